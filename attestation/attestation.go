@@ -0,0 +1,278 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package attestation creates signed statements that record how the policy
+// for a pull request was satisfied when it merged. Statements use the in-toto
+// format and are signed using DSSE envelopes, so deployment tooling can
+// verify the review provenance of a commit.
+package attestation
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v0.1"
+	PredicateType = "https://github.com/palantir/policy-bot/attestation/review/v1"
+	PayloadType   = "application/vnd.in-toto+json"
+)
+
+type Config struct {
+	// SigningKey is a PEM-encoded PKCS #8 Ed25519 private key. If it is
+	// empty, the key is read from SigningKeyPath.
+	SigningKey     string `yaml:"signing_key"`
+	SigningKeyPath string `yaml:"signing_key_path"`
+
+	// KeyID identifies the signing key in envelope signatures.
+	KeyID string `yaml:"key_id"`
+
+	// CheckRun enables posting attestations as a check run on the merge
+	// commit.
+	CheckRun bool `yaml:"check_run"`
+
+	// Endpoint is a URL that receives each attestation envelope in a POST
+	// request.
+	Endpoint string `yaml:"endpoint"`
+}
+
+// IsEnabled returns true if a signing key is configured.
+func (c *Config) IsEnabled() bool {
+	return c.SigningKey != "" || c.SigningKeyPath != ""
+}
+
+// Statement is an in-toto statement about a merge commit.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Review    `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Review is the predicate of a statement. It describes the pull request that
+// introduced the subject commit and the policy evaluation at the time of the
+// merge.
+type Review struct {
+	PullRequest    string    `json:"pull_request"`
+	URL            string    `json:"url,omitempty"`
+	BaseRef        string    `json:"base_ref"`
+	HeadSHA        string    `json:"head_sha"`
+	MergeCommitSHA string    `json:"merge_commit_sha"`
+	MergedAt       time.Time `json:"merged_at"`
+	PolicyPath     string    `json:"policy_path"`
+	PolicyRef      string    `json:"policy_ref"`
+	PolicyVersion  string    `json:"policy_version,omitempty"`
+	EvaluatedAt    time.Time `json:"evaluated_at"`
+
+	// Approvers are the users whose approval counted toward any rule.
+	Approvers []string `json:"approvers"`
+	Result    *Result  `json:"result"`
+}
+
+type Result struct {
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Description string    `json:"description,omitempty"`
+	Approvers   []string  `json:"approvers,omitempty"`
+	Children    []*Result `json:"children,omitempty"`
+}
+
+// NewResult converts an evaluation result for inclusion in a statement.
+func NewResult(r *common.Result) *Result {
+	if r == nil {
+		return nil
+	}
+
+	res := &Result{
+		Name:        r.Name,
+		Status:      r.Status.String(),
+		Description: r.Description,
+		Approvers:   r.Approvers,
+	}
+	for _, c := range r.Children {
+		res.Children = append(res.Children, NewResult(c))
+	}
+	return res
+}
+
+// AllApprovers returns the sorted, unique approvers of all approved rules in the
+// result.
+func (r *Result) AllApprovers() []string {
+	seen := make(map[string]bool)
+
+	var visit func(*Result)
+	visit = func(r *Result) {
+		if r.Status == common.StatusApproved.String() {
+			for _, a := range r.Approvers {
+				seen[a] = true
+			}
+		}
+		for _, c := range r.Children {
+			visit(c)
+		}
+	}
+	visit(r)
+
+	approvers := make([]string, 0, len(seen))
+	for a := range seen {
+		approvers = append(approvers, a)
+	}
+	sort.Strings(approvers)
+	return approvers
+}
+
+// NewStatement creates a statement for the merge commit of a pull request in
+// a repository identified as "owner/name" with the given review details.
+func NewStatement(repository string, review Review) *Statement {
+	if review.Result != nil && review.Approvers == nil {
+		review.Approvers = review.Result.AllApprovers()
+	}
+	return &Statement{
+		Type: StatementType,
+		Subject: []Subject{
+			{
+				Name:   fmt.Sprintf("git+https://github.com/%s", repository),
+				Digest: map[string]string{"gitCommit": review.MergeCommitSHA},
+			},
+		},
+		PredicateType: PredicateType,
+		Predicate:     review,
+	}
+}
+
+// Envelope is a DSSE envelope containing a signed statement.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// Signer signs statements with an Ed25519 key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner creates a Signer using the key in the configuration.
+func NewSigner(c Config) (*Signer, error) {
+	keyPEM := []byte(c.SigningKey)
+	if len(keyPEM) == 0 {
+		b, err := ioutil.ReadFile(c.SigningKeyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read signing key")
+		}
+		keyPEM = b
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM-encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse signing key")
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("signing key has unsupported type %T, expected Ed25519", key)
+	}
+	return &Signer{key: edKey, keyID: c.KeyID}, nil
+}
+
+// PublicKey returns the public key that verifies signatures by this signer.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign serializes and signs a statement.
+func (s *Signer) Sign(stmt *Statement) (*Envelope, error) {
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal statement")
+	}
+
+	sig := ed25519.Sign(s.key, pae(PayloadType, payload))
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []Signature{
+			{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}, nil
+}
+
+// Verify checks that the envelope has a valid signature by the public key and
+// returns the statement it contains.
+func Verify(env *Envelope, pub ed25519.PublicKey) (*Statement, error) {
+	if env.PayloadType != PayloadType {
+		return nil, errors.Errorf("unexpected payload type %q", env.PayloadType)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode payload")
+	}
+
+	verified := false
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(pub, pae(env.PayloadType, payload), sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("no valid signature for the public key")
+	}
+
+	var stmt Statement
+	if err := json.Unmarshal(payload, &stmt); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal statement")
+	}
+	if stmt.PredicateType != PredicateType {
+		return nil, errors.Errorf("unexpected predicate type %q", stmt.PredicateType)
+	}
+	return &stmt, nil
+}
+
+// pae computes the DSSE pre-authentication encoding of a payload.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
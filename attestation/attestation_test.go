@@ -0,0 +1,116 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attestation
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+func newTestSigner(t *testing.T) *Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	signer, err := NewSigner(Config{
+		SigningKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		KeyID:      "test-key",
+	})
+	require.NoError(t, err)
+	return signer
+}
+
+func testResult() *common.Result {
+	return &common.Result{
+		Name:   "policy",
+		Status: common.StatusApproved,
+		Children: []*common.Result{
+			{
+				Name:   "approval",
+				Status: common.StatusApproved,
+				Children: []*common.Result{
+					{Name: "rule1", Status: common.StatusApproved, Approvers: []string{"bob", "alice"}},
+					{Name: "rule2", Status: common.StatusApproved, Approvers: []string{"alice"}},
+					{Name: "rule3", Status: common.StatusPending, Approvers: []string{"carol"}},
+				},
+			},
+		},
+	}
+}
+
+func TestNewStatement(t *testing.T) {
+	stmt := NewStatement("palantir/policy-bot", Review{
+		PullRequest:    "palantir/policy-bot#1",
+		MergeCommitSHA: "abc123",
+		Result:         NewResult(testResult()),
+	})
+
+	assert.Equal(t, StatementType, stmt.Type)
+	assert.Equal(t, []Subject{
+		{
+			Name:   "git+https://github.com/palantir/policy-bot",
+			Digest: map[string]string{"gitCommit": "abc123"},
+		},
+	}, stmt.Subject)
+	assert.Equal(t, []string{"alice", "bob"}, stmt.Predicate.Approvers, "approvers of pending rules must not be included")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	stmt := NewStatement("palantir/policy-bot", Review{
+		PullRequest:    "palantir/policy-bot#1",
+		MergeCommitSHA: "abc123",
+		MergedAt:       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Result:         NewResult(testResult()),
+	})
+
+	env, err := signer.Sign(stmt)
+	require.NoError(t, err)
+	assert.Equal(t, PayloadType, env.PayloadType)
+	assert.Equal(t, "test-key", env.Signatures[0].KeyID)
+
+	verified, err := Verify(env, signer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, stmt, verified)
+
+	t.Run("wrongKey", func(t *testing.T) {
+		_, err := Verify(env, newTestSigner(t).PublicKey())
+		assert.Error(t, err)
+	})
+
+	t.Run("tamperedPayload", func(t *testing.T) {
+		tampered := *env
+		tampered.Payload = env.Payload[:len(env.Payload)-4] + "AAAA"
+
+		_, err := Verify(&tampered, signer.PublicKey())
+		assert.Error(t, err)
+	})
+}
+
+func TestNewSignerInvalidKey(t *testing.T) {
+	_, err := NewSigner(Config{SigningKey: "not a key"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditlog cross-checks the approvals of a pull request against the
+// GitHub Enterprise audit log to find approvals that may not be trustworthy,
+// like approvals by users who recently joined the organization.
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	ActionAddMember     = "org.add_member"
+	ActionDismissReview = "pull_request_review.dismiss"
+
+	DefaultWindow   = 7 * 24 * time.Hour
+	DefaultCacheTTL = 5 * time.Minute
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Window is how far back to search the audit log. Approvals by users who
+	// joined the organization or had reviews dismissed within the window are
+	// flagged. If unset, DefaultWindow is used.
+	Window time.Duration `yaml:"window"`
+
+	// CacheTTL is how long to reuse audit log search results. If unset,
+	// DefaultCacheTTL is used.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// IsEnabled returns true if audit log checks are enabled.
+func (c *Config) IsEnabled() bool {
+	return c.Enabled
+}
+
+// Event is an entry in the audit log.
+type Event struct {
+	Action string `json:"action"`
+	Actor  string `json:"actor"`
+	User   string `json:"user"`
+	Repo   string `json:"repo"`
+
+	// Timestamp is the time of the event in milliseconds since the epoch.
+	Timestamp int64 `json:"@timestamp"`
+}
+
+// Time returns the time of the event.
+func (e *Event) Time() time.Time {
+	return time.Unix(0, e.Timestamp*int64(time.Millisecond)).UTC()
+}
+
+// Source searches the audit log of an organization.
+type Source interface {
+	Events(ctx context.Context, org, phrase string) ([]*Event, error)
+}
+
+// GitHubSource is a Source that uses the audit log API of GitHub Enterprise.
+// It returns at most the 100 most recent events for each search.
+type GitHubSource struct {
+	Client *github.Client
+}
+
+var _ Source = &GitHubSource{}
+
+func (s *GitHubSource) Events(ctx context.Context, org, phrase string) ([]*Event, error) {
+	u := fmt.Sprintf("orgs/%s/audit-log?phrase=%s&per_page=100", url.PathEscape(org), url.QueryEscape(phrase))
+
+	req, err := s.Client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create audit log request")
+	}
+
+	var events []*Event
+	if _, err := s.Client.Do(ctx, req, &events); err != nil {
+		return nil, errors.Wrapf(err, "failed to search audit log of %s", org)
+	}
+	return events, nil
+}
+
+// Finding is a suspicious approval found in the audit log. Message describes
+// the finding for display.
+type Finding struct {
+	User    string
+	Message string
+}
+
+type cacheEntry struct {
+	expires time.Time
+	events  []*Event
+}
+
+// Checker finds suspicious approvals using an audit log Source. It caches
+// search results for each organization.
+type Checker struct {
+	config Config
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewChecker creates a Checker for the configuration.
+func NewChecker(c Config) *Checker {
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+	return &Checker{
+		config: c,
+		now:    time.Now,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+// Check returns findings for the approvers of a pull request in a repository
+// owned by org. Findings are ordered by user and then by time.
+func (c *Checker) Check(ctx context.Context, src Source, org, repo string, approvers []string) ([]Finding, error) {
+	if len(approvers) == 0 {
+		return nil, nil
+	}
+
+	isApprover := make(map[string]bool, len(approvers))
+	for _, u := range approvers {
+		isApprover[u] = true
+	}
+
+	since := c.now().Add(-c.config.Window).UTC().Format("2006-01-02")
+
+	added, err := c.events(ctx, src, org, fmt.Sprintf("action:%s created:>=%s", ActionAddMember, since))
+	if err != nil {
+		return nil, err
+	}
+
+	dismissed, err := c.events(ctx, src, org, fmt.Sprintf("action:%s repo:%s/%s created:>=%s", ActionDismissReview, org, repo, since))
+	if err != nil {
+		return nil, err
+	}
+
+	type timedFinding struct {
+		Finding
+		at time.Time
+	}
+
+	var found []timedFinding
+	for _, e := range added {
+		if isApprover[e.User] {
+			found = append(found, timedFinding{
+				Finding: Finding{
+					User:    e.User,
+					Message: fmt.Sprintf("Approver %s was added to %s on %s", e.User, org, e.Time().Format("2006-01-02")),
+				},
+				at: e.Time(),
+			})
+		}
+	}
+	for _, e := range dismissed {
+		if isApprover[e.User] {
+			found = append(found, timedFinding{
+				Finding: Finding{
+					User:    e.User,
+					Message: fmt.Sprintf("A review by approver %s was dismissed by %s on %s", e.User, e.Actor, e.Time().Format("2006-01-02")),
+				},
+				at: e.Time(),
+			})
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].User != found[j].User {
+			return found[i].User < found[j].User
+		}
+		return found[i].at.Before(found[j].at)
+	})
+
+	findings := make([]Finding, len(found))
+	for i, f := range found {
+		findings[i] = f.Finding
+	}
+	return findings, nil
+}
+
+// Flush discards all cached search results.
+func (c *Checker) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache = make(map[string]cacheEntry)
+}
+
+func (c *Checker) events(ctx context.Context, src Source, org, phrase string) ([]*Event, error) {
+	key := org + ":" + phrase
+
+	c.mu.Lock()
+	e, ok := c.cache[key]
+	c.mu.Unlock()
+
+	if ok && c.now().Before(e.expires) {
+		return e.events, nil
+	}
+
+	events, err := src.Events(ctx, org, phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[key] = cacheEntry{expires: c.now().Add(c.config.CacheTTL), events: events}
+	c.mu.Unlock()
+
+	return events, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticSource struct {
+	events   map[string][]*Event
+	requests int
+}
+
+func (s *staticSource) Events(ctx context.Context, org, phrase string) ([]*Event, error) {
+	s.requests++
+	return s.events[org+":"+phrase], nil
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2020, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	src := &staticSource{
+		events: map[string][]*Event{
+			"testorg:action:org.add_member created:>=2020-03-03": {
+				{Action: ActionAddMember, Actor: "admin", User: "newbie", Timestamp: millis(now.Add(-24 * time.Hour))},
+				{Action: ActionAddMember, Actor: "admin", User: "bystander", Timestamp: millis(now.Add(-24 * time.Hour))},
+			},
+			"testorg:action:pull_request_review.dismiss repo:testorg/testrepo created:>=2020-03-03": {
+				{Action: ActionDismissReview, Actor: "admin", User: "newbie", Timestamp: millis(now.Add(-2 * time.Hour))},
+				{Action: ActionDismissReview, Actor: "admin", User: "veteran", Timestamp: millis(now.Add(-3 * time.Hour))},
+			},
+		},
+	}
+
+	c := NewChecker(Config{Enabled: true})
+	c.now = func() time.Time { return now }
+
+	findings, err := c.Check(context.Background(), src, "testorg", "testrepo", []string{"veteran", "newbie"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Finding{
+		{User: "newbie", Message: "Approver newbie was added to testorg on 2020-03-09"},
+		{User: "newbie", Message: "A review by approver newbie was dismissed by admin on 2020-03-10"},
+		{User: "veteran", Message: "A review by approver veteran was dismissed by admin on 2020-03-10"},
+	}, findings)
+	assert.Equal(t, 2, src.requests)
+
+	_, err = c.Check(context.Background(), src, "testorg", "testrepo", []string{"newbie"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, src.requests, "searches should be cached")
+
+	findings, err = c.Check(context.Background(), src, "testorg", "testrepo", nil)
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+}
+
+func TestGitHubSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/testorg/audit-log", r.URL.Path)
+		assert.Equal(t, "action:org.add_member", r.URL.Query().Get("phrase"))
+		fmt.Fprint(w, `[{"action": "org.add_member", "actor": "admin", "user": "newbie", "@timestamp": 1583712000000}]`)
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	src := &GitHubSource{Client: client}
+	events, err := src.Events(context.Background(), "testorg", "action:org.add_member")
+	require.NoError(t, err)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, "newbie", events[0].User)
+	assert.Equal(t, time.Date(2020, time.March, 9, 0, 0, 0, 0, time.UTC), events[0].Time())
+}
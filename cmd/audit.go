@@ -0,0 +1,149 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policyaudit"
+	"github.com/palantir/policy-bot/version"
+)
+
+var auditCmdConfig struct {
+	ConfigPath      string
+	Org             string
+	PolicyPath      string
+	Format          string
+	Output          string
+	Parallelism     int
+	IncludeArchived bool
+}
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Reports whether open pull requests in an organization comply with a policy.",
+	Long: "Evaluates the open pull requests of every repository in an organization against a policy file " +
+		"without posting statuses and writes a CSV or JSON compliance report. Uses the GitHub App " +
+		"credentials from the server configuration.",
+
+	RunE: auditCmd,
+}
+
+func auditCmd(cmd *cobra.Command, args []string) error {
+	cfg := &auditCmdConfig
+	if cfg.Org == "" || cfg.PolicyPath == "" {
+		return errors.New("--org and --policy are required")
+	}
+	if cfg.Format != policyaudit.FormatCSV && cfg.Format != policyaudit.FormatJSON {
+		return errors.Errorf("invalid format %q, must be %q or %q", cfg.Format, policyaudit.FormatCSV, policyaudit.FormatJSON)
+	}
+
+	serverConfig, err := readServerConfig(cfg.ConfigPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to read server config")
+	}
+
+	policyData, err := ioutil.ReadFile(cfg.PolicyPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to read policy")
+	}
+
+	config, err := policy.ParseConfig(policyData)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy %s", cfg.PolicyPath)
+	}
+
+	evaluator, err := policy.ParsePolicy(config)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy %s", cfg.PolicyPath)
+	}
+
+	userAgent := fmt.Sprintf("%s/%s", serverConfig.Options.AppName, version.GetVersion())
+	cc, err := githubapp.NewDefaultCachingClientCreator(serverConfig.Github, githubapp.WithClientUserAgent(userAgent))
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize client creator")
+	}
+
+	appClient, err := cc.NewAppClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize Github app client")
+	}
+
+	level := zerolog.InfoLevel
+	if IsDebugMode() {
+		level = zerolog.DebugLevel
+	}
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger()
+	ctx := logger.WithContext(context.Background())
+
+	auditor := &policyaudit.Auditor{
+		ClientCreator:   cc,
+		Installations:   githubapp.NewInstallationsService(appClient),
+		Evaluator:       evaluator,
+		Options:         &serverConfig.Options,
+		Parallelism:     cfg.Parallelism,
+		IncludeArchived: cfg.IncludeArchived,
+	}
+
+	records, err := auditor.Audit(ctx, cfg.Org)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = cmd.OutOrStdout()
+	if cfg.Output != "" && cfg.Output != "-" {
+		f, err := os.Create(cfg.Output)
+		if err != nil {
+			return errors.Wrap(err, "failed to create report file")
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	if err := policyaudit.WriteReport(out, cfg.Format, records); err != nil {
+		return err
+	}
+
+	compliant := 0
+	for _, r := range records {
+		if r.Compliant() {
+			compliant++
+		}
+	}
+	logger.Info().Msgf("%d of %d open pull requests comply with the policy", compliant, len(records))
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(AuditCmd)
+
+	AuditCmd.Flags().StringVarP(&auditCmdConfig.ConfigPath, "config", "c", "config/policy-bot.yml", "configuration file for policy-bot")
+	AuditCmd.Flags().StringVar(&auditCmdConfig.Org, "org", "", "organization to audit")
+	AuditCmd.Flags().StringVar(&auditCmdConfig.PolicyPath, "policy", "", "policy file to evaluate pull requests against")
+	AuditCmd.Flags().StringVar(&auditCmdConfig.Format, "format", policyaudit.FormatCSV, "report format, csv or json")
+	AuditCmd.Flags().StringVarP(&auditCmdConfig.Output, "output", "o", "", "file to write the report to (default stdout)")
+	AuditCmd.Flags().IntVar(&auditCmdConfig.Parallelism, "parallelism", policyaudit.DefaultParallelism, "number of pull requests to evaluate at the same time")
+	AuditCmd.Flags().BoolVar(&auditCmdConfig.IncludeArchived, "include-archived", false, "also audit archived repositories")
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/policytest"
+	"github.com/palantir/policy-bot/snapshot"
+	"github.com/palantir/policy-bot/store"
+)
+
+var replayCmdConfig struct {
+	SnapshotPath string
+	PolicyPath   string
+	KeyFiles     []string
+	Inspect      bool
+}
+
+var ReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replays a stored evaluation snapshot offline.",
+	Long: "Evaluates a policy against the pull request data recorded in an evaluation snapshot and prints " +
+		"the differences from the recorded result. Uses the policy recorded in the snapshot unless --policy " +
+		"is set. Encrypted snapshots require the key files used by the server.",
+
+	RunE: replayCmd,
+}
+
+func replayCmd(cmd *cobra.Command, args []string) error {
+	cfg := &replayCmdConfig
+	if cfg.SnapshotPath == "" {
+		return errors.New("--snapshot is required")
+	}
+
+	s, err := snapshot.Read(cfg.SnapshotPath, store.EncryptionConfig{KeyFiles: cfg.KeyFiles})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if cfg.Inspect {
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to encode snapshot")
+		}
+		fmt.Fprintf(out, "%s\n", b)
+		return nil
+	}
+
+	policyData := []byte(s.Policy)
+	policyName := "recorded policy"
+	if cfg.PolicyPath != "" {
+		if policyData, err = ioutil.ReadFile(cfg.PolicyPath); err != nil {
+			return errors.Wrap(err, "failed to read policy")
+		}
+		policyName = cfg.PolicyPath
+	}
+	if len(policyData) == 0 {
+		return errors.New("snapshot does not contain the policy, set --policy")
+	}
+
+	config, err := policy.ParseConfig(policyData)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy %s", policyName)
+	}
+
+	evaluator, err := policy.ParsePolicy(config)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy %s", policyName)
+	}
+
+	result := evaluator.Evaluate(context.Background(), snapshot.NewContext(s))
+
+	fmt.Fprintf(out, "Replayed %s at %s with the %s, recorded at %s\n\n", s.Locator, s.HeadSHA, policyName, s.EvaluatedAt.Format(time.RFC3339))
+	fmt.Fprint(out, policytest.FormatResult(&result))
+
+	diffs := snapshot.Diff(s.Result, snapshot.NewResult(&result))
+	if len(diffs) == 0 {
+		fmt.Fprintf(out, "\nThe replayed result matches the recorded result\n")
+		return nil
+	}
+
+	fmt.Fprintf(out, "\nDifferences from the recorded result:\n")
+	for _, d := range diffs {
+		fmt.Fprintf(out, "    %s\n", d)
+	}
+	return errors.Errorf("%d result(s) differ from the recorded result", len(diffs))
+}
+
+func init() {
+	RootCmd.AddCommand(ReplayCmd)
+
+	ReplayCmd.Flags().StringVar(&replayCmdConfig.SnapshotPath, "snapshot", "", "evaluation snapshot to replay")
+	ReplayCmd.Flags().StringVar(&replayCmdConfig.PolicyPath, "policy", "", "policy file to evaluate instead of the recorded policy")
+	ReplayCmd.Flags().StringSliceVar(&replayCmdConfig.KeyFiles, "key-file", nil, "key file that decrypts the snapshot; may be repeated")
+	ReplayCmd.Flags().BoolVar(&replayCmdConfig.Inspect, "inspect", false, "print the decrypted snapshot instead of replaying it")
+}
@@ -72,6 +72,9 @@ func serverCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	s.SetConfigLoader(func() (*server.Config, error) {
+		return readServerConfig(serverCmdConfig.Path)
+	})
 
 	return errors.Wrap(s.Start(), "server terminated")
 }
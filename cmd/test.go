@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/policytest"
+)
+
+var TestCmd = &cobra.Command{
+	Use:   "test [suite files...]",
+	Short: "Runs policy test suites.",
+	Long: "Evaluates the hypothetical pull requests in each policy test suite and checks the results. " +
+		"If no files are given, runs " + policytest.DefaultSuiteFile + " in the current directory.",
+
+	RunE: testCmd,
+}
+
+func testCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{policytest.DefaultSuiteFile}
+	}
+
+	out := cmd.OutOrStdout()
+
+	var passed, failed int
+	for _, path := range args {
+		results, err := runSuite(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to run test suite %s", path)
+		}
+
+		for _, r := range results {
+			if r.Passed() {
+				passed++
+				fmt.Fprintf(out, "PASS %s: %s\n", path, r.Name)
+				continue
+			}
+
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %s\n", path, r.Name)
+			for _, f := range r.Failures {
+				fmt.Fprintf(out, "    %s\n", f)
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return errors.Errorf("%d test case(s) failed", failed)
+	}
+	return nil
+}
+
+func runSuite(path string) ([]*policytest.CaseResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read test suite")
+	}
+
+	suite, err := policytest.ParseSuite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	policyPath := suite.Policy
+	if !filepath.IsAbs(policyPath) {
+		policyPath = filepath.Join(filepath.Dir(path), policyPath)
+	}
+
+	policyData, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read policy")
+	}
+
+	config, err := policy.ParseConfig(policyData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid policy %s", policyPath)
+	}
+
+	evaluator, err := policy.ParsePolicy(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid policy %s", policyPath)
+	}
+
+	return suite.Run(context.Background(), evaluator), nil
+}
+
+func init() {
+	RootCmd.AddCommand(TestCmd)
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delivery records processed webhook deliveries so that duplicate
+// and replayed deliveries are processed only once, and so that operators can
+// process a recorded delivery again on purpose.
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/store"
+)
+
+const (
+	DefaultTTL = 72 * time.Hour
+
+	deliveryKeyPrefix = "delivery/id/"
+	payloadKeyPrefix  = "delivery/payload/"
+)
+
+// ErrUnknownDelivery is returned when replaying a delivery that was not
+// recorded or whose record expired.
+var ErrUnknownDelivery = errors.New("unknown delivery")
+
+type Config struct {
+	// Enabled records processed deliveries and skips duplicates.
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long deliveries are remembered. If unset, DefaultTTL is
+	// used.
+	TTL time.Duration `yaml:"ttl"`
+
+	// RecordPayloads keeps the payload of each delivery so that it can be
+	// replayed from the admin page. Payloads can be large, so this increases
+	// the size of the store.
+	RecordPayloads bool `yaml:"record_payloads"`
+}
+
+func (c *Config) IsEnabled() bool {
+	return c.Enabled
+}
+
+// record is the stored state of a delivery.
+type record struct {
+	Type        string    `json:"type"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Payload     []byte    `json:"payload,omitempty"`
+}
+
+// Recorder wraps event handlers to deduplicate deliveries. Deliveries are
+// identified by their delivery ID and by a hash of their payload: GitHub
+// signs the payload but not the delivery ID header, so a captured delivery
+// sent again with a new ID is still detected. Servers must share a store to
+// detect duplicates received by different servers.
+//
+// Every delivery writes to the store when it is claimed and again when a
+// failed delivery is forgotten. The file store rewrites and re-encrypts the
+// whole file on each write, so record deliveries with the memory store on
+// servers that receive many events.
+type Recorder struct {
+	store    store.Store
+	ttl      time.Duration
+	payloads bool
+	handlers map[string]githubapp.EventHandler
+}
+
+func New(c Config, st store.Store) *Recorder {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Recorder{
+		store:    st,
+		ttl:      ttl,
+		payloads: c.RecordPayloads,
+		handlers: make(map[string]githubapp.EventHandler),
+	}
+}
+
+// Wrap returns an event handler that skips deliveries that were already
+// processed and records deliveries before passing them to h. If h fails, the
+// record is removed so that a redelivery is processed. Wrap must not be
+// called concurrently with handling events.
+func (r *Recorder) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	for _, e := range h.Handles() {
+		if _, ok := r.handlers[e]; !ok {
+			r.handlers[e] = h
+		}
+	}
+	return &recordedHandler{recorder: r, handler: h}
+}
+
+// Replay processes a recorded delivery again, bypassing deduplication. It
+// returns ErrUnknownDelivery if the delivery was not recorded with its
+// payload.
+func (r *Recorder) Replay(ctx context.Context, deliveryID string) error {
+	value, ok, err := r.store.Get(ctx, deliveryKeyPrefix+deliveryID)
+	if err != nil {
+		return errors.Wrap(err, "failed to read delivery")
+	}
+
+	var rec record
+	if ok {
+		if err := json.Unmarshal(value, &rec); err != nil {
+			return errors.Wrap(err, "failed to decode delivery")
+		}
+	}
+	if rec.Payload == nil {
+		return ErrUnknownDelivery
+	}
+
+	h, ok := r.handlers[rec.Type]
+	if !ok {
+		return errors.Errorf("no handler for %s events", rec.Type)
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str(githubapp.LogKeyEventType, rec.Type).
+		Str(githubapp.LogKeyDeliveryID, deliveryID).
+		Logger()
+	logger.Info().Msg("Replaying recorded delivery")
+
+	return h.Handle(logger.WithContext(ctx), rec.Type, deliveryID, rec.Payload)
+}
+
+func payloadKey(eventType string, payload []byte) string {
+	sum := sha256.Sum256(append([]byte(eventType+"\n"), payload...))
+	return payloadKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// deliveryKeys returns the store keys that identify a delivery.
+func deliveryKeys(eventType, deliveryID string, payload []byte) []string {
+	keys := []string{payloadKey(eventType, payload)}
+	if deliveryID != "" {
+		keys = append(keys, deliveryKeyPrefix+deliveryID)
+	}
+	return keys
+}
+
+// claim records the delivery and returns true if neither its ID nor its
+// payload was recorded. Each key is set with an atomic put-if-absent, so
+// concurrent deliveries of the same event are claimed by exactly one caller.
+func (r *Recorder) claim(ctx context.Context, eventType, deliveryID string, payload []byte) (bool, error) {
+	claimed, err := r.store.PutIfAbsent(ctx, payloadKey(eventType, payload), []byte(deliveryID), r.ttl)
+	if err != nil || !claimed {
+		return false, err
+	}
+	if deliveryID == "" {
+		return true, nil
+	}
+
+	rec := record{Type: eventType, ProcessedAt: time.Now().UTC()}
+	if r.payloads {
+		rec.Payload = payload
+	}
+
+	value, err := json.Marshal(rec)
+	if err != nil {
+		r.release(ctx, payloadKey(eventType, payload))
+		return false, errors.Wrap(err, "failed to encode delivery")
+	}
+
+	claimed, err = r.store.PutIfAbsent(ctx, deliveryKeyPrefix+deliveryID, value, r.ttl)
+	if err != nil || !claimed {
+		// a different payload with a known ID is still a duplicate, but the
+		// payload was not processed, so it must not stay recorded
+		r.release(ctx, payloadKey(eventType, payload))
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Recorder) delete(ctx context.Context, eventType, deliveryID string, payload []byte) {
+	r.release(ctx, deliveryKeys(eventType, deliveryID, payload)...)
+}
+
+func (r *Recorder) release(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := r.store.Delete(ctx, key); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to remove record of failed delivery")
+		}
+	}
+}
+
+type recordedHandler struct {
+	recorder *Recorder
+	handler  githubapp.EventHandler
+}
+
+func (h *recordedHandler) Handles() []string {
+	return h.handler.Handles()
+}
+
+func (h *recordedHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	r := h.recorder
+
+	claimed, err := r.claim(ctx, eventType, deliveryID, payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to record delivery")
+	}
+	if !claimed {
+		zerolog.Ctx(ctx).Info().Msg("Skipping duplicate delivery")
+		return nil
+	}
+
+	if err := h.handler.Handle(ctx, eventType, deliveryID, payload); err != nil {
+		r.delete(ctx, eventType, deliveryID, payload)
+		return err
+	}
+	return nil
+}
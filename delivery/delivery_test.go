@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/store"
+)
+
+type testHandler struct {
+	mu      sync.Mutex
+	handled []string
+	fail    bool
+}
+
+func (h *testHandler) Handles() []string { return []string{"pull_request"} }
+
+func (h *testHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if h.fail {
+		return errors.New("handler failed")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handled = append(h.handled, deliveryID)
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("skipsDuplicates", func(t *testing.T) {
+		h := &testHandler{}
+		wrapped := New(Config{Enabled: true}, store.NewMemory()).Wrap(h)
+
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "2", []byte(`{"number":1}`)))
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "3", []byte(`{"number":3}`)))
+
+		assert.Equal(t, []string{"1", "3"}, h.handled, "deliveries with a known ID or payload should be skipped")
+	})
+
+	t.Run("skipsConcurrentDuplicates", func(t *testing.T) {
+		h := &testHandler{}
+		wrapped := New(Config{Enabled: true}, store.NewMemory()).Wrap(h)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, []string{"1"}, h.handled, "concurrent deliveries should be handled once")
+	})
+
+	t.Run("retriesFailures", func(t *testing.T) {
+		h := &testHandler{fail: true}
+		wrapped := New(Config{Enabled: true}, store.NewMemory()).Wrap(h)
+
+		assert.Error(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+
+		h.fail = false
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+		assert.Equal(t, []string{"1"}, h.handled, "failed deliveries should be processed when redelivered")
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		h := &testHandler{}
+		r := New(Config{Enabled: true, RecordPayloads: true}, store.NewMemory())
+		wrapped := r.Wrap(h)
+
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+		require.NoError(t, r.Replay(ctx, "1"))
+		assert.Equal(t, []string{"1", "1"}, h.handled)
+
+		assert.Equal(t, ErrUnknownDelivery, r.Replay(ctx, "2"))
+	})
+
+	t.Run("replayRequiresPayloads", func(t *testing.T) {
+		h := &testHandler{}
+		r := New(Config{Enabled: true}, store.NewMemory())
+		wrapped := r.Wrap(h)
+
+		require.NoError(t, wrapped.Handle(ctx, "pull_request", "1", []byte(`{"number":1}`)))
+		assert.Equal(t, ErrUnknownDelivery, r.Replay(ctx, "1"))
+	})
+}
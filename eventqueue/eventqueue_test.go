@@ -0,0 +1,326 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventqueue
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/delivery"
+	"github.com/palantir/policy-bot/store"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := []Config{
+		{},
+		{Mode: ModeAll},
+		{Mode: ModeReceiver, Type: TypeSQS, SQS: SQSConfig{QueueURL: "https://sqs.us-east-1.amazonaws.com/123/events", Region: "us-east-1"}},
+	}
+	for _, c := range valid {
+		assert.NoError(t, c.Validate(), "config %+v should be valid", c)
+	}
+
+	invalid := map[string]Config{
+		`unknown queue mode "sometimes"`:       {Mode: "sometimes"},
+		`memory queue requires the "all" mode`: {Mode: ModeWorker},
+		"sqs queue must specify a queue_url":   {Mode: ModeWorker, Type: TypeSQS},
+		"sqs queue must specify a region":      {Mode: ModeWorker, Type: TypeSQS, SQS: SQSConfig{QueueURL: "https://sqs/123/events"}},
+		`unknown queue type "kafka"`:           {Mode: ModeWorker, Type: "kafka"},
+	}
+	for msg, c := range invalid {
+		assert.EqualError(t, c.Validate(), msg)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory()
+	q.VisibilityTimeout = -time.Second
+
+	require.NoError(t, q.Send(ctx, Event{Type: "pull_request", DeliveryID: "1"}))
+	require.NoError(t, q.Send(ctx, Event{Type: "status", DeliveryID: "2"}))
+
+	msgs, err := q.Receive(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "1", msgs[0].Event.DeliveryID)
+	assert.Equal(t, "2", msgs[1].Event.DeliveryID)
+
+	require.NoError(t, q.Ack(ctx, msgs[0]))
+
+	msgs, err = q.Receive(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1, "unacknowledged message should be delivered again")
+	assert.Equal(t, "2", msgs[0].Event.DeliveryID)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	q.VisibilityTimeout = time.Hour
+	_, _ = q.Receive(ctx)
+	_, err = q.Receive(cctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMemoryDrain(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory()
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, q.Send(ctx, Event{Type: "status", DeliveryID: id}))
+	}
+
+	msgs, err := q.Receive(ctx)
+	require.NoError(t, err)
+	require.NoError(t, q.Ack(ctx, msgs[1]))
+	require.NoError(t, q.Send(ctx, Event{Type: "status", DeliveryID: "4"}))
+
+	events := q.Drain()
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.DeliveryID)
+	}
+	assert.Equal(t, []string{"1", "3", "4"}, ids, "unacknowledged events should be drained in order")
+	assert.Empty(t, q.Drain())
+}
+
+func TestPending(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	h := &testHandler{fail: map[string]bool{"bad": true}}
+
+	events := []Event{
+		{Type: "status", DeliveryID: "1", Payload: []byte(`{}`)},
+		{Type: "issue_comment", DeliveryID: "other"},
+		{Type: "pull_request", DeliveryID: "bad"},
+		{Type: "pull_request", DeliveryID: "2"},
+	}
+	require.NoError(t, SavePending(ctx, st, events))
+
+	count, err := ResumePending(ctx, st, h)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"1", "2"}, h.handled)
+
+	count, err = ResumePending(ctx, st, h)
+	require.NoError(t, err)
+	assert.Zero(t, count, "resumed events should be removed")
+}
+
+type testHandler struct {
+	mu      sync.Mutex
+	handled []string
+	fail    map[string]bool
+}
+
+func (h *testHandler) Handles() []string {
+	return []string{"pull_request", "status"}
+}
+
+func (h *testHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.fail[deliveryID] {
+		return errors.New("handler failed")
+	}
+	h.handled = append(h.handled, deliveryID)
+	return nil
+}
+
+func TestReceiver(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory()
+
+	r := NewReceiver(q, &testHandler{}, &testHandler{})
+	assert.Equal(t, []string{"pull_request", "status"}, r.Handles())
+
+	require.NoError(t, r.Handle(ctx, "pull_request", "abc", []byte(`{"action":"opened"}`)))
+
+	msgs, err := q.Receive(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, Event{Type: "pull_request", DeliveryID: "abc", Payload: []byte(`{"action":"opened"}`)}, msgs[0].Event)
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory()
+	h := &testHandler{fail: map[string]bool{"bad": true}}
+
+	w := NewWorker(Config{Workers: 1}, q, delivery.New(delivery.Config{Enabled: true}, store.NewMemory()), h)
+
+	for _, id := range []string{"good", "bad", "good", "bad"} {
+		msgs := []*Message{{Event: Event{Type: "pull_request", DeliveryID: id, Payload: []byte(`{"id":"` + id + `"}`)}, Handle: id}}
+		q.inflight[id] = inflightMessage{msg: msgs[0], deadline: time.Now().Add(time.Hour)}
+		w.process(ctx, msgs[0])
+	}
+	w.process(ctx, &Message{Event: Event{Type: "issue_comment", DeliveryID: "other"}, Handle: "other"})
+
+	assert.Equal(t, []string{"good"}, h.handled, "duplicate deliveries should be skipped")
+
+	_, ok := q.inflight["good"]
+	assert.False(t, ok, "processed event should be acknowledged")
+	_, ok = q.inflight["bad"]
+	assert.True(t, ok, "failed event should not be acknowledged")
+
+	h.fail["bad"] = false
+	w.process(ctx, &Message{Event: Event{Type: "pull_request", DeliveryID: "bad", Payload: []byte(`{"id":"bad"}`)}, Handle: "bad"})
+	assert.Equal(t, []string{"good", "bad"}, h.handled, "failed deliveries should be processed when they are delivered again")
+}
+
+func TestWorkerConcurrentDuplicates(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory()
+	h := &testHandler{}
+
+	w := NewWorker(Config{Workers: 4}, q, delivery.New(delivery.Config{Enabled: true}, store.NewMemory()), h)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.process(ctx, &Message{Event: Event{Type: "status", DeliveryID: "dup", Payload: []byte(`{}`)}, Handle: "dup"})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{"dup"}, h.handled, "concurrent duplicates should be processed once")
+}
+
+func TestWorkerRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := NewMemory()
+	h := &testHandler{}
+
+	w := NewWorker(Config{Workers: 2}, q, delivery.New(delivery.Config{Enabled: true}, store.NewMemory()), h)
+
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, q.Send(ctx, Event{Type: "status", DeliveryID: id, Payload: []byte(`{"id":"` + id + `"}`)}))
+	}
+
+	handled := func() int {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.handled)
+	}
+	for deadline := time.Now().Add(5 * time.Second); handled() < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 3, handled())
+
+	cancel()
+	<-done
+}
+
+func TestSQS(t *testing.T) {
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-amz-json-1.0", r.Header.Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"), "request should be signed")
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var req map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, "https://sqs.example.com/123/events", req["QueueUrl"])
+
+		action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+		actions = append(actions, action)
+
+		switch action {
+		case "SendMessage":
+			var e Event
+			require.NoError(t, json.Unmarshal([]byte(req["MessageBody"].(string)), &e))
+			assert.Equal(t, "abc", e.DeliveryID)
+			_, _ = w.Write([]byte(`{"MessageId": "m1"}`))
+		case "ReceiveMessage":
+			assert.Equal(t, float64(20), req["WaitTimeSeconds"])
+			e, _ := json.Marshal(Event{Type: "status", DeliveryID: "abc", Payload: []byte(`{}`)})
+			res, _ := json.Marshal(map[string]interface{}{
+				"Messages": []map[string]string{{"MessageId": "m1", "ReceiptHandle": "r1", "Body": string(e)}},
+			})
+			_, _ = w.Write(res)
+		case "DeleteMessage":
+			assert.Equal(t, "r1", req["ReceiptHandle"])
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "InvalidAction", "message": "unknown action"}`))
+		}
+	}))
+	defer srv.Close()
+
+	q, err := NewSQS(SQSConfig{
+		QueueURL:        "https://sqs.example.com/123/events",
+		Region:          "us-east-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	}, srv.Client())
+	require.NoError(t, err)
+	q.endpoint = srv.URL + "/"
+
+	ctx := context.Background()
+	require.NoError(t, q.Send(ctx, Event{Type: "status", DeliveryID: "abc"}))
+
+	msgs, err := q.Receive(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "r1", msgs[0].Handle)
+	assert.Equal(t, "status", msgs[0].Event.Type)
+
+	require.NoError(t, q.Ack(ctx, msgs[0]))
+	assert.Equal(t, []string{"SendMessage", "ReceiveMessage", "DeleteMessage"}, actions)
+
+	err = q.call(ctx, "PurgeQueue", map[string]string{"QueueUrl": "https://sqs.example.com/123/events"}, nil)
+	assert.EqualError(t, err, "sqs returned status 400: InvalidAction unknown action")
+}
+
+func TestSignV4(t *testing.T) {
+	// example from the AWS Signature Version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds := credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signV4(req, nil, creds, "us-east-1", "iam", time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"),
+	)
+}
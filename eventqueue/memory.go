@@ -0,0 +1,151 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventqueue
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// memoryWaitTime is how long Receive waits for a message on a memory
+	// queue.
+	memoryWaitTime = time.Second
+
+	// DefaultMemoryVisibilityTimeout is how long a message received from a
+	// memory queue is hidden before it is delivered again if it is not
+	// acknowledged.
+	DefaultMemoryVisibilityTimeout = 5 * time.Minute
+)
+
+type inflightMessage struct {
+	msg      *Message
+	deadline time.Time
+}
+
+// Memory is an in-process Queue. It is useful for tests and for running the
+// receiver and workers in the same server.
+type Memory struct {
+	// VisibilityTimeout is how long received messages are hidden before they
+	// are delivered again if they are not acknowledged.
+	VisibilityTimeout time.Duration
+
+	mu       sync.Mutex
+	next     int
+	ready    []*Message
+	inflight map[string]inflightMessage
+	notify   chan struct{}
+}
+
+var _ Queue = &Memory{}
+
+// NewMemory creates an empty memory queue.
+func NewMemory() *Memory {
+	return &Memory{
+		VisibilityTimeout: DefaultMemoryVisibilityTimeout,
+		inflight:          make(map[string]inflightMessage),
+		notify:            make(chan struct{}, 1),
+	}
+}
+
+func (q *Memory) Send(ctx context.Context, e Event) error {
+	q.mu.Lock()
+	q.next++
+	q.ready = append(q.ready, &Message{Event: e, Handle: strconv.Itoa(q.next)})
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *Memory) Receive(ctx context.Context) ([]*Message, error) {
+	if msgs := q.take(); len(msgs) > 0 {
+		return msgs, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-q.notify:
+	case <-time.After(memoryWaitTime):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return q.take(), nil
+}
+
+func (q *Memory) Ack(ctx context.Context, m *Message) error {
+	q.mu.Lock()
+	delete(q.inflight, m.Handle)
+	q.mu.Unlock()
+	return nil
+}
+
+// Drain removes and returns the events of all messages that were not
+// acknowledged, including messages that are in flight. Because the queue
+// only exists in memory, servers drain it when they shut down to save the
+// events for the next server.
+func (q *Memory) Drain() []Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msgs := q.ready
+	for _, m := range q.inflight {
+		msgs = append(msgs, m.msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		a, _ := strconv.Atoi(msgs[i].Handle)
+		b, _ := strconv.Atoi(msgs[j].Handle)
+		return a < b
+	})
+
+	events := make([]Event, len(msgs))
+	for i, m := range msgs {
+		events[i] = m.Event
+	}
+
+	q.ready = nil
+	q.inflight = make(map[string]inflightMessage)
+	return events
+}
+
+// take returns the ready messages and any unacknowledged messages whose
+// visibility timeout expired, marking them as in flight.
+func (q *Memory) take() []*Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for h, m := range q.inflight {
+		if now.After(m.deadline) {
+			q.ready = append(q.ready, m.msg)
+			delete(q.inflight, h)
+		}
+	}
+
+	msgs := q.ready
+	q.ready = nil
+	for _, m := range msgs {
+		q.inflight[m.Handle] = inflightMessage{msg: m, deadline: now.Add(q.VisibilityTimeout)}
+	}
+	return msgs
+}
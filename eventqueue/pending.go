@@ -0,0 +1,114 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/store"
+)
+
+const (
+	pendingKeyPrefix = "eventqueue:pending:"
+
+	// PendingEventTTL is how long saved events wait for a server to resume
+	// them before they expire.
+	PendingEventTTL = 7 * 24 * time.Hour
+)
+
+// SavePending writes events that were received but not processed to the
+// store, so that ResumePending can process them after the server restarts.
+// The store must persist across restarts for events to survive.
+func SavePending(ctx context.Context, st store.Store, events []Event) error {
+	now := time.Now().UnixNano()
+	for i, e := range events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode pending event")
+		}
+
+		// keys sort in the order the events were received
+		key := fmt.Sprintf("%s%020d:%06d", pendingKeyPrefix, now, i)
+		if err := st.Put(ctx, key, value, PendingEventTTL); err != nil {
+			return errors.Wrapf(err, "failed to save pending %s event %s", e.Type, e.DeliveryID)
+		}
+	}
+	return nil
+}
+
+// ResumePending passes the events saved by SavePending to the first handler
+// for each event type, in the order they were saved, and removes them from
+// the store. Events are removed even if their handler fails, so that an event
+// that cannot be handled does not block every restart; failures are logged.
+// It returns the number of resumed events.
+func ResumePending(ctx context.Context, st store.Store, handlers ...githubapp.EventHandler) (int, error) {
+	handlerMap := make(map[string]githubapp.EventHandler)
+	for i := len(handlers) - 1; i >= 0; i-- {
+		for _, e := range handlers[i].Handles() {
+			handlerMap[e] = handlers[i]
+		}
+	}
+
+	type pendingEvent struct {
+		key   string
+		event Event
+	}
+
+	var pending []pendingEvent
+	err := st.Scan(ctx, pendingKeyPrefix, func(key string, value []byte) error {
+		var e Event
+		if err := json.Unmarshal(value, &e); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("key", key).Msg("Discarding invalid pending event")
+			e = Event{}
+		}
+		pending = append(pending, pendingEvent{key: key, event: e})
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list pending events")
+	}
+
+	count := 0
+	for _, p := range pending {
+		if err := st.Delete(ctx, p.key); err != nil {
+			return count, errors.Wrap(err, "failed to remove pending event")
+		}
+
+		e := p.event
+		h, ok := handlerMap[e.Type]
+		if !ok {
+			continue
+		}
+
+		logger := zerolog.Ctx(ctx).With().
+			Str(githubapp.LogKeyEventType, e.Type).
+			Str(githubapp.LogKeyDeliveryID, e.DeliveryID).
+			Logger()
+
+		if err := h.Handle(logger.WithContext(ctx), e.Type, e.DeliveryID, e.Payload); err != nil {
+			logger.Error().Err(err).Msg("Failed to handle pending event")
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
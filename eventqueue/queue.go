@@ -0,0 +1,146 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventqueue splits webhook processing into a receiver, which
+// validates webhooks and writes them to a message queue, and workers, which
+// consume events from the queue and evaluate them. This allows evaluation to
+// scale horizontally and retries events if a worker fails.
+package eventqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ModeReceiver = "receiver"
+	ModeWorker   = "worker"
+	ModeAll      = "all"
+
+	TypeMemory = "memory"
+	TypeSQS    = "sqs"
+
+	DefaultWorkers          = 4
+	DefaultDeduplicationTTL = 24 * time.Hour
+)
+
+// Event is a validated webhook event.
+type Event struct {
+	Type       string `json:"type"`
+	DeliveryID string `json:"delivery_id"`
+	Payload    []byte `json:"payload"`
+}
+
+// Message is an event received from a queue. Messages that are not
+// acknowledged are delivered again.
+type Message struct {
+	Event Event
+
+	// Handle identifies the message to the queue implementation.
+	Handle string
+}
+
+// Queue is a message queue with at-least-once delivery. Implementations must
+// be safe for concurrent use.
+type Queue interface {
+	// Send adds an event to the queue.
+	Send(ctx context.Context, e Event) error
+
+	// Receive waits for and returns the next available messages. It may
+	// return no messages if none are available after a queue-specific time.
+	Receive(ctx context.Context) ([]*Message, error)
+
+	// Ack removes a message from the queue after it is processed.
+	Ack(ctx context.Context, m *Message) error
+}
+
+type Config struct {
+	// Mode is "receiver" to write validated webhooks to the queue, "worker"
+	// to process events from the queue, or "all" to do both. If empty,
+	// webhooks are processed as they are received.
+	Mode string `yaml:"mode"`
+
+	// Type is the queue implementation, either "memory" (the default) or
+	// "sqs". The memory queue only works with the "all" mode.
+	Type string `yaml:"type"`
+
+	SQS SQSConfig `yaml:"sqs"`
+
+	// Workers is the number of events a worker processes at once. If unset,
+	// DefaultWorkers is used.
+	Workers int `yaml:"workers"`
+
+	// DeduplicationTTL is how long workers remember processed deliveries to
+	// skip events that are delivered more than once. If unset,
+	// DefaultDeduplicationTTL is used. It is ignored if webhook deliveries
+	// are recorded, which use the TTL of the delivery configuration.
+	DeduplicationTTL time.Duration `yaml:"deduplication_ttl"`
+}
+
+// IsEnabled returns true if events are processed using a queue.
+func (c *Config) IsEnabled() bool {
+	return c.Mode != ""
+}
+
+// IsReceiver returns true if the server writes webhooks to the queue.
+func (c *Config) IsReceiver() bool {
+	return c.Mode == ModeReceiver || c.Mode == ModeAll
+}
+
+// IsWorker returns true if the server processes events from the queue.
+func (c *Config) IsWorker() bool {
+	return c.Mode == ModeWorker || c.Mode == ModeAll
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *Config) Validate() error {
+	switch c.Mode {
+	case "", ModeReceiver, ModeWorker, ModeAll:
+	default:
+		return errors.Errorf("unknown queue mode %q", c.Mode)
+	}
+
+	switch c.Type {
+	case "", TypeMemory:
+		if c.Mode != "" && c.Mode != ModeAll {
+			return errors.Errorf("memory queue requires the %q mode", ModeAll)
+		}
+	case TypeSQS:
+		if c.SQS.QueueURL == "" {
+			return errors.New("sqs queue must specify a queue_url")
+		}
+		if c.SQS.Region == "" {
+			return errors.New("sqs queue must specify a region")
+		}
+	default:
+		return errors.Errorf("unknown queue type %q", c.Type)
+	}
+	return nil
+}
+
+// New creates the queue described by the configuration.
+func New(c Config) (Queue, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch c.Type {
+	case TypeSQS:
+		return NewSQS(c.SQS, nil)
+	default:
+		return NewMemory(), nil
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultSQSWaitTime          = 20 * time.Second
+	DefaultSQSVisibilityTimeout = 5 * time.Minute
+
+	sqsMaxMessages = 10
+)
+
+type SQSConfig struct {
+	QueueURL string `yaml:"queue_url"`
+	Region   string `yaml:"region"`
+
+	// AccessKeyID, SecretAccessKey, and SessionToken are the AWS credentials.
+	// If AccessKeyID is empty, the standard AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment variables are
+	// used.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+
+	// WaitTime is how long to wait for messages when receiving. If unset,
+	// DefaultSQSWaitTime is used. The maximum is 20 seconds.
+	WaitTime time.Duration `yaml:"wait_time"`
+
+	// VisibilityTimeout is how long received messages are hidden before they
+	// are delivered again if they are not acknowledged. It should be longer
+	// than the time needed to process an event. If unset,
+	// DefaultSQSVisibilityTimeout is used.
+	VisibilityTimeout time.Duration `yaml:"visibility_timeout"`
+}
+
+// SQS is a Queue backed by Amazon SQS. It uses the SQS JSON protocol and
+// signs requests with AWS Signature Version 4.
+type SQS struct {
+	config   SQSConfig
+	endpoint string
+	creds    credentials
+	client   *http.Client
+	now      func() time.Time
+}
+
+var _ Queue = &SQS{}
+
+// NewSQS creates an SQS queue for the configuration. If httpClient is nil, a
+// client with a timeout longer than the receive wait time is used.
+func NewSQS(c SQSConfig, httpClient *http.Client) (*SQS, error) {
+	u, err := url.Parse(c.QueueURL)
+	if err != nil || u.Host == "" {
+		return nil, errors.Errorf("invalid sqs queue_url %q", c.QueueURL)
+	}
+
+	if c.WaitTime <= 0 {
+		c.WaitTime = DefaultSQSWaitTime
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = DefaultSQSVisibilityTimeout
+	}
+
+	creds := credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+	}
+	if creds.AccessKeyID == "" {
+		creds = credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("sqs queue requires AWS credentials")
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: c.WaitTime + 10*time.Second}
+	}
+
+	return &SQS{
+		config:   c,
+		endpoint: fmt.Sprintf("%s://%s/", u.Scheme, u.Host),
+		creds:    creds,
+		client:   httpClient,
+		now:      time.Now,
+	}, nil
+}
+
+func (q *SQS) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	req := map[string]interface{}{
+		"QueueUrl":    q.config.QueueURL,
+		"MessageBody": string(body),
+	}
+	return errors.Wrap(q.call(ctx, "SendMessage", req, nil), "failed to send message")
+}
+
+func (q *SQS) Receive(ctx context.Context) ([]*Message, error) {
+	req := map[string]interface{}{
+		"QueueUrl":            q.config.QueueURL,
+		"MaxNumberOfMessages": sqsMaxMessages,
+		"WaitTimeSeconds":     int(q.config.WaitTime / time.Second),
+		"VisibilityTimeout":   int(q.config.VisibilityTimeout / time.Second),
+	}
+
+	var res struct {
+		Messages []struct {
+			MessageID     string `json:"MessageId"`
+			ReceiptHandle string `json:"ReceiptHandle"`
+			Body          string `json:"Body"`
+		} `json:"Messages"`
+	}
+	if err := q.call(ctx, "ReceiveMessage", req, &res); err != nil {
+		return nil, errors.Wrap(err, "failed to receive messages")
+	}
+
+	msgs := make([]*Message, 0, len(res.Messages))
+	for _, m := range res.Messages {
+		msg := &Message{Handle: m.ReceiptHandle}
+		if err := json.Unmarshal([]byte(m.Body), &msg.Event); err != nil {
+			return nil, errors.Wrapf(err, "invalid event in message %s", m.MessageID)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (q *SQS) Ack(ctx context.Context, m *Message) error {
+	req := map[string]interface{}{
+		"QueueUrl":      q.config.QueueURL,
+		"ReceiptHandle": m.Handle,
+	}
+	return errors.Wrap(q.call(ctx, "DeleteMessage", req, nil), "failed to delete message")
+}
+
+func (q *SQS) call(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal request")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, q.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	signV4(req, body, q.creds, q.config.Region, "sqs", q.now())
+
+	res, err := q.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var sqsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(resBody, &sqsErr)
+		return errors.Errorf("sqs returned status %d: %s %s", res.StatusCode, sqsErr.Type, sqsErr.Message)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(resBody, out); err != nil {
+			return errors.Wrap(err, "failed to unmarshal response")
+		}
+	}
+	return nil
+}
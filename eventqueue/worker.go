@@ -0,0 +1,187 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/delivery"
+)
+
+// receiveRetryDelay is how long a worker waits after failing to receive
+// messages before trying again.
+const receiveRetryDelay = 5 * time.Second
+
+// Receiver is an event handler that writes events to a queue instead of
+// processing them. Use it with a githubapp event dispatcher, which validates
+// webhook signatures before calling the handler.
+type Receiver struct {
+	Queue  Queue
+	Events []string
+}
+
+var _ githubapp.EventHandler = &Receiver{}
+
+// NewReceiver returns a Receiver for the events handled by the handlers.
+func NewReceiver(q Queue, handlers ...githubapp.EventHandler) *Receiver {
+	seen := make(map[string]bool)
+	r := &Receiver{Queue: q}
+	for _, h := range handlers {
+		for _, e := range h.Handles() {
+			if !seen[e] {
+				seen[e] = true
+				r.Events = append(r.Events, e)
+			}
+		}
+	}
+	return r
+}
+
+func (r *Receiver) Handles() []string {
+	return r.Events
+}
+
+func (r *Receiver) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	err := r.Queue.Send(ctx, Event{
+		Type:       eventType,
+		DeliveryID: deliveryID,
+		Payload:    payload,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to queue event")
+	}
+
+	zerolog.Ctx(ctx).Debug().Msg("Queued event for processing by a worker")
+	return nil
+}
+
+// Worker processes events from a queue using event handlers. Events are
+// acknowledged after they are processed successfully; events that fail are
+// delivered again by the queue. Workers record processed deliveries with a
+// delivery.Recorder so that events delivered more than once are only
+// processed once. Workers should share the recorder's store, or redelivered
+// events may be processed again by a different worker.
+type Worker struct {
+	queue    Queue
+	handlers map[string]githubapp.EventHandler
+	workers  int
+}
+
+// NewWorker creates a Worker for the configuration. The handlers are wrapped
+// by the recorder, which must not wrap the handlers that write events to the
+// queue, or every queued event is skipped as a duplicate. If multiple
+// handlers handle the same event, the first one is used.
+func NewWorker(c Config, q Queue, rec *delivery.Recorder, handlers ...githubapp.EventHandler) *Worker {
+	if c.Workers <= 0 {
+		c.Workers = DefaultWorkers
+	}
+
+	handlerMap := make(map[string]githubapp.EventHandler)
+	for _, h := range handlers {
+		wrapped := rec.Wrap(h)
+		for _, e := range h.Handles() {
+			if _, ok := handlerMap[e]; !ok {
+				handlerMap[e] = wrapped
+			}
+		}
+	}
+
+	return &Worker{
+		queue:    q,
+		handlers: handlerMap,
+		workers:  c.Workers,
+	}
+}
+
+// Run processes events until the context is canceled. Events that are
+// processing when the context is canceled finish with a context that is not
+// canceled, and Run returns after they finish, so that a server can drain
+// in-flight evaluations when it shuts down.
+func (w *Worker) Run(ctx context.Context) {
+	msgs := make(chan *Message)
+	processCtx := zerolog.Ctx(ctx).WithContext(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range msgs {
+				w.process(processCtx, m)
+			}
+		}()
+	}
+
+	defer func() {
+		close(msgs)
+		wg.Wait()
+	}()
+
+	for {
+		received, err := w.queue.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to receive events from queue")
+			select {
+			case <-time.After(receiveRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		for _, m := range received {
+			select {
+			case msgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *Worker) process(ctx context.Context, m *Message) {
+	logger := zerolog.Ctx(ctx).With().
+		Str(githubapp.LogKeyEventType, m.Event.Type).
+		Str(githubapp.LogKeyDeliveryID, m.Event.DeliveryID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	if err := w.handle(ctx, m); err != nil {
+		logger.Error().Err(err).Msg("Failed to process queued event")
+		return
+	}
+
+	if err := w.queue.Ack(ctx, m); err != nil {
+		logger.Error().Err(err).Msg("Failed to acknowledge queued event")
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, m *Message) error {
+	h, ok := w.handlers[m.Event.Type]
+	if !ok {
+		zerolog.Ctx(ctx).Debug().Msg("Skipping event with no handler")
+		return nil
+	}
+	return h.Handle(ctx, m.Event.Type, m.Event.DeliveryID, m.Event.Payload)
+}
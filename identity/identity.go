@@ -0,0 +1,228 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package identity looks up attributes of users, like the region they work
+// in, from a static map or an identity provider, so that policies can limit
+// approvers to users with specific attributes.
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultCacheTTL = 10 * time.Minute
+)
+
+// Provider looks up the attributes of GitHub users.
+type Provider interface {
+	// Attributes returns the attributes of the user, keyed by name. Users
+	// without known attributes have no attributes.
+	Attributes(ctx context.Context, user string) (map[string][]string, error)
+}
+
+type Config struct {
+	// Users maps GitHub usernames to their attributes. Static attributes
+	// replace attributes with the same name from the URL.
+	Users map[string]map[string][]string `yaml:"users"`
+
+	// URL is an endpoint that returns the attributes of a user, usually
+	// backed by the identity provider. Requests add the GitHub username as
+	// the "user" query parameter and expect a response like
+	// {"attributes": {"region": ["us"]}}. A 404 response means the user has
+	// no attributes.
+	URL string `yaml:"url"`
+
+	// Token is sent as a bearer token with requests to the URL.
+	Token string `yaml:"token"`
+
+	// CacheTTL is how long to reuse the attributes of a user. If unset,
+	// DefaultCacheTTL is used.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// IsEnabled returns true if static attributes or a URL are configured.
+func (c *Config) IsEnabled() bool {
+	return len(c.Users) > 0 || c.URL != ""
+}
+
+// Validate returns an error if the URL is malformed.
+func (c *Config) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid identity url")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("invalid identity url %q: scheme must be http or https", c.URL)
+	}
+	return nil
+}
+
+type cacheEntry struct {
+	expires    time.Time
+	attributes map[string][]string
+}
+
+// Client is a Provider that combines static attributes with attributes from
+// the configured URL.
+type Client struct {
+	config Config
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewClient creates a Client for the configuration. If httpClient is nil,
+// http.DefaultClient is used.
+func NewClient(c Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+	return &Client{
+		config: c,
+		client: httpClient,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+var _ Provider = &Client{}
+
+func (c *Client) Attributes(ctx context.Context, user string) (map[string][]string, error) {
+	if c.config.URL == "" {
+		return c.config.Users[user], nil
+	}
+
+	if attrs, ok := c.cached(user); ok {
+		return attrs, nil
+	}
+
+	fetched, err := c.fetch(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]string, len(fetched))
+	for name, values := range fetched {
+		attrs[name] = values
+	}
+	for name, values := range c.config.Users[user] {
+		attrs[name] = values
+	}
+
+	c.store(user, attrs)
+	return attrs, nil
+}
+
+func (c *Client) fetch(ctx context.Context, user string) (map[string][]string, error) {
+	u, err := url.Parse(c.config.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid identity url")
+	}
+	q := u.Query()
+	q.Set("user", user)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Accept", "application/json")
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get attributes of %s", user)
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errors.Errorf("failed to get attributes of %s: request failed with status %d", user, res.StatusCode)
+	}
+
+	var body struct {
+		Attributes map[string][]string `json:"attributes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode attributes of %s", user)
+	}
+	return body.Attributes, nil
+}
+
+func (c *Client) cached(user string) (map[string][]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.cache[user]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.attributes, true
+}
+
+func (c *Client) store(user string, attrs map[string][]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache[user] = cacheEntry{attributes: attrs, expires: time.Now().Add(c.config.CacheTTL)}
+}
+
+// Flush discards all cached attributes.
+func (c *Client) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache = make(map[string]cacheEntry)
+}
+
+type providerKey struct{}
+
+// WithProvider returns a context that uses p to look up user attributes.
+func WithProvider(ctx context.Context, p Provider) context.Context {
+	return context.WithValue(ctx, providerKey{}, p)
+}
+
+// ProviderFromContext returns the Provider in the context or an error if
+// identity metadata is not configured.
+func ProviderFromContext(ctx context.Context) (Provider, error) {
+	if p, ok := ctx.Value(providerKey{}).(Provider); ok && p != nil {
+		return p, nil
+	}
+	return nil, errors.New("identity metadata is not configured on this server")
+}
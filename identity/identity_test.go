@@ -0,0 +1,98 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "Bearer identity-token", r.Header.Get("Authorization"))
+		switch r.URL.Query().Get("user") {
+		case "alice":
+			fmt.Fprint(w, `{"attributes": {"region": ["us"], "clearance": ["secret"]}}`)
+		case "broken":
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{
+		URL:   srv.URL + "/attributes",
+		Token: "identity-token",
+		Users: map[string]map[string][]string{
+			"alice": {"region": {"eu"}},
+			"bob":   {"region": {"us"}},
+		},
+	}, srv.Client())
+	ctx := context.Background()
+
+	attrs, err := c.Attributes(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"region": {"eu"}, "clearance": {"secret"}}, attrs, "static attributes did not replace fetched attributes")
+
+	attrs, err = c.Attributes(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"region": {"us"}}, attrs)
+
+	attrs, err = c.Attributes(ctx, "carol")
+	require.NoError(t, err)
+	assert.Empty(t, attrs)
+
+	_, err = c.Attributes(ctx, "broken")
+	assert.Error(t, err)
+
+	t.Run("caching", func(t *testing.T) {
+		requests = 0
+		for i := 0; i < 2; i++ {
+			_, err := c.Attributes(ctx, "alice")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 0, requests, "cached attributes were not used")
+
+		c.Flush()
+		_, err := c.Attributes(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 1, requests)
+	})
+}
+
+func TestStaticClient(t *testing.T) {
+	c := NewClient(Config{
+		Users: map[string]map[string][]string{
+			"alice": {"region": {"eu"}},
+		},
+	}, nil)
+
+	attrs, err := c.Attributes(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"region": {"eu"}}, attrs)
+
+	attrs, err = c.Attributes(context.Background(), "bob")
+	require.NoError(t, err)
+	assert.Empty(t, attrs)
+}
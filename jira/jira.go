@@ -0,0 +1,181 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jira looks up the status of Jira issues, so that policies can
+// approve pull requests linked to issues that reached an approved status.
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Provider looks up Jira issues.
+type Provider interface {
+	// IssueStatus returns the name of the current status of the issue with
+	// the key, like "PROJ-123". It returns an empty string if the issue does
+	// not exist or is not visible to policy-bot.
+	IssueStatus(ctx context.Context, key string) (string, error)
+}
+
+type Config struct {
+	// URL is the base URL of the Jira instance, like
+	// "https://example.atlassian.net".
+	URL string `yaml:"url"`
+
+	// Username and Token authenticate requests. If Username is set, requests
+	// use basic authentication with the token as the password, as required
+	// by Jira Cloud. Otherwise, the token is sent as a bearer token, like a
+	// personal access token for Jira Server or Data Center.
+	Username string `yaml:"username"`
+	Token    string `yaml:"token"`
+}
+
+// IsEnabled returns true if a Jira instance is configured.
+func (c *Config) IsEnabled() bool {
+	return c.URL != ""
+}
+
+// Validate returns an error if the configuration is incomplete.
+func (c *Config) Validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return errors.Wrap(err, "invalid jira url")
+	}
+	if c.Token == "" {
+		return errors.New("jira integration must specify a token")
+	}
+	return nil
+}
+
+// Client is a Provider that uses the Jira REST API.
+type Client struct {
+	config Config
+	client *http.Client
+}
+
+// NewClient creates a Client for the configuration. If httpClient is nil,
+// http.DefaultClient is used.
+func NewClient(c Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+	return &Client{config: c, client: httpClient}
+}
+
+var _ Provider = &Client{}
+
+func (c *Client) IssueStatus(ctx context.Context, key string) (string, error) {
+	u := fmt.Sprintf("%s/rest/api/2/issue/%s?fields=status", c.config.URL, url.PathEscape(key))
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Accept", "application/json")
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get jira issue %s", key)
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", errors.Errorf("failed to get jira issue %s: request failed with status %d", key, res.StatusCode)
+	}
+
+	var issue struct {
+		Fields struct {
+			Status struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&issue); err != nil {
+		return "", errors.Wrapf(err, "failed to decode jira issue %s", key)
+	}
+	return issue.Fields.Status.Name, nil
+}
+
+// cachingProvider remembers the status of each issue it looks up.
+type cachingProvider struct {
+	provider Provider
+
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+// NewCachingProvider returns a Provider that looks up each issue at most once.
+// Because statuses never expire, callers should create a new provider for
+// each evaluation so that all rules see the same status for an issue.
+func NewCachingProvider(p Provider) Provider {
+	return &cachingProvider{provider: p, statuses: make(map[string]string)}
+}
+
+func (p *cachingProvider) IssueStatus(ctx context.Context, key string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if status, ok := p.statuses[key]; ok {
+		return status, nil
+	}
+
+	status, err := p.provider.IssueStatus(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	p.statuses[key] = status
+	return status, nil
+}
+
+type providerKey struct{}
+
+// WithProvider returns a context that uses p to look up Jira issues.
+func WithProvider(ctx context.Context, p Provider) context.Context {
+	return context.WithValue(ctx, providerKey{}, p)
+}
+
+// ProviderFromContext returns the Provider in the context or an error if
+// Jira integration is not configured.
+func ProviderFromContext(ctx context.Context) (Provider, error) {
+	if p, ok := ctx.Value(providerKey{}).(Provider); ok && p != nil {
+		return p, nil
+	}
+	return nil, errors.New("jira integration is not configured on this server")
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jira
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/rest/api/2/issue/CHG-123":
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok, "request did not use basic auth")
+			assert.Equal(t, "bot@example.com", user)
+			assert.Equal(t, "jira-token", pass)
+			assert.Equal(t, "status", r.URL.Query().Get("fields"))
+			fmt.Fprint(w, `{"key": "CHG-123", "fields": {"status": {"name": "Change Approved"}}}`)
+		case "/rest/api/2/issue/CHG-500":
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{URL: srv.URL + "/", Username: "bot@example.com", Token: "jira-token"}, srv.Client())
+	ctx := context.Background()
+
+	status, err := c.IssueStatus(ctx, "CHG-123")
+	require.NoError(t, err)
+	assert.Equal(t, "Change Approved", status)
+
+	status, err = c.IssueStatus(ctx, "CHG-404")
+	require.NoError(t, err)
+	assert.Equal(t, "", status, "missing issue had a status")
+
+	_, err = c.IssueStatus(ctx, "CHG-500")
+	assert.Error(t, err)
+
+	t.Run("caching", func(t *testing.T) {
+		requests = 0
+		p := NewCachingProvider(c)
+
+		for i := 0; i < 2; i++ {
+			status, err := p.IssueStatus(ctx, "CHG-123")
+			require.NoError(t, err)
+			assert.Equal(t, "Change Approved", status)
+		}
+		assert.Equal(t, 1, requests, "cached status was not used")
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer jira-pat", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"fields": {"status": {"name": "Open"}}}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{URL: srv.URL, Token: "jira-pat"}, srv.Client())
+
+	status, err := c.IssueStatus(context.Background(), "PROJ-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Open", status)
+}
@@ -0,0 +1,300 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oncall looks up the users on call for a schedule and the open
+// incidents for a service using an on-call management service like PagerDuty
+// or Opsgenie.
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ProviderPagerDuty = "pagerduty"
+	ProviderOpsgenie  = "opsgenie"
+
+	DefaultCacheTTL = time.Minute
+)
+
+// Provider looks up on-call information for schedules and services. Schedules
+// and services are identified by the names used in the server configuration,
+// not by provider IDs, so policies do not need to know provider details.
+type Provider interface {
+	// OnCallUsers returns the GitHub usernames of the users who are currently
+	// on call for the schedule. On-call users without a known GitHub username
+	// are omitted.
+	OnCallUsers(ctx context.Context, schedule string) ([]string, error)
+
+	// HasOpenIncident returns true if the service has an open incident.
+	HasOpenIncident(ctx context.Context, service string) (bool, error)
+}
+
+type Config struct {
+	PagerDuty PagerDutyConfig `yaml:"pagerduty"`
+	Opsgenie  OpsgenieConfig  `yaml:"opsgenie"`
+
+	// Schedules and Services map the names used in policies to provider
+	// schedules and services.
+	Schedules map[string]Reference `yaml:"schedules"`
+	Services  map[string]Reference `yaml:"services"`
+
+	// Users maps the email addresses of on-call users to GitHub usernames.
+	Users map[string]string `yaml:"users"`
+
+	// CacheTTL is how long to reuse on-call and incident information. If
+	// unset, DefaultCacheTTL is used.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+type PagerDutyConfig struct {
+	Token  string `yaml:"token"`
+	APIURL string `yaml:"api_url"`
+}
+
+type OpsgenieConfig struct {
+	APIKey string `yaml:"api_key"`
+	APIURL string `yaml:"api_url"`
+}
+
+// Reference identifies a schedule or service in a provider.
+type Reference struct {
+	Provider string `yaml:"provider"`
+	ID       string `yaml:"id"`
+}
+
+// IsEnabled returns true if any schedules or services are configured.
+func (c *Config) IsEnabled() bool {
+	return len(c.Schedules) > 0 || len(c.Services) > 0
+}
+
+// Validate returns an error if a schedule or service references a provider
+// that is unknown or not configured.
+func (c *Config) Validate() error {
+	check := func(kind, name string, ref Reference) error {
+		if ref.ID == "" {
+			return errors.Errorf("on-call %s %q must specify an id", kind, name)
+		}
+		switch ref.Provider {
+		case ProviderPagerDuty:
+			if c.PagerDuty.Token == "" {
+				return errors.Errorf("on-call %s %q uses pagerduty, but no pagerduty token is configured", kind, name)
+			}
+		case ProviderOpsgenie:
+			if c.Opsgenie.APIKey == "" {
+				return errors.Errorf("on-call %s %q uses opsgenie, but no opsgenie API key is configured", kind, name)
+			}
+		default:
+			return errors.Errorf("on-call %s %q has unknown provider %q", kind, name, ref.Provider)
+		}
+		return nil
+	}
+
+	for name, ref := range c.Schedules {
+		if err := check("schedule", name, ref); err != nil {
+			return err
+		}
+	}
+	for name, ref := range c.Services {
+		if err := check("service", name, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backend implements lookups for a single provider using provider IDs.
+type backend interface {
+	onCallEmails(ctx context.Context, scheduleID string) ([]string, error)
+	hasOpenIncident(ctx context.Context, serviceID string) (bool, error)
+}
+
+type cacheEntry struct {
+	expires time.Time
+	users   []string
+	open    bool
+}
+
+// Client is a Provider that uses the backends defined in a Config.
+type Client struct {
+	config   Config
+	backends map[string]backend
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewClient creates a Client for the configuration. If httpClient is nil,
+// http.DefaultClient is used.
+func NewClient(c Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+
+	users := make(map[string]string, len(c.Users))
+	for email, login := range c.Users {
+		users[strings.ToLower(email)] = login
+	}
+	c.Users = users
+
+	return &Client{
+		config: c,
+		backends: map[string]backend{
+			ProviderPagerDuty: &pagerDuty{config: c.PagerDuty, client: httpClient},
+			ProviderOpsgenie:  &opsgenie{config: c.Opsgenie, client: httpClient},
+		},
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+var _ Provider = &Client{}
+
+func (c *Client) OnCallUsers(ctx context.Context, schedule string) ([]string, error) {
+	key := "schedule:" + schedule
+	if e, ok := c.cached(key); ok {
+		return e.users, nil
+	}
+
+	ref, ok := c.config.Schedules[schedule]
+	if !ok {
+		return nil, errors.Errorf("on-call schedule %q is not configured", schedule)
+	}
+
+	emails, err := c.backends[ref.Provider].onCallEmails(ctx, ref.ID)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("failed to get on-call users for schedule %q", schedule))
+	}
+
+	var users []string
+	for _, email := range emails {
+		if login, ok := c.config.Users[strings.ToLower(email)]; ok {
+			users = append(users, login)
+		} else {
+			zerolog.Ctx(ctx).Warn().Str("schedule", schedule).Msgf("On-call user %s has no configured GitHub username", email)
+		}
+	}
+
+	c.store(key, cacheEntry{users: users})
+	return users, nil
+}
+
+func (c *Client) HasOpenIncident(ctx context.Context, service string) (bool, error) {
+	key := "service:" + service
+	if e, ok := c.cached(key); ok {
+		return e.open, nil
+	}
+
+	ref, ok := c.config.Services[service]
+	if !ok {
+		return false, errors.Errorf("on-call service %q is not configured", service)
+	}
+
+	open, err := c.backends[ref.Provider].hasOpenIncident(ctx, ref.ID)
+	if err != nil {
+		return false, errors.WithMessage(err, fmt.Sprintf("failed to get incidents for service %q", service))
+	}
+
+	c.store(key, cacheEntry{open: open})
+	return open, nil
+}
+
+func (c *Client) cached(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.cache[key]
+	if !ok || time.Now().After(e.expires) {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *Client) store(key string, e cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.expires = time.Now().Add(c.config.CacheTTL)
+	c.cache[key] = e
+}
+
+// Flush discards all cached on-call and incident information.
+func (c *Client) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache = make(map[string]cacheEntry)
+}
+
+type providerKey struct{}
+
+// WithProvider returns a context that uses p to evaluate on-call conditions.
+func WithProvider(ctx context.Context, p Provider) context.Context {
+	return context.WithValue(ctx, providerKey{}, p)
+}
+
+// ProviderFromContext returns the Provider in the context or an error if
+// on-call integration is not configured.
+func ProviderFromContext(ctx context.Context) (Provider, error) {
+	if p, ok := ctx.Value(providerKey{}).(Provider); ok && p != nil {
+		return p, nil
+	}
+	return nil, errors.New("on-call integration is not configured on this server")
+}
+
+// getJSON performs a GET request with the headers and decodes the JSON
+// response into v.
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "failed to decode response")
+	}
+	return nil
+}
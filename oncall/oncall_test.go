@@ -0,0 +1,120 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oncall
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/oncalls":
+			assert.Equal(t, "Token token=pd-token", r.Header.Get("Authorization"))
+			assert.Equal(t, "PSCHED", r.URL.Query().Get("schedule_ids[]"))
+			fmt.Fprint(w, `{"oncalls": [{"user": {"email": "Primary@example.com"}}, {"user": {"email": "unknown@example.com"}}]}`)
+		case r.URL.Path == "/incidents":
+			assert.Equal(t, "PSERV", r.URL.Query().Get("service_ids[]"))
+			fmt.Fprint(w, `{"incidents": [{"id": "P123"}]}`)
+		case r.URL.Path == "/v2/schedules/og-sched/on-calls":
+			assert.Equal(t, "GenieKey og-key", r.Header.Get("Authorization"))
+			fmt.Fprint(w, `{"data": {"onCallRecipients": ["secondary@example.com"]}}`)
+		case r.URL.Path == "/v1/incidents":
+			fmt.Fprint(w, `{"data": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{
+		PagerDuty: PagerDutyConfig{Token: "pd-token", APIURL: srv.URL},
+		Opsgenie:  OpsgenieConfig{APIKey: "og-key", APIURL: srv.URL},
+		Schedules: map[string]Reference{
+			"primary":   {Provider: ProviderPagerDuty, ID: "PSCHED"},
+			"secondary": {Provider: ProviderOpsgenie, ID: "og-sched"},
+		},
+		Services: map[string]Reference{
+			"production": {Provider: ProviderPagerDuty, ID: "PSERV"},
+			"staging":    {Provider: ProviderOpsgenie, ID: "og-serv"},
+		},
+		Users: map[string]string{
+			"primary@example.com":   "mhaypenny",
+			"secondary@example.com": "ttest",
+		},
+	}, srv.Client())
+
+	ctx := context.Background()
+
+	t.Run("pagerDutyOnCall", func(t *testing.T) {
+		users, err := c.OnCallUsers(ctx, "primary")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mhaypenny"}, users)
+	})
+
+	t.Run("opsgenieOnCall", func(t *testing.T) {
+		users, err := c.OnCallUsers(ctx, "secondary")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ttest"}, users)
+	})
+
+	t.Run("incidents", func(t *testing.T) {
+		open, err := c.HasOpenIncident(ctx, "production")
+		require.NoError(t, err)
+		assert.True(t, open, "production has no open incident")
+
+		open, err = c.HasOpenIncident(ctx, "staging")
+		require.NoError(t, err)
+		assert.False(t, open, "staging has an open incident")
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		before := requests
+		_, err := c.OnCallUsers(ctx, "primary")
+		require.NoError(t, err)
+		assert.Equal(t, before, requests, "cached on-call users were not used")
+	})
+
+	t.Run("unknownSchedule", func(t *testing.T) {
+		_, err := c.OnCallUsers(ctx, "missing")
+		assert.Error(t, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	c := Config{
+		Schedules: map[string]Reference{
+			"primary": {Provider: ProviderPagerDuty, ID: "PSCHED"},
+		},
+	}
+	assert.Error(t, c.Validate(), "pagerduty without token is valid")
+
+	c.PagerDuty.Token = "token"
+	assert.NoError(t, c.Validate())
+
+	c.Services = map[string]Reference{
+		"production": {Provider: "statuspage", ID: "x"},
+	}
+	assert.Error(t, c.Validate(), "unknown provider is valid")
+}
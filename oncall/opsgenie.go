@@ -0,0 +1,77 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oncall
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultOpsgenieURL = "https://api.opsgenie.com"
+)
+
+type opsgenie struct {
+	config OpsgenieConfig
+	client *http.Client
+}
+
+func (og *opsgenie) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	base := og.config.APIURL
+	if base == "" {
+		base = DefaultOpsgenieURL
+	}
+
+	u := strings.TrimSuffix(base, "/") + path + "?" + query.Encode()
+	return getJSON(ctx, og.client, u, map[string]string{
+		"Authorization": "GenieKey " + og.config.APIKey,
+	}, v)
+}
+
+func (og *opsgenie) onCallEmails(ctx context.Context, scheduleID string) ([]string, error) {
+	var res struct {
+		Data struct {
+			OnCallRecipients []string `json:"onCallRecipients"`
+		} `json:"data"`
+	}
+
+	query := url.Values{
+		"scheduleIdentifierType": {"id"},
+		"flat":                   {"true"},
+	}
+	if err := og.get(ctx, "/v2/schedules/"+url.PathEscape(scheduleID)+"/on-calls", query, &res); err != nil {
+		return nil, err
+	}
+	return res.Data.OnCallRecipients, nil
+}
+
+func (og *opsgenie) hasOpenIncident(ctx context.Context, serviceID string) (bool, error) {
+	var res struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	query := url.Values{
+		"query": {"status:open AND impactedServices:" + serviceID},
+		"limit": {"1"},
+	}
+	if err := og.get(ctx, "/v1/incidents", query, &res); err != nil {
+		return false, err
+	}
+	return len(res.Data) > 0, nil
+}
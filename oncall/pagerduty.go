@@ -0,0 +1,89 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oncall
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultPagerDutyURL = "https://api.pagerduty.com"
+)
+
+type pagerDuty struct {
+	config PagerDutyConfig
+	client *http.Client
+}
+
+func (pd *pagerDuty) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	base := pd.config.APIURL
+	if base == "" {
+		base = DefaultPagerDutyURL
+	}
+
+	u := strings.TrimSuffix(base, "/") + path + "?" + query.Encode()
+	return getJSON(ctx, pd.client, u, map[string]string{
+		"Accept":        "application/vnd.pagerduty+json;version=2",
+		"Authorization": "Token token=" + pd.config.Token,
+	}, v)
+}
+
+func (pd *pagerDuty) onCallEmails(ctx context.Context, scheduleID string) ([]string, error) {
+	var res struct {
+		OnCalls []struct {
+			User struct {
+				Email string `json:"email"`
+			} `json:"user"`
+		} `json:"oncalls"`
+	}
+
+	query := url.Values{
+		"schedule_ids[]": {scheduleID},
+		"include[]":      {"users"},
+		"earliest":       {"true"},
+	}
+	if err := pd.get(ctx, "/oncalls", query, &res); err != nil {
+		return nil, err
+	}
+
+	var emails []string
+	for _, oc := range res.OnCalls {
+		if oc.User.Email != "" {
+			emails = append(emails, oc.User.Email)
+		}
+	}
+	return emails, nil
+}
+
+func (pd *pagerDuty) hasOpenIncident(ctx context.Context, serviceID string) (bool, error) {
+	var res struct {
+		Incidents []struct {
+			ID string `json:"id"`
+		} `json:"incidents"`
+	}
+
+	query := url.Values{
+		"service_ids[]": {serviceID},
+		"statuses[]":    {"triggered", "acknowledged"},
+		"limit":         {"1"},
+	}
+	if err := pd.get(ctx, "/incidents", query, &res); err != nil {
+		return false, err
+	}
+	return len(res.Incidents) > 0, nil
+}
@@ -17,8 +17,10 @@ package approval
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -42,6 +44,27 @@ type Rule struct {
 	Predicates Predicates `yaml:"if"`
 	Options    Options    `yaml:"options"`
 	Requires   Requires   `yaml:"requires"`
+
+	// RequiresRules lists rules that must be approved or skipped before this
+	// rule can be approved. Until then, the rule is pending and its approvers
+	// are not asked for review.
+	RequiresRules []string `yaml:"requires_rules"`
+
+	// StatusContext is the context of a commit status that reports the
+	// result of this rule, so that other systems, like deployment pipelines,
+	// can depend on a specific approval instead of the whole policy.
+	StatusContext string `yaml:"status_context"`
+
+	// Triggers lists the sources of data the rule depends on. Events that
+	// only change other sources do not re-evaluate the pull request unless
+	// another rule depends on them. If empty, the rule depends on all
+	// sources.
+	Triggers []string `yaml:"triggers"`
+
+	// Extends is the name of a rule whose fields this rule inherits. It is
+	// resolved when the policy is decoded, so evaluation only sees the
+	// merged rule.
+	Extends string `yaml:"extends"`
 }
 
 type Options struct {
@@ -50,30 +73,176 @@ type Options struct {
 	InvalidateOnPush   bool `yaml:"invalidate_on_push"`
 	IgnoreUpdateMerges bool `yaml:"ignore_update_merges"`
 
+	// AllowAuthorIf allows approval by the author of the pull request only if
+	// the pull request satisfies all of the predicates. It has no effect if
+	// AllowAuthor or AllowContributor is set or if it contains no predicates.
+	AllowAuthorIf *Predicates `yaml:"allow_author_if"`
+
+	// IgnoreTrivialRebases keeps approvals when invalidate_on_push is set if
+	// the approved commit has the same tree as the head commit, meaning the
+	// pull request was rebased or amended without changing its content.
+	IgnoreTrivialRebases bool `yaml:"ignore_trivial_rebases"`
+
+	// IgnoreRebases keeps approvals when invalidate_on_push is set if the
+	// changes of the pull request as of the approved commit have the same
+	// patch ID as the current changes, meaning the pull request was rebased
+	// onto a new base without changing its diff.
+	IgnoreRebases bool `yaml:"ignore_rebases"`
+
+	// InvalidateOnPushThreshold keeps approvals when invalidate_on_push is
+	// set if the diff of the pull request changed by at most this fraction
+	// since the approved commit, from 0 to 1. If zero, any push invalidates
+	// approvals.
+	InvalidateOnPushThreshold float64 `yaml:"invalidate_on_push_threshold"`
+
+	// WaitForRereview discards the approval of a user who was asked to review
+	// the pull request again, until that user submits a new review.
+	WaitForRereview bool `yaml:"wait_for_rereview"`
+
+	// InvalidateOnBaseChange discards approvals given before the most recent
+	// change of the base branch of the pull request.
+	InvalidateOnBaseChange bool `yaml:"invalidate_on_base_change"`
+
+	// IgnoreStackRetargets keeps approvals when invalidate_on_base_change is
+	// set if the base branch changed because the parent of a stacked pull
+	// request was merged and the pull request was retargeted to the base
+	// branch of the parent.
+	IgnoreStackRetargets bool `yaml:"ignore_stack_retargets"`
+
+	// RequireApprovedParent keeps the rule pending while the pull request is
+	// stacked on an open pull request whose policy is not approved. A pull
+	// request is stacked if its base branch is the head branch of another
+	// pull request in the same repository.
+	RequireApprovedParent bool `yaml:"require_approved_parent"`
+
+	// IgnoreDepartedApprovers discards approvals by users whose accounts are
+	// suspended or who left the organization that owns the repository.
+	IgnoreDepartedApprovers bool `yaml:"ignore_departed_approvers"`
+
+	// IgnoreRecentLineAuthors discards approvals by users who authored lines
+	// that the pull request modifies or deletes within this duration before
+	// the pull request was opened, according to the blame of the files at
+	// the merge base. If zero, authors of changed lines can approve.
+	IgnoreRecentLineAuthors time.Duration `yaml:"ignore_recent_line_authors"`
+
+	// AllowTeamReviews counts approving reviews that GitHub recorded as
+	// satisfying a review request for one of the required teams, even if
+	// the reviewer does not otherwise satisfy the required actors.
+	AllowTeamReviews bool `yaml:"allow_team_reviews"`
+
+	// MinimumOpenDuration is the minimum time that must pass after the pull
+	// request is opened and after the most recent push before the rule can
+	// be approved.
+	MinimumOpenDuration common.Duration `yaml:"minimum_open_duration"`
+
+	// Advisory reports the outcome of the rule without affecting the status of
+	// the policy, for trialing new rules or for informational checks.
+	Advisory bool `yaml:"advisory"`
+
+	// RequireResolvedThreads keeps the rule pending while the pull request
+	// has unresolved review conversations.
+	RequireResolvedThreads bool `yaml:"require_resolved_threads"`
+
 	Methods *common.Methods `yaml:"methods"`
 }
 
-func (opts *Options) GetMethods() *common.Methods {
-	methods := opts.Methods
-	if methods == nil {
-		methods = &DefaultApproveMethods
+// GetMethods returns the approval methods for the rule. If the rule does not
+// specify methods, it uses the defaults from the context, if any, or
+// DefaultApproveMethods.
+func (opts *Options) GetMethods(ctx context.Context) *common.Methods {
+	defaults := common.DefaultMethodsFromContext(ctx)
+	return common.SelectMethods(pull.ReviewApproved, opts.Methods, defaults.Approve, &DefaultApproveMethods)
+}
+
+type ignoredCommitAuthorsKey struct{}
+
+// WithIgnoredCommitAuthors returns a context in which commits made only by
+// the given users, like automation accounts, are ignored when computing
+// contributors, invalidating approvals, and enforcing minimum open
+// durations.
+func WithIgnoredCommitAuthors(ctx context.Context, users []string) context.Context {
+	return context.WithValue(ctx, ignoredCommitAuthorsKey{}, users)
+}
+
+// isIgnoredCommit returns true if every user associated with the commit is
+// ignored by the context.
+func isIgnoredCommit(ctx context.Context, c *pull.Commit) bool {
+	ignored, _ := ctx.Value(ignoredCommitAuthorsKey{}).([]string)
+	if len(ignored) == 0 {
+		return false
 	}
 
-	methods.GithubReviewState = pull.ReviewApproved
-	return methods
+	users := c.Users()
+	if len(users) == 0 {
+		return false
+	}
+	for _, u := range users {
+		isIgnored := false
+		for _, i := range ignored {
+			if strings.EqualFold(u, i) {
+				isIgnored = true
+				break
+			}
+		}
+		if !isIgnored {
+			return false
+		}
+	}
+	return true
 }
 
 type Requires struct {
 	Count int `yaml:"count"`
 
+	// CountPerMatch maps path patterns to the number of approvals required
+	// if a changed file matches the pattern. The rule requires the largest
+	// count of any matching pattern, or Count if it is larger.
+	CountPerMatch map[string]int `yaml:"count_per_match"`
+
 	common.Actors `yaml:",inline"`
+
+	// Jira approves the rule if a linked Jira issue reaches an approving
+	// status, even if the rule does not have enough approvals. If Count is
+	// zero, the linked issue is the only way to approve the rule. The issue
+	// does not replace the approvals required by OwnersFiles or Environments.
+	Jira *JiraRequirement `yaml:"jira"`
+
+	// OwnersFiles requires that the owners of each changed file approve the
+	// pull request, in addition to any approvals required by Count.
+	OwnersFiles *OwnersRequirement `yaml:"owners_files"`
+
+	// Environments requires that each deployment environment affected by
+	// the pull request is approved by one of its actors, in addition to any
+	// approvals required by Count.
+	Environments EnvironmentRequirement `yaml:"environments"`
+
+	// Attributes limits approvers to users with the given identity
+	// attributes, like an export control region. It applies to all
+	// approvals of the rule, including owner and environment approvals.
+	Attributes AttributeRequirement `yaml:"attributes"`
 }
 
 func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
 	log := zerolog.Ctx(ctx)
 
+	if timeout := ruleTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// errors from canceled requests do not always preserve the cause, so
+	// report any error after the deadline as a timeout
+	defer func() {
+		if res.Error != nil && ctx.Err() == context.DeadlineExceeded {
+			res.Error = errors.Wrap(context.DeadlineExceeded, "rule evaluation timed out")
+		}
+	}()
+
 	res.Name = r.Name
 	res.Status = common.StatusSkipped
+	res.Advisory = r.Options.Advisory
+	res.StatusContext = r.StatusContext
 
 	for _, p := range r.Predicates.Predicates() {
 		satisfied, desc, err := p.Evaluate(ctx, prctx)
@@ -94,73 +263,541 @@ func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Res
 		}
 	}
 
-	approved, msg, err := r.IsApproved(ctx, prctx)
+	if d := r.dispatchDecision(ctx, prctx); d != nil && d.Veto {
+		res.Status = common.StatusPending
+		res.Description = fmt.Sprintf("Vetoed by %s", d.Actor)
+		return
+	}
+
+	approved, msg, approvers, err := r.approval(ctx, prctx)
 	if err != nil {
 		res.Error = errors.Wrap(err, "failed to compute approval status")
 		return
 	}
 
 	res.Description = msg
+	for _, c := range approvers {
+		res.Approvers = append(res.Approvers, c.User)
+		if c.SHA != "" {
+			if res.ApprovalSHAs == nil {
+				res.ApprovalSHAs = make(map[string]string)
+			}
+			res.ApprovalSHAs[c.User] = c.SHA
+		}
+		if c.ID != "" {
+			if res.ApprovalIDs == nil {
+				res.ApprovalIDs = make(map[string]string)
+			}
+			res.ApprovalIDs[c.User] = c.ID
+		}
+	}
+	if r.Options.IgnoreDepartedApprovers {
+		if res.Warnings, err = r.departedApprovals(ctx, prctx); err != nil {
+			res.Error = errors.Wrap(err, "failed to check for departed approvers")
+			return
+		}
+	}
+	if len(r.Requires.Environments) > 0 {
+		if res.Environments, err = r.environmentStatus(ctx, prctx); err != nil {
+			res.Error = errors.Wrap(err, "failed to compute environment status")
+			return
+		}
+	}
 	if approved {
 		res.Status = common.StatusApproved
 	} else {
 		res.Status = common.StatusPending
+
+		count, err := r.requiredCount(ctx, prctx)
+		if err != nil {
+			res.Error = err
+			return
+		}
+		res.RequiredCount = count
 	}
 	return
 }
 
 func (r *Rule) IsApproved(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	approved, msg, _, err := r.approval(ctx, prctx)
+	return approved, msg, err
+}
+
+func countUnresolvedThreads(ctx context.Context, prctx pull.Context) (int, error) {
+	threads, err := prctx.ReviewThreads(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list review threads")
+	}
+
+	var unresolved int
+	for _, t := range threads {
+		if !t.Resolved {
+			unresolved++
+		}
+	}
+	return unresolved, nil
+}
+
+// approval is like IsApproved, but also returns the candidates whose approval
+// counted toward the rule.
+func (r *Rule) approval(ctx context.Context, prctx pull.Context) (bool, string, []*common.Candidate, error) {
 	log := zerolog.Ctx(ctx)
 
-	if r.Requires.Count <= 0 {
+	if r.Options.MinimumOpenDuration > 0 {
+		remaining, err := r.remainingOpenDuration(ctx, prctx)
+		if err != nil {
+			return false, "", nil, err
+		}
+		if remaining > 0 {
+			log.Debug().Msgf("rule requires a minimum open duration of %s", r.Options.MinimumOpenDuration)
+			msg := fmt.Sprintf("Waiting %s to satisfy the minimum open duration of %s", formatDuration(remaining), r.Options.MinimumOpenDuration)
+			return false, msg, nil, nil
+		}
+	}
+
+	if r.Options.RequireResolvedThreads {
+		unresolved, err := countUnresolvedThreads(ctx, prctx)
+		if err != nil {
+			return false, "", nil, err
+		}
+		if unresolved > 0 {
+			log.Debug().Msgf("rule requires resolved conversations, found %d unresolved", unresolved)
+			noun := "conversations"
+			if unresolved == 1 {
+				noun = "conversation"
+			}
+			msg := fmt.Sprintf("Waiting for %d unresolved %s", unresolved, noun)
+			return false, msg, nil, nil
+		}
+	}
+
+	if r.Options.RequireApprovedParent {
+		parent, err := pendingParent(ctx, prctx)
+		if err != nil {
+			return false, "", nil, err
+		}
+		if parent != nil {
+			log.Debug().Msgf("rule requires an approved parent, found pending parent #%d", parent.Number)
+			msg := fmt.Sprintf("Waiting for approval of parent pull request #%d", parent.Number)
+			return false, msg, nil, nil
+		}
+	}
+
+	count, err := r.requiredCount(ctx, prctx)
+	if err != nil {
+		return false, "", nil, err
+	}
+
+	// an approving Jira issue replaces the required count of approvals, but
+	// owner and environment approvals are still required
+	var jiraMsg string
+	if r.Requires.Jira != nil {
+		approved, msg, err := r.Requires.Jira.approval(ctx, prctx)
+		if err != nil {
+			return false, "", nil, err
+		}
+		log.Debug().Msgf("rule approval by jira issue: %t", approved)
+
+		switch {
+		case approved:
+			count, jiraMsg = 0, msg
+		case count <= 0:
+			return false, msg, nil, nil
+		}
+	}
+	withJira := func(msg string) string {
+		if jiraMsg == "" {
+			return msg
+		}
+		return jiraMsg + "; " + msg
+	}
+
+	if count <= 0 && r.Requires.OwnersFiles == nil && len(r.Requires.Environments) == 0 {
+		if jiraMsg != "" {
+			return true, jiraMsg, nil, nil
+		}
 		log.Debug().Msg("rule requires no approvals")
-		return true, "No approval required", nil
+		return true, "No approval required", nil, nil
+	}
+
+	candidates, err := r.candidates(ctx, prctx)
+	if err != nil {
+		return false, "", nil, err
+	}
+
+	log.Debug().Msgf("found %d candidates for approval", len(candidates))
+
+	banned, err := r.bannedUsers(ctx, prctx)
+	if err != nil {
+		return false, "", nil, err
+	}
+
+	approvers, err := r.filterApprovers(ctx, prctx, candidates, banned)
+	if err != nil {
+		return false, "", nil, err
+	}
+
+	var rereviewers []string
+	if r.Options.WaitForRereview {
+		approvers, rereviewers, err = r.removeRerequested(ctx, prctx, approvers)
+		if err != nil {
+			return false, "", nil, err
+		}
+	}
+
+	var owners []*common.Candidate
+	if r.Requires.OwnersFiles != nil {
+		var missing []*ownedFile
+		owners, missing, err = r.ownerApproval(ctx, prctx, candidates, banned)
+		if err != nil {
+			return false, "", nil, err
+		}
+		log.Debug().Msgf("found %d changed files without owner approval", len(missing))
+
+		if len(missing) > 0 {
+			msg := fmt.Sprintf("Waiting for approval from the owners of %s", formatOwnedFiles(missing))
+			return false, msg, appendCandidates(approvers, owners), nil
+		}
+		if count <= 0 && len(r.Requires.Environments) == 0 {
+			msg := "No changed files require owner approval"
+			if len(owners) > 0 {
+				msg = fmt.Sprintf("Approved by owners %s", strings.Join(candidateUsers(owners), ", "))
+			}
+			return true, withJira(msg), owners, nil
+		}
+		approvers = appendCandidates(approvers, owners)
+	}
+
+	if len(r.Requires.Environments) > 0 {
+		envApprovers, envs, err := r.environmentApproval(ctx, prctx, candidates, banned)
+		if err != nil {
+			return false, "", nil, err
+		}
+		pending := pendingEnvironments(envs)
+		log.Debug().Msgf("found %d environments without approval", len(pending))
+
+		if len(pending) > 0 {
+			return false, environmentsMessage(envs), appendCandidates(approvers, envApprovers), nil
+		}
+		if count <= 0 {
+			return true, withJira(environmentsMessage(envs)), appendCandidates(owners, envApprovers), nil
+		}
+		approvers = appendCandidates(approvers, envApprovers)
+	}
+
+	log.Debug().Msgf("found %d/%d required approvers", len(approvers), count)
+	remaining := count - len(approvers)
+
+	if remaining <= 0 {
+		msg := fmt.Sprintf("Approved by %s", strings.Join(candidateUsers(approvers), ", "))
+		return true, msg, approvers, nil
 	}
 
-	candidates, err := r.Options.GetMethods().Candidates(ctx, prctx)
+	if len(rereviewers) > 0 {
+		msg := fmt.Sprintf("%d/%d approvals required. Waiting for re-review by %s",
+			len(approvers),
+			count,
+			strings.Join(rereviewers, ", "))
+		return false, msg, approvers, nil
+	}
+
+	if len(candidates) > 0 && len(approvers) == 0 {
+		msg := fmt.Sprintf("%d/%d approvals required. Ignored %s from disqualified users",
+			len(approvers),
+			count,
+			numberOfApprovals(len(candidates)))
+		return false, msg, nil, nil
+	}
+
+	msg := fmt.Sprintf("%d/%d approvals required", len(approvers), count)
+	return false, msg, approvers, nil
+}
+
+// EligibleApprovers returns the sorted usernames of the users who could help
+// satisfy the rule by approving the pull request. Teams, organizations, and
+// repository permissions are expanded to their members. Users disqualified by
+// the rule options, like the author and contributors, and users whose
+// approval already counts towards the rule are excluded. It returns nil if
+// the rule does not require approval.
+func (r *Rule) EligibleApprovers(ctx context.Context, prctx pull.Context) ([]string, error) {
+	count, err := r.requiredCount(ctx, prctx)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 && r.Requires.OwnersFiles == nil && len(r.Requires.Environments) == 0 {
+		return nil, nil
+	}
+
+	var users []string
+	if count > 0 {
+		if users, err = r.Requires.ListUsers(ctx, prctx); err != nil {
+			return nil, errors.Wrap(err, "failed to list required users")
+		}
+	}
+
+	candidates, err := r.candidates(ctx, prctx)
 	if err != nil {
-		return false, "", errors.Wrap(err, "failed to get approval candidates")
+		return nil, err
 	}
+
+	banned, err := r.bannedUsers(ctx, prctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Requires.OwnersFiles != nil {
+		_, missing, err := r.ownerApproval(ctx, prctx, candidates, banned)
+		if err != nil {
+			return nil, err
+		}
+		if users, err = listOwners(ctx, prctx, missing, users); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.Requires.Environments) > 0 {
+		_, envs, err := r.environmentApproval(ctx, prctx, candidates, banned)
+		if err != nil {
+			return nil, err
+		}
+		if users, err = r.Requires.Environments.listApprovers(ctx, prctx, pendingEnvironments(envs), users); err != nil {
+			return nil, err
+		}
+	}
+
+	approvers, err := r.filterApprovers(ctx, prctx, candidates, banned)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range approvers {
+		banned[c.User] = true
+	}
+
+	var eligible []string
+	for _, u := range users {
+		if !banned[u] {
+			eligible = append(eligible, u)
+		}
+	}
+	if len(r.Requires.Attributes) > 0 {
+		return r.usersWithAttributes(ctx, eligible)
+	}
+	return eligible, nil
+}
+
+// requiredCount returns the number of approvals the rule requires for the
+// pull request, which depends on the changed files if the rule sets
+// CountPerMatch.
+func (r *Rule) requiredCount(ctx context.Context, prctx pull.Context) (int, error) {
+	count := r.Requires.Count
+	if len(r.Requires.CountPerMatch) == 0 {
+		return count, nil
+	}
+
+	// check patterns in a fixed order so that errors are deterministic
+	var patterns []string
+	for p := range r.Requires.CountPerMatch {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	paths := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to parse count_per_match path %q", p)
+		}
+		paths[i] = re
+	}
+
+	err := prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		for i, re := range paths {
+			n := r.Requires.CountPerMatch[patterns[i]]
+			if n <= count {
+				continue
+			}
+			for _, p := range f.Paths() {
+				if re.MatchString(p) {
+					count = n
+					break
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list changed files")
+	}
+	return count, nil
+}
+
+// methods returns the approval methods of the rule with file comments scoped
+// to the paths of the rule's file predicates.
+func (r *Rule) methods(ctx context.Context) *common.Methods {
+	m := r.Options.GetMethods(ctx)
+	m.CommentPaths = r.Predicates.filePaths()
+	return m
+}
+
+// candidates returns the approval candidates ordered from oldest to newest,
+// excluding candidates invalidated by a push if required by the options.
+func (r *Rule) candidates(ctx context.Context, prctx pull.Context) ([]*common.Candidate, error) {
+	candidates, err := r.methods(ctx).Candidates(ctx, prctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get approval candidates")
+	}
+	candidates = r.addCarriedApprovals(ctx, prctx, candidates)
+	candidates = r.addDispatchApproval(ctx, prctx, candidates)
+	candidates = r.addSlackApprovals(ctx, prctx, candidates)
 	sort.Stable(common.CandidatesByCreationTime(candidates))
 
 	if r.Options.InvalidateOnPush {
-		commits, err := r.filteredCommits(prctx)
+		commits, err := r.filteredCommits(ctx, prctx)
 		if err != nil {
-			return false, "", err
+			return nil, err
+		}
+		if len(commits) == 0 {
+			return candidates, nil
 		}
 
-		lastCommitTime := commits[len(commits)-1].CreatedAt
+		head := commits[len(commits)-1]
+		if sha := prctx.HeadSHA(); sha != "" {
+			for _, c := range commits {
+				if c.SHA == sha {
+					head = c
+				}
+			}
+		}
+
+		distances := make(map[string]float64)
+		patchIDs := make(map[string]string)
 
 		var allowedCandidates []*common.Candidate
 		for _, candidate := range candidates {
-			if candidate.CreatedAt.After(lastCommitTime) {
+			if candidate.SHA == "" {
+				assignCommit(candidate, commits)
+			}
+			if r.coversHead(candidate, head) {
 				allowedCandidates = append(allowedCandidates, candidate)
+				continue
+			}
+			if r.Options.IgnoreRebases && candidate.SHA != "" {
+				same, err := samePatch(ctx, prctx, candidate.SHA, head.SHA, patchIDs)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					allowedCandidates = append(allowedCandidates, candidate)
+					continue
+				}
+			}
+			if r.Options.InvalidateOnPushThreshold > 0 && candidate.SHA != "" {
+				within, err := r.withinDiffThreshold(ctx, prctx, candidate.SHA, distances)
+				if err != nil {
+					return nil, err
+				}
+				if within {
+					allowedCandidates = append(allowedCandidates, candidate)
+				}
 			}
 		}
 		candidates = allowedCandidates
 	}
 
-	log.Debug().Msgf("found %d candidates for approval", len(candidates))
+	if r.Options.InvalidateOnBaseChange {
+		changedAt, err := r.baseChangedAt(ctx, prctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get base branch change time")
+		}
+
+		if !changedAt.IsZero() {
+			var allowedCandidates []*common.Candidate
+			for _, candidate := range candidates {
+				if candidate.CreatedAt.After(changedAt) {
+					allowedCandidates = append(allowedCandidates, candidate)
+				}
+			}
+			candidates = allowedCandidates
+		}
+	}
+
+	if r.Options.IgnoreDepartedApprovers {
+		if candidates, err = removeDeparted(ctx, prctx, candidates); err != nil {
+			return nil, err
+		}
+	}
 
-	author, err := prctx.Author()
+	if r.Options.IgnoreRecentLineAuthors > 0 {
+		if candidates, err = r.removeRecentLineAuthors(ctx, prctx, candidates); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.Requires.Attributes) > 0 {
+		if candidates, err = r.removeByAttributes(ctx, candidates); err != nil {
+			return nil, err
+		}
+	}
+
+	return candidates, nil
+}
+
+// coversHead returns true if the candidate's approval applies to the head
+// commit of the pull request. Approvals given after the most recent push or
+// on the head commit always count. If the rule ignores trivial rebases,
+// approvals of a commit with the same tree as the head also count.
+func (r *Rule) coversHead(c *common.Candidate, head *pull.Commit) bool {
+	switch {
+	case c.CreatedAt.After(head.CreatedAt):
+		return true
+	case c.SHA != "" && c.SHA == head.SHA:
+		return true
+	case r.Options.IgnoreTrivialRebases && c.TreeSHA != "" && c.TreeSHA == head.TreeSHA:
+		return true
+	}
+	return false
+}
+
+// assignCommit sets the commit of a candidate that did not record one to the
+// most recent commit pushed before the candidate was created. The commits
+// must be ordered from oldest to newest.
+func assignCommit(c *common.Candidate, commits []*pull.Commit) {
+	for _, commit := range commits {
+		if commit.CreatedAt.After(c.CreatedAt) {
+			break
+		}
+		c.SHA = commit.SHA
+		c.TreeSHA = commit.TreeSHA
+	}
+}
+
+// bannedUsers returns the users who may not approve the rule because of the
+// approval options.
+func (r *Rule) bannedUsers(ctx context.Context, prctx pull.Context) (map[string]bool, error) {
+	author, err := prctx.Author(ctx)
 	if err != nil {
-		return false, "", err
+		return nil, err
 	}
 
-	// collect users "banned" by approval options
 	banned := make(map[string]bool)
 
 	// "author" is the user who opened the PR
 	// if contributors are allowed, the author counts as a contributor
 	if !r.Options.AllowAuthor && !r.Options.AllowContributor {
-		banned[author] = true
+		allowed, err := r.authorAllowedByPredicates(ctx, prctx)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			banned[author] = true
+		}
 	}
 
 	// "contributor" is any user who added a commit to the PR
 	if !r.Options.AllowContributor {
-		commits, err := r.filteredCommits(prctx)
+		commits, err := r.filteredCommits(ctx, prctx)
 		if err != nil {
-			return false, "", err
+			return nil, err
 		}
 
 		for _, c := range commits {
@@ -172,69 +809,239 @@ func (r *Rule) IsApproved(ctx context.Context, prctx pull.Context) (bool, string
 		}
 	}
 
-	// filter real approvers using banned status and required membership
-	var approvers []string
+	return banned, nil
+}
+
+// authorAllowedByPredicates returns true if the rule allows approval by the
+// author because the pull request satisfies the allow_author_if predicates.
+func (r *Rule) authorAllowedByPredicates(ctx context.Context, prctx pull.Context) (bool, error) {
+	if r.Options.AllowAuthorIf == nil {
+		return false, nil
+	}
+
+	// an empty block would otherwise be satisfied by every pull request
+	predicates := r.Options.AllowAuthorIf.Predicates()
+	if len(predicates) == 0 {
+		return false, nil
+	}
+
+	for _, p := range predicates {
+		satisfied, _, err := p.Evaluate(ctx, prctx)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to evaluate author approval predicate")
+		}
+		if !satisfied {
+			zerolog.Ctx(ctx).Debug().Msgf("author approval predicate of type %T was not satisfied", p)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// filterApprovers returns the users of the candidates who are not banned and
+// satisfy the required membership.
+func (r *Rule) filterApprovers(ctx context.Context, prctx pull.Context, candidates []*common.Candidate, banned map[string]bool) ([]*common.Candidate, error) {
+	log := zerolog.Ctx(ctx)
+
+	var approvers []*common.Candidate
 	for _, c := range candidates {
 		if banned[c.User] {
 			log.Debug().Str("user", c.User).Msg("rejecting approval by banned user")
 			continue
 		}
 
+		if r.isRequiredTeamReview(c) {
+			log.Debug().Str("user", c.User).Msgf("accepting approval on behalf of teams %s", strings.Join(c.OnBehalfOf, ", "))
+			approvers = append(approvers, c)
+			continue
+		}
+
 		isApprover, err := r.Requires.IsActor(ctx, prctx, c.User)
 		if err != nil {
-			return false, "", errors.Wrap(err, "failed to check candidate status")
+			return nil, errors.Wrap(err, "failed to check candidate status")
 		}
 		if !isApprover {
 			log.Debug().Str("user", c.User).Msg("ignoring approval by non-whitelisted user")
 			continue
 		}
 
-		approvers = append(approvers, c.User)
+		approvers = append(approvers, c)
 	}
+	return approvers, nil
+}
 
-	log.Debug().Msgf("found %d/%d required approvers", len(approvers), r.Requires.Count)
-	remaining := r.Requires.Count - len(approvers)
+// isRequiredTeamReview returns true if the rule allows team reviews and the
+// candidate's review satisfied a review request for a required team.
+func (r *Rule) isRequiredTeamReview(c *common.Candidate) bool {
+	if !r.Options.AllowTeamReviews {
+		return false
+	}
+	for _, team := range c.OnBehalfOf {
+		for _, required := range r.Requires.Teams {
+			if strings.EqualFold(team, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	if remaining <= 0 {
-		msg := fmt.Sprintf("Approved by %s", strings.Join(approvers, ", "))
-		return true, msg, nil
+// ownerApproval is like OwnersRequirement.approval, but only considers
+// candidates allowed by the rule options.
+func (r *Rule) ownerApproval(ctx context.Context, prctx pull.Context, candidates []*common.Candidate, banned map[string]bool) ([]*common.Candidate, []*ownedFile, error) {
+	allowed, err := r.allowedCandidates(ctx, prctx, candidates, banned)
+	if err != nil {
+		return nil, nil, err
 	}
+	return r.Requires.OwnersFiles.approval(ctx, prctx, allowed)
+}
 
-	if len(candidates) > 0 && len(approvers) == 0 {
-		msg := fmt.Sprintf("%d/%d approvals required. Ignored %s from disqualified users",
-			len(approvers),
-			r.Requires.Count,
-			numberOfApprovals(len(candidates)))
-		return false, msg, nil
+// environmentApproval is like EnvironmentRequirement.approval, but only
+// considers candidates allowed by the rule options.
+func (r *Rule) environmentApproval(ctx context.Context, prctx pull.Context, candidates []*common.Candidate, banned map[string]bool) ([]*common.Candidate, []*common.EnvironmentStatus, error) {
+	allowed, err := r.allowedCandidates(ctx, prctx, candidates, banned)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Requires.Environments.approval(ctx, prctx, allowed)
+}
+
+// environmentStatus returns the approval status of each deployment
+// environment affected by the pull request.
+func (r *Rule) environmentStatus(ctx context.Context, prctx pull.Context) ([]*common.EnvironmentStatus, error) {
+	candidates, err := r.candidates(ctx, prctx)
+	if err != nil {
+		return nil, err
+	}
+
+	banned, err := r.bannedUsers(ctx, prctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, envs, err := r.environmentApproval(ctx, prctx, candidates, banned)
+	return envs, err
+}
+
+// allowedCandidates removes banned users and, if the rule waits for
+// re-review, users with a pending review request from the candidates.
+func (r *Rule) allowedCandidates(ctx context.Context, prctx pull.Context, candidates []*common.Candidate, banned map[string]bool) ([]*common.Candidate, error) {
+	var allowed []*common.Candidate
+	for _, c := range candidates {
+		if !banned[c.User] {
+			allowed = append(allowed, c)
+		}
+	}
+
+	if r.Options.WaitForRereview {
+		var err error
+		if allowed, _, err = r.removeRerequested(ctx, prctx, allowed); err != nil {
+			return nil, err
+		}
 	}
+	return allowed, nil
+}
 
-	msg := fmt.Sprintf("%d/%d approvals required", len(approvers), r.Requires.Count)
-	return false, msg, nil
+// appendCandidates appends the candidates in more to candidates, skipping
+// users who are already present.
+func appendCandidates(candidates []*common.Candidate, more []*common.Candidate) []*common.Candidate {
+	present := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		present[c.User] = true
+	}
+	for _, c := range more {
+		if !present[c.User] {
+			present[c.User] = true
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// removeRerequested removes approvers who have a pending review request,
+// meaning they were asked to review the pull request again after approving.
+// It returns the remaining approvers and the removed users.
+func (r *Rule) removeRerequested(ctx context.Context, prctx pull.Context, approvers []*common.Candidate) ([]*common.Candidate, []string, error) {
+	requested, err := prctx.RequestedReviewers(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get requested reviewers")
+	}
+
+	isRequested := make(map[string]bool, len(requested.Users))
+	for _, u := range requested.Users {
+		isRequested[u] = true
+	}
+
+	var remaining []*common.Candidate
+	var removed []string
+	for _, c := range approvers {
+		if isRequested[c.User] {
+			zerolog.Ctx(ctx).Debug().Str("user", c.User).Msg("ignoring approval by user with a pending re-review request")
+			removed = append(removed, c.User)
+			continue
+		}
+		remaining = append(remaining, c)
+	}
+	return remaining, removed, nil
+}
+
+func candidateUsers(candidates []*common.Candidate) []string {
+	users := make([]string, len(candidates))
+	for i, c := range candidates {
+		users[i] = c.User
+	}
+	return users
+}
+
+// remainingOpenDuration returns how long the rule must wait until the pull
+// request has been open and unchanged for the minimum duration.
+func (r *Rule) remainingOpenDuration(ctx context.Context, prctx pull.Context) (time.Duration, error) {
+	start, err := prctx.CreatedAt(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get pull request creation time")
+	}
+
+	commits, err := r.filteredCommits(ctx, prctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(commits) > 0 {
+		if lastPush := commits[len(commits)-1].CreatedAt; lastPush.After(start) {
+			start = lastPush
+		}
+	}
+
+	return time.Until(start.Add(r.Options.MinimumOpenDuration.Duration())), nil
 }
 
 // filteredCommits returns relevant commits ordered from oldest to newest.
-func (r *Rule) filteredCommits(prctx pull.Context) ([]*pull.Commit, error) {
-	commits, err := prctx.Commits()
+func (r *Rule) filteredCommits(ctx context.Context, prctx pull.Context) ([]*pull.Commit, error) {
+	commits, err := prctx.Commits(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to list commits")
 	}
 
 	sort.Stable(pull.CommitsByCreationTime(commits))
 
-	needsFiltering := r.Options.IgnoreUpdateMerges
+	ignored, _ := ctx.Value(ignoredCommitAuthorsKey{}).([]string)
+	needsFiltering := r.Options.IgnoreUpdateMerges || len(ignored) > 0
 	if !needsFiltering {
 		return commits, nil
 	}
 
 	var filtered []*pull.Commit
 	for _, c := range commits {
-		isUpdate, err := isUpdateMerge(prctx, c)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to detemine update merge status")
+		isUpdate := false
+		if r.Options.IgnoreUpdateMerges {
+			var err error
+			if isUpdate, err = isUpdateMerge(ctx, prctx, c); err != nil {
+				return nil, errors.Wrap(err, "failed to detemine update merge status")
+			}
 		}
 
 		switch {
 		case isUpdate:
+		case isIgnoredCommit(ctx, c):
 		default:
 			filtered = append(filtered, c)
 		}
@@ -242,7 +1049,7 @@ func (r *Rule) filteredCommits(prctx pull.Context) ([]*pull.Commit, error) {
 	return filtered, nil
 }
 
-func isUpdateMerge(prctx pull.Context, c *pull.Commit) (bool, error) {
+func isUpdateMerge(ctx context.Context, prctx pull.Context, c *pull.Commit) (bool, error) {
 	// must be a simple merge commit (exactly 2 parents)
 	if len(c.Parents) != 2 {
 		return false, nil
@@ -254,7 +1061,7 @@ func isUpdateMerge(prctx pull.Context, c *pull.Commit) (bool, error) {
 	}
 
 	// one parent must exist in recent history on the target branch
-	targets, err := prctx.TargetCommits()
+	targets, err := prctx.TargetCommits(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -267,6 +1074,13 @@ func isUpdateMerge(prctx pull.Context, c *pull.Commit) (bool, error) {
 	return false, nil
 }
 
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	return d.Round(time.Minute).String()
+}
+
 func numberOfApprovals(count int) string {
 	if count == 1 {
 		return "1 approval"
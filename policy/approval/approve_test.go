@@ -17,14 +17,19 @@ package approval
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/palantir/policy-bot/identity"
+	"github.com/palantir/policy-bot/jira"
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
 )
@@ -177,6 +182,49 @@ func TestIsApproved(t *testing.T) {
 		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
 	})
 
+	t.Run("authorCanApproveIfPredicates", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "docs/README.md"},
+		}
+
+		r := &Rule{
+			Options: Options{
+				AllowAuthorIf: &Predicates{
+					OnlyChangedFiles: &predicate.OnlyChangedFiles{
+						Paths: []string{"^docs/.*$"},
+					},
+				},
+			},
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"mhaypenny"},
+				},
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by mhaypenny")
+
+		prctx.ChangedFilesValue = append(prctx.ChangedFilesValue, &pull.File{Filename: "app/main.go"})
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+	})
+
+	t.Run("authorCannotApproveIfNoPredicates", func(t *testing.T) {
+		prctx := basePullContext()
+		r := &Rule{
+			Options: Options{
+				AllowAuthorIf: &Predicates{},
+			},
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"mhaypenny"},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+	})
+
 	t.Run("contributorsCannotApprove", func(t *testing.T) {
 		prctx := basePullContext()
 		r := &Rule{
@@ -319,65 +367,1154 @@ func TestIsApproved(t *testing.T) {
 		assertPending(t, prctx, r, "0/1 approvals required")
 	})
 
-	t.Run("ignoreUpdateMergeAfterReview", func(t *testing.T) {
+	t.Run("invalidateOnPushApprovalOfHead", func(t *testing.T) {
 		prctx := basePullContext()
-		prctx.CommitsValue = append(prctx.CommitsValue[:1], &pull.Commit{
-			CreatedAt:       now.Add(25 * time.Second),
-			SHA:             "647c5078288f0ea9de27b5c280f25edaf2089045",
-			CommittedViaWeb: true,
-			Parents: []string{
-				"c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
-				"2e1b0bb6ab144bf7a1b7a1df9d3bdcb0fe85a206",
+		prctx.HeadSHAValue = "c6ade256ecfc755d8bc877ef22cc9e01745d46bb"
+		prctx.CommitsValue = []*pull.Commit{
+			{
+				CreatedAt: now.Add(85 * time.Second),
+				SHA:       "c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				Author:    "mhaypenny",
+				Committer: "mhaypenny",
 			},
-			Author: "merge-committer",
+		}
+		prctx.ReviewsValue[1].SHA = "c6ade256ecfc755d8bc877ef22cc9e01745d46bb"
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by review-approver")
+	})
+
+	t.Run("ignoreTrivialRebases", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.HeadSHAValue = "3b5d4a8bd2dcd0180ac3137b085ab3fb55a83f07"
+		prctx.CommitsValue = append(prctx.CommitsValue, &pull.Commit{
+			CreatedAt: now.Add(85 * time.Second),
+			SHA:       "3b5d4a8bd2dcd0180ac3137b085ab3fb55a83f07",
+			TreeSHA:   "0e2ac5a4b1ba4b7d4a6c5e104c2d3bd5832ad2c8",
+			Author:    "mhaypenny",
+			Committer: "mhaypenny",
 		})
+		prctx.ReviewsValue[1].SHA = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+		prctx.ReviewsValue[1].TreeSHA = "0e2ac5a4b1ba4b7d4a6c5e104c2d3bd5832ad2c8"
 
 		r := &Rule{
 			Requires: Requires{
 				Count: 1,
 				Actors: common.Actors{
-					Users: []string{"comment-approver"},
+					Users: []string{"review-approver"},
 				},
 			},
 			Options: Options{
 				InvalidateOnPush: true,
 			},
 		}
-		assertPending(t, prctx, r, "0/1 approvals required. Ignored 4 approvals from disqualified users")
+		assertPending(t, prctx, r, "0/1 approvals required")
 
-		r.Options.IgnoreUpdateMerges = true
-		assertApproved(t, prctx, r, "Approved by comment-approver")
+		r.Options.IgnoreTrivialRebases = true
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		prctx.ReviewsValue[1].TreeSHA = "9dfe5ff0ba1f4b5a1aa8c2a06f2fa0ab4a2d69b5"
+		assertPending(t, prctx, r, "0/1 approvals required")
 	})
 
-	t.Run("ignoreUpdateMergeContributor", func(t *testing.T) {
+	t.Run("ignoreRebases", func(t *testing.T) {
 		prctx := basePullContext()
-		prctx.CommitsValue = append(prctx.CommitsValue[:1], &pull.Commit{
-			CreatedAt:       now.Add(25 * time.Second),
-			SHA:             "647c5078288f0ea9de27b5c280f25edaf2089045",
-			CommittedViaWeb: true,
-			Parents: []string{
-				"c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
-				"2e1b0bb6ab144bf7a1b7a1df9d3bdcb0fe85a206",
+		prctx.HeadSHAValue = "3b5d4a8bd2dcd0180ac3137b085ab3fb55a83f07"
+		prctx.CommitsValue = append(prctx.CommitsValue, &pull.Commit{
+			CreatedAt: now.Add(85 * time.Second),
+			SHA:       "3b5d4a8bd2dcd0180ac3137b085ab3fb55a83f07",
+			Author:    "mhaypenny",
+			Committer: "mhaypenny",
+		})
+		prctx.ReviewsValue[1].SHA = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "app.go", Status: pull.FileModified, Patch: "@@ -10,2 +12,3 @@\n context\n-old\n+new"},
+		}
+		prctx.CommitChangedFilesValue = map[string][]*pull.File{
+			"97d5ea26da319a987d80f6db0b7ef759f2f2e441": {
+				{Filename: "app.go", Status: pull.FileModified, Patch: "@@ -4,2 +4,3 @@\n context\n-old\n+new"},
 			},
-			Author: "merge-committer",
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		r.Options.IgnoreRebases = true
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		prctx.ChangedFilesValue[0].Patch = "@@ -10,2 +12,3 @@\n context\n-old\n+newer"
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
+	t.Run("invalidateOnPushThreshold", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.HeadSHAValue = "3b5d4a8bd2dcd0180ac3137b085ab3fb55a83f07"
+		prctx.CommitsValue = append(prctx.CommitsValue, &pull.Commit{
+			CreatedAt: now.Add(85 * time.Second),
+			SHA:       "3b5d4a8bd2dcd0180ac3137b085ab3fb55a83f07",
+			Author:    "mhaypenny",
+			Committer: "mhaypenny",
 		})
-		prctx.CommentsValue = append(prctx.CommentsValue, &pull.Comment{
-			CreatedAt: now.Add(100 * time.Second),
-			Author:    "merge-committer",
-			Body:      ":+1:",
+		prctx.ReviewsValue[1].SHA = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "app.go", Status: pull.FileModified, Patch: "@@ -10,2 +12,3 @@\n context\n-old\n+new\n+added"},
+		}
+		prctx.CommitChangedFilesValue = map[string][]*pull.File{
+			"97d5ea26da319a987d80f6db0b7ef759f2f2e441": {
+				{Filename: "app.go", Status: pull.FileModified, Patch: "@@ -4,2 +4,3 @@\n context\n-old\n+new\n+added"},
+			},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		r.Options.InvalidateOnPushThreshold = 0.25
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		prctx.ChangedFilesValue = append(prctx.ChangedFilesValue, &pull.File{
+			Filename: "new.go", Status: pull.FileAdded, Patch: "@@ -0,0 +1,2 @@\n+package app\n+// more",
+		})
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
+	t.Run("waitForRereview", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.RequestedReviewersValue = []string{"review-approver", "other-user"}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver", "review-approver"},
+				},
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		r.Options.WaitForRereview = true
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+
+		r.Requires.Count = 2
+		assertPending(t, prctx, r, "1/2 approvals required. Waiting for re-review by review-approver")
+	})
+
+	t.Run("invalidateOnBaseChange", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.BaseChangedAtValue = now.Add(75 * time.Second)
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver", "review-approver"},
+				},
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		r.Options.InvalidateOnBaseChange = true
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		prctx.BaseChangedAtValue = now.Add(90 * time.Second)
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
+	t.Run("ignoreStackRetargets", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.BaseChangedAtValue = now.Add(90 * time.Second)
+		prctx.TimelineValue = []*pull.TimelineEvent{
+			{Type: pull.TimelineBaseChanged, CreatedAt: now.Add(90 * time.Second), PreviousRef: "feature-base", CurrentRef: "develop"},
+		}
+		prctx.BranchPullRequestsValue = map[string]*pull.PullRequestRef{
+			"feature-base": {Number: 12, Base: "develop", Head: "feature-base", Merged: true},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver", "review-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnBaseChange: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		r.Options.IgnoreStackRetargets = true
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		// retargets to a different branch than the base of the parent count
+		prctx.TimelineValue[0].CurrentRef = "main"
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		// retargets while the parent is not merged count
+		prctx.TimelineValue[0].CurrentRef = "develop"
+		prctx.BranchPullRequestsValue["feature-base"].Merged = false
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
+	t.Run("organizationDefaultMethods", func(t *testing.T) {
+		orgCtx := common.WithDefaultMethods(ctx, common.DefaultMethods{
+			Approve: &common.Methods{
+				Comments: []string{"LGTM"},
+			},
 		})
 
+		prctx := basePullContext()
 		r := &Rule{
 			Requires: Requires{
 				Count: 1,
 				Actors: common.Actors{
-					Users: []string{"merge-committer"},
+					Users: []string{"comment-approver", "review-approver"},
 				},
 			},
 		}
-		assertPending(t, prctx, r, "0/1 approvals required. Ignored 6 approvals from disqualified users")
 
-		r.Options.IgnoreUpdateMerges = true
-		assertApproved(t, prctx, r, "Approved by merge-committer")
+		approved, msg, err := r.IsApproved(orgCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by comment-approver", msg)
+
+		// methods in the rule override the organization defaults
+		r.Options.Methods = &common.Methods{
+			GithubReview: true,
+		}
+
+		approved, msg, err = r.IsApproved(orgCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by review-approver", msg)
+	})
+
+	t.Run("minimumOpenDuration", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CreatedAtValue = now.Add(-48 * time.Hour)
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver"},
+				},
+			},
+			Options: Options{
+				MinimumOpenDuration: common.Duration(24 * time.Hour),
+			},
+		}
+
+		// the most recent commit was pushed too recently
+		approved, msg, err := r.IsApproved(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+		assert.Contains(t, msg, "minimum open duration of 24h0m0s")
+
+		for _, c := range prctx.CommitsValue {
+			c.CreatedAt = c.CreatedAt.Add(-36 * time.Hour)
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+
+		// the pull request was opened too recently
+		prctx.CreatedAtValue = now.Add(-1 * time.Hour)
+		approved, _, err = r.IsApproved(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+	})
+
+	t.Run("requireResolvedThreads", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ReviewThreadsValue = []*pull.ReviewThread{
+			{Path: "app.go", Author: "comment-approver", Resolved: true},
+			{Path: "app.go", Author: "other-user", Outdated: true},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver"},
+				},
+			},
+			Options: Options{
+				RequireResolvedThreads: true,
+			},
+		}
+
+		approved, msg, err := r.IsApproved(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+		assert.Equal(t, "Waiting for 1 unresolved conversation", msg)
+
+		prctx.ReviewThreadsValue[1].Resolved = true
+		assertApproved(t, prctx, r, "Approved by comment-approver")
 	})
+
+	t.Run("requireApprovedParent", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.BranchBaseName = "feature-base"
+		prctx.BranchPullRequestsValue = map[string]*pull.PullRequestRef{
+			"feature-base": {
+				Number: 12,
+				Base:   "develop",
+				Head:   "feature-base",
+				Open:   true,
+				Statuses: map[string]string{
+					"policy-bot: develop": "pending",
+				},
+			},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver"},
+				},
+			},
+			Options: Options{
+				RequireApprovedParent: true,
+			},
+		}
+		assertPending(t, prctx, r, "Waiting for approval of parent pull request #12")
+
+		prctx.BranchPullRequestsValue["feature-base"].Statuses["policy-bot: develop"] = "success"
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+
+		// the parent status uses the status check context of the server
+		customCtx := WithStatusCheckContext(ctx, "approvals")
+		approved, msg, err := r.IsApproved(customCtx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+		assert.Equal(t, "Waiting for approval of parent pull request #12", msg)
+
+		// merged parents do not block approval
+		prctx.BranchPullRequestsValue["feature-base"].Open = false
+		prctx.BranchPullRequestsValue["feature-base"].Merged = true
+		approved, _, err = r.IsApproved(customCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+	})
+
+	t.Run("ignoreDepartedApprovers", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.OwnerValue = "everyone"
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 2,
+				Actors: common.Actors{
+					Users: []string{"comment-approver", "review-approver"},
+				},
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		r.Options.IgnoreDepartedApprovers = true
+		prctx.SuspendedUsers = []string{"comment-approver"}
+		assertPending(t, prctx, r, "1/2 approvals required")
+
+		prctx.SuspendedUsers = nil
+		prctx.OrgMemberships["review-approver"] = []string{"even-cooler-org"}
+		assertPending(t, prctx, r, "1/2 approvals required")
+
+		res := r.Evaluate(ctx, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, []string{"Ignored approval by review-approver because the user is no longer a member of everyone"}, res.Warnings)
+
+		// outside collaborators keep access to the repository
+		prctx.OutsideCollaborators = map[string][]string{"review-approver": {"everyone"}}
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+	})
+
+	t.Run("ignoreRecentLineAuthors", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CreatedAtValue = now
+		prctx.ChangedFilesValue = []*pull.File{
+			{
+				Filename: "app/main.go",
+				Status:   pull.FileModified,
+				Patch:    "@@ -10,3 +10,3 @@\n a\n-b\n+c\n d",
+			},
+			{
+				Filename:         "app/util.go",
+				PreviousFilename: "app/helpers.go",
+				Status:           pull.FileModified,
+				Patch:            "@@ -1,2 +1,1 @@\n-x\n y",
+			},
+			{
+				Filename: "app/new.go",
+				Status:   pull.FileAdded,
+				Patch:    "@@ -0,0 +1 @@\n+z",
+			},
+		}
+		prctx.BlameValue = map[string]map[int]*pull.BlameLine{
+			"app/main.go": {
+				10: {Author: "review-approver", AuthoredAt: now.Add(-time.Hour)},
+				11: {Author: "comment-approver", AuthoredAt: now.Add(-30 * 24 * time.Hour)},
+			},
+			"app/helpers.go": {
+				1: {Author: "other-user", AuthoredAt: now.Add(-2 * time.Hour)},
+			},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 2,
+				Actors: common.Actors{
+					Users: []string{"comment-approver", "review-approver", "other-user"},
+				},
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		// review-approver recently wrote an unchanged context line and
+		// comment-approver wrote the modified line, but not recently
+		r.Options.IgnoreRecentLineAuthors = 7 * 24 * time.Hour
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		r.Options.IgnoreRecentLineAuthors = 60 * 24 * time.Hour
+		assertPending(t, prctx, r, "1/2 approvals required")
+
+		prctx.BlameValue["app/main.go"][11].Author = "review-approver"
+		r.Requires.Count = 1
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+
+		prctx.BlameError = errors.New("blame failed")
+		_, _, err := r.IsApproved(ctx, prctx)
+		assert.EqualError(t, err, "failed to find recent authors of changed lines: failed to get blame of app/main.go: blame failed")
+	})
+
+	t.Run("jiraIssue", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.TitleValue = "OPS-7: Rotate credentials"
+		prctx.BodyValue = "Change request: CHG-123"
+
+		statuses := staticJira{"OPS-7": "Change Approved", "CHG-123": "In Review"}
+		jiraCtx := jira.WithProvider(ctx, statuses)
+
+		r := &Rule{
+			Requires: Requires{
+				Jira: &JiraRequirement{
+					Statuses: []string{"change approved"},
+					Projects: []string{"CHG"},
+				},
+			},
+		}
+
+		approved, msg, err := r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+		assert.Equal(t, "Waiting for Jira issue CHG-123 to reach change approved", msg)
+
+		statuses["CHG-123"] = "Change Approved"
+		approved, msg, err = r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by Jira issue CHG-123 (Change Approved)", msg)
+
+		// approvals still satisfy the rule when the issue is not approved
+		statuses["CHG-123"] = "Rejected"
+		r.Requires.Count = 1
+		r.Requires.Users = []string{"comment-approver"}
+		approved, msg, err = r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by comment-approver", msg)
+
+		prctx.BodyValue = ""
+		r.Requires.Count = 0
+		approved, msg, err = r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+		assert.Equal(t, "No linked Jira issue", msg)
+
+		_, _, err = r.IsApproved(ctx, prctx)
+		assert.Error(t, err, "missing jira configuration did not cause an error")
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		prctx := basePullContext()
+
+		users := identity.NewClient(identity.Config{
+			Users: map[string]map[string][]string{
+				"comment-approver": {"region": {"US"}},
+				"review-approver":  {"region": {"eu"}},
+			},
+		}, nil)
+		idCtx := identity.WithProvider(ctx, users)
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver", "review-approver"},
+				},
+				Attributes: AttributeRequirement{
+					"region": {"eu"},
+				},
+			},
+		}
+
+		approved, msg, err := r.IsApproved(idCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by review-approver", msg)
+
+		r.Requires.Count = 2
+		approved, msg, err = r.IsApproved(idCtx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "pull request was incorrectly approved")
+		assert.Equal(t, "1/2 approvals required", msg)
+
+		r.Requires.Attributes["region"] = []string{"eu", "us"}
+		approved, msg, err = r.IsApproved(idCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by comment-approver, review-approver", msg)
+
+		_, _, err = r.IsApproved(ctx, prctx)
+		assert.Error(t, err, "missing identity configuration did not cause an error")
+	})
+
+	t.Run("ignoreUpdateMergeAfterReview", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue[:1], &pull.Commit{
+			CreatedAt:       now.Add(25 * time.Second),
+			SHA:             "647c5078288f0ea9de27b5c280f25edaf2089045",
+			CommittedViaWeb: true,
+			Parents: []string{
+				"c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				"2e1b0bb6ab144bf7a1b7a1df9d3bdcb0fe85a206",
+			},
+			Author: "merge-committer",
+		})
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 4 approvals from disqualified users")
+
+		r.Options.IgnoreUpdateMerges = true
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+	})
+
+	t.Run("ignoreUpdateMergeContributor", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue[:1], &pull.Commit{
+			CreatedAt:       now.Add(25 * time.Second),
+			SHA:             "647c5078288f0ea9de27b5c280f25edaf2089045",
+			CommittedViaWeb: true,
+			Parents: []string{
+				"c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				"2e1b0bb6ab144bf7a1b7a1df9d3bdcb0fe85a206",
+			},
+			Author: "merge-committer",
+		})
+		prctx.CommentsValue = append(prctx.CommentsValue, &pull.Comment{
+			CreatedAt: now.Add(100 * time.Second),
+			Author:    "merge-committer",
+			Body:      ":+1:",
+		})
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"merge-committer"},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 6 approvals from disqualified users")
+
+		r.Options.IgnoreUpdateMerges = true
+		assertApproved(t, prctx, r, "Approved by merge-committer")
+	})
+
+	t.Run("ignoredCommitAuthors", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue, &pull.Commit{
+			CreatedAt: now.Add(100 * time.Second),
+			SHA:       "9a3d6a6bd8ab2e6d2f3c8b4a0f0ed2e6a7f4f1c5",
+			Author:    "dependabot[bot]",
+		})
+		prctx.CommentsValue = append(prctx.CommentsValue, &pull.Comment{
+			CreatedAt: now.Add(50 * time.Second),
+			Author:    "comment-approver",
+			Body:      ":+1:",
+		})
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"comment-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		ctx := WithIgnoredCommitAuthors(context.Background(), []string{"dependabot[bot]"})
+		allowed, msg, err := r.IsApproved(ctx, prctx)
+		require.NoError(t, err)
+		assert.True(t, allowed, "pull request was not approved")
+		assert.Equal(t, "Approved by comment-approver", msg)
+	})
+
+	t.Run("allowTeamReviews", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ReviewsValue = append(prctx.ReviewsValue, &pull.Review{
+			CreatedAt:  now.Add(90 * time.Second),
+			Author:     "team-reviewer",
+			State:      pull.ReviewApproved,
+			OnBehalfOf: []string{"everyone/team-dba"},
+		})
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 2,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+					Teams: []string{"everyone/team-dba"},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "1/2 approvals required")
+
+		r.Options.AllowTeamReviews = true
+		assertApproved(t, prctx, r, "Approved by review-approver, team-reviewer")
+
+		r.Requires.Teams = []string{"everyone/team-other"}
+		assertPending(t, prctx, r, "1/2 approvals required")
+	})
+
+	t.Run("carriedApprovals", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.HeadSHAValue = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+
+		r := &Rule{
+			Name: "carried",
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"carried-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 3 approvals from disqualified users")
+
+		ctx := WithCarriedApprovals(context.Background(), map[string][]*common.Candidate{
+			"carried": {
+				{User: "carried-approver", CreatedAt: now.Add(-time.Hour), SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb"},
+			},
+		})
+		allowed, msg, err := r.IsApproved(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, allowed, "approval of a different commit was carried over")
+		assert.Equal(t, "0/1 approvals required. Ignored 3 approvals from disqualified users", msg)
+
+		ctx = WithCarriedApprovals(context.Background(), map[string][]*common.Candidate{
+			"carried": {
+				{User: "carried-approver", CreatedAt: now.Add(-time.Hour), SHA: prctx.HeadSHAValue},
+			},
+			"other": {
+				{User: "comment-approver", CreatedAt: now.Add(-time.Hour), SHA: prctx.HeadSHAValue},
+			},
+		})
+		allowed, msg, err = r.IsApproved(ctx, prctx)
+		require.NoError(t, err)
+		assert.True(t, allowed, "pull request was not approved")
+		assert.Equal(t, "Approved by carried-approver", msg)
+	})
+
+	t.Run("dispatchDecisions", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.HeadSHAValue = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+
+		r := &Rule{
+			Name: "risk",
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"risk-scorer[bot]"},
+				},
+			},
+			Options: Options{
+				Methods: &common.Methods{
+					GithubActionsDispatch: true,
+				},
+			},
+		}
+
+		approve := WithDispatchDecisions(context.Background(), map[string]*DispatchDecision{
+			"risk": {Actor: "risk-scorer[bot]", SHA: prctx.HeadSHAValue, CreatedAt: now},
+		})
+		allowed, msg, err := r.IsApproved(approve, prctx)
+		require.NoError(t, err)
+		assert.True(t, allowed, "pull request was not approved")
+		assert.Equal(t, "Approved by risk-scorer[bot]", msg)
+
+		old := WithDispatchDecisions(context.Background(), map[string]*DispatchDecision{
+			"risk": {Actor: "risk-scorer[bot]", SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb", CreatedAt: now},
+		})
+		allowed, _, err = r.IsApproved(old, prctx)
+		require.NoError(t, err)
+		assert.False(t, allowed, "decision for a different commit was used")
+
+		veto := WithDispatchDecisions(context.Background(), map[string]*DispatchDecision{
+			"risk": {Actor: "risk-scorer[bot]", Veto: true, SHA: prctx.HeadSHAValue, CreatedAt: now},
+		})
+		res := r.Evaluate(veto, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, common.StatusPending, res.Status)
+		assert.Equal(t, "Vetoed by risk-scorer[bot]", res.Description)
+
+		r.Options.Methods = &common.Methods{GithubReview: true}
+		allowed, _, err = r.IsApproved(approve, prctx)
+		require.NoError(t, err)
+		assert.False(t, allowed, "decision was used by a rule without the dispatch method")
+	})
+
+	t.Run("slackDecisions", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.HeadSHAValue = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+
+		r := &Rule{
+			Name: "chat",
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver", "slack-approver"},
+				},
+			},
+			Options: Options{
+				Methods: &common.Methods{
+					GithubReview: true,
+					Slack:        true,
+				},
+			},
+		}
+
+		approve := WithSlackDecisions(context.Background(), map[string][]*SlackDecision{
+			"chat": {{User: "slack-approver", SHA: prctx.HeadSHAValue, CreatedAt: now}},
+		})
+		res := r.Evaluate(approve, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, common.StatusApproved, res.Status)
+		assert.ElementsMatch(t, []string{"review-approver", "slack-approver"}, res.Approvers)
+
+		reject := WithSlackDecisions(context.Background(), map[string][]*SlackDecision{
+			"chat": {
+				{User: "review-approver", SHA: prctx.HeadSHAValue, Reject: true, CreatedAt: now},
+				{User: "slack-approver", SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb", CreatedAt: now},
+			},
+		})
+		allowed, _, err := r.IsApproved(reject, prctx)
+		require.NoError(t, err)
+		assert.False(t, allowed, "rejection did not withdraw the review approval")
+
+		r.Options.Methods = &common.Methods{GithubReview: true}
+		res = r.Evaluate(approve, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, []string{"review-approver"}, res.Approvers, "decision was used by a rule without the slack method")
+	})
+
+	t.Run("ownersFiles", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "README.md", Status: pull.FileModified},
+			{Filename: "server/api/handler.go", Status: pull.FileModified},
+			{Filename: "server/schema.sql", Status: pull.FileAdded},
+		}
+		prctx.BaseFilesValue = map[string][]byte{
+			"OWNERS":            []byte("users: [root-owner]\n"),
+			"server/OWNERS":     []byte("organizations: [cool-org]\nfiles:\n  - pattern: \"*.sql\"\n    users: [dba]\n"),
+			"server/api/OWNERS": []byte("inherit: false\norganizations: [even-cooler-org]\n"),
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				OwnersFiles: &OwnersRequirement{},
+			},
+		}
+		assertPending(t, prctx, r, "Waiting for approval from the owners of README.md, server/schema.sql")
+
+		eligible, err := r.EligibleApprovers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dba", "root-owner"}, eligible)
+
+		prctx.CommentsValue = append(prctx.CommentsValue,
+			&pull.Comment{
+				CreatedAt: now.Add(100 * time.Second),
+				Author:    "root-owner",
+				Body:      ":+1:",
+			},
+			&pull.Comment{
+				CreatedAt: now.Add(110 * time.Second),
+				Author:    "dba",
+				Body:      ":+1:",
+			},
+		)
+		assertApproved(t, prctx, r, "Approved by owners root-owner, review-approver, dba")
+
+		r.Requires.Count = 1
+		r.Requires.Users = []string{"comment-approver"}
+		assertApproved(t, prctx, r, "Approved by comment-approver, root-owner, review-approver, dba")
+	})
+
+	t.Run("jiraIssueInOtherProject", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.TitleValue = "Fix typo (see SEC-99)"
+
+		jiraCtx := jira.WithProvider(ctx, staticJira{"SEC-99": "Closed"})
+
+		r := &Rule{
+			Requires: Requires{
+				Jira: &JiraRequirement{
+					Statuses: []string{"Closed"},
+					Projects: []string{"CHG"},
+				},
+			},
+		}
+
+		approved, msg, err := r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "issue in another project approved the rule")
+		assert.Equal(t, "No linked Jira issue", msg)
+	})
+
+	t.Run("jiraIssueWithOwnersFiles", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.TitleValue = "CHG-123: Add schema"
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "server/schema.sql", Status: pull.FileAdded},
+		}
+		prctx.BaseFilesValue = map[string][]byte{
+			"server/OWNERS": []byte("users: [dba]\n"),
+		}
+
+		statuses := staticJira{"CHG-123": "Change Approved"}
+		jiraCtx := jira.WithProvider(ctx, statuses)
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"nobody"},
+				},
+				Jira: &JiraRequirement{
+					Statuses: []string{"Change Approved"},
+					Projects: []string{"CHG"},
+				},
+				OwnersFiles: &OwnersRequirement{},
+			},
+		}
+
+		approved, msg, err := r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.False(t, approved, "jira issue approved the rule without owner approval")
+		assert.Equal(t, "Waiting for approval from the owners of server/schema.sql", msg)
+
+		prctx.CommentsValue = append(prctx.CommentsValue, &pull.Comment{
+			CreatedAt: now.Add(100 * time.Second),
+			Author:    "dba",
+			Body:      ":+1:",
+		})
+
+		approved, msg, err = r.IsApproved(jiraCtx, prctx)
+		require.NoError(t, err)
+		assert.True(t, approved, "pull request was not approved")
+		assert.Equal(t, "Approved by Jira issue CHG-123 (Change Approved); Approved by owners dba", msg)
+	})
+
+	t.Run("environments", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "deploy/prod/app.yml", Status: pull.FileModified},
+			{Filename: "deploy/staging/app.yml", Status: pull.FileModified},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Environments: EnvironmentRequirement{
+					"production": {
+						Paths:  []string{"^deploy/prod/"},
+						Actors: common.Actors{Organizations: []string{"cool-org"}},
+					},
+					"staging": {
+						Paths:  []string{"^deploy/staging/"},
+						Actors: common.Actors{Users: []string{"stager"}},
+					},
+					"dev": {
+						Paths:  []string{"^deploy/dev/"},
+						Actors: common.Actors{Users: []string{"developer"}},
+					},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "Waiting for approval for environments staging")
+
+		res := r.Evaluate(ctx, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, []*common.EnvironmentStatus{
+			{Name: "production", Files: []string{"deploy/prod/app.yml"}, Approvers: []string{"comment-approver"}},
+			{Name: "staging", Files: []string{"deploy/staging/app.yml"}},
+		}, res.Environments)
+
+		eligible, err := r.EligibleApprovers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stager"}, eligible)
+
+		prctx.CommentsValue = append(prctx.CommentsValue, &pull.Comment{
+			CreatedAt: now.Add(100 * time.Second),
+			Author:    "stager",
+			Body:      ":+1:",
+		})
+		assertApproved(t, prctx, r, "Approved for environments production, staging")
+
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "src/main.go", Status: pull.FileModified},
+		}
+		assertApproved(t, prctx, r, "No changed files deploy to an environment")
+	})
+
+	t.Run("countPerMatch", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "docs/README.md", Status: pull.FileModified},
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				CountPerMatch: map[string]int{
+					"^infra/.*": 3,
+					"^docs/.*":  2,
+				},
+				Actors: common.Actors{
+					Organizations: []string{"everyone"},
+				},
+			},
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		prctx.ChangedFilesValue = append(prctx.ChangedFilesValue, &pull.File{
+			Filename: "infra/main.tf", Status: pull.FileModified,
+		})
+		assertPending(t, prctx, r, "2/3 approvals required")
+
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "src/main.go", Status: pull.FileModified},
+		}
+		r.Requires.Count = 0
+		assertApproved(t, prctx, r, "No approval required")
+	})
+}
+
+func TestEligibleApprovers(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	prctx := &pulltest.Context{
+		AuthorValue: "mhaypenny",
+		CommentsValue: []*pull.Comment{
+			{
+				CreatedAt: now.Add(20 * time.Second),
+				Author:    "comment-approver",
+				Body:      ":+1:",
+			},
+		},
+		CommitsValue: []*pull.Commit{
+			{
+				CreatedAt: now.Add(5 * time.Second),
+				SHA:       "c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				Author:    "mhaypenny",
+				Committer: "contributor-committer",
+			},
+		},
+		TeamMemberships: map[string][]string{
+			"mhaypenny":             {"cool-org/team"},
+			"contributor-committer": {"cool-org/team"},
+			"comment-approver":      {"cool-org/team"},
+			"team-member":           {"cool-org/team"},
+		},
+	}
+
+	t.Run("noApprovalRequired", func(t *testing.T) {
+		r := &Rule{}
+
+		approvers, err := r.EligibleApprovers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Empty(t, approvers)
+	})
+
+	t.Run("excludesDisqualifiedAndApproved", func(t *testing.T) {
+		r := &Rule{
+			Requires: Requires{
+				Count: 2,
+				Actors: common.Actors{
+					Users: []string{"specific-user"},
+					Teams: []string{"cool-org/team"},
+				},
+			},
+		}
+
+		approvers, err := r.EligibleApprovers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"specific-user", "team-member"}, approvers)
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		r := &Rule{
+			Requires: Requires{
+				Count: 2,
+				Actors: common.Actors{
+					Users: []string{"specific-user"},
+					Teams: []string{"cool-org/team"},
+				},
+				Attributes: AttributeRequirement{
+					"region": {"us"},
+				},
+			},
+		}
+
+		users := identity.NewClient(identity.Config{
+			Users: map[string]map[string][]string{
+				"team-member": {"region": {"us"}},
+			},
+		}, nil)
+
+		approvers, err := r.EligibleApprovers(identity.WithProvider(ctx, users), prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team-member"}, approvers)
+	})
+
+	t.Run("allowContributor", func(t *testing.T) {
+		r := &Rule{
+			Options: Options{
+				AllowContributor: true,
+			},
+			Requires: Requires{
+				Count: 2,
+				Actors: common.Actors{
+					Teams: []string{"cool-org/team"},
+				},
+			},
+		}
+
+		approvers, err := r.EligibleApprovers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"contributor-committer", "mhaypenny", "team-member"}, approvers)
+	})
+}
+
+func TestRuleTimeout(t *testing.T) {
+	r := &Rule{
+		Name: "slow",
+		Requires: Requires{
+			Count: 1,
+		},
+	}
+	prctx := slowCommentsContext{pulltest.New().Build()}
+
+	ctx := WithRuleTimeout(context.Background(), 10*time.Millisecond)
+	res := r.Evaluate(ctx, prctx)
+
+	require.Error(t, res.Error)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(res.Error))
+	assert.NoError(t, ctx.Err(), "the rule timeout should not cancel the parent context")
+}
+
+// slowCommentsContext is a context that lists comments until the request is
+// canceled.
+type slowCommentsContext struct {
+	*pulltest.Context
+}
+
+func (c slowCommentsContext) Comments(ctx context.Context) ([]*pull.Comment, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type staticJira map[string]string
+
+func (j staticJira) IssueStatus(ctx context.Context, key string) (string, error) {
+	return j[key], nil
+}
+
+func TestDiffDistance(t *testing.T) {
+	patch := func(lines ...string) string {
+		return "@@ -1,1 +1,1 @@\n" + strings.Join(lines, "\n")
+	}
+
+	approved := []*pull.File{
+		{Filename: "a.go", Status: pull.FileModified, Patch: patch("-one", "+two", "+three")},
+		{Filename: "image.png", Status: pull.FileAdded, Additions: 0, Deletions: 0},
+	}
+
+	assert.Equal(t, 0.0, diffDistance(nil, nil))
+	assert.Equal(t, 0.0, diffDistance(approved, approved))
+	assert.Equal(t, 1.0, diffDistance(approved, nil))
+
+	moved := []*pull.File{
+		{Filename: "a.go", Status: pull.FileModified, Patch: patch(" context", "+three", "+two", "-one")},
+		{Filename: "image.png", Status: pull.FileAdded},
+	}
+	assert.Equal(t, 0.0, diffDistance(approved, moved))
+
+	changed := []*pull.File{
+		{Filename: "a.go", Status: pull.FileModified, Patch: patch("-one", "+two", "+four")},
+		{Filename: "image.png", Status: pull.FileAdded},
+	}
+	assert.InDelta(t, 2.0/5.0, diffDistance(approved, changed), 0.0001)
+
+	renamed := []*pull.File{
+		{Filename: "b.go", Status: pull.FileModified, Patch: patch("-one", "+two", "+three")},
+		{Filename: "image.png", Status: pull.FileAdded},
+	}
+	assert.InDelta(t, 6.0/7.0, diffDistance(approved, renamed), 0.0001)
 }
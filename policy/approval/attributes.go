@@ -0,0 +1,120 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/identity"
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// AttributeRequirement maps attribute names to allowed values. A user
+// satisfies the requirement if, for every attribute, the user has at least
+// one of the allowed values. Values are compared without case.
+type AttributeRequirement map[string][]string
+
+// allows returns true if the user has the required attributes.
+func (req AttributeRequirement) allows(ctx context.Context, p identity.Provider, user string) (bool, error) {
+	attrs, err := p.Attributes(ctx, user)
+	if err != nil {
+		return false, errors.WithMessage(err, "failed to get user attributes")
+	}
+
+	for name, allowed := range req {
+		if !anyValueMatches(attrs[name], allowed) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func anyValueMatches(values, allowed []string) bool {
+	for _, v := range values {
+		for _, a := range allowed {
+			if strings.EqualFold(v, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeByAttributes removes candidates without the attributes the rule
+// requires.
+func (r *Rule) removeByAttributes(ctx context.Context, candidates []*common.Candidate) ([]*common.Candidate, error) {
+	allowed, err := r.attributeFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []*common.Candidate
+	for _, c := range candidates {
+		ok, err := allowed(c.User)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// usersWithAttributes returns the users with the attributes the rule
+// requires.
+func (r *Rule) usersWithAttributes(ctx context.Context, users []string) ([]string, error) {
+	allowed, err := r.attributeFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []string
+	for _, u := range users {
+		ok, err := allowed(u)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, u)
+		}
+	}
+	return kept, nil
+}
+
+// attributeFilter returns a function that reports if a user has the
+// attributes the rule requires, checking each user once.
+func (r *Rule) attributeFilter(ctx context.Context) (func(user string) (bool, error), error) {
+	p, err := identity.ProviderFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checked := make(map[string]bool)
+	return func(user string) (bool, error) {
+		if ok, seen := checked[user]; seen {
+			return ok, nil
+		}
+		ok, err := r.Requires.Attributes.allows(ctx, p, user)
+		if err != nil {
+			return false, err
+		}
+		checked[user] = ok
+		return ok, nil
+	}, nil
+}
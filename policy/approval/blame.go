@@ -0,0 +1,85 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// recentLineAuthors returns the users who authored lines that the pull
+// request modifies or deletes within the rule's IgnoreRecentLineAuthors
+// duration before the pull request was opened.
+func (r *Rule) recentLineAuthors(ctx context.Context, prctx pull.Context) (map[string]bool, error) {
+	createdAt, err := prctx.CreatedAt(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get pull request creation time")
+	}
+	since := createdAt.Add(-r.Options.IgnoreRecentLineAuthors)
+
+	files, err := prctx.ChangedFiles(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	authors := make(map[string]bool)
+	for _, f := range files {
+		lines := f.RemovedLines()
+		if len(lines) == 0 {
+			continue
+		}
+
+		path := f.Filename
+		if f.PreviousFilename != "" {
+			path = f.PreviousFilename
+		}
+
+		blame, err := prctx.Blame(ctx, path, lines)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get blame of %s", path)
+		}
+		for _, line := range blame {
+			if line.Author != "" && !line.AuthoredAt.Before(since) {
+				authors[line.Author] = true
+			}
+		}
+	}
+	return authors, nil
+}
+
+// removeRecentLineAuthors removes candidates who recently authored the lines
+// that the pull request modifies or deletes.
+func (r *Rule) removeRecentLineAuthors(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) ([]*common.Candidate, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	authors, err := r.recentLineAuthors(ctx, prctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find recent authors of changed lines")
+	}
+
+	var allowed []*common.Candidate
+	for _, c := range candidates {
+		if !authors[c.User] {
+			allowed = append(allowed, c)
+		}
+	}
+	return allowed, nil
+}
@@ -0,0 +1,425 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// ResultCache stores the results of rules for repeated evaluations of the
+// same pull request. Results are keyed by the rule and the pull request data
+// it depends on, so a rule is only evaluated again if its inputs changed or
+// its result expired. Results also record the membership lookups made while
+// evaluating the rule and are only reused if the lookups return the same
+// answers.
+type ResultCache struct {
+	ttl  time.Duration
+	size int
+
+	lock       sync.Mutex
+	entries    map[string]resultCacheEntry
+	generation int
+}
+
+type resultCacheEntry struct {
+	res         common.Result
+	memberships []membershipQuery
+	expires     time.Time
+}
+
+// NewResultCache returns a cache that keeps results for the given duration.
+// If size is positive, it keeps at most size results, discarding the ones
+// that expire first.
+func NewResultCache(ttl time.Duration, size int) *ResultCache {
+	return &ResultCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]resultCacheEntry),
+	}
+}
+
+func (c *ResultCache) get(key string) (resultCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return resultCacheEntry{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return resultCacheEntry{}, false
+	}
+	return e, true
+}
+
+// currentGeneration returns a value that changes every time the cache is
+// flushed. Results computed before a flush are not stored after it.
+func (c *ResultCache) currentGeneration() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.generation
+}
+
+func (c *ResultCache) put(key string, generation int, res common.Result, memberships []membershipQuery) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if c.size > 0 && len(c.entries) >= c.size {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = resultCacheEntry{res: res, memberships: memberships, expires: now.Add(c.ttl)}
+}
+
+// Len returns the number of cached results, including expired results that
+// were not removed yet.
+func (c *ResultCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.entries)
+}
+
+// Flush discards all cached results, including the results of evaluations
+// that are still in progress.
+func (c *ResultCache) Flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]resultCacheEntry)
+	c.generation++
+}
+
+type resultCacheKey struct{}
+
+type resultCacheValue struct {
+	cache   *ResultCache
+	version string
+}
+
+// WithResultCache returns a context in which rules reuse results from the
+// cache if the pull request data they depend on did not change. The version
+// identifies the policy, so that results are not reused after it changes.
+func WithResultCache(ctx context.Context, cache *ResultCache, version string) context.Context {
+	return context.WithValue(ctx, resultCacheKey{}, &resultCacheValue{cache: cache, version: version})
+}
+
+// resultCacheInputs returns a digest of the pull request data that rules
+// depend on: the head commit, the base branch, the title and body, the
+// reviews and comments, and the requested reviewers. Rules are evaluated
+// again when any of them change.
+// The data is cached by the pull request context, so computing the digest
+// for each rule does not make additional requests.
+func resultCacheInputs(ctx context.Context, prctx pull.Context) (string, error) {
+	title, err := prctx.Title(ctx)
+	if err != nil {
+		return "", err
+	}
+	body, err := prctx.Body(ctx)
+	if err != nil {
+		return "", err
+	}
+	base, _, err := prctx.Branches(ctx)
+	if err != nil {
+		return "", err
+	}
+	reviews, err := prctx.Reviews(ctx)
+	if err != nil {
+		return "", err
+	}
+	comments, err := prctx.Comments(ctx)
+	if err != nil {
+		return "", err
+	}
+	requested, err := prctx.RequestedReviewers(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00", prctx.Locator(), prctx.HeadSHA(), base, title, body)
+	fmt.Fprintf(h, "reviews:%d\x00", len(reviews))
+	for _, r := range reviews {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00", r.ID, r.Author, r.State, r.SHA, r.Body)
+	}
+	fmt.Fprintf(h, "comments:%d\x00", len(comments))
+	for _, c := range comments {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", c.ID, c.Author, c.Body)
+	}
+	fmt.Fprintf(h, "requested:%d\x00", len(requested.Users))
+	for _, u := range requested.Users {
+		fmt.Fprintf(h, "%s\x00", u)
+	}
+	fmt.Fprintf(h, "requestedTeams:%d\x00", len(requested.Teams))
+	for _, t := range requested.Teams {
+		fmt.Fprintf(h, "%s\x00", t)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// evaluateCached evaluates the rule, reusing a cached result if the context
+// has a result cache and the rule only depends on the cache inputs.
+func (r *Rule) evaluateCached(ctx context.Context, prctx pull.Context) common.Result {
+	v, _ := ctx.Value(resultCacheKey{}).(*resultCacheValue)
+	if v == nil || !r.cacheable(ctx) {
+		return r.Evaluate(ctx, prctx)
+	}
+
+	inputs, err := resultCacheInputs(ctx, prctx)
+	if err != nil {
+		return r.Evaluate(ctx, prctx)
+	}
+	key, err := r.resultCacheKey(ctx, v.version+"\x00"+inputs)
+	if err != nil {
+		return r.Evaluate(ctx, prctx)
+	}
+	if e, ok := v.cache.get(key); ok && membershipsUnchanged(ctx, prctx, e.memberships) {
+		return e.res
+	}
+
+	generation := v.cache.currentGeneration()
+	recorder := &membershipRecorder{Context: prctx}
+
+	res := r.Evaluate(ctx, recorder)
+	if queries, ok := recorder.recorded(); ok && res.Error == nil {
+		v.cache.put(key, generation, res, queries)
+	}
+	return res
+}
+
+// cacheable returns true if the result of the rule only depends on the
+// pull request data in the cache inputs and on membership. Rules that depend
+// on the time, external services, other pull requests, the repository,
+// review threads, the review request timeline, or blame are always
+// evaluated.
+func (r *Rule) cacheable(ctx context.Context) bool {
+	p := r.Predicates
+	if p.LastPushAge != nil || p.AuthorRecentMergedPRs != nil || p.ReviewRequested != nil ||
+		p.ExternalCheck != nil || p.HasOpenIncident != nil {
+		return false
+	}
+	if p.HasRepositoryTopic != nil || p.HasRepositoryProperty != nil || p.TargetRepository != nil ||
+		p.RepositoryContains != nil {
+		return false
+	}
+
+	// author predicates can use any of the above, so they are not inspected
+	o := r.Options
+	if o.MinimumOpenDuration > 0 || o.RequireApprovedParent || o.IgnoreStackRetargets || o.RequireResolvedThreads ||
+		o.IgnoreRecentLineAuthors > 0 || o.WaitForRereview || o.AllowAuthorIf != nil {
+		return false
+	}
+
+	if r.Requires.Jira != nil || len(r.Requires.OnCall) > 0 || len(r.Requires.Attributes) > 0 {
+		return false
+	}
+	for _, env := range r.Requires.Environments {
+		if env != nil && len(env.OnCall) > 0 {
+			return false
+		}
+	}
+
+	if m := r.Options.GetMethods(ctx); m.FileComments || len(m.GithubReviewCommentPatterns) > 0 {
+		return false
+	}
+	return true
+}
+
+// resultCacheKey returns the cache key of the rule for the inputs. The key
+// includes the definition of the rule and the decisions recorded for it,
+// which are not part of the pull request data.
+func (r *Rule) resultCacheKey(ctx context.Context, inputs string) (string, error) {
+	def, err := yaml.Marshal(r)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode rule")
+	}
+
+	carried, _ := ctx.Value(carriedApprovalsKey{}).(map[string][]*common.Candidate)
+	dispatch, _ := ctx.Value(dispatchDecisionsKey{}).(map[string]*DispatchDecision)
+	slack, _ := ctx.Value(slackDecisionsKey{}).(map[string][]*SlackDecision)
+
+	decisions, err := json.Marshal([]interface{}{carried[r.Name], dispatch[r.Name], slack[r.Name]})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode decisions")
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", inputs, r.Name, def, decisions)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// membershipQuery is a membership lookup made while evaluating a rule and
+// its encoded answer.
+type membershipQuery struct {
+	method string
+	args   []string
+	answer string
+}
+
+// membershipRecorder is a pull request context that records the membership
+// lookups made through it, so a cached result can be checked against the
+// current membership before it is reused.
+type membershipRecorder struct {
+	pull.Context
+
+	lock    sync.Mutex
+	queries []membershipQuery
+	seen    map[string]bool
+	failed  bool
+}
+
+// recorded returns the recorded lookups and true if all of them succeeded.
+func (m *membershipRecorder) recorded() ([]membershipQuery, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.queries, !m.failed
+}
+
+func (m *membershipRecorder) record(answer interface{}, err error, method string, args ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err != nil {
+		m.failed = true
+		return
+	}
+
+	id := method + "\x00" + strings.Join(args, "\x00")
+	if m.seen[id] {
+		return
+	}
+
+	encoded, err := json.Marshal(answer)
+	if err != nil {
+		m.failed = true
+		return
+	}
+	if m.seen == nil {
+		m.seen = make(map[string]bool)
+	}
+	m.seen[id] = true
+	m.queries = append(m.queries, membershipQuery{method: method, args: args, answer: string(encoded)})
+}
+
+func (m *membershipRecorder) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	answer, err := m.Context.IsTeamMember(ctx, team, user)
+	m.record(answer, err, "IsTeamMember", team, user)
+	return answer, err
+}
+
+func (m *membershipRecorder) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	answer, err := m.Context.IsOrgMember(ctx, org, user)
+	m.record(answer, err, "IsOrgMember", org, user)
+	return answer, err
+}
+
+func (m *membershipRecorder) OrganizationMembership(ctx context.Context, org, user string) (*pull.OrgMembership, error) {
+	answer, err := m.Context.OrganizationMembership(ctx, org, user)
+	m.record(answer, err, "OrganizationMembership", org, user)
+	return answer, err
+}
+
+func (m *membershipRecorder) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	answer, err := m.Context.IsCollaborator(ctx, org, repo, user, desiredPerm)
+	m.record(answer, err, "IsCollaborator", org, repo, user, desiredPerm)
+	return answer, err
+}
+
+func (m *membershipRecorder) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	answer, err := m.Context.TeamMembers(ctx, team)
+	m.record(answer, err, "TeamMembers", team)
+	return answer, err
+}
+
+func (m *membershipRecorder) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	answer, err := m.Context.OrganizationMembers(ctx, org)
+	m.record(answer, err, "OrganizationMembers", org)
+	return answer, err
+}
+
+func (m *membershipRecorder) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	answer, err := m.Context.RepositoryCollaborators(ctx, org, repo, desiredPerm)
+	m.record(answer, err, "RepositoryCollaborators", org, repo, desiredPerm)
+	return answer, err
+}
+
+// membershipsUnchanged returns true if the membership lookups recorded with a
+// cached result return the same answers now.
+func membershipsUnchanged(ctx context.Context, prctx pull.Context, queries []membershipQuery) bool {
+	for _, q := range queries {
+		var answer interface{}
+		var err error
+
+		a := q.args
+		switch q.method {
+		case "IsTeamMember":
+			answer, err = prctx.IsTeamMember(ctx, a[0], a[1])
+		case "IsOrgMember":
+			answer, err = prctx.IsOrgMember(ctx, a[0], a[1])
+		case "OrganizationMembership":
+			answer, err = prctx.OrganizationMembership(ctx, a[0], a[1])
+		case "IsCollaborator":
+			answer, err = prctx.IsCollaborator(ctx, a[0], a[1], a[2], a[3])
+		case "TeamMembers":
+			answer, err = prctx.TeamMembers(ctx, a[0])
+		case "OrganizationMembers":
+			answer, err = prctx.OrganizationMembers(ctx, a[0])
+		case "RepositoryCollaborators":
+			answer, err = prctx.RepositoryCollaborators(ctx, a[0], a[1], a[2])
+		default:
+			return false
+		}
+		if err != nil {
+			return false
+		}
+
+		encoded, err := json.Marshal(answer)
+		if err != nil || string(encoded) != q.answer {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+type carriedApprovalsKey struct{}
+
+// WithCarriedApprovals returns a context in which rules also count approvals
+// given on other pull requests with the same head commit, like pull requests
+// that were closed and recreated from the same branch. Approvals are keyed
+// by rule name.
+func WithCarriedApprovals(ctx context.Context, approvals map[string][]*common.Candidate) context.Context {
+	return context.WithValue(ctx, carriedApprovalsKey{}, approvals)
+}
+
+// addCarriedApprovals adds the approvals carried over for the rule to the
+// candidates. Only approvals of the head commit are added and users who are
+// already candidates keep their own candidate.
+func (r *Rule) addCarriedApprovals(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) []*common.Candidate {
+	approvals, _ := ctx.Value(carriedApprovalsKey{}).(map[string][]*common.Candidate)
+	if len(approvals[r.Name]) == 0 {
+		return candidates
+	}
+
+	users := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		users[c.User] = true
+	}
+
+	head := prctx.HeadSHA()
+	for _, c := range approvals[r.Name] {
+		if c.SHA != head || users[c.User] {
+			continue
+		}
+		users[c.User] = true
+
+		carried := *c
+		candidates = append(candidates, &carried)
+	}
+	return candidates
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// departureReason returns why a user is no longer allowed to approve pull
+// requests in the repository, or an empty string if the user is active. Users
+// depart if their account is suspended or if they are neither members nor
+// outside collaborators of the organization that owns the repository.
+func departureReason(ctx context.Context, prctx pull.Context, user string) (string, error) {
+	org := prctx.RepositoryOwner()
+
+	m, err := prctx.OrganizationMembership(ctx, org, user)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get membership of %s", user)
+	}
+
+	switch {
+	case m.Suspended:
+		return "the account is suspended", nil
+	case !m.Member && !m.OutsideCollaborator:
+		return fmt.Sprintf("the user is no longer a member of %s", org), nil
+	}
+	return "", nil
+}
+
+// removeDeparted removes candidates who departed from the candidates.
+func removeDeparted(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) ([]*common.Candidate, error) {
+	departed := make(map[string]bool)
+
+	var active []*common.Candidate
+	for _, c := range candidates {
+		isDeparted, checked := departed[c.User]
+		if !checked {
+			reason, err := departureReason(ctx, prctx, c.User)
+			if err != nil {
+				return nil, err
+			}
+			isDeparted = reason != ""
+			departed[c.User] = isDeparted
+		}
+		if !isDeparted {
+			active = append(active, c)
+		}
+	}
+	return active, nil
+}
+
+// departedApprovals describes the approvals ignored because their authors
+// departed. Only users who could otherwise approve the rule are included.
+func (r *Rule) departedApprovals(ctx context.Context, prctx pull.Context) ([]string, error) {
+	candidates, err := r.methods(ctx).Candidates(ctx, prctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get approval candidates")
+	}
+	sort.Stable(common.CandidatesByCreationTime(candidates))
+
+	var notes []string
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if seen[c.User] {
+			continue
+		}
+		seen[c.User] = true
+
+		reason, err := departureReason(ctx, prctx, c.User)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			continue
+		}
+
+		isApprover, err := r.Requires.IsActor(ctx, prctx, c.User)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to check candidate status")
+		}
+		if isApprover {
+			notes = append(notes, fmt.Sprintf("Ignored approval by %s because %s", c.User, reason))
+		}
+	}
+	return notes, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// DispatchDecision is an approval or veto of a rule sent by an automated
+// workflow, like a risk scoring job, with a signed dispatch event.
+type DispatchDecision struct {
+	// Actor is the user or app that sent the dispatch event.
+	Actor string
+
+	// Veto is true if the workflow blocks the rule instead of approving it.
+	Veto bool
+
+	// SHA is the head commit of the pull request the decision applies to.
+	SHA       string
+	CreatedAt time.Time
+}
+
+type dispatchDecisionsKey struct{}
+
+// WithDispatchDecisions returns a context in which rules that allow the
+// github_actions_dispatch method use the given decisions, keyed by rule name.
+func WithDispatchDecisions(ctx context.Context, decisions map[string]*DispatchDecision) context.Context {
+	return context.WithValue(ctx, dispatchDecisionsKey{}, decisions)
+}
+
+// dispatchDecision returns the dispatch decision for the rule if the rule
+// allows the github_actions_dispatch method and the decision applies to the
+// head commit of the pull request.
+func (r *Rule) dispatchDecision(ctx context.Context, prctx pull.Context) *DispatchDecision {
+	if !r.Options.GetMethods(ctx).GithubActionsDispatch {
+		return nil
+	}
+
+	decisions, _ := ctx.Value(dispatchDecisionsKey{}).(map[string]*DispatchDecision)
+	d := decisions[r.Name]
+	if d == nil || d.SHA != prctx.HeadSHA() {
+		return nil
+	}
+	return d
+}
+
+// addDispatchApproval adds the actor of an approving dispatch decision to the
+// candidates, replacing any other candidate for the same user.
+func (r *Rule) addDispatchApproval(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) []*common.Candidate {
+	d := r.dispatchDecision(ctx, prctx)
+	if d == nil || d.Veto {
+		return candidates
+	}
+
+	filtered := candidates[:0]
+	for _, c := range candidates {
+		if c.User != d.Actor {
+			filtered = append(filtered, c)
+		}
+	}
+	return append(filtered, &common.Candidate{
+		User:      d.Actor,
+		CreatedAt: d.CreatedAt,
+		SHA:       d.SHA,
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// diffDistance returns the fraction of the changed lines in either diff that
+// are not in the other diff, from 0 for identical diffs to 1 for diffs with
+// nothing in common. Lines are compared by file, direction, and content, so
+// moving a hunk within a file or rebasing onto a new base does not count as a
+// change. Files without a patch, like binary files, count as changed unless
+// both diffs change them in the same way.
+func diffDistance(a, b []*pull.File) float64 {
+	linesA, linesB := diffLines(a), diffLines(b)
+
+	total, changed := 0, 0
+	for k, n := range linesA {
+		m := linesB[k]
+		total += maxInt(n, m)
+		changed += absInt(n - m)
+	}
+	for k, m := range linesB {
+		if _, ok := linesA[k]; !ok {
+			total += m
+			changed += m
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(changed) / float64(total)
+}
+
+// diffLines counts the added and removed lines of the files, keyed by file
+// name and line.
+func diffLines(files []*pull.File) map[string]int {
+	lines := make(map[string]int)
+	for _, f := range files {
+		if f.Patch == "" {
+			key := fmt.Sprintf("%s\x00%d:%d:%d", f.Filename, f.Status, f.Additions, f.Deletions)
+			lines[key] += maxInt(1, f.Additions+f.Deletions)
+			continue
+		}
+
+		for _, line := range strings.Split(f.Patch, "\n") {
+			if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+				lines[f.Filename+"\x00"+line]++
+			}
+		}
+	}
+	return lines
+}
+
+// withinDiffThreshold returns true if the diff of the pull request as of the
+// commit differs from the current diff by no more than the rule's
+// invalidate_on_push_threshold. Distances are cached by commit.
+func (r *Rule) withinDiffThreshold(ctx context.Context, prctx pull.Context, sha string, distances map[string]float64) (bool, error) {
+	distance, ok := distances[sha]
+	if !ok {
+		approved, err := prctx.CommitChangedFiles(ctx, sha)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get files changed as of %s", sha)
+		}
+
+		current, err := prctx.ChangedFiles(ctx)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to get changed files")
+		}
+
+		distance = diffDistance(approved, current)
+		distances[sha] = distance
+	}
+	return distance <= r.Options.InvalidateOnPushThreshold, nil
+}
+
+// samePatch returns true if the changes of the pull request as of the two
+// commits have the same patch ID. Patch IDs are cached by commit, with an
+// empty ID for changes that cannot be compared.
+func samePatch(ctx context.Context, prctx pull.Context, sha, head string, patchIDs map[string]string) (bool, error) {
+	patchID := func(sha string) (string, error) {
+		if id, ok := patchIDs[sha]; ok {
+			return id, nil
+		}
+		id, _, err := pull.CommitPatchID(ctx, prctx, sha)
+		if err != nil {
+			return "", err
+		}
+		patchIDs[sha] = id
+		return id, nil
+	}
+
+	approved, err := patchID(sha)
+	if err != nil || approved == "" {
+		return false, err
+	}
+	current, err := patchID(head)
+	if err != nil {
+		return false, err
+	}
+	return approved == current, nil
+}
+
+// checkDiffThresholds returns an error if a rule has a threshold that is not
+// a fraction.
+func checkDiffThresholds(rules map[string]*Rule) error {
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if t := rules[name].Options.InvalidateOnPushThreshold; t < 0 || t > 1 {
+			return errors.Errorf("rule '%s' has invalid invalidate_on_push_threshold %v, must be between 0 and 1", name, t)
+		}
+	}
+	return nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Environment is a deployment environment, like "production", and the files
+// that deploy to it. Changes to the files require approval from one of the
+// actors of the environment.
+type Environment struct {
+	// Paths are regular expressions that match the files that deploy to the
+	// environment.
+	Paths []string `yaml:"paths"`
+
+	common.Actors `yaml:",inline"`
+}
+
+// EnvironmentRequirement maps environment names to environments. Every
+// environment affected by a pull request must be approved by one of its
+// actors.
+type EnvironmentRequirement map[string]*Environment
+
+// affected returns the environments with paths that match a changed file,
+// ordered by name. The returned statuses do not have approvers.
+func (req EnvironmentRequirement) affected(ctx context.Context, prctx pull.Context) ([]*common.EnvironmentStatus, error) {
+	var names []string
+	for name, env := range req {
+		if env != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	paths := make(map[string][]*regexp.Regexp, len(req))
+	for _, name := range names {
+		for _, p := range req[name].Paths {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse path %q of environment %q", p, name)
+			}
+			paths[name] = append(paths[name], re)
+		}
+	}
+
+	files := make(map[string][]string)
+	err := prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		for _, name := range names {
+			if matchesAny(paths[name], f.Paths()) {
+				files[name] = append(files[name], f.Filename)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	var affected []*common.EnvironmentStatus
+	for _, name := range names {
+		if len(files[name]) > 0 {
+			affected = append(affected, &common.EnvironmentStatus{Name: name, Files: files[name]})
+		}
+	}
+	return affected, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, paths []string) bool {
+	for _, re := range patterns {
+		for _, p := range paths {
+			if re.MatchString(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// approval returns the candidates who approved any affected environment and
+// the status of each affected environment. The candidates must already be
+// filtered by the rule options.
+func (req EnvironmentRequirement) approval(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) ([]*common.Candidate, []*common.EnvironmentStatus, error) {
+	affected, err := req.affected(ctx, prctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var approvers []*common.Candidate
+	isApprover := make(map[string]bool)
+
+	for _, env := range affected {
+		for _, c := range candidates {
+			ok, err := req[env.Name].IsActor(ctx, prctx, c.User)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to check approvers of environment %q", env.Name)
+			}
+			if !ok {
+				continue
+			}
+
+			env.Approvers = append(env.Approvers, c.User)
+			if !isApprover[c.User] {
+				isApprover[c.User] = true
+				approvers = append(approvers, c)
+			}
+		}
+	}
+	return approvers, affected, nil
+}
+
+// pendingEnvironments returns the environments without approval.
+func pendingEnvironments(envs []*common.EnvironmentStatus) []*common.EnvironmentStatus {
+	var pending []*common.EnvironmentStatus
+	for _, env := range envs {
+		if len(env.Approvers) == 0 {
+			pending = append(pending, env)
+		}
+	}
+	return pending
+}
+
+func formatEnvironments(envs []*common.EnvironmentStatus) string {
+	names := make([]string, len(envs))
+	for i, env := range envs {
+		names[i] = env.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// listApprovers adds the users who may approve any of the environments to
+// users, returning the sorted result.
+func (req EnvironmentRequirement) listApprovers(ctx context.Context, prctx pull.Context, envs []*common.EnvironmentStatus, users []string) ([]string, error) {
+	present := make(map[string]bool, len(users))
+	for _, u := range users {
+		present[u] = true
+	}
+
+	for _, env := range envs {
+		approvers, err := req[env.Name].ListUsers(ctx, prctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list approvers of environment %q", env.Name)
+		}
+		for _, u := range approvers {
+			if !present[u] {
+				present[u] = true
+				users = append(users, u)
+			}
+		}
+	}
+
+	sort.Strings(users)
+	return users, nil
+}
+
+// environmentsMessage describes the approval status of the environments.
+func environmentsMessage(envs []*common.EnvironmentStatus) string {
+	if len(envs) == 0 {
+		return "No changed files deploy to an environment"
+	}
+	if pending := pendingEnvironments(envs); len(pending) > 0 {
+		return fmt.Sprintf("Waiting for approval for environments %s", formatEnvironments(pending))
+	}
+	return fmt.Sprintf("Approved for environments %s", formatEnvironments(envs))
+}
@@ -17,7 +17,9 @@ package approval
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/palantir/policy-bot/policy/common"
@@ -43,14 +45,18 @@ func (eval *evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res co
 }
 
 type RuleRequirement struct {
-	rule *Rule
+	rule     *Rule
+	requires []*RuleRequirement
 }
 
 func (r *RuleRequirement) Evaluate(ctx context.Context, prctx pull.Context) common.Result {
 	log := zerolog.Ctx(ctx).With().Str("rule", r.rule.Name).Logger()
 	ctx = log.WithContext(ctx)
 
-	result := r.rule.Evaluate(ctx, prctx)
+	result := r.rule.evaluateCached(ctx, prctx)
+	if result.Error == nil && result.Status != common.StatusSkipped && len(r.requires) > 0 {
+		r.evaluateRequired(ctx, prctx, &result)
+	}
 	if result.Error == nil {
 		log.Debug().Msgf("rule evaluation resulted in %s:\"%s\"", result.Status, result.Description)
 	}
@@ -58,6 +64,30 @@ func (r *RuleRequirement) Evaluate(ctx context.Context, prctx pull.Context) comm
 	return result
 }
 
+// evaluateRequired evaluates the rules required by the rule and marks the
+// result as pending if any of them are pending. Skipped rules do not block.
+func (r *RuleRequirement) evaluateRequired(ctx context.Context, prctx pull.Context, result *common.Result) {
+	result.RequiredRules = r.rule.RequiresRules
+
+	var waiting []string
+	for _, req := range r.requires {
+		res := req.Evaluate(ctx, prctx)
+		if res.Error != nil {
+			result.Error = errors.WithMessage(res.Error, fmt.Sprintf("failed to evaluate required rule '%s'", req.rule.Name))
+			return
+		}
+		if res.Status == common.StatusPending {
+			waiting = append(waiting, req.rule.Name)
+		}
+	}
+
+	if len(waiting) > 0 {
+		result.Status = common.StatusPending
+		result.Description = fmt.Sprintf("Waiting for required rules: %s", strings.Join(waiting, ", "))
+		result.WaitingFor = waiting
+	}
+}
+
 type OrRequirement struct {
 	requirements []common.Evaluator
 }
@@ -72,6 +102,9 @@ func (r *OrRequirement) Evaluate(ctx context.Context, prctx pull.Context) common
 	var err error
 	var pending, approved, skipped int
 	for _, c := range children {
+		if c.Advisory {
+			continue
+		}
 		if c.Error != nil {
 			err = c.Error
 			continue
@@ -124,6 +157,9 @@ func (r *AndRequirement) Evaluate(ctx context.Context, prctx pull.Context) commo
 	var err error
 	var pending, approved, skipped int
 	for _, c := range children {
+		if c.Advisory {
+			continue
+		}
 		if c.Error != nil {
 			err = c.Error
 			continue
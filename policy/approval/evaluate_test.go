@@ -19,6 +19,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -241,3 +242,308 @@ func TestOrRequirement(t *testing.T) {
 	assert.NoError(t, result.Error)
 	assert.Equal(t, common.StatusApproved, result.Status)
 }
+
+func TestRequiredRules(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{}
+
+	policy := `
+- security
+`
+
+	rules := `
+- name: security
+  requires_rules: ["owners", "docs"]
+- name: owners
+  requires:
+    count: 1
+    users: ["owner"]
+- name: docs
+  if:
+    changed_files:
+      paths: ["docs/.*"]
+`
+
+	eval, err := loadAndParsePolicy(t, policy, rules)
+	require.NoError(t, err)
+
+	res := eval.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+
+	rule := res.Children[0]
+	assert.Equal(t, "security", rule.Name)
+	assert.Equal(t, common.StatusPending, rule.Status)
+	assert.Equal(t, "Waiting for required rules: owners", rule.Description)
+	assert.Equal(t, []string{"owners", "docs"}, rule.RequiredRules)
+	assert.Equal(t, []string{"owners"}, rule.WaitingFor)
+
+	prctx.CommentsValue = []*pull.Comment{
+		{
+			Author: "owner",
+			Body:   ":+1:",
+		},
+	}
+
+	res = eval.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+
+	rule = res.Children[0]
+	assert.Equal(t, common.StatusApproved, rule.Status)
+	assert.Empty(t, rule.WaitingFor)
+}
+
+func TestAdvisoryRequirement(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{}
+
+	advisory := &mockRequirement{
+		result: &common.Result{
+			Status:   common.StatusPending,
+			Advisory: true,
+		},
+	}
+	failing := &mockRequirement{
+		result: &common.Result{
+			Error:    errors.New("advisory failure"),
+			Advisory: true,
+		},
+	}
+
+	// Advisory rules do not block approval
+	and := &AndRequirement{
+		requirements: append(makeRulesResultingIn(common.StatusApproved), advisory, failing),
+	}
+	result := and.Evaluate(ctx, prctx)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, common.StatusApproved, result.Status)
+	assert.Len(t, result.Children, 3)
+
+	// Advisory rules do not approve
+	or := &OrRequirement{
+		requirements: append(makeRulesResultingIn(common.StatusPending), &mockRequirement{
+			result: &common.Result{
+				Status:   common.StatusApproved,
+				Advisory: true,
+			},
+		}),
+	}
+	result = or.Evaluate(ctx, prctx)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, common.StatusPending, result.Status)
+}
+
+func TestResultCache(t *testing.T) {
+	prctx := &pulltest.Context{
+		HeadSHAValue: "abc123",
+		TeamMemberships: map[string][]string{
+			"reviewer": {"org/reviewers"},
+		},
+	}
+
+	rules := `
+- name: reviewers
+  requires:
+    count: 1
+    teams: ["org/reviewers"]
+- name: aged
+  options:
+    minimum_open_duration: 1h
+  requires:
+    count: 1
+    teams: ["org/reviewers"]
+`
+
+	eval, err := loadAndParsePolicy(t, "- and: [reviewers, aged]", rules)
+	require.NoError(t, err)
+
+	cache := NewResultCache(time.Hour, 0)
+	ctx := WithResultCache(context.Background(), cache, "v1")
+
+	res := eval.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusPending, res.Children[0].Children[0].Status)
+	assert.Equal(t, 1, cache.Len(), "only the rule without a minimum open duration is cached")
+
+	prctx.CommentsValue = []*pull.Comment{
+		{
+			ID:     "comment1",
+			Author: "reviewer",
+			Body:   ":+1:",
+		},
+	}
+
+	res = eval.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusApproved, res.Children[0].Children[0].Status, "new comments invalidate cached results")
+	assert.Equal(t, 2, cache.Len())
+
+	prctx.TeamMemberships = nil
+
+	res = eval.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusPending, res.Children[0].Children[0].Status, "membership changes invalidate cached results")
+
+	prctx.TeamMemberships = map[string][]string{
+		"reviewer": {"org/reviewers"},
+	}
+
+	cached := cache.Len()
+
+	res = eval.Evaluate(WithResultCache(context.Background(), cache, "v2"), prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusApproved, res.Children[0].Children[0].Status)
+	assert.Equal(t, cached+1, cache.Len(), "policy changes invalidate cached results")
+
+	cache.Flush()
+	assert.Equal(t, 0, cache.Len())
+
+	// results of evaluations that started before a flush are discarded
+	generation := cache.currentGeneration()
+	cache.Flush()
+	cache.put("key", generation, common.Result{Status: common.StatusApproved}, nil)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestResultCacheInputs(t *testing.T) {
+	evaluate := func(t *testing.T, ctx context.Context, eval common.Evaluator, prctx pull.Context) common.EvaluationStatus {
+		res := eval.Evaluate(ctx, prctx)
+		require.NoError(t, res.Error)
+		return res.Children[0].Status
+	}
+
+	newContext := func() *pulltest.Context {
+		return &pulltest.Context{
+			AuthorValue:  "author",
+			HeadSHAValue: "abc123",
+			ReviewsValue: []*pull.Review{
+				{ID: "review1", Author: "reviewer", State: pull.ReviewApproved, SHA: "abc123"},
+			},
+			TeamMemberships: map[string][]string{
+				"author":   {"org/reviewers"},
+				"reviewer": {"org/reviewers"},
+			},
+		}
+	}
+
+	t.Run("requestedReviewers", func(t *testing.T) {
+		eval, err := loadAndParsePolicy(t, "- reviewers", `
+- name: reviewers
+  requires:
+    count: 1
+    teams: ["org/reviewers"]
+`)
+		require.NoError(t, err)
+
+		cache := NewResultCache(time.Hour, 0)
+		ctx := WithResultCache(context.Background(), cache, "v1")
+		prctx := newContext()
+
+		assert.Equal(t, common.StatusApproved, evaluate(t, ctx, eval, prctx))
+		assert.Equal(t, 1, cache.Len())
+
+		prctx.RequestedReviewersValue = []string{"reviewer"}
+
+		assert.Equal(t, common.StatusApproved, evaluate(t, ctx, eval, prctx))
+		assert.Equal(t, 2, cache.Len(), "requested reviewers are not part of the inputs")
+
+		prctx.RequestedTeamsValue = []string{"org/reviewers"}
+
+		assert.Equal(t, common.StatusApproved, evaluate(t, ctx, eval, prctx))
+		assert.Equal(t, 3, cache.Len(), "requested teams are not part of the inputs")
+	})
+
+	t.Run("waitForRereview", func(t *testing.T) {
+		eval, err := loadAndParsePolicy(t, "- reviewers", `
+- name: reviewers
+  options:
+    wait_for_rereview: true
+  requires:
+    count: 1
+    teams: ["org/reviewers"]
+`)
+		require.NoError(t, err)
+
+		cache := NewResultCache(time.Hour, 0)
+		ctx := WithResultCache(context.Background(), cache, "v1")
+		prctx := newContext()
+
+		assert.Equal(t, common.StatusApproved, evaluate(t, ctx, eval, prctx))
+
+		prctx.RequestedReviewersValue = []string{"reviewer"}
+
+		assert.Equal(t, common.StatusPending, evaluate(t, ctx, eval, prctx), "re-requested review did not invalidate the result")
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("allowAuthorIf", func(t *testing.T) {
+		eval, err := loadAndParsePolicy(t, "- reviewers", `
+- name: reviewers
+  options:
+    allow_author_if:
+      has_repository_topic:
+        topics: ["docs"]
+  requires:
+    count: 1
+    teams: ["org/reviewers"]
+`)
+		require.NoError(t, err)
+
+		cache := NewResultCache(time.Hour, 0)
+		ctx := WithResultCache(context.Background(), cache, "v1")
+		prctx := newContext()
+		prctx.ReviewsValue[0].Author = "author"
+		prctx.RepositoryTopicsValue = []string{"docs"}
+
+		assert.Equal(t, common.StatusApproved, evaluate(t, ctx, eval, prctx))
+
+		prctx.RepositoryTopicsValue = nil
+
+		assert.Equal(t, common.StatusPending, evaluate(t, ctx, eval, prctx), "author predicate changes did not invalidate the result")
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("repositoryPredicates", func(t *testing.T) {
+		eval, err := loadAndParsePolicy(t, "- reviewers", `
+- name: reviewers
+  if:
+    has_repository_topic:
+      topics: ["critical"]
+  requires:
+    count: 1
+    teams: ["org/admins"]
+`)
+		require.NoError(t, err)
+
+		cache := NewResultCache(time.Hour, 0)
+		ctx := WithResultCache(context.Background(), cache, "v1")
+		prctx := newContext()
+
+		assert.Equal(t, common.StatusSkipped, evaluate(t, ctx, eval, prctx))
+
+		prctx.RepositoryTopicsValue = []string{"critical"}
+
+		assert.Equal(t, common.StatusPending, evaluate(t, ctx, eval, prctx), "repository changes did not invalidate the result")
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("membership", func(t *testing.T) {
+		eval, err := loadAndParsePolicy(t, "- reviewers", `
+- name: reviewers
+  requires:
+    count: 1
+    teams: ["org/reviewers"]
+`)
+		require.NoError(t, err)
+
+		cache := NewResultCache(time.Hour, 0)
+		ctx := WithResultCache(context.Background(), cache, "v1")
+		prctx := newContext()
+
+		assert.Equal(t, common.StatusApproved, evaluate(t, ctx, eval, prctx))
+		assert.Equal(t, 1, cache.Len())
+
+		delete(prctx.TeamMemberships, "reviewer")
+
+		assert.Equal(t, common.StatusPending, evaluate(t, ctx, eval, prctx), "removal from a team did not invalidate the result")
+	})
+}
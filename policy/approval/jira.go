@@ -0,0 +1,144 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/jira"
+	"github.com/palantir/policy-bot/pull"
+)
+
+var jiraKeyPattern = regexp.MustCompile(`\b([A-Z][A-Z0-9_]+)-[0-9]+\b`)
+
+// JiraRequirement approves a rule when a Jira issue linked by the pull request
+// reaches one of the configured statuses. Issues are linked by mentioning
+// their keys, like "CHG-123", in the title or body of the pull request.
+//
+// The author of the pull request controls the title and body, so they can
+// link any issue. Only issues in the configured projects are considered,
+// which should be projects where issues reach an approving status only after
+// review of the change they describe.
+type JiraRequirement struct {
+	// Statuses are the names of the issue statuses that approve the rule,
+	// like "Change Approved". Names are not case sensitive.
+	Statuses []string `yaml:"statuses"`
+
+	// Projects are the keys of the projects whose issues are linked. At
+	// least one project is required.
+	Projects []string `yaml:"projects"`
+}
+
+// linkedIssues returns the keys of the issues mentioned in the title and body
+// of the pull request in the order they appear.
+func (j *JiraRequirement) linkedIssues(ctx context.Context, prctx pull.Context) ([]string, error) {
+	title, err := prctx.Title(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get title")
+	}
+	body, err := prctx.Body(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get body")
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, match := range jiraKeyPattern.FindAllStringSubmatch(title+"\n"+body, -1) {
+		if seen[match[0]] || !j.inProject(match[1]) {
+			continue
+		}
+		seen[match[0]] = true
+		keys = append(keys, match[0])
+	}
+	return keys, nil
+}
+
+func (j *JiraRequirement) inProject(project string) bool {
+	for _, p := range j.Projects {
+		if p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// checkJiraRequirements returns an error if a rule requires a Jira issue
+// without listing the projects and statuses that approve it.
+func checkJiraRequirements(rules map[string]*Rule) error {
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		j := rules[name].Requires.Jira
+		if j == nil {
+			continue
+		}
+		if len(j.Projects) == 0 {
+			return errors.Errorf("rule '%s' requires a Jira issue but does not list its projects", name)
+		}
+		if len(j.Statuses) == 0 {
+			return errors.Errorf("rule '%s' requires a Jira issue but does not list its approving statuses", name)
+		}
+	}
+	return nil
+}
+
+func (j *JiraRequirement) approvingStatus(status string) bool {
+	for _, s := range j.Statuses {
+		if strings.EqualFold(s, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// approval returns true if a linked issue has an approving status and a
+// message describing the state of the linked issues.
+func (j *JiraRequirement) approval(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	provider, err := jira.ProviderFromContext(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	keys, err := j.linkedIssues(ctx, prctx)
+	if err != nil {
+		return false, "", err
+	}
+	if len(keys) == 0 {
+		return false, "No linked Jira issue", nil
+	}
+
+	for _, key := range keys {
+		status, err := provider.IssueStatus(ctx, key)
+		if err != nil {
+			return false, "", errors.WithMessage(err, fmt.Sprintf("failed to get status of Jira issue %s", key))
+		}
+		if j.approvingStatus(status) {
+			return true, fmt.Sprintf("Approved by Jira issue %s (%s)", key, status), nil
+		}
+	}
+
+	msg := fmt.Sprintf("Waiting for Jira issue %s to reach %s", strings.Join(keys, ", "), strings.Join(j.Statuses, " or "))
+	return false, msg, nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultOwnersFilename = "OWNERS"
+
+	// maxListedFiles is the number of files without owner approval that are
+	// named in the rule description.
+	maxListedFiles = 3
+)
+
+// OwnersRequirement requires that every changed file is approved by one of
+// its owners. Owners are defined by owners files on the base branch of the
+// pull request. Each directory may have an owners file, and files are owned
+// by the owners of their directory and of every parent directory, unless a
+// directory stops inheritance. Files without owners do not need approval.
+type OwnersRequirement struct {
+	// Filename is the name of owners files. If empty, DefaultOwnersFilename
+	// is used.
+	Filename string `yaml:"filename"`
+}
+
+// ownersFile is the content of an owners file.
+type ownersFile struct {
+	common.Actors `yaml:",inline"`
+
+	// Inherit adds the owners of parent directories to the owners of this
+	// directory. The default is true.
+	Inherit *bool `yaml:"inherit"`
+
+	// Files overrides the owners of files that match a pattern relative to
+	// the directory. The owners of the first matching pattern replace the
+	// owners of this directory and its parents.
+	Files []ownersOverride `yaml:"files"`
+}
+
+type ownersOverride struct {
+	Pattern       string `yaml:"pattern"`
+	common.Actors `yaml:",inline"`
+}
+
+// ownedFile is a changed file and its owners.
+type ownedFile struct {
+	Path   string
+	Owners []*common.Actors
+}
+
+func hasOwners(a *common.Actors) bool {
+	return !a.IsEmpty() || a.Admins || a.WriteCollaborators
+}
+
+// ownersResolver finds the owners of files, loading each owners file once.
+type ownersResolver struct {
+	prctx    pull.Context
+	filename string
+	files    map[string]*ownersFile
+}
+
+func (req *OwnersRequirement) newResolver(prctx pull.Context) *ownersResolver {
+	filename := req.Filename
+	if filename == "" {
+		filename = DefaultOwnersFilename
+	}
+	return &ownersResolver{
+		prctx:    prctx,
+		filename: filename,
+		files:    make(map[string]*ownersFile),
+	}
+}
+
+// load returns the owners file in a directory or nil if the directory does
+// not have one.
+func (o *ownersResolver) load(ctx context.Context, dir string) (*ownersFile, error) {
+	if f, ok := o.files[dir]; ok {
+		return f, nil
+	}
+
+	p := path.Join(dir, o.filename)
+	content, err := o.prctx.BaseFileContent(ctx, p)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("failed to load owners file %s", p))
+	}
+
+	var f *ownersFile
+	if content != nil {
+		f = &ownersFile{}
+		if err := yaml.UnmarshalStrict(content, f); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse owners file %s", p)
+		}
+		for _, override := range f.Files {
+			if _, err := path.Match(override.Pattern, ""); err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern in owners file %s", p)
+			}
+		}
+	}
+
+	o.files[dir] = f
+	return f, nil
+}
+
+// owners returns the owners of the file with the given path, starting with
+// the owners of its directory.
+func (o *ownersResolver) owners(ctx context.Context, file string) ([]*common.Actors, error) {
+	var owners []*common.Actors
+
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		f, err := o.load(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if f != nil {
+			rel := file
+			if dir != "." {
+				rel = strings.TrimPrefix(file, dir+"/")
+			}
+			for i := range f.Files {
+				if ok, _ := path.Match(f.Files[i].Pattern, rel); ok {
+					return append(owners, &f.Files[i].Actors), nil
+				}
+			}
+
+			if hasOwners(&f.Actors) {
+				owners = append(owners, &f.Actors)
+			}
+			if f.Inherit != nil && !*f.Inherit {
+				break
+			}
+		}
+
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+	return owners, nil
+}
+
+// approval returns the candidates who approved changed files as owners and
+// the changed files that are not approved by any of their owners. The
+// candidates must already be filtered by the rule options. Renamed files
+// need the approval of the owners of both paths.
+func (req *OwnersRequirement) approval(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) ([]*common.Candidate, []*ownedFile, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	err := prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		for _, p := range f.Paths() {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	type ownerKey struct {
+		owners *common.Actors
+		user   string
+	}
+	isOwner := make(map[ownerKey]bool)
+
+	resolver := req.newResolver(prctx)
+
+	var approvers []*common.Candidate
+	var missing []*ownedFile
+	isApprover := make(map[string]bool)
+
+	for _, p := range paths {
+		owners, err := resolver.owners(ctx, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(owners) == 0 {
+			continue
+		}
+
+		approved := false
+		for _, c := range candidates {
+			for _, a := range owners {
+				key := ownerKey{owners: a, user: c.User}
+				member, ok := isOwner[key]
+				if !ok {
+					if member, err = a.IsActor(ctx, prctx, c.User); err != nil {
+						return nil, nil, errors.Wrap(err, "failed to check file ownership")
+					}
+					isOwner[key] = member
+				}
+				if member {
+					approved = true
+					break
+				}
+			}
+			if approved {
+				if !isApprover[c.User] {
+					isApprover[c.User] = true
+					approvers = append(approvers, c)
+				}
+				break
+			}
+		}
+
+		if !approved {
+			missing = append(missing, &ownedFile{Path: p, Owners: owners})
+		}
+	}
+	return approvers, missing, nil
+}
+
+// listOwners adds the users who own any of the files to users, returning the
+// sorted result.
+func listOwners(ctx context.Context, prctx pull.Context, files []*ownedFile, users []string) ([]string, error) {
+	listed := make(map[*common.Actors]bool)
+	present := make(map[string]bool, len(users))
+	for _, u := range users {
+		present[u] = true
+	}
+
+	for _, f := range files {
+		for _, a := range f.Owners {
+			if listed[a] {
+				continue
+			}
+			listed[a] = true
+
+			owners, err := a.ListUsers(ctx, prctx)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to list file owners")
+			}
+			for _, u := range owners {
+				if !present[u] {
+					present[u] = true
+					users = append(users, u)
+				}
+			}
+		}
+	}
+
+	sort.Strings(users)
+	return users, nil
+}
+
+func formatOwnedFiles(files []*ownedFile) string {
+	var names []string
+	for i, f := range files {
+		if i == maxListedFiles {
+			names = append(names, fmt.Sprintf("%d more files", len(files)-i))
+			break
+		}
+		names = append(names, f.Path)
+	}
+	return strings.Join(names, ", ")
+}
@@ -16,6 +16,8 @@ package approval
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -31,6 +33,22 @@ func (p Policy) Parse(rules map[string]*Rule) (common.Evaluator, error) {
 		return eval, nil
 	}
 
+	if err := checkRuleDependencies(rules); err != nil {
+		return nil, err
+	}
+	if err := checkStatusContexts(rules); err != nil {
+		return nil, err
+	}
+	if err := checkTriggers(rules); err != nil {
+		return nil, err
+	}
+	if err := checkDiffThresholds(rules); err != nil {
+		return nil, err
+	}
+	if err := checkJiraRequirements(rules); err != nil {
+		return nil, err
+	}
+
 	// assume "and" for the list of rules
 	root := map[interface{}]interface{}{
 		"and": []interface{}(p),
@@ -53,10 +71,7 @@ func parsePolicyR(policy interface{}, rules map[string]*Rule, depth int) (common
 	// Base case
 	if ruleName, ok := policy.(string); ok {
 		if rule, ok := rules[ruleName]; ok {
-			req := &RuleRequirement{
-				rule: rule,
-			}
-			return req, nil
+			return newRuleRequirement(rule, rules), nil
 		}
 		var keys []string
 		for k := range rules {
@@ -105,3 +120,82 @@ func parsePolicyR(policy interface{}, rules map[string]*Rule, depth int) (common
 
 	return nil, errors.Errorf("malformed policy, expected string or map, but encountered %T", policy)
 }
+
+// newRuleRequirement creates a requirement for a rule and the rules it
+// depends on. The dependencies must already be checked for cycles.
+func newRuleRequirement(rule *Rule, rules map[string]*Rule) *RuleRequirement {
+	req := &RuleRequirement{rule: rule}
+	for _, name := range rule.RequiresRules {
+		req.requires = append(req.requires, newRuleRequirement(rules[name], rules))
+	}
+	return req
+}
+
+// checkRuleDependencies returns an error if a rule requires a rule that does
+// not exist or if the rule dependencies contain a cycle.
+func checkRuleDependencies(rules map[string]*Rule) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return errors.Errorf("rule dependencies contain a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range rules[name].RequiresRules {
+			if _, ok := rules[dep]; !ok {
+				return errors.Errorf("rule '%s' requires undefined rule '%s'", name, dep)
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+
+	// visit rules in a fixed order so that errors are deterministic
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStatusContexts returns an error if multiple rules post statuses with
+// the same context.
+func checkStatusContexts(rules map[string]*Rule) error {
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	owners := make(map[string]string)
+	for _, name := range names {
+		status := rules[name].StatusContext
+		if status == "" {
+			continue
+		}
+		if owner, ok := owners[status]; ok {
+			return errors.Errorf("rules '%s' and '%s' use the same status context '%s'", owner, name, status)
+		}
+		owners[status] = name
+	}
+	return nil
+}
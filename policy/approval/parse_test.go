@@ -17,7 +17,9 @@ package approval
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
 
@@ -119,6 +121,28 @@ func TestParsePolicy(t *testing.T) {
 	require.True(t, reflect.DeepEqual(expected, req))
 }
 
+func TestParseRuleOptions(t *testing.T) {
+	ruleText := `
+- name: rule1
+  options:
+    minimum_open_duration: 2d12h
+- name: rule2
+  options:
+    minimum_open_duration: 90m
+`
+
+	var rules []*Rule
+	err := yaml.UnmarshalStrict([]byte(ruleText), &rules)
+	require.NoError(t, err, "failed to unmarshal rules")
+
+	require.Len(t, rules, 2)
+	assert.Equal(t, 60*time.Hour, rules[0].Options.MinimumOpenDuration.Duration())
+	assert.Equal(t, 90*time.Minute, rules[1].Options.MinimumOpenDuration.Duration())
+
+	err = yaml.UnmarshalStrict([]byte("options:\n  minimum_open_duration: 2x\n"), &Rule{})
+	assert.EqualError(t, err, `invalid duration "2x"`)
+}
+
 func TestParsePolicyError_empty(t *testing.T) {
 	// Empty list
 	policy := `
@@ -228,3 +252,86 @@ func loadAndParsePolicy(t *testing.T, policyText string, ruleText string) (commo
 
 	return policy.Parse(rulesByName)
 }
+
+func TestParsePolicyError_requiredRules(t *testing.T) {
+	policy := `
+- rule1
+`
+
+	rules := `
+- name: rule1
+  requires_rules: ["rule2"]
+`
+
+	_, err := loadAndParsePolicy(t, policy, rules)
+	require.EqualError(t, err, "rule 'rule1' requires undefined rule 'rule2'")
+
+	rules = `
+- name: rule1
+  requires_rules: ["rule2"]
+- name: rule2
+  requires_rules: ["rule3"]
+- name: rule3
+  requires_rules: ["rule1"]
+`
+
+	_, err = loadAndParsePolicy(t, policy, rules)
+	require.EqualError(t, err, "rule dependencies contain a cycle: rule1 -> rule2 -> rule3 -> rule1")
+}
+
+func TestParsePolicyError_statusContexts(t *testing.T) {
+	policy := `
+- rule1
+- rule2
+`
+
+	rules := `
+- name: rule1
+  status_context: security-review/approved
+- name: rule2
+  status_context: security-review/approved
+`
+
+	_, err := loadAndParsePolicy(t, policy, rules)
+	require.EqualError(t, err, "rules 'rule1' and 'rule2' use the same status context 'security-review/approved'")
+}
+
+func TestParsePolicyError_triggers(t *testing.T) {
+	policy := `
+- rule1
+`
+
+	rules := `
+- name: rule1
+  triggers: ["files", "labels"]
+`
+
+	_, err := loadAndParsePolicy(t, policy, rules)
+	require.EqualError(t, err, "rule 'rule1' has unknown trigger 'labels', must be one of comments, files, reviews, statuses")
+}
+
+func TestParsePolicyError_jira(t *testing.T) {
+	policy := `
+- rule1
+`
+
+	rules := `
+- name: rule1
+  requires:
+    jira:
+      statuses: ["Change Approved"]
+`
+
+	_, err := loadAndParsePolicy(t, policy, rules)
+	require.EqualError(t, err, "rule 'rule1' requires a Jira issue but does not list its projects")
+
+	rules = `
+- name: rule1
+  requires:
+    jira:
+      projects: ["CHG"]
+`
+
+	_, err = loadAndParsePolicy(t, policy, rules)
+	require.EqualError(t, err, "rule 'rule1' requires a Jira issue but does not list its approving statuses")
+}
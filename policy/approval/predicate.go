@@ -21,9 +21,30 @@ import (
 type Predicates struct {
 	ChangedFiles     *predicate.ChangedFiles     `yaml:"changed_files"`
 	OnlyChangedFiles *predicate.OnlyChangedFiles `yaml:"only_changed_files"`
-	HasAuthorIn      *predicate.HasAuthorIn      `yaml:"has_author_in"`
-	HasContributorIn *predicate.HasContributorIn `yaml:"has_contributor_in"`
-	TargetsBranch    *predicate.TargetsBranch    `yaml:"targets_branch"`
+
+	ChangedFileContents   *predicate.ChangedFileContents   `yaml:"changed_file_contents"`
+	ChangedLanguages      predicate.ChangedLanguages       `yaml:"changed_languages"`
+	ChangedDependencies   *predicate.ChangedDependencies   `yaml:"changed_dependencies"`
+	ChangedWorkflows      *predicate.ChangedWorkflows      `yaml:"changed_workflows"`
+	ContainsSecrets       *predicate.ContainsSecrets       `yaml:"contains_secrets"`
+	HasAuthorIn           *predicate.HasAuthorIn           `yaml:"has_author_in"`
+	HasContributorIn      *predicate.HasContributorIn      `yaml:"has_contributor_in"`
+	AuthorRecentMergedPRs *predicate.AuthorRecentMergedPRs `yaml:"author_recent_merged_prs"`
+	CommitEmails          *predicate.CommitEmails          `yaml:"commit_emails"`
+	TargetsBranch         *predicate.TargetsBranch         `yaml:"targets_branch"`
+	Title                 *predicate.Title                 `yaml:"title"`
+	Body                  *predicate.Body                  `yaml:"body"`
+	LastPushAge           *predicate.LastPushAge           `yaml:"last_push_age"`
+	ReviewRequested       *predicate.ReviewRequested       `yaml:"review_requested"`
+
+	HasRepositoryTopic    *predicate.HasRepositoryTopic   `yaml:"has_repository_topic"`
+	HasRepositoryProperty predicate.HasRepositoryProperty `yaml:"has_repository_property"`
+	SourceRepository      *predicate.SourceRepository     `yaml:"source_repository"`
+	TargetRepository      *predicate.TargetRepository     `yaml:"target_repository"`
+	RepositoryContains    *predicate.RepositoryContains   `yaml:"repository_contains"`
+
+	ExternalCheck   *predicate.ExternalCheck   `yaml:"external_check"`
+	HasOpenIncident *predicate.HasOpenIncident `yaml:"has_open_incident"`
 }
 
 func (p *Predicates) Predicates() []predicate.Predicate {
@@ -35,15 +56,82 @@ func (p *Predicates) Predicates() []predicate.Predicate {
 	if p.OnlyChangedFiles != nil {
 		ps = append(ps, predicate.Predicate(p.OnlyChangedFiles))
 	}
+	if p.ChangedFileContents != nil {
+		ps = append(ps, predicate.Predicate(p.ChangedFileContents))
+	}
+	if p.ChangedLanguages != nil {
+		ps = append(ps, predicate.Predicate(p.ChangedLanguages))
+	}
+	if p.ChangedDependencies != nil {
+		ps = append(ps, predicate.Predicate(p.ChangedDependencies))
+	}
+	if p.ChangedWorkflows != nil {
+		ps = append(ps, predicate.Predicate(p.ChangedWorkflows))
+	}
+	if p.ContainsSecrets != nil {
+		ps = append(ps, predicate.Predicate(p.ContainsSecrets))
+	}
 	if p.HasAuthorIn != nil {
 		ps = append(ps, predicate.Predicate(p.HasAuthorIn))
 	}
 	if p.HasContributorIn != nil {
 		ps = append(ps, predicate.Predicate(p.HasContributorIn))
 	}
+	if p.AuthorRecentMergedPRs != nil {
+		ps = append(ps, predicate.Predicate(p.AuthorRecentMergedPRs))
+	}
+	if p.CommitEmails != nil {
+		ps = append(ps, predicate.Predicate(p.CommitEmails))
+	}
 	if p.TargetsBranch != nil {
 		ps = append(ps, predicate.Predicate(p.TargetsBranch))
 	}
+	if p.Title != nil {
+		ps = append(ps, predicate.Predicate(p.Title))
+	}
+	if p.Body != nil {
+		ps = append(ps, predicate.Predicate(p.Body))
+	}
+	if p.LastPushAge != nil {
+		ps = append(ps, predicate.Predicate(p.LastPushAge))
+	}
+	if p.ReviewRequested != nil {
+		ps = append(ps, predicate.Predicate(p.ReviewRequested))
+	}
+	if p.HasRepositoryTopic != nil {
+		ps = append(ps, predicate.Predicate(p.HasRepositoryTopic))
+	}
+	if p.HasRepositoryProperty != nil {
+		ps = append(ps, predicate.Predicate(p.HasRepositoryProperty))
+	}
+	if p.SourceRepository != nil {
+		ps = append(ps, predicate.Predicate(p.SourceRepository))
+	}
+	if p.TargetRepository != nil {
+		ps = append(ps, predicate.Predicate(p.TargetRepository))
+	}
+	if p.RepositoryContains != nil {
+		ps = append(ps, predicate.Predicate(p.RepositoryContains))
+	}
+	if p.ExternalCheck != nil {
+		ps = append(ps, predicate.Predicate(p.ExternalCheck))
+	}
+	if p.HasOpenIncident != nil {
+		ps = append(ps, predicate.Predicate(p.HasOpenIncident))
+	}
 
 	return ps
 }
+
+// filePaths returns the path patterns of the file predicates, which scope the
+// file comments that approve the rule.
+func (p *Predicates) filePaths() []string {
+	var paths []string
+	if p.ChangedFiles != nil {
+		paths = append(paths, p.ChangedFiles.Paths...)
+	}
+	if p.OnlyChangedFiles != nil {
+		paths = append(paths, p.OnlyChangedFiles.Paths...)
+	}
+	return paths
+}
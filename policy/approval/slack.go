@@ -0,0 +1,89 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// SlackDecision is an approval or rejection of a rule that a user sent from
+// a Slack message. User is the GitHub login linked to the Slack account.
+type SlackDecision struct {
+	User   string
+	Reject bool
+
+	// SHA is the head commit of the pull request the decision applies to.
+	SHA       string
+	CreatedAt time.Time
+}
+
+type slackDecisionsKey struct{}
+
+// WithSlackDecisions returns a context in which rules that allow the slack
+// method use the given decisions, keyed by rule name.
+func WithSlackDecisions(ctx context.Context, decisions map[string][]*SlackDecision) context.Context {
+	return context.WithValue(ctx, slackDecisionsKey{}, decisions)
+}
+
+// addSlackApprovals applies the Slack decisions for the rule to the
+// candidates if the rule allows the slack method. An approval replaces any
+// other candidate for the same user and a rejection removes the user's
+// candidate, withdrawing their approval. Only decisions about the head
+// commit apply.
+func (r *Rule) addSlackApprovals(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) []*common.Candidate {
+	if !r.Options.GetMethods(ctx).Slack {
+		return candidates
+	}
+
+	decisions, _ := ctx.Value(slackDecisionsKey{}).(map[string][]*SlackDecision)
+	if len(decisions[r.Name]) == 0 {
+		return candidates
+	}
+
+	head := prctx.HeadSHA()
+	latest := make(map[string]*SlackDecision)
+	for _, d := range decisions[r.Name] {
+		if d.SHA != head {
+			continue
+		}
+		if prev, ok := latest[d.User]; !ok || d.CreatedAt.After(prev.CreatedAt) {
+			latest[d.User] = d
+		}
+	}
+	if len(latest) == 0 {
+		return candidates
+	}
+
+	filtered := candidates[:0]
+	for _, c := range candidates {
+		if _, ok := latest[c.User]; !ok {
+			filtered = append(filtered, c)
+		}
+	}
+	for _, d := range latest {
+		if !d.Reject {
+			filtered = append(filtered, &common.Candidate{
+				User:      d.User,
+				CreatedAt: d.CreatedAt,
+				SHA:       d.SHA,
+			})
+		}
+	}
+	return filtered
+}
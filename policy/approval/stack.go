@@ -0,0 +1,113 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// DefaultStatusCheckContext is the status check context used to find the
+// policy status of a parent pull request if the context does not set one.
+const DefaultStatusCheckContext = "policy-bot"
+
+type statusCheckContextKey struct{}
+
+// WithStatusCheckContext returns a context in which the policy status of
+// other pull requests is read from statuses with the given context prefix.
+func WithStatusCheckContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, statusCheckContextKey{}, name)
+}
+
+func statusCheckContext(ctx context.Context) string {
+	if name, ok := ctx.Value(statusCheckContextKey{}).(string); ok && name != "" {
+		return name
+	}
+	return DefaultStatusCheckContext
+}
+
+// pendingParent returns the open parent of a stacked pull request if the
+// policy of the parent is not approved. A pull request is stacked if its base
+// branch is the head branch of another pull request.
+func pendingParent(ctx context.Context, prctx pull.Context) (*pull.PullRequestRef, error) {
+	base, _, err := prctx.Branches(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get base branch")
+	}
+
+	parent, err := prctx.BranchPullRequest(ctx, base)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get parent pull request")
+	}
+	if parent == nil || !parent.Open {
+		return nil, nil
+	}
+
+	status := fmt.Sprintf("%s: %s", statusCheckContext(ctx), parent.Base)
+	if parent.Statuses[status] == "success" {
+		return nil, nil
+	}
+	return parent, nil
+}
+
+// baseChangedAt returns the time of the most recent change of the base
+// branch. If the rule ignores stack retargets, changes caused by merging the
+// parent of a stacked pull request are skipped.
+func (r *Rule) baseChangedAt(ctx context.Context, prctx pull.Context) (time.Time, error) {
+	if !r.Options.IgnoreStackRetargets {
+		return prctx.BaseChangedAt(ctx)
+	}
+
+	timeline, err := prctx.Timeline(ctx)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to list pull request timeline")
+	}
+
+	var changedAt time.Time
+	for _, e := range timeline {
+		if e.Type != pull.TimelineBaseChanged {
+			continue
+		}
+
+		retarget, err := isStackRetarget(ctx, prctx, e)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !retarget && e.CreatedAt.After(changedAt) {
+			changedAt = e.CreatedAt
+		}
+	}
+	return changedAt, nil
+}
+
+// isStackRetarget returns true if the base branch changed from the head
+// branch of a merged pull request to the base branch of that pull request,
+// which happens when the parent of a stacked pull request is merged.
+func isStackRetarget(ctx context.Context, prctx pull.Context, e *pull.TimelineEvent) (bool, error) {
+	if e.PreviousRef == "" {
+		return false, nil
+	}
+
+	parent, err := prctx.BranchPullRequest(ctx, e.PreviousRef)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get parent pull request")
+	}
+	return parent != nil && parent.Merged && parent.Base == e.CurrentRef, nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"time"
+)
+
+type ruleTimeoutKey struct{}
+
+// WithRuleTimeout returns a context in which the evaluation of each rule is
+// canceled after the given duration. Rules that time out report an error
+// caused by context.DeadlineExceeded; other rules are still evaluated.
+func WithRuleTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, ruleTimeoutKey{}, timeout)
+}
+
+func ruleTimeout(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(ruleTimeoutKey{}).(time.Duration)
+	return timeout
+}
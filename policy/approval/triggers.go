@@ -0,0 +1,75 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The sources of data that may trigger the evaluation of a rule.
+const (
+	TriggerFiles    = "files"
+	TriggerReviews  = "reviews"
+	TriggerComments = "comments"
+	TriggerStatuses = "statuses"
+)
+
+var validTriggers = map[string]bool{
+	TriggerFiles:    true,
+	TriggerReviews:  true,
+	TriggerComments: true,
+	TriggerStatuses: true,
+}
+
+// TriggeredBy returns true if events that change the given source of data
+// may change the result of the rule. Rules that do not declare triggers
+// depend on every source.
+func (r *Rule) TriggeredBy(source string) bool {
+	if len(r.Triggers) == 0 {
+		return true
+	}
+	for _, t := range r.Triggers {
+		if t == source {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTriggers returns an error if a rule declares an unknown trigger.
+func checkTriggers(rules map[string]*Rule) error {
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, t := range rules[name].Triggers {
+			if !validTriggers[t] {
+				var valid []string
+				for v := range validTriggers {
+					valid = append(valid, v)
+				}
+				sort.Strings(valid)
+				return errors.Errorf("rule '%s' has unknown trigger '%s', must be one of %s", name, t, strings.Join(valid, ", "))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// EligibleApprovers returns the users who could currently help satisfy each
+// pending rule in the approval section of the policy, keyed by rule name.
+// Rules that are waiting for required rules or that failed to evaluate are
+// excluded. See approval.Rule.EligibleApprovers for how users are selected.
+//
+// The result must come from evaluating the policy in config against prctx.
+// If result is nil, the policy is evaluated first. The context should be the
+// one used for evaluation, so that server settings like ignored commit
+// authors apply.
+func EligibleApprovers(ctx context.Context, prctx pull.Context, config *Config, result *common.Result) (map[string][]string, error) {
+	prctx, err := IgnoringPaths(prctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		evaluator, err := ParsePolicy(config)
+		if err != nil {
+			return nil, err
+		}
+		res := evaluator.Evaluate(ctx, prctx)
+		result = &res
+	}
+
+	rules := make(map[string]*approval.Rule)
+	for _, r := range config.ApprovalRules {
+		rules[r.Name] = r
+	}
+
+	approvers := make(map[string][]string)
+	for _, res := range PendingRules(config, result) {
+		name := res.Name
+		if _, ok := approvers[name]; ok {
+			continue
+		}
+
+		users, err := rules[name].EligibleApprovers(ctx, prctx)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("failed to list eligible approvers for rule %q", name))
+		}
+		approvers[name] = users
+	}
+	return approvers, nil
+}
+
+// PendingRules returns the results of the rules in the approval section of
+// result that are pending and not waiting for required rules, in the order
+// they appear in the policy. A rule that appears more than once in the policy
+// has more than one result.
+func PendingRules(config *Config, result *common.Result) []*common.Result {
+	rules := make(map[string]bool)
+	for _, r := range config.ApprovalRules {
+		rules[r.Name] = true
+	}
+
+	var pending []*common.Result
+	for _, c := range result.Children {
+		if c.Name == "approval" {
+			pending = pendingRules(c, rules, pending)
+		}
+	}
+	return pending
+}
+
+func pendingRules(res *common.Result, rules map[string]bool, pending []*common.Result) []*common.Result {
+	if len(res.Children) == 0 {
+		if rules[res.Name] && res.Error == nil && res.Status == common.StatusPending && len(res.WaitingFor) == 0 {
+			pending = append(pending, res)
+		}
+		return pending
+	}
+
+	for _, c := range res.Children {
+		pending = pendingRules(c, rules, pending)
+	}
+	return pending
+}
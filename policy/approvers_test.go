@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestEligibleApprovers(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		AuthorValue: "author",
+	}
+
+	config := &Config{
+		Policy: Policy{
+			Approval: approval.Policy{"review", "no-review", "review"},
+		},
+		ApprovalRules: []*approval.Rule{
+			{
+				Name: "review",
+				Requires: approval.Requires{
+					Count: 1,
+					Actors: common.Actors{
+						Users: []string{"reviewer", "author"},
+					},
+				},
+			},
+			{
+				Name: "no-review",
+			},
+		},
+	}
+
+	t.Run("evaluatesPolicy", func(t *testing.T) {
+		approvers, err := EligibleApprovers(ctx, prctx, config, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"review": {"reviewer"}}, approvers)
+	})
+
+	t.Run("usesResult", func(t *testing.T) {
+		evaluator, err := ParsePolicy(config)
+		require.NoError(t, err)
+
+		result := evaluator.Evaluate(ctx, prctx)
+		require.NoError(t, result.Error)
+
+		pending := PendingRules(config, &result)
+		if assert.Len(t, pending, 2) {
+			assert.Equal(t, "review", pending[0].Name)
+			assert.Equal(t, "review", pending[1].Name)
+		}
+
+		approvers, err := EligibleApprovers(ctx, prctx, config, &result)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"review": {"reviewer"}}, approvers)
+	})
+}
@@ -16,9 +16,11 @@ package common
 
 import (
 	"context"
+	"sort"
 
 	"github.com/pkg/errors"
 
+	"github.com/palantir/policy-bot/oncall"
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -30,9 +32,28 @@ type Actors struct {
 	Teams         []string `yaml:"teams"`
 	Organizations []string `yaml:"organizations"`
 
+	// ExcludeOutsideCollaborators and ExcludeSuspendedUsers restrict
+	// organization membership to active members who are not outside
+	// collaborators or suspended users, respectively.
+	ExcludeOutsideCollaborators bool `yaml:"exclude_outside_collaborators"`
+	ExcludeSuspendedUsers       bool `yaml:"exclude_suspended_users"`
+
 	// Github repository specific interpolation options
 	Admins             bool `yaml:"admins"`
 	WriteCollaborators bool `yaml:"write_collaborators"`
+
+	// OnCall lists on-call schedules, by the names defined in the server
+	// configuration, whose current on-call users are allowed actors.
+	OnCall []string `yaml:"on_call"`
+
+	// CIAdmins allows members of the CI administrator teams defined in the
+	// server configuration.
+	CIAdmins bool `yaml:"ci_admins"`
+
+	// PrincipalSets lists sets of users, teams, and organizations, by the
+	// names defined in the server configuration, whose members are allowed
+	// actors.
+	PrincipalSets []string `yaml:"principal_sets"`
 }
 
 const (
@@ -42,7 +63,7 @@ const (
 
 // IsEmpty returns true if no conditions for actors are defined.
 func (a *Actors) IsEmpty() bool {
-	return a == nil || (len(a.Users) == 0 && len(a.Teams) == 0 && len(a.Organizations) == 0)
+	return a == nil || (len(a.Users) == 0 && len(a.Teams) == 0 && len(a.Organizations) == 0 && len(a.OnCall) == 0 && !a.CIAdmins && len(a.PrincipalSets) == 0)
 }
 
 // IsActor returns true if the given user satisfies at least one of the
@@ -55,7 +76,7 @@ func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (
 	}
 
 	for _, t := range a.Teams {
-		member, err := prctx.IsTeamMember(t, user)
+		member, err := prctx.IsTeamMember(ctx, t, user)
 		if err != nil {
 			return false, errors.Wrap(err, "failed to get team membership")
 		}
@@ -65,7 +86,7 @@ func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (
 	}
 
 	for _, o := range a.Organizations {
-		member, err := prctx.IsOrgMember(o, user)
+		member, err := a.isOrgActor(ctx, prctx, o, user)
 		if err != nil {
 			return false, errors.Wrap(err, "failed to get org membership")
 		}
@@ -75,7 +96,7 @@ func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (
 	}
 
 	if a.Admins {
-		isAdmin, err := prctx.IsCollaborator(prctx.RepositoryOwner(), prctx.RepositoryName(), user, GithubAdminPermission)
+		isAdmin, err := prctx.IsCollaborator(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), user, GithubAdminPermission)
 		if err != nil {
 			return false, errors.Wrap(err, "failed to get admin collaborator status")
 		}
@@ -85,7 +106,7 @@ func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (
 	}
 
 	if a.WriteCollaborators {
-		isWrite, err := prctx.IsCollaborator(prctx.RepositoryOwner(), prctx.RepositoryName(), user, GithubWritePermission)
+		isWrite, err := prctx.IsCollaborator(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), user, GithubWritePermission)
 		if err != nil {
 			return false, errors.Wrap(err, "failed to get write collaborator status")
 		}
@@ -94,5 +115,208 @@ func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (
 		}
 	}
 
+	for _, s := range a.OnCall {
+		onCall, err := onCallUsers(ctx, s)
+		if err != nil {
+			return false, err
+		}
+		for _, u := range onCall {
+			if user == u {
+				return true, nil
+			}
+		}
+	}
+
+	if a.CIAdmins {
+		teams, err := ciAdminTeams(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range teams {
+			member, err := prctx.IsTeamMember(ctx, t, user)
+			if err != nil {
+				return false, errors.Wrap(err, "failed to get team membership")
+			}
+			if member {
+				return true, nil
+			}
+		}
+	}
+
+	for _, name := range a.PrincipalSets {
+		set, err := principalSet(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		isActor, err := set.IsActor(ctx, prctx, user)
+		if err != nil {
+			return false, err
+		}
+		if isActor {
+			return true, nil
+		}
+	}
+
 	return false, nil
 }
+
+// isOrgActor returns true if the user is a member of the organization that
+// is not excluded by the membership options.
+func (a *Actors) isOrgActor(ctx context.Context, prctx pull.Context, org, user string) (bool, error) {
+	if !a.ExcludeOutsideCollaborators && !a.ExcludeSuspendedUsers {
+		return prctx.IsOrgMember(ctx, org, user)
+	}
+
+	m, err := prctx.OrganizationMembership(ctx, org, user)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case !m.Member:
+		return false, nil
+	case a.ExcludeOutsideCollaborators && m.OutsideCollaborator:
+		return false, nil
+	case a.ExcludeSuspendedUsers && m.Suspended:
+		return false, nil
+	}
+	return true, nil
+}
+
+type ciAdminTeamsKey struct{}
+
+// WithCIAdminTeams returns a context in which the CIAdmins actor matches
+// members of the given teams.
+func WithCIAdminTeams(ctx context.Context, teams []string) context.Context {
+	return context.WithValue(ctx, ciAdminTeamsKey{}, teams)
+}
+
+func ciAdminTeams(ctx context.Context) ([]string, error) {
+	teams, _ := ctx.Value(ciAdminTeamsKey{}).([]string)
+	if len(teams) == 0 {
+		return nil, errors.New("ci_admins requires the server to configure CI administrator teams")
+	}
+	return teams, nil
+}
+
+func onCallUsers(ctx context.Context, schedule string) ([]string, error) {
+	provider, err := oncall.ProviderFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := provider.OnCallUsers(ctx, schedule)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get on-call users")
+	}
+	return users, nil
+}
+
+// ListUsers returns the sorted, de-duplicated usernames of all users who satisfy
+// at least one of the conditions in this structure. Teams, organizations, and
+// repository permissions are expanded to their current members.
+func (a *Actors) ListUsers(ctx context.Context, prctx pull.Context) ([]string, error) {
+	users := make(map[string]bool)
+	for _, u := range a.Users {
+		users[u] = true
+	}
+
+	for _, t := range a.Teams {
+		members, err := prctx.TeamMembers(ctx, t)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list team members")
+		}
+		for _, u := range members {
+			users[u] = true
+		}
+	}
+
+	for _, o := range a.Organizations {
+		members, err := prctx.OrganizationMembers(ctx, o)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list org members")
+		}
+		for _, u := range members {
+			if users[u] {
+				continue
+			}
+			if a.ExcludeOutsideCollaborators || a.ExcludeSuspendedUsers {
+				ok, err := a.isOrgActor(ctx, prctx, o, u)
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to get org membership")
+				}
+				if !ok {
+					continue
+				}
+			}
+			users[u] = true
+		}
+	}
+
+	if a.Admins {
+		admins, err := prctx.RepositoryCollaborators(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), GithubAdminPermission)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list admin collaborators")
+		}
+		for _, u := range admins {
+			users[u] = true
+		}
+	}
+
+	if a.WriteCollaborators {
+		writers, err := prctx.RepositoryCollaborators(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), GithubWritePermission)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list write collaborators")
+		}
+		for _, u := range writers {
+			users[u] = true
+		}
+	}
+
+	for _, s := range a.OnCall {
+		onCall, err := onCallUsers(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range onCall {
+			users[u] = true
+		}
+	}
+
+	if a.CIAdmins {
+		teams, err := ciAdminTeams(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			members, err := prctx.TeamMembers(ctx, t)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to list team members")
+			}
+			for _, u := range members {
+				users[u] = true
+			}
+		}
+	}
+
+	for _, name := range a.PrincipalSets {
+		set, err := principalSet(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		members, err := set.ListUsers(ctx, prctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range members {
+			users[u] = true
+		}
+	}
+
+	list := make([]string, 0, len(users))
+	for u := range users {
+		list = append(list, u)
+	}
+	sort.Strings(list)
+	return list, nil
+}
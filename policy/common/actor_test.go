@@ -16,11 +16,13 @@ package common
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/palantir/policy-bot/oncall"
 	"github.com/palantir/policy-bot/pull/pulltest"
 )
 
@@ -92,6 +94,57 @@ func TestIsActor(t *testing.T) {
 	})
 }
 
+func TestOrganizationMembershipOptions(t *testing.T) {
+	ctx := context.Background()
+	prctx := pulltest.New().
+		WithOrgs("member", "acme").
+		WithOrgs("suspended-member", "acme").
+		WithSuspendedUsers("suspended-member").
+		WithOutsideCollaborator("outsider", "acme").
+		Build()
+
+	isActor := func(t *testing.T, a *Actors, user string) bool {
+		ok, err := a.IsActor(ctx, prctx, user)
+		require.NoError(t, err)
+		return ok
+	}
+
+	t.Run("default", func(t *testing.T) {
+		a := &Actors{Organizations: []string{"acme"}}
+
+		assert.True(t, isActor(t, a, "member"))
+		assert.True(t, isActor(t, a, "suspended-member"))
+		assert.False(t, isActor(t, a, "outsider"))
+	})
+
+	t.Run("excludeSuspended", func(t *testing.T) {
+		a := &Actors{
+			Organizations:               []string{"acme"},
+			ExcludeOutsideCollaborators: true,
+			ExcludeSuspendedUsers:       true,
+		}
+
+		assert.True(t, isActor(t, a, "member"))
+		assert.False(t, isActor(t, a, "suspended-member"))
+		assert.False(t, isActor(t, a, "outsider"))
+
+		users, err := a.ListUsers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"member"}, users)
+	})
+
+	t.Run("membershipError", func(t *testing.T) {
+		a := &Actors{
+			Organizations:         []string{"acme"},
+			ExcludeSuspendedUsers: true,
+		}
+
+		prctx := pulltest.New().WithError("OrganizationMembership", errors.New("api failure")).Build()
+		_, err := a.IsActor(ctx, prctx, "member")
+		assert.Error(t, err)
+	})
+}
+
 func TestIsEmpty(t *testing.T) {
 	a := &Actors{}
 	assert.True(t, a.IsEmpty(), "Actors struct was not empty")
@@ -108,3 +161,147 @@ func TestIsEmpty(t *testing.T) {
 	a = nil
 	assert.True(t, a.IsEmpty(), "nil struct was not empty")
 }
+
+func TestListUsers(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		TeamMemberships: map[string][]string{
+			"mhaypenny": {"cool-org/team1"},
+			"ttest":     {"cool-org/team1", "cool-org/team2"},
+		},
+		OrgMemberships: map[string][]string{
+			"mhaypenny": {"cool-org"},
+			"otest":     {"other-org"},
+		},
+		CollaboratorMemberships: map[string][]string{
+			"atest": {GithubAdminPermission},
+			"wtest": {GithubWritePermission},
+		},
+	}
+
+	t.Run("union", func(t *testing.T) {
+		a := &Actors{
+			Users:         []string{"utest", "mhaypenny"},
+			Teams:         []string{"cool-org/team1"},
+			Organizations: []string{"other-org"},
+			Admins:        true,
+		}
+
+		users, err := a.ListUsers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"atest", "mhaypenny", "otest", "ttest", "utest"}, users)
+	})
+
+	t.Run("writeCollaborators", func(t *testing.T) {
+		a := &Actors{
+			WriteCollaborators: true,
+		}
+
+		users, err := a.ListUsers(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"wtest"}, users)
+	})
+}
+
+type staticOnCall map[string][]string
+
+func (p staticOnCall) OnCallUsers(ctx context.Context, schedule string) ([]string, error) {
+	return p[schedule], nil
+}
+
+func (p staticOnCall) HasOpenIncident(ctx context.Context, service string) (bool, error) {
+	return false, nil
+}
+
+func TestOnCallActors(t *testing.T) {
+	prctx := &pulltest.Context{}
+	a := &Actors{
+		OnCall: []string{"primary"},
+	}
+
+	_, err := a.IsActor(context.Background(), prctx, "mhaypenny")
+	assert.Error(t, err, "on-call actors were evaluated without a provider")
+
+	ctx := oncall.WithProvider(context.Background(), staticOnCall{
+		"primary":   {"mhaypenny"},
+		"secondary": {"ttest"},
+	})
+
+	isActor, err := a.IsActor(ctx, prctx, "mhaypenny")
+	require.NoError(t, err)
+	assert.True(t, isActor, "mhaypenny is not an actor")
+
+	isActor, err = a.IsActor(ctx, prctx, "ttest")
+	require.NoError(t, err)
+	assert.False(t, isActor, "ttest is an actor")
+
+	users, err := a.ListUsers(ctx, prctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mhaypenny"}, users)
+}
+
+func TestCIAdminActors(t *testing.T) {
+	prctx := &pulltest.Context{
+		TeamMemberships: map[string][]string{
+			"mhaypenny": {"cool-org/ci-admins"},
+			"ttest":     {"cool-org/team1"},
+		},
+	}
+	a := &Actors{
+		CIAdmins: true,
+	}
+	assert.False(t, a.IsEmpty())
+
+	_, err := a.IsActor(context.Background(), prctx, "mhaypenny")
+	assert.Error(t, err, "CI admin actors were evaluated without teams")
+
+	ctx := WithCIAdminTeams(context.Background(), []string{"cool-org/ci-admins"})
+
+	isActor, err := a.IsActor(ctx, prctx, "mhaypenny")
+	require.NoError(t, err)
+	assert.True(t, isActor, "mhaypenny is not an actor")
+
+	isActor, err = a.IsActor(ctx, prctx, "ttest")
+	require.NoError(t, err)
+	assert.False(t, isActor, "ttest is an actor")
+
+	users, err := a.ListUsers(ctx, prctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mhaypenny"}, users)
+}
+
+func TestPrincipalSetActors(t *testing.T) {
+	prctx := &pulltest.Context{
+		TeamMemberships: map[string][]string{
+			"mhaypenny": {"cool-org/security"},
+		},
+	}
+	a := &Actors{
+		PrincipalSets: []string{"security-reviewers"},
+	}
+	assert.False(t, a.IsEmpty())
+
+	_, err := a.IsActor(context.Background(), prctx, "mhaypenny")
+	assert.EqualError(t, err, "undefined principal set 'security-reviewers'")
+
+	ctx := WithPrincipalSets(context.Background(), map[string]PrincipalSet{
+		"security-reviewers": {
+			Users: []string{"ttest"},
+			Teams: []string{"cool-org/security"},
+		},
+	})
+
+	for _, user := range []string{"mhaypenny", "ttest"} {
+		isActor, err := a.IsActor(ctx, prctx, user)
+		require.NoError(t, err)
+		assert.Truef(t, isActor, "%s is not an actor", user)
+	}
+
+	isActor, err := a.IsActor(ctx, prctx, "other")
+	require.NoError(t, err)
+	assert.False(t, isActor, "other is an actor")
+
+	users, err := a.ListUsers(ctx, prctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mhaypenny", "ttest"}, users)
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var longUnitPattern = regexp.MustCompile(`([0-9]*\.?[0-9]+)([dw])`)
+
+// Duration is a time.Duration that is parsed from YAML with ParseDuration,
+// so values can use days and weeks, like "7d" or "1w12h".
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// ParseDuration parses a duration string like time.ParseDuration, but also
+// accepts "d" for days (24 hours) and "w" for weeks (7 days).
+func ParseDuration(s string) (time.Duration, error) {
+	var convErr error
+	expanded := longUnitPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := longUnitPattern.FindStringSubmatch(m)
+
+		n, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			convErr = err
+			return m
+		}
+
+		hours := n * 24
+		if parts[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+	if convErr != nil {
+		return 0, errors.Wrapf(convErr, "invalid duration %q", s)
+	}
+
+	d, err := time.ParseDuration(expanded)
+	if err != nil {
+		return 0, errors.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
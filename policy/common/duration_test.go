@@ -0,0 +1,57 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90m":    90 * time.Minute,
+		"7d":     7 * 24 * time.Hour,
+		"1.5d":   36 * time.Hour,
+		"1w":     7 * 24 * time.Hour,
+		"1w2d":   9 * 24 * time.Hour,
+		"2d12h":  60 * time.Hour,
+		"1d30ms": 24*time.Hour + 30*time.Millisecond,
+	}
+
+	for s, expected := range tests {
+		d, err := ParseDuration(s)
+		if assert.NoError(t, err, "failed to parse %q", s) {
+			assert.Equal(t, expected, d, "incorrect duration for %q", s)
+		}
+	}
+
+	_, err := ParseDuration("7 days")
+	assert.Error(t, err, "invalid duration was parsed")
+}
+
+func TestDurationUnmarshalYAML(t *testing.T) {
+	var v struct {
+		Expiration Duration `yaml:"expiration"`
+	}
+
+	require.NoError(t, yaml.UnmarshalStrict([]byte("expiration: 7d"), &v))
+	assert.Equal(t, 7*24*time.Hour, v.Expiration.Duration())
+
+	assert.Error(t, yaml.UnmarshalStrict([]byte("expiration: soon"), &v))
+}
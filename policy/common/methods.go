@@ -16,9 +16,12 @@ package common
 
 import (
 	"context"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -26,15 +29,93 @@ type Methods struct {
 	Comments     []string `yaml:"comments,omitempty"`
 	GithubReview bool     `yaml:"github_review,omitempty"`
 
+	// If FileComments is true, comments only make a user a candidate if they
+	// are review comments on a file matching CommentPaths or if they mention
+	// the name of a changed file matching CommentPaths. Review comments are
+	// ignored otherwise.
+	FileComments bool `yaml:"file_comments,omitempty"`
+
+	// CommentPaths are the path regular expressions used by FileComments. If
+	// empty, any changed file matches. It is excluded from serialized forms
+	// and should be set by the application.
+	CommentPaths []string `yaml:"-" json:"-"`
+
+	// GithubReviewCommentPatterns are regular expressions matched against
+	// inline review comments, which are attached to a line of a file. Unlike
+	// Comments, comments on the pull request itself never match. If
+	// FileComments is true, only review comments on files matching
+	// CommentPaths are considered.
+	GithubReviewCommentPatterns []string `yaml:"github_review_comment_patterns,omitempty"`
+
+	// If GithubActionsDispatch is true, automated workflows may approve or
+	// veto the rule by sending a signed repository_dispatch or
+	// workflow_dispatch event. It is only supported by approval rules.
+	GithubActionsDispatch bool `yaml:"github_actions_dispatch,omitempty"`
+
+	// If Slack is true, eligible approvers may approve or reject the rule
+	// from a Slack message after linking their Slack and GitHub accounts.
+	// It is only supported by approval rules.
+	Slack bool `yaml:"slack,omitempty"`
+
 	// If GithubReview is true, GithubReviewState is the state a review must
 	// have to be considered a candidated. It is currently excluded from
 	// serialized forms and should be set by the application.
 	GithubReviewState pull.ReviewState `yaml:"-" json:"-"`
 }
 
+// DefaultMethods overrides the built-in methods used by rules and policies
+// that do not specify their own methods. A nil field keeps the built-in
+// default.
+type DefaultMethods struct {
+	Approve    *Methods `yaml:"approve"`
+	Disapprove *Methods `yaml:"disapprove"`
+	Revoke     *Methods `yaml:"revoke"`
+}
+
+type defaultMethodsKey struct{}
+
+// WithDefaultMethods returns a context that uses the given methods in place
+// of the built-in defaults.
+func WithDefaultMethods(ctx context.Context, d DefaultMethods) context.Context {
+	return context.WithValue(ctx, defaultMethodsKey{}, d)
+}
+
+// DefaultMethodsFromContext returns the methods set by WithDefaultMethods or
+// an empty DefaultMethods if none were set.
+func DefaultMethodsFromContext(ctx context.Context) DefaultMethods {
+	d, _ := ctx.Value(defaultMethodsKey{}).(DefaultMethods)
+	return d
+}
+
+// SelectMethods returns a copy of the first non-nil methods with
+// GithubReviewState set to state.
+func SelectMethods(state pull.ReviewState, methods ...*Methods) *Methods {
+	for _, m := range methods {
+		if m != nil {
+			selected := *m
+			selected.GithubReviewState = state
+			return &selected
+		}
+	}
+	return &Methods{GithubReviewState: state}
+}
+
 type Candidate struct {
 	User      string
 	CreatedAt time.Time
+
+	// SHA and TreeSHA identify the head commit of the pull request at the
+	// time of the candidate action. They are empty if the commit is unknown.
+	SHA     string
+	TreeSHA string
+
+	// OnBehalfOf lists the teams whose review requests were satisfied by the
+	// review that made the user a candidate.
+	OnBehalfOf []string
+
+	// ID is the GitHub node ID of the comment or review that made the user a
+	// candidate, if known.
+	ID string
 }
 
 type CandidatesByCreationTime []*Candidate
@@ -53,23 +134,59 @@ func (m *Methods) Candidates(ctx context.Context, prctx pull.Context) ([]*Candid
 	var candidates []*Candidate
 
 	if len(m.Comments) > 0 {
-		comments, err := prctx.Comments()
+		comments, err := prctx.Comments(ctx)
 		if err != nil {
 			return nil, err
 		}
 
+		if m.FileComments {
+			if comments, err = m.fileComments(ctx, prctx, comments); err != nil {
+				return nil, err
+			}
+		}
+
 		for _, c := range comments {
 			if m.CommentMatches(c.Body) {
 				candidates = append(candidates, &Candidate{
 					User:      c.Author,
 					CreatedAt: c.CreatedAt,
+					ID:        c.ID,
 				})
 			}
 		}
 	}
 
+	if len(m.GithubReviewCommentPatterns) > 0 {
+		comments, err := m.reviewComments(ctx, prctx)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns := make([]*regexp.Regexp, 0, len(m.GithubReviewCommentPatterns))
+		for _, p := range m.GithubReviewCommentPatterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse review comment pattern %q", p)
+			}
+			patterns = append(patterns, re)
+		}
+
+		for _, c := range comments {
+			for _, re := range patterns {
+				if re.MatchString(c.Body) {
+					candidates = append(candidates, &Candidate{
+						User:      c.Author,
+						CreatedAt: c.CreatedAt,
+						ID:        c.ID,
+					})
+					break
+				}
+			}
+		}
+	}
+
 	if m.GithubReview {
-		reviews, err := prctx.Reviews()
+		reviews, err := prctx.Reviews(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -77,8 +194,12 @@ func (m *Methods) Candidates(ctx context.Context, prctx pull.Context) ([]*Candid
 		for _, r := range reviews {
 			if r.State == m.GithubReviewState {
 				candidates = append(candidates, &Candidate{
-					User:      r.Author,
-					CreatedAt: r.CreatedAt,
+					User:       r.Author,
+					CreatedAt:  r.CreatedAt,
+					SHA:        r.SHA,
+					TreeSHA:    r.TreeSHA,
+					OnBehalfOf: r.OnBehalfOf,
+					ID:         r.ID,
 				})
 			}
 		}
@@ -87,6 +208,97 @@ func (m *Methods) Candidates(ctx context.Context, prctx pull.Context) ([]*Candid
 	return deduplicateCandidates(candidates), nil
 }
 
+// fileComments returns the comments that mention a changed file matching
+// CommentPaths and the review comments on files matching CommentPaths.
+func (m *Methods) fileComments(ctx context.Context, prctx pull.Context, comments []*pull.Comment) ([]*pull.Comment, error) {
+	matches, err := m.commentPathMatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if matches(f.Filename) {
+			files = append(files, f.Filename)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	var scoped []*pull.Comment
+	for _, c := range comments {
+		for _, f := range files {
+			if strings.Contains(c.Body, f) {
+				scoped = append(scoped, c)
+				break
+			}
+		}
+	}
+
+	threads, err := prctx.ReviewThreads(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list review threads")
+	}
+	for _, t := range threads {
+		if matches(t.Path) {
+			scoped = append(scoped, t.Comments...)
+		}
+	}
+	return scoped, nil
+}
+
+// reviewComments returns the inline review comments, limited to files
+// matching CommentPaths if FileComments is true.
+func (m *Methods) reviewComments(ctx context.Context, prctx pull.Context) ([]*pull.Comment, error) {
+	matches := func(string) bool { return true }
+	if m.FileComments {
+		var err error
+		if matches, err = m.commentPathMatcher(); err != nil {
+			return nil, err
+		}
+	}
+
+	threads, err := prctx.ReviewThreads(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list review threads")
+	}
+
+	var comments []*pull.Comment
+	for _, t := range threads {
+		if matches(t.Path) {
+			comments = append(comments, t.Comments...)
+		}
+	}
+	return comments, nil
+}
+
+// commentPathMatcher returns a function that reports if a file matches
+// CommentPaths. If CommentPaths is empty, all files match.
+func (m *Methods) commentPathMatcher() (func(filename string) bool, error) {
+	paths := make([]*regexp.Regexp, 0, len(m.CommentPaths))
+	for _, p := range m.CommentPaths {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse comment path %q", p)
+		}
+		paths = append(paths, re)
+	}
+
+	return func(filename string) bool {
+		if len(paths) == 0 {
+			return true
+		}
+		for _, re := range paths {
+			if re.MatchString(filename) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
 func deduplicateCandidates(all []*Candidate) []*Candidate {
 	users := make(map[string]*Candidate)
 	for _, c := range all {
@@ -42,6 +42,7 @@ func TestCandidates(t *testing.T) {
 				CreatedAt: now.Add(2 * time.Minute),
 				Body:      "Looks good to me :+1:",
 				Author:    "mhaypenny",
+				ID:        "comment-mhaypenny",
 			},
 			{
 				CreatedAt: now.Add(4 * time.Minute),
@@ -64,6 +65,7 @@ func TestCandidates(t *testing.T) {
 				CreatedAt: now.Add(5 * time.Minute),
 				Author:    "ttest",
 				State:     pull.ReviewApproved,
+				ID:        "review-ttest",
 			},
 		},
 	}
@@ -113,6 +115,167 @@ func TestCandidates(t *testing.T) {
 		require.Len(t, cs, 2, "incorrect number of candidates found")
 		assert.Equal(t, "mhaypenny", cs[0].User)
 		assert.Equal(t, "ttest", cs[1].User)
+		assert.Equal(t, "comment-mhaypenny", cs[0].ID)
+		assert.Equal(t, "review-ttest", cs[1].ID)
+	})
+}
+
+func TestFileCommentCandidates(t *testing.T) {
+	now := time.Now()
+
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "db/migrations/0001_init.sql", Status: pull.FileAdded},
+			{Filename: "app/server.go", Status: pull.FileModified},
+		},
+		CommentsValue: []*pull.Comment{
+			{
+				CreatedAt: now.Add(0 * time.Minute),
+				Body:      "LGTM",
+				Author:    "rrandom",
+			},
+			{
+				CreatedAt: now.Add(1 * time.Minute),
+				Body:      "LGTM for db/migrations/0001_init.sql",
+				Author:    "mhaypenny",
+			},
+			{
+				CreatedAt: now.Add(2 * time.Minute),
+				Body:      "LGTM for app/server.go",
+				Author:    "ttest",
+			},
+		},
+		ReviewThreadsValue: []*pull.ReviewThread{
+			{
+				Path: "db/migrations/0001_init.sql",
+				Comments: []*pull.Comment{
+					{CreatedAt: now.Add(3 * time.Minute), Body: "Why this index?", Author: "bbob", Path: "db/migrations/0001_init.sql"},
+					{CreatedAt: now.Add(4 * time.Minute), Body: "Makes sense, LGTM", Author: "aalice", Path: "db/migrations/0001_init.sql"},
+				},
+			},
+			{
+				Path: "app/server.go",
+				Comments: []*pull.Comment{
+					{CreatedAt: now.Add(5 * time.Minute), Body: "LGTM", Author: "ccarol", Path: "app/server.go"},
+				},
+			},
+		},
+	}
+
+	t.Run("scopedToPaths", func(t *testing.T) {
+		m := &Methods{
+			Comments:     []string{"LGTM"},
+			FileComments: true,
+			CommentPaths: []string{"^db/migrations/.*"},
+		}
+
+		cs, err := m.Candidates(ctx, prctx)
+		require.NoError(t, err)
+
+		sort.Sort(CandidatesByCreationTime(cs))
+
+		require.Len(t, cs, 2, "incorrect number of candidates found")
+		assert.Equal(t, "mhaypenny", cs[0].User)
+		assert.Equal(t, "aalice", cs[1].User)
+	})
+
+	t.Run("anyChangedFile", func(t *testing.T) {
+		m := &Methods{
+			Comments:     []string{"LGTM"},
+			FileComments: true,
+		}
+
+		cs, err := m.Candidates(ctx, prctx)
+		require.NoError(t, err)
+
+		sort.Sort(CandidatesByCreationTime(cs))
+
+		require.Len(t, cs, 4, "incorrect number of candidates found")
+		assert.Equal(t, "mhaypenny", cs[0].User)
+		assert.Equal(t, "ttest", cs[1].User)
+		assert.Equal(t, "aalice", cs[2].User)
+		assert.Equal(t, "ccarol", cs[3].User)
+	})
+
+	t.Run("invalidPath", func(t *testing.T) {
+		m := &Methods{
+			Comments:     []string{"LGTM"},
+			FileComments: true,
+			CommentPaths: []string{"("},
+		}
+
+		_, err := m.Candidates(ctx, prctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestReviewCommentCandidates(t *testing.T) {
+	now := time.Now()
+
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "db/migrations/0001_init.sql", Status: pull.FileAdded},
+			{Filename: "app/server.go", Status: pull.FileModified},
+		},
+		CommentsValue: []*pull.Comment{
+			{CreatedAt: now.Add(0 * time.Minute), Body: "Signed-off-by: rrandom", Author: "rrandom"},
+		},
+		ReviewThreadsValue: []*pull.ReviewThread{
+			{
+				Path: "db/migrations/0001_init.sql",
+				Comments: []*pull.Comment{
+					{CreatedAt: now.Add(1 * time.Minute), Body: "Why this index?", Author: "bbob", Path: "db/migrations/0001_init.sql"},
+					{CreatedAt: now.Add(2 * time.Minute), Body: "Signed-off-by: aalice", Author: "aalice", Path: "db/migrations/0001_init.sql", ID: "comment-aalice"},
+				},
+			},
+			{
+				Path: "app/server.go",
+				Comments: []*pull.Comment{
+					{CreatedAt: now.Add(3 * time.Minute), Body: "signed-off-by: ccarol", Author: "ccarol", Path: "app/server.go"},
+				},
+			},
+		},
+	}
+
+	t.Run("matchesPatterns", func(t *testing.T) {
+		m := &Methods{
+			GithubReviewCommentPatterns: []string{"(?i)^signed-off-by:"},
+		}
+
+		cs, err := m.Candidates(ctx, prctx)
+		require.NoError(t, err)
+
+		sort.Sort(CandidatesByCreationTime(cs))
+
+		require.Len(t, cs, 2, "incorrect number of candidates found")
+		assert.Equal(t, "aalice", cs[0].User)
+		assert.Equal(t, "comment-aalice", cs[0].ID)
+		assert.Equal(t, "ccarol", cs[1].User)
+	})
+
+	t.Run("scopedToPaths", func(t *testing.T) {
+		m := &Methods{
+			GithubReviewCommentPatterns: []string{"(?i)^signed-off-by:"},
+			FileComments:                true,
+			CommentPaths:                []string{"^db/migrations/.*"},
+		}
+
+		cs, err := m.Candidates(ctx, prctx)
+		require.NoError(t, err)
+
+		require.Len(t, cs, 1, "incorrect number of candidates found")
+		assert.Equal(t, "aalice", cs[0].User)
+	})
+
+	t.Run("invalidPattern", func(t *testing.T) {
+		m := &Methods{
+			GithubReviewCommentPatterns: []string{"("},
+		}
+
+		_, err := m.Candidates(ctx, prctx)
+		assert.Error(t, err)
 	})
 }
 
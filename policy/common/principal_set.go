@@ -0,0 +1,56 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// PrincipalSet is a named group of users, teams, and organizations defined in
+// the server configuration. Policies reference sets by name, so the members
+// of a set can change without editing every policy that uses it.
+type PrincipalSet struct {
+	Users         []string `yaml:"users" json:"users"`
+	Teams         []string `yaml:"teams" json:"teams"`
+	Organizations []string `yaml:"organizations" json:"organizations"`
+}
+
+func (s PrincipalSet) actors() *Actors {
+	return &Actors{
+		Users:         s.Users,
+		Teams:         s.Teams,
+		Organizations: s.Organizations,
+	}
+}
+
+type principalSetsKey struct{}
+
+// WithPrincipalSets returns a context in which actors can reference the
+// given sets by name.
+func WithPrincipalSets(ctx context.Context, sets map[string]PrincipalSet) context.Context {
+	return context.WithValue(ctx, principalSetsKey{}, sets)
+}
+
+// principalSet returns the set with the given name from the context.
+func principalSet(ctx context.Context, name string) (*Actors, error) {
+	sets, _ := ctx.Value(principalSetsKey{}).(map[string]PrincipalSet)
+	s, ok := sets[name]
+	if !ok {
+		return nil, errors.Errorf("undefined principal set '%s'", name)
+	}
+	return s.actors(), nil
+}
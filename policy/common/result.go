@@ -42,7 +42,61 @@ type Result struct {
 	Description string
 	Status      EvaluationStatus
 
+	// Approvers are the users whose approval counted toward an approval rule.
+	// It is only set for rule results.
+	Approvers []string
+
+	// ApprovalSHAs maps each approver to the head commit of the pull request
+	// at the time of their approval, if known. It is only set for rule
+	// results.
+	ApprovalSHAs map[string]string
+
+	// ApprovalIDs maps each approver to the GitHub node ID of the comment or
+	// review that counted as their approval, if known. It is only set for
+	// rule results.
+	ApprovalIDs map[string]string
+
+	// RequiredCount is the number of approvals the rule requires. It is only
+	// set for pending rule results.
+	RequiredCount int
+
+	// Environments are the deployment environments affected by the pull
+	// request and their approval status. It is only set for rule results
+	// of rules that require environment approval.
+	Environments []*EnvironmentStatus
+
+	// Warnings describe approvals that counted toward the rule but may not be
+	// trustworthy, like approvals flagged by the audit log, and approvals
+	// that were ignored, like approvals by departed users.
+	Warnings []string
+
+	// RequiredRules are the rules that must be satisfied before this rule and
+	// WaitingFor are the required rules that are still pending. They are only
+	// set for rule results.
+	RequiredRules []string
+	WaitingFor    []string
+
+	// Advisory is true if the result is reported but does not contribute to
+	// the status of its parent.
+	Advisory bool
+
+	// StatusContext is the context of the commit status that reports this
+	// result, if any. It is only set for rule results.
+	StatusContext string
+
 	Error error
 
 	Children []*Result
 }
+
+// EnvironmentStatus is a deployment environment affected by a pull request.
+type EnvironmentStatus struct {
+	Name string `json:"name"`
+
+	// Files are the changed files that deploy to the environment.
+	Files []string `json:"files"`
+
+	// Approvers are the users who approved changes to the environment. It is
+	// empty if the environment is waiting for approval.
+	Approvers []string `json:"approvers,omitempty"`
+}
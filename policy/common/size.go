@@ -0,0 +1,68 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var sizePattern = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([KMG]?B?)$`)
+
+// ByteSize is a number of bytes that is parsed from YAML with ParseByteSize,
+// so values can use units, like "10MB".
+type ByteSize int64
+
+func (s *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+
+	parsed, err := ParseByteSize(str)
+	if err != nil {
+		return err
+	}
+
+	*s = ByteSize(parsed)
+	return nil
+}
+
+// ParseByteSize parses a size like "512", "64KB", "10MB", or "1.5GB". Units
+// are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	parts := sizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if parts == nil {
+		return 0, errors.Errorf("invalid size %q", s)
+	}
+
+	n, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid size %q", s)
+	}
+
+	switch strings.TrimSuffix(parts[2], "B") {
+	case "K":
+		n *= 1 << 10
+	case "M":
+		n *= 1 << 20
+	case "G":
+		n *= 1 << 30
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":   512,
+		"512B":  512,
+		"64KB":  64 << 10,
+		"10MB":  10 << 20,
+		"10 mb": 10 << 20,
+		"1.5G":  3 << 29,
+	}
+
+	for s, expected := range tests {
+		n, err := ParseByteSize(s)
+		if assert.NoError(t, err, "failed to parse %q", s) {
+			assert.Equal(t, expected, n, "incorrect size for %q", s)
+		}
+	}
+
+	_, err := ParseByteSize("10 megabytes")
+	assert.Error(t, err, "invalid size was parsed")
+}
+
+func TestByteSizeUnmarshalYAML(t *testing.T) {
+	var v struct {
+		Limit ByteSize `yaml:"limit"`
+	}
+
+	require.NoError(t, yaml.UnmarshalStrict([]byte("limit: 5MB"), &v))
+	assert.Equal(t, ByteSize(5<<20), v.Limit)
+
+	require.NoError(t, yaml.UnmarshalStrict([]byte("limit: 1024"), &v))
+	assert.Equal(t, ByteSize(1024), v.Limit)
+
+	assert.Error(t, yaml.UnmarshalStrict([]byte("limit: large"), &v))
+}
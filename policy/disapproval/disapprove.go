@@ -18,10 +18,12 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
 )
@@ -45,12 +47,19 @@ var (
 )
 
 type Policy struct {
-	Options  Options  `yaml:"options"`
-	Requires Requires `yaml:"requires"`
+	// Predicates limit disapproval to pull requests that satisfy all of the
+	// predicates. If a predicate is not satisfied, disapprovals are ignored.
+	Predicates approval.Predicates `yaml:"if"`
+	Options    Options             `yaml:"options"`
+	Requires   Requires            `yaml:"requires"`
 }
 
 type Options struct {
 	Methods Methods `yaml:"methods"`
+
+	// ChangesRequestedExpiration is how long a disapproval continues to block
+	// the pull request once the author has pushed new commits after it.
+	ChangesRequestedExpiration common.Duration `yaml:"changes_requested_expiration"`
 }
 
 type Methods struct {
@@ -58,24 +67,20 @@ type Methods struct {
 	Revoke     *common.Methods `yaml:"revoke"`
 }
 
-func (opts *Options) GetDisapproveMethods() *common.Methods {
-	m := opts.Methods.Disapprove
-	if m == nil {
-		m = &DefaultDisapproveMethods
-	}
-
-	m.GithubReviewState = pull.ReviewChangesRequested
-	return m
+// GetDisapproveMethods returns the methods for disapproval. If the policy
+// does not specify methods, it uses the defaults from the context, if any, or
+// DefaultDisapproveMethods.
+func (opts *Options) GetDisapproveMethods(ctx context.Context) *common.Methods {
+	defaults := common.DefaultMethodsFromContext(ctx)
+	return common.SelectMethods(pull.ReviewChangesRequested, opts.Methods.Disapprove, defaults.Disapprove, &DefaultDisapproveMethods)
 }
 
-func (opts *Options) GetRevokeMethods() *common.Methods {
-	m := opts.Methods.Revoke
-	if m == nil {
-		m = &DefaultRevokeMethods
-	}
-
-	m.GithubReviewState = pull.ReviewApproved
-	return m
+// GetRevokeMethods returns the methods for revoking disapproval. If the
+// policy does not specify methods, it uses the defaults from the context, if
+// any, or DefaultRevokeMethods.
+func (opts *Options) GetRevokeMethods(ctx context.Context) *common.Methods {
+	defaults := common.DefaultMethodsFromContext(ctx)
+	return common.SelectMethods(pull.ReviewApproved, opts.Methods.Revoke, defaults.Revoke, &DefaultRevokeMethods)
 }
 
 type Requires struct {
@@ -95,6 +100,24 @@ func (p *Policy) Evaluate(ctx context.Context, prctx pull.Context) (res common.R
 		return
 	}
 
+	for _, pred := range p.Predicates.Predicates() {
+		satisfied, desc, err := pred.Evaluate(ctx, prctx)
+		if err != nil {
+			res.Error = errors.Wrap(err, "failed to evaluate predicate")
+			return
+		}
+
+		if !satisfied {
+			log.Debug().Msgf("skipping disapproval, predicate of type %T was not satisfied", pred)
+
+			res.Description = desc
+			if desc == "" {
+				res.Description = "The preconditions of the disapproval policy are not satisfied"
+			}
+			return
+		}
+	}
+
 	disapproved, msg, err := p.IsDisapproved(ctx, prctx)
 	if err != nil {
 		res.Error = errors.WithMessage(err, "failed to compute disapproval status")
@@ -111,8 +134,8 @@ func (p *Policy) Evaluate(ctx context.Context, prctx pull.Context) (res common.R
 }
 
 func (p *Policy) IsDisapproved(ctx context.Context, prctx pull.Context) (disapproved bool, msg string, err error) {
-	disapproveMethods := p.Options.GetDisapproveMethods()
-	revokeMethods := p.Options.GetRevokeMethods()
+	disapproveMethods := p.Options.GetDisapproveMethods(ctx)
+	revokeMethods := p.Options.GetRevokeMethods(ctx)
 
 	disapprover, err := p.lastActor(ctx, prctx, disapproveMethods, "disapproval")
 	if err != nil {
@@ -145,9 +168,57 @@ func (p *Policy) IsDisapproved(ctx context.Context, prctx pull.Context) (disappr
 	default:
 		msg = fmt.Sprintf("Disapproval revoked by %s", revoker.User)
 	}
+
+	if disapproved && p.Options.ChangesRequestedExpiration > 0 {
+		return p.checkExpiration(ctx, prctx, disapprover)
+	}
 	return
 }
 
+// checkExpiration determines if a standing disapproval has expired because
+// the author pushed new commits and the disapprover did not respond within
+// the configured expiration.
+func (p *Policy) checkExpiration(ctx context.Context, prctx pull.Context, disapprover *common.Candidate) (bool, string, error) {
+	commits, err := prctx.Commits(ctx)
+	if err != nil {
+		return false, "", errors.WithMessage(err, "failed to list commits")
+	}
+
+	var pushedAt time.Time
+	for _, c := range commits {
+		if c.CreatedAt.After(disapprover.CreatedAt) && (pushedAt.IsZero() || c.CreatedAt.Before(pushedAt)) {
+			pushedAt = c.CreatedAt
+		}
+	}
+
+	// the disapproval stands until the author pushes changes
+	if pushedAt.IsZero() {
+		return true, fmt.Sprintf("Disapproved by %s", disapprover.User), nil
+	}
+
+	expiresAt := pushedAt.Add(p.Options.ChangesRequestedExpiration.Duration())
+	remaining := time.Until(expiresAt)
+	if remaining <= 0 {
+		zerolog.Ctx(ctx).Debug().Msgf("disapproval by %s expired at %s", disapprover.User, expiresAt.Format(time.RFC3339))
+		return false, fmt.Sprintf("Disapproval by %s expired after new commits", disapprover.User), nil
+	}
+
+	return true, fmt.Sprintf("Disapproved by %s (expires in %s)", disapprover.User, formatRemaining(remaining)), nil
+}
+
+func formatRemaining(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d/time.Hour))
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%d minutes", int(d/time.Minute))
+	default:
+		return "less than 2 minutes"
+	}
+}
+
 func (p *Policy) lastActor(ctx context.Context, prctx pull.Context, methods *common.Methods, kind string) (*common.Candidate, error) {
 	log := zerolog.Ctx(ctx)
 
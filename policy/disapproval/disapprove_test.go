@@ -24,6 +24,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
 )
@@ -147,6 +150,111 @@ func TestIsDisapproved(t *testing.T) {
 	})
 }
 
+func TestDisapprovalPredicates(t *testing.T) {
+	logger := zerolog.New(os.Stdout)
+	ctx := logger.WithContext(context.Background())
+
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "app/main.go"},
+		},
+		CommentsValue: []*pull.Comment{
+			{
+				Author:    "disapprover-1",
+				Body:      "me no like :-1:",
+				CreatedAt: date(0),
+			},
+		},
+	}
+
+	p := &Policy{
+		Predicates: approval.Predicates{
+			ChangedFiles: &predicate.ChangedFiles{
+				Paths: []string{"^config/.*$"},
+			},
+		},
+	}
+	p.Requires.Users = []string{"disapprover-1"}
+
+	res := p.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusSkipped, res.Status)
+	assert.Equal(t, "No changed files match the required patterns", res.Description)
+
+	prctx.ChangedFilesValue = append(prctx.ChangedFilesValue, &pull.File{Filename: "config/prod.yml"})
+
+	res = p.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusDisapproved, res.Status)
+	assert.Equal(t, "Disapproved by disapprover-1", res.Description)
+}
+
 func date(hour int) time.Time {
 	return time.Date(2018, 6, 29, hour, 0, 0, 0, time.UTC)
 }
+
+func TestChangesRequestedExpiration(t *testing.T) {
+	logger := zerolog.New(os.Stdout)
+	ctx := logger.WithContext(context.Background())
+
+	now := time.Now()
+	newContext := func(pushedAt time.Time) pull.Context {
+		prctx := &pulltest.Context{
+			ReviewsValue: []*pull.Review{
+				{
+					Author:    "disapprover-1",
+					State:     pull.ReviewChangesRequested,
+					CreatedAt: now.Add(-10 * 24 * time.Hour),
+				},
+			},
+			CommitsValue: []*pull.Commit{
+				{
+					SHA:       "c1",
+					CreatedAt: now.Add(-11 * 24 * time.Hour),
+				},
+			},
+		}
+		if !pushedAt.IsZero() {
+			prctx.CommitsValue = append(prctx.CommitsValue, &pull.Commit{
+				SHA:       "c2",
+				CreatedAt: pushedAt,
+			})
+		}
+		return prctx
+	}
+
+	p := &Policy{}
+	p.Requires.Users = []string{"disapprover-1"}
+	p.Options.ChangesRequestedExpiration = common.Duration(7 * 24 * time.Hour)
+
+	t.Run("noPushAfterDisapproval", func(t *testing.T) {
+		disapproved, msg, err := p.IsDisapproved(ctx, newContext(time.Time{}))
+		require.NoError(t, err)
+		assert.True(t, disapproved)
+		assert.Equal(t, "Disapproved by disapprover-1", msg)
+	})
+
+	t.Run("expiresSoon", func(t *testing.T) {
+		disapproved, msg, err := p.IsDisapproved(ctx, newContext(now.Add(-4*24*time.Hour-time.Hour)))
+		require.NoError(t, err)
+		assert.True(t, disapproved)
+		assert.Equal(t, "Disapproved by disapprover-1 (expires in 2 days)", msg)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		disapproved, msg, err := p.IsDisapproved(ctx, newContext(now.Add(-8*24*time.Hour)))
+		require.NoError(t, err)
+		assert.False(t, disapproved)
+		assert.Equal(t, "Disapproval by disapprover-1 expired after new commits", msg)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p := &Policy{}
+		p.Requires.Users = []string{"disapprover-1"}
+
+		disapproved, msg, err := p.IsDisapproved(ctx, newContext(now.Add(-8*24*time.Hour)))
+		require.NoError(t, err)
+		assert.True(t, disapproved)
+		assert.Equal(t, "Disapproved by disapprover-1", msg)
+	})
+}
@@ -0,0 +1,220 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy/approval"
+)
+
+// uninheritedRuleFields are the fields of a rule that identify it and are
+// never copied from the rule it extends.
+var uninheritedRuleFields = []string{"name", "extends", "status_context"}
+
+// builtinRules are rule templates that any rule can extend by name, unless
+// the policy defines a rule with the same name.
+var builtinRules = map[string]string{
+	// require approval from a CI administrator for changes to GitHub
+	// Actions workflows, which can expose repository secrets
+	"builtin:workflow-changes": `
+if:
+  changed_workflows: true
+requires:
+  count: 1
+  ci_admins: true
+options:
+  invalidate_on_push: true
+`,
+}
+
+// UnmarshalYAML decodes a policy and resolves approval rules that extend
+// other rules. An extending rule starts from the fields of the rule it
+// extends, except its name and status context. Each field the extending rule
+// sets replaces the inherited field, except mappings like "if", "options",
+// and "requires", which are merged key by key with the same rules. Lists are
+// always replaced, and a null value removes the inherited field.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	extends := false
+	for _, r := range c.ApprovalRules {
+		if r.Extends != "" {
+			extends = true
+			break
+		}
+	}
+	if !extends {
+		return nil
+	}
+
+	// decode the rules again without types to merge the fields they set
+	var raw map[string]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(raw["approval_rules"])
+	if err != nil {
+		return errors.Wrap(err, "failed to encode approval rules")
+	}
+	var rawRules []map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &rawRules); err != nil {
+		return errors.Wrap(err, "failed to decode approval rules")
+	}
+
+	rules, err := resolveExtends(c.ApprovalRules, rawRules)
+	if err != nil {
+		return err
+	}
+	c.ApprovalRules = rules
+	return nil
+}
+
+// resolveExtends returns the rules with the fields of the rules they extend.
+// The raw rules must be the undecoded form of the rules, in the same order.
+func resolveExtends(rules []*approval.Rule, raw []map[interface{}]interface{}) ([]*approval.Rule, error) {
+	if len(rules) != len(raw) {
+		return nil, errors.New("failed to resolve rule extensions: rule count mismatch")
+	}
+
+	byName := make(map[string]int, len(rules))
+	for i, r := range rules {
+		byName[r.Name] = i
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	resolved := make(map[string]map[interface{}]interface{})
+
+	var resolve func(name string, path []string) (map[interface{}]interface{}, error)
+	resolve = func(name string, path []string) (map[interface{}]interface{}, error) {
+		switch state[name] {
+		case visiting:
+			return nil, errors.Errorf("rule extensions contain a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return resolved[name], nil
+		}
+
+		state[name] = visiting
+		rule := rules[byName[name]]
+		fields := raw[byName[name]]
+
+		if parentName := rule.Extends; parentName != "" {
+			var parent map[interface{}]interface{}
+			var err error
+			if _, ok := byName[parentName]; ok {
+				parent, err = resolve(parentName, append(path, name))
+			} else if template, ok := builtinRules[parentName]; ok {
+				parent, err = decodeBuiltinRule(parentName, template)
+			} else {
+				err = errors.Errorf("rule '%s' extends undefined rule '%s'", name, parentName)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			inherited := copyYAMLMap(parent)
+			for _, f := range uninheritedRuleFields {
+				delete(inherited, f)
+			}
+			fields = mergeYAMLMaps(inherited, fields)
+		}
+
+		state[name] = visited
+		resolved[name] = fields
+		return fields, nil
+	}
+
+	// visit rules in a fixed order so that errors are deterministic
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	merged := make([]*approval.Rule, len(rules))
+	for i, r := range rules {
+		if r.Extends == "" {
+			merged[i] = r
+			continue
+		}
+
+		data, err := yaml.Marshal(resolved[r.Name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode rule '%s'", r.Name)
+		}
+
+		var rule approval.Rule
+		if err := yaml.UnmarshalStrict(data, &rule); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("invalid rule '%s' after applying extends", r.Name))
+		}
+		merged[i] = &rule
+	}
+	return merged, nil
+}
+
+func decodeBuiltinRule(name, template string) (map[interface{}]interface{}, error) {
+	var fields map[interface{}]interface{}
+	if err := yaml.Unmarshal([]byte(template), &fields); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode built-in rule '%s'", name)
+	}
+	return fields, nil
+}
+
+// mergeYAMLMaps returns the fields of base with the fields of override. If
+// both contain a mapping for a key, the mappings are merged recursively.
+// Otherwise, the value in override wins.
+func mergeYAMLMaps(base, override map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := copyYAMLMap(base)
+	for k, v := range override {
+		baseMap, baseOK := merged[k].(map[interface{}]interface{})
+		overrideMap, overrideOK := v.(map[interface{}]interface{})
+		if baseOK && overrideOK {
+			merged[k] = mergeYAMLMaps(baseMap, overrideMap)
+			continue
+		}
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+func copyYAMLMap(m map[interface{}]interface{}) map[interface{}]interface{} {
+	c := make(map[interface{}]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
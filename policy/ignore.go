@@ -0,0 +1,105 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/palantir/policy-bot/pull"
+)
+
+func parseIgnorePaths(paths []string) ([]*regexp.Regexp, error) {
+	var ignored []*regexp.Regexp
+	for _, p := range paths {
+		re, err := predicate.GlobToRegexp(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse ignore_paths pattern %q", p)
+		}
+		ignored = append(ignored, re)
+	}
+	return ignored, nil
+}
+
+// IgnoringPaths returns a context that hides the changed files matching the
+// ignore_paths patterns of the policy. It returns the context unchanged if
+// the policy does not ignore any paths.
+func IgnoringPaths(prctx pull.Context, config *Config) (pull.Context, error) {
+	ignored, err := parseIgnorePaths(config.IgnorePaths)
+	if err != nil {
+		return nil, err
+	}
+	return ignoringPaths(prctx, ignored), nil
+}
+
+func ignoringPaths(prctx pull.Context, ignored []*regexp.Regexp) pull.Context {
+	if len(ignored) == 0 {
+		return prctx
+	}
+	return &ignoredPathsContext{Context: prctx, ignored: ignored}
+}
+
+// ignoredPathsContext is a pull.Context in which the changed files do not
+// include files that match an ignored pattern. A renamed file is ignored only
+// if both its current and previous paths match.
+type ignoredPathsContext struct {
+	pull.Context
+	ignored []*regexp.Regexp
+}
+
+func (c *ignoredPathsContext) ChangedFiles(ctx context.Context) ([]*pull.File, error) {
+	files, err := c.Context.ChangedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []*pull.File
+	for _, f := range files {
+		if !c.isIgnored(f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
+
+func (c *ignoredPathsContext) ChangedFilesIter(ctx context.Context, fn func(*pull.File) bool) error {
+	return c.Context.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if c.isIgnored(f) {
+			return true
+		}
+		return fn(f)
+	})
+}
+
+func (c *ignoredPathsContext) isIgnored(f *pull.File) bool {
+	for _, path := range f.Paths() {
+		if !c.matches(path) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ignoredPathsContext) matches(path string) bool {
+	for _, re := range c.ignored {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package override
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	// MinCount is the smallest number of distinct users who must approve an
+	// override. A single user may never override a policy.
+	MinCount = 2
+
+	DefaultWindow = 24 * time.Hour
+)
+
+var DefaultMethods = common.Methods{
+	Comments: []string{
+		"!override",
+	},
+}
+
+// Policy allows a group of administrators to bypass the rest of the policy
+// in an emergency. An override requires approval from at least MinCount
+// distinct users within a time window. The author and contributors of the
+// pull request never count, and approvals given before the last push are
+// ignored.
+type Policy struct {
+	Options  Options  `yaml:"options"`
+	Requires Requires `yaml:"requires"`
+}
+
+type Options struct {
+	// Methods are the actions that approve an override. If unset,
+	// DefaultMethods is used.
+	Methods *common.Methods `yaml:"methods"`
+
+	// Window is the longest time between the first and last approval of an
+	// override. If unset, DefaultWindow is used.
+	Window common.Duration `yaml:"window"`
+}
+
+type Requires struct {
+	// Count is the number of distinct users who must approve an override.
+	// If unset, MinCount is used.
+	Count int `yaml:"count"`
+
+	common.Actors `yaml:",inline"`
+}
+
+// Validate returns an error if the policy would allow fewer than MinCount
+// users to override.
+func (p *Policy) Validate() error {
+	if p.Requires.Count != 0 && p.Requires.Count < MinCount {
+		return errors.Errorf("override requires a count of at least %d", MinCount)
+	}
+	if p.Requires.IsEmpty() {
+		return errors.New("override must list the users who may approve it")
+	}
+	return nil
+}
+
+func (p *Policy) methods() *common.Methods {
+	return common.SelectMethods(pull.ReviewApproved, p.Options.Methods, &DefaultMethods)
+}
+
+func (p *Policy) count() int {
+	if p.Requires.Count < MinCount {
+		return MinCount
+	}
+	return p.Requires.Count
+}
+
+func (p *Policy) window() time.Duration {
+	if p.Options.Window > 0 {
+		return p.Options.Window.Duration()
+	}
+	return DefaultWindow
+}
+
+func (p *Policy) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
+	res.Name = "override"
+	res.Status = common.StatusSkipped
+
+	approvers, err := p.Approvers(ctx, prctx)
+	if err != nil {
+		res.Error = errors.WithMessage(err, "failed to compute override status")
+		return
+	}
+
+	if approvers == nil {
+		res.Description = "Not overridden"
+		return
+	}
+
+	res.Status = common.StatusApproved
+	res.Approvers = approvers
+	res.Description = fmt.Sprintf("Overridden by %s", strings.Join(approvers, " and "))
+	return
+}
+
+// Approvers returns the users who approved an override of the policy, or nil
+// if the policy is not overridden.
+func (p *Policy) Approvers(ctx context.Context, prctx pull.Context) ([]string, error) {
+	log := zerolog.Ctx(ctx)
+
+	candidates, err := p.methods().Candidates(ctx, prctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get override candidates")
+	}
+
+	candidates, err = p.filter(ctx, prctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(common.CandidatesByCreationTime(candidates))
+
+	log.Debug().Msgf("found %d valid override candidates", len(candidates))
+
+	// candidates are unique by user, so any group of count candidates within
+	// the window is a valid override
+	count, window := p.count(), p.window()
+	for i := 0; i+count <= len(candidates); i++ {
+		first, last := candidates[i], candidates[i+count-1]
+		if last.CreatedAt.Sub(first.CreatedAt) <= window {
+			var users []string
+			for _, c := range candidates[i : i+count] {
+				users = append(users, c.User)
+			}
+			return users, nil
+		}
+	}
+	return nil, nil
+}
+
+// filter removes candidates who are not allowed to override, who contributed
+// to the pull request, or whose approval is older than the last push.
+func (p *Policy) filter(ctx context.Context, prctx pull.Context, candidates []*common.Candidate) ([]*common.Candidate, error) {
+	log := zerolog.Ctx(ctx)
+
+	author, err := prctx.Author(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get pull request author")
+	}
+
+	commits, err := prctx.Commits(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list commits")
+	}
+
+	banned := map[string]bool{author: true}
+	var pushedAt time.Time
+	for _, c := range commits {
+		for _, u := range c.Users() {
+			banned[u] = true
+		}
+		if c.CreatedAt.After(pushedAt) {
+			pushedAt = c.CreatedAt
+		}
+	}
+
+	var filtered []*common.Candidate
+	for _, c := range candidates {
+		if banned[c.User] {
+			log.Debug().Str("user", c.User).Msg("ignoring override by the author or a contributor")
+			continue
+		}
+		if !c.CreatedAt.After(pushedAt) {
+			log.Debug().Str("user", c.User).Msg("ignoring override approved before the last push")
+			continue
+		}
+
+		ok, err := p.Requires.IsActor(ctx, prctx, c.User)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to check candidate status")
+		}
+		if !ok {
+			log.Debug().Str("user", c.User).Msg("ignoring override by non-whitelisted user")
+			continue
+		}
+
+		filtered = append(filtered, c)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package override
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestEvaluate(t *testing.T) {
+	logger := zerolog.New(os.Stdout)
+	ctx := logger.WithContext(context.Background())
+
+	newContext := func() *pulltest.Context {
+		return &pulltest.Context{
+			AuthorValue: "author",
+			CommitsValue: []*pull.Commit{
+				{SHA: "a", Author: "author", CreatedAt: date(0)},
+				{SHA: "b", Author: "contributor", CreatedAt: date(1)},
+			},
+			CommentsValue: []*pull.Comment{
+				{Author: "admin-1", Body: "!override", CreatedAt: date(2)},
+				{Author: "author", Body: "!override", CreatedAt: date(3)},
+				{Author: "contributor", Body: "!override", CreatedAt: date(3)},
+				{Author: "admin-2", Body: "!override", CreatedAt: date(27)},
+				{Author: "admin-3", Body: "!override", CreatedAt: date(28)},
+			},
+		}
+	}
+
+	admins := common.Actors{Users: []string{"admin-1", "admin-2", "admin-3", "author", "contributor"}}
+
+	t.Run("approved", func(t *testing.T) {
+		p := &Policy{Requires: Requires{Actors: admins}}
+
+		r := p.Evaluate(ctx, newContext())
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusApproved, r.Status)
+		assert.Equal(t, "Overridden by admin-2 and admin-3", r.Description)
+		assert.Equal(t, []string{"admin-2", "admin-3"}, r.Approvers)
+	})
+
+	t.Run("outsideWindow", func(t *testing.T) {
+		p := &Policy{
+			Requires: Requires{Actors: admins},
+			Options:  Options{Window: common.Duration(30 * time.Minute)},
+		}
+
+		r := p.Evaluate(ctx, newContext())
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusSkipped, r.Status)
+		assert.Equal(t, "Not overridden", r.Description)
+	})
+
+	t.Run("countAboveMinimum", func(t *testing.T) {
+		p := &Policy{
+			Requires: Requires{Count: 3, Actors: admins},
+			Options:  Options{Window: common.Duration(48 * time.Hour)},
+		}
+
+		r := p.Evaluate(ctx, newContext())
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusApproved, r.Status)
+		assert.Equal(t, []string{"admin-1", "admin-2", "admin-3"}, r.Approvers)
+	})
+
+	t.Run("ignoresApprovalsBeforePush", func(t *testing.T) {
+		prctx := newContext()
+		prctx.CommitsValue = append(prctx.CommitsValue, &pull.Commit{SHA: "c", Author: "author", CreatedAt: date(27)})
+
+		p := &Policy{Requires: Requires{Actors: admins}}
+
+		r := p.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusSkipped, r.Status)
+	})
+
+	t.Run("ignoresUnlistedUsers", func(t *testing.T) {
+		p := &Policy{Requires: Requires{Actors: common.Actors{Users: []string{"admin-2"}}}}
+
+		r := p.Evaluate(ctx, newContext())
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusSkipped, r.Status)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	admins := common.Actors{Users: []string{"admin-1", "admin-2"}}
+
+	assert.NoError(t, (&Policy{Requires: Requires{Actors: admins}}).Validate())
+	assert.NoError(t, (&Policy{Requires: Requires{Count: 2, Actors: admins}}).Validate())
+	assert.EqualError(t, (&Policy{Requires: Requires{Count: 1, Actors: admins}}).Validate(), "override requires a count of at least 2")
+	assert.EqualError(t, (&Policy{}).Validate(), "override must list the users who may approve it")
+}
+
+func date(hour int) time.Time {
+	return time.Date(2020, 1, 1, hour, 0, 0, 0, time.UTC)
+}
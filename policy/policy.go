@@ -16,12 +16,14 @@ package policy
 
 import (
 	"context"
+	"regexp"
 
 	"github.com/pkg/errors"
 
 	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/policy/disapproval"
+	"github.com/palantir/policy-bot/policy/override"
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -38,11 +40,20 @@ type RemoteConfig struct {
 type Config struct {
 	Policy        Policy           `yaml:"policy"`
 	ApprovalRules []*approval.Rule `yaml:"approval_rules"`
+
+	// IgnorePaths are .gitattributes-style patterns for files that are
+	// removed from the changed files before any rule is evaluated, so that
+	// trivial changes like documentation do not trigger rules.
+	IgnorePaths []string `yaml:"ignore_paths"`
 }
 
 type Policy struct {
 	Approval    approval.Policy     `yaml:"approval"`
 	Disapproval *disapproval.Policy `yaml:"disapproval"`
+
+	// Override allows a group of administrators to approve a pull request
+	// regardless of the approval and disapproval policies.
+	Override *override.Policy `yaml:"override"`
 }
 
 func ParsePolicy(c *Config) (common.Evaluator, error) {
@@ -56,29 +67,54 @@ func ParsePolicy(c *Config) (common.Evaluator, error) {
 		return nil, errors.WithMessage(err, "failed to parse approval policy")
 	}
 
+	ignored, err := parseIgnorePaths(c.IgnorePaths)
+	if err != nil {
+		return nil, err
+	}
+
 	evalDisapproval := c.Policy.Disapproval
 	if evalDisapproval == nil {
 		evalDisapproval = &disapproval.Policy{}
 	}
 
-	return evaluator{
+	eval := evaluator{
 		approval:    evalApproval,
 		disapproval: evalDisapproval,
-	}, nil
+		ignored:     ignored,
+	}
+
+	if c.Policy.Override != nil {
+		if err := c.Policy.Override.Validate(); err != nil {
+			return nil, errors.WithMessage(err, "failed to parse override policy")
+		}
+		eval.override = c.Policy.Override
+	}
+
+	return eval, nil
 }
 
 type evaluator struct {
 	approval    common.Evaluator
 	disapproval common.Evaluator
+	override    common.Evaluator
+	ignored     []*regexp.Regexp
 }
 
 func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
+	prctx = ignoringPaths(prctx, e.ignored)
+
 	disapproval := e.disapproval.Evaluate(ctx, prctx)
 	approval := e.approval.Evaluate(ctx, prctx)
 
 	res.Name = "policy"
 	res.Children = []*common.Result{&approval, &disapproval}
 
+	var override common.Result
+	if e.override != nil {
+		override = e.override.Evaluate(ctx, prctx)
+		res.Children = append(res.Children, &override)
+	}
+
 	for _, r := range res.Children {
 		if r.Error != nil {
 			res.Error = r.Error
@@ -87,6 +123,9 @@ func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common
 
 	switch {
 	case res.Error != nil:
+	case override.Status == common.StatusApproved:
+		res.Status = common.StatusApproved
+		res.Description = override.Description
 	case disapproval.Status == common.StatusDisapproved:
 		res.Status = common.StatusDisapproved
 		res.Description = disapproval.Description
@@ -96,3 +135,32 @@ func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common
 	}
 	return
 }
+
+// TriggeredBy returns true if events that change the given source of data,
+// one of the approval.Trigger constants, may change the result of the
+// policy. Disapproval and override policies depend on comments and reviews.
+// The predicates of a disapproval policy may read any source, so a
+// disapproval policy with predicates depends on every source, like a rule
+// without triggers.
+func (c *Config) TriggeredBy(source string) bool {
+	for _, r := range c.ApprovalRules {
+		if r.TriggeredBy(source) {
+			return true
+		}
+	}
+
+	if d := c.Policy.Disapproval; d != nil && !d.Requires.IsEmpty() {
+		if len(d.Predicates.Predicates()) > 0 {
+			return true
+		}
+		if source == approval.TriggerComments || source == approval.TriggerReviews {
+			return true
+		}
+	}
+	if c.Policy.Override != nil {
+		if source == approval.TriggerComments || source == approval.TriggerReviews {
+			return true
+		}
+	}
+	return false
+}
@@ -22,7 +22,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/disapproval"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
 )
@@ -73,6 +76,28 @@ func TestEvaluator(t *testing.T) {
 		assert.Equal(t, "2 approvals needed", r.Description)
 	})
 
+	t.Run("overrideWins", func(t *testing.T) {
+		eval := evaluator{
+			approval: &StaticEvaluator{
+				Status: common.StatusPending,
+			},
+			disapproval: &StaticEvaluator{
+				Status: common.StatusDisapproved,
+			},
+			override: &StaticEvaluator{
+				Status:      common.StatusApproved,
+				Description: "Overridden by admin-1 and admin-2",
+			},
+		}
+
+		r := eval.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusApproved, r.Status)
+		assert.Equal(t, "Overridden by admin-1 and admin-2", r.Description)
+		assert.Len(t, r.Children, 3)
+	})
+
 	t.Run("propagateError", func(t *testing.T) {
 		eval := evaluator{
 			approval: &StaticEvaluator{
@@ -113,3 +138,142 @@ func TestEvaluator(t *testing.T) {
 func castToResult(e common.Evaluator) *common.Result {
 	return (*common.Result)(e.(*StaticEvaluator))
 }
+
+func TestIgnoringPaths(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "README.md", Status: pull.FileModified},
+			{Filename: "vendor/github.com/pkg/errors/errors.go", Status: pull.FileAdded},
+			{Filename: "docs/guide.md", PreviousFilename: "guide.txt", Status: pull.FileModified},
+			{Filename: "server/server.go", Status: pull.FileModified},
+		},
+	}
+
+	t.Run("noPatterns", func(t *testing.T) {
+		filtered, err := IgnoringPaths(prctx, &Config{})
+		require.NoError(t, err)
+		assert.Equal(t, prctx, filtered)
+	})
+
+	t.Run("filtersFiles", func(t *testing.T) {
+		filtered, err := IgnoringPaths(prctx, &Config{IgnorePaths: []string{"*.md", "vendor/**"}})
+		require.NoError(t, err)
+
+		files, err := filtered.ChangedFiles(ctx)
+		require.NoError(t, err)
+
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Filename)
+		}
+		assert.Equal(t, []string{"docs/guide.md", "server/server.go"}, names)
+
+		var iterNames []string
+		err = filtered.ChangedFilesIter(ctx, func(f *pull.File) bool {
+			iterNames = append(iterNames, f.Filename)
+			return true
+		})
+		require.NoError(t, err)
+		assert.Equal(t, names, iterNames)
+	})
+
+	t.Run("invalidPattern", func(t *testing.T) {
+		_, err := IgnoringPaths(prctx, &Config{IgnorePaths: []string{"docs/"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestDirectories(t *testing.T) {
+	files := []*pull.File{
+		{Filename: "README.md", Status: pull.FileModified},
+		{Filename: "services/payments/api/handler.go", Status: pull.FileModified},
+		{Filename: "services/ledger/main.go", PreviousFilename: "services/payments/ledger.go", Status: pull.FileModified},
+		{Filename: "docs/guide.md", Status: pull.FileAdded},
+	}
+
+	assert.Equal(t, []string{"docs", "services"}, Directories(files, 1))
+	assert.Equal(t, []string{"services/ledger", "services/payments"}, Directories(files, 2))
+	assert.Equal(t, []string{"services/payments/api"}, Directories(files, 3))
+	assert.Empty(t, Directories(nil, 1))
+}
+
+func TestScopeToDirectory(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "README.md", Status: pull.FileModified},
+			{Filename: "services/payments/api/handler.go", Status: pull.FileModified},
+			{Filename: "services/ledger/main.go", PreviousFilename: "services/payments/ledger.go", Status: pull.FileModified},
+			{Filename: "services/payments-v2/main.go", Status: pull.FileAdded},
+		},
+	}
+
+	scoped := ScopeToDirectory(prctx, "services/payments")
+
+	files, err := scoped.ChangedFiles(ctx)
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Filename)
+	}
+	assert.Equal(t, []string{"services/payments/api/handler.go", "services/ledger/main.go"}, names)
+
+	var iterNames []string
+	err = scoped.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		iterNames = append(iterNames, f.Filename)
+		return true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, names, iterNames)
+}
+
+func TestConfigTriggeredBy(t *testing.T) {
+	config := &Config{
+		ApprovalRules: []*approval.Rule{
+			{Name: "files only", Triggers: []string{approval.TriggerFiles}},
+			{Name: "reviews", Triggers: []string{approval.TriggerFiles, approval.TriggerReviews}},
+		},
+	}
+
+	assert.True(t, config.TriggeredBy(approval.TriggerFiles))
+	assert.True(t, config.TriggeredBy(approval.TriggerReviews))
+	assert.False(t, config.TriggeredBy(approval.TriggerComments))
+	assert.False(t, config.TriggeredBy(approval.TriggerStatuses))
+
+	config.Policy.Disapproval = &disapproval.Policy{
+		Requires: disapproval.Requires{Actors: common.Actors{Users: []string{"mhaypenny"}}},
+	}
+	assert.True(t, config.TriggeredBy(approval.TriggerComments))
+	assert.False(t, config.TriggeredBy(approval.TriggerStatuses))
+
+	config.ApprovalRules = append(config.ApprovalRules, &approval.Rule{Name: "everything"})
+	assert.True(t, config.TriggeredBy(approval.TriggerStatuses))
+}
+
+func TestConfigTriggeredByDisapproval(t *testing.T) {
+	config := &Config{
+		ApprovalRules: []*approval.Rule{
+			{Name: "reviews only", Triggers: []string{approval.TriggerReviews}},
+		},
+		Policy: Policy{
+			Disapproval: &disapproval.Policy{
+				Predicates: approval.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{},
+				},
+			},
+		},
+	}
+
+	assert.False(t, config.TriggeredBy(approval.TriggerFiles), "disapproval without allowed users should not trigger evaluation")
+
+	config.Policy.Disapproval.Requires = disapproval.Requires{Actors: common.Actors{Users: []string{"mhaypenny"}}}
+	assert.True(t, config.TriggeredBy(approval.TriggerFiles), "disapproval predicates should trigger evaluation")
+	assert.True(t, config.TriggeredBy(approval.TriggerStatuses), "disapproval predicates should trigger evaluation")
+	assert.True(t, config.TriggeredBy(approval.TriggerComments))
+
+	config.Policy.Disapproval.Predicates = approval.Predicates{}
+	assert.False(t, config.TriggeredBy(approval.TriggerFiles))
+	assert.True(t, config.TriggeredBy(approval.TriggerComments), "disapproval should trigger evaluation on comments")
+}
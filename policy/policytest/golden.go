@@ -0,0 +1,88 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policytest provides helpers for testing policies, like comparing
+// evaluation results to golden files.
+package policytest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// UpdateGoldenEnv is the environment variable that, if set to "true", makes
+// AssertGolden write the actual result to the golden file instead of
+// comparing against it.
+const UpdateGoldenEnv = "POLICYTEST_UPDATE_GOLDEN"
+
+// FormatResult formats a result tree as indented text, one line per result,
+// in a stable format suitable for snapshots.
+func FormatResult(res *common.Result) string {
+	var b strings.Builder
+	formatResultR(&b, res, 0)
+	return b.String()
+}
+
+func formatResultR(b *strings.Builder, res *common.Result, depth int) {
+	status := res.Status.String()
+	desc := res.Description
+	if res.Error != nil {
+		status = "error"
+		desc = res.Error.Error()
+	}
+
+	fmt.Fprintf(b, "%s%s: %s", strings.Repeat("  ", depth), res.Name, status)
+	if desc != "" {
+		fmt.Fprintf(b, " (%s)", desc)
+	}
+	b.WriteString("\n")
+
+	for _, c := range res.Children {
+		formatResultR(b, c, depth+1)
+	}
+}
+
+// AssertGolden fails the test if the formatted result does not match the
+// content of the golden file. Set the POLICYTEST_UPDATE_GOLDEN environment
+// variable to "true" to create or update golden files.
+func AssertGolden(t testing.TB, path string, res *common.Result) {
+	t.Helper()
+
+	actual := FormatResult(res)
+
+	if os.Getenv(UpdateGoldenEnv) == "true" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create golden file directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (set %s=true to create it): %v", UpdateGoldenEnv, err)
+	}
+
+	if actual != string(expected) {
+		t.Errorf("result does not match golden file %s\n--- expected\n%s--- actual\n%s", path, expected, actual)
+	}
+}
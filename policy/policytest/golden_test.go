@@ -0,0 +1,62 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+const testPolicy = `
+policy:
+  approval:
+    - or:
+      - docs only
+      - code review
+approval_rules:
+  - name: docs only
+    if:
+      only_changed_files:
+        paths: ["^docs/.*$"]
+  - name: code review
+    requires:
+      count: 1
+      teams: ["org/reviewers"]
+`
+
+func TestAssertGolden(t *testing.T) {
+	var config policy.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(testPolicy), &config))
+
+	evaluator, err := policy.ParsePolicy(&config)
+	require.NoError(t, err)
+
+	prctx := pulltest.New().
+		WithAuthor("mhaypenny").
+		WithFiles(&pull.File{Filename: "app/main.go"}).
+		WithComments(&pull.Comment{Author: "ttest", Body: ":+1:"}).
+		WithTeams("ttest", "org/reviewers").
+		Build()
+
+	res := evaluator.Evaluate(context.Background(), prctx)
+	AssertGolden(t, "testdata/approved.golden", &res)
+}
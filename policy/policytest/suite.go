@@ -0,0 +1,375 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policytest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+// DefaultSuiteFile is the conventional name of a policy test suite.
+const DefaultSuiteFile = ".policy_test.yml"
+
+// DefaultPolicyFile is the policy tested by a suite that does not set a path.
+const DefaultPolicyFile = ".policy.yml"
+
+// eventInterval is the time between consecutive events of a test case that do
+// not set an explicit time.
+const eventInterval = time.Minute
+
+// Suite is a set of hypothetical pull requests and the results a policy is
+// expected to produce for them.
+type Suite struct {
+	// Policy is the path to the policy file, relative to the suite file.
+	Policy string `yaml:"policy"`
+	Cases  []Case `yaml:"cases"`
+}
+
+// Case is a single pull request and its expected evaluation result.
+type Case struct {
+	Name        string      `yaml:"name"`
+	PullRequest PullRequest `yaml:"pull_request"`
+	Expect      Expectation `yaml:"expect"`
+}
+
+// PullRequest describes a hypothetical pull request. Events without an
+// explicit time occur one minute apart in the order commits, comments, and
+// reviews, starting one minute after the pull request is opened.
+type PullRequest struct {
+	Author     string `yaml:"author"`
+	Title      string `yaml:"title"`
+	Body       string `yaml:"body"`
+	BaseBranch string `yaml:"base_branch"`
+	HeadBranch string `yaml:"head_branch"`
+
+	Files    []File    `yaml:"files"`
+	Commits  []Commit  `yaml:"commits"`
+	Comments []Comment `yaml:"comments"`
+	Reviews  []Review  `yaml:"reviews"`
+
+	// BaseFiles maps paths to the content of files on the base branch, like
+	// the owners files used by "owners_files" requirements.
+	BaseFiles map[string]string `yaml:"base_files"`
+
+	// Threads are review conversations on the pull request.
+	Threads []Thread `yaml:"threads"`
+
+	// Teams, Organizations, and Collaborators map users to their team
+	// memberships (as "org/team"), organizations, and repository permissions.
+	Teams         map[string][]string `yaml:"teams"`
+	Organizations map[string][]string `yaml:"organizations"`
+	Collaborators map[string][]string `yaml:"collaborators"`
+}
+
+// File is a file changed by a hypothetical pull request. Status is one of
+// "added", "modified" (the default), or "deleted". PreviousFilename is set
+// for renamed files.
+type File struct {
+	Filename         string `yaml:"filename"`
+	PreviousFilename string `yaml:"previous_filename"`
+	Status           string `yaml:"status"`
+	Additions        int    `yaml:"additions"`
+	Deletions        int    `yaml:"deletions"`
+
+	// Size, Binary, and LFS describe the contents of the file at the head of
+	// the pull request, for the "changed_file_contents" predicate.
+	Size   common.ByteSize `yaml:"size"`
+	Binary bool            `yaml:"binary"`
+	LFS    bool            `yaml:"lfs"`
+}
+
+// Commit is a commit in a hypothetical pull request. The author and committer
+// default to the author of the pull request.
+type Commit struct {
+	SHA       string `yaml:"sha"`
+	Author    string `yaml:"author"`
+	Committer string `yaml:"committer"`
+
+	// AuthorEmail and CommitterEmail are the email addresses recorded in
+	// the commit, for the "commit_emails" predicate.
+	AuthorEmail    string `yaml:"author_email"`
+	CommitterEmail string `yaml:"committer_email"`
+
+	At common.Duration `yaml:"at"`
+}
+
+// Comment is a comment on a hypothetical pull request.
+type Comment struct {
+	Author string          `yaml:"author"`
+	Body   string          `yaml:"body"`
+	At     common.Duration `yaml:"at"`
+}
+
+// Review is a review of a hypothetical pull request. State defaults to
+// "approved".
+type Review struct {
+	Author string          `yaml:"author"`
+	State  string          `yaml:"state"`
+	Body   string          `yaml:"body"`
+	At     common.Duration `yaml:"at"`
+}
+
+// Thread is a review conversation on a hypothetical pull request.
+type Thread struct {
+	Path     string `yaml:"path"`
+	Author   string `yaml:"author"`
+	Resolved bool   `yaml:"resolved"`
+}
+
+// Expectation is the expected result of evaluating a test case. Status is the
+// expected status of the whole policy and Rules maps rule names to their
+// expected status. Statuses are "skipped", "pending", "approved",
+// "disapproved", or "error". Rules that are not listed are not checked.
+type Expectation struct {
+	Status string            `yaml:"status"`
+	Rules  map[string]string `yaml:"rules"`
+}
+
+// CaseResult is the outcome of running a test case. The case passed if there
+// are no failures.
+type CaseResult struct {
+	Name     string
+	Failures []string
+}
+
+// Passed returns true if the test case produced the expected result.
+func (r *CaseResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// ParseSuite parses a test suite file.
+func ParseSuite(data []byte) (*Suite, error) {
+	var s Suite
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal test suite")
+	}
+	if len(s.Cases) == 0 {
+		return nil, errors.New("test suite has no cases")
+	}
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			return nil, errors.Errorf("test case %d has no name", i+1)
+		}
+	}
+	if s.Policy == "" {
+		s.Policy = DefaultPolicyFile
+	}
+	return &s, nil
+}
+
+// Run evaluates each case of the suite with the evaluator and returns the
+// results in the order of the cases.
+func (s *Suite) Run(ctx context.Context, evaluator common.Evaluator) []*CaseResult {
+	results := make([]*CaseResult, len(s.Cases))
+	for i, c := range s.Cases {
+		results[i] = c.Run(ctx, evaluator)
+	}
+	return results
+}
+
+// Run evaluates the case with the evaluator and compares the result to the
+// expectation.
+func (c *Case) Run(ctx context.Context, evaluator common.Evaluator) *CaseResult {
+	cr := &CaseResult{Name: c.Name}
+
+	prctx, err := c.PullRequest.Context()
+	if err != nil {
+		cr.Failures = append(cr.Failures, err.Error())
+		return cr
+	}
+
+	res := evaluator.Evaluate(ctx, prctx)
+
+	if c.Expect.Status != "" {
+		if actual := resultStatus(&res); actual != c.Expect.Status {
+			cr.Failures = append(cr.Failures, fmt.Sprintf("policy: expected %s, but was %s (%s)", c.Expect.Status, actual, resultDescription(&res)))
+		}
+	}
+
+	rules := make(map[string]*common.Result)
+	collectResults(&res, rules)
+
+	names := make([]string, 0, len(c.Expect.Rules))
+	for name := range c.Expect.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expected := c.Expect.Rules[name]
+		r, ok := rules[name]
+		if !ok {
+			cr.Failures = append(cr.Failures, fmt.Sprintf("rule %q: not found in the evaluation result", name))
+			continue
+		}
+		if actual := resultStatus(r); actual != expected {
+			cr.Failures = append(cr.Failures, fmt.Sprintf("rule %q: expected %s, but was %s (%s)", name, expected, actual, resultDescription(r)))
+		}
+	}
+
+	return cr
+}
+
+// Context returns a pull request context for the hypothetical pull request.
+func (pr *PullRequest) Context() (pull.Context, error) {
+	created := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	next := created
+	at := func(d common.Duration) time.Time {
+		next = next.Add(eventInterval)
+		if d > 0 {
+			return created.Add(d.Duration())
+		}
+		return next
+	}
+
+	b := pulltest.New().
+		WithAuthor(pr.Author).
+		WithCreatedAt(created).
+		WithTitle(pr.Title).
+		WithBody(pr.Body).
+		WithBranches(pr.BaseBranch, pr.HeadBranch)
+
+	for _, f := range pr.Files {
+		status, err := parseFileStatus(f.Status)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid file %q", f.Filename)
+		}
+		b.WithFiles(&pull.File{
+			Filename:         f.Filename,
+			PreviousFilename: f.PreviousFilename,
+			Status:           status,
+			Additions:        f.Additions,
+			Deletions:        f.Deletions,
+		})
+		if status != pull.FileDeleted {
+			b.WithFileContents(f.Filename, &pull.FileContents{
+				Size:   int64(f.Size),
+				Binary: f.Binary,
+				LFS:    f.LFS,
+			})
+		}
+	}
+
+	for path, content := range pr.BaseFiles {
+		b.WithBaseFile(path, []byte(content))
+	}
+
+	var head string
+	for i, c := range pr.Commits {
+		sha := c.SHA
+		if sha == "" {
+			sha = fmt.Sprintf("%040x", i+1)
+		}
+		head = sha
+		b.WithCommits(&pull.Commit{
+			CreatedAt: at(c.At),
+			SHA:       sha,
+			Author:    defaultString(c.Author, pr.Author),
+			Committer: defaultString(c.Committer, pr.Author),
+
+			AuthorEmail:    c.AuthorEmail,
+			CommitterEmail: c.CommitterEmail,
+		})
+	}
+	b.WithHeadSHA(head)
+
+	for _, c := range pr.Comments {
+		b.WithComments(&pull.Comment{
+			CreatedAt: at(c.At),
+			Author:    c.Author,
+			Body:      c.Body,
+		})
+	}
+
+	for _, r := range pr.Reviews {
+		b.WithReviews(&pull.Review{
+			CreatedAt: at(r.At),
+			Author:    r.Author,
+			State:     pull.ReviewState(defaultString(r.State, string(pull.ReviewApproved))),
+			Body:      r.Body,
+		})
+	}
+
+	for _, t := range pr.Threads {
+		b.WithReviewThreads(&pull.ReviewThread{
+			Path:     t.Path,
+			Author:   t.Author,
+			Resolved: t.Resolved,
+		})
+	}
+
+	for user, teams := range pr.Teams {
+		b.WithTeams(user, teams...)
+	}
+	for user, orgs := range pr.Organizations {
+		b.WithOrgs(user, orgs...)
+	}
+	for user, perms := range pr.Collaborators {
+		b.WithCollaborator(user, perms...)
+	}
+
+	return b.Build(), nil
+}
+
+func parseFileStatus(s string) (pull.FileStatus, error) {
+	switch s {
+	case "", "modified":
+		return pull.FileModified, nil
+	case "added":
+		return pull.FileAdded, nil
+	case "deleted":
+		return pull.FileDeleted, nil
+	}
+	return 0, errors.Errorf("unknown status %q", s)
+}
+
+func resultStatus(r *common.Result) string {
+	if r.Error != nil {
+		return "error"
+	}
+	return r.Status.String()
+}
+
+func resultDescription(r *common.Result) string {
+	if r.Error != nil {
+		return r.Error.Error()
+	}
+	return r.Description
+}
+
+func collectResults(r *common.Result, results map[string]*common.Result) {
+	if len(r.Children) == 0 {
+		results[r.Name] = r
+	}
+	for _, c := range r.Children {
+		collectResults(c, results)
+	}
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const testSuite = `
+cases:
+  - name: docs change
+    pull_request:
+      author: mhaypenny
+      files:
+        - filename: docs/README.md
+    expect:
+      status: approved
+      rules:
+        docs only: approved
+        code review: pending
+
+  - name: approved code change
+    pull_request:
+      author: mhaypenny
+      files:
+        - filename: app/main.go
+          status: added
+      reviews:
+        - author: ttest
+      teams:
+        ttest: ["org/reviewers"]
+    expect:
+      status: approved
+      rules:
+        docs only: skipped
+        code review: approved
+
+  - name: wrong expectation
+    pull_request:
+      author: mhaypenny
+      files:
+        - filename: app/main.go
+    expect:
+      status: approved
+      rules:
+        code review: approved
+        missing rule: approved
+`
+
+func TestParseSuite(t *testing.T) {
+	s, err := ParseSuite([]byte(testSuite))
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultPolicyFile, s.Policy)
+	assert.Len(t, s.Cases, 3)
+
+	_, err = ParseSuite([]byte("cases: []"))
+	assert.EqualError(t, err, "test suite has no cases")
+
+	_, err = ParseSuite([]byte("cases: [{pull_request: {author: mhaypenny}}]"))
+	assert.EqualError(t, err, "test case 1 has no name")
+
+	_, err = ParseSuite([]byte("cases: [{name: test, unknown: true}]"))
+	assert.Error(t, err, "unknown fields should be rejected")
+}
+
+func TestSuiteRun(t *testing.T) {
+	var config policy.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(testPolicy), &config))
+
+	evaluator, err := policy.ParsePolicy(&config)
+	require.NoError(t, err)
+
+	s, err := ParseSuite([]byte(testSuite))
+	require.NoError(t, err)
+
+	results := s.Run(context.Background(), evaluator)
+	require.Len(t, results, 3)
+
+	assert.True(t, results[0].Passed(), "unexpected failures: %v", results[0].Failures)
+	assert.True(t, results[1].Passed(), "unexpected failures: %v", results[1].Failures)
+
+	assert.False(t, results[2].Passed())
+	assert.Equal(t, []string{
+		"policy: expected approved, but was pending (0/1 rules approved)",
+		`rule "code review": expected approved, but was pending (0/1 approvals required)`,
+		`rule "missing rule": not found in the evaluation result`,
+	}, results[2].Failures)
+}
+
+func TestPullRequestContext(t *testing.T) {
+	pr := PullRequest{
+		Author: "mhaypenny",
+		Commits: []Commit{
+			{Author: "ttest"},
+			{},
+		},
+		Comments: []Comment{
+			{Author: "ttest", Body: ":+1:"},
+		},
+		Reviews: []Review{
+			{Author: "ttest", State: "changes_requested", At: common.Duration(30 * time.Second)},
+		},
+	}
+
+	prctx, err := pr.Context()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	commits, err := prctx.Commits(ctx)
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	assert.Equal(t, "ttest", commits[0].Author)
+	assert.Equal(t, "mhaypenny", commits[1].Author)
+	assert.Equal(t, commits[1].SHA, prctx.HeadSHA())
+
+	comments, err := prctx.Comments(ctx)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.True(t, comments[0].CreatedAt.After(commits[1].CreatedAt), "comment should be after the commits")
+
+	reviews, err := prctx.Reviews(ctx)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.True(t, reviews[0].CreatedAt.Before(commits[0].CreatedAt), "review should use its explicit time")
+
+	_, err = (&PullRequest{Files: []File{{Filename: "a.txt", Status: "renamed"}}}).Context()
+	assert.EqualError(t, err, `invalid file "a.txt": unknown status "renamed"`)
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// LastPushAge is satisfied if the time since the last commit was pushed to
+// the pull request compares to a duration. It is written as an operator and
+// a duration, like "> 30d" or "<= 12h". If the pull request has no commits,
+// the time since it was opened is used.
+type LastPushAge struct {
+	Op  string
+	Age time.Duration
+}
+
+var _ Predicate = &LastPushAge{}
+
+func ParseLastPushAge(s string) (*LastPushAge, error) {
+	s = strings.TrimSpace(s)
+
+	var op string
+	for _, o := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return nil, errors.Errorf("last push age %q must start with one of >, >=, <, or <=", s)
+	}
+
+	age, err := common.ParseDuration(strings.TrimSpace(strings.TrimPrefix(s, op)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid last push age %q", s)
+	}
+	return &LastPushAge{Op: op, Age: age}, nil
+}
+
+func (pred *LastPushAge) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	parsed, err := ParseLastPushAge(s)
+	if err != nil {
+		return err
+	}
+	*pred = *parsed
+	return nil
+}
+
+func (pred *LastPushAge) String() string {
+	return fmt.Sprintf("%s %s", pred.Op, pred.Age)
+}
+
+func (pred *LastPushAge) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	lastPush, err := prctx.CreatedAt(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get pull request creation time")
+	}
+
+	commits, err := prctx.Commits(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list commits")
+	}
+	for _, c := range commits {
+		if c.CreatedAt.After(lastPush) {
+			lastPush = c.CreatedAt
+		}
+	}
+
+	age := time.Since(lastPush)
+
+	var matches bool
+	switch pred.Op {
+	case ">":
+		matches = age > pred.Age
+	case ">=":
+		matches = age >= pred.Age
+	case "<":
+		matches = age < pred.Age
+	case "<=":
+		matches = age <= pred.Age
+	default:
+		return false, "", errors.Errorf("unknown last push age operator %q", pred.Op)
+	}
+
+	desc := ""
+	if !matches {
+		desc = fmt.Sprintf("Last push %s ago does not match required age %q", age.Truncate(time.Minute), pred.String())
+	}
+	return matches, desc, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestLastPushAge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	prctx := &pulltest.Context{
+		CreatedAtValue: now.Add(-60 * 24 * time.Hour),
+		CommitsValue: []*pull.Commit{
+			{SHA: "a", CreatedAt: now.Add(-45 * 24 * time.Hour)},
+			{SHA: "b", CreatedAt: now.Add(-40 * 24 * time.Hour)},
+		},
+	}
+
+	t.Run("parse", func(t *testing.T) {
+		var pred LastPushAge
+		require.NoError(t, yaml.UnmarshalStrict([]byte(`">= 30d"`), &pred))
+		assert.Equal(t, ">=", pred.Op)
+		assert.Equal(t, 30*24*time.Hour, pred.Age)
+
+		assert.Error(t, yaml.UnmarshalStrict([]byte(`"30d"`), &pred), "missing operator")
+		assert.Error(t, yaml.UnmarshalStrict([]byte(`"> soon"`), &pred), "invalid duration")
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		pred := &LastPushAge{Op: ">", Age: 30 * 24 * time.Hour}
+		ok, _, err := pred.Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		pred = &LastPushAge{Op: "<", Age: 30 * 24 * time.Hour}
+		ok, desc, err := pred.Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Contains(t, desc, "does not match required age")
+	})
+
+	t.Run("usesLatestCommit", func(t *testing.T) {
+		pred := &LastPushAge{Op: "<=", Age: 42 * 24 * time.Hour}
+		ok, _, err := pred.Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("noCommits", func(t *testing.T) {
+		pred := &LastPushAge{Op: ">", Age: 50 * 24 * time.Hour}
+		ok, _, err := pred.Evaluate(ctx, &pulltest.Context{CreatedAtValue: now.Add(-60 * 24 * time.Hour)})
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
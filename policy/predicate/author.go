@@ -17,6 +17,9 @@ package predicate
 import (
 	"context"
 	"fmt"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -31,7 +34,7 @@ type HasAuthorIn struct {
 var _ Predicate = &HasAuthorIn{}
 
 func (pred *HasAuthorIn) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
-	author, err := prctx.Author()
+	author, err := prctx.Author(ctx)
 	if err != nil {
 		return false, "", errors.Wrap(err, "failed to get author")
 	}
@@ -53,12 +56,12 @@ type HasContributorIn struct {
 var _ Predicate = &HasContributorIn{}
 
 func (pred *HasContributorIn) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
-	commits, err := prctx.Commits()
+	commits, err := prctx.Commits(ctx)
 	if err != nil {
 		return false, "", errors.Wrap(err, "failed to get commits")
 	}
 
-	author, err := prctx.Author()
+	author, err := prctx.Author(ctx)
 	if err != nil {
 		return false, "", errors.Wrap(err, "failed to get author")
 	}
@@ -85,3 +88,106 @@ func (pred *HasContributorIn) Evaluate(ctx context.Context, prctx pull.Context)
 	desc := "No contributors meet the required membership conditions"
 	return false, desc, nil
 }
+
+// CommitEmails is satisfied if the author email address of every commit in
+// the pull request matches one of the patterns. Patterns use the syntax of
+// path.Match, like "*@corp.example.com", and are not case-sensitive. Commits
+// without an email address never match.
+type CommitEmails struct {
+	Match []string `yaml:"match"`
+
+	// IncludeCommitters also requires the committer email address of every
+	// commit to match. Commits created in the GitHub UI are committed by
+	// "noreply@github.com".
+	IncludeCommitters bool `yaml:"include_committers"`
+}
+
+var _ Predicate = &CommitEmails{}
+
+func (pred *CommitEmails) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	commits, err := prctx.Commits(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get commits")
+	}
+
+	for _, c := range commits {
+		emails := []string{c.AuthorEmail}
+		if pred.IncludeCommitters {
+			emails = append(emails, c.CommitterEmail)
+		}
+
+		for _, email := range emails {
+			matches, err := pred.matches(email)
+			if err != nil {
+				return false, "", err
+			}
+			if !matches {
+				if email == "" {
+					email = "(none)"
+				}
+				desc := fmt.Sprintf("Commit %.10s has email address %s, which does not match any of %q", c.SHA, email, pred.Match)
+				return false, desc, nil
+			}
+		}
+	}
+	return true, "", nil
+}
+
+func (pred *CommitEmails) matches(email string) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+	for _, pattern := range pred.Match {
+		matches, err := path.Match(strings.ToLower(pattern), strings.ToLower(email))
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid email pattern %q", pattern)
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AuthorRecentMergedPRs is satisfied if the number of pull requests by the
+// author that were merged in the repository within a duration is between Min
+// and Max, inclusive. Rules can use it to require fewer approvals from
+// frequent contributors or more approvals from first-time contributors.
+type AuthorRecentMergedPRs struct {
+	Min int `yaml:"min"`
+
+	// Max is the largest number of merged pull requests. If nil, there is no
+	// maximum.
+	Max *int `yaml:"max"`
+
+	// Within limits the count to pull requests merged within the duration
+	// before now. If zero, all merged pull requests are counted.
+	Within common.Duration `yaml:"within"`
+}
+
+var _ Predicate = &AuthorRecentMergedPRs{}
+
+func (pred *AuthorRecentMergedPRs) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	var since time.Time
+	if pred.Within > 0 {
+		since = time.Now().Add(-pred.Within.Duration())
+	}
+
+	count, err := prctx.AuthorMergedPullRequests(ctx, since)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to count merged pull requests by the author")
+	}
+
+	period := "in total"
+	if pred.Within > 0 {
+		period = "in the last " + pred.Within.String()
+	}
+
+	if count < pred.Min {
+		return false, fmt.Sprintf("The author has %d merged pull requests %s, fewer than %d", count, period, pred.Min), nil
+	}
+	if pred.Max != nil && count > *pred.Max {
+		return false, fmt.Sprintf("The author has %d merged pull requests %s, more than %d", count, period, *pred.Max), nil
+	}
+	return true, "", nil
+}
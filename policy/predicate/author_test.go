@@ -17,6 +17,7 @@ package predicate
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -187,6 +188,56 @@ func TestHasContributorIn(t *testing.T) {
 	})
 }
 
+func TestAuthorRecentMergedPRs(t *testing.T) {
+	now := time.Now()
+
+	frequent := pulltest.New().
+		WithAuthorMergedPullRequests(
+			now.Add(-24*time.Hour),
+			now.Add(-10*24*time.Hour),
+			now.Add(-30*24*time.Hour),
+			now.Add(-200*24*time.Hour),
+		).
+		Build()
+
+	firstTime := pulltest.New().Build()
+
+	t.Run("min", func(t *testing.T) {
+		p := &AuthorRecentMergedPRs{
+			Min:    3,
+			Within: common.Duration(90 * 24 * time.Hour),
+		}
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"frequent", true, frequent},
+			{"firstTime", false, firstTime},
+		})
+
+		p.Within = common.Duration(7 * 24 * time.Hour)
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"frequentLastWeek", false, frequent},
+		})
+	})
+
+	t.Run("max", func(t *testing.T) {
+		max := 1
+		p := &AuthorRecentMergedPRs{
+			Max:    &max,
+			Within: common.Duration(90 * 24 * time.Hour),
+		}
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"frequent", false, frequent},
+			{"firstTime", true, firstTime},
+		})
+	})
+
+	t.Run("allTime", func(t *testing.T) {
+		p := &AuthorRecentMergedPRs{Min: 4}
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"frequent", true, frequent},
+		})
+	})
+}
+
 type AuthorTestCase struct {
 	Name     string
 	Expected bool
@@ -205,3 +256,63 @@ func runAuthorTests(t *testing.T, p Predicate, cases []AuthorTestCase) {
 		})
 	}
 }
+
+func TestCommitEmails(t *testing.T) {
+	p := &CommitEmails{
+		Match: []string{"*@corp.example.com"},
+	}
+
+	commits := func(emails ...string) *pulltest.Context {
+		ctx := &pulltest.Context{}
+		for i := 0; i < len(emails); i += 2 {
+			ctx.CommitsValue = append(ctx.CommitsValue, &pull.Commit{
+				SHA:            "a6f3f69b64eaafece5a0d854eb4af11c0d64394c",
+				AuthorEmail:    emails[i],
+				CommitterEmail: emails[i+1],
+			})
+		}
+		return ctx
+	}
+
+	runCommitEmailsTests := func(t *testing.T, p Predicate, cases []struct {
+		name     string
+		expected bool
+		context  pull.Context
+	}) {
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				ok, _, err := p.Evaluate(context.Background(), tc.context)
+				if assert.NoError(t, err) {
+					assert.Equal(t, tc.expected, ok)
+				}
+			})
+		}
+	}
+
+	runCommitEmailsTests(t, p, []struct {
+		name     string
+		expected bool
+		context  pull.Context
+	}{
+		{"allMatch", true, commits("a@corp.example.com", "noreply@github.com", "B@Corp.Example.com", "b@corp.example.com")},
+		{"personalAuthor", false, commits("a@corp.example.com", "a@corp.example.com", "me@gmail.com", "a@corp.example.com")},
+		{"missingEmail", false, commits("", "a@corp.example.com")},
+		{"noCommits", true, commits()},
+	})
+
+	t.Run("includeCommitters", func(t *testing.T) {
+		p := &CommitEmails{
+			Match:             []string{"*@corp.example.com"},
+			IncludeCommitters: true,
+		}
+
+		runCommitEmailsTests(t, p, []struct {
+			name     string
+			expected bool
+			context  pull.Context
+		}{
+			{"allMatch", true, commits("a@corp.example.com", "b@corp.example.com")},
+			{"webCommitter", false, commits("a@corp.example.com", "noreply@github.com")},
+		})
+	})
+}
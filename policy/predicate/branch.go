@@ -36,7 +36,7 @@ func (pred *TargetsBranch) Evaluate(ctx context.Context, prctx pull.Context) (bo
 		return false, "", errors.Wrap(err, "failed to compile the target regex")
 	}
 
-	targetName, _, err := prctx.Branches()
+	targetName, _, err := prctx.Branches(ctx)
 	if err != nil {
 		return false, "", err
 	}
@@ -0,0 +1,448 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	EcosystemGo    = "go"
+	EcosystemNPM   = "npm"
+	EcosystemPip   = "pip"
+	EcosystemMaven = "maven"
+)
+
+type DependencyChangeKind string
+
+const (
+	DependencyAdded         DependencyChangeKind = "added"
+	DependencyRemoved       DependencyChangeKind = "removed"
+	DependencyUpgradedMajor DependencyChangeKind = "upgraded_major"
+	DependencyChanged       DependencyChangeKind = "changed"
+)
+
+var (
+	goMajorSuffixPattern   = regexp.MustCompile(`^(.+)/v([0-9]+)$`)
+	goGopkgSuffixPattern   = regexp.MustCompile(`^(gopkg\.in/.+)\.v([0-9]+)$`)
+	majorVersionPattern    = regexp.MustCompile(`^[\s^~<>=!v]*([0-9]+)`)
+	pipRequirementPattern  = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*(?:[<>=!~]=?=?\s*([^\s,;]+))?`)
+	pipNameSeparatorRegexp = regexp.MustCompile(`[-_.]+`)
+	mavenPropertyPattern   = regexp.MustCompile(`\$\{([^}]+)\}`)
+)
+
+// DependencyChange is a change to a dependency in a manifest file.
+type DependencyChange struct {
+	Ecosystem string
+	Path      string
+	Package   string
+	Kind      DependencyChangeKind
+
+	// From and To are the versions before and after the change. From is
+	// empty for added dependencies and To is empty for removed dependencies.
+	From string
+	To   string
+}
+
+func (c *DependencyChange) String() string {
+	switch c.Kind {
+	case DependencyAdded:
+		return fmt.Sprintf("%s: added %s %s", c.Path, c.Package, c.To)
+	case DependencyRemoved:
+		return fmt.Sprintf("%s: removed %s %s", c.Path, c.Package, c.From)
+	}
+	return fmt.Sprintf("%s: %s %s -> %s", c.Path, c.Package, c.From, c.To)
+}
+
+// ChangedDependencies is satisfied if the pull request adds, removes, or
+// upgrades a dependency in a manifest file: go.mod for Go, package.json for
+// npm, requirements*.txt for pip, and pom.xml for Maven. Manifests are
+// compared between the base branch and the head of the pull request, so
+// rules can require a supply-chain review for actual dependency changes
+// instead of any change to a manifest.
+type ChangedDependencies struct {
+	// Ecosystems limits the manifests that are compared. If empty, all
+	// supported ecosystems are compared.
+	Ecosystems []string `yaml:"ecosystems"`
+
+	// Packages are regular expressions for the names of the dependencies
+	// that are considered. If empty, all dependencies are considered. Go
+	// modules are named without their major version suffix, pip packages by
+	// their normalized name, and Maven dependencies as "groupId:artifactId".
+	Packages []string `yaml:"packages"`
+
+	// Added, Removed, and UpgradedMajor select the kinds of changes that
+	// satisfy the predicate. If none are set, any change to a dependency,
+	// including a minor version change, satisfies the predicate.
+	Added         bool `yaml:"added"`
+	Removed       bool `yaml:"removed"`
+	UpgradedMajor bool `yaml:"upgraded_major"`
+}
+
+var _ Predicate = &ChangedDependencies{}
+
+func (pred *ChangedDependencies) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	changes, err := pred.Changes(ctx, prctx)
+	if err != nil {
+		return false, "", err
+	}
+	for _, c := range changes {
+		if pred.matchesKind(c.Kind) {
+			return true, "", nil
+		}
+	}
+	return false, "No matching dependency changes were found", nil
+}
+
+func (pred *ChangedDependencies) matchesKind(kind DependencyChangeKind) bool {
+	if !pred.Added && !pred.Removed && !pred.UpgradedMajor {
+		return true
+	}
+	switch kind {
+	case DependencyAdded:
+		return pred.Added
+	case DependencyRemoved:
+		return pred.Removed
+	case DependencyUpgradedMajor:
+		return pred.UpgradedMajor
+	}
+	return false
+}
+
+// Changes returns the changes to dependencies in the manifests changed by the
+// pull request, limited to the configured ecosystems and packages.
+func (pred *ChangedDependencies) Changes(ctx context.Context, prctx pull.Context) ([]*DependencyChange, error) {
+	ecosystems := make(map[string]bool)
+	for _, e := range pred.Ecosystems {
+		if _, ok := dependencyParsers[e]; !ok {
+			return nil, errors.Errorf("unknown dependency ecosystem %q", e)
+		}
+		ecosystems[e] = true
+	}
+
+	packages, err := pathsToRegexps(pred.Packages)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse packages")
+	}
+
+	files, err := prctx.ChangedFiles(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	var changes []*DependencyChange
+	for _, f := range files {
+		ecosystem := ManifestEcosystem(f.Filename)
+		if ecosystem == "" && f.PreviousFilename != "" {
+			ecosystem = ManifestEcosystem(f.PreviousFilename)
+		}
+		if ecosystem == "" || (len(ecosystems) > 0 && !ecosystems[ecosystem]) {
+			continue
+		}
+
+		before, after, err := manifestDependencies(ctx, prctx, f, ecosystem)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range diffDependencies(before, after) {
+			if len(packages) > 0 && !anyMatches(packages, c.Package) {
+				continue
+			}
+			c.Ecosystem = ecosystem
+			c.Path = f.Filename
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// ManifestEcosystem returns the ecosystem of the dependency manifest at the
+// path or an empty string if the path is not a supported manifest.
+func ManifestEcosystem(p string) string {
+	base := path.Base(p)
+	switch {
+	case base == "go.mod":
+		return EcosystemGo
+	case base == "package.json":
+		return EcosystemNPM
+	case base == "pom.xml":
+		return EcosystemMaven
+	case strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt"):
+		return EcosystemPip
+	}
+	return ""
+}
+
+// dependency is a dependency declared in a manifest. Major is the major
+// version or -1 if it is unknown.
+type dependency struct {
+	Version string
+	Major   int
+}
+
+type dependencyParser func(content []byte) (map[string]dependency, error)
+
+var dependencyParsers = map[string]dependencyParser{
+	EcosystemGo:    parseGoMod,
+	EcosystemNPM:   parsePackageJSON,
+	EcosystemPip:   parseRequirements,
+	EcosystemMaven: parsePOM,
+}
+
+// manifestDependencies returns the dependencies in the manifest on the base
+// branch and at the head of the pull request. Manifests that do not exist
+// have no dependencies.
+func manifestDependencies(ctx context.Context, prctx pull.Context, f *pull.File, ecosystem string) (map[string]dependency, map[string]dependency, error) {
+	parse := dependencyParsers[ecosystem]
+
+	var before, after map[string]dependency
+	if f.Status != pull.FileAdded {
+		basePath := f.Filename
+		if f.PreviousFilename != "" {
+			basePath = f.PreviousFilename
+		}
+		content, err := prctx.BaseFileContent(ctx, basePath)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get contents of %s", basePath)
+		}
+		if before, err = parse(content); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse %s on the base branch", basePath)
+		}
+	}
+	if f.Status != pull.FileDeleted {
+		content, err := prctx.RefFileContent(ctx, f.Filename, prctx.HeadSHA())
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get contents of %s", f.Filename)
+		}
+		if after, err = parse(content); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse %s", f.Filename)
+		}
+	}
+	return before, after, nil
+}
+
+// diffDependencies returns the changes between two sets of dependencies,
+// sorted by package name.
+func diffDependencies(before, after map[string]dependency) []*DependencyChange {
+	var changes []*DependencyChange
+	for name, b := range before {
+		a, ok := after[name]
+		switch {
+		case !ok:
+			changes = append(changes, &DependencyChange{Package: name, Kind: DependencyRemoved, From: b.Version})
+		case a.Version != b.Version:
+			kind := DependencyChanged
+			if a.Major >= 0 && b.Major >= 0 && a.Major > b.Major {
+				kind = DependencyUpgradedMajor
+			}
+			changes = append(changes, &DependencyChange{Package: name, Kind: kind, From: b.Version, To: a.Version})
+		}
+	}
+	for name, a := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, &DependencyChange{Package: name, Kind: DependencyAdded, To: a.Version})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Package < changes[j].Package })
+	return changes
+}
+
+// majorVersion returns the first number in a version or version range, or -1
+// if the version does not start with a number.
+func majorVersion(v string) int {
+	m := majorVersionPattern.FindStringSubmatch(v)
+	if m == nil {
+		return -1
+	}
+	major, err := strconv.Atoi(m[1])
+	if err != nil {
+		return -1
+	}
+	return major
+}
+
+// parseGoMod returns the required modules in a go.mod file. Modules are
+// named without their major version suffix, so that moving from
+// "example.com/mod" to "example.com/mod/v2" is a major upgrade.
+func parseGoMod(content []byte) (map[string]dependency, error) {
+	deps := make(map[string]dependency)
+	add := func(fields []string) {
+		if len(fields) < 2 {
+			return
+		}
+		name, version := fields[0], fields[1]
+		major := majorVersion(version)
+		for _, re := range []*regexp.Regexp{goMajorSuffixPattern, goGopkgSuffixPattern} {
+			if m := re.FindStringSubmatch(name); m != nil {
+				name = m[1]
+				major, _ = strconv.Atoi(m[2])
+				break
+			}
+		}
+		deps[name] = dependency{Version: version, Major: major}
+	}
+
+	inRequire := false
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire:
+			add(fields)
+		case fields[0] == "require" && len(fields) > 1 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require":
+			add(fields[1:])
+		}
+	}
+	return deps, s.Err()
+}
+
+// parsePackageJSON returns the dependencies in all dependency sections of a
+// package.json file.
+func parsePackageJSON(content []byte) (map[string]dependency, error) {
+	deps := make(map[string]dependency)
+	if len(bytes.TrimSpace(content)) == 0 {
+		return deps, nil
+	}
+
+	var manifest struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+
+	sections := []map[string]string{
+		manifest.Dependencies,
+		manifest.DevDependencies,
+		manifest.PeerDependencies,
+		manifest.OptionalDependencies,
+	}
+	for _, section := range sections {
+		for name, version := range section {
+			if _, ok := deps[name]; !ok {
+				deps[name] = dependency{Version: version, Major: majorVersion(version)}
+			}
+		}
+	}
+	return deps, nil
+}
+
+// parseRequirements returns the requirements in a pip requirements file.
+// Options, like references to other files, are ignored.
+func parseRequirements(content []byte) (map[string]dependency, error) {
+	deps := make(map[string]dependency)
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") {
+			continue
+		}
+
+		m := pipRequirementPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := strings.ToLower(pipNameSeparatorRegexp.ReplaceAllString(m[1], "-"))
+		deps[name] = dependency{Version: m[2], Major: majorVersion(m[2])}
+	}
+	return deps, s.Err()
+}
+
+// parsePOM returns the dependencies and managed dependencies in a Maven
+// pom.xml file, named "groupId:artifactId". Versions that reference
+// properties of the POM are resolved.
+func parsePOM(content []byte) (map[string]dependency, error) {
+	deps := make(map[string]dependency)
+	if len(bytes.TrimSpace(content)) == 0 {
+		return deps, nil
+	}
+
+	type mavenDependency struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+	}
+	var project struct {
+		Properties struct {
+			Entries []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"properties"`
+		Dependencies        []mavenDependency `xml:"dependencies>dependency"`
+		ManagedDependencies []mavenDependency `xml:"dependencyManagement>dependencies>dependency"`
+	}
+	if err := xml.Unmarshal(content, &project); err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]string)
+	for _, e := range project.Properties.Entries {
+		properties[e.XMLName.Local] = strings.TrimSpace(e.Value)
+	}
+	resolve := func(v string) string {
+		return mavenPropertyPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			if value, ok := properties[ref[2:len(ref)-1]]; ok {
+				return value
+			}
+			return ref
+		})
+	}
+
+	for _, d := range append(project.Dependencies, project.ManagedDependencies...) {
+		name := strings.TrimSpace(d.GroupID) + ":" + strings.TrimSpace(d.ArtifactID)
+		if _, ok := deps[name]; ok {
+			continue
+		}
+		version := resolve(strings.TrimSpace(d.Version))
+		deps[name] = dependency{Version: version, Major: majorVersion(version)}
+	}
+	return deps, nil
+}
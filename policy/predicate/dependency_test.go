@@ -0,0 +1,230 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+const (
+	baseGoMod = `module example.com/app
+
+go 1.21
+
+require github.com/pkg/errors v0.9.1
+
+require (
+	github.com/stretchr/testify v1.8.4
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
+`
+	headGoMod = `module example.com/app
+
+go 1.21
+
+require (
+	github.com/google/go-github/v57 v57.0.0
+	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+`
+	basePackageJSON = `{
+  "dependencies": {"react": "^17.0.2", "lodash": "~4.17.0"},
+  "devDependencies": {"jest": "29.x"}
+}`
+	headPackageJSON = `{
+  "dependencies": {"react": "^18.2.0", "lodash": "~4.17.21"},
+  "devDependencies": {"jest": "29.x", "left-pad": "1.3.0"}
+}`
+	baseRequirements = `# pinned requirements
+Django==3.2.20
+requests[security]>=2.28 ; python_version >= "3.8"
+-r common.txt
+`
+	headRequirements = `Django==4.2.4
+requests[security]>=2.31
+`
+	basePOM = `<project>
+  <properties>
+    <guava.version>31.1-jre</guava.version>
+  </properties>
+  <dependencies>
+    <dependency>
+      <groupId>com.google.guava</groupId>
+      <artifactId>guava</artifactId>
+      <version>${guava.version}</version>
+    </dependency>
+    <dependency>
+      <groupId>junit</groupId>
+      <artifactId>junit</artifactId>
+      <version>4.13.2</version>
+    </dependency>
+  </dependencies>
+</project>`
+	headPOM = `<project>
+  <properties>
+    <guava.version>32.1.2-jre</guava.version>
+  </properties>
+  <dependencies>
+    <dependency>
+      <groupId>com.google.guava</groupId>
+      <artifactId>guava</artifactId>
+      <version>${guava.version}</version>
+    </dependency>
+  </dependencies>
+</project>`
+)
+
+func TestManifestEcosystem(t *testing.T) {
+	tests := map[string]string{
+		"go.mod":                    EcosystemGo,
+		"tools/go.mod":              EcosystemGo,
+		"web/package.json":          EcosystemNPM,
+		"requirements.txt":          EcosystemPip,
+		"ml/requirements-dev.txt":   EcosystemPip,
+		"pom.xml":                   EcosystemMaven,
+		"go.sum":                    "",
+		"web/package-lock.json":     "",
+		"docs/requirements.md":      "",
+		"src/main/resources/pom.go": "",
+	}
+
+	for p, expected := range tests {
+		assert.Equal(t, expected, ManifestEcosystem(p), "incorrect ecosystem for %s", p)
+	}
+}
+
+func TestChangedDependencies(t *testing.T) {
+	ctx := context.Background()
+
+	manifest := func(b *pulltest.Builder, path, base, head string) *pulltest.Builder {
+		return b.
+			WithFiles(&pull.File{Filename: path, Status: pull.FileModified}).
+			WithBaseFile(path, []byte(base)).
+			WithRefFile("head-sha", path, []byte(head))
+	}
+	newBuilder := func() *pulltest.Builder {
+		return pulltest.New().WithHeadSHA("head-sha")
+	}
+
+	changes := func(t *testing.T, pred *ChangedDependencies, prctx pull.Context) map[string]DependencyChangeKind {
+		cs, err := pred.Changes(ctx, prctx)
+		require.NoError(t, err)
+
+		kinds := make(map[string]DependencyChangeKind)
+		for _, c := range cs {
+			kinds[c.Package] = c.Kind
+		}
+		return kinds
+	}
+
+	t.Run("goMod", func(t *testing.T) {
+		prctx := manifest(newBuilder(), "go.mod", baseGoMod, headGoMod).Build()
+		assert.Equal(t, map[string]DependencyChangeKind{
+			"github.com/google/go-github": DependencyAdded,
+			"github.com/pkg/errors":       DependencyRemoved,
+			"github.com/stretchr/testify": DependencyChanged,
+			"gopkg.in/yaml":               DependencyUpgradedMajor,
+		}, changes(t, &ChangedDependencies{}, prctx))
+	})
+
+	t.Run("packageJSON", func(t *testing.T) {
+		prctx := manifest(newBuilder(), "web/package.json", basePackageJSON, headPackageJSON).Build()
+		assert.Equal(t, map[string]DependencyChangeKind{
+			"left-pad": DependencyAdded,
+			"lodash":   DependencyChanged,
+			"react":    DependencyUpgradedMajor,
+		}, changes(t, &ChangedDependencies{}, prctx))
+	})
+
+	t.Run("requirements", func(t *testing.T) {
+		prctx := manifest(newBuilder(), "requirements.txt", baseRequirements, headRequirements).Build()
+		assert.Equal(t, map[string]DependencyChangeKind{
+			"django":   DependencyUpgradedMajor,
+			"requests": DependencyChanged,
+		}, changes(t, &ChangedDependencies{}, prctx))
+	})
+
+	t.Run("pom", func(t *testing.T) {
+		prctx := manifest(newBuilder(), "pom.xml", basePOM, headPOM).Build()
+		assert.Equal(t, map[string]DependencyChangeKind{
+			"com.google.guava:guava": DependencyUpgradedMajor,
+			"junit:junit":            DependencyRemoved,
+		}, changes(t, &ChangedDependencies{}, prctx))
+	})
+
+	t.Run("addedManifest", func(t *testing.T) {
+		prctx := newBuilder().
+			WithFiles(&pull.File{Filename: "web/package.json", Status: pull.FileAdded}).
+			WithRefFile("head-sha", "web/package.json", []byte(headPackageJSON)).
+			Build()
+		assert.Equal(t, map[string]DependencyChangeKind{
+			"jest":     DependencyAdded,
+			"left-pad": DependencyAdded,
+			"lodash":   DependencyAdded,
+			"react":    DependencyAdded,
+		}, changes(t, &ChangedDependencies{}, prctx))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		b := manifest(newBuilder(), "go.mod", baseGoMod, headGoMod)
+		prctx := manifest(b, "web/package.json", basePackageJSON, headPackageJSON).Build()
+
+		pred := &ChangedDependencies{Ecosystems: []string{EcosystemNPM}, Packages: []string{"^l"}}
+		assert.Equal(t, map[string]DependencyChangeKind{
+			"left-pad": DependencyAdded,
+			"lodash":   DependencyChanged,
+		}, changes(t, pred, prctx))
+
+		_, err := (&ChangedDependencies{Ecosystems: []string{"cargo"}}).Changes(ctx, prctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("evaluate", func(t *testing.T) {
+		prctx := manifest(newBuilder(), "web/package.json", basePackageJSON, headPackageJSON).Build()
+
+		runTest := func(pred *ChangedDependencies, expected bool) {
+			ok, _, err := pred.Evaluate(ctx, prctx)
+			require.NoError(t, err)
+			assert.Equal(t, expected, ok)
+		}
+
+		runTest(&ChangedDependencies{}, true)
+		runTest(&ChangedDependencies{UpgradedMajor: true}, true)
+		runTest(&ChangedDependencies{Removed: true}, false)
+		runTest(&ChangedDependencies{Removed: true, Packages: []string{"^react$"}}, false)
+		runTest(&ChangedDependencies{Ecosystems: []string{EcosystemGo}}, false)
+	})
+
+	t.Run("otherFiles", func(t *testing.T) {
+		prctx := newBuilder().WithFiles(&pull.File{Filename: "main.go", Status: pull.FileModified}).Build()
+		ok, _, err := (&ChangedDependencies{}).Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("invalidManifest", func(t *testing.T) {
+		prctx := manifest(newBuilder(), "package.json", basePackageJSON, "{").Build()
+		_, _, err := (&ChangedDependencies{}).Evaluate(ctx, prctx)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,317 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultExternalCheckTimeout = 10 * time.Second
+
+	maxExternalCheckRedirects    = 5
+	maxExternalCheckResponseSize = 1 << 20
+
+	FailureModeClosed = "closed"
+	FailureModeOpen   = "open"
+)
+
+// ExternalCheck is satisfied if an external HTTP service approves the pull
+// request. The service receives an ExternalCheckRequest as JSON and must
+// respond with a 2xx status and an ExternalCheckResponse.
+type ExternalCheck struct {
+	URL     string        `yaml:"url"`
+	Method  string        `yaml:"method"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// CacheTTL is how long to reuse a verdict for identical requests. If it
+	// is zero, the service is called on every evaluation.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// FailureMode determines the result if the service cannot be reached or
+	// returns an invalid response. If "open", the predicate is satisfied. If
+	// "closed" (the default), the predicate is not satisfied.
+	FailureMode string `yaml:"failure_mode"`
+}
+
+type ExternalCheckRequest struct {
+	Locator    string `json:"locator"`
+	Owner      string `json:"owner"`
+	Repository string `json:"repository"`
+	Author     string `json:"author"`
+	BaseBranch string `json:"base_branch"`
+	HeadBranch string `json:"head_branch"`
+}
+
+type ExternalCheckResponse struct {
+	Satisfied   bool   `json:"satisfied"`
+	Description string `json:"description"`
+}
+
+var _ Predicate = &ExternalCheck{}
+
+type allowedURLsKey struct{}
+
+// WithAllowedExternalURLs returns a context that allows external checks to
+// call URLs that match any of the given prefixes. A URL matches a prefix if
+// it has the same scheme and host and its path is the prefix path or is
+// below it. By default, external checks may not call any URL.
+func WithAllowedExternalURLs(ctx context.Context, prefixes []string) context.Context {
+	return context.WithValue(ctx, allowedURLsKey{}, prefixes)
+}
+
+// isAllowedExternalURL returns true if the URL has the same scheme and host
+// as one of the allowed prefixes and a path that starts with the prefix path
+// at a segment boundary. URLs with user information or "." and ".." path
+// segments are never allowed.
+func isAllowedExternalURL(ctx context.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || u.Opaque != "" || hasDotSegment(u.EscapedPath()) {
+		return false
+	}
+
+	prefixes, _ := ctx.Value(allowedURLsKey{}).([]string)
+	for _, p := range prefixes {
+		prefix, err := url.Parse(p)
+		if err != nil || prefix.Host == "" {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, prefix.Scheme) || !strings.EqualFold(u.Host, prefix.Host) {
+			continue
+		}
+		if hasPathPrefix(u.EscapedPath(), prefix.EscapedPath()) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix returns true if the path is the prefix or is below it.
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "" || prefix == "/" {
+		return true
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if s, err := url.PathUnescape(segment); err != nil || s == "." || s == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func (pred *ExternalCheck) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	if !isAllowedExternalURL(ctx, pred.URL) {
+		return false, "", errors.Errorf("external check URL %q is not allowed by the server configuration", pred.URL)
+	}
+
+	req, err := pred.newRequest(ctx, prctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	res, err := pred.check(ctx, req)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("url", pred.URL).Msg("external check failed")
+		if pred.FailureMode == FailureModeOpen {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("The external check at %s failed", pred.URL), nil
+	}
+
+	desc := res.Description
+	if !res.Satisfied && desc == "" {
+		desc = fmt.Sprintf("The external check at %s is not satisfied", pred.URL)
+	}
+	return res.Satisfied, desc, nil
+}
+
+func (pred *ExternalCheck) newRequest(ctx context.Context, prctx pull.Context) (*ExternalCheckRequest, error) {
+	author, err := prctx.Author(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get author")
+	}
+
+	base, head, err := prctx.Branches(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get branches")
+	}
+
+	return &ExternalCheckRequest{
+		Locator:    prctx.Locator(),
+		Owner:      prctx.RepositoryOwner(),
+		Repository: prctx.RepositoryName(),
+		Author:     author,
+		BaseBranch: base,
+		HeadBranch: head,
+	}, nil
+}
+
+func (pred *ExternalCheck) check(ctx context.Context, req *ExternalCheckRequest) (*ExternalCheckResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal external check request")
+	}
+
+	method := strings.ToUpper(pred.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	key := method + " " + pred.URL + " " + string(body)
+	if res, ok := externalChecks.get(key); ok {
+		return res, nil
+	}
+
+	timeout := pred.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExternalCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if method != http.MethodGet {
+		reqBody = bytes.NewReader(body)
+	}
+
+	httpReq, err := http.NewRequest(method, pred.URL, reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create external check request")
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	httpRes, err := externalCheckClient(ctx, timeout).Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "external check request failed")
+	}
+	defer func() {
+		_ = httpRes.Body.Close()
+	}()
+
+	if httpRes.StatusCode < 200 || httpRes.StatusCode >= 300 {
+		return nil, errors.Errorf("external check returned status %d", httpRes.StatusCode)
+	}
+
+	resBody, err := ioutil.ReadAll(io.LimitReader(httpRes.Body, maxExternalCheckResponseSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read external check response")
+	}
+	if len(resBody) > maxExternalCheckResponseSize {
+		return nil, errors.Errorf("external check response is larger than %d bytes", maxExternalCheckResponseSize)
+	}
+
+	var res ExternalCheckResponse
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal external check response")
+	}
+
+	if pred.CacheTTL > 0 {
+		externalChecks.put(key, &res, pred.CacheTTL)
+	}
+	return &res, nil
+}
+
+// externalCheckClient returns a client for external checks. The client only
+// follows redirects to URLs that are allowed in the context.
+func externalCheckClient(ctx context.Context, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxExternalCheckRedirects {
+				return errors.Errorf("stopped after %d redirects", maxExternalCheckRedirects)
+			}
+			if !isAllowedExternalURL(ctx, req.URL.String()) {
+				return errors.Errorf("redirect to %s is not allowed by the server configuration", req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// FlushExternalChecks discards all cached external check verdicts.
+func FlushExternalChecks() {
+	externalChecks.lock.Lock()
+	defer externalChecks.lock.Unlock()
+
+	externalChecks.entries = make(map[string]externalCheckEntry)
+}
+
+var externalChecks = &externalCheckCache{
+	entries: make(map[string]externalCheckEntry),
+}
+
+type externalCheckEntry struct {
+	res     *ExternalCheckResponse
+	expires time.Time
+}
+
+type externalCheckCache struct {
+	lock    sync.Mutex
+	entries map[string]externalCheckEntry
+}
+
+func (c *externalCheckCache) get(key string) (*ExternalCheckResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.res, true
+}
+
+func (c *externalCheckCache) put(key string, res *ExternalCheckResponse, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// opportunistically remove expired entries to bound the size
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = externalCheckEntry{res: res, expires: now.Add(ttl)}
+}
@@ -20,11 +20,17 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
 )
 
 type ChangedFiles struct {
 	Paths []string `yaml:"paths"`
+
+	// ExcludeGenerated ignores files marked as generated by the
+	// linguist-generated attribute in the .gitattributes file on the base
+	// branch.
+	ExcludeGenerated bool `yaml:"exclude_generated"`
 }
 
 var _ Predicate = &ChangedFiles{}
@@ -35,15 +41,25 @@ func (pred *ChangedFiles) Evaluate(ctx context.Context, prctx pull.Context) (boo
 		return false, "", errors.Wrap(err, "failed to parse paths")
 	}
 
-	files, err := prctx.ChangedFiles()
+	generated, err := generatedFilesIf(ctx, prctx, pred.ExcludeGenerated)
 	if err != nil {
-		return false, "", errors.Wrap(err, "failed to list changed files")
+		return false, "", err
 	}
 
-	for _, f := range files {
-		if anyMatches(paths, f.Filename) {
-			return true, "", nil
+	matched := false
+	err = prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if generated.isGenerated(f) {
+			return true
 		}
+		matched = anyPathMatches(paths, f)
+		return !matched
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	if matched {
+		return true, "", nil
 	}
 
 	desc := "No changed files match the required patterns"
@@ -52,6 +68,9 @@ func (pred *ChangedFiles) Evaluate(ctx context.Context, prctx pull.Context) (boo
 
 type OnlyChangedFiles struct {
 	Paths []string `yaml:"paths"`
+
+	// ExcludeGenerated ignores generated files, as for ChangedFiles.
+	ExcludeGenerated bool `yaml:"exclude_generated"`
 }
 
 var _ Predicate = &OnlyChangedFiles{}
@@ -62,20 +81,31 @@ func (pred *OnlyChangedFiles) Evaluate(ctx context.Context, prctx pull.Context)
 		return false, "", errors.Wrap(err, "failed to parse paths")
 	}
 
-	files, err := prctx.ChangedFiles()
+	generated, err := generatedFilesIf(ctx, prctx, pred.ExcludeGenerated)
 	if err != nil {
-		return false, "", errors.Wrap(err, "failed to list changed files")
+		return false, "", err
 	}
 
-	for _, f := range files {
-		if anyMatches(paths, f.Filename) {
-			continue
+	count := 0
+	unmatched := false
+	err = prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if generated.isGenerated(f) {
+			return true
 		}
+		count++
+		unmatched = !allPathsMatch(paths, f)
+		return !unmatched
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	if unmatched {
 		desc := "A changed file does not match the required pattern"
 		return false, desc, nil
 	}
 
-	filesChanged := len(files) > 0
+	filesChanged := count > 0
 
 	desc := ""
 	if !filesChanged {
@@ -85,6 +115,92 @@ func (pred *OnlyChangedFiles) Evaluate(ctx context.Context, prctx pull.Context)
 	return filesChanged, desc, nil
 }
 
+// ChangedFileContents matches if an added or modified file matching the paths
+// has all of the configured properties. If Paths is empty, all files match.
+// Properties that are not set match any file.
+type ChangedFileContents struct {
+	Paths      []string        `yaml:"paths"`
+	Binary     *bool           `yaml:"binary"`
+	LFS        *bool           `yaml:"lfs"`
+	LargerThan common.ByteSize `yaml:"larger_than"`
+
+	// ExcludeGenerated ignores generated files, as for ChangedFiles.
+	ExcludeGenerated bool `yaml:"exclude_generated"`
+}
+
+var _ Predicate = &ChangedFileContents{}
+
+func (pred *ChangedFileContents) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	paths, err := pathsToRegexps(pred.Paths)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse paths")
+	}
+
+	generated, err := generatedFilesIf(ctx, prctx, pred.ExcludeGenerated)
+	if err != nil {
+		return false, "", err
+	}
+
+	var candidates []string
+	err = prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if generated.isGenerated(f) {
+			return true
+		}
+		if f.Status != pull.FileDeleted && (len(paths) == 0 || anyMatches(paths, f.Filename)) {
+			candidates = append(candidates, f.Filename)
+		}
+		return true
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	for _, path := range candidates {
+		fc, err := prctx.FileContents(ctx, path)
+		if err != nil {
+			return false, "", errors.Wrapf(err, "failed to get contents of %s", path)
+		}
+		if pred.matches(fc) {
+			return true, "", nil
+		}
+	}
+
+	desc := "No changed files have the required contents"
+	return false, desc, nil
+}
+
+func (pred *ChangedFileContents) matches(fc *pull.FileContents) bool {
+	if pred.Binary != nil && *pred.Binary != fc.Binary {
+		return false
+	}
+	if pred.LFS != nil && *pred.LFS != fc.LFS {
+		return false
+	}
+	return fc.Size > int64(pred.LargerThan)
+}
+
+// anyPathMatches returns true if the current or previous path of a file
+// matches, so that moving a file out of a matched directory still matches.
+func anyPathMatches(re []*regexp.Regexp, f *pull.File) bool {
+	for _, p := range f.Paths() {
+		if anyMatches(re, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// allPathsMatch returns true if both the current and previous paths of a file
+// match, so that moving a file into a matched directory does not match.
+func allPathsMatch(re []*regexp.Regexp, f *pull.File) bool {
+	for _, p := range f.Paths() {
+		if !anyMatches(re, p) {
+			return false
+		}
+	}
+	return true
+}
+
 func anyMatches(re []*regexp.Regexp, s string) bool {
 	for _, r := range re {
 		if r.MatchString(s) {
@@ -66,6 +66,17 @@ func TestChangedFiles(t *testing.T) {
 				},
 			},
 		},
+		{
+			"renamedFrom",
+			true,
+			[]*pull.File{
+				{
+					Filename:         "model/client.go",
+					PreviousFilename: "app/client.go",
+					Status:           pull.FileModified,
+				},
+			},
+		},
 		{
 			"noMatches",
 			false,
@@ -125,6 +136,17 @@ func TestOnlyChangedFiles(t *testing.T) {
 				},
 			},
 		},
+		{
+			"renamedFrom",
+			false,
+			[]*pull.File{
+				{
+					Filename:         "app/client.go",
+					PreviousFilename: "model/client.go",
+					Status:           pull.FileModified,
+				},
+			},
+		},
 		{
 			"noMatches",
 			false,
@@ -142,6 +164,63 @@ func TestOnlyChangedFiles(t *testing.T) {
 	})
 }
 
+func TestChangedFileContents(t *testing.T) {
+	ctx := context.Background()
+	yes := true
+	no := false
+
+	prctx := pulltest.New().
+		WithFiles(
+			&pull.File{Filename: "assets/logo.png", Status: pull.FileAdded},
+			&pull.File{Filename: "assets/video.mp4", Status: pull.FileAdded},
+			&pull.File{Filename: "data/dump.sql", Status: pull.FileModified},
+			&pull.File{Filename: "lib/old.jar", Status: pull.FileDeleted},
+		).
+		WithFileContents("assets/logo.png", &pull.FileContents{Size: 20 << 10, Binary: true}).
+		WithFileContents("assets/video.mp4", &pull.FileContents{Size: 130, LFS: true}).
+		WithFileContents("data/dump.sql", &pull.FileContents{Size: 50 << 20}).
+		Build()
+
+	tests := map[string]struct {
+		Predicate *ChangedFileContents
+		Expected  bool
+	}{
+		"smallBinary": {
+			&ChangedFileContents{Binary: &yes},
+			true,
+		},
+		"largeBinary": {
+			&ChangedFileContents{Binary: &yes, LargerThan: 1 << 20},
+			false,
+		},
+		"largeNotLFS": {
+			&ChangedFileContents{LFS: &no, LargerThan: 10 << 20},
+			true,
+		},
+		"largeNotLFSInPaths": {
+			&ChangedFileContents{Paths: []string{"assets/.*"}, LFS: &no, LargerThan: 10 << 20},
+			false,
+		},
+		"lfs": {
+			&ChangedFileContents{Paths: []string{".*\\.mp4"}, LFS: &yes},
+			true,
+		},
+		"deleted": {
+			&ChangedFileContents{Paths: []string{"lib/.*"}},
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, _, err := test.Predicate.Evaluate(ctx, prctx)
+			if assert.NoError(t, err, "evaluation failed") {
+				assert.Equal(t, test.Expected, ok, "predicate was not correct")
+			}
+		})
+	}
+}
+
 type FileTestCase struct {
 	Name     string
 	Expected bool
@@ -0,0 +1,176 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	gitAttributesPath = ".gitattributes"
+
+	generatedAttribute = "linguist-generated"
+)
+
+// generatedPattern is a line of a .gitattributes file that sets or unsets
+// the linguist-generated attribute.
+type generatedPattern struct {
+	re        *regexp.Regexp
+	generated bool
+}
+
+// generatedFiles identifies files marked as generated by the
+// linguist-generated attribute in the .gitattributes file at the root of the
+// base branch. As in git, the last matching line decides the attribute.
+type generatedFiles struct {
+	patterns []generatedPattern
+}
+
+// loadGeneratedFiles reads the .gitattributes file on the base branch of the
+// pull request. If the file does not exist, no files are generated.
+func loadGeneratedFiles(ctx context.Context, prctx pull.Context) (*generatedFiles, error) {
+	content, err := prctx.BaseFileContent(ctx, gitAttributesPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load "+gitAttributesPath)
+	}
+	return parseGeneratedFiles(content), nil
+}
+
+// generatedFilesIf loads the generated files if exclude is true and returns
+// nil otherwise, so that no files are generated.
+func generatedFilesIf(ctx context.Context, prctx pull.Context, exclude bool) (*generatedFiles, error) {
+	if !exclude {
+		return nil, nil
+	}
+	return loadGeneratedFiles(ctx, prctx)
+}
+
+// parseGeneratedFiles parses the content of a .gitattributes file. Lines with
+// invalid patterns are ignored, like git does.
+func parseGeneratedFiles(content []byte) *generatedFiles {
+	g := &generatedFiles{}
+
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		generated, ok := generatedValue(fields[1:])
+		if !ok {
+			continue
+		}
+
+		re, err := GlobToRegexp(fields[0])
+		if err != nil {
+			continue
+		}
+		g.patterns = append(g.patterns, generatedPattern{re: re, generated: generated})
+	}
+	return g
+}
+
+// generatedValue returns the value of the linguist-generated attribute set
+// by the attributes of a line and false if the line does not set it.
+func generatedValue(attrs []string) (generated bool, ok bool) {
+	for _, attr := range attrs {
+		switch {
+		case attr == generatedAttribute || attr == generatedAttribute+"=true":
+			generated, ok = true, true
+		case attr == "-"+generatedAttribute || attr == "!"+generatedAttribute || attr == generatedAttribute+"=false":
+			generated, ok = false, true
+		}
+	}
+	return generated, ok
+}
+
+// isGenerated returns true if the file is marked as generated. It is safe to
+// call on a nil generatedFiles.
+func (g *generatedFiles) isGenerated(f *pull.File) bool {
+	if g == nil {
+		return false
+	}
+
+	generated := false
+	for _, p := range g.patterns {
+		if p.re.MatchString(f.Filename) {
+			generated = p.generated
+		}
+	}
+	return generated
+}
+
+// GlobToRegexp converts a .gitattributes pattern to a regular expression.
+// Patterns without a slash match files in any directory. Patterns with a
+// slash are relative to the root of the repository.
+func GlobToRegexp(pattern string) (*regexp.Regexp, error) {
+	if strings.HasSuffix(pattern, "/") {
+		return nil, errors.Errorf("pattern %q matches directories", pattern)
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, errors.Errorf("pattern %q has an unterminated character class", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+const testGitAttributes = `
+# generated code
+*.pb.go linguist-generated
+/gen/** linguist-generated=true
+docs/api/*.md linguist-generated text
+gen/handwritten.go -linguist-generated
+vendor/** linguist-vendored
+*.png binary
+`
+
+func TestGeneratedFiles(t *testing.T) {
+	g := parseGeneratedFiles([]byte(testGitAttributes))
+
+	tests := map[string]bool{
+		"api.pb.go":             true,
+		"server/api/api.pb.go":  true,
+		"gen/client.go":         true,
+		"gen/v1/models.go":      true,
+		"gen/handwritten.go":    false,
+		"server/gen/client.go":  false,
+		"docs/api/users.md":     true,
+		"docs/api/v1/users.md":  false,
+		"docs/guide.md":         false,
+		"vendor/lib/lib.go":     false,
+		"assets/logo.png":       false,
+		"server/api/api.pb.go2": false,
+	}
+
+	for name, expected := range tests {
+		assert.Equal(t, expected, g.isGenerated(&pull.File{Filename: name}), "incorrect result for %s", name)
+	}
+
+	var missing *generatedFiles
+	assert.False(t, missing.isGenerated(&pull.File{Filename: "api.pb.go"}))
+}
+
+func TestExcludeGenerated(t *testing.T) {
+	ctx := context.Background()
+
+	prctx := pulltest.New().
+		WithBaseFile(".gitattributes", []byte(testGitAttributes)).
+		WithFiles(
+			&pull.File{Filename: "server/api/api.pb.go", Status: pull.FileModified},
+			&pull.File{Filename: "gen/client.go", Status: pull.FileModified},
+		).
+		Build()
+
+	changed := &ChangedFiles{Paths: []string{".*\\.go"}}
+	ok, _, err := changed.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.True(t, ok, "generated files should match by default")
+
+	changed.ExcludeGenerated = true
+	ok, _, err = changed.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.False(t, ok, "generated files should not match")
+
+	only := &OnlyChangedFiles{Paths: []string{"docs/.*"}, ExcludeGenerated: true}
+	ok, desc, err := only.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.False(t, ok, "pull requests with only generated files should not match")
+	assert.Equal(t, "No files changed", desc)
+
+	prctx.ChangedFilesValue = append(prctx.ChangedFilesValue, &pull.File{Filename: "docs/guide.md", Status: pull.FileAdded})
+	ok, _, err = only.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.True(t, ok, "generated files should be ignored")
+}
@@ -0,0 +1,227 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+const languageAttribute = "linguist-language"
+
+// languagesByFilename and languagesByExtension classify files using a subset
+// of the names and extensions in GitHub's linguist. Filenames take precedence
+// over extensions. Extensions are lowercase.
+var (
+	languagesByFilename = map[string]string{
+		"Dockerfile":  "Dockerfile",
+		"Makefile":    "Makefile",
+		"GNUmakefile": "Makefile",
+		"BUILD":       "Starlark",
+		"BUILD.bazel": "Starlark",
+		"WORKSPACE":   "Starlark",
+		"Jenkinsfile": "Groovy",
+		"Gemfile":     "Ruby",
+		"Rakefile":    "Ruby",
+	}
+
+	languagesByExtension = map[string]string{
+		".bash":       "Shell",
+		".bzl":        "Starlark",
+		".c":          "C",
+		".cc":         "C++",
+		".cjs":        "JavaScript",
+		".clj":        "Clojure",
+		".cpp":        "C++",
+		".cs":         "C#",
+		".css":        "CSS",
+		".cxx":        "C++",
+		".dart":       "Dart",
+		".dockerfile": "Dockerfile",
+		".erl":        "Erlang",
+		".ex":         "Elixir",
+		".exs":        "Elixir",
+		".go":         "Go",
+		".gql":        "GraphQL",
+		".gradle":     "Gradle",
+		".graphql":    "GraphQL",
+		".groovy":     "Groovy",
+		".h":          "C",
+		".hcl":        "HCL",
+		".hh":         "C++",
+		".hpp":        "C++",
+		".hs":         "Haskell",
+		".htm":        "HTML",
+		".html":       "HTML",
+		".java":       "Java",
+		".js":         "JavaScript",
+		".json":       "JSON",
+		".jsonnet":    "Jsonnet",
+		".jsx":        "JavaScript",
+		".kt":         "Kotlin",
+		".kts":        "Kotlin",
+		".libsonnet":  "Jsonnet",
+		".lua":        "Lua",
+		".m":          "Objective-C",
+		".markdown":   "Markdown",
+		".md":         "Markdown",
+		".mjs":        "JavaScript",
+		".mk":         "Makefile",
+		".php":        "PHP",
+		".pl":         "Perl",
+		".pm":         "Perl",
+		".proto":      "Protocol Buffer",
+		".ps1":        "PowerShell",
+		".py":         "Python",
+		".r":          "R",
+		".rb":         "Ruby",
+		".rs":         "Rust",
+		".scala":      "Scala",
+		".scss":       "SCSS",
+		".sh":         "Shell",
+		".sql":        "SQL",
+		".swift":      "Swift",
+		".tf":         "Terraform",
+		".tfvars":     "Terraform",
+		".toml":       "TOML",
+		".ts":         "TypeScript",
+		".tsx":        "TSX",
+		".vue":        "Vue",
+		".xml":        "XML",
+		".yaml":       "YAML",
+		".yml":        "YAML",
+		".zsh":        "Shell",
+	}
+)
+
+// ChangedLanguages is satisfied if at least one changed file is written in
+// one of the listed languages. Languages use the names from GitHub's
+// linguist, like "SQL" or "Terraform", and are compared case-insensitively.
+// The linguist-language attribute in the .gitattributes file on the base
+// branch overrides the language of matching files.
+type ChangedLanguages []string
+
+var _ Predicate = ChangedLanguages{}
+
+func (pred ChangedLanguages) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	content, err := prctx.BaseFileContent(ctx, gitAttributesPath)
+	if err != nil {
+		return false, "", errors.WithMessage(err, "failed to load "+gitAttributesPath)
+	}
+	overrides := parseLanguageOverrides(content)
+
+	matched := false
+	err = prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		lang := overrides.language(f.Filename)
+		for _, l := range pred {
+			if lang != "" && sameLanguage(lang, l) {
+				matched = true
+				break
+			}
+		}
+		return !matched
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	if matched {
+		return true, "", nil
+	}
+
+	desc := fmt.Sprintf("No changed files are written in any of the languages %q", []string(pred))
+	return false, desc, nil
+}
+
+// sameLanguage returns true if two language names are equal ignoring case.
+// Dashes and spaces are equivalent, because attribute values cannot contain
+// spaces.
+func sameLanguage(a, b string) bool {
+	return strings.EqualFold(strings.Replace(a, " ", "-", -1), strings.Replace(b, " ", "-", -1))
+}
+
+// languageOverride is a line of a .gitattributes file that sets the
+// linguist-language attribute.
+type languageOverride struct {
+	re       *regexp.Regexp
+	language string
+}
+
+// languageOverrides classifies files using the linguist-language attribute
+// and falls back to the filename and extension. As in git, the last matching
+// line decides the attribute.
+type languageOverrides struct {
+	overrides []languageOverride
+}
+
+// parseLanguageOverrides parses the content of a .gitattributes file. Lines
+// with invalid patterns are ignored, like git does.
+func parseLanguageOverrides(content []byte) *languageOverrides {
+	o := &languageOverrides{}
+
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var language string
+		for _, attr := range fields[1:] {
+			if strings.HasPrefix(attr, languageAttribute+"=") {
+				language = strings.TrimPrefix(attr, languageAttribute+"=")
+			}
+		}
+		if language == "" {
+			continue
+		}
+
+		re, err := GlobToRegexp(fields[0])
+		if err != nil {
+			continue
+		}
+		o.overrides = append(o.overrides, languageOverride{re: re, language: language})
+	}
+	return o
+}
+
+// language returns the language of the file or an empty string if the
+// language is unknown.
+func (o *languageOverrides) language(filename string) string {
+	language := ""
+	for _, override := range o.overrides {
+		if override.re.MatchString(filename) {
+			language = override.language
+		}
+	}
+	if language != "" {
+		return language
+	}
+
+	base := path.Base(filename)
+	if lang, ok := languagesByFilename[base]; ok {
+		return lang
+	}
+	return languagesByExtension[strings.ToLower(path.Ext(base))]
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestLanguageOverrides(t *testing.T) {
+	o := parseLanguageOverrides([]byte(`
+*.sql.tmpl linguist-language=SQL
+/deploy/*.conf linguist-language=HCL
+scripts/legacy.sh linguist-vendored
+`))
+
+	tests := map[string]string{
+		"db/migrations/001_init.sql":   "SQL",
+		"db/queries/users.sql.tmpl":    "SQL",
+		"deploy/nomad.conf":            "HCL",
+		"other/deploy/nomad.conf":      "",
+		"infra/main.tf":                "Terraform",
+		"infra/prod.TFVARS":            "Terraform",
+		"server/Dockerfile":            "Dockerfile",
+		"tools/BUILD.bazel":            "Starlark",
+		"scripts/legacy.sh":            "Shell",
+		"README":                       "",
+		"assets/logo.png":              "",
+		"vendor/github.com/lib/lib.go": "Go",
+	}
+
+	for name, expected := range tests {
+		assert.Equal(t, expected, o.language(name), "incorrect language for %s", name)
+	}
+}
+
+func TestChangedLanguages(t *testing.T) {
+	ctx := context.Background()
+
+	prctx := pulltest.New().
+		WithBaseFile(".gitattributes", []byte("*.sql.tmpl linguist-language=SQL\n")).
+		WithFiles(
+			&pull.File{Filename: "server/api.go", Status: pull.FileModified},
+			&pull.File{Filename: "README.md", Status: pull.FileModified},
+		).
+		Build()
+
+	p := ChangedLanguages{"SQL", "terraform"}
+
+	ok, desc, err := p.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.False(t, ok, "no files should match")
+	assert.Equal(t, `No changed files are written in any of the languages ["SQL" "terraform"]`, desc)
+
+	prctx.ChangedFilesValue = append(prctx.ChangedFilesValue, &pull.File{Filename: "infra/main.tf", Status: pull.FileAdded})
+	ok, _, err = p.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.True(t, ok, "Terraform file should match")
+
+	prctx.ChangedFilesValue = []*pull.File{{Filename: "db/users.sql.tmpl", Status: pull.FileDeleted}}
+	ok, _, err = p.Evaluate(ctx, prctx)
+	require.NoError(t, err)
+	assert.True(t, ok, "overridden language should match")
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/oncall"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// HasOpenIncident is satisfied if any of the services, by the names defined
+// in the server configuration, has an open incident in the on-call provider.
+type HasOpenIncident struct {
+	Services []string `yaml:"services"`
+}
+
+var _ Predicate = &HasOpenIncident{}
+
+func (pred *HasOpenIncident) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	provider, err := oncall.ProviderFromContext(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	for _, s := range pred.Services {
+		open, err := provider.HasOpenIncident(ctx, s)
+		if err != nil {
+			return false, "", errors.Wrap(err, "failed to get open incidents")
+		}
+		if open {
+			return true, "", nil
+		}
+	}
+
+	desc := fmt.Sprintf("None of the services %q have an open incident", pred.Services)
+	return false, desc, nil
+}
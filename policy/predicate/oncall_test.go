@@ -0,0 +1,71 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/oncall"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+type staticOnCall struct {
+	incidents map[string]bool
+}
+
+func (p *staticOnCall) OnCallUsers(ctx context.Context, schedule string) ([]string, error) {
+	return nil, nil
+}
+
+func (p *staticOnCall) HasOpenIncident(ctx context.Context, service string) (bool, error) {
+	return p.incidents[service], nil
+}
+
+func TestHasOpenIncident(t *testing.T) {
+	prctx := &pulltest.Context{}
+	p := &HasOpenIncident{
+		Services: []string{"production", "billing"},
+	}
+
+	t.Run("notConfigured", func(t *testing.T) {
+		_, _, err := p.Evaluate(context.Background(), prctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("openIncident", func(t *testing.T) {
+		ctx := oncall.WithProvider(context.Background(), &staticOnCall{
+			incidents: map[string]bool{"billing": true},
+		})
+
+		ok, _, err := p.Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.True(t, ok, "predicate was not satisfied")
+	})
+
+	t.Run("noOpenIncident", func(t *testing.T) {
+		ctx := oncall.WithProvider(context.Background(), &staticOnCall{
+			incidents: map[string]bool{"staging": true},
+		})
+
+		ok, desc, err := p.Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.False(t, ok, "predicate was satisfied")
+		assert.Contains(t, desc, "production")
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+type HasRepositoryTopic struct {
+	Topics []string `yaml:"topics"`
+}
+
+var _ Predicate = &HasRepositoryTopic{}
+
+func (pred *HasRepositoryTopic) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	topics, err := prctx.RepositoryTopics(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get repository topics")
+	}
+
+	for _, topic := range topics {
+		for _, t := range pred.Topics {
+			if topic == t {
+				return true, "", nil
+			}
+		}
+	}
+
+	desc := fmt.Sprintf("The repository does not have any of the required topics %q", pred.Topics)
+	return false, desc, nil
+}
+
+// HasRepositoryProperty is satisfied if every listed custom property of the
+// repository has at least one of the allowed values.
+type HasRepositoryProperty map[string][]string
+
+var _ Predicate = HasRepositoryProperty{}
+
+func (pred HasRepositoryProperty) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	properties, err := prctx.RepositoryCustomProperties(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get repository custom properties")
+	}
+
+	// check properties in a stable order for consistent descriptions
+	names := make([]string, 0, len(pred))
+	for name := range pred {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !anyValueIn(properties[name], pred[name]) {
+			desc := fmt.Sprintf("The repository property %q does not have any of the required values %q", name, pred[name])
+			return false, desc, nil
+		}
+	}
+	return true, "", nil
+}
+
+func anyValueIn(values, allowed []string) bool {
+	for _, v := range values {
+		for _, a := range allowed {
+			if v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SourceRepository is satisfied if the repository that contains the head
+// branch of the pull request meets all of the set conditions. If the source
+// repository was deleted, only the CrossRepository and NotOwners conditions
+// can be satisfied.
+type SourceRepository struct {
+	// CrossRepository, if set, requires the head branch to be in a different
+	// repository than the base branch (true) or the same repository (false).
+	CrossRepository *bool `yaml:"cross_repository"`
+
+	// Fork and Private, if set, require the source repository to have the
+	// same fork or visibility status.
+	Fork    *bool `yaml:"fork"`
+	Private *bool `yaml:"private"`
+
+	// Owners requires the source repository to belong to one of the users or
+	// organizations. NotOwners requires the opposite.
+	Owners    []string `yaml:"owners"`
+	NotOwners []string `yaml:"not_owners"`
+}
+
+var _ Predicate = &SourceRepository{}
+
+func (pred *SourceRepository) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	repo, err := prctx.SourceRepository(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get source repository")
+	}
+
+	name := "(deleted)"
+	if repo != nil {
+		name = repo.FullName()
+	}
+
+	if pred.CrossRepository != nil {
+		isCross := repo == nil || repo.Owner != prctx.RepositoryOwner() || repo.Name != prctx.RepositoryName()
+		if isCross != *pred.CrossRepository {
+			if isCross {
+				return false, fmt.Sprintf("The source repository %s is not the target repository", name), nil
+			}
+			return false, "The source repository is the target repository", nil
+		}
+	}
+
+	if pred.Fork != nil && (repo == nil || repo.Fork != *pred.Fork) {
+		return false, fmt.Sprintf("The source repository %s does not have fork status %t", name, *pred.Fork), nil
+	}
+
+	if pred.Private != nil && (repo == nil || repo.Private != *pred.Private) {
+		return false, fmt.Sprintf("The source repository %s does not have private status %t", name, *pred.Private), nil
+	}
+
+	if len(pred.Owners) > 0 && (repo == nil || !anyValueIn([]string{repo.Owner}, pred.Owners)) {
+		return false, fmt.Sprintf("The source repository %s is not owned by any of %q", name, pred.Owners), nil
+	}
+
+	if len(pred.NotOwners) > 0 && repo != nil && anyValueIn([]string{repo.Owner}, pred.NotOwners) {
+		return false, fmt.Sprintf("The source repository %s is owned by one of %q", name, pred.NotOwners), nil
+	}
+
+	return true, "", nil
+}
+
+// TargetRepository is satisfied if the repository that the pull request
+// targets meets all of the set conditions.
+type TargetRepository struct {
+	// Private, if set, requires the repository to have the same visibility
+	// status. Internal repositories are private.
+	Private *bool `yaml:"private"`
+
+	// Fork, if set, requires the repository to have the same fork status.
+	Fork *bool `yaml:"fork"`
+}
+
+var _ Predicate = &TargetRepository{}
+
+func (pred *TargetRepository) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	repo, err := prctx.TargetRepository(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get target repository")
+	}
+
+	if pred.Private != nil && repo.Private != *pred.Private {
+		return false, fmt.Sprintf("The repository %s does not have private status %t", repo.FullName(), *pred.Private), nil
+	}
+
+	if pred.Fork != nil && repo.Fork != *pred.Fork {
+		return false, fmt.Sprintf("The repository %s does not have fork status %t", repo.FullName(), *pred.Fork), nil
+	}
+
+	return true, "", nil
+}
+
+// RepositoryContains is satisfied if at least one of the files exists on the
+// target branch of the pull request and its content satisfies the patterns.
+// Paths are exact paths relative to the root of the repository.
+type RepositoryContains struct {
+	Paths []string `yaml:"paths"`
+
+	TextPatterns `yaml:",inline"`
+}
+
+var _ Predicate = &RepositoryContains{}
+
+func (pred *RepositoryContains) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	base, _, err := prctx.Branches(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get base branch")
+	}
+
+	desc := fmt.Sprintf("The target branch does not contain any of the files %q", pred.Paths)
+	for _, p := range pred.Paths {
+		content, err := prctx.RefFileContent(ctx, p, base)
+		if err != nil {
+			return false, "", errors.Wrapf(err, "failed to get contents of %s", p)
+		}
+		if content == nil {
+			continue
+		}
+
+		matched, matchDesc, err := pred.evaluate(fmt.Sprintf("The content of %s", p), string(content))
+		if err != nil {
+			return false, "", err
+		}
+		if matched {
+			return true, "", nil
+		}
+		desc = matchDesc
+	}
+	return false, desc, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestHasRepositoryTopic(t *testing.T) {
+	p := &HasRepositoryTopic{
+		Topics: []string{"tier-0", "critical"},
+	}
+
+	runTargetsTestCase(t, p, []targetsTestCase{
+		{
+			"noTopics",
+			false,
+			&pulltest.Context{},
+		},
+		{
+			"matchingTopic",
+			true,
+			&pulltest.Context{
+				RepositoryTopicsValue: []string{"go", "tier-0"},
+			},
+		},
+		{
+			"otherTopics",
+			false,
+			&pulltest.Context{
+				RepositoryTopicsValue: []string{"go", "tier-1"},
+			},
+		},
+	})
+}
+
+func TestHasRepositoryProperty(t *testing.T) {
+	p := HasRepositoryProperty{
+		"tier":  {"0", "1"},
+		"owner": {"infra"},
+	}
+
+	runTargetsTestCase(t, p, []targetsTestCase{
+		{
+			"noProperties",
+			false,
+			&pulltest.Context{},
+		},
+		{
+			"allPropertiesMatch",
+			true,
+			&pulltest.Context{
+				RepositoryCustomPropertiesValue: map[string][]string{
+					"tier":  {"0"},
+					"owner": {"infra", "security"},
+				},
+			},
+		},
+		{
+			"somePropertiesMatch",
+			false,
+			&pulltest.Context{
+				RepositoryCustomPropertiesValue: map[string][]string{
+					"tier":  {"1"},
+					"owner": {"security"},
+				},
+			},
+		},
+		{
+			"missingProperty",
+			false,
+			&pulltest.Context{
+				RepositoryCustomPropertiesValue: map[string][]string{
+					"tier": {"0"},
+				},
+			},
+		},
+	})
+}
+
+func TestSourceRepository(t *testing.T) {
+	yes, no := true, false
+
+	sameRepo := &pull.Repository{Owner: "pulltest", Name: "context"}
+	fork := &pull.Repository{Owner: "ttest", Name: "context", Fork: true}
+	privateFork := &pull.Repository{Owner: "ttest", Name: "context", Fork: true, Private: true}
+
+	t.Run("crossRepository", func(t *testing.T) {
+		runTargetsTestCase(t, &SourceRepository{CrossRepository: &yes}, []targetsTestCase{
+			{"sameRepository", false, &pulltest.Context{SourceRepositoryValue: sameRepo}},
+			{"fork", true, &pulltest.Context{SourceRepositoryValue: fork}},
+			{"deleted", true, &pulltest.Context{}},
+		})
+	})
+
+	t.Run("notCrossRepository", func(t *testing.T) {
+		runTargetsTestCase(t, &SourceRepository{CrossRepository: &no}, []targetsTestCase{
+			{"sameRepository", true, &pulltest.Context{SourceRepositoryValue: sameRepo}},
+			{"fork", false, &pulltest.Context{SourceRepositoryValue: fork}},
+		})
+	})
+
+	t.Run("privateFork", func(t *testing.T) {
+		runTargetsTestCase(t, &SourceRepository{Fork: &yes, Private: &yes}, []targetsTestCase{
+			{"publicFork", false, &pulltest.Context{SourceRepositoryValue: fork}},
+			{"privateFork", true, &pulltest.Context{SourceRepositoryValue: privateFork}},
+			{"deleted", false, &pulltest.Context{}},
+		})
+	})
+
+	t.Run("owners", func(t *testing.T) {
+		runTargetsTestCase(t, &SourceRepository{Owners: []string{"pulltest"}}, []targetsTestCase{
+			{"insideOwner", true, &pulltest.Context{SourceRepositoryValue: sameRepo}},
+			{"outsideOwner", false, &pulltest.Context{SourceRepositoryValue: fork}},
+			{"deleted", false, &pulltest.Context{}},
+		})
+	})
+
+	t.Run("notOwners", func(t *testing.T) {
+		runTargetsTestCase(t, &SourceRepository{NotOwners: []string{"pulltest"}}, []targetsTestCase{
+			{"insideOwner", false, &pulltest.Context{SourceRepositoryValue: sameRepo}},
+			{"outsideOwner", true, &pulltest.Context{SourceRepositoryValue: fork}},
+			{"deleted", true, &pulltest.Context{}},
+		})
+	})
+}
+
+func TestTargetRepository(t *testing.T) {
+	yes, no := true, false
+
+	public := &pull.Repository{Owner: "pulltest", Name: "context"}
+	private := &pull.Repository{Owner: "pulltest", Name: "context", Private: true}
+	privateFork := &pull.Repository{Owner: "pulltest", Name: "context", Private: true, Fork: true}
+
+	t.Run("private", func(t *testing.T) {
+		runTargetsTestCase(t, &TargetRepository{Private: &yes}, []targetsTestCase{
+			{"public", false, &pulltest.Context{TargetRepositoryValue: public}},
+			{"private", true, &pulltest.Context{TargetRepositoryValue: private}},
+		})
+	})
+
+	t.Run("public", func(t *testing.T) {
+		runTargetsTestCase(t, &TargetRepository{Private: &no}, []targetsTestCase{
+			{"public", true, &pulltest.Context{TargetRepositoryValue: public}},
+			{"private", false, &pulltest.Context{TargetRepositoryValue: private}},
+		})
+	})
+
+	t.Run("privateNotFork", func(t *testing.T) {
+		runTargetsTestCase(t, &TargetRepository{Private: &yes, Fork: &no}, []targetsTestCase{
+			{"private", true, &pulltest.Context{TargetRepositoryValue: private}},
+			{"privateFork", false, &pulltest.Context{TargetRepositoryValue: privateFork}},
+		})
+	})
+}
+
+func TestRepositoryContains(t *testing.T) {
+	codeowners := pulltest.New().
+		WithBranches("develop", "feature").
+		WithRefFile("develop", ".github/CODEOWNERS", []byte("* @example/owners\n")).
+		Build()
+
+	security := pulltest.New().
+		WithBranches("develop", "feature").
+		WithBaseFile("SECURITY.md", []byte("# Security Policy\n\nEmail security@example.com.\n")).
+		Build()
+
+	unrelated := pulltest.New().
+		WithBranches("develop", "feature").
+		WithRefFile("feature", "CODEOWNERS", []byte("* @example/owners\n")).
+		Build()
+
+	t.Run("exists", func(t *testing.T) {
+		p := &RepositoryContains{
+			Paths: []string{"CODEOWNERS", ".github/CODEOWNERS", "docs/CODEOWNERS"},
+		}
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"codeowners", true, codeowners},
+			{"security", false, security},
+			{"headBranchOnly", false, unrelated},
+		})
+	})
+
+	t.Run("matches", func(t *testing.T) {
+		p := &RepositoryContains{
+			Paths: []string{"SECURITY.md"},
+			TextPatterns: TextPatterns{
+				Matches: []string{`security@example\.com`},
+			},
+		}
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"security", true, security},
+			{"codeowners", false, codeowners},
+		})
+
+		p.Matches = []string{`vulnerabilities@example\.com`}
+		runTargetsTestCase(t, p, []targetsTestCase{
+			{"security", false, security},
+		})
+	})
+}
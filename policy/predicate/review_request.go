@@ -0,0 +1,59 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// ReviewRequested is satisfied if the pull request has a pending review
+// request for one of the users or teams. Teams use the "org/team-slug" form
+// and are compared case-insensitively. GitHub removes a request when the
+// user or a member of the team submits a review.
+type ReviewRequested struct {
+	Users []string `yaml:"users"`
+	Teams []string `yaml:"teams"`
+}
+
+var _ Predicate = &ReviewRequested{}
+
+func (pred *ReviewRequested) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	requests, err := prctx.RequestedReviewers(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get review requests")
+	}
+
+	for _, u := range requests.Users {
+		for _, want := range pred.Users {
+			if strings.EqualFold(u, want) {
+				return true, "", nil
+			}
+		}
+	}
+	for _, t := range requests.Teams {
+		for _, want := range pred.Teams {
+			if strings.EqualFold(t, want) {
+				return true, "", nil
+			}
+		}
+	}
+
+	return false, "No review is requested from the required users or teams", nil
+}
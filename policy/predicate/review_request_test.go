@@ -0,0 +1,58 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestReviewRequested(t *testing.T) {
+	p := &ReviewRequested{
+		Users: []string{"mhaypenny"},
+		Teams: []string{"cool-org/Security"},
+	}
+
+	runTargetsTestCase(t, p, []targetsTestCase{
+		{
+			"userRequested",
+			true,
+			&pulltest.Context{
+				RequestedReviewersValue: []string{"ttest", "mhaypenny"},
+			},
+		},
+		{
+			"teamRequested",
+			true,
+			&pulltest.Context{
+				RequestedTeamsValue: []string{"cool-org/security"},
+			},
+		},
+		{
+			"otherTeamRequested",
+			false,
+			&pulltest.Context{
+				RequestedReviewersValue: []string{"ttest"},
+				RequestedTeamsValue:     []string{"cool-org/platform"},
+			},
+		},
+		{
+			"noRequests",
+			false,
+			&pulltest.Context{},
+		},
+	})
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// DefaultSecretEntropy is the Shannon entropy, in bits per character, above
+// which a long token is reported as a possible secret.
+const DefaultSecretEntropy = 4.5
+
+// minEntropyTokenLength is the length of the shortest token checked for high
+// entropy. Shorter tokens are too common in code to report.
+const minEntropyTokenLength = 20
+
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var secretPatterns = []secretPattern{
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"AWS secret access key", regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+}
+
+var (
+	entropyTokenPattern = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{20,}`)
+	hunkHeaderPattern   = regexp.MustCompile(`^@@ -[0-9]+(?:,[0-9]+)? \+([0-9]+)(?:,[0-9]+)? @@`)
+)
+
+// SecretFinding is a possible secret in a line added by a pull request.
+type SecretFinding struct {
+	Path string
+	Line int
+	Kind string
+}
+
+func (f *SecretFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Kind)
+}
+
+// ContainsSecrets is satisfied if lines added by the pull request contain
+// possible secrets, like cloud provider keys, private keys, or long strings
+// with high entropy. Rules use it to require approval from a security team
+// when a pull request may leak credentials. Files without a patch, like
+// binary files or files with very large changes, are not scanned.
+type ContainsSecrets struct {
+	// Patterns are additional regular expressions that match secrets.
+	Patterns []string `yaml:"patterns"`
+
+	// IgnorePaths are regular expressions for files that are not scanned,
+	// like test fixtures with fake keys.
+	IgnorePaths []string `yaml:"ignore_paths"`
+
+	// Entropy is the entropy above which long tokens are reported. If zero,
+	// DefaultSecretEntropy is used.
+	Entropy float64 `yaml:"entropy"`
+
+	// IgnoreEntropy disables reporting tokens with high entropy, so that only
+	// lines matching a pattern are reported.
+	IgnoreEntropy bool `yaml:"ignore_entropy"`
+}
+
+var _ Predicate = &ContainsSecrets{}
+
+func (pred *ContainsSecrets) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	findings, err := pred.Findings(ctx, prctx)
+	if err != nil {
+		return false, "", err
+	}
+	if len(findings) == 0 {
+		return false, "No possible secrets were found in added lines", nil
+	}
+	return true, "", nil
+}
+
+// Findings returns the possible secrets in the lines added by the pull
+// request. A line is reported at most once.
+func (pred *ContainsSecrets) Findings(ctx context.Context, prctx pull.Context) ([]*SecretFinding, error) {
+	patterns := append([]secretPattern(nil), secretPatterns...)
+	for _, p := range pred.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse secret pattern %q", p)
+		}
+		patterns = append(patterns, secretPattern{kind: "custom pattern", re: re})
+	}
+
+	ignored, err := pathsToRegexps(pred.IgnorePaths)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse ignored paths")
+	}
+
+	threshold := pred.Entropy
+	if threshold <= 0 {
+		threshold = DefaultSecretEntropy
+	}
+
+	var findings []*SecretFinding
+	err = prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if f.Patch == "" || anyMatches(ignored, f.Filename) {
+			return true
+		}
+		forEachAddedLine(f.Patch, func(line int, text string) {
+			if kind := pred.secretKind(patterns, threshold, text); kind != "" {
+				findings = append(findings, &SecretFinding{Path: f.Filename, Line: line, Kind: kind})
+			}
+		})
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+	return findings, nil
+}
+
+// secretKind returns the kind of the first possible secret in the text or
+// an empty string if there is none.
+func (pred *ContainsSecrets) secretKind(patterns []secretPattern, threshold float64, text string) string {
+	for _, p := range patterns {
+		if p.re.MatchString(text) {
+			return p.kind
+		}
+	}
+	if !pred.IgnoreEntropy {
+		for _, token := range entropyTokenPattern.FindAllString(text, -1) {
+			if len(token) >= minEntropyTokenLength && shannonEntropy(token) > threshold {
+				return "high entropy string"
+			}
+		}
+	}
+	return ""
+}
+
+// forEachAddedLine calls fn with the line number in the new file and the text
+// of each line added by a unified diff patch.
+func forEachAddedLine(patch string, fn func(line int, text string)) {
+	line := 0
+	for _, l := range strings.Split(patch, "\n") {
+		if m := hunkHeaderPattern.FindStringSubmatch(l); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, "+"):
+			fn(line, l[1:])
+			line++
+		case strings.HasPrefix(l, "-"), strings.HasPrefix(l, `\`):
+			// removed lines and "no newline" markers are not in the new file
+		default:
+			line++
+		}
+	}
+}
+
+// shannonEntropy returns the entropy of the characters in s in bits per
+// character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
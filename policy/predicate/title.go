@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// TextPatterns matches text against regular expressions. It is satisfied if
+// the text matches at least one pattern in Matches (or Matches is empty) and
+// does not match any pattern in NotMatches.
+type TextPatterns struct {
+	Matches    []string `yaml:"matches"`
+	NotMatches []string `yaml:"not_matches"`
+}
+
+// evaluate returns true if the text satisfies the patterns. If it does not, it
+// returns a description of the failed condition that starts with the given
+// name of the text.
+func (tp *TextPatterns) evaluate(name, text string) (bool, string, error) {
+	matches, err := pathsToRegexps(tp.Matches)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse matches")
+	}
+
+	notMatches, err := pathsToRegexps(tp.NotMatches)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse not_matches")
+	}
+
+	if len(matches) > 0 && !anyMatches(matches, text) {
+		return false, fmt.Sprintf("%s does not match any required pattern", name), nil
+	}
+
+	for i, r := range notMatches {
+		if r.MatchString(text) {
+			return false, fmt.Sprintf("%s matches the excluded pattern %q", name, tp.NotMatches[i]), nil
+		}
+	}
+
+	return true, "", nil
+}
+
+type Title struct {
+	TextPatterns `yaml:",inline"`
+}
+
+var _ Predicate = &Title{}
+
+func (pred *Title) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	title, err := prctx.Title(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get title")
+	}
+	return pred.evaluate("Title", title)
+}
+
+type Body struct {
+	TextPatterns `yaml:",inline"`
+}
+
+var _ Predicate = &Body{}
+
+func (pred *Body) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	body, err := prctx.Body(ctx)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get body")
+	}
+	return pred.evaluate("Body", body)
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestTitle(t *testing.T) {
+	p := &Title{
+		TextPatterns: TextPatterns{
+			Matches:    []string{`^[A-Z]+-[0-9]+: `, `\[skip-review\]`},
+			NotMatches: []string{`(?i)^wip\b`},
+		},
+	}
+
+	runTargetsTestCase(t, p, []targetsTestCase{
+		{
+			"ticketInTitle",
+			true,
+			&pulltest.Context{
+				TitleValue: "PB-123: fix the thing",
+			},
+		},
+		{
+			"skipReview",
+			true,
+			&pulltest.Context{
+				TitleValue: "Bump version [skip-review]",
+			},
+		},
+		{
+			"noMatch",
+			false,
+			&pulltest.Context{
+				TitleValue: "fix the thing",
+			},
+		},
+		{
+			"excluded",
+			false,
+			&pulltest.Context{
+				TitleValue: "WIP [skip-review]",
+			},
+		},
+	})
+
+	t.Run("onlyNotMatches", func(t *testing.T) {
+		p := &Title{
+			TextPatterns: TextPatterns{
+				NotMatches: []string{`(?i)^wip\b`},
+			},
+		}
+
+		ok, _, err := p.Evaluate(context.Background(), &pulltest.Context{TitleValue: "fix the thing"})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, desc, err := p.Evaluate(context.Background(), &pulltest.Context{TitleValue: "wip: fix the thing"})
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, `Title matches the excluded pattern "(?i)^wip\\b"`, desc)
+	})
+
+	t.Run("invalidPattern", func(t *testing.T) {
+		p := &Title{
+			TextPatterns: TextPatterns{
+				Matches: []string{`(`},
+			},
+		}
+
+		_, _, err := p.Evaluate(context.Background(), &pulltest.Context{})
+		assert.Error(t, err)
+	})
+}
+
+func TestBody(t *testing.T) {
+	p := &Body{
+		TextPatterns: TextPatterns{
+			Matches:    []string{`(?m)^- \[x\] I have tested this change`},
+			NotMatches: []string{`(?m)^- \[ \]`},
+		},
+	}
+
+	runTargetsTestCase(t, p, []targetsTestCase{
+		{
+			"allChecked",
+			true,
+			&pulltest.Context{
+				BodyValue: "Summary\n\n- [x] I have tested this change\n- [x] I updated the docs\n",
+			},
+		},
+		{
+			"unchecked",
+			false,
+			&pulltest.Context{
+				BodyValue: "Summary\n\n- [x] I have tested this change\n- [ ] I updated the docs\n",
+			},
+		},
+		{
+			"empty",
+			false,
+			&pulltest.Context{},
+		},
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+const workflowsDir = ".github/workflows/"
+
+// ChangedWorkflows is satisfied if the pull request adds, modifies, renames,
+// or deletes a GitHub Actions workflow in the .github/workflows directory or
+// the action.yml metadata file of an action in any directory. Workflows run
+// with access to repository secrets, so these changes often need a stricter
+// review than other files.
+type ChangedWorkflows bool
+
+var _ Predicate = ChangedWorkflows(false)
+
+func (pred ChangedWorkflows) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	matched := false
+	err := prctx.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		for _, p := range f.Paths() {
+			if IsWorkflowFile(p) {
+				matched = true
+				break
+			}
+		}
+		return !matched
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	if matched == bool(pred) {
+		return true, "", nil
+	}
+
+	desc := "No GitHub Actions workflows or actions changed"
+	if !pred {
+		desc = "A GitHub Actions workflow or action changed"
+	}
+	return false, desc, nil
+}
+
+// IsWorkflowFile returns true if the path is a GitHub Actions workflow or
+// action metadata file.
+func IsWorkflowFile(p string) bool {
+	if strings.HasPrefix(p, workflowsDir) {
+		return true
+	}
+	switch path.Base(p) {
+	case "action.yml", "action.yaml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestIsWorkflowFile(t *testing.T) {
+	tests := map[string]bool{
+		".github/workflows/ci.yml":         true,
+		".github/workflows/nested/lib.sh":  true,
+		"action.yml":                       true,
+		"actions/deploy/action.yaml":       true,
+		".github/CODEOWNERS":               false,
+		"docs/.github/workflows/ci.yml":    false,
+		"actions/deploy/action.yml.orig":   false,
+		"src/github/workflows/workflow.go": false,
+	}
+
+	for p, expected := range tests {
+		assert.Equal(t, expected, IsWorkflowFile(p), "incorrect result for %s", p)
+	}
+}
+
+func TestChangedWorkflows(t *testing.T) {
+	ctx := context.Background()
+	changed := ChangedWorkflows(true)
+	unchanged := ChangedWorkflows(false)
+
+	runTest := func(t *testing.T, pred ChangedWorkflows, expected bool, files ...*pull.File) {
+		prctx := pulltest.New().WithFiles(files...).Build()
+		ok, _, err := pred.Evaluate(ctx, prctx)
+		require.NoError(t, err)
+		assert.Equal(t, expected, ok)
+	}
+
+	t.Run("modified", func(t *testing.T) {
+		f := &pull.File{Filename: ".github/workflows/ci.yml", Status: pull.FileModified}
+		runTest(t, changed, true, f)
+		runTest(t, unchanged, false, f)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		runTest(t, changed, true, &pull.File{Filename: "tools/action.yml", Status: pull.FileDeleted})
+	})
+
+	t.Run("renamedOut", func(t *testing.T) {
+		runTest(t, changed, true, &pull.File{Filename: "ci.yml.bak", PreviousFilename: ".github/workflows/ci.yml", Status: pull.FileModified})
+	})
+
+	t.Run("noWorkflows", func(t *testing.T) {
+		f := &pull.File{Filename: "app/main.go", Status: pull.FileModified}
+		runTest(t, changed, false, f)
+		runTest(t, unchanged, true, f)
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
+)
+
+// schemaOverrides are the schemas of types that have custom YAML parsing or
+// that cannot be described by their Go type.
+var schemaOverrides = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(time.Duration(0)):        {"type": "string"},
+	reflect.TypeOf(common.Duration(0)):      {"type": "string"},
+	reflect.TypeOf(common.ByteSize(0)):      {"type": []string{"string", "integer"}},
+	reflect.TypeOf(approval.Policy(nil)):    {"$ref": "#/definitions/approvalPolicy"},
+	reflect.TypeOf(predicate.LastPushAge{}): {"type": "string"},
+}
+
+// Schema returns a JSON Schema for policy files. The schema is generated from
+// the Config and RemoteConfig types, so it describes the structure of a policy
+// but not all of its constraints. Policies that match the schema may still be
+// invalid, like when they reference rules that are not defined.
+func Schema() map[string]interface{} {
+	remote := typeSchema(reflect.TypeOf(RemoteConfig{}))
+	remote["required"] = []string{"remote"}
+
+	return map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "policy-bot policy",
+		"anyOf": []interface{}{
+			typeSchema(reflect.TypeOf(Config{})),
+			remote,
+		},
+		"definitions": map[string]interface{}{
+			"approvalPolicy": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"anyOf": []interface{}{
+						map[string]interface{}{"type": "string"},
+						map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"and": map[string]interface{}{"$ref": "#/definitions/approvalPolicy"},
+								"or":  map[string]interface{}{"$ref": "#/definitions/approvalPolicy"},
+							},
+							"additionalProperties": false,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if s, ok := schemaOverrides[t]; ok {
+		return copySchema(s)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		addProperties(properties, t)
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+
+	// interfaces and other types accept any value
+	return map[string]interface{}{}
+}
+
+// addProperties adds the schemas of the fields of a struct to properties,
+// following the same rules for names and inlining as the YAML parser.
+func addProperties(properties map[string]interface{}, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		inline := false
+		for _, flag := range parts[1:] {
+			inline = inline || flag == "inline"
+		}
+
+		if inline {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			addProperties(properties, ft)
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		properties[name] = typeSchema(f.Type)
+	}
+}
+
+func copySchema(s map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(s))
+	for k, v := range s {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Directories returns the sorted directories that contain the changed files,
+// truncated to the given number of path components. Files at the root of the
+// repository and files in directories with fewer components are not in any
+// directory. Renamed files are in the directories of both paths.
+func Directories(files []*pull.File, depth int) []string {
+	if depth <= 0 {
+		depth = 1
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range files {
+		for _, path := range f.Paths() {
+			parts := strings.Split(path, "/")
+			if len(parts) <= depth {
+				continue
+			}
+			seen[strings.Join(parts[:depth], "/")] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// ScopeToDirectory returns a pull.Context in which the changed files only
+// include files in the directory, so that a policy evaluated with it only
+// considers changes to the directory. A renamed file is included if either
+// its current or previous path is in the directory.
+func ScopeToDirectory(prctx pull.Context, dir string) pull.Context {
+	return &directoryContext{Context: prctx, prefix: strings.TrimSuffix(dir, "/") + "/"}
+}
+
+type directoryContext struct {
+	pull.Context
+	prefix string
+}
+
+func (c *directoryContext) ChangedFiles(ctx context.Context) ([]*pull.File, error) {
+	files, err := c.Context.ChangedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []*pull.File
+	for _, f := range files {
+		if c.contains(f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
+
+func (c *directoryContext) ChangedFilesIter(ctx context.Context, fn func(*pull.File) bool) error {
+	return c.Context.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		if !c.contains(f) {
+			return true
+		}
+		return fn(f)
+	})
+}
+
+func (c *directoryContext) contains(f *pull.File) bool {
+	for _, path := range f.Paths() {
+		if strings.HasPrefix(path, c.prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// ScansSecrets returns true if any approval rule in the policy uses the
+// contains_secrets predicate.
+func ScansSecrets(config *Config) bool {
+	for _, r := range config.ApprovalRules {
+		if r.Predicates.ContainsSecrets != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretFindings returns the possible secrets found by the contains_secrets
+// predicates of the approval rules in the policy. A secret found by more than
+// one rule is returned once.
+func SecretFindings(ctx context.Context, prctx pull.Context, config *Config) ([]*predicate.SecretFinding, error) {
+	prctx, err := IgnoringPaths(prctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+
+	var findings []*predicate.SecretFinding
+	for _, r := range config.ApprovalRules {
+		pred := r.Predicates.ContainsSecrets
+		if pred == nil {
+			continue
+		}
+
+		ruleFindings, err := pred.Findings(ctx, prctx)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("failed to scan for secrets in rule %q", r.Name))
+		}
+		for _, f := range ruleFindings {
+			if key := f.String(); !seen[key] {
+				seen[key] = true
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings, nil
+}
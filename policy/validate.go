@@ -0,0 +1,246 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ParseConfig parses and validates the contents of a policy file. Unlike
+// ParsePolicy, it rejects unknown fields and returns an error if the policy
+// references rules that do not exist.
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal policy")
+	}
+
+	if _, err := ParsePolicy(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ValidationError is a problem found in a policy file. Line is the line of the
+// file with the problem, or zero if the problem is not tied to a line.
+type ValidationError struct {
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ValidateConfig parses and validates the contents of a policy file like
+// ParseConfig, but returns each problem separately. Problems found by the
+// YAML parser, like unknown fields or values with the wrong type, include the
+// line where they occur. Files that reference a remote policy are validated
+// as a RemoteConfig.
+func ValidateConfig(data []byte) []ValidationError {
+	var raw map[string]interface{}
+	_ = yaml.Unmarshal(data, &raw)
+
+	if _, isRemote := raw["remote"]; isRemote {
+		var remote RemoteConfig
+		if err := yaml.UnmarshalStrict(data, &remote); err != nil {
+			return newValidationErrors(err)
+		}
+		if len(strings.Split(remote.Remote, "/")) != 2 {
+			return []ValidationError{{Message: fmt.Sprintf("remote must have the form owner/repo: %q", remote.Remote)}}
+		}
+		return nil
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return newValidationErrors(err)
+	}
+
+	if _, err := ParsePolicy(&config); err != nil {
+		return []ValidationError{{Message: err.Error()}}
+	}
+	return nil
+}
+
+func newValidationErrors(err error) []ValidationError {
+	var messages []string
+	if terr, ok := err.(*yaml.TypeError); ok {
+		messages = terr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	verrs := make([]ValidationError, 0, len(messages))
+	for _, msg := range messages {
+		verrs = append(verrs, newValidationError(msg))
+	}
+	return verrs
+}
+
+func newValidationError(msg string) ValidationError {
+	if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return ValidationError{Line: line, Message: m[2]}
+	}
+	return ValidationError{Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// Change describes a difference between two versions of a policy file. Name
+// is "policy" for changes to the policy block, "ignore_paths" for changes to
+// the ignored paths, and the rule name for changes to approval rules. Old and New contain the YAML for each version and are
+// empty if the item does not exist in that version.
+type Change struct {
+	Name string
+	Kind ChangeKind
+	Old  string
+	New  string
+}
+
+// DiffConfigs compares two policy files and returns the changes to the policy
+// block, the ignored paths, and each approval rule. The policy block and the
+// ignored paths are listed first, followed by rules in the order they are
+// defined in the new file, followed by any removed rules. Either input may be nil if that version does not exist.
+func DiffConfigs(oldData, newData []byte) ([]Change, error) {
+	oldConfig, err := parseRawConfig(oldData)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to parse old policy")
+	}
+
+	newConfig, err := parseRawConfig(newData)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to parse new policy")
+	}
+
+	var changes []Change
+	if c, ok := diffItem("policy", oldConfig.Policy, newConfig.Policy); ok {
+		changes = append(changes, c)
+	}
+	if c, ok := diffItem("ignore_paths", oldConfig.IgnorePaths, newConfig.IgnorePaths); ok {
+		changes = append(changes, c)
+	}
+
+	oldRules := oldConfig.rulesByName()
+	seen := make(map[string]bool)
+	for _, r := range newConfig.ApprovalRules {
+		name := ruleName(r)
+		seen[name] = true
+		if c, ok := diffItem(name, oldRules[name], r); ok {
+			changes = append(changes, c)
+		}
+	}
+
+	var removed []string
+	for name := range oldRules {
+		if !seen[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, name := range removed {
+		if c, ok := diffItem(name, oldRules[name], nil); ok {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, nil
+}
+
+// rawConfig holds the uninterpreted structure of a policy file so that
+// versions can be compared as written by users.
+type rawConfig struct {
+	Policy        interface{}              `yaml:"policy"`
+	ApprovalRules []map[string]interface{} `yaml:"approval_rules"`
+	IgnorePaths   interface{}              `yaml:"ignore_paths"`
+}
+
+func parseRawConfig(data []byte) (*rawConfig, error) {
+	var c rawConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal policy")
+	}
+	return &c, nil
+}
+
+func (c *rawConfig) rulesByName() map[string]interface{} {
+	rules := make(map[string]interface{})
+	for _, r := range c.ApprovalRules {
+		rules[ruleName(r)] = r
+	}
+	return rules
+}
+
+func ruleName(r map[string]interface{}) string {
+	if name, ok := r["name"].(string); ok {
+		return name
+	}
+	return ""
+}
+
+func diffItem(name string, oldItem, newItem interface{}) (Change, bool) {
+	c := Change{
+		Name: name,
+		Old:  marshalItem(oldItem),
+		New:  marshalItem(newItem),
+	}
+
+	switch {
+	case c.Old == c.New:
+		return c, false
+	case c.Old == "":
+		c.Kind = ChangeAdded
+	case c.New == "":
+		c.Kind = ChangeRemoved
+	default:
+		c.Kind = ChangeModified
+	}
+	return c, true
+}
+
+func marshalItem(item interface{}) string {
+	if item == nil {
+		return ""
+	}
+	if m, ok := item.(map[string]interface{}); ok && m == nil {
+		return ""
+	}
+
+	b, err := yaml.Marshal(item)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,301 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		config, err := ParseConfig([]byte(`
+policy:
+  approval:
+    - rule1
+approval_rules:
+  - name: rule1
+    requires:
+      count: 1
+`))
+		require.NoError(t, err)
+		assert.Len(t, config.ApprovalRules, 1)
+	})
+
+	t.Run("unknownField", func(t *testing.T) {
+		_, err := ParseConfig([]byte(`
+approval_rules:
+  - name: rule1
+    requries:
+      count: 1
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "requries")
+	})
+
+	t.Run("undefinedRule", func(t *testing.T) {
+		_, err := ParseConfig([]byte(`
+policy:
+  approval:
+    - rule2
+approval_rules:
+  - name: rule1
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rule2")
+	})
+
+	t.Run("extends", func(t *testing.T) {
+		config, err := ParseConfig([]byte(`
+policy:
+  approval:
+    - base
+    - strict
+    - docs
+approval_rules:
+  - name: base
+    if:
+      changed_files:
+        paths: ["^src/.*"]
+    options:
+      invalidate_on_push: true
+    requires:
+      count: 1
+      teams: ["org/reviewers"]
+    status_context: policy-bot/base
+  - name: strict
+    extends: base
+    requires:
+      count: 2
+  - name: docs
+    extends: strict
+    if: ~
+    options:
+      allow_author: true
+`))
+		require.NoError(t, err)
+		require.Len(t, config.ApprovalRules, 3)
+
+		strict := config.ApprovalRules[1]
+		assert.Equal(t, "strict", strict.Name)
+		assert.Equal(t, 2, strict.Requires.Count)
+		assert.Equal(t, []string{"org/reviewers"}, strict.Requires.Teams)
+		assert.True(t, strict.Options.InvalidateOnPush)
+		assert.NotNil(t, strict.Predicates.ChangedFiles)
+		assert.Empty(t, strict.StatusContext)
+
+		docs := config.ApprovalRules[2]
+		assert.Equal(t, 2, docs.Requires.Count)
+		assert.True(t, docs.Options.InvalidateOnPush)
+		assert.True(t, docs.Options.AllowAuthor)
+		assert.Nil(t, docs.Predicates.ChangedFiles)
+	})
+
+	t.Run("extendsBuiltinRule", func(t *testing.T) {
+		config, err := ParseConfig([]byte(`
+policy:
+  approval:
+    - workflows
+approval_rules:
+  - name: workflows
+    extends: builtin:workflow-changes
+    requires:
+      count: 2
+`))
+		require.NoError(t, err)
+		require.Len(t, config.ApprovalRules, 1)
+
+		r := config.ApprovalRules[0]
+		assert.Equal(t, "workflows", r.Name)
+		assert.Equal(t, 2, r.Requires.Count)
+		assert.True(t, r.Requires.CIAdmins)
+		assert.True(t, r.Options.InvalidateOnPush)
+		require.NotNil(t, r.Predicates.ChangedWorkflows)
+		assert.True(t, bool(*r.Predicates.ChangedWorkflows))
+	})
+
+	t.Run("extendsUndefinedRule", func(t *testing.T) {
+		_, err := ParseConfig([]byte(`
+approval_rules:
+  - name: rule1
+    extends: rule2
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rule 'rule1' extends undefined rule 'rule2'")
+	})
+
+	t.Run("extendsCycle", func(t *testing.T) {
+		_, err := ParseConfig([]byte(`
+approval_rules:
+  - name: rule1
+    extends: rule2
+  - name: rule2
+    extends: rule1
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rule extensions contain a cycle: rule1 -> rule2 -> rule1")
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		verrs := ValidateConfig([]byte(`
+policy:
+  approval:
+    - rule1
+approval_rules:
+  - name: rule1
+    requires:
+      count: 1
+`))
+		assert.Empty(t, verrs)
+	})
+
+	t.Run("fieldErrors", func(t *testing.T) {
+		verrs := ValidateConfig([]byte(`
+approval_rules:
+  - name: rule1
+    requries:
+      count: 1
+  - name: rule2
+    requires:
+      count: many
+`))
+		require.Len(t, verrs, 2)
+		assert.Equal(t, 4, verrs[0].Line)
+		assert.Contains(t, verrs[0].Message, "requries")
+		assert.Equal(t, 8, verrs[1].Line)
+		assert.Contains(t, verrs[1].Message, "many")
+	})
+
+	t.Run("syntaxError", func(t *testing.T) {
+		verrs := ValidateConfig([]byte("policy:\n  approval: [rule1\n"))
+		require.Len(t, verrs, 1)
+		assert.NotZero(t, verrs[0].Line)
+	})
+
+	t.Run("undefinedRule", func(t *testing.T) {
+		verrs := ValidateConfig([]byte(`
+policy:
+  approval:
+    - rule2
+approval_rules:
+  - name: rule1
+`))
+		require.Len(t, verrs, 1)
+		assert.Zero(t, verrs[0].Line)
+		assert.Contains(t, verrs[0].Message, "rule2")
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		assert.Empty(t, ValidateConfig([]byte("remote: org/policies\npath: policy.yml\n")))
+
+		verrs := ValidateConfig([]byte("remote: org\n"))
+		require.Len(t, verrs, 1)
+		assert.Contains(t, verrs[0].Message, "owner/repo")
+	})
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	options := schema["anyOf"].([]interface{})
+	require.Len(t, options, 2)
+
+	config := options[0].(map[string]interface{})
+	properties := config["properties"].(map[string]interface{})
+	assert.Contains(t, properties, "policy")
+	assert.Contains(t, properties, "approval_rules")
+
+	rules := properties["approval_rules"].(map[string]interface{})
+	rule := rules["items"].(map[string]interface{})
+	ruleProperties := rule["properties"].(map[string]interface{})
+	assert.Contains(t, ruleProperties, "name")
+	assert.Contains(t, ruleProperties, "requires")
+
+	remote := options[1].(map[string]interface{})
+	assert.Equal(t, []string{"remote"}, remote["required"])
+}
+
+func TestDiffConfigs(t *testing.T) {
+	oldPolicy := []byte(`
+policy:
+  approval:
+    - rule1
+    - rule2
+approval_rules:
+  - name: rule1
+    requires:
+      count: 1
+  - name: rule2
+    requires:
+      count: 1
+  - name: rule3
+    requires:
+      count: 1
+`)
+
+	newPolicy := []byte(`
+policy:
+  approval:
+    - rule1
+    - rule4
+approval_rules:
+  - name: rule1
+    requires:
+      count: 1
+  - name: rule4
+    requires:
+      count: 1
+  - name: rule2
+    requires:
+      count: 2
+`)
+
+	t.Run("changes", func(t *testing.T) {
+		changes, err := DiffConfigs(oldPolicy, newPolicy)
+		require.NoError(t, err)
+
+		var summary []string
+		for _, c := range changes {
+			summary = append(summary, string(c.Kind)+" "+c.Name)
+		}
+		assert.Equal(t, []string{
+			"modified policy",
+			"added rule4",
+			"modified rule2",
+			"removed rule3",
+		}, summary)
+
+		assert.Contains(t, changes[2].Old, "count: 1")
+		assert.Contains(t, changes[2].New, "count: 2")
+	})
+
+	t.Run("noChanges", func(t *testing.T) {
+		changes, err := DiffConfigs(oldPolicy, oldPolicy)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("newFile", func(t *testing.T) {
+		changes, err := DiffConfigs(nil, newPolicy)
+		require.NoError(t, err)
+		require.Len(t, changes, 4)
+		for _, c := range changes {
+			assert.Equal(t, ChangeAdded, c.Kind)
+		}
+	})
+}
@@ -0,0 +1,332 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policyaudit evaluates the open pull requests of every repository in
+// an organization against a single policy, without posting statuses or
+// changing anything, and reports whether each pull request complies. The
+// report is evidence for periodic compliance audits.
+package policyaudit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/shurcooL/githubv4"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/handler"
+)
+
+const (
+	DefaultParallelism = 8
+
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Auditor evaluates pull requests with the GitHub App installation of an
+// organization.
+type Auditor struct {
+	ClientCreator githubapp.ClientCreator
+	Installations githubapp.InstallationsService
+
+	// Evaluator is the policy that all pull requests are evaluated against.
+	Evaluator common.Evaluator
+
+	// Options are the evaluation options of the server, used for default
+	// approval methods and ignored commit authors.
+	Options *handler.PullEvaluationOptions
+
+	// Parallelism is the number of pull requests evaluated at the same time.
+	// If unset, DefaultParallelism is used.
+	Parallelism int
+
+	// IncludeArchived also audits archived repositories. Archived
+	// repositories cannot have open pull requests that change, so they are
+	// skipped by default.
+	IncludeArchived bool
+}
+
+// Record is the result of evaluating one pull request.
+type Record struct {
+	Repository  string   `json:"repository"`
+	Number      int      `json:"number"`
+	Title       string   `json:"title"`
+	Author      string   `json:"author"`
+	URL         string   `json:"url"`
+	HeadSHA     string   `json:"head_sha"`
+	Status      string   `json:"status"`
+	Description string   `json:"description,omitempty"`
+	Approvers   []string `json:"approvers,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Compliant returns true if the policy approved the pull request.
+func (r *Record) Compliant() bool {
+	return r.Error == "" && r.Status == common.StatusApproved.String()
+}
+
+// Audit evaluates the open pull requests of all repositories in the
+// organization that the installation can access. Records are sorted by
+// repository and number. Errors evaluating individual pull requests are
+// included in their records; the returned error is only set if the
+// repositories or pull requests could not be listed.
+func (a *Auditor) Audit(ctx context.Context, org string) ([]*Record, error) {
+	logger := zerolog.Ctx(ctx)
+
+	installation, err := a.Installations.GetByOwner(ctx, org)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get installation for %s", org)
+	}
+
+	client, err := a.ClientCreator.NewInstallationClient(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
+	}
+
+	v4client, err := a.ClientCreator.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
+	}
+
+	repos, err := a.listRepositories(ctx, client, org)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info().Msgf("Auditing open pull requests in %d repositories", len(repos))
+
+	parallelism := a.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+
+	var (
+		mu      sync.Mutex
+		records []*Record
+		wg      sync.WaitGroup
+	)
+
+	prs := make(chan *github.PullRequest)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pr := range prs {
+				r := a.evaluate(ctx, client, v4client, pr)
+
+				mu.Lock()
+				records = append(records, r)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var listErr error
+	for _, repo := range repos {
+		if listErr = listOpenPullRequests(ctx, client, repo, prs); listErr != nil {
+			break
+		}
+	}
+	close(prs)
+	wg.Wait()
+
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Repository != records[j].Repository {
+			return records[i].Repository < records[j].Repository
+		}
+		return records[i].Number < records[j].Number
+	})
+	return records, nil
+}
+
+func (a *Auditor) listRepositories(ctx context.Context, client *github.Client, org string) ([]*github.Repository, error) {
+	var repos []*github.Repository
+
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, res, err := client.Apps.ListRepos(ctx, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list installation repositories")
+		}
+		for _, r := range page {
+			if !strings.EqualFold(r.GetOwner().GetLogin(), org) {
+				continue
+			}
+			if r.GetArchived() && !a.IncludeArchived {
+				continue
+			}
+			repos = append(repos, r)
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	sort.Slice(repos, func(i, j int) bool { return repos[i].GetFullName() < repos[j].GetFullName() })
+	return repos, nil
+}
+
+func listOpenPullRequests(ctx context.Context, client *github.Client, repo *github.Repository, prs chan<- *github.PullRequest) error {
+	opt := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, res, err := client.PullRequests.List(ctx, repo.GetOwner().GetLogin(), repo.GetName(), opt)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pull requests in %s", repo.GetFullName())
+		}
+		for _, pr := range page {
+			prs <- pr
+		}
+		if res.NextPage == 0 {
+			return nil
+		}
+		opt.Page = res.NextPage
+	}
+}
+
+func (a *Auditor) evaluate(ctx context.Context, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest) *Record {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+
+	record := &Record{
+		Repository: pr.GetBase().GetRepo().GetFullName(),
+		Number:     pr.GetNumber(),
+		Title:      pr.GetTitle(),
+		Author:     pr.GetUser().GetLogin(),
+		URL:        pr.GetHTMLURL(),
+		HeadSHA:    pr.GetHead().GetSHA(),
+	}
+
+	mbrCtx := handler.NewCrossOrgMembershipContext(client, owner, a.Installations, a.ClientCreator)
+	prctx := pull.NewGitHubContext(mbrCtx, client, v4client, pr)
+
+	result := a.Evaluator.Evaluate(a.evaluationContext(ctx, owner), prctx)
+	record.Status = result.Status.String()
+	record.Description = result.Description
+	record.Approvers = approvers(&result)
+	if result.Error != nil {
+		record.Error = result.Error.Error()
+	}
+	return record
+}
+
+func (a *Auditor) evaluationContext(ctx context.Context, owner string) context.Context {
+	if a.Options == nil {
+		return ctx
+	}
+	ctx = approval.WithStatusCheckContext(ctx, a.Options.StatusCheckContext)
+	if methods, ok := a.Options.OrganizationMethods[owner]; ok {
+		ctx = common.WithDefaultMethods(ctx, methods)
+	}
+	if len(a.Options.IgnoreCommitsBy) > 0 {
+		ctx = approval.WithIgnoredCommitAuthors(ctx, a.Options.IgnoreCommitsBy)
+	}
+	if len(a.Options.CIAdminTeams) > 0 {
+		ctx = common.WithCIAdminTeams(ctx, a.Options.CIAdminTeams)
+	}
+	if len(a.Options.PrincipalSets) > 0 {
+		ctx = common.WithPrincipalSets(ctx, a.Options.PrincipalSets)
+	}
+	return ctx
+}
+
+// approvers returns the users whose approvals count toward the approved
+// rules in the result.
+func approvers(result *common.Result) []string {
+	seen := make(map[string]bool)
+
+	var collect func(r *common.Result)
+	collect = func(r *common.Result) {
+		if r.Status == common.StatusApproved {
+			for _, u := range r.Approvers {
+				seen[u] = true
+			}
+		}
+		for _, c := range r.Children {
+			collect(c)
+		}
+	}
+	collect(result)
+
+	users := make([]string, 0, len(seen))
+	for u := range seen {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// WriteReport writes the records in the given format, FormatCSV or
+// FormatJSON.
+func WriteReport(w io.Writer, format string, records []*Record) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, records)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(records), "failed to write report")
+	default:
+		return errors.Errorf("invalid report format %q, must be %q or %q", format, FormatCSV, FormatJSON)
+	}
+}
+
+func writeCSV(w io.Writer, records []*Record) error {
+	out := csv.NewWriter(w)
+
+	header := []string{"repository", "number", "title", "author", "url", "head_sha", "status", "compliant", "description", "approvers", "error"}
+	if err := out.Write(header); err != nil {
+		return errors.Wrap(err, "failed to write report")
+	}
+
+	for _, r := range records {
+		row := []string{
+			r.Repository,
+			strconv.Itoa(r.Number),
+			r.Title,
+			r.Author,
+			r.URL,
+			r.HeadSHA,
+			r.Status,
+			strconv.FormatBool(r.Compliant()),
+			r.Description,
+			strings.Join(r.Approvers, " "),
+			r.Error,
+		}
+		if err := out.Write(row); err != nil {
+			return errors.Wrap(err, "failed to write report")
+		}
+	}
+
+	out.Flush()
+	return errors.Wrap(out.Error(), "failed to write report")
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyaudit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+func TestApprovers(t *testing.T) {
+	result := &common.Result{
+		Status: common.StatusPending,
+		Children: []*common.Result{
+			{Name: "rule1", Status: common.StatusApproved, Approvers: []string{"mhaypenny", "bkeyes"}},
+			{Name: "rule2", Status: common.StatusPending, Approvers: []string{"ttest"}},
+			{Name: "rule3", Status: common.StatusApproved, Approvers: []string{"bkeyes"}},
+		},
+	}
+	assert.Equal(t, []string{"bkeyes", "mhaypenny"}, approvers(result))
+}
+
+func TestWriteReport(t *testing.T) {
+	records := []*Record{
+		{
+			Repository: "org/repo",
+			Number:     1,
+			Title:      "Add a feature, finally",
+			Author:     "ttest",
+			URL:        "https://github.com/org/repo/pull/1",
+			HeadSHA:    "abcdef",
+			Status:     "approved",
+			Approvers:  []string{"bkeyes", "mhaypenny"},
+		},
+		{
+			Repository: "org/repo",
+			Number:     2,
+			Status:     "pending",
+			Error:      "failed to list reviews",
+		},
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteReport(&buf, FormatCSV, records))
+		assert.Equal(t, "repository,number,title,author,url,head_sha,status,compliant,description,approvers,error\n"+
+			"org/repo,1,\"Add a feature, finally\",ttest,https://github.com/org/repo/pull/1,abcdef,approved,true,,bkeyes mhaypenny,\n"+
+			"org/repo,2,,,,,pending,false,,,failed to list reviews\n", buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteReport(&buf, FormatJSON, records))
+
+		var decoded []*Record
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, records, decoded)
+	})
+
+	t.Run("invalidFormat", func(t *testing.T) {
+		err := WriteReport(&bytes.Buffer{}, "xml", records)
+		assert.EqualError(t, err, `invalid report format "xml", must be "csv" or "json"`)
+	})
+}
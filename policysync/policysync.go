@@ -0,0 +1,286 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policysync loads policies from a central configuration service
+// instead of from repository files. The service serves a signed bundle of
+// policies that is refreshed on a schedule and can be pinned to a version.
+package policysync
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SignatureHeader is the response header that contains the base64 Ed25519
+	// signature of the bundle.
+	SignatureHeader = "X-Policy-Signature"
+
+	// Wildcard is the bundle key of the policy used for repositories that do
+	// not match a more specific key.
+	Wildcard = "*"
+
+	DefaultInterval = 5 * time.Minute
+)
+
+type Config struct {
+	// URL is the location of the policy bundle. Central policies are disabled
+	// if it is empty.
+	URL string `yaml:"url"`
+
+	// Interval is how often to fetch the bundle. If unset, DefaultInterval is
+	// used.
+	Interval time.Duration `yaml:"interval"`
+
+	// PublicKey or PublicKeyPath is a PEM-encoded Ed25519 public key. If set,
+	// bundles must be signed by the matching private key.
+	PublicKey     string `yaml:"public_key"`
+	PublicKeyPath string `yaml:"public_key_path"`
+
+	// Version pins the bundle to a specific version, the SHA-256 hash of its
+	// content in the form "sha256:<hex>". Other versions are rejected.
+	Version string `yaml:"version"`
+
+	// Authoritative ignores policy files in repositories. Repositories that
+	// do not have a policy in the bundle have no policy. If false, the policy
+	// file in the repository is used for repositories without a central
+	// policy.
+	Authoritative bool `yaml:"authoritative"`
+}
+
+// IsEnabled returns true if a bundle URL is configured.
+func (c *Config) IsEnabled() bool {
+	return c.URL != ""
+}
+
+// Bundle is the document served by the configuration service. Policies are
+// keyed by "owner/repo", "owner", or "*", in order of precedence.
+type Bundle struct {
+	Policies map[string]interface{} `yaml:"policies"`
+}
+
+// Policy is a policy from the current bundle.
+type Policy struct {
+	// Key is the bundle key that matched the repository.
+	Key string
+
+	// Version is the version of the bundle that contains the policy.
+	Version string
+
+	Content []byte
+}
+
+// Syncer fetches and caches the policy bundle.
+type Syncer struct {
+	config Config
+	key    ed25519.PublicKey
+	client *http.Client
+
+	mu       sync.RWMutex
+	version  string
+	policies map[string][]byte
+}
+
+// New creates a Syncer for the configuration. If httpClient is nil,
+// http.DefaultClient is used. The Syncer has no policies until the first
+// successful call to Sync.
+func New(c Config, httpClient *http.Client) (*Syncer, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+
+	s := &Syncer{config: c, client: httpClient}
+
+	keyPEM := []byte(c.PublicKey)
+	if len(keyPEM) == 0 && c.PublicKeyPath != "" {
+		b, err := ioutil.ReadFile(c.PublicKeyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read policy bundle public key")
+		}
+		keyPEM = b
+	}
+	if len(keyPEM) > 0 {
+		key, err := parsePublicKey(keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	}
+
+	return s, nil
+}
+
+func parsePublicKey(keyPEM []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("policy bundle public key is not PEM-encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse policy bundle public key")
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("policy bundle public key has unsupported type %T", key)
+	}
+	return edKey, nil
+}
+
+// Version returns the SHA-256 version of the data in the form used to pin
+// bundles.
+func Version(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Authoritative returns true if repository policy files are ignored.
+func (s *Syncer) Authoritative() bool {
+	return s.config.Authoritative
+}
+
+// Ready returns true if the Syncer has loaded a bundle.
+func (s *Syncer) Ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policies != nil
+}
+
+// Policy returns the central policy for a repository. The boolean is false
+// if the bundle has no policy for the repository.
+func (s *Syncer) Policy(owner, repo string) (Policy, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range []string{owner + "/" + repo, owner, Wildcard} {
+		if content, ok := s.policies[key]; ok {
+			return Policy{Key: key, Version: s.version, Content: content}, true
+		}
+	}
+	return Policy{}, false
+}
+
+// Run fetches the bundle immediately and then periodically until the context
+// is canceled. Failed fetches are logged and keep the previous bundle.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to sync central policies")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches, verifies, and loads the bundle. If the bundle is invalid,
+// the previous bundle remains in use.
+func (s *Syncer) Sync(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create policy bundle request")
+	}
+	req = req.WithContext(ctx)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch policy bundle")
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("policy bundle request returned status %d", res.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read policy bundle")
+	}
+
+	return s.Load(ctx, data, res.Header.Get(SignatureHeader))
+}
+
+// Load verifies and loads a bundle with its base64 signature.
+func (s *Syncer) Load(ctx context.Context, data []byte, signature string) error {
+	version := Version(data)
+
+	if s.config.Version != "" && version != s.config.Version {
+		return errors.Errorf("policy bundle version %s does not match pinned version %s", version, s.config.Version)
+	}
+
+	if s.key != nil {
+		sig, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil || signature == "" {
+			return errors.New("policy bundle is not signed")
+		}
+		if !ed25519.Verify(s.key, data, sig) {
+			return errors.New("policy bundle signature is invalid")
+		}
+	}
+
+	var bundle Bundle
+	if err := yaml.UnmarshalStrict(data, &bundle); err != nil {
+		return errors.Wrap(err, "failed to unmarshal policy bundle")
+	}
+
+	policies := make(map[string][]byte, len(bundle.Policies))
+	for key, p := range bundle.Policies {
+		content, err := yaml.Marshal(p)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal policy %q", key)
+		}
+		policies[key] = content
+	}
+
+	s.mu.Lock()
+	changed := s.version != version
+	s.version = version
+	s.policies = policies
+	s.mu.Unlock()
+
+	if changed {
+		zerolog.Ctx(ctx).Info().Msgf("Loaded central policy bundle %s with %d policies", version, len(policies))
+	}
+	return nil
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("central policy %q version %s", p.Key, p.Version)
+}
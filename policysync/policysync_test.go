@@ -0,0 +1,134 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policysync
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBundle = `
+policies:
+  "*":
+    policy:
+      approval:
+        - default
+  org:
+    policy:
+      approval:
+        - org
+  org/special:
+    policy:
+      approval:
+        - special
+`
+
+func TestPolicyLookup(t *testing.T) {
+	s, err := New(Config{URL: "https://example.com/bundle"}, nil)
+	require.NoError(t, err)
+
+	assert.False(t, s.Ready())
+	_, ok := s.Policy("org", "repo")
+	assert.False(t, ok)
+
+	require.NoError(t, s.Load(context.Background(), []byte(testBundle), ""))
+	assert.True(t, s.Ready())
+
+	p, ok := s.Policy("org", "special")
+	require.True(t, ok)
+	assert.Equal(t, "org/special", p.Key)
+	assert.Equal(t, Version([]byte(testBundle)), p.Version)
+	assert.Contains(t, string(p.Content), "special")
+
+	p, ok = s.Policy("org", "repo")
+	require.True(t, ok)
+	assert.Equal(t, "org", p.Key)
+
+	p, ok = s.Policy("other", "repo")
+	require.True(t, ok)
+	assert.Equal(t, Wildcard, p.Key)
+}
+
+func TestVersionPin(t *testing.T) {
+	s, err := New(Config{URL: "https://example.com/bundle", Version: Version([]byte("policies: {}\n"))}, nil)
+	require.NoError(t, err)
+
+	err = s.Load(context.Background(), []byte(testBundle), "")
+	assert.EqualError(t, err, "policy bundle version "+Version([]byte(testBundle))+" does not match pinned version "+Version([]byte("policies: {}\n")))
+	assert.False(t, s.Ready())
+
+	require.NoError(t, s.Load(context.Background(), []byte("policies: {}\n"), ""))
+	assert.True(t, s.Ready())
+}
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	s, err := New(Config{URL: "https://example.com/bundle", PublicKey: string(keyPEM)}, nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(testBundle)))
+
+	assert.EqualError(t, s.Load(ctx, []byte(testBundle), ""), "policy bundle is not signed")
+
+	otherSig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("policies: {}\n")))
+	assert.EqualError(t, s.Load(ctx, []byte(testBundle), otherSig), "policy bundle signature is invalid")
+	assert.False(t, s.Ready())
+
+	require.NoError(t, s.Load(ctx, []byte(testBundle), sig))
+	assert.True(t, s.Ready())
+}
+
+func TestSync(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(testBundle))
+	}))
+	defer srv.Close()
+
+	s, err := New(Config{URL: srv.URL}, srv.Client())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, s.Sync(ctx))
+
+	p, ok := s.Policy("org", "repo")
+	require.True(t, ok)
+	assert.Equal(t, "org", p.Key)
+
+	// a failed fetch keeps the previous bundle
+	status = http.StatusInternalServerError
+	assert.EqualError(t, s.Sync(ctx), "policy bundle request returned status 500")
+
+	_, ok = s.Policy("org", "repo")
+	assert.True(t, ok)
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var oldHunkPattern = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// RemovedLines returns the numbers of the lines that the patch of the file
+// modifies or deletes, in the file as it was before the changes. It returns
+// nil if the file has no patch.
+func (f *File) RemovedLines() []int {
+	var lines []int
+	old := 0
+	for _, line := range strings.Split(f.Patch, "\n") {
+		if m := oldHunkPattern.FindStringSubmatch(line); m != nil {
+			old, _ = strconv.Atoi(m[1])
+			continue
+		}
+		if old == 0 || line == "" {
+			continue
+		}
+		switch line[0] {
+		case '-':
+			lines = append(lines, old)
+			old++
+		case ' ':
+			old++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemovedLines(t *testing.T) {
+	t.Run("modifiedAndDeleted", func(t *testing.T) {
+		f := &File{Patch: "@@ -2,5 +2,4 @@ func main() {\n" +
+			" \ta := 1\n" +
+			"-\tb := 2\n" +
+			"+\tb := 3\n" +
+			" \tc := 3\n" +
+			"-\td := 4\n" +
+			" }\n" +
+			"@@ -20,2 +19,3 @@\n" +
+			" x\n" +
+			"+y\n" +
+			"-z\n" +
+			"\\ No newline at end of file"}
+
+		assert.Equal(t, []int{3, 5, 21}, f.RemovedLines())
+	})
+
+	t.Run("addedOnly", func(t *testing.T) {
+		f := &File{Patch: "@@ -0,0 +1,2 @@\n+a\n+b"}
+		assert.Empty(t, f.RemovedLines())
+	})
+
+	t.Run("noPatch", func(t *testing.T) {
+		f := &File{Filename: "image.png"}
+		assert.Nil(t, f.RemovedLines())
+	})
+}
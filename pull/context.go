@@ -15,6 +15,7 @@
 package pull
 
 import (
+	"context"
 	"time"
 )
 
@@ -23,13 +24,48 @@ import (
 type MembershipContext interface {
 	// IsTeamMember returns true if the user is a member of the given team.
 	// Teams are specified as "org-name/team-name".
-	IsTeamMember(team, user string) (bool, error)
+	IsTeamMember(ctx context.Context, team, user string) (bool, error)
 
 	// IsOrgMember returns true if the user is a member of the given organzation.
-	IsOrgMember(org, user string) (bool, error)
+	IsOrgMember(ctx context.Context, org, user string) (bool, error)
+
+	// OrganizationMembership returns details about the relationship between
+	// the user and the given organization.
+	OrganizationMembership(ctx context.Context, org, user string) (*OrgMembership, error)
 
 	// IsCollaborator returns true if the user meets the desiredPerm of the given organzation's repository.
-	IsCollaborator(org, repo, user, desiredPerm string) (bool, error)
+	IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error)
+
+	// TeamMembers returns the usernames of the active members of the given
+	// team. Teams are specified as "org-name/team-name".
+	TeamMembers(ctx context.Context, team string) ([]string, error)
+
+	// OrganizationMembers returns the usernames of the members of the given
+	// organization.
+	OrganizationMembers(ctx context.Context, org string) ([]string, error)
+
+	// RepositoryCollaborators returns the usernames of the users who have
+	// exactly the desiredPerm on the given organization's repository.
+	RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error)
+}
+
+// OrgMembership describes the relationship between a user and an
+// organization.
+type OrgMembership struct {
+	// Member is true if the user is an active member of the organization.
+	// Users with pending invitations are not members.
+	Member bool
+
+	// Role is the role of an active member, either "admin" or "member".
+	Role string
+
+	// OutsideCollaborator is true if the user has access to repositories in
+	// the organization without being a member.
+	OutsideCollaborator bool
+
+	// Suspended is true if the user's account is suspended. Suspensions are
+	// only reported by GitHub Enterprise.
+	Suspended bool
 }
 
 // Context is the context for a pull request. It defines methods to get
@@ -45,39 +81,170 @@ type Context interface {
 	// string is formated as "<owner>/<repository>#<number>"
 	Locator() string
 
+	// HeadSHA returns the SHA of the head commit of the pull request.
+	HeadSHA() string
+
 	// RepositoryOwner returns the owner of the repo that the pull request targets.
 	RepositoryOwner() string
 
 	// RepositoryName returns the repo that the pull request targets.
 	RepositoryName() string
 
+	// RepositoryTopics returns the topics of the repo that the pull request
+	// targets.
+	RepositoryTopics(ctx context.Context) ([]string, error)
+
+	// RepositoryCustomProperties returns the custom property values of the
+	// repo that the pull request targets, keyed by property name. Single-value
+	// properties are returned as a list with one element and properties
+	// without a value are omitted.
+	RepositoryCustomProperties(ctx context.Context) (map[string][]string, error)
+
+	// TargetRepository returns the repository that the pull request targets.
+	TargetRepository(ctx context.Context) (*Repository, error)
+
+	// SourceRepository returns the repository that contains the head branch
+	// of the pull request. For pull requests from forks, this is the fork. It
+	// returns nil if the source repository was deleted.
+	SourceRepository(ctx context.Context) (*Repository, error)
+
 	// Author returns the username of the user who opened the pull request.
-	Author() (string, error)
+	Author(ctx context.Context) (string, error)
+
+	// CreatedAt returns the time when the pull request was opened.
+	CreatedAt(ctx context.Context) (time.Time, error)
+
+	// Title returns the title of the pull request.
+	Title(ctx context.Context) (string, error)
+
+	// Body returns the description of the pull request.
+	Body(ctx context.Context) (string, error)
 
 	// ChangedFiles returns the files that were changed in this pull request.
-	ChangedFiles() ([]*File, error)
+	ChangedFiles(ctx context.Context) ([]*File, error)
+
+	// ChangedFilesIter calls fn for each file that was changed in this pull
+	// request, stopping when fn returns false. Unlike ChangedFiles, files may
+	// be loaded incrementally, so callers that only need to find a single
+	// file avoid loading the full list. It returns an error if the files
+	// cannot be loaded or if iteration did not stop early and the pull
+	// request has too many files to list completely.
+	ChangedFilesIter(ctx context.Context, fn func(*File) bool) error
+
+	// FileContents returns the size and type of the file with the given path
+	// at the head of the pull request. It returns an error if the file does
+	// not exist, like when it was deleted by the pull request.
+	FileContents(ctx context.Context, path string) (*FileContents, error)
+
+	// BaseFileContent returns the content of the file with the given path
+	// on the base branch of the pull request. It returns nil if the file does
+	// not exist.
+	BaseFileContent(ctx context.Context, path string) ([]byte, error)
+
+	// RefFileContent returns the content of the file with the given path at
+	// the given ref of the repository, which may be a branch, a tag, or a
+	// commit SHA. It returns nil if the file does not exist.
+	RefFileContent(ctx context.Context, path, ref string) ([]byte, error)
 
 	// Commits returns the commits that are part of this pull request. The
 	// commit order is implementation dependent.
-	Commits() ([]*Commit, error)
+	Commits(ctx context.Context) ([]*Commit, error)
 
 	// Comments lists all comments on a Pull Request. The comment order is
 	// implementation dependent.
-	Comments() ([]*Comment, error)
+	Comments(ctx context.Context) ([]*Comment, error)
 
 	// Reviews lists all reviews on a Pull Request. The review order is
 	// implementation dependent.
-	Reviews() ([]*Review, error)
+	Reviews(ctx context.Context) ([]*Review, error)
+
+	// RequestedReviewers returns the users and teams that have a pending
+	// review request on the pull request. GitHub removes a request when the
+	// user submits a review, so an outstanding request for a user who already
+	// reviewed the pull request is a request for a re-review.
+	RequestedReviewers(ctx context.Context) (*ReviewRequests, error)
 
 	// Branches returns the base (also known as target) and head branch names
 	// of this pull request. Branches in this repository have no prefix, while
 	// branches in forks are prefixed with the owner of the fork and a colon.
 	// The base branch will always be unprefixed.
-	Branches() (base string, head string, err error)
+	Branches(ctx context.Context) (base string, head string, err error)
+
+	// BaseChangedAt returns the time when the base branch of the pull request
+	// was last changed. It returns the zero time if the base branch has not
+	// changed since the pull request was opened.
+	BaseChangedAt(ctx context.Context) (time.Time, error)
+
+	// ReviewThreads returns the review conversations on the pull request. If
+	// the context evaluates the pull request at an earlier time, comments made
+	// after that time are omitted, but the resolved and outdated states are
+	// always current.
+	ReviewThreads(ctx context.Context) ([]*ReviewThread, error)
 
 	// TargetCommits returns recent commits on the target branch of the pull
 	// request. The exact number of commits is an implementation detail.
-	TargetCommits() ([]*Commit, error)
+	TargetCommits(ctx context.Context) ([]*Commit, error)
+
+	// Timeline returns the pushes, reviews, review dismissals, and base
+	// branch changes on the pull request in the order they happened. Unlike
+	// the timestamps returned by other methods, which may come from different
+	// sources, the order of events is consistent.
+	Timeline(ctx context.Context) ([]*TimelineEvent, error)
+
+	// BranchPullRequest returns the most recently created pull request in the
+	// target repository whose head is the given branch, or nil if there is no
+	// such pull request. If the branch is the base branch of this pull
+	// request, the returned pull request is the parent in a stack of pull
+	// requests.
+	BranchPullRequest(ctx context.Context, branch string) (*PullRequestRef, error)
+
+	// AuthorMergedPullRequests returns the number of pull requests opened by
+	// the author of this pull request that were merged in the target
+	// repository on or after the day of the given time. If the time is zero,
+	// all merged pull requests are counted.
+	AuthorMergedPullRequests(ctx context.Context, since time.Time) (int, error)
+
+	// CommitChangedFiles returns the files the pull request changed as of the
+	// given commit: the changes between the commit and its merge base with
+	// the target branch. Files include patches when GitHub provides them.
+	CommitChangedFiles(ctx context.Context, sha string) ([]*File, error)
+
+	// Blame returns the commits that last changed the given lines of a file
+	// as it was at the merge base of the pull request, keyed by line number.
+	// Line numbers start at 1. Lines that do not exist in the file are
+	// omitted.
+	Blame(ctx context.Context, path string, lines []int) (map[int]*BlameLine, error)
+}
+
+// BlameLine is the commit that last changed a line of a file.
+type BlameLine struct {
+	SHA string
+
+	// Author is the login of the commit author. It is empty if the author
+	// email is not associated with a GitHub user.
+	Author string
+
+	AuthoredAt time.Time
+}
+
+// Repository describes a GitHub repository.
+type Repository struct {
+	Owner string
+	Name  string
+
+	// Private is true if the repository is private.
+	Private bool
+
+	// Fork is true if the repository is a fork of another repository.
+	Fork bool
+
+	// Archived is true if the repository is archived and read-only.
+	Archived bool
+}
+
+// FullName returns the name of the repository formatted as "owner/name".
+func (r *Repository) FullName() string {
+	return r.Owner + "/" + r.Name
 }
 
 type FileStatus int
@@ -93,11 +260,52 @@ type File struct {
 	Status    FileStatus
 	Additions int
 	Deletions int
+
+	// PreviousFilename is the path of the file before it was renamed. It is
+	// empty if the file was not renamed.
+	PreviousFilename string
+
+	// Patch is the unified diff of the changes to the file. It is empty for
+	// binary files and files with very large changes.
+	Patch string
+}
+
+// ReviewRequests are the pending review requests on a pull request.
+type ReviewRequests struct {
+	Users []string
+
+	// Teams are the requested teams, as "org/team-slug".
+	Teams []string
+}
+
+// Paths returns the current path of the file and, if the file was renamed,
+// its previous path.
+func (f *File) Paths() []string {
+	if f.PreviousFilename == "" || f.PreviousFilename == f.Filename {
+		return []string{f.Filename}
+	}
+	return []string{f.Filename, f.PreviousFilename}
+}
+
+// FileContents describes the contents of a file.
+type FileContents struct {
+	// Size is the size of the file in bytes. For Git LFS pointers, this is
+	// the size of the pointer, not the size of the stored object.
+	Size int64
+
+	// Binary is true if the file contains a null byte near the start, which
+	// is the same test used by git. Files too large for GitHub to return
+	// their contents are never considered binary.
+	Binary bool
+
+	// LFS is true if the file is a Git LFS pointer.
+	LFS bool
 }
 
 type Commit struct {
 	CreatedAt       time.Time
 	SHA             string
+	TreeSHA         string
 	Parents         []string
 	CommittedViaWeb bool
 
@@ -108,6 +316,11 @@ type Commit struct {
 	// Commiter is the login name of the committer. It is empty if the
 	// committer is not a real user.
 	Committer string
+
+	// AuthorEmail and CommitterEmail are the email addresses recorded in the
+	// commit. They are empty if the commit does not include an address.
+	AuthorEmail    string
+	CommitterEmail string
 }
 
 // Users returns the login names of the users associated with this commit.
@@ -130,10 +343,72 @@ func (cs CommitsByCreationTime) Less(i, j int) bool {
 	return cs[i].CreatedAt.Before(cs[j].CreatedAt)
 }
 
+// ReviewThread is a conversation started by a review comment on a file in
+// the pull request. Outdated threads refer to lines that have since changed.
+type ReviewThread struct {
+	Path     string
+	Author   string
+	Resolved bool
+	Outdated bool
+
+	// Comments are the comments in the conversation, oldest first.
+	Comments []*Comment
+}
+
+type TimelineEventType string
+
+const (
+	TimelinePush            TimelineEventType = "push"
+	TimelineForcePush       TimelineEventType = "force_push"
+	TimelineReview          TimelineEventType = "review"
+	TimelineReviewDismissed TimelineEventType = "review_dismissed"
+	TimelineBaseChanged     TimelineEventType = "base_changed"
+)
+
+// TimelineEvent is an event in the history of a pull request. Actor is the
+// user who caused the event. SHA is the new head commit for pushes and the
+// reviewed commit for reviews and review dismissals.
+type TimelineEvent struct {
+	Type      TimelineEventType
+	CreatedAt time.Time
+	Actor     string
+	SHA       string
+
+	// PreviousRef and CurrentRef are the names of the old and new base
+	// branches for base branch changes.
+	PreviousRef string
+	CurrentRef  string
+}
+
+// PullRequestRef describes another pull request in the same repository, like
+// the parent of a stacked pull request.
+type PullRequestRef struct {
+	Number  int
+	Base    string
+	Head    string
+	HeadSHA string
+
+	// Open is true if the pull request is open. Merged is true if the pull
+	// request was closed by merging it.
+	Open   bool
+	Merged bool
+
+	// Statuses maps the contexts of the commit statuses of the head commit to
+	// their states. It is only set for open pull requests.
+	Statuses map[string]string
+}
+
 type Comment struct {
 	CreatedAt time.Time
 	Author    string
 	Body      string
+
+	// Path is the file a review comment is on. It is empty for comments on
+	// the pull request itself.
+	Path string
+
+	// ID is the GitHub node ID of the comment.
+	ID string
 }
 
 type ReviewState string
@@ -146,12 +421,33 @@ const (
 	ReviewPending          ReviewState = "pending"
 )
 
+// ReviewsForCommit returns the reviews that were submitted when the head of
+// the pull request was the commit with the given SHA.
+func ReviewsForCommit(reviews []*Review, sha string) []*Review {
+	var matching []*Review
+	for _, r := range reviews {
+		if r.SHA == sha {
+			matching = append(matching, r)
+		}
+	}
+	return matching
+}
+
 type Review struct {
 	CreatedAt time.Time
 	Author    string
 	State     ReviewState
 	Body      string
 
+	// SHA and TreeSHA identify the head commit of the pull request when the
+	// review was submitted. They are empty if the commit is unknown.
+	SHA     string
+	TreeSHA string
+
+	// OnBehalfOf lists the teams, as "org-name/team-name", whose review
+	// requests the review satisfied.
+	OnBehalfOf []string
+
 	// ID is the GitHub node ID of the review, used to resolve dismissals
 	ID string
 }
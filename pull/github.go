@@ -15,6 +15,7 @@
 package pull
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -39,12 +40,17 @@ const (
 	// target branch of a pull request. 100 items is the maximum that can be
 	// retrieved from the GitHub API without paging.
 	TargetCommitLimit = 100
+
+	// binaryCheckLength is the number of bytes at the start of a file that
+	// are checked for null bytes, matching the limit used by git.
+	binaryCheckLength = 8000
+
+	lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
 )
 
 // GitHubContext is a Context implementation that gets information from GitHub.
 // A new instance must be created for each request.
 type GitHubContext struct {
-	ctx      context.Context
 	client   *github.Client
 	v4client *githubv4.Client
 	mbrCtx   MembershipContext
@@ -53,20 +59,33 @@ type GitHubContext struct {
 	repo   string
 	number int
 	pr     *github.PullRequest
+	asOf   time.Time
 
 	// cached fields
+	topics        []string
+	baseChangedAt *time.Time
+	properties    map[string][]string
 	files         []*File
+	fileContents  map[string]*FileContents
+	refFiles      map[refFile][]byte
 	commits       []*Commit
 	targetCommits []*Commit
 	comments      []*Comment
 	reviews       []*Review
+	threads       []*ReviewThread
+	timeline      []*TimelineEvent
+	branchPRs     map[string]*PullRequestRef
+	mergedPRs     map[string]int
+	commitFiles   map[string][]*File
+	mergeBase     string
+	blames        map[string][]*blameRange
+	requests      *ReviewRequests
 	teamIDs       map[string]int64
 	membership    map[string]bool
 }
 
-func NewGitHubContext(ctx context.Context, mbrCtx MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest) Context {
+func NewGitHubContext(mbrCtx MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest) Context {
 	return &GitHubContext{
-		ctx:      ctx,
 		client:   client,
 		v4client: v4client,
 		mbrCtx:   mbrCtx,
@@ -78,16 +97,46 @@ func NewGitHubContext(ctx context.Context, mbrCtx MembershipContext, client *git
 	}
 }
 
-func (ghc *GitHubContext) IsTeamMember(team, user string) (bool, error) {
-	return ghc.mbrCtx.IsTeamMember(team, user)
+// NewGitHubContextAt creates a Context for a pull request as it existed at a
+// fixed point in time. Comments, review comments, and reviews created after
+// that time are ignored. This is intended for evaluating pull requests that are closed or
+// merged, where the commits no longer change.
+func NewGitHubContextAt(mbrCtx MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest, asOf time.Time) Context {
+	ghc := NewGitHubContext(mbrCtx, client, v4client, pr).(*GitHubContext)
+	ghc.asOf = asOf
+	return ghc
+}
+
+func (ghc *GitHubContext) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	return ghc.mbrCtx.IsTeamMember(ctx, team, user)
+}
+
+func (ghc *GitHubContext) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	return ghc.mbrCtx.IsOrgMember(ctx, org, user)
+}
+
+func (ghc *GitHubContext) OrganizationMembership(ctx context.Context, org, user string) (*OrgMembership, error) {
+	return ghc.mbrCtx.OrganizationMembership(ctx, org, user)
+}
+
+func (ghc *GitHubContext) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	return ghc.mbrCtx.IsCollaborator(ctx, org, repo, user, desiredPerm)
 }
 
-func (ghc *GitHubContext) IsOrgMember(org, user string) (bool, error) {
-	return ghc.mbrCtx.IsOrgMember(org, user)
+func (ghc *GitHubContext) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	return ghc.mbrCtx.TeamMembers(ctx, team)
 }
 
-func (ghc *GitHubContext) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
-	return ghc.mbrCtx.IsCollaborator(org, repo, user, desiredPerm)
+func (ghc *GitHubContext) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	return ghc.mbrCtx.OrganizationMembers(ctx, org)
+}
+
+func (ghc *GitHubContext) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	return ghc.mbrCtx.RepositoryCollaborators(ctx, org, repo, desiredPerm)
+}
+
+func (ghc *GitHubContext) HeadSHA() string {
+	return ghc.pr.GetHead().GetSHA()
 }
 
 func (ghc *GitHubContext) Locator() string {
@@ -102,54 +151,388 @@ func (ghc *GitHubContext) RepositoryName() string {
 	return ghc.repo
 }
 
-func (ghc *GitHubContext) Author() (string, error) {
+func (ghc *GitHubContext) RepositoryTopics(ctx context.Context) ([]string, error) {
+	if ghc.topics == nil {
+		topics, _, err := ghc.client.Repositories.ListAllTopics(ctx, ghc.owner, ghc.repo)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list repository topics")
+		}
+		ghc.topics = append([]string{}, topics...)
+	}
+	return ghc.topics, nil
+}
+
+func (ghc *GitHubContext) RepositoryCustomProperties(ctx context.Context) (map[string][]string, error) {
+	if ghc.properties == nil {
+		// the vendored client does not support custom properties yet
+		u := fmt.Sprintf("repos/%s/%s/properties/values", ghc.owner, ghc.repo)
+		req, err := ghc.client.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create custom properties request")
+		}
+
+		var values []*customPropertyValue
+		if _, err := ghc.client.Do(ctx, req, &values); err != nil {
+			return nil, errors.Wrap(err, "failed to list repository custom properties")
+		}
+
+		ghc.properties = make(map[string][]string)
+		for _, v := range values {
+			if vs := v.Values(); len(vs) > 0 {
+				ghc.properties[v.PropertyName] = vs
+			}
+		}
+	}
+	return ghc.properties, nil
+}
+
+func (ghc *GitHubContext) TargetRepository(ctx context.Context) (*Repository, error) {
+	return newRepository(ghc.pr.GetBase().GetRepo()), nil
+}
+
+func (ghc *GitHubContext) SourceRepository(ctx context.Context) (*Repository, error) {
+	repo := ghc.pr.GetHead().GetRepo()
+	if repo == nil {
+		return nil, nil
+	}
+	return newRepository(repo), nil
+}
+
+func newRepository(repo *github.Repository) *Repository {
+	return &Repository{
+		Owner:    repo.GetOwner().GetLogin(),
+		Name:     repo.GetName(),
+		Private:  repo.GetPrivate(),
+		Fork:     repo.GetFork(),
+		Archived: repo.GetArchived(),
+	}
+}
+
+func (ghc *GitHubContext) Author(ctx context.Context) (string, error) {
 	return ghc.pr.GetUser().GetLogin(), nil
 }
 
-func (ghc *GitHubContext) ChangedFiles() ([]*File, error) {
+func (ghc *GitHubContext) CreatedAt(ctx context.Context) (time.Time, error) {
+	return ghc.pr.GetCreatedAt(), nil
+}
+
+func (ghc *GitHubContext) Title(ctx context.Context) (string, error) {
+	return ghc.pr.GetTitle(), nil
+}
+
+func (ghc *GitHubContext) Body(ctx context.Context) (string, error) {
+	return ghc.pr.GetBody(), nil
+}
+
+func (ghc *GitHubContext) ChangedFiles(ctx context.Context) ([]*File, error) {
 	if ghc.files == nil {
-		var opt github.ListOptions
-		var allFiles []*github.CommitFile
-		for {
-			files, res, err := ghc.client.PullRequests.ListFiles(ghc.ctx, ghc.owner, ghc.repo, ghc.number, &opt)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to list pull request files")
-			}
-			allFiles = append(allFiles, files...)
-			if res.NextPage == 0 {
+		var files []*File
+		err := ghc.listFiles(ctx, func(f *File) bool {
+			files = append(files, f)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		ghc.files = files
+	}
+	if len(ghc.files) >= MaxPullRequestFiles {
+		return nil, errors.Errorf("too many files in pull request, maximum is %d", MaxPullRequestFiles)
+	}
+	return ghc.files, nil
+}
+
+func (ghc *GitHubContext) ChangedFilesIter(ctx context.Context, fn func(*File) bool) error {
+	count := 0
+	stopped := false
+	iter := func(f *File) bool {
+		count++
+		stopped = !fn(f)
+		return !stopped
+	}
+
+	if ghc.files != nil {
+		for _, f := range ghc.files {
+			if !iter(f) {
 				break
 			}
-			opt.Page = res.NextPage
 		}
+	} else {
+		files := []*File{}
+		err := ghc.listFiles(ctx, func(f *File) bool {
+			files = append(files, f)
+			return iter(f)
+		})
+		if err != nil {
+			return err
+		}
+
+		// only a complete listing can be reused by later calls
+		if !stopped {
+			ghc.files = files
+		}
+	}
 
-		for _, f := range allFiles {
-			var status FileStatus
-			switch f.GetStatus() {
-			case "added":
-				status = FileAdded
-			case "deleted":
-				status = FileDeleted
-			case "modified":
-				status = FileModified
+	if !stopped && count >= MaxPullRequestFiles {
+		return errors.Errorf("too many files in pull request, maximum is %d", MaxPullRequestFiles)
+	}
+	return nil
+}
+
+// listFiles loads changed files page by page, calling fn for each file until
+// fn returns false. Results are not cached.
+func (ghc *GitHubContext) listFiles(ctx context.Context, fn func(*File) bool) error {
+	page := 0
+	for {
+		// the vendored client does not decode the previous names of renamed
+		// files, so request the files directly
+		u := fmt.Sprintf("repos/%s/%s/pulls/%d/files", ghc.owner, ghc.repo, ghc.number)
+		if page > 0 {
+			u = fmt.Sprintf("%s?page=%d", u, page)
+		}
+
+		req, err := ghc.client.NewRequest("GET", u, nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to create pull request files request")
+		}
+
+		var files []*pullRequestFile
+		res, err := ghc.client.Do(ctx, req, &files)
+		if err != nil {
+			return errors.Wrap(err, "failed to list pull request files")
+		}
+		for _, f := range files {
+			file := toFile(&f.CommitFile)
+			file.PreviousFilename = f.GetPreviousFilename()
+			if !fn(file) {
+				return nil
 			}
+		}
+		if res.NextPage == 0 {
+			return nil
+		}
+		page = res.NextPage
+	}
+}
 
-			ghc.files = append(ghc.files, &File{
-				Filename:  f.GetFilename(),
-				Status:    status,
-				Additions: f.GetAdditions(),
-				Deletions: f.GetDeletions(),
+type pullRequestFile struct {
+	github.CommitFile
+	PreviousFilename *string `json:"previous_filename,omitempty"`
+}
+
+func (f *pullRequestFile) GetPreviousFilename() string {
+	if f.PreviousFilename == nil {
+		return ""
+	}
+	return *f.PreviousFilename
+}
+
+func toFile(f *github.CommitFile) *File {
+	var status FileStatus
+	switch f.GetStatus() {
+	case "added":
+		status = FileAdded
+	case "deleted":
+		status = FileDeleted
+	case "modified":
+		status = FileModified
+	}
+
+	return &File{
+		Filename:  f.GetFilename(),
+		Status:    status,
+		Additions: f.GetAdditions(),
+		Deletions: f.GetDeletions(),
+		Patch:     f.GetPatch(),
+	}
+}
+
+func (ghc *GitHubContext) CommitChangedFiles(ctx context.Context, sha string) ([]*File, error) {
+	if files, ok := ghc.commitFiles[sha]; ok {
+		return files, nil
+	}
+
+	base := ghc.pr.GetBase().GetRef()
+	comparison, _, err := ghc.client.Repositories.CompareCommits(ctx, ghc.owner, ghc.repo, base, sha)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to compare %s to %s", sha, base)
+	}
+
+	files := make([]*File, 0, len(comparison.Files))
+	for i := range comparison.Files {
+		files = append(files, toFile(&comparison.Files[i]))
+	}
+
+	if ghc.commitFiles == nil {
+		ghc.commitFiles = make(map[string][]*File)
+	}
+	ghc.commitFiles[sha] = files
+	return files, nil
+}
+
+// blameRange is a range of lines that were last changed by the same commit.
+type blameRange struct {
+	start, end int
+	line       *BlameLine
+}
+
+func (ghc *GitHubContext) Blame(ctx context.Context, path string, lines []int) (map[int]*BlameLine, error) {
+	ranges, ok := ghc.blames[path]
+	if !ok {
+		sha, err := ghc.mergeBaseSHA(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var q struct {
+			Repository struct {
+				Object struct {
+					Commit struct {
+						Blame struct {
+							Ranges []struct {
+								StartingLine int
+								EndingLine   int
+								Commit       struct {
+									OID          string
+									AuthoredDate time.Time
+									Author       v4GitActor
+								}
+							}
+						} `graphql:"blame(path: $path)"`
+					} `graphql:"... on Commit"`
+				} `graphql:"object(oid: $oid)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		qvars := map[string]interface{}{
+			"owner": githubv4.String(ghc.owner),
+			"name":  githubv4.String(ghc.repo),
+			"oid":   githubv4.GitObjectID(sha),
+			"path":  githubv4.String(path),
+		}
+
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
+			return nil, errors.Wrapf(err, "failed to get blame of %s", path)
+		}
+
+		for _, r := range q.Repository.Object.Commit.Blame.Ranges {
+			ranges = append(ranges, &blameRange{
+				start: r.StartingLine,
+				end:   r.EndingLine,
+				line: &BlameLine{
+					SHA:        r.Commit.OID,
+					Author:     r.Commit.Author.GetV3Login(),
+					AuthoredAt: r.Commit.AuthoredDate,
+				},
 			})
 		}
+
+		if ghc.blames == nil {
+			ghc.blames = make(map[string][]*blameRange)
+		}
+		ghc.blames[path] = ranges
 	}
-	if len(ghc.files) >= MaxPullRequestFiles {
-		return nil, errors.Errorf("too many files in pull request, maximum is %d", MaxPullRequestFiles)
+
+	blame := make(map[int]*BlameLine)
+	for _, n := range lines {
+		for _, r := range ranges {
+			if n >= r.start && n <= r.end {
+				blame[n] = r.line
+				break
+			}
+		}
 	}
-	return ghc.files, nil
+	return blame, nil
+}
+
+// mergeBaseSHA returns the merge base of the head commit and the base branch.
+func (ghc *GitHubContext) mergeBaseSHA(ctx context.Context) (string, error) {
+	if ghc.mergeBase == "" {
+		base := ghc.pr.GetBase().GetRef()
+		head := ghc.pr.GetHead().GetSHA()
+		comparison, _, err := ghc.client.Repositories.CompareCommits(ctx, ghc.owner, ghc.repo, base, head)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to compare %s to %s", head, base)
+		}
+		ghc.mergeBase = comparison.GetMergeBaseCommit().GetSHA()
+	}
+	return ghc.mergeBase, nil
 }
 
-func (ghc *GitHubContext) Commits() ([]*Commit, error) {
+func (ghc *GitHubContext) FileContents(ctx context.Context, path string) (*FileContents, error) {
+	if fc, ok := ghc.fileContents[path]; ok {
+		return fc, nil
+	}
+
+	opt := &github.RepositoryContentGetOptions{Ref: ghc.pr.GetHead().GetSHA()}
+	file, _, _, err := ghc.client.Repositories.GetContents(ctx, ghc.owner, ghc.repo, path, opt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get contents of %s", path)
+	}
+	if file == nil {
+		return nil, errors.Errorf("path %s is not a file", path)
+	}
+
+	fc := &FileContents{Size: int64(file.GetSize())}
+
+	// GitHub does not return the content of large files
+	if file.GetEncoding() != "none" {
+		content, err := file.GetContent()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode contents of %s", path)
+		}
+		fc.Binary = isBinary([]byte(content))
+		fc.LFS = strings.HasPrefix(content, lfsPointerPrefix)
+	}
+
+	if ghc.fileContents == nil {
+		ghc.fileContents = make(map[string]*FileContents)
+	}
+	ghc.fileContents[path] = fc
+	return fc, nil
+}
+
+func (ghc *GitHubContext) BaseFileContent(ctx context.Context, path string) ([]byte, error) {
+	return ghc.RefFileContent(ctx, path, ghc.pr.GetBase().GetRef())
+}
+
+// refFile identifies a file at a ref for caching.
+type refFile struct {
+	ref  string
+	path string
+}
+
+func (ghc *GitHubContext) RefFileContent(ctx context.Context, path, ref string) ([]byte, error) {
+	key := refFile{ref: ref, path: path}
+	if content, ok := ghc.refFiles[key]; ok {
+		return content, nil
+	}
+
+	var content []byte
+
+	opt := &github.RepositoryContentGetOptions{Ref: ref}
+	file, _, _, err := ghc.client.Repositories.GetContents(ctx, ghc.owner, ghc.repo, path, opt)
+	switch {
+	case isNotFound(err):
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to get contents of %s at %s", path, ref)
+	case file != nil:
+		s, err := file.GetContent()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode contents of %s", path)
+		}
+		content = []byte(s)
+	}
+
+	if ghc.refFiles == nil {
+		ghc.refFiles = make(map[refFile][]byte)
+	}
+	ghc.refFiles[key] = content
+	return content, nil
+}
+
+func (ghc *GitHubContext) Commits(ctx context.Context) ([]*Commit, error) {
 	if ghc.commits == nil {
-		if err := ghc.loadPullRequestData(); err != nil {
+		if err := ghc.loadPullRequestData(ctx); err != nil {
 			return nil, err
 		}
 	}
@@ -170,18 +553,51 @@ func (ghc *GitHubContext) Commits() ([]*Commit, error) {
 	return nil, errors.Errorf("pull request head %s was missing from commit listing", headSHA)
 }
 
-func (ghc *GitHubContext) Comments() ([]*Comment, error) {
+func (ghc *GitHubContext) Comments(ctx context.Context) ([]*Comment, error) {
 	if ghc.comments == nil {
-		if err := ghc.loadPullRequestData(); err != nil {
+		if err := ghc.loadPullRequestData(ctx); err != nil {
 			return nil, err
 		}
 	}
 	return ghc.comments, nil
 }
 
-func (ghc *GitHubContext) Reviews() ([]*Review, error) {
+func (ghc *GitHubContext) RequestedReviewers(ctx context.Context) (*ReviewRequests, error) {
+	if ghc.requests != nil {
+		return ghc.requests, nil
+	}
+
+	// the vendored client does not decode requested teams, so request them
+	// directly
+	u := fmt.Sprintf("repos/%s/%s/pulls/%d/requested_reviewers", ghc.owner, ghc.repo, ghc.number)
+	req, err := ghc.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create review requests request")
+	}
+
+	var res struct {
+		Users []*github.User `json:"users"`
+		Teams []*github.Team `json:"teams"`
+	}
+	if _, err := ghc.client.Do(ctx, req, &res); err != nil {
+		return nil, errors.Wrap(err, "failed to list review requests")
+	}
+
+	requests := &ReviewRequests{}
+	for _, u := range res.Users {
+		requests.Users = append(requests.Users, u.GetLogin())
+	}
+	for _, t := range res.Teams {
+		requests.Teams = append(requests.Teams, fmt.Sprintf("%s/%s", ghc.owner, t.GetSlug()))
+	}
+
+	ghc.requests = requests
+	return requests, nil
+}
+
+func (ghc *GitHubContext) Reviews(ctx context.Context) ([]*Review, error) {
 	if ghc.reviews == nil {
-		if err := ghc.loadPullRequestData(); err != nil {
+		if err := ghc.loadPullRequestData(ctx); err != nil {
 			return nil, err
 		}
 	}
@@ -190,7 +606,7 @@ func (ghc *GitHubContext) Reviews() ([]*Review, error) {
 
 // Branches returns the names of the base and head branch. If the head branch is from another repository (it is a fork)
 // then the branch name is `owner:branchName`.
-func (ghc *GitHubContext) Branches() (base string, head string, err error) {
+func (ghc *GitHubContext) Branches(ctx context.Context) (base string, head string, err error) {
 	base = ghc.pr.GetBase().GetRef()
 
 	if ghc.pr.GetHead().GetRepo().GetID() == ghc.pr.GetBase().GetRepo().GetID() {
@@ -202,7 +618,208 @@ func (ghc *GitHubContext) Branches() (base string, head string, err error) {
 	return
 }
 
-func (ghc *GitHubContext) TargetCommits() ([]*Commit, error) {
+func (ghc *GitHubContext) BaseChangedAt(ctx context.Context) (time.Time, error) {
+	if ghc.baseChangedAt == nil {
+		var changedAt time.Time
+
+		opt := &github.ListOptions{PerPage: 100}
+		for {
+			events, res, err := ghc.client.Issues.ListIssueEvents(ctx, ghc.owner, ghc.repo, ghc.number, opt)
+			if err != nil {
+				return time.Time{}, errors.Wrap(err, "failed to list pull request events")
+			}
+
+			for _, e := range events {
+				if e.GetEvent() != "base_ref_changed" || ghc.isAfterCutoff(e.GetCreatedAt()) {
+					continue
+				}
+				if t := e.GetCreatedAt(); t.After(changedAt) {
+					changedAt = t
+				}
+			}
+
+			if res.NextPage == 0 {
+				break
+			}
+			opt.Page = res.NextPage
+		}
+
+		ghc.baseChangedAt = &changedAt
+	}
+	return *ghc.baseChangedAt, nil
+}
+
+func (ghc *GitHubContext) ReviewThreads(ctx context.Context) ([]*ReviewThread, error) {
+	if ghc.threads == nil {
+		var q struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						PageInfo v4PageInfo
+						Nodes    []*v4ReviewThread
+					} `graphql:"reviewThreads(first: 100, after: $cursor)"`
+				} `graphql:"pullRequest(number: $number)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		qvars := map[string]interface{}{
+			"owner":  githubv4.String(ghc.owner),
+			"name":   githubv4.String(ghc.repo),
+			"number": githubv4.Int(ghc.number),
+			"cursor": (*githubv4.String)(nil),
+		}
+
+		threads := make([]*ReviewThread, 0)
+		for {
+			if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
+				return nil, errors.Wrap(err, "failed to list review threads")
+			}
+			for _, t := range q.Repository.PullRequest.ReviewThreads.Nodes {
+				if thread := ghc.reviewThreadAsOf(t.ToReviewThread()); thread != nil {
+					threads = append(threads, thread)
+				}
+			}
+			if !q.Repository.PullRequest.ReviewThreads.PageInfo.UpdateCursor(qvars, "cursor") {
+				break
+			}
+		}
+		ghc.threads = threads
+	}
+	return ghc.threads, nil
+}
+
+func (ghc *GitHubContext) Timeline(ctx context.Context) ([]*TimelineEvent, error) {
+	if ghc.timeline == nil {
+		var q struct {
+			Repository struct {
+				PullRequest struct {
+					TimelineItems struct {
+						PageInfo v4PageInfo
+						Nodes    []*v4TimelineItem
+					} `graphql:"timelineItems(first: 100, after: $cursor, itemTypes: [PULL_REQUEST_COMMIT, HEAD_REF_FORCE_PUSHED_EVENT, PULL_REQUEST_REVIEW, REVIEW_DISMISSED_EVENT, BASE_REF_CHANGED_EVENT])"`
+				} `graphql:"pullRequest(number: $number)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		qvars := map[string]interface{}{
+			"owner":  githubv4.String(ghc.owner),
+			"name":   githubv4.String(ghc.repo),
+			"number": githubv4.Int(ghc.number),
+			"cursor": (*githubv4.String)(nil),
+		}
+
+		timeline := make([]*TimelineEvent, 0)
+		for {
+			if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
+				return nil, errors.Wrap(err, "failed to list pull request timeline")
+			}
+			for _, item := range q.Repository.PullRequest.TimelineItems.Nodes {
+				e := item.ToTimelineEvent()
+				if e == nil || ghc.isAfterCutoff(e.CreatedAt) {
+					continue
+				}
+				timeline = append(timeline, e)
+			}
+			if !q.Repository.PullRequest.TimelineItems.PageInfo.UpdateCursor(qvars, "cursor") {
+				break
+			}
+		}
+		ghc.timeline = timeline
+	}
+	return ghc.timeline, nil
+}
+
+func (ghc *GitHubContext) BranchPullRequest(ctx context.Context, branch string) (*PullRequestRef, error) {
+	if ref, ok := ghc.branchPRs[branch]; ok {
+		return ref, nil
+	}
+
+	opts := &github.PullRequestListOptions{
+		State:       "all",
+		Head:        ghc.owner + ":" + branch,
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	prs, _, err := ghc.client.PullRequests.List(ctx, ghc.owner, ghc.repo, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list pull requests for branch %s", branch)
+	}
+
+	var ref *PullRequestRef
+	if len(prs) > 0 {
+		pr := prs[0]
+		ref = &PullRequestRef{
+			Number:  pr.GetNumber(),
+			Base:    pr.GetBase().GetRef(),
+			Head:    pr.GetHead().GetRef(),
+			HeadSHA: pr.GetHead().GetSHA(),
+			Open:    pr.GetState() == "open",
+			Merged:  !pr.GetMergedAt().IsZero(),
+		}
+		if ref.Open {
+			if ref.Statuses, err = ghc.commitStatuses(ctx, ref.HeadSHA); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ghc.branchPRs == nil {
+		ghc.branchPRs = make(map[string]*PullRequestRef)
+	}
+	ghc.branchPRs[branch] = ref
+	return ref, nil
+}
+
+func (ghc *GitHubContext) AuthorMergedPullRequests(ctx context.Context, since time.Time) (int, error) {
+	// the search API only compares dates, so requests for times on the same
+	// day share a result
+	var day string
+	if !since.IsZero() {
+		day = since.UTC().Format("2006-01-02")
+	}
+	if count, ok := ghc.mergedPRs[day]; ok {
+		return count, nil
+	}
+
+	author := ghc.pr.GetUser().GetLogin()
+	query := fmt.Sprintf("repo:%s/%s is:pr is:merged author:%s", ghc.owner, ghc.repo, author)
+	if day != "" {
+		query += " merged:>=" + day
+	}
+
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}}
+	res, _, err := ghc.client.Search.Issues(ctx, query, opts)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to search merged pull requests by %s", author)
+	}
+
+	if ghc.mergedPRs == nil {
+		ghc.mergedPRs = make(map[string]int)
+	}
+	ghc.mergedPRs[day] = res.GetTotal()
+	return res.GetTotal(), nil
+}
+
+func (ghc *GitHubContext) commitStatuses(ctx context.Context, sha string) (map[string]string, error) {
+	statuses := make(map[string]string)
+
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		combined, res, err := ghc.client.Repositories.GetCombinedStatus(ctx, ghc.owner, ghc.repo, sha, opt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get statuses for commit %s", sha)
+		}
+		for _, s := range combined.Statuses {
+			statuses[s.GetContext()] = s.GetState()
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return statuses, nil
+}
+
+func (ghc *GitHubContext) TargetCommits(ctx context.Context) ([]*Commit, error) {
 	if ghc.targetCommits == nil {
 		var q struct {
 			Repository struct {
@@ -224,7 +841,7 @@ func (ghc *GitHubContext) TargetCommits() ([]*Commit, error) {
 			"limit": githubv4.Int(TargetCommitLimit),
 		}
 
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 			return nil, errors.Wrap(err, "failed to list target commits")
 		}
 
@@ -239,7 +856,7 @@ func (ghc *GitHubContext) TargetCommits() ([]*Commit, error) {
 	return ghc.targetCommits, nil
 }
 
-func (ghc *GitHubContext) loadPullRequestData() error {
+func (ghc *GitHubContext) loadPullRequestData(ctx context.Context) error {
 	// do not query changed files here because they are only need for rules
 	// that use file predicates, while comments, commits, and reviews are
 	// needed for almost all rule evaluations
@@ -280,11 +897,14 @@ func (ghc *GitHubContext) loadPullRequestData() error {
 
 	for {
 		complete := 0
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.v4client.Query(ctx, &q, qvars); err != nil {
 			return errors.Wrap(err, "failed to load pull request data")
 		}
 
 		for _, c := range q.Repository.PullRequest.Comments.Nodes {
+			if ghc.isAfterCutoff(c.CreatedAt) {
+				continue
+			}
 			ghc.comments = append(ghc.comments, c.ToComment())
 		}
 		if !q.Repository.PullRequest.Comments.PageInfo.UpdateCursor(qvars, "commentCursor") {
@@ -299,6 +919,9 @@ func (ghc *GitHubContext) loadPullRequestData() error {
 		}
 
 		for _, r := range q.Repository.PullRequest.Reviews.Nodes {
+			if ghc.isAfterCutoff(r.SubmittedAt) {
+				continue
+			}
 			ghc.reviews = append(ghc.reviews, r.ToReview())
 		}
 		if !q.Repository.PullRequest.Reviews.PageInfo.UpdateCursor(qvars, "reviewCursor") {
@@ -320,6 +943,51 @@ func (ghc *GitHubContext) loadPullRequestData() error {
 	return nil
 }
 
+// reviewThreadAsOf removes the comments of the thread that were made after
+// the cutoff. It returns nil if the thread started after the cutoff.
+func (ghc *GitHubContext) reviewThreadAsOf(t *ReviewThread) *ReviewThread {
+	var comments []*Comment
+	for _, c := range t.Comments {
+		if !ghc.isAfterCutoff(c.CreatedAt) {
+			comments = append(comments, c)
+		}
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	t.Comments = comments
+	return t
+}
+
+// isAfterCutoff returns true if the context evaluates the pull request at a
+// fixed time and t is after that time.
+func (ghc *GitHubContext) isAfterCutoff(t time.Time) bool {
+	return !ghc.asOf.IsZero() && t.After(ghc.asOf)
+}
+
+type customPropertyValue struct {
+	PropertyName string      `json:"property_name"`
+	Value        interface{} `json:"value"`
+}
+
+// Values normalizes the property value, which may be null, a string, or a
+// list of strings depending on the property type.
+func (v *customPropertyValue) Values() []string {
+	switch value := v.Value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
 type v4PageInfo struct {
 	EndCursor   *githubv4.String
 	HasNextPage bool
@@ -346,18 +1014,41 @@ type v4PullRequestReview struct {
 	State       string
 	Body        string
 	SubmittedAt time.Time
+	Commit      *struct {
+		OID  string
+		Tree struct {
+			OID string
+		}
+	}
+	OnBehalfOf struct {
+		Nodes []struct {
+			Slug         string
+			Organization struct {
+				Login string
+			}
+		}
+	} `graphql:"onBehalfOf(first: 25)"`
 }
 
 func (r *v4PullRequestReview) ToReview() *Review {
-	return &Review{
+	review := &Review{
 		CreatedAt: r.SubmittedAt,
 		Author:    r.Author.GetV3Login(),
 		State:     ReviewState(strings.ToLower(r.State)),
 		Body:      r.Body,
 	}
+	if r.Commit != nil {
+		review.SHA = r.Commit.OID
+		review.TreeSHA = r.Commit.Tree.OID
+	}
+	for _, t := range r.OnBehalfOf.Nodes {
+		review.OnBehalfOf = append(review.OnBehalfOf, t.Organization.Login+"/"+t.Slug)
+	}
+	return review
 }
 
 type v4IssueComment struct {
+	ID        string
 	Author    v4Actor
 	Body      string
 	CreatedAt time.Time
@@ -368,6 +1059,7 @@ func (c *v4IssueComment) ToComment() *Comment {
 		CreatedAt: c.CreatedAt,
 		Author:    c.Author.GetV3Login(),
 		Body:      c.Body,
+		ID:        c.ID,
 	}
 }
 
@@ -381,7 +1073,10 @@ type v4Commit struct {
 	Author          v4GitActor
 	Committer       v4GitActor
 	CommittedViaWeb bool
-	Parents         struct {
+	Tree            struct {
+		OID string
+	}
+	Parents struct {
 		Nodes []struct {
 			OID string
 		}
@@ -402,10 +1097,13 @@ func (c *v4Commit) ToCommit() *Commit {
 	return &Commit{
 		CreatedAt:       createdAt,
 		SHA:             c.OID,
+		TreeSHA:         c.Tree.OID,
 		Parents:         parents,
 		CommittedViaWeb: c.CommittedViaWeb,
 		Author:          c.Author.GetV3Login(),
 		Committer:       c.Committer.GetV3Login(),
+		AuthorEmail:     c.Author.Email,
+		CommitterEmail:  c.Committer.Email,
 	}
 }
 
@@ -439,7 +1137,8 @@ func (a v4Actor) GetV3Login() string {
 }
 
 type v4GitActor struct {
-	User *v4Actor
+	Email string
+	User  *v4Actor
 }
 
 func (ga v4GitActor) GetV3Login() string {
@@ -449,9 +1148,139 @@ func (ga v4GitActor) GetV3Login() string {
 	return ""
 }
 
+func isBinary(content []byte) bool {
+	if len(content) > binaryCheckLength {
+		content = content[:binaryCheckLength]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
 func isNotFound(err error) bool {
 	if rerr, ok := err.(*github.ErrorResponse); ok {
 		return rerr.Response.StatusCode == http.StatusNotFound
 	}
 	return false
 }
+
+type v4ReviewThread struct {
+	Path       string
+	IsResolved bool
+	IsOutdated bool
+	Comments   struct {
+		Nodes []*v4IssueComment
+	} `graphql:"comments(first: 100)"`
+}
+
+func (t *v4ReviewThread) ToReviewThread() *ReviewThread {
+	thread := &ReviewThread{
+		Path:     t.Path,
+		Resolved: t.IsResolved,
+		Outdated: t.IsOutdated,
+	}
+	for _, c := range t.Comments.Nodes {
+		comment := c.ToComment()
+		comment.Path = t.Path
+		thread.Comments = append(thread.Comments, comment)
+	}
+	if len(thread.Comments) > 0 {
+		thread.Author = thread.Comments[0].Author
+	}
+	return thread
+}
+
+type v4TimelineItem struct {
+	Type string `graphql:"__typename"`
+
+	PullRequestCommit struct {
+		Commit struct {
+			OID           string
+			CommittedDate time.Time
+			PushedDate    *time.Time
+		}
+	} `graphql:"... on PullRequestCommit"`
+
+	HeadRefForcePushedEvent struct {
+		Actor       v4Actor
+		CreatedAt   time.Time
+		AfterCommit *struct {
+			OID string
+		}
+	} `graphql:"... on HeadRefForcePushedEvent"`
+
+	PullRequestReview struct {
+		Author      v4Actor
+		SubmittedAt *time.Time
+		Commit      *struct {
+			OID string
+		}
+	} `graphql:"... on PullRequestReview"`
+
+	ReviewDismissedEvent struct {
+		Actor     v4Actor
+		CreatedAt time.Time
+		Review    *struct {
+			Commit *struct {
+				OID string
+			}
+		}
+	} `graphql:"... on ReviewDismissedEvent"`
+
+	BaseRefChangedEvent struct {
+		Actor           v4Actor
+		CreatedAt       time.Time
+		PreviousRefName string
+		CurrentRefName  string
+	} `graphql:"... on BaseRefChangedEvent"`
+}
+
+// ToTimelineEvent converts the item to an event. It returns nil for items
+// that are not yet part of the timeline, like pending reviews.
+func (item *v4TimelineItem) ToTimelineEvent() *TimelineEvent {
+	switch item.Type {
+	case "PullRequestCommit":
+		c := item.PullRequestCommit.Commit
+		e := &TimelineEvent{Type: TimelinePush, CreatedAt: c.CommittedDate, SHA: c.OID}
+		if c.PushedDate != nil {
+			e.CreatedAt = *c.PushedDate
+		}
+		return e
+
+	case "HeadRefForcePushedEvent":
+		fp := item.HeadRefForcePushedEvent
+		e := &TimelineEvent{Type: TimelineForcePush, CreatedAt: fp.CreatedAt, Actor: fp.Actor.GetV3Login()}
+		if fp.AfterCommit != nil {
+			e.SHA = fp.AfterCommit.OID
+		}
+		return e
+
+	case "PullRequestReview":
+		r := item.PullRequestReview
+		if r.SubmittedAt == nil {
+			return nil
+		}
+		e := &TimelineEvent{Type: TimelineReview, CreatedAt: *r.SubmittedAt, Actor: r.Author.GetV3Login()}
+		if r.Commit != nil {
+			e.SHA = r.Commit.OID
+		}
+		return e
+
+	case "ReviewDismissedEvent":
+		d := item.ReviewDismissedEvent
+		e := &TimelineEvent{Type: TimelineReviewDismissed, CreatedAt: d.CreatedAt, Actor: d.Actor.GetV3Login()}
+		if d.Review != nil && d.Review.Commit != nil {
+			e.SHA = d.Review.Commit.OID
+		}
+		return e
+
+	case "BaseRefChangedEvent":
+		b := item.BaseRefChangedEvent
+		return &TimelineEvent{
+			Type:        TimelineBaseChanged,
+			CreatedAt:   b.CreatedAt,
+			Actor:       b.Actor.GetV3Login(),
+			PreviousRef: b.PreviousRefName,
+			CurrentRef:  b.CurrentRefName,
+		}
+	}
+	return nil
+}
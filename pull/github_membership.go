@@ -23,19 +23,25 @@ import (
 )
 
 type GitHubMembershipContext struct {
-	ctx    context.Context
 	client *github.Client
 
 	teamIDs    map[string]int64
 	membership map[string]bool
+
+	orgMemberships       map[string]*OrgMembership
+	outsideCollaborators map[string]map[string]bool
+	suspended            map[string]bool
 }
 
-func NewGitHubMembershipContext(ctx context.Context, client *github.Client) *GitHubMembershipContext {
+func NewGitHubMembershipContext(client *github.Client) *GitHubMembershipContext {
 	return &GitHubMembershipContext{
-		ctx:        ctx,
 		client:     client,
 		teamIDs:    make(map[string]int64),
 		membership: make(map[string]bool),
+
+		orgMemberships:       make(map[string]*OrgMembership),
+		outsideCollaborators: make(map[string]map[string]bool),
+		suspended:            make(map[string]bool),
 	}
 }
 
@@ -43,20 +49,12 @@ func membershipKey(group, user string) string {
 	return group + ":" + user
 }
 
-func (mc *GitHubMembershipContext) IsTeamMember(team, user string) (bool, error) {
+func (mc *GitHubMembershipContext) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
 	key := membershipKey(team, user)
-	org := strings.Split(team, "/")[0]
-
-	id, ok := mc.teamIDs[team]
-	if !ok {
-		if err := mc.cacheTeamIDs(org); err != nil {
-			return false, err
-		}
 
-		id, ok = mc.teamIDs[team]
-		if !ok {
-			return false, errors.Errorf("failed to get ID for team %s", team)
-		}
+	id, err := mc.teamID(ctx, team)
+	if err != nil {
+		return false, err
 	}
 
 	isMember, ok := mc.membership[key]
@@ -64,7 +62,7 @@ func (mc *GitHubMembershipContext) IsTeamMember(team, user string) (bool, error)
 		return isMember, nil
 	}
 
-	membership, _, err := mc.client.Teams.GetTeamMembership(mc.ctx, id, user)
+	membership, _, err := mc.client.Teams.GetTeamMembership(ctx, id, user)
 	if err != nil && !isNotFound(err) {
 		return false, errors.Wrap(err, "failed to get team membership")
 	}
@@ -75,10 +73,27 @@ func (mc *GitHubMembershipContext) IsTeamMember(team, user string) (bool, error)
 	return isMember, nil
 }
 
-func (mc *GitHubMembershipContext) cacheTeamIDs(org string) error {
+func (mc *GitHubMembershipContext) teamID(ctx context.Context, team string) (int64, error) {
+	if id, ok := mc.teamIDs[team]; ok {
+		return id, nil
+	}
+
+	org := strings.Split(team, "/")[0]
+	if err := mc.cacheTeamIDs(ctx, org); err != nil {
+		return 0, err
+	}
+
+	id, ok := mc.teamIDs[team]
+	if !ok {
+		return 0, errors.Errorf("team '%s' does not exist or is not visible to the app", team)
+	}
+	return id, nil
+}
+
+func (mc *GitHubMembershipContext) cacheTeamIDs(ctx context.Context, org string) error {
 	var opt github.ListOptions
 	for {
-		teams, res, err := mc.client.Teams.ListTeams(mc.ctx, org, &opt)
+		teams, res, err := mc.client.Teams.ListTeams(ctx, org, &opt)
 		if err != nil {
 			return errors.Wrap(err, "failed to list organization teams")
 		}
@@ -96,7 +111,7 @@ func (mc *GitHubMembershipContext) cacheTeamIDs(org string) error {
 	return nil
 }
 
-func (mc *GitHubMembershipContext) IsOrgMember(org, user string) (bool, error) {
+func (mc *GitHubMembershipContext) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
 	key := membershipKey(org, user)
 
 	isMember, ok := mc.membership[key]
@@ -104,7 +119,7 @@ func (mc *GitHubMembershipContext) IsOrgMember(org, user string) (bool, error) {
 		return isMember, nil
 	}
 
-	isMember, _, err := mc.client.Organizations.IsMember(mc.ctx, org, user)
+	isMember, _, err := mc.client.Organizations.IsMember(ctx, org, user)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to get organization membership")
 	}
@@ -113,11 +128,177 @@ func (mc *GitHubMembershipContext) IsOrgMember(org, user string) (bool, error) {
 	return isMember, nil
 }
 
-func (mc *GitHubMembershipContext) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
-	perm, _, err := mc.client.Repositories.GetPermissionLevel(mc.ctx, org, repo, user)
+func (mc *GitHubMembershipContext) OrganizationMembership(ctx context.Context, org, user string) (*OrgMembership, error) {
+	key := membershipKey(org, user)
+	if m, ok := mc.orgMemberships[key]; ok {
+		return m, nil
+	}
+
+	m := &OrgMembership{}
+
+	membership, _, err := mc.client.Organizations.GetOrgMembership(ctx, user, org)
+	if err != nil && !isNotFound(err) {
+		return nil, errors.Wrap(err, "failed to get organization membership")
+	}
+	if membership.GetState() == "active" {
+		m.Member = true
+		m.Role = membership.GetRole()
+	}
+
+	if !m.Member {
+		collaborators, err := mc.orgOutsideCollaborators(ctx, org)
+		if err != nil {
+			return nil, err
+		}
+		m.OutsideCollaborator = collaborators[user]
+	}
+
+	suspended, err := mc.isSuspended(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	m.Suspended = suspended
+
+	mc.orgMemberships[key] = m
+	return m, nil
+}
+
+func (mc *GitHubMembershipContext) orgOutsideCollaborators(ctx context.Context, org string) (map[string]bool, error) {
+	if collaborators, ok := mc.outsideCollaborators[org]; ok {
+		return collaborators, nil
+	}
+
+	collaborators := make(map[string]bool)
+	opt := &github.ListOutsideCollaboratorsOptions{}
+	for {
+		users, res, err := mc.client.Organizations.ListOutsideCollaborators(ctx, org, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list outside collaborators")
+		}
+		for _, u := range users {
+			collaborators[u.GetLogin()] = true
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	mc.outsideCollaborators[org] = collaborators
+	return collaborators, nil
+}
+
+func (mc *GitHubMembershipContext) isSuspended(ctx context.Context, user string) (bool, error) {
+	if suspended, ok := mc.suspended[user]; ok {
+		return suspended, nil
+	}
+
+	u, _, err := mc.client.Users.Get(ctx, user)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get user")
+	}
+
+	suspended := u.SuspendedAt != nil
+	mc.suspended[user] = suspended
+	return suspended, nil
+}
+
+func (mc *GitHubMembershipContext) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	perm, _, err := mc.client.Repositories.GetPermissionLevel(ctx, org, repo, user)
 	if err != nil {
 		return false, errors.Wrapf(err, "failed to get repo %s permission", desiredPerm)
 	}
 
 	return perm.GetPermission() == desiredPerm, nil
 }
+
+func (mc *GitHubMembershipContext) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	id, err := mc.teamID(ctx, team)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	opt := &github.TeamListTeamMembersOptions{}
+	for {
+		users, res, err := mc.client.Teams.ListTeamMembers(ctx, id, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list team members")
+		}
+
+		for _, u := range users {
+			members = append(members, u.GetLogin())
+			mc.membership[membershipKey(team, u.GetLogin())] = true
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return members, nil
+}
+
+func (mc *GitHubMembershipContext) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	var members []string
+	opt := &github.ListMembersOptions{}
+	for {
+		users, res, err := mc.client.Organizations.ListMembers(ctx, org, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list organization members")
+		}
+
+		for _, u := range users {
+			members = append(members, u.GetLogin())
+			mc.membership[membershipKey(org, u.GetLogin())] = true
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return members, nil
+}
+
+func (mc *GitHubMembershipContext) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	var collaborators []string
+	opt := &github.ListCollaboratorsOptions{}
+	for {
+		users, res, err := mc.client.Repositories.ListCollaborators(ctx, org, repo, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list repository collaborators")
+		}
+
+		for _, u := range users {
+			if collaboratorPermission(u) == desiredPerm {
+				collaborators = append(collaborators, u.GetLogin())
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return collaborators, nil
+}
+
+// collaboratorPermission converts the permission flags of a listed
+// collaborator to the permission level returned by GetPermissionLevel.
+func collaboratorPermission(u *github.User) string {
+	if u.Permissions == nil {
+		return "none"
+	}
+
+	perms := *u.Permissions
+	switch {
+	case perms["admin"]:
+		return "admin"
+	case perms["push"]:
+		return "write"
+	case perms["pull"]:
+		return "read"
+	}
+	return "none"
+}
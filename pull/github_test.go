@@ -34,15 +34,16 @@ func TestAuthor(t *testing.T) {
 		"testdata/responses/pull.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	author, err := ctx.Author()
+	author, err := prctx.Author(ctx)
 	require.NoError(t, err)
 
 	assert.Equal(t, "mhaypenny", author)
 	assert.Equal(t, 1, pullsRule.Count, "no http request was made")
 
-	author, err = ctx.Author()
+	author, err = prctx.Author(ctx)
 	require.NoError(t, err)
 
 	// verify that the pull request is cached
@@ -50,6 +51,100 @@ func TestAuthor(t *testing.T) {
 	assert.Equal(t, 1, pullsRule.Count, "cached pull request was not used")
 }
 
+func TestRequestedReviewers(t *testing.T) {
+	rp := &ResponsePlayer{}
+	requestsRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123/requested_reviewers"),
+		"testdata/responses/pull_requested_reviewers.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	requested, err := prctx.RequestedReviewers(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"bkeyes"}, requested.Users)
+	assert.Equal(t, []string{"testorg/security"}, requested.Teams)
+
+	// verify that the review requests are cached
+	_, err = prctx.RequestedReviewers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requestsRule.Count, "cached review requests were not used")
+}
+
+func TestSourceRepository(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123"),
+		"testdata/responses/pull_fork.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	repo, err := prctx.SourceRepository(ctx)
+	require.NoError(t, err)
+
+	expected := &Repository{
+		Owner:   "ttest",
+		Name:    "testrepo",
+		Private: true,
+		Fork:    true,
+	}
+	assert.Equal(t, expected, repo)
+	assert.Equal(t, "ttest/testrepo", repo.FullName())
+}
+
+func TestRepositoryTopics(t *testing.T) {
+	rp := &ResponsePlayer{}
+	topicsRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/topics"),
+		"testdata/responses/repo_topics.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	topics, err := prctx.RepositoryTopics(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"go", "tier-0"}, topics)
+	assert.Equal(t, 1, topicsRule.Count, "no http request was made")
+
+	// verify that the topics are cached
+	topics, err = prctx.RepositoryTopics(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"go", "tier-0"}, topics)
+	assert.Equal(t, 1, topicsRule.Count, "cached topics were not used")
+}
+
+func TestRepositoryCustomProperties(t *testing.T) {
+	rp := &ResponsePlayer{}
+	propertiesRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/properties/values"),
+		"testdata/responses/repo_properties.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	properties, err := prctx.RepositoryCustomProperties(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		"tier":   {"0"},
+		"owners": {"infra", "security"},
+	}, properties)
+	assert.Equal(t, 1, propertiesRule.Count, "no http request was made")
+
+	// verify that the properties are cached
+	_, err = prctx.RepositoryCustomProperties(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, propertiesRule.Count, "cached properties were not used")
+}
+
 func TestChangedFiles(t *testing.T) {
 	rp := &ResponsePlayer{}
 	filesRule := rp.AddRule(
@@ -57,9 +152,10 @@ func TestChangedFiles(t *testing.T) {
 		"testdata/responses/pull_files.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	files, err := ctx.ChangedFiles()
+	files, err := prctx.ChangedFiles(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, files, 3, "incorrect number of files")
@@ -72,13 +168,81 @@ func TestChangedFiles(t *testing.T) {
 	assert.Equal(t, FileDeleted, files[1].Status)
 
 	assert.Equal(t, "README.md", files[2].Filename)
+	assert.Equal(t, "README", files[2].PreviousFilename)
 	assert.Equal(t, FileModified, files[2].Status)
 
 	// verify that the file list is cached
-	files, err = ctx.ChangedFiles()
+	files, err = prctx.ChangedFiles(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, files, 3, "incorrect number of files")
+	assert.Equal(t, 2, filesRule.Count, "cached files were not used")
+}
+
+func TestChangedFilesIter(t *testing.T) {
+	rp := &ResponsePlayer{}
+	filesRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123/files"),
+		"testdata/responses/pull_files.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	var names []string
+	err := prctx.ChangedFilesIter(ctx, func(f *File) bool {
+		names = append(names, f.Filename)
+		return f.Filename != "path/foo.txt"
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"path/foo.txt"}, names)
+	assert.Equal(t, 1, filesRule.Count, "iteration did not stop after the first page")
+
+	// verify that a complete iteration caches the files
+	rp = &ResponsePlayer{}
+	filesRule = rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123/files"),
+		"testdata/responses/pull_files.yml",
+	)
+	prctx = makeContext(rp)
+
+	names = nil
+	err = prctx.ChangedFilesIter(ctx, func(f *File) bool {
+		names = append(names, f.Filename)
+		return true
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"path/foo.txt", "path/bar.txt", "README.md"}, names)
+	assert.Equal(t, 2, filesRule.Count, "no http request was made")
+
+	files, err := prctx.ChangedFiles(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, files, 3, "incorrect number of files")
+	assert.Equal(t, 2, filesRule.Count, "files from iteration were not cached")
+
+	// verify that iteration uses files cached by ChangedFiles
+	rp = &ResponsePlayer{}
+	filesRule = rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123/files"),
+		"testdata/responses/pull_files.yml",
+	)
+	prctx = makeContext(rp)
+
+	_, err = prctx.ChangedFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, filesRule.Count, "no http request was made")
+
+	names = nil
+	err = prctx.ChangedFilesIter(ctx, func(f *File) bool {
+		names = append(names, f.Filename)
+		return true
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"path/foo.txt", "path/bar.txt", "README.md"}, names)
 	assert.Equal(t, 2, filesRule.Count, "cached files were not used")
 }
 
@@ -93,9 +257,10 @@ func TestCommits(t *testing.T) {
 		"testdata/responses/pull_data_commits.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	commits, err := ctx.Commits()
+	commits, err := prctx.Commits(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, commits, 3, "incorrect number of commits")
@@ -107,6 +272,8 @@ func TestCommits(t *testing.T) {
 	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", commits[0].SHA)
 	assert.Equal(t, "ttest", commits[0].Author)
 	assert.Equal(t, "mhaypenny", commits[0].Committer)
+	assert.Equal(t, "ttest@example.com", commits[0].AuthorEmail)
+	assert.Equal(t, "mhaypenny@example.com", commits[0].CommitterEmail)
 	assert.Equal(t, expectedTime, commits[0].CreatedAt)
 
 	assert.Equal(t, "1fc89f1cedf8e3f3ce516ab75b5952295c8ea5e9", commits[1].SHA)
@@ -120,7 +287,7 @@ func TestCommits(t *testing.T) {
 	assert.Equal(t, expectedTime.Add(-48*time.Hour), commits[2].CreatedAt)
 
 	// verify that the commit list is cached
-	commits, err = ctx.Commits()
+	commits, err = prctx.Commits(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, commits, 3, "incorrect number of commits")
@@ -134,9 +301,10 @@ func TestReviews(t *testing.T) {
 		"testdata/responses/pull_data_reviews.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	reviews, err := ctx.Reviews()
+	reviews, err := prctx.Reviews(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, reviews, 2, "incorrect number of reviews")
@@ -149,20 +317,91 @@ func TestReviews(t *testing.T) {
 	assert.Equal(t, expectedTime, reviews[0].CreatedAt)
 	assert.Equal(t, ReviewChangesRequested, reviews[0].State)
 	assert.Equal(t, "", reviews[0].Body)
+	assert.Equal(t, "", reviews[0].SHA)
+	assert.Empty(t, reviews[0].OnBehalfOf)
 
 	assert.Equal(t, "bkeyes", reviews[1].Author)
 	assert.Equal(t, expectedTime.Add(time.Second), reviews[1].CreatedAt)
 	assert.Equal(t, ReviewApproved, reviews[1].State)
 	assert.Equal(t, "the body", reviews[1].Body)
+	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", reviews[1].SHA)
+	assert.Equal(t, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", reviews[1].TreeSHA)
+	assert.Equal(t, []string{"testorg/team-dba"}, reviews[1].OnBehalfOf)
+
+	assert.Len(t, ReviewsForCommit(reviews, "e05fcae367230ee709313dd2720da527d178ce43"), 1)
 
 	// verify that the review list is cached
-	reviews, err = ctx.Reviews()
+	reviews, err = prctx.Reviews(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, reviews, 2, "incorrect number of reviews")
 	assert.Equal(t, 2, dataRule.Count, "cached reviews were not used")
 }
 
+func TestReviewsAt(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.reviews"),
+		"testdata/responses/pull_data_reviews.yml",
+	)
+
+	asOf, err := time.Parse(time.RFC3339, "2018-06-27T20:33:26Z")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	prctx := makeContextAt(rp, asOf)
+
+	reviews, err := prctx.Reviews(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, reviews, 1, "incorrect number of reviews")
+	assert.Equal(t, "mhaypenny", reviews[0].Author)
+}
+
+func TestReviewThreads(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.reviewThreads"),
+		"testdata/responses/pull_data_review_threads.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	threads, err := prctx.ReviewThreads(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, threads, 2, "incorrect number of threads")
+	assert.Equal(t, "server/handler.go", threads[0].Path)
+	assert.Equal(t, "bkeyes", threads[0].Author)
+	assert.True(t, threads[0].Resolved)
+	require.Len(t, threads[0].Comments, 2, "incorrect number of comments")
+	assert.Equal(t, "server/handler.go", threads[0].Comments[1].Path)
+	assert.Equal(t, "README.md", threads[1].Path)
+}
+
+func TestReviewThreadsAt(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.reviewThreads"),
+		"testdata/responses/pull_data_review_threads.yml",
+	)
+
+	asOf, err := time.Parse(time.RFC3339, "2018-06-27T20:33:26Z")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	prctx := makeContextAt(rp, asOf)
+
+	threads, err := prctx.ReviewThreads(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, threads, 1, "threads started after the cutoff were not removed")
+	assert.Equal(t, "server/handler.go", threads[0].Path)
+	require.Len(t, threads[0].Comments, 1, "comments after the cutoff were not removed")
+	assert.Equal(t, "bkeyes", threads[0].Comments[0].Author)
+}
+
 func TestComments(t *testing.T) {
 	rp := &ResponsePlayer{}
 	dataRule := rp.AddRule(
@@ -170,9 +409,10 @@ func TestComments(t *testing.T) {
 		"testdata/responses/pull_data_comments.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	comments, err := ctx.Comments()
+	comments, err := prctx.Comments(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, comments, 2, "incorrect number of comments")
@@ -184,13 +424,14 @@ func TestComments(t *testing.T) {
 	assert.Equal(t, "bkeyes", comments[0].Author)
 	assert.Equal(t, expectedTime, comments[0].CreatedAt)
 	assert.Equal(t, ":+1:", comments[0].Body)
+	assert.Equal(t, "MDEyOklzc3VlQ29tbWVudDE=", comments[0].ID)
 
 	assert.Equal(t, "bulldozer[bot]", comments[1].Author)
 	assert.Equal(t, expectedTime.Add(time.Minute), comments[1].CreatedAt)
 	assert.Equal(t, "I merge!", comments[1].Body)
 
 	// verify that the commit list is cached
-	comments, err = ctx.Comments()
+	comments, err = prctx.Comments(ctx)
 	require.NoError(t, err)
 
 	require.Len(t, comments, 2, "incorrect number of comments")
@@ -220,16 +461,17 @@ func TestIsTeamMember(t *testing.T) {
 		"testdata/responses/membership_team456_ttest.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	isMember, err := ctx.IsTeamMember("testorg/yes-team", "mhaypenny")
+	isMember, err := prctx.IsTeamMember(ctx, "testorg/yes-team", "mhaypenny")
 	require.NoError(t, err)
 
 	assert.True(t, isMember, "user is not a member")
 	assert.Equal(t, 2, teamsRule.Count, "no http request was made for teams")
 	assert.Equal(t, 1, yesRule1.Count, "no http request was made")
 
-	isMember, err = ctx.IsTeamMember("testorg/yes-team", "ttest")
+	isMember, err = prctx.IsTeamMember(ctx, "testorg/yes-team", "ttest")
 	require.NoError(t, err)
 
 	assert.True(t, isMember, "user is not a member")
@@ -237,7 +479,7 @@ func TestIsTeamMember(t *testing.T) {
 	assert.Equal(t, 1, yesRule2.Count, "no http request was made")
 
 	// not a member because missing from team
-	isMember, err = ctx.IsTeamMember("testorg/no-team", "mhaypenny")
+	isMember, err = prctx.IsTeamMember(ctx, "testorg/no-team", "mhaypenny")
 	require.NoError(t, err)
 
 	assert.False(t, isMember, "user is a member")
@@ -245,7 +487,7 @@ func TestIsTeamMember(t *testing.T) {
 	assert.Equal(t, 1, noRule1.Count, "no http request was made")
 
 	// not a member because membership state is pending
-	isMember, err = ctx.IsTeamMember("testorg/no-team", "ttest")
+	isMember, err = prctx.IsTeamMember(ctx, "testorg/no-team", "ttest")
 	require.NoError(t, err)
 
 	assert.False(t, isMember, "user is a member")
@@ -253,7 +495,7 @@ func TestIsTeamMember(t *testing.T) {
 	assert.Equal(t, 1, noRule2.Count, "no http request was made")
 
 	// verify that team membership is cached
-	isMember, err = ctx.IsTeamMember("testorg/yes-team", "mhaypenny")
+	isMember, err = prctx.IsTeamMember(ctx, "testorg/yes-team", "mhaypenny")
 	require.NoError(t, err)
 
 	assert.True(t, isMember, "user is not a member")
@@ -272,15 +514,16 @@ func TestMixedPaging(t *testing.T) {
 		"testdata/responses/pull_data_mixed.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	comments, err := ctx.Comments()
+	comments, err := prctx.Comments(ctx)
 	require.NoError(t, err)
 
-	reviews, err := ctx.Reviews()
+	reviews, err := prctx.Reviews(ctx)
 	require.NoError(t, err)
 
-	commits, err := ctx.Commits()
+	commits, err := prctx.Commits(ctx)
 	require.NoError(t, err)
 
 	assert.Equal(t, 3, dataRule.Count, "cached values were not used")
@@ -300,29 +543,338 @@ func TestIsOrgMember(t *testing.T) {
 		"testdata/responses/membership_testorg_ttest.yml",
 	)
 
-	ctx := makeContext(rp)
+	ctx := context.Background()
+	prctx := makeContext(rp)
 
-	isMember, err := ctx.IsOrgMember("testorg", "mhaypenny")
+	isMember, err := prctx.IsOrgMember(ctx, "testorg", "mhaypenny")
 	require.NoError(t, err)
 
 	assert.True(t, isMember, "user is not a member")
 	assert.Equal(t, 1, yesRule.Count, "no http request was made")
 
-	isMember, err = ctx.IsOrgMember("testorg", "ttest")
+	isMember, err = prctx.IsOrgMember(ctx, "testorg", "ttest")
 	require.NoError(t, err)
 
 	assert.False(t, isMember, "user is a member")
 	assert.Equal(t, 1, noRule.Count, "no http request was made")
 
 	// verify that org membership is cached
-	isMember, err = ctx.IsOrgMember("testorg", "mhaypenny")
+	isMember, err = prctx.IsOrgMember(ctx, "testorg", "mhaypenny")
 	require.NoError(t, err)
 
 	assert.True(t, isMember, "user is not a member")
 	assert.Equal(t, 1, yesRule.Count, "cached membership was not used")
 }
 
+func TestOrganizationMembership(t *testing.T) {
+	rp := &ResponsePlayer{}
+	membershipRule := rp.AddRule(
+		ExactPathMatcher("/orgs/testorg/memberships/mhaypenny"),
+		"testdata/responses/org_membership_testorg_mhaypenny.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/orgs/testorg/memberships/ttest"),
+		"testdata/responses/org_membership_testorg_ttest.yml",
+	)
+	collaboratorsRule := rp.AddRule(
+		ExactPathMatcher("/orgs/testorg/outside_collaborators"),
+		"testdata/responses/outside_collaborators_testorg.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/users/mhaypenny"),
+		"testdata/responses/user_mhaypenny.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/users/ttest"),
+		"testdata/responses/user_ttest.yml",
+	)
+
+	ctx := context.Background()
+	prctx := makeContext(rp)
+
+	m, err := prctx.OrganizationMembership(ctx, "testorg", "mhaypenny")
+	require.NoError(t, err)
+
+	assert.Equal(t, &OrgMembership{Member: true, Role: "admin"}, m)
+	assert.Equal(t, 0, collaboratorsRule.Count, "outside collaborators were listed for a member")
+
+	m, err = prctx.OrganizationMembership(ctx, "testorg", "ttest")
+	require.NoError(t, err)
+
+	assert.Equal(t, &OrgMembership{OutsideCollaborator: true, Suspended: true}, m)
+	assert.Equal(t, 1, collaboratorsRule.Count, "no http request was made")
+
+	// verify that membership is cached
+	_, err = prctx.OrganizationMembership(ctx, "testorg", "mhaypenny")
+	require.NoError(t, err)
+	assert.Equal(t, 1, membershipRule.Count, "cached membership was not used")
+}
+
+func TestBaseChangedAt(t *testing.T) {
+	ctx := context.Background()
+	expected := time.Date(2018, time.June, 4, 10, 0, 0, 0, time.UTC)
+
+	rp := &ResponsePlayer{}
+	eventsRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/issues/123/events"),
+		"testdata/responses/issue_events.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	changedAt, err := prctx.BaseChangedAt(ctx)
+	require.NoError(t, err)
+
+	assert.True(t, expected.Equal(changedAt), "incorrect base change time: %s", changedAt)
+	assert.Equal(t, 1, eventsRule.Count, "no http request was made")
+
+	// verify that the time is cached
+	_, err = prctx.BaseChangedAt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, eventsRule.Count, "cached base change time was not used")
+
+	// verify that changes after the cutoff are ignored
+	prctx = makeContextAt(rp, time.Date(2018, time.June, 3, 10, 0, 0, 0, time.UTC))
+
+	changedAt, err = prctx.BaseChangedAt(ctx)
+	require.NoError(t, err)
+
+	expected = time.Date(2018, time.June, 2, 10, 0, 0, 0, time.UTC)
+	assert.True(t, expected.Equal(changedAt), "incorrect base change time: %s", changedAt)
+}
+
+func TestFileContents(t *testing.T) {
+	ctx := context.Background()
+
+	rp := &ResponsePlayer{}
+	logoRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/assets/logo.png"),
+		"testdata/responses/contents_logo.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/assets/video.mp4"),
+		"testdata/responses/contents_video.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/data/dump.sql"),
+		"testdata/responses/contents_dump.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	fc, err := prctx.FileContents(ctx, "assets/logo.png")
+	require.NoError(t, err)
+	assert.Equal(t, &FileContents{Size: 16, Binary: true}, fc)
+	assert.Equal(t, 1, logoRule.Count, "no http request was made")
+
+	fc, err = prctx.FileContents(ctx, "assets/video.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, &FileContents{Size: 130, LFS: true}, fc)
+
+	fc, err = prctx.FileContents(ctx, "data/dump.sql")
+	require.NoError(t, err)
+	assert.Equal(t, &FileContents{Size: 52428800}, fc)
+
+	// verify that contents are cached
+	_, err = prctx.FileContents(ctx, "assets/logo.png")
+	require.NoError(t, err)
+	assert.Equal(t, 1, logoRule.Count, "cached contents were not used")
+}
+
+func TestRefFileContent(t *testing.T) {
+	ctx := context.Background()
+
+	rp := &ResponsePlayer{}
+	securityRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/SECURITY.md"),
+		"testdata/responses/contents_security.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	content, err := prctx.RefFileContent(ctx, "SECURITY.md", "develop")
+	require.NoError(t, err)
+	assert.Equal(t, "# Security Policy\n", string(content))
+	assert.Equal(t, 1, securityRule.Count, "no http request was made")
+
+	content, err = prctx.RefFileContent(ctx, "CODEOWNERS", "develop")
+	require.NoError(t, err)
+	assert.Nil(t, content, "missing files should have no content")
+
+	// verify that contents are cached
+	_, err = prctx.RefFileContent(ctx, "SECURITY.md", "develop")
+	require.NoError(t, err)
+	assert.Equal(t, 1, securityRule.Count, "cached contents were not used")
+}
+
+func TestTimeline(t *testing.T) {
+	ctx := context.Background()
+
+	rp := &ResponsePlayer{}
+	timelineRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.timelineItems"),
+		"testdata/responses/pull_timeline.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	timeline, err := prctx.Timeline(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, timeline, 5, "incorrect number of events")
+	assert.Equal(t, 2, timelineRule.Count, "no http request was made")
+
+	expectedTime := time.Date(2018, time.June, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, TimelinePush, timeline[0].Type)
+	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", timeline[0].SHA)
+	assert.True(t, expectedTime.Equal(timeline[0].CreatedAt), "incorrect push time: %s", timeline[0].CreatedAt)
+
+	assert.Equal(t, TimelineReview, timeline[1].Type)
+	assert.Equal(t, "mhaypenny", timeline[1].Actor)
+	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", timeline[1].SHA)
+
+	assert.Equal(t, TimelineForcePush, timeline[2].Type)
+	assert.Equal(t, "ttest", timeline[2].Actor)
+	assert.Equal(t, "aaf3d0b2e1f8f7fd0e4d8d6a4656b4fd8c0e8e7f", timeline[2].SHA)
+
+	assert.Equal(t, TimelineReviewDismissed, timeline[3].Type)
+	assert.Equal(t, "policy-bot[bot]", timeline[3].Actor)
+	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", timeline[3].SHA)
+
+	assert.Equal(t, TimelineBaseChanged, timeline[4].Type)
+	assert.Equal(t, "mhaypenny", timeline[4].Actor)
+	assert.Equal(t, "feature-base", timeline[4].PreviousRef)
+	assert.Equal(t, "develop", timeline[4].CurrentRef)
+
+	// verify that the timeline is cached
+	_, err = prctx.Timeline(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, timelineRule.Count, "cached timeline was not used")
+
+	// verify that events after the cutoff are ignored
+	rp = &ResponsePlayer{}
+	rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.timelineItems"),
+		"testdata/responses/pull_timeline.yml",
+	)
+	prctx = makeContextAt(rp, time.Date(2018, time.June, 3, 12, 0, 0, 0, time.UTC))
+
+	timeline, err = prctx.Timeline(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, timeline, 3, "incorrect number of events")
+	assert.Equal(t, TimelineForcePush, timeline[2].Type)
+}
+
+func TestBranchPullRequest(t *testing.T) {
+	ctx := context.Background()
+
+	rp := &ResponsePlayer{}
+	pullsRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls"),
+		"testdata/responses/branch_pulls.yml",
+	)
+	statusRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/commits/b5a1e4c0ad6a4bbd3bb8b1b47c1a7d9f6f6c2b71/status"),
+		"testdata/responses/branch_statuses.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	ref, err := prctx.BranchPullRequest(ctx, "feature-base")
+	require.NoError(t, err)
+
+	expected := &PullRequestRef{
+		Number:  122,
+		Base:    "develop",
+		Head:    "feature-base",
+		HeadSHA: "b5a1e4c0ad6a4bbd3bb8b1b47c1a7d9f6f6c2b71",
+		Open:    true,
+		Statuses: map[string]string{
+			"policy-bot: develop": "success",
+			"ci/build":            "pending",
+		},
+	}
+	assert.Equal(t, expected, ref)
+	assert.Equal(t, 1, pullsRule.Count, "no http request was made")
+	assert.Equal(t, 1, statusRule.Count, "no http request was made")
+
+	// verify that the pull request is cached
+	_, err = prctx.BranchPullRequest(ctx, "feature-base")
+	require.NoError(t, err)
+	assert.Equal(t, 1, pullsRule.Count, "cached pull request was not used")
+}
+
+func TestAuthorMergedPullRequests(t *testing.T) {
+	ctx := context.Background()
+
+	rp := &ResponsePlayer{}
+	searchRule := rp.AddRule(
+		ExactPathMatcher("/search/issues"),
+		"testdata/responses/search_merged_pulls.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	since := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	count, err := prctx.AuthorMergedPullRequests(ctx, since)
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, count)
+	assert.Equal(t, 1, searchRule.Count, "no http request was made")
+
+	// verify that counts for the same day are cached
+	_, err = prctx.AuthorMergedPullRequests(ctx, since.Add(6*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, searchRule.Count, "cached count was not used")
+}
+
+func TestBlame(t *testing.T) {
+	ctx := context.Background()
+
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123"),
+		"testdata/responses/pull.yml",
+	)
+	compareRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/compare/develop...e05fcae367230ee709313dd2720da527d178ce43"),
+		"testdata/responses/compare_merge_base.yml",
+	)
+	blameRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.object.Commit.blame"),
+		"testdata/responses/blame.yml",
+	)
+
+	prctx := makeContext(rp)
+
+	blame, err := prctx.Blame(ctx, "path/foo.txt", []int{2, 4, 10})
+	require.NoError(t, err)
+
+	require.Len(t, blame, 2, "incorrect number of lines")
+	assert.Equal(t, &BlameLine{
+		SHA:        "4f2e1d0c9b8a7f6e5d4c3b2a1f0e9d8c7b6a5f4e",
+		Author:     "mhaypenny",
+		AuthoredAt: time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC),
+	}, blame[2])
+	assert.Equal(t, "0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b", blame[4].SHA)
+	assert.Equal(t, "", blame[4].Author)
+	assert.Equal(t, 1, compareRule.Count, "no http request was made")
+	assert.Equal(t, 1, blameRule.Count, "no http request was made")
+
+	// verify that the blame is cached
+	blame, err = prctx.Blame(ctx, "path/foo.txt", []int{1})
+	require.NoError(t, err)
+	assert.Equal(t, "mhaypenny", blame[1].Author)
+	assert.Equal(t, 1, compareRule.Count, "cached merge base was not used")
+	assert.Equal(t, 1, blameRule.Count, "cached blame was not used")
+}
+
 func makeContext(rp *ResponsePlayer) Context {
+	return makeContextAt(rp, time.Time{})
+}
+
+func makeContextAt(rp *ResponsePlayer, asOf time.Time) Context {
 	ctx := context.Background()
 	client := github.NewClient(&http.Client{Transport: rp})
 	v4client := githubv4.NewClient(&http.Client{Transport: rp})
@@ -330,7 +882,7 @@ func makeContext(rp *ResponsePlayer) Context {
 	base, _ := url.Parse("http://github.localhost/")
 	client.BaseURL = base
 
-	mbrCtx := NewGitHubMembershipContext(ctx, client)
+	mbrCtx := NewGitHubMembershipContext(client)
 	pr, _, _ := client.PullRequests.Get(ctx, "testorg", "testrepo", 123)
 	if pr == nil {
 		// create a stub PR if none is returned from the response player
@@ -339,6 +891,7 @@ func makeContext(rp *ResponsePlayer) Context {
 
 	pr.Number = github.Int(123)
 	pr.Base = &github.PullRequestBranch{
+		Ref: github.String(pr.GetBase().GetRef()),
 		Repo: &github.Repository{
 			Owner: &github.User{
 				Login: github.String("testorg"),
@@ -347,5 +900,5 @@ func makeContext(rp *ResponsePlayer) Context {
 		},
 	}
 
-	return NewGitHubContext(ctx, mbrCtx, client, v4client, pr)
+	return NewGitHubContextAt(mbrCtx, client, v4client, pr, asOf)
 }
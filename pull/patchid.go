@@ -0,0 +1,83 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// PatchID returns an identifier of the changes to the files, like the one
+// computed by "git patch-id --stable". Whitespace, line numbers, and the order
+// of files are ignored, so a diff has the same patch ID after it is rebased
+// onto a new base as long as its changes and their context are identical. The
+// second result is false if a file has changes without a patch, like a binary
+// file, because the changes cannot be compared.
+func PatchID(files []*File) (string, bool) {
+	sorted := make([]*File, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Filename < sorted[j].Filename })
+
+	h := sha1.New()
+	for _, f := range sorted {
+		if f.Patch == "" && (f.PreviousFilename == "" || f.Additions+f.Deletions > 0) {
+			return "", false
+		}
+
+		fmt.Fprintf(h, "diff %s %s %d\n", f.PreviousFilename, f.Filename, f.Status)
+		for _, line := range strings.Split(f.Patch, "\n") {
+			if line == "" || strings.HasPrefix(line, "@@") {
+				continue
+			}
+			fmt.Fprintf(h, "%s\n", stripSpace(line))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// CommitPatchID returns the patch ID of the changes of the pull request as
+// of the given commit, comparing the commit to the base branch. The second
+// result is false if the changes cannot be compared.
+func CommitPatchID(ctx context.Context, prctx Context, sha string) (string, bool, error) {
+	var files []*File
+	var err error
+	if sha == prctx.HeadSHA() {
+		files, err = prctx.ChangedFiles(ctx)
+	} else {
+		files, err = prctx.CommitChangedFiles(ctx, sha)
+	}
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to get files changed as of %s", sha)
+	}
+
+	id, ok := PatchID(files)
+	return id, ok, nil
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
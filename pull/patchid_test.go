@@ -0,0 +1,64 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchID(t *testing.T) {
+	app := &File{Filename: "app.go", Status: FileModified, Patch: "@@ -4,2 +4,3 @@\n context\n-old\n+new"}
+	docs := &File{Filename: "docs.md", Status: FileAdded, Patch: "@@ -0,0 +1 @@\n+# Docs"}
+
+	id, ok := PatchID([]*File{app, docs})
+	assert.True(t, ok)
+	assert.NotEmpty(t, id)
+
+	t.Run("rebased", func(t *testing.T) {
+		rebased := &File{Filename: "app.go", Status: FileModified, Patch: "@@ -40,2 +52,3 @@\n context\n-old\n+new"}
+		other, ok := PatchID([]*File{docs, rebased})
+		assert.True(t, ok)
+		assert.Equal(t, id, other, "line numbers and file order are ignored")
+	})
+
+	t.Run("whitespace", func(t *testing.T) {
+		reindented := &File{Filename: "app.go", Status: FileModified, Patch: "@@ -4,2 +4,3 @@\n   context\n-  old\n+\tnew"}
+		other, ok := PatchID([]*File{reindented, docs})
+		assert.True(t, ok)
+		assert.Equal(t, id, other)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		changed := &File{Filename: "app.go", Status: FileModified, Patch: "@@ -4,2 +4,3 @@\n context\n-old\n+newer"}
+		other, ok := PatchID([]*File{changed, docs})
+		assert.True(t, ok)
+		assert.NotEqual(t, id, other)
+
+		moved := &File{Filename: "context.go", Status: FileModified, Patch: app.Patch}
+		other, ok = PatchID([]*File{moved, docs})
+		assert.True(t, ok)
+		assert.NotEqual(t, id, other)
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		_, ok := PatchID([]*File{app, {Filename: "logo.png", Status: FileModified}})
+		assert.False(t, ok)
+
+		_, ok = PatchID([]*File{app, {Filename: "new.go", PreviousFilename: "old.go", Status: FileModified}})
+		assert.True(t, ok, "renames without changes can be compared")
+	})
+}
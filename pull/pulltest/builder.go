@@ -0,0 +1,372 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pulltest
+
+import (
+	"time"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Builder creates a Context with chained method calls. It is intended for
+// tests of policies, where listing every field of a Context is verbose:
+//
+//	prctx := pulltest.New().
+//		WithAuthor("mhaypenny").
+//		WithFiles(&pull.File{Filename: "app/main.go"}).
+//		WithTeams("ttest", "org/reviewers").
+//		Build()
+type Builder struct {
+	c      Context
+	errors map[string]error
+	hooks  []func(method string) error
+}
+
+// New returns a Builder for an empty Context.
+func New() *Builder {
+	return &Builder{}
+}
+
+// WithLocator sets the locator of the pull request.
+func (b *Builder) WithLocator(locator string) *Builder {
+	b.c.LocatorValue = locator
+	return b
+}
+
+// WithHeadSHA sets the SHA of the head commit of the pull request.
+func (b *Builder) WithHeadSHA(sha string) *Builder {
+	b.c.HeadSHAValue = sha
+	return b
+}
+
+// WithRepository sets the owner and name of the target repository.
+func (b *Builder) WithRepository(owner, name string) *Builder {
+	b.c.OwnerValue = owner
+	b.c.RepoValue = name
+	return b
+}
+
+// WithTopics sets the topics of the target repository.
+func (b *Builder) WithTopics(topics ...string) *Builder {
+	b.c.RepositoryTopicsValue = topics
+	return b
+}
+
+// WithProperty sets the values of a custom property of the target repository.
+func (b *Builder) WithProperty(name string, values ...string) *Builder {
+	if b.c.RepositoryCustomPropertiesValue == nil {
+		b.c.RepositoryCustomPropertiesValue = make(map[string][]string)
+	}
+	b.c.RepositoryCustomPropertiesValue[name] = values
+	return b
+}
+
+// WithSourceRepository sets the repository that contains the head branch.
+func (b *Builder) WithSourceRepository(repo *pull.Repository) *Builder {
+	b.c.SourceRepositoryValue = repo
+	return b
+}
+
+// WithAuthor sets the user who opened the pull request.
+func (b *Builder) WithAuthor(author string) *Builder {
+	b.c.AuthorValue = author
+	return b
+}
+
+// WithCreatedAt sets the time when the pull request was opened.
+func (b *Builder) WithCreatedAt(t time.Time) *Builder {
+	b.c.CreatedAtValue = t
+	return b
+}
+
+// WithTitle sets the title of the pull request.
+func (b *Builder) WithTitle(title string) *Builder {
+	b.c.TitleValue = title
+	return b
+}
+
+// WithBody sets the description of the pull request.
+func (b *Builder) WithBody(body string) *Builder {
+	b.c.BodyValue = body
+	return b
+}
+
+// WithFiles adds changed files to the pull request.
+func (b *Builder) WithFiles(files ...*pull.File) *Builder {
+	b.c.ChangedFilesValue = append(b.c.ChangedFilesValue, files...)
+	return b
+}
+
+// WithFileContents sets the contents of a file at the head of the pull
+// request.
+func (b *Builder) WithFileContents(path string, contents *pull.FileContents) *Builder {
+	if b.c.FileContentsValue == nil {
+		b.c.FileContentsValue = make(map[string]*pull.FileContents)
+	}
+	b.c.FileContentsValue[path] = contents
+	return b
+}
+
+// WithBaseFile sets the content of a file on the base branch.
+func (b *Builder) WithBaseFile(path string, content []byte) *Builder {
+	if b.c.BaseFilesValue == nil {
+		b.c.BaseFilesValue = make(map[string][]byte)
+	}
+	b.c.BaseFilesValue[path] = content
+	return b
+}
+
+// WithRefFile sets the content of a file at a ref.
+func (b *Builder) WithRefFile(ref, path string, content []byte) *Builder {
+	if b.c.RefFilesValue == nil {
+		b.c.RefFilesValue = make(map[string]map[string][]byte)
+	}
+	if b.c.RefFilesValue[ref] == nil {
+		b.c.RefFilesValue[ref] = make(map[string][]byte)
+	}
+	b.c.RefFilesValue[ref][path] = content
+	return b
+}
+
+// WithCommits adds commits to the pull request.
+func (b *Builder) WithCommits(commits ...*pull.Commit) *Builder {
+	b.c.CommitsValue = append(b.c.CommitsValue, commits...)
+	return b
+}
+
+// WithComments adds comments to the pull request.
+func (b *Builder) WithComments(comments ...*pull.Comment) *Builder {
+	b.c.CommentsValue = append(b.c.CommentsValue, comments...)
+	return b
+}
+
+// WithReviews adds reviews to the pull request.
+func (b *Builder) WithReviews(reviews ...*pull.Review) *Builder {
+	b.c.ReviewsValue = append(b.c.ReviewsValue, reviews...)
+	return b
+}
+
+// WithRequestedReviewers adds users with pending review requests.
+func (b *Builder) WithRequestedReviewers(users ...string) *Builder {
+	b.c.RequestedReviewersValue = append(b.c.RequestedReviewersValue, users...)
+	return b
+}
+
+// WithRequestedTeams adds teams with pending review requests, specified as
+// "org-name/team-name".
+func (b *Builder) WithRequestedTeams(teams ...string) *Builder {
+	b.c.RequestedTeamsValue = append(b.c.RequestedTeamsValue, teams...)
+	return b
+}
+
+// WithTeams adds the user to teams, specified as "org-name/team-name".
+func (b *Builder) WithTeams(user string, teams ...string) *Builder {
+	b.c.TeamMemberships = addMemberships(b.c.TeamMemberships, user, teams)
+	return b
+}
+
+// WithOrgs adds the user to organizations.
+func (b *Builder) WithOrgs(user string, orgs ...string) *Builder {
+	b.c.OrgMemberships = addMemberships(b.c.OrgMemberships, user, orgs)
+	return b
+}
+
+// WithOutsideCollaborator makes the user an outside collaborator in
+// organizations.
+func (b *Builder) WithOutsideCollaborator(user string, orgs ...string) *Builder {
+	b.c.OutsideCollaborators = addMemberships(b.c.OutsideCollaborators, user, orgs)
+	return b
+}
+
+// WithSuspendedUsers marks user accounts as suspended.
+func (b *Builder) WithSuspendedUsers(users ...string) *Builder {
+	b.c.SuspendedUsers = append(b.c.SuspendedUsers, users...)
+	return b
+}
+
+// WithCollaborator gives the user permissions on the target repository.
+func (b *Builder) WithCollaborator(user string, perms ...string) *Builder {
+	b.c.CollaboratorMemberships = addMemberships(b.c.CollaboratorMemberships, user, perms)
+	return b
+}
+
+// WithBranches sets the base and head branch names.
+func (b *Builder) WithBranches(base, head string) *Builder {
+	b.c.BranchBaseName = base
+	b.c.BranchHeadName = head
+	return b
+}
+
+// WithBaseChangedAt sets the time when the base branch last changed.
+func (b *Builder) WithBaseChangedAt(t time.Time) *Builder {
+	b.c.BaseChangedAtValue = t
+	return b
+}
+
+// WithReviewThreads adds review conversations.
+func (b *Builder) WithReviewThreads(threads ...*pull.ReviewThread) *Builder {
+	b.c.ReviewThreadsValue = append(b.c.ReviewThreadsValue, threads...)
+	return b
+}
+
+// WithTargetCommits adds recent commits on the target branch.
+func (b *Builder) WithTargetCommits(commits ...*pull.Commit) *Builder {
+	b.c.TargetCommitsValue = append(b.c.TargetCommitsValue, commits...)
+	return b
+}
+
+// WithTimeline adds timeline events. Events must be added in order.
+func (b *Builder) WithTimeline(events ...*pull.TimelineEvent) *Builder {
+	b.c.TimelineValue = append(b.c.TimelineValue, events...)
+	return b
+}
+
+// WithBranchPullRequest adds a pull request whose head is the given branch.
+func (b *Builder) WithBranchPullRequest(branch string, ref *pull.PullRequestRef) *Builder {
+	if b.c.BranchPullRequestsValue == nil {
+		b.c.BranchPullRequestsValue = make(map[string]*pull.PullRequestRef)
+	}
+	b.c.BranchPullRequestsValue[branch] = ref
+	return b
+}
+
+// WithAuthorMergedPullRequests adds other pull requests by the author that
+// were merged at the given times.
+func (b *Builder) WithAuthorMergedPullRequests(mergedAt ...time.Time) *Builder {
+	b.c.AuthorMergedAtValue = append(b.c.AuthorMergedAtValue, mergedAt...)
+	return b
+}
+
+// WithBlame sets the commit that last changed the given lines of a file.
+func (b *Builder) WithBlame(path string, blame *pull.BlameLine, lines ...int) *Builder {
+	if b.c.BlameValue == nil {
+		b.c.BlameValue = make(map[string]map[int]*pull.BlameLine)
+	}
+	if b.c.BlameValue[path] == nil {
+		b.c.BlameValue[path] = make(map[int]*pull.BlameLine)
+	}
+	for _, n := range lines {
+		b.c.BlameValue[path][n] = blame
+	}
+	return b
+}
+
+// WithError makes the named Context method, like "ChangedFiles" or
+// "IsTeamMember", return err. An error for "ChangedFiles" also applies to
+// "ChangedFilesIter".
+func (b *Builder) WithError(method string, err error) *Builder {
+	if b.errors == nil {
+		b.errors = make(map[string]error)
+	}
+	b.errors[method] = err
+	if method == "ChangedFiles" {
+		b.errors["ChangedFilesIter"] = err
+	}
+	return b
+}
+
+// WithErrorHook adds a hook that is called with the name of each Context
+// method. If the hook returns an error, the method returns that error. Hooks
+// are called in the order they are added and after errors set by WithError.
+func (b *Builder) WithErrorHook(hook func(method string) error) *Builder {
+	b.hooks = append(b.hooks, hook)
+	return b
+}
+
+// Build returns a new Context. Later changes to the Builder do not affect
+// previously built contexts.
+func (b *Builder) Build() *Context {
+	c := b.c
+
+	c.ChangedFilesValue = append([]*pull.File(nil), b.c.ChangedFilesValue...)
+	c.CommitsValue = append([]*pull.Commit(nil), b.c.CommitsValue...)
+	c.CommentsValue = append([]*pull.Comment(nil), b.c.CommentsValue...)
+	c.ReviewsValue = append([]*pull.Review(nil), b.c.ReviewsValue...)
+	c.RequestedReviewersValue = append([]string(nil), b.c.RequestedReviewersValue...)
+	c.RequestedTeamsValue = append([]string(nil), b.c.RequestedTeamsValue...)
+	c.TargetCommitsValue = append([]*pull.Commit(nil), b.c.TargetCommitsValue...)
+	c.ReviewThreadsValue = append([]*pull.ReviewThread(nil), b.c.ReviewThreadsValue...)
+	c.TimelineValue = append([]*pull.TimelineEvent(nil), b.c.TimelineValue...)
+	c.AuthorMergedAtValue = append([]time.Time(nil), b.c.AuthorMergedAtValue...)
+	if b.c.BranchPullRequestsValue != nil {
+		c.BranchPullRequestsValue = make(map[string]*pull.PullRequestRef, len(b.c.BranchPullRequestsValue))
+		for branch, ref := range b.c.BranchPullRequestsValue {
+			c.BranchPullRequestsValue[branch] = ref
+		}
+	}
+	if b.c.FileContentsValue != nil {
+		c.FileContentsValue = make(map[string]*pull.FileContents, len(b.c.FileContentsValue))
+		for path, fc := range b.c.FileContentsValue {
+			c.FileContentsValue[path] = fc
+		}
+	}
+	if b.c.BlameValue != nil {
+		c.BlameValue = make(map[string]map[int]*pull.BlameLine, len(b.c.BlameValue))
+		for path, lines := range b.c.BlameValue {
+			c.BlameValue[path] = make(map[int]*pull.BlameLine, len(lines))
+			for n, line := range lines {
+				c.BlameValue[path][n] = line
+			}
+		}
+	}
+	c.RepositoryCustomPropertiesValue = copyMemberships(b.c.RepositoryCustomPropertiesValue)
+	c.TeamMemberships = copyMemberships(b.c.TeamMemberships)
+	c.OrgMemberships = copyMemberships(b.c.OrgMemberships)
+	c.OutsideCollaborators = copyMemberships(b.c.OutsideCollaborators)
+	c.SuspendedUsers = append([]string(nil), b.c.SuspendedUsers...)
+	c.CollaboratorMemberships = copyMemberships(b.c.CollaboratorMemberships)
+
+	errors := make(map[string]error, len(b.errors))
+	for method, err := range b.errors {
+		errors[method] = err
+	}
+	hooks := append([]func(string) error(nil), b.hooks...)
+
+	if len(errors) > 0 || len(hooks) > 0 {
+		c.ErrorHook = func(method string) error {
+			if err := errors[method]; err != nil {
+				return err
+			}
+			for _, hook := range hooks {
+				if err := hook(method); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	return &c
+}
+
+func addMemberships(m map[string][]string, user string, groups []string) map[string][]string {
+	if m == nil {
+		m = make(map[string][]string)
+	}
+	m[user] = append(m[user], groups...)
+	return m
+}
+
+func copyMemberships(m map[string][]string) map[string][]string {
+	if m == nil {
+		return nil
+	}
+
+	c := make(map[string][]string, len(m))
+	for k, v := range m {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
@@ -0,0 +1,93 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pulltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+func TestBuilder(t *testing.T) {
+	ctx := context.Background()
+
+	b := New().
+		WithAuthor("mhaypenny").
+		WithFiles(&pull.File{Filename: "app/main.go"}).
+		WithTeams("ttest", "org/team1", "org/team2").
+		WithBranches("develop", "feature")
+
+	prctx := b.Build()
+
+	author, err := prctx.Author(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "mhaypenny", author)
+
+	files, err := prctx.ChangedFiles(ctx)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	isMember, err := prctx.IsTeamMember(ctx, "org/team2", "ttest")
+	require.NoError(t, err)
+	assert.True(t, isMember, "ttest is not a member of org/team2")
+
+	// later changes do not affect built contexts
+	b.WithFiles(&pull.File{Filename: "README.md"}).WithTeams("ttest", "org/team3")
+
+	files, err = prctx.ChangedFiles(ctx)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	isMember, err = prctx.IsTeamMember(ctx, "org/team3", "ttest")
+	require.NoError(t, err)
+	assert.False(t, isMember, "ttest is a member of org/team3")
+}
+
+func TestBuilderErrors(t *testing.T) {
+	ctx := context.Background()
+
+	filesErr := errors.New("files failed")
+	hookErr := errors.New("hook failed")
+
+	var called []string
+	prctx := New().
+		WithAuthor("mhaypenny").
+		WithError("ChangedFiles", filesErr).
+		WithErrorHook(func(method string) error {
+			called = append(called, method)
+			if method == "Reviews" {
+				return hookErr
+			}
+			return nil
+		}).
+		Build()
+
+	_, err := prctx.ChangedFiles(ctx)
+	assert.Equal(t, filesErr, err)
+
+	_, err = prctx.Reviews(ctx)
+	assert.Equal(t, hookErr, err)
+
+	author, err := prctx.Author(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "mhaypenny", author)
+
+	assert.Equal(t, []string{"Reviews", "Author"}, called)
+}
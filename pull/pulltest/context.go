@@ -15,20 +15,62 @@
 package pulltest
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
 	"github.com/palantir/policy-bot/pull"
 )
 
 type Context struct {
 	LocatorValue string
+	HeadSHAValue string
 	OwnerValue   string
 	RepoValue    string
 
+	RepositoryTopicsValue []string
+	RepositoryTopicsError error
+
+	RepositoryCustomPropertiesValue map[string][]string
+	RepositoryCustomPropertiesError error
+
+	TargetRepositoryValue *pull.Repository
+	TargetRepositoryError error
+
+	SourceRepositoryValue *pull.Repository
+	SourceRepositoryError error
+
 	AuthorValue string
 	AuthorError error
 
+	CreatedAtValue time.Time
+	CreatedAtError error
+
+	TitleValue string
+	TitleError error
+
+	BodyValue string
+	BodyError error
+
 	ChangedFilesValue []*pull.File
 	ChangedFilesError error
 
+	// FileContentsValue maps file paths to their contents. Paths that are
+	// not in the map do not exist.
+	FileContentsValue map[string]*pull.FileContents
+	FileContentsError error
+
+	// BaseFilesValue maps file paths to their content on the base branch.
+	// Paths that are not in the map do not exist.
+	BaseFilesValue map[string][]byte
+	BaseFilesError error
+
+	// RefFilesValue maps refs to file paths to their content at that ref.
+	// Files at the base branch that are not in the map use BaseFilesValue.
+	RefFilesValue map[string]map[string][]byte
+	RefFilesError error
+
 	CommitsValue []*pull.Commit
 	CommitsError error
 
@@ -38,12 +80,23 @@ type Context struct {
 	ReviewsValue []*pull.Review
 	ReviewsError error
 
+	RequestedReviewersValue []string
+	RequestedTeamsValue     []string
+	RequestedReviewersError error
+
 	TeamMemberships     map[string][]string
 	TeamMembershipError error
 
 	OrgMemberships     map[string][]string
 	OrgMembershipError error
 
+	// OutsideCollaborators maps users to the organizations in which they are
+	// outside collaborators.
+	OutsideCollaborators map[string][]string
+
+	// SuspendedUsers lists users with suspended accounts.
+	SuspendedUsers []string
+
 	CollaboratorMemberships     map[string][]string
 	CollaboratorMembershipError error
 
@@ -51,8 +104,44 @@ type Context struct {
 	BranchHeadName string
 	BranchesError  error
 
+	BaseChangedAtValue time.Time
+	BaseChangedAtError error
+
+	ReviewThreadsValue []*pull.ReviewThread
+	ReviewThreadsError error
+
 	TargetCommitsValue []*pull.Commit
 	TargetCommitsError error
+
+	TimelineValue []*pull.TimelineEvent
+	TimelineError error
+
+	BranchPullRequestsValue map[string]*pull.PullRequestRef
+	BranchPullRequestError  error
+
+	// AuthorMergedAtValue lists when the other pull requests by the author
+	// were merged.
+	AuthorMergedAtValue           []time.Time
+	AuthorMergedPullRequestsError error
+
+	// CommitChangedFilesValue maps commit SHAs to the files the pull request
+	// changed as of that commit.
+	CommitChangedFilesValue map[string][]*pull.File
+	CommitChangedFilesError error
+
+	// BlameValue maps file paths to line numbers to the commits that last
+	// changed those lines.
+	BlameValue map[string]map[int]*pull.BlameLine
+	BlameError error
+
+	// ErrorHook, if set, is called with the name of each method before it
+	// returns. A non-nil error from the hook is returned by the method
+	// instead of the method's configured error.
+	ErrorHook func(method string) error
+}
+
+func (c *Context) HeadSHA() string {
+	return c.HeadSHAValue
 }
 
 func (c *Context) Locator() string {
@@ -76,21 +165,92 @@ func (c *Context) RepositoryName() string {
 	return "context"
 }
 
-func (c *Context) Author() (string, error) {
-	return c.AuthorValue, c.AuthorError
+func (c *Context) RepositoryTopics(ctx context.Context) ([]string, error) {
+	return c.RepositoryTopicsValue, c.err("RepositoryTopics", c.RepositoryTopicsError)
+}
+
+func (c *Context) RepositoryCustomProperties(ctx context.Context) (map[string][]string, error) {
+	return c.RepositoryCustomPropertiesValue, c.err("RepositoryCustomProperties", c.RepositoryCustomPropertiesError)
+}
+
+func (c *Context) TargetRepository(ctx context.Context) (*pull.Repository, error) {
+	repo := c.TargetRepositoryValue
+	if repo == nil {
+		repo = &pull.Repository{Owner: c.RepositoryOwner(), Name: c.RepositoryName()}
+	}
+	return repo, c.err("TargetRepository", c.TargetRepositoryError)
+}
+
+func (c *Context) SourceRepository(ctx context.Context) (*pull.Repository, error) {
+	return c.SourceRepositoryValue, c.err("SourceRepository", c.SourceRepositoryError)
+}
+
+func (c *Context) Author(ctx context.Context) (string, error) {
+	return c.AuthorValue, c.err("Author", c.AuthorError)
+}
+
+func (c *Context) CreatedAt(ctx context.Context) (time.Time, error) {
+	return c.CreatedAtValue, c.err("CreatedAt", c.CreatedAtError)
+}
+
+func (c *Context) Title(ctx context.Context) (string, error) {
+	return c.TitleValue, c.err("Title", c.TitleError)
 }
 
-func (c *Context) ChangedFiles() ([]*pull.File, error) {
-	return c.ChangedFilesValue, c.ChangedFilesError
+func (c *Context) Body(ctx context.Context) (string, error) {
+	return c.BodyValue, c.err("Body", c.BodyError)
 }
 
-func (c *Context) Commits() ([]*pull.Commit, error) {
-	return c.CommitsValue, c.CommitsError
+func (c *Context) ChangedFiles(ctx context.Context) ([]*pull.File, error) {
+	return c.ChangedFilesValue, c.err("ChangedFiles", c.ChangedFilesError)
 }
 
-func (c *Context) IsTeamMember(team, user string) (bool, error) {
-	if c.TeamMembershipError != nil {
-		return false, c.TeamMembershipError
+func (c *Context) ChangedFilesIter(ctx context.Context, fn func(*pull.File) bool) error {
+	if err := c.err("ChangedFilesIter", c.ChangedFilesError); err != nil {
+		return err
+	}
+	for _, f := range c.ChangedFilesValue {
+		if !fn(f) {
+			break
+		}
+	}
+	return nil
+}
+
+func (c *Context) FileContents(ctx context.Context, path string) (*pull.FileContents, error) {
+	if err := c.err("FileContents", c.FileContentsError); err != nil {
+		return nil, err
+	}
+	if fc, ok := c.FileContentsValue[path]; ok {
+		return fc, nil
+	}
+	return nil, fmt.Errorf("file %s does not exist", path)
+}
+
+func (c *Context) BaseFileContent(ctx context.Context, path string) ([]byte, error) {
+	return c.BaseFilesValue[path], c.err("BaseFileContent", c.BaseFilesError)
+}
+
+func (c *Context) RefFileContent(ctx context.Context, path, ref string) ([]byte, error) {
+	if err := c.err("RefFileContent", c.RefFilesError); err != nil {
+		return nil, err
+	}
+	if files, ok := c.RefFilesValue[ref]; ok {
+		return files[path], nil
+	}
+	if ref == c.BranchBaseName {
+		return c.BaseFilesValue[path], nil
+	}
+	return nil, nil
+}
+
+func (c *Context) Commits(ctx context.Context) ([]*pull.Commit, error) {
+	return c.CommitsValue, c.err("Commits", c.CommitsError)
+}
+
+func (c *Context) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	if err := c.err("IsTeamMember", c.TeamMembershipError); err != nil {
+		return false, err
 	}
 
 	for _, t := range c.TeamMemberships[user] {
@@ -101,9 +261,25 @@ func (c *Context) IsTeamMember(team, user string) (bool, error) {
 	return false, nil
 }
 
-func (c *Context) IsOrgMember(org, user string) (bool, error) {
-	if c.OrgMembershipError != nil {
-		return false, c.OrgMembershipError
+func (c *Context) OrganizationMembership(ctx context.Context, org, user string) (*pull.OrgMembership, error) {
+	if err := c.err("OrganizationMembership", c.OrgMembershipError); err != nil {
+		return nil, err
+	}
+
+	m := &pull.OrgMembership{
+		Member:              contains(c.OrgMemberships[user], org),
+		OutsideCollaborator: contains(c.OutsideCollaborators[user], org),
+		Suspended:           contains(c.SuspendedUsers, user),
+	}
+	if m.Member {
+		m.Role = "member"
+	}
+	return m, nil
+}
+
+func (c *Context) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	if err := c.err("IsOrgMember", c.OrgMembershipError); err != nil {
+		return false, err
 	}
 
 	for _, o := range c.OrgMemberships[user] {
@@ -114,9 +290,9 @@ func (c *Context) IsOrgMember(org, user string) (bool, error) {
 	return false, nil
 }
 
-func (c *Context) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
-	if c.CollaboratorMembershipError != nil {
-		return false, c.CollaboratorMembershipError
+func (c *Context) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	if err := c.err("IsCollaborator", c.CollaboratorMembershipError); err != nil {
+		return false, err
 	}
 
 	for _, c := range c.CollaboratorMemberships[user] {
@@ -127,20 +303,129 @@ func (c *Context) IsCollaborator(org, repo, user, desiredPerm string) (bool, err
 	return false, nil
 }
 
-func (c *Context) Comments() ([]*pull.Comment, error) {
-	return c.CommentsValue, c.CommentsError
+func (c *Context) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	if err := c.err("TeamMembers", c.TeamMembershipError); err != nil {
+		return nil, err
+	}
+	return membersOf(c.TeamMemberships, team), nil
+}
+
+func (c *Context) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	if err := c.err("OrganizationMembers", c.OrgMembershipError); err != nil {
+		return nil, err
+	}
+	return membersOf(c.OrgMemberships, org), nil
+}
+
+func (c *Context) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	if err := c.err("RepositoryCollaborators", c.CollaboratorMembershipError); err != nil {
+		return nil, err
+	}
+	return membersOf(c.CollaboratorMemberships, desiredPerm), nil
 }
 
-func (c *Context) Reviews() ([]*pull.Review, error) {
-	return c.ReviewsValue, c.ReviewsError
+// membersOf returns the sorted users whose memberships include group.
+func membersOf(memberships map[string][]string, group string) []string {
+	var users []string
+	for user, groups := range memberships {
+		for _, g := range groups {
+			if g == group {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Context) Comments(ctx context.Context) ([]*pull.Comment, error) {
+	return c.CommentsValue, c.err("Comments", c.CommentsError)
+}
+
+func (c *Context) Reviews(ctx context.Context) ([]*pull.Review, error) {
+	return c.ReviewsValue, c.err("Reviews", c.ReviewsError)
+}
+
+func (c *Context) RequestedReviewers(ctx context.Context) (*pull.ReviewRequests, error) {
+	if err := c.err("RequestedReviewers", c.RequestedReviewersError); err != nil {
+		return nil, err
+	}
+	return &pull.ReviewRequests{Users: c.RequestedReviewersValue, Teams: c.RequestedTeamsValue}, nil
 }
 
-func (c *Context) Branches() (base string, head string, err error) {
-	return c.BranchBaseName, c.BranchHeadName, c.BranchesError
+func (c *Context) Branches(ctx context.Context) (base string, head string, err error) {
+	return c.BranchBaseName, c.BranchHeadName, c.err("Branches", c.BranchesError)
 }
 
-func (c *Context) TargetCommits() ([]*pull.Commit, error) {
-	return c.TargetCommitsValue, c.TargetCommitsError
+func (c *Context) BaseChangedAt(ctx context.Context) (time.Time, error) {
+	return c.BaseChangedAtValue, c.err("BaseChangedAt", c.BaseChangedAtError)
+}
+
+func (c *Context) ReviewThreads(ctx context.Context) ([]*pull.ReviewThread, error) {
+	return c.ReviewThreadsValue, c.err("ReviewThreads", c.ReviewThreadsError)
+}
+
+func (c *Context) TargetCommits(ctx context.Context) ([]*pull.Commit, error) {
+	return c.TargetCommitsValue, c.err("TargetCommits", c.TargetCommitsError)
+}
+
+func (c *Context) Timeline(ctx context.Context) ([]*pull.TimelineEvent, error) {
+	return c.TimelineValue, c.err("Timeline", c.TimelineError)
+}
+
+func (c *Context) BranchPullRequest(ctx context.Context, branch string) (*pull.PullRequestRef, error) {
+	return c.BranchPullRequestsValue[branch], c.err("BranchPullRequest", c.BranchPullRequestError)
+}
+
+func (c *Context) AuthorMergedPullRequests(ctx context.Context, since time.Time) (int, error) {
+	if err := c.err("AuthorMergedPullRequests", c.AuthorMergedPullRequestsError); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, t := range c.AuthorMergedAtValue {
+		if !t.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (c *Context) CommitChangedFiles(ctx context.Context, sha string) ([]*pull.File, error) {
+	return c.CommitChangedFilesValue[sha], c.err("CommitChangedFiles", c.CommitChangedFilesError)
+}
+
+func (c *Context) Blame(ctx context.Context, path string, lines []int) (map[int]*pull.BlameLine, error) {
+	if err := c.err("Blame", c.BlameError); err != nil {
+		return nil, err
+	}
+
+	blame := make(map[int]*pull.BlameLine)
+	for _, n := range lines {
+		if line, ok := c.BlameValue[path][n]; ok {
+			blame[n] = line
+		}
+	}
+	return blame, nil
+}
+
+func (c *Context) err(method string, err error) error {
+	if c.ErrorHook != nil {
+		if hookErr := c.ErrorHook(method); hookErr != nil {
+			return hookErr
+		}
+	}
+	return err
 }
 
 // assert that the test object implements the full interface
@@ -0,0 +1,389 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scheduler limits the events processed concurrently for each tenant
+// of a shared deployment and schedules queued events fairly across tenants,
+// so that a burst of events from one organization cannot delay evaluations
+// for every other organization.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultTenantConcurrency = 2
+	DefaultTenantQueueSize   = 100
+)
+
+type Config struct {
+	// Workers is the total number of events processed concurrently. If it is
+	// zero or negative, events are processed synchronously by the webhook
+	// handler and no limits apply.
+	Workers int `yaml:"workers"`
+
+	// Limits are the default limits applied to each tenant.
+	Limits Limits `yaml:",inline"`
+
+	// Tenants overrides the default limits for specific organizations or
+	// users, keyed by login.
+	Tenants map[string]Limits `yaml:"tenants"`
+}
+
+type Limits struct {
+	// Concurrency is the maximum number of events processed concurrently for
+	// a tenant. If unset, DefaultTenantConcurrency is used.
+	Concurrency int `yaml:"tenant_concurrency"`
+
+	// QueueSize is the maximum number of events waiting to be processed for a
+	// tenant. Events that arrive when the queue is full are rejected. If
+	// unset, DefaultTenantQueueSize is used.
+	QueueSize int `yaml:"tenant_queue_size"`
+}
+
+// IsEnabled returns true if events are processed asynchronously.
+func (c *Config) IsEnabled() bool {
+	return c.Workers > 0
+}
+
+func (c *Config) limitsFor(tenant string) Limits {
+	l := c.Limits
+	if override, ok := c.Tenants[tenant]; ok {
+		if override.Concurrency > 0 {
+			l.Concurrency = override.Concurrency
+		}
+		if override.QueueSize > 0 {
+			l.QueueSize = override.QueueSize
+		}
+	}
+	if l.Concurrency <= 0 {
+		l.Concurrency = DefaultTenantConcurrency
+	}
+	if l.QueueSize <= 0 {
+		l.QueueSize = DefaultTenantQueueSize
+	}
+	return l
+}
+
+// QueueFullError is returned when an event is rejected because the queue
+// for its tenant is full.
+type QueueFullError struct {
+	Tenant string
+	Size   int
+}
+
+func (err QueueFullError) Error() string {
+	return fmt.Sprintf("event queue for %s is full (%d events)", err.Tenant, err.Size)
+}
+
+type job struct {
+	ctx        context.Context
+	handler    githubapp.EventHandler
+	eventType  string
+	deliveryID string
+	payload    []byte
+}
+
+type tenant struct {
+	name   string
+	limits Limits
+	queue  []job
+	active int
+}
+
+// Scheduler runs event handlers on a fixed pool of workers. Tenants with
+// queued events are served in round-robin order, skipping tenants that have
+// reached their concurrency limit.
+type Scheduler struct {
+	config Config
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tenants map[string]*tenant
+	order   []string
+	next    int
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// New creates a Scheduler. Callers must invoke Start before events are
+// processed.
+func New(c Config) *Scheduler {
+	s := &Scheduler{
+		config:  c,
+		tenants: make(map[string]*tenant),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Start launches the configured number of workers.
+func (s *Scheduler) Start() {
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+}
+
+// Stop waits for running events to finish and discards queued events.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// PendingEvent is an event that was queued but not processed when the
+// scheduler shut down.
+type PendingEvent struct {
+	Type       string
+	DeliveryID string
+	Payload    []byte
+}
+
+// Shutdown stops accepting events and waits for running events to finish or
+// for the context to be done, whichever is first. It returns the queued
+// events that did not start, in the order they were queued for each tenant,
+// so that callers can process them later.
+func (s *Scheduler) Shutdown(ctx context.Context) ([]PendingEvent, error) {
+	s.mu.Lock()
+	s.stopped = true
+
+	var pending []PendingEvent
+	for _, name := range s.order {
+		t := s.tenants[name]
+		for _, j := range t.queue {
+			pending = append(pending, PendingEvent{
+				Type:       j.eventType,
+				DeliveryID: j.deliveryID,
+				Payload:    j.payload,
+			})
+		}
+		t.queue = nil
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return pending, nil
+	case <-ctx.Done():
+		return pending, errors.Wrap(ctx.Err(), "running events did not finish")
+	}
+}
+
+// Wrap returns an event handler that schedules events for h instead of
+// handling them immediately. The returned handler reports an error only if
+// the event could not be queued; errors from h are logged.
+func (s *Scheduler) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	return &scheduledHandler{scheduler: s, handler: h}
+}
+
+// Stats returns the number of queued and active events for each tenant with
+// pending work.
+func (s *Scheduler) Stats() map[string]TenantStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]TenantStats, len(s.tenants))
+	for name, t := range s.tenants {
+		stats[name] = TenantStats{Queued: len(t.queue), Active: t.active}
+	}
+	return stats
+}
+
+type TenantStats struct {
+	Queued int
+	Active int
+}
+
+func (s *Scheduler) enqueue(name string, j job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return errors.New("scheduler is stopped")
+	}
+
+	t, ok := s.tenants[name]
+	if !ok {
+		t = &tenant{name: name, limits: s.config.limitsFor(name)}
+		s.tenants[name] = t
+		s.order = append(s.order, name)
+	}
+
+	if len(t.queue) >= t.limits.QueueSize {
+		return QueueFullError{Tenant: name, Size: t.limits.QueueSize}
+	}
+
+	t.queue = append(t.queue, j)
+	s.cond.Signal()
+	return nil
+}
+
+// take blocks until a job is available for a tenant below its concurrency
+// limit and returns it. It returns false if the scheduler is stopped.
+func (s *Scheduler) take() (*tenant, job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.stopped {
+			return nil, job{}, false
+		}
+
+		for i := 0; i < len(s.order); i++ {
+			idx := (s.next + i) % len(s.order)
+			t := s.tenants[s.order[idx]]
+			if len(t.queue) == 0 || t.active >= t.limits.Concurrency {
+				continue
+			}
+
+			j := t.queue[0]
+			t.queue[0] = job{}
+			t.queue = t.queue[1:]
+			t.active++
+
+			s.next = idx + 1
+			return t, j, true
+		}
+
+		s.cond.Wait()
+	}
+}
+
+func (s *Scheduler) done(t *tenant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.active--
+	if t.active == 0 && len(t.queue) == 0 {
+		s.remove(t.name)
+	}
+	s.cond.Broadcast()
+}
+
+// remove deletes an idle tenant so that the round-robin order only contains
+// tenants with recent activity.
+func (s *Scheduler) remove(name string) {
+	delete(s.tenants, name)
+	for i, n := range s.order {
+		if n == name {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			if s.next > i {
+				s.next--
+			}
+			break
+		}
+	}
+	if len(s.order) > 0 {
+		s.next %= len(s.order)
+	} else {
+		s.next = 0
+	}
+}
+
+func (s *Scheduler) work() {
+	defer s.wg.Done()
+	for {
+		t, j, ok := s.take()
+		if !ok {
+			return
+		}
+		s.run(j)
+		s.done(t)
+	}
+}
+
+func (s *Scheduler) run(j job) {
+	logger := zerolog.Ctx(j.ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error().Msgf("Panic while handling %s event %s: %v", j.eventType, j.deliveryID, r)
+		}
+	}()
+
+	if err := j.handler.Handle(j.ctx, j.eventType, j.deliveryID, j.payload); err != nil {
+		logger.Error().Err(err).Msgf("Failed to handle %s event %s", j.eventType, j.deliveryID)
+	}
+}
+
+type scheduledHandler struct {
+	scheduler *Scheduler
+	handler   githubapp.EventHandler
+}
+
+func (h *scheduledHandler) Handles() []string {
+	return h.handler.Handles()
+}
+
+func (h *scheduledHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	name := TenantForEvent(payload)
+
+	// the request context is canceled when the webhook response is sent, so
+	// keep only the logger for the scheduled work
+	logger := zerolog.Ctx(ctx).With().Str("tenant", name).Logger()
+	jobCtx := logger.WithContext(context.Background())
+
+	err := h.scheduler.enqueue(name, job{
+		ctx:        jobCtx,
+		handler:    h.handler,
+		eventType:  eventType,
+		deliveryID: deliveryID,
+		payload:    payload,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to schedule %s event", eventType)
+	}
+
+	logger.Debug().Msgf("Scheduled %s event %s", eventType, deliveryID)
+	return nil
+}
+
+// TenantForEvent returns the tenant that owns an event payload. This is the
+// login of the repository owner, or the installation ID if the event does not
+// reference a repository.
+func TenantForEvent(payload []byte) string {
+	var event struct {
+		Repository struct {
+			Owner struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+	}
+	_ = json.Unmarshal(payload, &event)
+
+	if login := event.Repository.Owner.Login; login != "" {
+		return login
+	}
+	return fmt.Sprintf("installation:%d", event.Installation.ID)
+}
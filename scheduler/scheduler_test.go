@@ -0,0 +1,215 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingHandler struct {
+	mu      sync.Mutex
+	order   []string
+	active  map[string]int
+	maxSeen map[string]int
+	release chan struct{}
+	done    sync.WaitGroup
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		active:  make(map[string]int),
+		maxSeen: make(map[string]int),
+		release: make(chan struct{}),
+	}
+}
+
+func (h *blockingHandler) Handles() []string { return []string{"push"} }
+
+func (h *blockingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	defer h.done.Done()
+	tenant := TenantForEvent(payload)
+
+	h.mu.Lock()
+	h.order = append(h.order, deliveryID)
+	h.active[tenant]++
+	if h.active[tenant] > h.maxSeen[tenant] {
+		h.maxSeen[tenant] = h.active[tenant]
+	}
+	h.mu.Unlock()
+
+	<-h.release
+
+	h.mu.Lock()
+	h.active[tenant]--
+	h.mu.Unlock()
+	return nil
+}
+
+func payloadFor(owner string) []byte {
+	return []byte(fmt.Sprintf(`{"repository":{"owner":{"login":%q}},"installation":{"id":1}}`, owner))
+}
+
+func TestTenantForEvent(t *testing.T) {
+	assert.Equal(t, "palantir", TenantForEvent(payloadFor("palantir")))
+	assert.Equal(t, "installation:42", TenantForEvent([]byte(`{"installation":{"id":42}}`)))
+}
+
+func TestLimitsFor(t *testing.T) {
+	c := Config{
+		Limits: Limits{Concurrency: 4},
+		Tenants: map[string]Limits{
+			"monorepo-org": {Concurrency: 1, QueueSize: 1000},
+		},
+	}
+
+	assert.Equal(t, Limits{Concurrency: 4, QueueSize: DefaultTenantQueueSize}, c.limitsFor("other"))
+	assert.Equal(t, Limits{Concurrency: 1, QueueSize: 1000}, c.limitsFor("monorepo-org"))
+}
+
+func TestSchedulerQueueFull(t *testing.T) {
+	s := New(Config{
+		Workers: 1,
+		Limits:  Limits{Concurrency: 1, QueueSize: 2},
+	})
+
+	h := newBlockingHandler()
+	wrapped := s.Wrap(h)
+	ctx := context.Background()
+
+	require.NoError(t, wrapped.Handle(ctx, "push", "1", payloadFor("big")))
+	require.NoError(t, wrapped.Handle(ctx, "push", "2", payloadFor("big")))
+
+	err := wrapped.Handle(ctx, "push", "3", payloadFor("big"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "event queue for big is full")
+
+	require.NoError(t, wrapped.Handle(ctx, "push", "4", payloadFor("small")), "other tenants must not be affected")
+	assert.Equal(t, TenantStats{Queued: 2}, s.Stats()["big"])
+}
+
+func TestSchedulerFairness(t *testing.T) {
+	s := New(Config{
+		Workers: 1,
+		Limits:  Limits{Concurrency: 1},
+	})
+
+	h := newBlockingHandler()
+	wrapped := s.Wrap(h)
+	ctx := context.Background()
+
+	// a burst from one tenant is queued before a single event from another
+	h.done.Add(4)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, wrapped.Handle(ctx, "push", fmt.Sprintf("big-%d", i), payloadFor("big")))
+	}
+	require.NoError(t, wrapped.Handle(ctx, "push", "small-1", payloadFor("small")))
+
+	s.Start()
+	defer s.Stop()
+
+	close(h.release)
+	waitTimeout(t, &h.done)
+
+	assert.Equal(t, []string{"big-1", "small-1", "big-2", "big-3"}, h.order)
+}
+
+func TestSchedulerConcurrency(t *testing.T) {
+	s := New(Config{
+		Workers: 4,
+		Limits:  Limits{Concurrency: 2},
+	})
+	s.Start()
+	defer s.Stop()
+
+	h := newBlockingHandler()
+	wrapped := s.Wrap(h)
+	ctx := context.Background()
+
+	h.done.Add(6)
+	for i := 0; i < 6; i++ {
+		require.NoError(t, wrapped.Handle(ctx, "push", fmt.Sprintf("%d", i), payloadFor("big")))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(h.release)
+	waitTimeout(t, &h.done)
+
+	assert.Equal(t, 2, h.maxSeen["big"])
+}
+
+func TestSchedulerShutdown(t *testing.T) {
+	s := New(Config{
+		Workers: 1,
+		Limits:  Limits{Concurrency: 1},
+	})
+
+	h := newBlockingHandler()
+	wrapped := s.Wrap(h)
+	ctx := context.Background()
+
+	h.done.Add(1)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, wrapped.Handle(ctx, "push", fmt.Sprintf("big-%d", i), payloadFor("big")))
+	}
+	s.Start()
+
+	for start := time.Now(); s.Stats()["big"].Active == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out waiting for an event to start")
+		}
+	}
+
+	t.Run("deadline", func(t *testing.T) {
+		deadline, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		pending, err := s.Shutdown(deadline)
+		assert.Error(t, err, "shutdown did not wait for the running event")
+		require.Len(t, pending, 2)
+		assert.Equal(t, PendingEvent{Type: "push", DeliveryID: "big-2", Payload: payloadFor("big")}, pending[0])
+		assert.Equal(t, "big-3", pending[1].DeliveryID)
+	})
+
+	t.Run("drained", func(t *testing.T) {
+		assert.Error(t, wrapped.Handle(ctx, "push", "big-4", payloadFor("big")), "stopped scheduler accepted an event")
+
+		close(h.release)
+		pending, err := s.Shutdown(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+		assert.Equal(t, []string{"big-1"}, h.order)
+	})
+}
+
+func waitTimeout(t *testing.T, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events to be handled")
+	}
+}
@@ -19,23 +19,57 @@ import (
 	"github.com/palantir/go-baseapp/baseapp/datadog"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v2"
 
+	"github.com/palantir/policy-bot/attestation"
+	"github.com/palantir/policy-bot/auditlog"
+	"github.com/palantir/policy-bot/delivery"
+	"github.com/palantir/policy-bot/eventqueue"
+	"github.com/palantir/policy-bot/identity"
+	"github.com/palantir/policy-bot/jira"
+	"github.com/palantir/policy-bot/oncall"
+	"github.com/palantir/policy-bot/policysync"
+	"github.com/palantir/policy-bot/scheduler"
 	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/snapshot"
+	"github.com/palantir/policy-bot/store"
 )
 
 type Config struct {
-	Server   baseapp.HTTPConfig            `yaml:"server"`
-	Github   githubapp.Config              `yaml:"github"`
-	Logging  LoggingConfig                 `yaml:"logging"`
-	Sessions SessionsConfig                `yaml:"sessions"`
-	Options  handler.PullEvaluationOptions `yaml:"options"`
-	Files    handler.FilesConfig           `yaml:"files"`
-	Datadog  datadog.Config                `yaml:"datadog"`
+	Server      baseapp.HTTPConfig            `yaml:"server"`
+	Github      githubapp.Config              `yaml:"github"`
+	Logging     LoggingConfig                 `yaml:"logging"`
+	Sessions    SessionsConfig                `yaml:"sessions"`
+	Options     handler.PullEvaluationOptions `yaml:"options"`
+	Files       handler.FilesConfig           `yaml:"files"`
+	Datadog     datadog.Config                `yaml:"datadog"`
+	OnCall      oncall.Config                 `yaml:"on_call"`
+	Jira        jira.Config                   `yaml:"jira"`
+	Identity    identity.Config               `yaml:"identity"`
+	Store       store.Config                  `yaml:"store"`
+	Scheduler   scheduler.Config              `yaml:"scheduler"`
+	Attestation attestation.Config            `yaml:"attestation"`
+	AuditLog    auditlog.Config               `yaml:"audit_log"`
+	Queue       eventqueue.Config             `yaml:"queue"`
+	PolicySync  policysync.Config             `yaml:"policy_sync"`
+	Admin       handler.AdminConfig           `yaml:"admin"`
+	Deliveries  delivery.Config               `yaml:"deliveries"`
+	SSO         handler.SSOConfig             `yaml:"sso"`
+	Shutdown    ShutdownConfig                `yaml:"shutdown"`
+	RuleCache   handler.RuleCacheConfig       `yaml:"rule_cache"`
+	Snapshots   snapshot.Config               `yaml:"snapshots"`
 }
 
 type LoggingConfig struct {
 	Text bool `yaml:"text" json:"text"`
+
+	// Level is the minimum level of logged messages. The default is "debug".
+	Level string `yaml:"level" json:"level"`
+
+	// Debug allows administrators to enable debug logging for individual
+	// repositories and pull requests when Level is higher than "debug".
+	Debug handler.DebugConfig `yaml:"debug" json:"debug"`
 }
 
 type SessionsConfig struct {
@@ -52,5 +86,43 @@ func ParseConfig(bytes []byte) (*Config, error) {
 
 	c.Options.FillDefaults()
 
+	if c.Logging.Level != "" {
+		if _, err := zerolog.ParseLevel(c.Logging.Level); err != nil {
+			return nil, errors.Wrap(err, "invalid logging level")
+		}
+	}
+
+	if err := c.Options.Repositories.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid repository filter")
+	}
+
+	if err := c.Options.ApprovalAcknowledgment.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid approval acknowledgment")
+	}
+
+	if err := c.Options.PushProtection.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid push protection")
+	}
+
+	if err := c.SSO.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid sso configuration")
+	}
+
+	if err := c.OnCall.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid on-call configuration")
+	}
+
+	if err := c.Identity.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid identity configuration")
+	}
+
+	if err := c.Jira.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid jira configuration")
+	}
+
+	if err := c.Queue.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid queue configuration")
+	}
+
 	return &c, nil
 }
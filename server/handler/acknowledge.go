@@ -0,0 +1,187 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/shurcooL/githubv4"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	approvalAckKeyPrefix = "approval-ack/"
+
+	// approvalAckTTL is how long policy-bot remembers that it acknowledged
+	// an approval.
+	approvalAckTTL = 90 * 24 * time.Hour
+)
+
+// reactions maps the reaction names used by the GitHub REST API to the
+// values used by the GraphQL API.
+var reactions = map[string]githubv4.ReactionContent{
+	"+1":       githubv4.ReactionContentThumbsUp,
+	"-1":       githubv4.ReactionContentThumbsDown,
+	"laugh":    githubv4.ReactionContentLaugh,
+	"confused": githubv4.ReactionContentConfused,
+	"heart":    githubv4.ReactionContentHeart,
+	"hooray":   githubv4.ReactionContentHooray,
+	"rocket":   githubv4.ReactionContent("ROCKET"),
+	"eyes":     githubv4.ReactionContent("EYES"),
+}
+
+// AcknowledgmentConfig configures feedback on comments and reviews that
+// count as approvals. Each comment or review is acknowledged once, the first
+// time it counts toward a rule. Acknowledgments are tracked in the store.
+type AcknowledgmentConfig struct {
+	// Reaction is the reaction to add to approving comments and reviews,
+	// using the names from the GitHub API, like "rocket" or "+1". If empty,
+	// policy-bot does not react.
+	Reaction string `yaml:"reaction"`
+
+	// Reply posts a comment mentioning the approver that lists the rules
+	// their approval counted toward.
+	Reply bool `yaml:"reply"`
+}
+
+func (c AcknowledgmentConfig) IsEnabled() bool {
+	return c.Reaction != "" || c.Reply
+}
+
+func (c AcknowledgmentConfig) Validate() error {
+	if c.Reaction != "" {
+		if _, ok := reactions[c.Reaction]; !ok {
+			return errors.Errorf("unknown reaction %q", c.Reaction)
+		}
+	}
+	return nil
+}
+
+// acknowledgedApproval is a comment or review that counted as an approval
+// and the rules it counted toward.
+type acknowledgedApproval struct {
+	ID    string
+	User  string
+	Rules []string
+}
+
+// acknowledgeApprovals reacts to or replies to the comments and reviews that
+// counted as approvals in the result and were not acknowledged before.
+// Failures are logged but do not affect the evaluation.
+func (b *Base) acknowledgeApprovals(ctx context.Context, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest, result *common.Result) {
+	logger := zerolog.Ctx(ctx)
+	opts := b.PullOpts().ApprovalAcknowledgment
+
+	if b.Store == nil {
+		return
+	}
+
+	for _, a := range collectApprovals(result) {
+		key := approvalAckKeyPrefix + a.ID
+		if _, ok, err := b.Store.Get(ctx, key); err != nil || ok {
+			if err != nil {
+				logger.Warn().Err(err).Msgf("Failed to check acknowledgment of approval by %s", a.User)
+			}
+			continue
+		}
+
+		if opts.Reaction != "" {
+			if err := addReaction(ctx, v4client, a.ID, reactions[opts.Reaction]); err != nil {
+				logger.Warn().Err(err).Msgf("Failed to react to approval by %s", a.User)
+				continue
+			}
+		}
+
+		if opts.Reply {
+			owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+			repo := pr.GetBase().GetRepo().GetName()
+			comment := &github.IssueComment{Body: github.String(formatAcknowledgment(a))}
+			if _, _, err := client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), comment); err != nil {
+				logger.Warn().Err(err).Msgf("Failed to reply to approval by %s", a.User)
+				continue
+			}
+		}
+
+		if err := b.Store.Put(ctx, key, []byte(a.User), approvalAckTTL); err != nil {
+			logger.Warn().Err(err).Msgf("Failed to record acknowledgment of approval by %s", a.User)
+		}
+	}
+}
+
+// collectApprovals returns the comments and reviews that counted as
+// approvals for any rule in the result, ordered by ID.
+func collectApprovals(result *common.Result) []*acknowledgedApproval {
+	byID := make(map[string]*acknowledgedApproval)
+
+	var collect func(*common.Result)
+	collect = func(r *common.Result) {
+		for _, u := range r.Approvers {
+			id, ok := r.ApprovalIDs[u]
+			if !ok {
+				continue
+			}
+			a, ok := byID[id]
+			if !ok {
+				a = &acknowledgedApproval{ID: id, User: u}
+				byID[id] = a
+			}
+			a.Rules = append(a.Rules, r.Name)
+		}
+		for _, c := range r.Children {
+			collect(c)
+		}
+	}
+	collect(result)
+
+	approvals := make([]*acknowledgedApproval, 0, len(byID))
+	for _, a := range byID {
+		approvals = append(approvals, a)
+	}
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].ID < approvals[j].ID })
+	return approvals
+}
+
+func formatAcknowledgment(a *acknowledgedApproval) string {
+	rules := make([]string, len(a.Rules))
+	for i, r := range a.Rules {
+		rules[i] = fmt.Sprintf("`%s`", r)
+	}
+	return fmt.Sprintf("@%s your approval counts toward %s.", a.User, strings.Join(rules, ", "))
+}
+
+func addReaction(ctx context.Context, v4client *githubv4.Client, id string, content githubv4.ReactionContent) error {
+	var m struct {
+		AddReaction struct {
+			Reaction struct {
+				Content githubv4.ReactionContent
+			}
+		} `graphql:"addReaction(input: $input)"`
+	}
+	input := githubv4.AddReactionInput{
+		SubjectID: githubv4.ID(id),
+		Content:   content,
+	}
+	return retryMutation(ctx, func() error {
+		return v4client.Mutate(ctx, &m, input, nil)
+	})
+}
@@ -0,0 +1,496 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/bluekeyes/templatetree"
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/delivery"
+	"github.com/palantir/policy-bot/policy/predicate"
+)
+
+const (
+	adminFlagsKey = "admin/flags"
+
+	redacted = "REDACTED"
+
+	tokenExpirationHeader = "GitHub-Authentication-Token-Expiration"
+	tokenExpirationFormat = "2006-01-02 15:04:05 MST"
+)
+
+// AdminConfig configures the admin page, where administrators can view the
+// effective server configuration, change runtime flags, flush caches, and
+// check the GitHub rate limits of each installation.
+type AdminConfig struct {
+	// Users are the GitHub users who may use the admin page and API. Users
+	// who log in with single sign-on are administrators only through the
+	// admin groups of the single sign-on configuration.
+	Users []string `yaml:"users"`
+}
+
+func (c *AdminConfig) IsAdmin(user string) bool {
+	if c == nil {
+		return false
+	}
+	for _, admin := range c.Users {
+		if strings.EqualFold(admin, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuntimeFlags are settings that administrators change from the admin page
+// without restarting the server. They are saved in the store, so they only
+// apply to all servers if the servers share a store.
+type RuntimeFlags struct {
+	// ShadowMode evaluates pull requests and logs the results without
+	// posting statuses or check runs.
+	ShadowMode bool `json:"shadow_mode"`
+
+	// MuteNotifications stops approval acknowledgments and disapproval
+	// escalations. Escalations resume when notifications are unmuted.
+	MuteNotifications bool `json:"mute_notifications"`
+}
+
+// runtimeFlags returns the current runtime flags. If the flags cannot be
+// read, it returns the defaults.
+func (b *Base) runtimeFlags(ctx context.Context) RuntimeFlags {
+	var flags RuntimeFlags
+	if b.Store == nil {
+		return flags
+	}
+
+	value, ok, err := b.Store.Get(ctx, adminFlagsKey)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to read runtime flags")
+		return flags
+	}
+	if ok {
+		if err := json.Unmarshal(value, &flags); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Ignoring invalid runtime flags")
+			return RuntimeFlags{}
+		}
+	}
+	return flags
+}
+
+func (b *Base) putRuntimeFlags(ctx context.Context, flags RuntimeFlags) error {
+	if b.Store == nil {
+		return errors.New("runtime flags require a store")
+	}
+
+	value, err := json.Marshal(flags)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode runtime flags")
+	}
+	return b.Store.Put(ctx, adminFlagsKey, value, 0)
+}
+
+// AdminStatus is the state shown on the admin page and returned by the admin
+// API.
+type AdminStatus struct {
+	// Options is the effective pull request evaluation configuration in
+	// YAML, with secrets redacted.
+	Options string `json:"options"`
+
+	// Integrations lists the optional integrations that are enabled.
+	Integrations []string `json:"integrations"`
+
+	Flags      RuntimeFlags             `json:"flags"`
+	RateLimits []*InstallationRateLimit `json:"rate_limits"`
+}
+
+// InstallationRateLimit is the core GitHub API rate limit of an installation.
+type InstallationRateLimit struct {
+	Owner          string    `json:"owner"`
+	InstallationID int64     `json:"installation_id"`
+	Limit          int       `json:"limit"`
+	Remaining      int       `json:"remaining"`
+	Reset          time.Time `json:"reset"`
+	Error          string    `json:"error,omitempty"`
+
+	// TokenExpiresAt is when the current installation token expires, as
+	// reported by GitHub. It is nil if GitHub did not report an expiration.
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+}
+
+func (b *Base) adminStatus(ctx context.Context) (*AdminStatus, error) {
+	opts := *b.PullOpts()
+	if opts.DisapprovalEscalation.SlackWebhookURL != "" {
+		opts.DisapprovalEscalation.SlackWebhookURL = redacted
+	}
+	if opts.Override.SlackWebhookURL != "" {
+		opts.Override.SlackWebhookURL = redacted
+	}
+	if opts.PushProtection.SlackWebhookURL != "" {
+		opts.PushProtection.SlackWebhookURL = redacted
+	}
+	if opts.Dispatch.Secret != "" {
+		opts.Dispatch.Secret = redacted
+	}
+	if opts.SlackApprovals.BotToken != "" {
+		opts.SlackApprovals.BotToken = redacted
+	}
+	if opts.SlackApprovals.SigningSecret != "" {
+		opts.SlackApprovals.SigningSecret = redacted
+	}
+	options, err := yaml.Marshal(&opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode configuration")
+	}
+
+	status := &AdminStatus{
+		Options:      string(options),
+		Integrations: []string{},
+		Flags:        b.runtimeFlags(ctx),
+	}
+
+	for name, enabled := range map[string]bool{
+		"attestation":      b.Attestor != nil,
+		"audit_log":        b.AuditLog != nil,
+		"central_policies": b.ConfigFetcher.Central != nil,
+		"deliveries":       b.Deliveries != nil,
+		"identity":         b.Identity != nil,
+		"jira":             b.Jira != nil,
+		"on_call":          b.OnCall != nil,
+	} {
+		if enabled {
+			status.Integrations = append(status.Integrations, name)
+		}
+	}
+	sort.Strings(status.Integrations)
+
+	if status.RateLimits, err = b.rateLimits(ctx); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// rateLimits returns the rate limit of each installation, ordered by owner.
+// Checking rate limits does not count against them.
+func (b *Base) rateLimits(ctx context.Context) ([]*InstallationRateLimit, error) {
+	installations, err := b.Installations.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list installations")
+	}
+	sort.Slice(installations, func(i, j int) bool { return installations[i].Owner < installations[j].Owner })
+
+	limits := make([]*InstallationRateLimit, 0, len(installations))
+	for _, inst := range installations {
+		limit := &InstallationRateLimit{Owner: inst.Owner, InstallationID: inst.ID}
+		limits = append(limits, limit)
+
+		client, err := b.NewInstallationClient(inst.ID)
+		if err != nil {
+			limit.Error = errors.Wrap(err, "failed to create github client").Error()
+			continue
+		}
+
+		res, resp, err := client.RateLimits(ctx)
+		if err != nil {
+			limit.Error = errors.Wrap(err, "failed to get rate limits").Error()
+			continue
+		}
+		if core := res.GetCore(); core != nil {
+			limit.Limit = core.Limit
+			limit.Remaining = core.Remaining
+			limit.Reset = core.Reset.Time
+		}
+		limit.TokenExpiresAt = tokenExpiration(resp)
+	}
+	return limits, nil
+}
+
+// tokenExpiration returns the expiration of the token used for a request,
+// which GitHub reports in a response header, or nil if it is not known.
+func tokenExpiration(resp *github.Response) *time.Time {
+	if resp == nil {
+		return nil
+	}
+	value := resp.Header.Get(tokenExpirationHeader)
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(tokenExpirationFormat, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// FlushCaches discards cached on-call, identity, audit log, external check,
+// and rule data and fetches central policies again.
+func (b *Base) FlushCaches(ctx context.Context) error {
+	if f, ok := b.OnCall.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+	if f, ok := b.Identity.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+	if b.AuditLog != nil {
+		b.AuditLog.Flush()
+	}
+	if b.RuleCache != nil {
+		b.RuleCache.Flush()
+	}
+	predicate.FlushExternalChecks()
+
+	if b.ConfigFetcher.Central != nil {
+		if err := b.ConfigFetcher.Central.Sync(ctx); err != nil {
+			return errors.WithMessage(err, "failed to sync central policies")
+		}
+	}
+	return nil
+}
+
+// adminUser returns the logged in user if the user is an administrator. If
+// not, it writes an error response and returns an empty user. Users who
+// logged in with single sign-on are administrators if they are in an admin
+// group; other users are administrators if their GitHub login is listed in
+// the admin configuration.
+func (b *Base) adminUser(w http.ResponseWriter, r *http.Request, sess *scs.Session) (string, error) {
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read sessions")
+	}
+	sso, err := requestSSO(r, sess)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read sessions")
+	}
+
+	admin := b.Admin.IsAdmin(user)
+	if sso {
+		admin = b.SSO.IsAdmin(requestGroups(r))
+	}
+	if !admin {
+		http.Error(w, "you do not have permission to administer the server", http.StatusForbidden)
+		return "", nil
+	}
+	return user, nil
+}
+
+// dashboardUser returns the logged in user if the user may use read-only
+// views that cover all repositories, either as an administrator or as a
+// member of a dashboard group. If not, it writes an error response and
+// returns an empty user.
+func (b *Base) dashboardUser(w http.ResponseWriter, r *http.Request, sess *scs.Session) (string, error) {
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read sessions")
+	}
+	sso, err := requestSSO(r, sess)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read sessions")
+	}
+
+	allowed := b.Admin.IsAdmin(user)
+	if sso {
+		allowed = b.SSO.CanViewDashboards(requestGroups(r))
+	}
+	if !allowed {
+		http.Error(w, "you do not have permission to view this page", http.StatusForbidden)
+		return "", nil
+	}
+	return user, nil
+}
+
+// Admin renders the admin page.
+type Admin struct {
+	Base
+	Sessions  *scs.Manager
+	Templates templatetree.HTMLTree
+}
+
+func (h *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	sess := h.Sessions.Load(r)
+	user, err := h.adminUser(w, r, sess)
+	if err != nil || user == "" {
+		return err
+	}
+
+	token, err := csrfToken(w, sess)
+	if err != nil {
+		return err
+	}
+
+	status, err := h.adminStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		*AdminStatus
+		User       string
+		CSRFToken  string
+		Deliveries bool
+	}{
+		AdminStatus: status,
+		User:        user,
+		CSRFToken:   token,
+		Deliveries:  h.Deliveries != nil,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	return h.Templates.ExecuteTemplate(w, "admin.html.tmpl", data)
+}
+
+// AdminAPI returns the AdminStatus as JSON.
+type AdminAPI struct {
+	Base
+	Sessions *scs.Manager
+}
+
+func (h *AdminAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.adminUser(w, r, h.Sessions.Load(r))
+	if err != nil || user == "" {
+		return err
+	}
+
+	status, err := h.adminStatus(r.Context())
+	if err != nil {
+		return err
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, status)
+	return nil
+}
+
+// GitHubStatus returns the rate limit and token expiration of each
+// installation as JSON, so that dashboards can monitor API usage. It is
+// available to administrators and members of single sign-on dashboard groups.
+type GitHubStatus struct {
+	Base
+	Sessions *scs.Manager
+}
+
+type GitHubStatusReport struct {
+	Installations []*InstallationRateLimit `json:"installations"`
+}
+
+func (h *GitHubStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.dashboardUser(w, r, h.Sessions.Load(r))
+	if err != nil || user == "" {
+		return err
+	}
+
+	limits, err := h.rateLimits(r.Context())
+	if err != nil {
+		return err
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &GitHubStatusReport{Installations: limits})
+	return nil
+}
+
+// AdminAction changes the runtime flags, flushes caches, reloads the server
+// configuration, or replays a webhook delivery on behalf of an administrator.
+// The "action" form value is "flags", "flush", "reload", or "replay".
+type AdminAction struct {
+	Base
+	Sessions *scs.Manager
+
+	// Reload reads the server configuration again and applies it. If nil,
+	// the configuration cannot be reloaded.
+	Reload func(ctx context.Context) error
+}
+
+func (h *AdminAction) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	sess := h.Sessions.Load(r)
+	user, err := h.adminUser(w, r, sess)
+	if err != nil || user == "" {
+		return err
+	}
+
+	token, err := sess.GetString(SessionKeyCSRFToken)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(r.PostFormValue("csrf_token"))) != 1 {
+		http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+		return nil
+	}
+
+	logger := zerolog.Ctx(ctx)
+	switch action := r.PostFormValue("action"); action {
+	case "flags":
+		flags := RuntimeFlags{
+			ShadowMode:        r.PostFormValue("shadow_mode") == "true",
+			MuteNotifications: r.PostFormValue("mute_notifications") == "true",
+		}
+		if err := h.putRuntimeFlags(ctx, flags); err != nil {
+			return err
+		}
+		logger.Info().Msgf("User %s set runtime flags to %+v", user, flags)
+
+	case "flush":
+		if err := h.FlushCaches(ctx); err != nil {
+			return err
+		}
+		logger.Info().Msgf("User %s flushed caches", user)
+
+	case "reload":
+		if h.Reload == nil {
+			http.Error(w, "the server configuration cannot be reloaded", http.StatusBadRequest)
+			return nil
+		}
+		if err := h.Reload(ctx); err != nil {
+			return err
+		}
+		logger.Info().Msgf("User %s reloaded the server configuration", user)
+
+	case "replay":
+		if h.Deliveries == nil {
+			http.Error(w, "delivery recording is not enabled", http.StatusBadRequest)
+			return nil
+		}
+		id := strings.TrimSpace(r.PostFormValue("delivery_id"))
+		if err := h.Deliveries.Replay(ctx, id); err != nil {
+			if errors.Cause(err) == delivery.ErrUnknownDelivery {
+				http.Error(w, fmt.Sprintf("delivery %q was not recorded with its payload", id), http.StatusNotFound)
+				return nil
+			}
+			return err
+		}
+		logger.Info().Msgf("User %s replayed delivery %s", user, id)
+
+	default:
+		http.Error(w, fmt.Sprintf("invalid action %q", action), http.StatusBadRequest)
+		return nil
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	return nil
+}
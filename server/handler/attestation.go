@@ -0,0 +1,165 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/shurcooL/githubv4"
+
+	"github.com/palantir/policy-bot/attestation"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Attestor publishes signed attestations for merged pull requests that
+// satisfied their policy.
+type Attestor struct {
+	Signer     *attestation.Signer
+	CheckRun   bool
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// AttestationCheckName returns the name of the check run that contains the
+// attestation for a merge commit.
+func (b *Base) AttestationCheckName() string {
+	return fmt.Sprintf("%s: attestation", b.PullOpts().StatusCheckContext)
+}
+
+// attestMerge evaluates the policy for a merged pull request as of its merge
+// and, if the pull request was approved, publishes a signed attestation for
+// the merge commit. The policy comes from the base branch just before the
+// merge, so changes to the policy made by the pull request do not apply to
+// its own attestation.
+func (b *Base) attestMerge(ctx context.Context, installationID int64, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest) error {
+	logger := zerolog.Ctx(ctx)
+
+	if !pr.GetMerged() || pr.GetMergeCommitSHA() == "" {
+		return nil
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, pr.GetBase().GetRepo().GetOwner().GetLogin(), b.Installations, b.ClientCreator)
+	loaded := &loadedPullRequest{
+		InstallationID: installationID,
+		Client:         client,
+		V4Client:       v4client,
+		PullRequest:    pr,
+		PullContext:    pull.NewGitHubContextAt(mbrCtx, client, v4client, pr, pr.GetMergedAt()),
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	result, config, err := b.evaluatePullRequest(ctx, loaded)
+	if err != nil {
+		logger.Info().Err(err).Msg("Skipping attestation for pull request without a valid policy")
+		return nil
+	}
+	if result.Error != nil {
+		return errors.WithMessage(result.Error, "failed to evaluate policy for attestation")
+	}
+	if result.Status != common.StatusApproved {
+		logger.Warn().Str(LogKeyAudit, "attestation").Msgf("Pull request merged with policy status %s; no attestation created", result.Status)
+		return nil
+	}
+
+	stmt := attestation.NewStatement(owner+"/"+repo, attestation.Review{
+		PullRequest:    fmt.Sprintf("%s/%s#%d", owner, repo, pr.GetNumber()),
+		URL:            pr.GetHTMLURL(),
+		BaseRef:        pr.GetBase().GetRef(),
+		HeadSHA:        pr.GetHead().GetSHA(),
+		MergeCommitSHA: pr.GetMergeCommitSHA(),
+		MergedAt:       pr.GetMergedAt(),
+		PolicyPath:     config.Path,
+		PolicyRef:      config.Ref,
+		PolicyVersion:  config.Version,
+		EvaluatedAt:    time.Now().UTC(),
+		Result:         attestation.NewResult(result),
+	})
+
+	env, err := b.Attestor.Signer.Sign(stmt)
+	if err != nil {
+		return err
+	}
+
+	envBytes, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal attestation")
+	}
+
+	logger.Info().Msgf("Publishing attestation for merge commit %s", pr.GetMergeCommitSHA())
+
+	if b.Attestor.CheckRun {
+		if err := b.postAttestationCheck(ctx, client, owner, repo, pr.GetMergeCommitSHA(), stmt, envBytes); err != nil {
+			return err
+		}
+	}
+	if b.Attestor.Endpoint != "" {
+		if err := b.postAttestationEndpoint(ctx, envBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Base) postAttestationCheck(ctx context.Context, client *github.Client, owner, repo, sha string, stmt *attestation.Statement, envBytes []byte) error {
+	title := fmt.Sprintf("Approved by %d reviewer(s)", len(stmt.Predicate.Approvers))
+	summary := fmt.Sprintf("Signed attestation for %s. Approvers: %v", stmt.Predicate.PullRequest, stmt.Predicate.Approvers)
+	text := fmt.Sprintf("```json\n%s\n```\n", envBytes)
+
+	completedAt := github.Timestamp{Time: time.Now()}
+	_, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:        b.AttestationCheckName(),
+		HeadSHA:     sha,
+		Status:      github.String("completed"),
+		Conclusion:  github.String("success"),
+		CompletedAt: &completedAt,
+		Output: &github.CheckRunOutput{
+			Title:   &title,
+			Summary: &summary,
+			Text:    &text,
+		},
+	})
+	return errors.Wrap(err, "failed to create attestation check")
+}
+
+func (b *Base) postAttestationEndpoint(ctx context.Context, envBytes []byte) error {
+	req, err := http.NewRequest(http.MethodPost, b.Attestor.Endpoint, bytes.NewReader(envBytes))
+	if err != nil {
+		return errors.Wrap(err, "failed to create attestation request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.Attestor.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to publish attestation")
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("attestation endpoint returned status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -14,6 +14,88 @@
 
 package handler
 
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+)
+
 const (
 	LogKeyAudit string = "audit"
 )
+
+// Audit evaluates a pull request and returns the result as JSON. Merged pull
+// requests are evaluated as of their merge commit, so this can be used to
+// check the historical compliance of changes.
+type Audit struct {
+	Base
+	Sessions *scs.Manager
+}
+
+type AuditReport struct {
+	PullRequest    string      `json:"pull_request"`
+	State          string      `json:"state"`
+	Merged         bool        `json:"merged"`
+	MergedAt       *time.Time  `json:"merged_at,omitempty"`
+	MergeCommitSHA string      `json:"merge_commit_sha,omitempty"`
+	PolicyRef      string      `json:"policy_ref"`
+	PolicyVersion  string      `json:"policy_version,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	Result         *ResultJSON `json:"result,omitempty"`
+}
+
+func (h *Audit) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	number, err := strconv.Atoi(pat.Param(r, "number"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
+		return nil
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	loaded, err := h.loadPullRequest(ctx, owner, repo, number, user)
+	if err != nil {
+		if isNotFoundError(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil
+		}
+		return err
+	}
+
+	pr := loaded.PullRequest
+	report := AuditReport{
+		PullRequest: fmt.Sprintf("%s/%s#%d", owner, repo, number),
+		State:       pr.GetState(),
+		Merged:      pr.GetMerged(),
+	}
+	if pr.GetMerged() {
+		report.MergedAt = pr.MergedAt
+		report.MergeCommitSHA = pr.GetMergeCommitSHA()
+	}
+
+	result, config, err := h.evaluatePullRequest(ctx, loaded)
+	report.PolicyRef = config.Ref
+	report.PolicyVersion = config.Version
+	report.Result = NewResultJSON(result)
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &report)
+	return nil
+}
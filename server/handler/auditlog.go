@@ -0,0 +1,82 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/auditlog"
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// checkApprovalIntegrity adds warnings to the rule results whose approvers
+// are flagged by the audit log. Failures to search the audit log are logged
+// and do not affect the result.
+func (b *Base) checkApprovalIntegrity(ctx context.Context, client *github.Client, owner, repo string, result *common.Result) {
+	if b.AuditLog == nil {
+		return
+	}
+
+	var rules []*common.Result
+	collectApprovedRules(result, &rules)
+
+	users := make(map[string]bool)
+	var approvers []string
+	for _, r := range rules {
+		for _, u := range r.Approvers {
+			if !users[u] {
+				users[u] = true
+				approvers = append(approvers, u)
+			}
+		}
+	}
+	if len(approvers) == 0 {
+		return
+	}
+
+	findings, err := b.AuditLog.Check(ctx, &auditlog.GitHubSource{Client: client}, owner, repo, approvers)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to check approvals against the audit log")
+		return
+	}
+
+	for _, r := range rules {
+		isApprover := make(map[string]bool, len(r.Approvers))
+		for _, u := range r.Approvers {
+			isApprover[u] = true
+		}
+		for _, f := range findings {
+			if isApprover[f.User] {
+				r.Warnings = append(r.Warnings, f.Message)
+			}
+		}
+	}
+
+	if len(findings) > 0 {
+		zerolog.Ctx(ctx).Info().Msgf("Found %d suspicious approval(s) in the audit log", len(findings))
+	}
+}
+
+func collectApprovedRules(r *common.Result, rules *[]*common.Result) {
+	if len(r.Approvers) > 0 {
+		*rules = append(*rules, r)
+	}
+	for _, c := range r.Children {
+		collectApprovedRules(c, rules)
+	}
+}
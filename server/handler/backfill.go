@@ -0,0 +1,216 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultBackfillInterval     = 2 * time.Second
+	DefaultBackfillMinRateLimit = 1000
+)
+
+// BackfillConfig configures the evaluation of existing open pull requests
+// when the app is installed on an organization or repository, so that they
+// get a status without waiting for their next event.
+type BackfillConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is the delay between evaluations, to spread the API requests
+	// of a large backfill over time. If unset, DefaultBackfillInterval is
+	// used.
+	Interval time.Duration `yaml:"interval"`
+
+	// MinRateLimit is the number of remaining core API requests to keep in
+	// reserve for regular events. If the installation has fewer requests
+	// remaining, the backfill pauses until the rate limit resets. If unset,
+	// DefaultBackfillMinRateLimit is used.
+	MinRateLimit int `yaml:"min_rate_limit"`
+}
+
+type Installation struct {
+	Base
+}
+
+func (h *Installation) Handles() []string {
+	return []string{"installation", "installation_repositories"}
+}
+
+// Handle installation and installation_repositories
+// https://developer.github.com/v3/activity/events/types/#installationevent
+// https://developer.github.com/v3/activity/events/types/#installationrepositoriesevent
+func (h *Installation) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if !h.PullOpts().Backfill.Enabled {
+		return nil
+	}
+
+	var installationID int64
+	var repos []*github.Repository
+
+	switch eventType {
+	case "installation":
+		var event github.InstallationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse installation event payload")
+		}
+		if event.GetAction() != "created" {
+			return nil
+		}
+		installationID = event.GetInstallation().GetID()
+		repos = event.Repositories
+
+	case "installation_repositories":
+		var event github.InstallationRepositoriesEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse installation repositories event payload")
+		}
+		if event.GetAction() != "added" {
+			return nil
+		}
+		installationID = event.GetInstallation().GetID()
+		repos = event.RepositoriesAdded
+	}
+
+	if len(repos) == 0 {
+		return nil
+	}
+	owner := repos[0].GetOwner().GetLogin()
+
+	logger := zerolog.Ctx(ctx).With().Int64(githubapp.LogKeyInstallationID, installationID).Logger()
+	logger.Info().Msgf("Starting backfill of %d repositories", len(repos))
+
+	// the backfill outlives the webhook request, so it must not use its context
+	go h.backfill(logger.WithContext(context.Background()), installationID, owner, repos)
+
+	return nil
+}
+
+// backfill evaluates the open pull requests of the repositories one at a
+// time, pausing between pull requests and when the installation is close to
+// its rate limit. Failures are logged and do not stop the backfill.
+func (h *Installation) backfill(ctx context.Context, installationID int64, owner string, repos []*github.Repository) {
+	logger := zerolog.Ctx(ctx)
+	config := h.PullOpts().Backfill
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultBackfillInterval
+	}
+	minRate := config.MinRateLimit
+	if minRate <= 0 {
+		minRate = DefaultBackfillMinRateLimit
+	}
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create client for backfill")
+		return
+	}
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create client for backfill")
+		return
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, h.Installations, h.ClientCreator)
+
+	var evaluated int
+	for _, repo := range repos {
+		if repo.GetArchived() {
+			continue
+		}
+
+		prs, err := listOpenPullRequests(ctx, client, repo.GetOwner().GetLogin(), repo.GetName())
+		if err != nil {
+			logger.Error().Err(err).Str(githubapp.LogKeyRepositoryName, repo.GetName()).Msg("Failed to list pull requests for backfill")
+			continue
+		}
+
+		for _, pr := range prs {
+			if err := waitForRateLimit(ctx, client, minRate); err != nil {
+				logger.Error().Err(err).Msg("Stopping backfill")
+				return
+			}
+
+			prCtx, prLogger := h.preparePRContext(ctx, installationID, pr.GetBase().GetRepo(), pr.GetNumber())
+			if err := h.Evaluate(prCtx, mbrCtx, client, v4client, pr); err != nil {
+				prLogger.Error().Err(err).Msg("Failed to evaluate pull request during backfill")
+			} else {
+				evaluated++
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	logger.Info().Msgf("Finished backfill, evaluated %d pull requests", evaluated)
+}
+
+func listOpenPullRequests(ctx context.Context, client *github.Client, owner, repo string) ([]*github.PullRequest, error) {
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var all []*github.PullRequest
+	for {
+		prs, res, err := client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list pull requests for %s/%s", owner, repo)
+		}
+		all = append(all, prs...)
+		if res.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+// waitForRateLimit blocks until the installation has at least min core API
+// requests remaining. Checking the rate limit does not count against it.
+func waitForRateLimit(ctx context.Context, client *github.Client, min int) error {
+	limits, _, err := client.RateLimits(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get rate limits")
+	}
+
+	core := limits.GetCore()
+	if core == nil || core.Remaining >= min {
+		return nil
+	}
+
+	wait := time.Until(core.Reset.Time)
+	zerolog.Ctx(ctx).Info().Msgf("Pausing backfill for %s, %d API requests remaining", wait.Round(time.Second), core.Remaining)
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
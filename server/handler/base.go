@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-baseapp/baseapp"
@@ -26,9 +27,18 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/shurcooL/githubv4"
 
+	"github.com/palantir/policy-bot/auditlog"
+	"github.com/palantir/policy-bot/delivery"
+	"github.com/palantir/policy-bot/identity"
+	"github.com/palantir/policy-bot/jira"
+	"github.com/palantir/policy-bot/oncall"
 	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/snapshot"
+	"github.com/palantir/policy-bot/store"
 )
 
 const (
@@ -41,15 +51,72 @@ type Base struct {
 	githubapp.ClientCreator
 
 	Installations githubapp.InstallationsService
-	PullOpts      *PullEvaluationOptions
+	Options       *Options
 	ConfigFetcher *ConfigFetcher
 	BaseConfig    *baseapp.HTTPConfig
+
+	// OnCall evaluates on-call actors and predicates. It is nil if on-call
+	// integration is not configured.
+	OnCall oncall.Provider
+
+	// Jira looks up Jira issues linked by pull requests. It is nil if Jira
+	// integration is not configured.
+	Jira jira.Provider
+
+	// Identity looks up user attributes for rules that limit approvers by
+	// attribute. It is nil if identity metadata is not configured.
+	Identity identity.Provider
+
+	// Store persists state across events. It may be nil if no features that
+	// require it are enabled.
+	Store store.Store
+
+	// Attestor publishes attestations for merged pull requests. It is nil if
+	// attestations are not configured.
+	Attestor *Attestor
+
+	// AuditLog checks approvals against the GitHub Enterprise audit log. It
+	// is nil if audit log checks are not enabled.
+	AuditLog *auditlog.Checker
+
+	// Debug configures who may temporarily enable debug logging for a
+	// repository or pull request.
+	Debug *DebugConfig
+
+	// Admin configures who may use the admin page.
+	Admin *AdminConfig
+
+	// SSO configures which single sign-on groups may use the admin page and
+	// read-only views that cover all repositories.
+	SSO *SSOConfig
+
+	// Deliveries deduplicates and replays webhook deliveries. It is nil if
+	// delivery deduplication is not enabled.
+	Deliveries *delivery.Recorder
+
+	// Logs filters messages by the server log level. Debug logging for
+	// repositories and pull requests bypasses it. It may be nil.
+	Logs *LevelWriter
+
+	// RuleCache stores rule results between evaluations of the same pull
+	// request. It is nil if the rule cache is not enabled.
+	RuleCache *approval.ResultCache
+
+	// Snapshots writes the pull request data and result of each evaluation,
+	// so that operators can replay evaluations offline. It is nil if
+	// snapshots are not enabled.
+	Snapshots *snapshot.Writer
 }
 
 type PullEvaluationOptions struct {
 	AppName    string `yaml:"app_name"`
 	PolicyPath string `yaml:"policy_path"`
 
+	// BranchPolicyPaths selects a different policy path for pull requests
+	// that target matching base branches. If no pattern matches, PolicyPath
+	// is used.
+	BranchPolicyPaths []BranchPolicyPath `yaml:"branch_policy_paths"`
+
 	// StatusCheckContext will be used to create the status context. It will be used in the following
 	// pattern: <StatusCheckContext>: <Base Branch Name>
 	StatusCheckContext string `yaml:"status_check_context"`
@@ -58,6 +125,104 @@ type PullEvaluationOptions struct {
 	// no templating. This is turned off by default. This is to support legacy workflows that depend on the original
 	// context behaviour, and will be removed in 2.0
 	PostInsecureStatusChecks bool `yaml:"post_insecure_status_checks"`
+
+	// AllowedExternalCheckURLs is the list of URL prefixes that policies may
+	// call using the "external_check" predicate. If empty, external checks
+	// always fail.
+	AllowedExternalCheckURLs []string `yaml:"allowed_external_check_urls"`
+
+	// DisapprovalEscalation configures actions for pull requests that stay
+	// disapproved for too long.
+	DisapprovalEscalation EscalationConfig `yaml:"disapproval_escalation"`
+
+	// ReviewReminders configures reminders for rules that stay pending for
+	// too long.
+	ReviewReminders ReminderConfig `yaml:"review_reminders"`
+
+	// OrganizationMethods sets the default approval, disapproval, and
+	// revocation methods for repositories owned by each organization, keyed
+	// by login. Policies that specify methods are not affected.
+	OrganizationMethods map[string]common.DefaultMethods `yaml:"organization_methods"`
+
+	// IgnoreCommitsBy lists automation accounts, like dependabot, whose
+	// commits are ignored by approval rules in all repositories: they do
+	// not make the account a contributor, invalidate approvals, or restart
+	// minimum open durations. A commit is ignored only if all of its users
+	// are listed.
+	IgnoreCommitsBy []string `yaml:"ignore_commits_by"`
+
+	// CIAdminTeams lists the teams, as "org/team-slug", whose members
+	// satisfy the ci_admins actor, like the reviewers required by the
+	// builtin:workflow-changes rule.
+	CIAdminTeams []string `yaml:"ci_admin_teams"`
+
+	// PrincipalSets defines named sets of users, teams, and organizations
+	// that policies reference with the principal_sets actor.
+	PrincipalSets map[string]common.PrincipalSet `yaml:"principal_sets"`
+
+	// Backfill configures the evaluation of existing pull requests when the
+	// app is installed.
+	Backfill BackfillConfig `yaml:"backfill"`
+
+	// CheckRunActions enables a check run with buttons to re-evaluate a pull
+	// request, request reviewers, and list eligible approvers. The app must
+	// subscribe to check_run events.
+	CheckRunActions bool `yaml:"check_run_actions"`
+
+	// ConfigErrorChecks posts a failed check run on pull requests with an
+	// invalid policy or a policy that cannot be evaluated, showing the error
+	// and the lines of the policy it refers to.
+	ConfigErrorChecks bool `yaml:"config_error_checks"`
+
+	// Repositories limits the repositories where policies are enforced.
+	// Pull requests in other repositories get a successful status that
+	// says the policy is not enforced.
+	Repositories RepositoryFilter `yaml:"repositories"`
+
+	// ReviewerLoad balances review requests from check run actions across
+	// eligible approvers.
+	ReviewerLoad ReviewerLoadConfig `yaml:"reviewer_load"`
+
+	// ApprovalAcknowledgment reacts or replies to comments and reviews when
+	// they first count as approvals.
+	ApprovalAcknowledgment AcknowledgmentConfig `yaml:"approval_acknowledgment"`
+
+	// ApprovalCarryover counts approvals given on other pull requests with
+	// the same head commit, like pull requests that were closed and
+	// recreated.
+	ApprovalCarryover CarryoverConfig `yaml:"approval_carryover"`
+
+	// Timeouts limits how long evaluations may take and retries evaluations
+	// that time out.
+	Timeouts TimeoutConfig `yaml:"timeouts"`
+
+	// Consistency verifies evaluations that downgrade recently approved
+	// rules by fetching the pull request data again.
+	Consistency ConsistencyConfig `yaml:"consistency"`
+
+	// Dispatch lets automated workflows approve or veto rules that allow the
+	// github_actions_dispatch method by sending signed dispatch events.
+	Dispatch DispatchConfig `yaml:"dispatch"`
+
+	// Timeline records changes to the status and approvers of rules and
+	// shows them on the details page.
+	Timeline TimelineConfig `yaml:"timeline"`
+
+	// Override configures notifications for pull requests approved by the
+	// override policy.
+	Override OverrideConfig `yaml:"override"`
+
+	// SlackApprovals lets eligible approvers approve or reject rules that
+	// allow the slack method from Slack messages.
+	SlackApprovals SlackApprovalConfig `yaml:"slack_approvals"`
+
+	// PushProtection checks that pushes to protected branches and tags merged
+	// an approved pull request.
+	PushProtection PushProtectionConfig `yaml:"push_protection"`
+
+	// DirectoryStatuses posts a status for each directory a pull request
+	// changes, evaluated with only the changes to that directory.
+	DirectoryStatuses DirectoryStatusConfig `yaml:"directory_statuses"`
 }
 
 func (p *PullEvaluationOptions) FillDefaults() {
@@ -74,15 +239,61 @@ func (p *PullEvaluationOptions) FillDefaults() {
 	}
 }
 
+// Options holds the current PullEvaluationOptions. The options are replaced
+// when the server configuration is reloaded, so handlers must load them for
+// each event instead of keeping a reference.
+type Options struct {
+	value atomic.Value
+}
+
+func NewOptions(opts *PullEvaluationOptions) *Options {
+	o := &Options{}
+	o.Store(opts)
+	return o
+}
+
+func (o *Options) Load() *PullEvaluationOptions {
+	return o.value.Load().(*PullEvaluationOptions)
+}
+
+func (o *Options) Store(opts *PullEvaluationOptions) {
+	o.value.Store(opts)
+}
+
+// PullOpts returns the current pull request evaluation options.
+func (b *Base) PullOpts() *PullEvaluationOptions {
+	return b.Options.Load()
+}
+
 func (b *Base) PostStatus(ctx context.Context, client *github.Client, pr *github.PullRequest, state, message string) error {
-	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
-	repo := pr.GetBase().GetRepo().GetName()
 	sha := pr.GetHead().GetSHA()
 
-	publicURL := strings.TrimSuffix(b.BaseConfig.PublicURL, "/")
-	detailsURL := fmt.Sprintf("%s/details/%s/%s/%d", publicURL, owner, repo, pr.GetNumber())
+	if b.runtimeFlags(ctx).ShadowMode {
+		zerolog.Ctx(ctx).Info().Msgf("Shadow mode is enabled, not posting status %s: %s", state, message)
+		return nil
+	}
+
+	if err := b.postCommitStatus(ctx, client, pr, sha, state, message); err != nil {
+		return err
+	}
 
-	contextWithBranch := fmt.Sprintf("%s: %s", b.PullOpts.StatusCheckContext, pr.GetBase().GetRef())
+	if b.PullOpts().CheckRunActions {
+		if err := b.postActionsCheck(ctx, client, pr, state, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// postCommitStatus posts the policy status of a pull request on a commit,
+// which is the head of the pull request or of a merge group that contains it.
+func (b *Base) postCommitStatus(ctx context.Context, client *github.Client, pr *github.PullRequest, sha, state, message string) error {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	detailsURL := b.DetailsURL(pr)
+
+	contextWithBranch := fmt.Sprintf("%s: %s", b.PullOpts().StatusCheckContext, pr.GetBase().GetRef())
 	status := &github.RepoStatus{
 		Context:     &contextWithBranch,
 		State:       &state,
@@ -94,21 +305,72 @@ func (b *Base) PostStatus(ctx context.Context, client *github.Client, pr *github
 		return err
 	}
 
-	if b.PullOpts.PostInsecureStatusChecks {
-		status.Context = &b.PullOpts.StatusCheckContext
+	if b.PullOpts().PostInsecureStatusChecks {
+		status.Context = &b.PullOpts().StatusCheckContext
 		if err := b.postGitHubRepoStatus(ctx, client, owner, repo, sha, status); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
+// evaluationContext returns a context containing the server-level settings
+// that apply to policy evaluations for repositories owned by owner.
+func (b *Base) evaluationContext(ctx context.Context, owner string) context.Context {
+	ctx = predicate.WithAllowedExternalURLs(ctx, b.PullOpts().AllowedExternalCheckURLs)
+	ctx = approval.WithStatusCheckContext(ctx, b.PullOpts().StatusCheckContext)
+	if methods, ok := b.PullOpts().OrganizationMethods[owner]; ok {
+		ctx = common.WithDefaultMethods(ctx, methods)
+	}
+	if timeout := b.PullOpts().Timeouts.Rule; timeout > 0 {
+		ctx = approval.WithRuleTimeout(ctx, timeout)
+	}
+	if len(b.PullOpts().IgnoreCommitsBy) > 0 {
+		ctx = approval.WithIgnoredCommitAuthors(ctx, b.PullOpts().IgnoreCommitsBy)
+	}
+	if len(b.PullOpts().CIAdminTeams) > 0 {
+		ctx = common.WithCIAdminTeams(ctx, b.PullOpts().CIAdminTeams)
+	}
+	if len(b.PullOpts().PrincipalSets) > 0 {
+		ctx = common.WithPrincipalSets(ctx, b.PullOpts().PrincipalSets)
+	}
+	if b.OnCall != nil {
+		ctx = oncall.WithProvider(ctx, b.OnCall)
+	}
+	if b.Identity != nil {
+		ctx = identity.WithProvider(ctx, b.Identity)
+	}
+	if b.Jira != nil {
+		ctx = jira.WithProvider(ctx, jira.NewCachingProvider(b.Jira))
+	}
+	return ctx
+}
+
+// pullEvaluationContext returns the evaluation context for a pull request,
+// including the approvals and decisions recorded for its head commit.
+func (b *Base) pullEvaluationContext(ctx context.Context, prctx pull.Context) context.Context {
+	ctx = b.evaluationContext(ctx, prctx.RepositoryOwner())
+	ctx = b.withCarriedApprovals(ctx, prctx)
+	ctx = b.withDispatchDecisions(ctx, prctx)
+	return b.withSlackDecisions(ctx, prctx)
+}
+
+// DetailsURL returns the URL of the details page for a pull request.
+func (b *Base) DetailsURL(pr *github.PullRequest) string {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	publicURL := strings.TrimSuffix(b.BaseConfig.PublicURL, "/")
+	return fmt.Sprintf("%s/details/%s/%s/%d", publicURL, owner, repo, pr.GetNumber())
+}
+
 func (b *Base) postGitHubRepoStatus(ctx context.Context, client *github.Client, owner, repo, ref string, status *github.RepoStatus) error {
 	logger := zerolog.Ctx(ctx)
 	logger.Info().Msgf("Setting status context=%s state=%s description=%s target_url=%s", status.GetContext(), status.GetState(), status.GetDescription(), status.GetTargetURL())
-	_, _, err := client.Repositories.CreateStatus(ctx, owner, repo, ref, status)
-	return err
+	return retryMutation(ctx, func() error {
+		_, _, err := client.Repositories.CreateStatus(ctx, owner, repo, ref, status)
+		return err
+	})
 }
 
 func (b *Base) Evaluate(ctx context.Context, mbrCtx pull.MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest) error {
@@ -119,54 +381,131 @@ func (b *Base) Evaluate(ctx context.Context, mbrCtx pull.MembershipContext, clie
 	return b.EvaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
 }
 
+// EvaluateTriggered evaluates a pull request after an event that changed the
+// given source of data, one of the approval.Trigger constants. If no rule in
+// a valid policy depends on the source, the evaluation is skipped.
+func (b *Base) EvaluateTriggered(ctx context.Context, mbrCtx pull.MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest, source string) error {
+	fetchedConfig, err := b.ConfigFetcher.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+	}
+	if fetchedConfig.Valid() && !fetchedConfig.Config.TriggeredBy(source) {
+		zerolog.Ctx(ctx).Debug().Msgf("Skipping evaluation because no rules depend on %s", source)
+		return nil
+	}
+	return b.EvaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
+}
+
 func (b *Base) EvaluateFetchedConfig(ctx context.Context, mbrCtx pull.MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest, fetchedConfig FetchedConfig) error {
+	_, err := b.evaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
+	return err
+}
+
+// Evaluation describes the outcome of evaluating the policy for a pull
+// request. Result is nil if the policy was missing or could not be parsed.
+type Evaluation struct {
+	State       string
+	Description string
+	Result      *common.Result
+}
+
+func (b *Base) evaluateFetchedConfig(ctx context.Context, mbrCtx pull.MembershipContext, client *github.Client, v4client *githubv4.Client, pr *github.PullRequest, fetchedConfig FetchedConfig) (Evaluation, error) {
 	logger := zerolog.Ctx(ctx)
 
+	// archived repositories are read-only, so no status can be posted
+	if pr.GetBase().GetRepo().GetArchived() {
+		logger.Debug().Msg("Skipping evaluation of pull request in archived repository")
+		return Evaluation{Description: "Repository is archived"}, nil
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	if !b.PullOpts().Repositories.Enforced(owner, repo) {
+		logger.Debug().Msgf("policy is not enforced for %s/%s", owner, repo)
+		eval := Evaluation{State: "success", Description: "Policy is not enforced for this repository"}
+		return eval, b.PostStatus(ctx, client, pr, eval.State, eval.Description)
+	}
+
 	if fetchedConfig.Missing() {
 		logger.Debug().Msgf("policy does not exist: %s", fetchedConfig)
-		return nil
+		return Evaluation{Description: fetchedConfig.Description()}, nil
 	}
 
 	if fetchedConfig.Invalid() {
 		logger.Warn().Err(fetchedConfig.Error).Msgf("invalid policy: %s", fetchedConfig)
-		err := b.PostStatus(ctx, client, pr, "error", fetchedConfig.Description())
-		return err
+		b.postConfigCheck(ctx, client, pr, fetchedConfig, "Invalid policy", fetchedConfig.Error)
+		eval := Evaluation{State: "error", Description: fetchedConfig.Description()}
+		return eval, b.PostStatus(ctx, client, pr, eval.State, eval.Description)
 	}
 
 	evaluator, err := policy.ParsePolicy(fetchedConfig.Config)
 	if err != nil {
 		statusMessage := fmt.Sprintf("Invalid policy defined by %s", fetchedConfig)
 		logger.Debug().Err(err).Msg(statusMessage)
-		err := b.PostStatus(ctx, client, pr, "error", statusMessage)
-		return err
+		b.postConfigCheck(ctx, client, pr, fetchedConfig, "Invalid policy", err)
+		eval := Evaluation{State: "error", Description: statusMessage}
+		return eval, b.PostStatus(ctx, client, pr, eval.State, eval.Description)
+	}
+
+	prctx := b.snapshotContext(pull.NewGitHubContext(mbrCtx, client, v4client, pr))
+	evalCtx := b.withRuleCache(b.pullEvaluationContext(ctx, prctx), fetchedConfig.Version)
+	if timeout := b.PullOpts().Timeouts.Evaluation; timeout > 0 {
+		var cancel context.CancelFunc
+		evalCtx, cancel = context.WithTimeout(evalCtx, timeout)
+		defer cancel()
 	}
+	result := evaluator.Evaluate(evalCtx, prctx)
+	prctx, result = b.verifyDowngrades(evalCtx, pr, evaluator, prctx, result, func() pull.Context {
+		return b.snapshotContext(pull.NewGitHubContext(mbrCtx, client, v4client, pr))
+	})
+	b.writeSnapshot(ctx, prctx, fetchedConfig, &result)
 
-	prctx := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, pr)
-	result := evaluator.Evaluate(ctx, prctx)
+	if result.Error != nil && isTimeout(evalCtx, result.Error) {
+		return b.evaluationTimedOut(ctx, client, pr, &result)
+	}
+	b.clearRetry(ctx, pr)
 
 	if result.Error != nil {
 		statusMessage := fmt.Sprintf("Error evaluating policy defined by %s", fetchedConfig)
 		logger.Warn().Err(result.Error).Msg(statusMessage)
-		err := b.PostStatus(ctx, client, pr, "error", statusMessage)
-		return err
+		b.postConfigCheck(ctx, client, pr, fetchedConfig, "Error evaluating policy", result.Error)
+		eval := Evaluation{State: "error", Description: statusMessage, Result: &result}
+		return eval, b.PostStatus(ctx, client, pr, eval.State, eval.Description)
+	}
+
+	b.postConfigCheck(ctx, client, pr, fetchedConfig, "", nil)
+	b.checkApprovalIntegrity(ctx, client, prctx.RepositoryOwner(), prctx.RepositoryName(), &result)
+	b.recordApprovals(ctx, prctx, &result)
+	b.recordTimeline(ctx, pr, &result)
+	b.notifyOverride(ctx, pr, &result)
+	b.trackDisapproval(ctx, pr, result.Status)
+	b.trackPendingRules(ctx, pr, fetchedConfig.Config, &result)
+	b.postSecretsCheck(ctx, client, pr, prctx, fetchedConfig.Config)
+	b.requestSlackApprovals(ctx, pr, prctx, fetchedConfig.Config, &result)
+	if b.PullOpts().ApprovalAcknowledgment.IsEnabled() && !b.runtimeFlags(ctx).MuteNotifications {
+		b.acknowledgeApprovals(ctx, client, v4client, pr, &result)
 	}
 
-	statusDescription := result.Description
-	var statusState string
+	eval := Evaluation{Description: result.Description, Result: &result}
 	switch result.Status {
 	case common.StatusApproved:
-		statusState = "success"
+		eval.State = "success"
 	case common.StatusDisapproved:
-		statusState = "failure"
+		eval.State = "failure"
 	case common.StatusPending:
-		statusState = "pending"
+		eval.State = "pending"
 	case common.StatusSkipped:
-		statusState = "error"
-		statusDescription = "All rules were skipped. At least one rule must match."
+		eval.State = "error"
+		eval.Description = "All rules were skipped. At least one rule must match."
 	default:
-		return errors.Errorf("evaluation resulted in unexpected state: %s", result.Status)
+		return eval, errors.Errorf("evaluation resulted in unexpected state: %s", result.Status)
 	}
 
-	err = b.PostStatus(ctx, client, pr, statusState, statusDescription)
-	return err
+	if err := b.PostStatus(ctx, client, pr, eval.State, eval.Description); err != nil {
+		return eval, err
+	}
+	if err := b.postRuleStatuses(ctx, client, pr, &result); err != nil {
+		return eval, err
+	}
+	return eval, b.postDirectoryStatuses(ctx, client, pr, evaluator, prctx)
 }
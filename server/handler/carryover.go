@@ -0,0 +1,176 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultCarryoverTTL = 30 * 24 * time.Hour
+
+	carryoverKeyPrefix = "carryover/"
+)
+
+// CarryoverConfig configures carrying approvals over between pull requests
+// with the same head commit, like pull requests that are closed and reopened
+// or recreated from the same branch after a mass rebase.
+type CarryoverConfig struct {
+	// Enabled records the approvals of each head commit in the store and
+	// counts them on other pull requests in the same repository with that
+	// head commit.
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long approvals are kept after they were last recorded. If
+	// unset, DefaultCarryoverTTL is used.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// carriedApproval is an approval recorded for a rule.
+type carriedApproval struct {
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// carryoverRecord maps rule names to the approvals recorded for a commit.
+type carryoverRecord map[string][]carriedApproval
+
+func carryoverKey(owner, repo, sha string) string {
+	return fmt.Sprintf("%s%s/%s/%s", carryoverKeyPrefix, owner, repo, sha)
+}
+
+func (b *Base) carryoverEnabled() bool {
+	return b.Store != nil && b.PullOpts().ApprovalCarryover.Enabled
+}
+
+// withCarriedApprovals returns a context in which rules count the approvals
+// recorded for the head commit of the pull request. Failures are logged and
+// return the context unchanged.
+func (b *Base) withCarriedApprovals(ctx context.Context, prctx pull.Context) context.Context {
+	if !b.carryoverEnabled() {
+		return ctx
+	}
+
+	sha := prctx.HeadSHA()
+	record, err := b.loadCarryover(ctx, carryoverKey(prctx.RepositoryOwner(), prctx.RepositoryName(), sha))
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to load carried approvals")
+		return ctx
+	}
+	if len(record) == 0 {
+		return ctx
+	}
+
+	approvals := make(map[string][]*common.Candidate, len(record))
+	for rule, as := range record {
+		for _, a := range as {
+			approvals[rule] = append(approvals[rule], &common.Candidate{
+				User:      a.User,
+				CreatedAt: a.CreatedAt,
+				SHA:       sha,
+			})
+		}
+	}
+	return approval.WithCarriedApprovals(ctx, approvals)
+}
+
+// recordApprovals adds the approvals that counted toward each rule in the
+// result to the approvals recorded for the head commit of the pull request.
+// Failures are logged but do not affect the evaluation.
+func (b *Base) recordApprovals(ctx context.Context, prctx pull.Context, result *common.Result) {
+	if !b.carryoverEnabled() {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	key := carryoverKey(prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.HeadSHA())
+
+	record, err := b.loadCarryover(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load carried approvals")
+		return
+	}
+	if record == nil {
+		record = make(carryoverRecord)
+	}
+
+	if !record.add(result, time.Now()) {
+		return
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode carried approvals")
+		return
+	}
+
+	ttl := b.PullOpts().ApprovalCarryover.TTL
+	if ttl <= 0 {
+		ttl = DefaultCarryoverTTL
+	}
+	if err := b.Store.Put(ctx, key, value, ttl); err != nil {
+		logger.Error().Err(err).Msg("Failed to save carried approvals")
+	}
+}
+
+func (b *Base) loadCarryover(ctx context.Context, key string) (carryoverRecord, error) {
+	value, exists, err := b.Store.Get(ctx, key)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var record carryoverRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to decode carried approvals")
+	}
+	return record, nil
+}
+
+// add adds the approvers of the rules in the result that are not already in
+// the record and returns true if the record changed.
+func (r carryoverRecord) add(result *common.Result, now time.Time) bool {
+	changed := false
+	for _, user := range result.Approvers {
+		if !r.contains(result.Name, user) {
+			r[result.Name] = append(r[result.Name], carriedApproval{User: user, CreatedAt: now})
+			changed = true
+		}
+	}
+	for _, c := range result.Children {
+		if r.add(c, now) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (r carryoverRecord) contains(rule, user string) bool {
+	for _, a := range r[rule] {
+		if a.User == user {
+			return true
+		}
+	}
+	return false
+}
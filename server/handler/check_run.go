@@ -0,0 +1,337 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Identifiers of the requested actions on the actions check run. GitHub
+// limits identifiers to 20 characters.
+const (
+	CheckActionReevaluate       = "reevaluate"
+	CheckActionRequestReviewers = "request_reviewers"
+	CheckActionShowApprovers    = "show_approvers"
+
+	// checkRunsMediaType enables the checks API on older GitHub Enterprise
+	// versions.
+	checkRunsMediaType = "application/vnd.github.antiope-preview+json"
+)
+
+// checkRunAction is a button on a check run. The vendored client does not
+// support actions, so check runs with actions are created directly.
+type checkRunAction struct {
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Identifier  string `json:"identifier"`
+}
+
+type checkRunOptions struct {
+	Name        string                 `json:"name"`
+	HeadSHA     string                 `json:"head_sha,omitempty"`
+	DetailsURL  string                 `json:"details_url,omitempty"`
+	Status      string                 `json:"status"`
+	Conclusion  string                 `json:"conclusion"`
+	CompletedAt github.Timestamp       `json:"completed_at"`
+	Output      *github.CheckRunOutput `json:"output"`
+	Actions     []checkRunAction       `json:"actions,omitempty"`
+}
+
+var checkRunActions = []checkRunAction{
+	{
+		Label:       "Re-evaluate",
+		Description: "Evaluate the policy again",
+		Identifier:  CheckActionReevaluate,
+	},
+	{
+		Label:       "Request reviewers",
+		Description: "Request reviews for pending rules",
+		Identifier:  CheckActionRequestReviewers,
+	},
+	{
+		Label:       "Show approvers",
+		Description: "Comment with eligible approvers",
+		Identifier:  CheckActionShowApprovers,
+	},
+}
+
+// ActionsCheckName returns the name of the check run that exposes buttons for
+// common operations on a pull request.
+func (b *Base) ActionsCheckName() string {
+	return fmt.Sprintf("%s: actions", b.PullOpts().StatusCheckContext)
+}
+
+// postActionsCheck creates or updates the actions check run for the head
+// commit of a pull request. The check run repeats the status but always has a
+// neutral conclusion so that it never affects whether the pull request can
+// be merged.
+func (b *Base) postActionsCheck(ctx context.Context, client *github.Client, pr *github.PullRequest, state, message string) error {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	sha := pr.GetHead().GetSHA()
+	name := b.ActionsCheckName()
+
+	title := fmt.Sprintf("Status: %s", state)
+	summary := fmt.Sprintf("%s\n\n[View details](%s)\n", message, b.DetailsURL(pr))
+
+	opts := checkRunOptions{
+		Name:        name,
+		DetailsURL:  b.DetailsURL(pr),
+		Status:      "completed",
+		Conclusion:  "neutral",
+		CompletedAt: github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:   &title,
+			Summary: &summary,
+		},
+		Actions: checkRunActions,
+	}
+
+	return errors.WithMessage(postCheckRun(ctx, client, owner, repo, sha, &opts), "failed to post actions check run")
+}
+
+// postCheckRun creates a check run for a commit or updates the existing check
+// run with the same name.
+func postCheckRun(ctx context.Context, client *github.Client, owner, repo, sha string, opts *checkRunOptions) error {
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{CheckName: &opts.Name})
+	if err != nil {
+		return errors.Wrap(err, "failed to list check runs")
+	}
+
+	method, u := "POST", fmt.Sprintf("repos/%s/%s/check-runs", owner, repo)
+	if len(runs.CheckRuns) > 0 {
+		method, u = "PATCH", fmt.Sprintf("repos/%s/%s/check-runs/%d", owner, repo, runs.CheckRuns[0].GetID())
+	} else {
+		opts.HeadSHA = sha
+	}
+
+	req, err := client.NewRequest(method, u, opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to create check run request")
+	}
+	req.Header.Set("Accept", checkRunsMediaType)
+
+	_, err = client.Do(ctx, req, nil)
+	return errors.Wrap(err, "failed to post check run")
+}
+
+type CheckRun struct {
+	Base
+}
+
+func (h *CheckRun) Handles() []string { return []string{"check_run"} }
+
+// checkRunEvent adds the requested action, which the vendored client does not
+// support, to the check run event.
+type checkRunEvent struct {
+	github.CheckRunEvent
+
+	RequestedAction *struct {
+		Identifier string `json:"identifier"`
+	} `json:"requested_action,omitempty"`
+}
+
+// Handle check_run
+// See https://developer.github.com/v3/activity/events/types/#checkrunevent
+func (h *CheckRun) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event checkRunEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse check run event payload")
+	}
+
+	if event.GetAction() != "requested_action" || event.RequestedAction == nil {
+		return nil
+	}
+	if event.GetCheckRun().GetName() != h.ActionsCheckName() {
+		return nil
+	}
+
+	repo := event.GetRepo()
+	owner := repo.GetOwner().GetLogin()
+	installationID := githubapp.GetInstallationIDFromEvent(&event.CheckRunEvent)
+
+	prs := event.GetCheckRun().PullRequests
+	if len(prs) == 0 {
+		zerolog.Ctx(ctx).Debug().Msg("Check run is not associated with a pull request")
+		return nil
+	}
+	number := prs[0].GetNumber()
+
+	ctx, logger := h.preparePRContext(ctx, installationID, repo, number)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo.GetName(), number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repo.GetName(), number)
+	}
+
+	action := event.RequestedAction.Identifier
+	logger.Info().Msgf("Handling check run action %s from %s", action, event.GetSender().GetLogin())
+
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, h.Installations, h.ClientCreator)
+
+	switch action {
+	case CheckActionReevaluate:
+		return h.Evaluate(ctx, mbrCtx, client, v4client, pr)
+
+	case CheckActionRequestReviewers, CheckActionShowApprovers:
+		fetchedConfig, err := h.ConfigFetcher.ConfigForPR(ctx, client, pr)
+		if err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+		}
+
+		eval, err := h.evaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
+		if err != nil {
+			return err
+		}
+		if eval.Result == nil || eval.Result.Error != nil {
+			return nil
+		}
+
+		loaded := &loadedPullRequest{
+			InstallationID: installationID,
+			Client:         client,
+			V4Client:       v4client,
+			PullRequest:    pr,
+			PullContext:    pull.NewGitHubContext(mbrCtx, client, v4client, pr),
+		}
+
+		approvers, err := policy.EligibleApprovers(h.evaluationContext(ctx, owner), loaded.PullContext, fetchedConfig.Config, eval.Result)
+		if err != nil {
+			return err
+		}
+
+		if action == CheckActionShowApprovers {
+			body := formatApproversComment(approvers)
+			_, _, err := client.Issues.CreateComment(ctx, owner, repo.GetName(), number, &github.IssueComment{Body: &body})
+			return errors.Wrap(err, "failed to create approvers comment")
+		}
+
+		if h.PullOpts().ReviewerLoad.Enabled {
+			if approvers, err = h.balanceApprovers(ctx, approvers); err != nil {
+				return err
+			}
+		}
+
+		reviewers := selectReviewers(fetchedConfig.Config, eval.Result, approvers, pr)
+		if len(reviewers) == 0 {
+			logger.Debug().Msg("No reviewers to request")
+			return nil
+		}
+
+		logger.Info().Msgf("Requesting reviews from %v", reviewers)
+		req := github.ReviewersRequest{Reviewers: reviewers}
+		if err := requestReviewers(ctx, client, owner, repo.GetName(), number, req); err != nil {
+			return errors.Wrap(err, "failed to request reviewers")
+		}
+
+		if h.PullOpts().ReviewerLoad.Enabled {
+			return h.recordReviewRequests(ctx, owner, repo.GetName(), number, reviewers)
+		}
+		return nil
+
+	default:
+		logger.Debug().Msgf("Ignoring unknown check run action %s", action)
+		return nil
+	}
+}
+
+// selectReviewers picks eligible approvers to request reviews from so that
+// each pending rule could collect its remaining approvals. Users who are
+// already requested count toward the rules they are eligible for.
+func selectReviewers(config *policy.Config, result *common.Result, approvers map[string][]string, pr *github.PullRequest) []string {
+	requested := make(map[string]bool)
+	for _, u := range pr.RequestedReviewers {
+		requested[u.GetLogin()] = true
+	}
+
+	var reviewers []string
+	seen := make(map[string]bool)
+	for _, res := range policy.PendingRules(config, result) {
+		// a rule can appear more than once in the policy
+		if seen[res.Name] {
+			continue
+		}
+		seen[res.Name] = true
+
+		needed := res.RequiredCount - len(res.Approvers)
+		for _, u := range approvers[res.Name] {
+			if needed <= 0 {
+				break
+			}
+			if !requested[u] {
+				requested[u] = true
+				reviewers = append(reviewers, u)
+			}
+			needed--
+		}
+	}
+	return reviewers
+}
+
+func formatApproversComment(approvers map[string][]string) string {
+	var buf bytes.Buffer
+	if len(approvers) == 0 {
+		buf.WriteString("No pending rules need approval.\n")
+		return buf.String()
+	}
+
+	var names []string
+	for name := range approvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.WriteString("Eligible approvers for pending rules:\n\n")
+	for _, name := range names {
+		users := approvers[name]
+		fmt.Fprintf(&buf, "- **%s**:", name)
+		for i, u := range users {
+			if i == MaxDisplayedApprovers {
+				fmt.Fprintf(&buf, " and %d more", len(users)-i)
+				break
+			}
+			fmt.Fprintf(&buf, " `%s`", u)
+		}
+		if len(users) == 0 {
+			buf.WriteString(" no eligible users")
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	// PolicyCommand is the comment that requests a re-evaluation of a pull
+	// request and a reply with the detailed evaluation result.
+	PolicyCommand = "/policy"
+
+	// evaluationCommentMarker identifies comments created in response to a
+	// PolicyCommand so they can be updated instead of duplicated.
+	evaluationCommentMarker = "<!-- policy-bot: evaluation -->"
+)
+
+// IsPolicyCommand returns true if the comment body invokes PolicyCommand.
+func IsPolicyCommand(body string) bool {
+	fields := strings.Fields(body)
+	return len(fields) > 0 && fields[0] == PolicyCommand
+}
+
+// PostEvaluationComment creates or updates the evaluation comment on a pull
+// request with the details of an evaluation.
+func (b *Base) PostEvaluationComment(ctx context.Context, client *github.Client, pr *github.PullRequest, eval Evaluation) error {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	number := pr.GetNumber()
+
+	body := b.formatEvaluationComment(pr, eval)
+
+	existing, err := b.findEvaluationComment(ctx, client, owner, repo, number)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		_, _, err := client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+		return errors.Wrap(err, "failed to update evaluation comment")
+	}
+
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+	return errors.Wrap(err, "failed to create evaluation comment")
+}
+
+func (b *Base) findEvaluationComment(ctx context.Context, client *github.Client, owner, repo string, number int) (*github.IssueComment, error) {
+	botName := b.PullOpts().AppName + "[bot]"
+
+	opt := &github.IssueListCommentsOptions{}
+	for {
+		comments, res, err := client.Issues.ListComments(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list pull request comments")
+		}
+
+		for _, c := range comments {
+			if c.GetUser().GetLogin() == botName && strings.Contains(c.GetBody(), evaluationCommentMarker) {
+				return c, nil
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return nil, nil
+}
+
+func (b *Base) formatEvaluationComment(pr *github.PullRequest, eval Evaluation) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(evaluationCommentMarker)
+	buf.WriteString("\n")
+
+	state := eval.State
+	if state == "" {
+		state = "not evaluated"
+	}
+	fmt.Fprintf(&buf, "**%s** status: `%s` - %s\n\n", b.PullOpts().AppName, state, eval.Description)
+
+	if eval.Result != nil {
+		writeResultMarkdown(&buf, eval.Result, 0)
+		buf.WriteString("\n")
+	}
+
+	fmt.Fprintf(&buf, "[View details](%s)\n", b.DetailsURL(pr))
+	return buf.String()
+}
+
+func writeResultMarkdown(buf *bytes.Buffer, r *common.Result, depth int) {
+	status := r.Status.String()
+	desc := r.Description
+	if r.Error != nil {
+		status = "error"
+		desc = r.Error.Error()
+	}
+
+	fmt.Fprintf(buf, "%s- **%s**: `%s`", strings.Repeat("  ", depth), r.Name, status)
+	if r.Advisory {
+		buf.WriteString(" (advisory)")
+	}
+	if desc != "" {
+		fmt.Fprintf(buf, " - %s", desc)
+	}
+	buf.WriteString("\n")
+
+	for _, c := range r.Children {
+		writeResultMarkdown(buf, c, depth+1)
+	}
+}
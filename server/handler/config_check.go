@@ -0,0 +1,175 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// configSnippetContext is the number of lines shown before and after the
+	// line that contains an error.
+	configSnippetContext = 2
+
+	// maxCheckRunSummary is the maximum length of a check run summary.
+	maxCheckRunSummary = 65535
+)
+
+var (
+	errorLinePattern  = regexp.MustCompile(`\bline (\d+)`)
+	errorQuotePattern = regexp.MustCompile(`'([^'\n]+)'|"([^"\n]+)"`)
+)
+
+// ConfigCheckName returns the name of the check run that reports errors in
+// the policy of a pull request.
+func (b *Base) ConfigCheckName() string {
+	return fmt.Sprintf("%s: configuration", b.PullOpts().StatusCheckContext)
+}
+
+// postConfigCheck posts a failed configuration check run with the error and
+// the lines of the policy that contain it. If cause is nil, an existing
+// configuration check run on the head commit is marked as successful, so
+// that fixing the policy clears the failure. Failures to post are logged.
+func (b *Base) postConfigCheck(ctx context.Context, client *github.Client, pr *github.PullRequest, fc FetchedConfig, title string, cause error) {
+	if !b.PullOpts().ConfigErrorChecks {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	if b.runtimeFlags(ctx).ShadowMode {
+		logger.Info().Msg("Shadow mode is enabled, not posting configuration check")
+		return
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	sha := pr.GetHead().GetSHA()
+
+	opts := checkRunOptions{
+		Name:        b.ConfigCheckName(),
+		DetailsURL:  b.DetailsURL(pr),
+		Status:      "completed",
+		CompletedAt: github.Timestamp{Time: time.Now()},
+	}
+
+	if cause == nil {
+		runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{CheckName: &opts.Name})
+		if err != nil {
+			logger.Warn().Err(err).Msg("Failed to list configuration checks")
+			return
+		}
+		if len(runs.CheckRuns) == 0 || runs.CheckRuns[0].GetConclusion() == "success" {
+			return
+		}
+
+		valid, summary := "Valid policy", fmt.Sprintf("The policy defined by %s is valid.", fc)
+		opts.Conclusion = "success"
+		opts.Output = &github.CheckRunOutput{Title: &valid, Summary: &summary}
+	} else {
+		summary := configErrorSummary(fc, cause)
+		opts.Conclusion = "failure"
+		opts.Output = &github.CheckRunOutput{Title: &title, Summary: &summary}
+	}
+
+	if err := postCheckRun(ctx, client, owner, repo, sha, &opts); err != nil {
+		logger.Warn().Err(err).Msg("Failed to post configuration check")
+	}
+}
+
+// configErrorSummary describes an error in the policy for developers who
+// need to fix it, with the lines of the policy that the error refers to.
+func configErrorSummary(fc FetchedConfig, cause error) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "The policy defined by %s could not be used:\n\n", fc)
+	fmt.Fprintf(&b, "```\n%s\n```\n", cause.Error())
+
+	if line := configErrorLine(fc.Content, cause); line > 0 {
+		fmt.Fprintf(&b, "\nLine %d of `%s`:\n\n```yaml\n%s```\n", line, fc.Path, configSnippet(fc.Content, line))
+	}
+
+	b.WriteString("\nFix the policy or ask the owners of the policy for help. " +
+		"The status of the pull request updates when the policy is valid.\n")
+
+	summary := b.String()
+	if len(summary) > maxCheckRunSummary {
+		summary = summary[:maxCheckRunSummary]
+	}
+	return summary
+}
+
+// configErrorLine returns the line of the policy that an error refers to,
+// or 0 if it is unknown. Parse errors include the line. For other errors,
+// it is the first line that contains a quoted name from the error, like the
+// name of an undefined rule or team.
+func configErrorLine(content []byte, cause error) int {
+	if len(content) == 0 {
+		return 0
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	msg := cause.Error()
+
+	if m := errorLinePattern.FindStringSubmatch(msg); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 && n <= len(lines) {
+			return n
+		}
+	}
+
+	// the innermost cause is at the end of the message and names the most
+	// specific value
+	quoted := errorQuotePattern.FindAllStringSubmatch(msg, -1)
+	for i := len(quoted) - 1; i >= 0; i-- {
+		name := quoted[i][1] + quoted[i][2]
+		for n, line := range lines {
+			if bytes.Contains(line, []byte(name)) {
+				return n + 1
+			}
+		}
+	}
+	return 0
+}
+
+// configSnippet returns the line of the content with the lines around it,
+// prefixed by line numbers, with a marker on the given line.
+func configSnippet(content []byte, line int) string {
+	lines := strings.Split(string(content), "\n")
+
+	start, end := line-configSnippetContext, line+configSnippetContext
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	var b strings.Builder
+	for n := start; n <= end; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %4d | %s\n", marker, n, lines[n-1])
+	}
+	return b.String()
+}
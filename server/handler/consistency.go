@@ -0,0 +1,196 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultConsistencyDelay       = 2 * time.Second
+	DefaultConsistencyMaxAttempts = 3
+
+	approvedRulesKeyPrefix = "approved/"
+)
+
+// ConsistencyConfig configures the verification of evaluations that
+// downgrade a recently approved rule. GitHub may not return new reviews or
+// commits until shortly after sending the event about them, so an evaluation
+// right after an event can miss data that an earlier evaluation saw. The
+// verification is disabled if Window is zero.
+type ConsistencyConfig struct {
+	// Window is how long after an evaluation that approved a rule a
+	// downgrade of the rule on the same head commit is verified.
+	Window time.Duration `yaml:"window"`
+
+	// Delay is the time to wait before fetching the pull request data again.
+	// If unset, DefaultConsistencyDelay is used.
+	Delay time.Duration `yaml:"delay"`
+
+	// MaxAttempts is the number of times the data is fetched again before
+	// accepting the downgrade. If unset, DefaultConsistencyMaxAttempts is
+	// used.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+func (c *ConsistencyConfig) IsEnabled() bool {
+	return c.Window > 0
+}
+
+// approvedRulesRecord lists the rules approved by the last evaluation of a
+// pull request. Records expire after the consistency window.
+type approvedRulesRecord struct {
+	SHA   string   `json:"sha"`
+	Rules []string `json:"rules"`
+}
+
+func approvedRulesKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%d", approvedRulesKeyPrefix, owner, repo, number)
+}
+
+// approvedRules returns the names of the approved rules in the result.
+func approvedRules(r *common.Result, rules map[string]bool) map[string]bool {
+	if len(r.Children) == 0 {
+		if r.Status == common.StatusApproved && r.Error == nil {
+			rules[r.Name] = true
+		}
+		return rules
+	}
+	for _, c := range r.Children {
+		approvedRules(c, rules)
+	}
+	return rules
+}
+
+// downgradedRules returns the rules in the record that are not approved by
+// the result.
+func (r approvedRulesRecord) downgradedRules(result *common.Result) []string {
+	approved := approvedRules(result, make(map[string]bool))
+
+	var downgraded []string
+	for _, name := range r.Rules {
+		if !approved[name] {
+			downgraded = append(downgraded, name)
+		}
+	}
+	return downgraded
+}
+
+// verifyDowngrades evaluates the policy again with freshly fetched data if
+// the result no longer approves a rule that was approved for the same head
+// commit within the consistency window. It stops when no rules are
+// downgraded or after the maximum number of attempts and returns the last
+// successful evaluation.
+func (b *Base) verifyDowngrades(ctx context.Context, pr *github.PullRequest, evaluator common.Evaluator, prctx pull.Context, result common.Result, refresh func() pull.Context) (pull.Context, common.Result) {
+	config := b.PullOpts().Consistency
+	if b.Store == nil || !config.IsEnabled() || result.Error != nil {
+		return prctx, result
+	}
+
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := approvedRulesKey(owner, repo, pr.GetNumber())
+
+	record, err := b.loadApprovedRules(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read approved rules")
+		return prctx, result
+	}
+
+	delay := config.Delay
+	if delay <= 0 {
+		delay = DefaultConsistencyDelay
+	}
+	maxAttempts := config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultConsistencyMaxAttempts
+	}
+
+	if record != nil && record.SHA == pr.GetHead().GetSHA() {
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			downgraded := record.downgradedRules(&result)
+			if len(downgraded) == 0 {
+				break
+			}
+
+			logger.Info().Msgf("Rules %q were recently approved, fetching data again (attempt %d of %d)", downgraded, attempt, maxAttempts)
+
+			select {
+			case <-ctx.Done():
+				return prctx, result
+			case <-time.After(delay):
+			}
+
+			fresh := refresh()
+			freshResult := evaluator.Evaluate(ctx, fresh)
+			if freshResult.Error != nil {
+				logger.Warn().Err(freshResult.Error).Msg("Failed to verify downgraded rules")
+				break
+			}
+			prctx, result = fresh, freshResult
+		}
+	}
+
+	if err := b.saveApprovedRules(ctx, key, pr.GetHead().GetSHA(), &result, config.Window); err != nil {
+		logger.Error().Err(err).Msg("Failed to save approved rules")
+	}
+	return prctx, result
+}
+
+func (b *Base) loadApprovedRules(ctx context.Context, key string) (*approvedRulesRecord, error) {
+	value, exists, err := b.Store.Get(ctx, key)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var record approvedRulesRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Ignoring invalid approved rules record")
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (b *Base) saveApprovedRules(ctx context.Context, key, sha string, result *common.Result, window time.Duration) error {
+	approved := approvedRules(result, make(map[string]bool))
+	if len(approved) == 0 {
+		return b.Store.Delete(ctx, key)
+	}
+
+	record := approvedRulesRecord{SHA: sha}
+	for name := range approved {
+		record.Rules = append(record.Rules, name)
+	}
+	sort.Strings(record.Rules)
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode approved rules")
+	}
+	return b.Store.Put(ctx, key, value, window)
+}
@@ -26,7 +26,6 @@ import (
 )
 
 type CrossOrgMembershipContext struct {
-	ctx           context.Context
 	lookupClient  *github.Client
 	installations githubapp.InstallationsService
 	clientCreator githubapp.ClientCreator
@@ -34,27 +33,26 @@ type CrossOrgMembershipContext struct {
 	mbrCtxs map[string]pull.MembershipContext
 }
 
-func NewCrossOrgMembershipContext(ctx context.Context, client *github.Client, orgName string, installations githubapp.InstallationsService, clientCreator githubapp.ClientCreator) *CrossOrgMembershipContext {
+func NewCrossOrgMembershipContext(client *github.Client, orgName string, installations githubapp.InstallationsService, clientCreator githubapp.ClientCreator) *CrossOrgMembershipContext {
 	mbrCtx := &CrossOrgMembershipContext{
-		ctx:           ctx,
 		lookupClient:  client,
 		installations: installations,
 		clientCreator: clientCreator,
 		mbrCtxs:       make(map[string]pull.MembershipContext),
 	}
-	mbrCtx.mbrCtxs[orgName] = pull.NewGitHubMembershipContext(ctx, client)
+	mbrCtx.mbrCtxs[orgName] = pull.NewGitHubMembershipContext(client)
 	return mbrCtx
 }
 
-func (c *CrossOrgMembershipContext) getCtxForOrg(name string) (pull.MembershipContext, error) {
+func (c *CrossOrgMembershipContext) getCtxForOrg(ctx context.Context, name string) (pull.MembershipContext, error) {
 	mbrCtx, ok := c.mbrCtxs[name]
 	if !ok {
-		org, _, err := c.lookupClient.Organizations.Get(c.ctx, name)
+		org, _, err := c.lookupClient.Organizations.Get(ctx, name)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		installation, err := c.installations.GetByOwner(c.ctx, org.GetLogin())
+		installation, err := c.installations.GetByOwner(ctx, org.GetLogin())
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to lookup installation ID for org '%s' or there is no such installation", name)
 		}
@@ -64,34 +62,67 @@ func (c *CrossOrgMembershipContext) getCtxForOrg(name string) (pull.MembershipCo
 			return nil, err
 		}
 
-		mbrCtx = pull.NewGitHubMembershipContext(c.ctx, client)
+		mbrCtx = pull.NewGitHubMembershipContext(client)
 		c.mbrCtxs[name] = mbrCtx
 	}
 
 	return mbrCtx, nil
 }
 
-func (c *CrossOrgMembershipContext) IsTeamMember(team, user string) (bool, error) {
+func (c *CrossOrgMembershipContext) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
 	org := strings.Split(team, "/")[0]
-	mbrCtx, err := c.getCtxForOrg(org)
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
 	if err != nil {
 		return false, err
 	}
-	return mbrCtx.IsTeamMember(team, user)
+	return mbrCtx.IsTeamMember(ctx, team, user)
 }
 
-func (c *CrossOrgMembershipContext) IsOrgMember(org, user string) (bool, error) {
-	mbrCtx, err := c.getCtxForOrg(org)
+func (c *CrossOrgMembershipContext) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
 	if err != nil {
 		return false, err
 	}
-	return mbrCtx.IsOrgMember(org, user)
+	return mbrCtx.IsOrgMember(ctx, org, user)
 }
 
-func (c *CrossOrgMembershipContext) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
-	mbrCtx, err := c.getCtxForOrg(org)
+func (c *CrossOrgMembershipContext) OrganizationMembership(ctx context.Context, org, user string) (*pull.OrgMembership, error) {
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return mbrCtx.OrganizationMembership(ctx, org, user)
+}
+
+func (c *CrossOrgMembershipContext) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
 	if err != nil {
 		return false, err
 	}
-	return mbrCtx.IsCollaborator(org, repo, user, desiredPerm)
+	return mbrCtx.IsCollaborator(ctx, org, repo, user, desiredPerm)
+}
+
+func (c *CrossOrgMembershipContext) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	org := strings.Split(team, "/")[0]
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return mbrCtx.TeamMembers(ctx, team)
+}
+
+func (c *CrossOrgMembershipContext) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return mbrCtx.OrganizationMembers(ctx, org)
+}
+
+func (c *CrossOrgMembershipContext) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	mbrCtx, err := c.getCtxForOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return mbrCtx.RepositoryCollaborators(ctx, org, repo, desiredPerm)
 }
@@ -0,0 +1,247 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+)
+
+const (
+	debugKeyPrefix = "debug/"
+
+	DefaultDebugDuration = time.Hour
+)
+
+// DebugConfig allows administrators to temporarily enable debug logging for
+// a single repository or pull request. While debug logging is enabled, all
+// messages about the repository or pull request are logged, including GitHub
+// API requests and predicate decisions, regardless of the server log level.
+type DebugConfig struct {
+	// Admins are the GitHub users who may enable debug logging from the
+	// details page. Users who log in with single sign-on may not.
+	Admins []string `yaml:"admins"`
+
+	// Duration is how long debug logging stays enabled. The default is one
+	// hour.
+	Duration time.Duration `yaml:"duration"`
+}
+
+func (c *DebugConfig) IsAdmin(user string) bool {
+	if c == nil {
+		return false
+	}
+	for _, admin := range c.Admins {
+		if strings.EqualFold(admin, user) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *DebugConfig) duration() time.Duration {
+	if c.Duration > 0 {
+		return c.Duration
+	}
+	return DefaultDebugDuration
+}
+
+// debugKey returns the store key that enables debug logging for a pull
+// request, or for the whole repository if number is zero.
+func debugKey(owner, repo string, number int) string {
+	key := fmt.Sprintf("%s%s/%s", debugKeyPrefix, strings.ToLower(owner), strings.ToLower(repo))
+	if number > 0 {
+		key = fmt.Sprintf("%s/%d", key, number)
+	}
+	return key
+}
+
+// debugExpiration returns the time when debug logging for the pull request,
+// or for the repository if number is zero, ends. The boolean is false if
+// debug logging is not enabled.
+func (b *Base) debugExpiration(ctx context.Context, owner, repo string, number int) (time.Time, bool) {
+	if b.Store == nil {
+		return time.Time{}, false
+	}
+
+	value, ok, err := b.Store.Get(ctx, debugKey(owner, repo, number))
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to check debug logging status")
+		return time.Time{}, false
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+
+	expires, err := time.Parse(time.RFC3339, string(value))
+	if err != nil || time.Now().After(expires) {
+		return time.Time{}, false
+	}
+	return expires, true
+}
+
+// debugContext returns a context with a logger that logs all levels if debug
+// logging is enabled for the pull request or its repository.
+func (b *Base) debugContext(ctx context.Context, logger zerolog.Logger, owner, repo string, number int) (context.Context, zerolog.Logger) {
+	_, enabled := b.debugExpiration(ctx, owner, repo, 0)
+	if !enabled && number > 0 {
+		_, enabled = b.debugExpiration(ctx, owner, repo, number)
+	}
+	if !enabled {
+		return ctx, logger
+	}
+
+	if b.Logs != nil {
+		logger = logger.Output(b.Logs.Unfiltered())
+	}
+	logger = logger.Level(zerolog.DebugLevel).With().Bool("debug", true).Logger()
+	return logger.WithContext(ctx), logger
+}
+
+// preparePRContext is like githubapp.PreparePRContext, but enables debug
+// logging if it is enabled for the pull request or its repository.
+func (b *Base) preparePRContext(ctx context.Context, installationID int64, repo *github.Repository, number int) (context.Context, zerolog.Logger) {
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, repo, number)
+	return b.debugContext(ctx, logger, repo.GetOwner().GetLogin(), repo.GetName(), number)
+}
+
+// prepareRepoContext is like githubapp.PrepareRepoContext, but enables debug
+// logging if it is enabled for the repository.
+func (b *Base) prepareRepoContext(ctx context.Context, installationID int64, repo *github.Repository) (context.Context, zerolog.Logger) {
+	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	return b.debugContext(ctx, logger, repo.GetOwner().GetLogin(), repo.GetName(), 0)
+}
+
+// debugForm is the form on the details page that enables and disables debug
+// logging. It is only shown to debug administrators.
+type debugForm struct {
+	Action    string
+	CSRFToken string
+	Scopes    []*debugScope
+}
+
+// debugScope is the debug logging status of the pull request or its
+// repository. Until is nil if debug logging is not enabled.
+type debugScope struct {
+	Name  string
+	Until *time.Time
+}
+
+func (b *Base) newDebugForm(ctx context.Context, owner, repo string, number int, token string) *debugForm {
+	form := &debugForm{
+		Action:    fmt.Sprintf("/details/%s/%s/%d/debug", owner, repo, number),
+		CSRFToken: token,
+	}
+	for _, scope := range []string{"pull", "repository"} {
+		n := number
+		if scope == "repository" {
+			n = 0
+		}
+
+		ds := &debugScope{Name: scope}
+		if t, ok := b.debugExpiration(ctx, owner, repo, n); ok {
+			ds.Until = &t
+		}
+		form.Scopes = append(form.Scopes, ds)
+	}
+	return form
+}
+
+// DebugLogging enables or disables debug logging for a pull request or its
+// repository on behalf of a debug administrator.
+type DebugLogging struct {
+	Base
+	Sessions *scs.Manager
+}
+
+func (h *DebugLogging) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	number, err := strconv.Atoi(pat.Param(r, "number"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
+		return nil
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	token, err := sess.GetString(SessionKeyCSRFToken)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(r.PostFormValue("csrf_token"))) != 1 {
+		http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+		return nil
+	}
+
+	sso, err := requestSSO(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if sso || !h.Debug.IsAdmin(user) {
+		http.Error(w, "you do not have permission to change debug logging", http.StatusForbidden)
+		return nil
+	}
+
+	target := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	key := debugKey(owner, repo, number)
+	if r.PostFormValue("scope") == "repository" {
+		target = fmt.Sprintf("%s/%s", owner, repo)
+		key = debugKey(owner, repo, 0)
+	}
+
+	logger := zerolog.Ctx(ctx)
+	switch action := r.PostFormValue("action"); action {
+	case "enable":
+		d := h.Debug.duration()
+		expires := time.Now().Add(d).UTC().Format(time.RFC3339)
+		if err := h.Store.Put(ctx, key, []byte(expires), d); err != nil {
+			return errors.Wrap(err, "failed to enable debug logging")
+		}
+		logger.Info().Msgf("User %s enabled debug logging for %s until %s", user, target, expires)
+
+	case "disable":
+		if err := h.Store.Delete(ctx, key); err != nil {
+			return errors.Wrap(err, "failed to disable debug logging")
+		}
+		logger.Info().Msgf("User %s disabled debug logging for %s", user, target)
+
+	default:
+		http.Error(w, fmt.Sprintf("invalid action %q", action), http.StatusBadRequest)
+		return nil
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/details/%s/%s/%d", owner, repo, number), http.StatusSeeOther)
+	return nil
+}
@@ -15,17 +15,21 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/alexedwards/scs"
 	"github.com/bluekeyes/templatetree"
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/shurcooL/githubv4"
 	"goji.io/pat"
 
 	"github.com/palantir/policy-bot/policy"
@@ -35,8 +39,9 @@ import (
 
 type Details struct {
 	Base
-	Sessions  *scs.Manager
-	Templates templatetree.HTMLTree
+	GithubConfig *githubapp.Config
+	Sessions     *scs.Manager
+	Templates    templatetree.HTMLTree
 }
 
 func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
@@ -51,94 +56,337 @@ func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
-	installation, err := h.Installations.GetByOwner(ctx, owner)
+	sess := h.Sessions.Load(r)
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	sso, err := requestSSO(r, sess)
 	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	loaded, err := h.loadPullRequest(ctx, owner, repo, number, user)
+	if err != nil {
+		if isNotFoundError(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil
+		}
 		return err
 	}
 
-	client, err := h.ClientCreator.NewInstallationClient(installation.ID)
+	token, err := csrfToken(w, sess)
 	if err != nil {
-		return errors.Wrap(err, "failed to create github client")
+		return err
 	}
 
-	v4client, err := h.ClientCreator.NewInstallationV4Client(installation.ID)
+	var data struct {
+		Error       error
+		Result      *detailsResult
+		PullRequest *github.PullRequest
+		User        string
+		PolicyURL   string
+
+		// PolicyKey and PolicyVersion identify the central policy or the
+		// policy file content used for the evaluation.
+		PolicyKey     string
+		PolicyVersion string
+
+		// DebugForm enables and disables debug logging. It is nil unless
+		// the user is a debug administrator.
+		DebugForm *debugForm
+
+		// Timeline lists changes to rules, newest first. It is empty if the
+		// timeline is not enabled.
+		Timeline []timelineEntry
+	}
+
+	data.PullRequest = loaded.PullRequest
+	data.User = user
+	if !sso && h.Debug.IsAdmin(user) {
+		data.DebugForm = h.newDebugForm(ctx, owner, repo, number, token)
+	}
+
+	data.Timeline, err = h.timelineEntries(ctx, owner, repo, number)
 	if err != nil {
-		return errors.Wrap(err, "failed to create github client")
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to load timeline")
 	}
 
-	sess := h.Sessions.Load(r)
-	user, err := sess.GetString(SessionKeyUsername)
+	result, config, err := h.evaluatePullRequest(ctx, loaded)
+	data.PolicyVersion = config.Version
+	if config.Central {
+		data.PolicyKey = config.Path
+	} else {
+		data.PolicyURL = getPolicyURL(loaded.PullRequest, config)
+	}
+	data.Error = err
+
+	if result != nil {
+		var approvers map[string][]string
+		if result.Error == nil {
+			approvers, err = policy.EligibleApprovers(h.evaluationContext(ctx, owner), loaded.PullContext, config.Config, result)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to compute eligible approvers")
+			}
+		}
+
+		var form *reviewRequestForm
+		if canRequestReviewers(loaded, user) {
+			form = &reviewRequestForm{
+				Action:    fmt.Sprintf("/details/%s/%s/%d/reviewers", owner, repo, number),
+				CSRFToken: token,
+			}
+		}
+
+		requested := func(user string) bool {
+			ok, err := reviewRequested(ctx, loaded.PullContext, user)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Msgf("Failed to check review requests for %s", user)
+			}
+			return ok
+		}
+
+		data.Result = h.newDetailsResult(result, requested, approvers, form)
+	}
+
+	return h.render(w, data)
+}
+
+// detailsResult wraps a result with the information needed to show who can
+// approve pending rules on the details page.
+type detailsResult struct {
+	*common.Result
+
+	Approvers     []*detailsApprover
+	MoreApprovers int
+	RequestForm   *reviewRequestForm
+
+	Approvals []*detailsApproval
+
+	Children []*detailsResult
+}
+
+type detailsApprover struct {
+	Login     string
+	AvatarURL string
+	Requested bool
+}
+
+// detailsApproval is an approval that counted toward a rule and the commit
+// that it covers.
+type detailsApproval struct {
+	Login    string
+	SHA      string
+	ShortSHA string
+}
+
+type reviewRequestForm struct {
+	Action    string
+	CSRFToken string
+}
+
+// newDetailsResult converts a result for display. The requested function
+// returns true if a user already has a pending review request, so the page
+// does not offer to request the user again.
+func (h *Details) newDetailsResult(res *common.Result, requested func(user string) bool, approvers map[string][]string, form *reviewRequestForm) *detailsResult {
+	dr := &detailsResult{Result: res}
+
+	for _, u := range res.Approvers {
+		if sha, ok := res.ApprovalSHAs[u]; ok {
+			short := sha
+			if len(short) > 7 {
+				short = short[:7]
+			}
+			dr.Approvals = append(dr.Approvals, &detailsApproval{
+				Login:    u,
+				SHA:      sha,
+				ShortSHA: short,
+			})
+		}
+	}
+
+	if users, ok := approvers[res.Name]; ok && len(res.Children) == 0 {
+		for i, u := range users {
+			if i == MaxDisplayedApprovers {
+				dr.MoreApprovers = len(users) - i
+				break
+			}
+			dr.Approvers = append(dr.Approvers, &detailsApprover{
+				Login:     u,
+				AvatarURL: fmt.Sprintf("%s/%s.png?size=40", strings.TrimSuffix(h.GithubConfig.WebURL, "/"), url.PathEscape(u)),
+				Requested: requested(u),
+			})
+		}
+		dr.RequestForm = form
+	}
+
+	for _, c := range res.Children {
+		dr.Children = append(dr.Children, h.newDetailsResult(c, requested, approvers, form))
+	}
+	return dr
+}
+
+type notFoundError string
+
+func (err notFoundError) Error() string {
+	return string(err)
+}
+
+func isNotFoundError(err error) bool {
+	_, ok := errors.Cause(err).(notFoundError)
+	return ok
+}
+
+type loadedPullRequest struct {
+	InstallationID int64
+	Client         *github.Client
+	V4Client       *githubv4.Client
+	PullRequest    *github.PullRequest
+	PullContext    pull.Context
+
+	// Permission is the permission level of the user who loaded the pull
+	// request on the repository.
+	Permission string
+}
+
+// loadPullRequest loads a pull request on behalf of a user, returning a
+// notFoundError if the pull request does not exist or the user does not have
+// permission to see it.
+func (b *Base) loadPullRequest(ctx context.Context, owner, repo string, number int, user string) (*loadedPullRequest, error) {
+	notFound := notFoundError(fmt.Sprintf("not found: %s/%s#%d", owner, repo, number))
+
+	installation, err := b.Installations.GetByOwner(ctx, owner)
 	if err != nil {
-		return errors.Wrap(err, "failed to read sessions")
+		return nil, err
+	}
+
+	client, err := b.ClientCreator.NewInstallationClient(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
+	}
+
+	v4client, err := b.ClientCreator.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
 	}
 
 	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
 	if err != nil {
 		if isNotFound(err) {
-			http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
-			return nil
+			return nil, notFound
 		}
-		return errors.Wrap(err, "failed to get user permission level")
+		return nil, errors.Wrap(err, "failed to get user permission level")
 	}
 
 	// if the user does not have permission, pretend the repo/PR doesn't exist
 	if level.GetPermission() == "none" {
-		http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
-		return nil
+		return nil, notFound
+	}
+
+	// the user's token may have less access than the user
+	canAccess, err := userCanAccess(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, notFound
 	}
 
 	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
 	if err != nil {
 		if isNotFound(err) {
-			http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
-			return nil
+			return nil, notFound
 		}
-		return errors.Wrap(err, "failed to get pull request")
+		return nil, errors.Wrap(err, "failed to get pull request")
 	}
 
-	var data struct {
-		Error       error
-		Result      *common.Result
-		PullRequest *github.PullRequest
-		User        string
-		PolicyURL   string
+	// merged pull requests are evaluated as of their merge
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, b.Installations, b.ClientCreator)
+
+	var prctx pull.Context
+	if pr.GetMerged() {
+		prctx = pull.NewGitHubContextAt(mbrCtx, client, v4client, pr, pr.GetMergedAt())
+	} else {
+		prctx = pull.NewGitHubContext(mbrCtx, client, v4client, pr)
 	}
 
-	data.PullRequest = pr
-	data.User = user
+	return &loadedPullRequest{
+		InstallationID: installation.ID,
+		Client:         client,
+		V4Client:       v4client,
+		PullRequest:    pr,
+		PullContext:    prctx,
+		Permission:     level.GetPermission(),
+	}, nil
+}
 
-	ctx, _ = githubapp.PreparePRContext(ctx, installation.ID, pr.GetBase().GetRepo(), number)
+// evaluatePullRequest evaluates the policy for a loaded pull request without
+// posting any statuses. Merged pull requests are evaluated as of their merge,
+// using the policy defined on the base branch just before the merge, so a
+// pull request cannot change the policy it is evaluated against. The returned
+// error describes why the policy could not be evaluated and is suitable for
+// display.
+func (b *Base) evaluatePullRequest(ctx context.Context, loaded *loadedPullRequest) (*common.Result, FetchedConfig, error) {
+	pr := loaded.PullRequest
+	ctx, _ = b.preparePRContext(ctx, loaded.InstallationID, pr.GetBase().GetRepo(), pr.GetNumber())
 
-	config, err := h.ConfigFetcher.ConfigForPR(ctx, client, pr)
-	data.PolicyURL = getPolicyURL(pr, config)
+	var config FetchedConfig
+	var err error
+	if pr.GetMerged() && pr.GetMergeCommitSHA() != "" {
+		owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+		repo := pr.GetBase().GetRepo().GetName()
 
+		var baseSHA string
+		if baseSHA, err = preMergeBaseSHA(ctx, loaded.Client, owner, repo, pr); err != nil {
+			return nil, config, errors.WithMessage(err, "Failed to find the policy in effect before the merge")
+		}
+		config, err = b.ConfigFetcher.ConfigForRef(ctx, loaded.Client, pr, baseSHA)
+	} else {
+		config, err = b.ConfigFetcher.ConfigForPR(ctx, loaded.Client, pr)
+	}
 	if err != nil {
-		data.Error = errors.WithMessage(err, fmt.Sprintf("Failed to fetch configuration at ref=%s", config.Ref))
-		return h.render(w, data)
+		return nil, config, errors.WithMessage(err, fmt.Sprintf("Failed to fetch configuration at ref=%s", config.Ref))
 	}
 
 	if config.Missing() {
-		data.Error = errors.New(config.Description())
-		return h.render(w, data)
+		return nil, config, errors.New(config.Description())
 	}
 
 	if config.Invalid() {
-		data.Error = errors.WithMessage(config.Error, config.Description())
-		return h.render(w, data)
+		return nil, config, errors.WithMessage(config.Error, config.Description())
 	}
 
 	evaluator, err := policy.ParsePolicy(config.Config)
 	if err != nil {
-		data.Error = errors.WithMessage(err, fmt.Sprintf("invalid policy at ref \"%s\"", config.Ref))
-		return h.render(w, data)
+		return nil, config, errors.WithMessage(err, fmt.Sprintf("invalid policy at ref \"%s\"", config.Ref))
+	}
+
+	evalCtx := b.pullEvaluationContext(ctx, loaded.PullContext)
+	result := evaluator.Evaluate(evalCtx, loaded.PullContext)
+	if result.Error == nil {
+		b.checkApprovalIntegrity(ctx, loaded.Client, loaded.PullContext.RepositoryOwner(), loaded.PullContext.RepositoryName(), &result)
 	}
+	return &result, config, nil
+}
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, owner, h.Installations, h.ClientCreator)
-	prctx := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, pr)
-	result := evaluator.Evaluate(ctx, prctx)
+// preMergeBaseSHA returns the commit of the base branch just before the pull
+// request merged. For a merge commit, this is its first parent. Squash and
+// rebase merges do not record the base in the new commits, so it is the base
+// commit GitHub recorded for the pull request when it merged. If neither is
+// available, it returns an error instead of guessing.
+func preMergeBaseSHA(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) (string, error) {
+	merge, _, err := client.Repositories.GetCommit(ctx, owner, repo, pr.GetMergeCommitSHA())
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get merge commit %s", pr.GetMergeCommitSHA())
+	}
+	if len(merge.Parents) > 1 {
+		return merge.Parents[0].GetSHA(), nil
+	}
 
-	data.Result = &result
-	return h.render(w, data)
+	if sha := pr.GetBase().GetSHA(); sha != "" {
+		return sha, nil
+	}
+	return "", errors.Errorf("failed to find the base of merge commit %s", pr.GetMergeCommitSHA())
 }
 
 func (h *Details) render(w http.ResponseWriter, data interface{}) error {
@@ -150,7 +398,7 @@ func (h *Details) render(w http.ResponseWriter, data interface{}) error {
 func getPolicyURL(pr *github.PullRequest, config FetchedConfig) string {
 	base := pr.GetBase().GetRepo().GetHTMLURL()
 	if u, _ := url.Parse(base); u != nil {
-		u.Path = path.Join(u.Path, "blob", pr.GetBase().GetRef(), config.Path)
+		u.Path = path.Join(u.Path, "blob", config.Ref, config.Path)
 		return u.String()
 	}
 	return base
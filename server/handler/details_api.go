@@ -0,0 +1,138 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/scs"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/policy"
+)
+
+// DetailsAPI evaluates a pull request and returns the information shown on
+// the details page as JSON, for dashboards and command line tools.
+type DetailsAPI struct {
+	Base
+	Sessions *scs.Manager
+}
+
+// DetailsReport is the JSON form of the details page. Fields are only added
+// to it, never renamed or removed.
+type DetailsReport struct {
+	PullRequest string `json:"pull_request"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	State       string `json:"state"`
+	Merged      bool   `json:"merged"`
+	BaseBranch  string `json:"base_branch"`
+	HeadSHA     string `json:"head_sha"`
+
+	// Status and Description are the overall policy status, like the commit
+	// status posted for the pull request.
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+
+	PolicyURL     string `json:"policy_url,omitempty"`
+	PolicyKey     string `json:"policy_key,omitempty"`
+	PolicyVersion string `json:"policy_version,omitempty"`
+
+	Error  string      `json:"error,omitempty"`
+	Result *ResultJSON `json:"result,omitempty"`
+
+	// EligibleApprovers maps the names of pending rules to the users who can
+	// approve them. RequestedReviewers lists users with a pending review
+	// request.
+	EligibleApprovers  map[string][]string `json:"eligible_approvers,omitempty"`
+	RequestedReviewers []string            `json:"requested_reviewers,omitempty"`
+}
+
+func (h *DetailsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	number, err := strconv.Atoi(pat.Param(r, "number"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
+		return nil
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	loaded, err := h.loadPullRequest(ctx, owner, repo, number, user)
+	if err != nil {
+		if isNotFoundError(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil
+		}
+		return err
+	}
+
+	pr := loaded.PullRequest
+	report := DetailsReport{
+		PullRequest: fmt.Sprintf("%s/%s#%d", owner, repo, number),
+		Title:       pr.GetTitle(),
+		URL:         pr.GetHTMLURL(),
+		State:       pr.GetState(),
+		Merged:      pr.GetMerged(),
+		BaseBranch:  pr.GetBase().GetRef(),
+		HeadSHA:     pr.GetHead().GetSHA(),
+		Status:      "error",
+	}
+	for _, u := range pr.RequestedReviewers {
+		report.RequestedReviewers = append(report.RequestedReviewers, u.GetLogin())
+	}
+
+	result, config, err := h.evaluatePullRequest(ctx, loaded)
+	report.PolicyVersion = config.Version
+	if config.Central {
+		report.PolicyKey = config.Path
+	} else {
+		report.PolicyURL = getPolicyURL(pr, config)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	if result != nil {
+		report.Result = NewResultJSON(result)
+		report.Status = report.Result.Status
+		report.Description = result.Description
+		if result.Error != nil {
+			report.Error = result.Error.Error()
+		} else {
+			approvers, err := policy.EligibleApprovers(h.evaluationContext(ctx, owner), loaded.PullContext, config.Config, result)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to compute eligible approvers")
+			}
+			report.EligibleApprovers = approvers
+		}
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &report)
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreMergeBaseSHA(t *testing.T) {
+	ctx := context.Background()
+
+	parents := map[string]string{
+		"merge":  `[{"sha": "base"}, {"sha": "head"}]`,
+		"squash": `[{"sha": "main"}]`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for sha, p := range parents {
+			if r.URL.Path == "/repos/testorg/testrepo/commits/"+sha {
+				fmt.Fprintf(w, `{"sha": %q, "parents": %s}`, sha, p)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	newPR := func(mergeSHA, baseSHA string) *github.PullRequest {
+		return &github.PullRequest{
+			Merged:         github.Bool(true),
+			MergeCommitSHA: github.String(mergeSHA),
+			Base:           &github.PullRequestBranch{SHA: github.String(baseSHA)},
+		}
+	}
+
+	t.Run("mergeCommit", func(t *testing.T) {
+		sha, err := preMergeBaseSHA(ctx, client, "testorg", "testrepo", newPR("merge", "outdated"))
+		require.NoError(t, err)
+		assert.Equal(t, "base", sha, "merge commits use their first parent")
+	})
+
+	t.Run("squashOrRebase", func(t *testing.T) {
+		sha, err := preMergeBaseSHA(ctx, client, "testorg", "testrepo", newPR("squash", "recorded"))
+		require.NoError(t, err)
+		assert.Equal(t, "recorded", sha, "squash and rebase merges use the recorded base")
+	})
+
+	t.Run("unknownBase", func(t *testing.T) {
+		_, err := preMergeBaseSHA(ctx, client, "testorg", "testrepo", newPR("squash", ""))
+		assert.EqualError(t, err, "failed to find the base of merge commit squash")
+	})
+
+	t.Run("missingCommit", func(t *testing.T) {
+		_, err := preMergeBaseSHA(ctx, client, "testorg", "testrepo", newPR("missing", "recorded"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultDirectoryStatusDepth = 1
+	DefaultMaxDirectoryStatuses = 50
+)
+
+// DirectoryStatusConfig configures a commit status for each directory that a
+// pull request changes, so that branch protection in a monorepo can require
+// only the statuses of the directories a team owns.
+type DirectoryStatusConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Depth is the number of path components that identify a directory. For
+	// example, with a depth of 2, changes to "services/payments/api/main.go"
+	// are reported by the "services/payments" status. If unset,
+	// DefaultDirectoryStatusDepth is used.
+	Depth int `yaml:"depth"`
+
+	// MaxStatuses limits the number of directory statuses posted for a pull
+	// request. Pull requests that change more directories only get the
+	// status for the whole policy. If unset, DefaultMaxDirectoryStatuses is
+	// used.
+	MaxStatuses int `yaml:"max_statuses"`
+}
+
+func (c *DirectoryStatusConfig) IsEnabled() bool {
+	return c.Enabled
+}
+
+// DirectoryStatusContext returns the context of the status for a directory.
+func (b *Base) DirectoryStatusContext(dir string) string {
+	return fmt.Sprintf("%s: %s", b.PullOpts().StatusCheckContext, dir)
+}
+
+// postDirectoryStatuses evaluates the policy for each directory the pull
+// request changes, considering only the changed files in the directory, and
+// posts a status with the result. Directories where all rules are skipped
+// report success, because the policy does not require anything for them.
+func (b *Base) postDirectoryStatuses(ctx context.Context, client *github.Client, pr *github.PullRequest, evaluator common.Evaluator, prctx pull.Context) error {
+	config := b.PullOpts().DirectoryStatuses
+	if !config.IsEnabled() {
+		return nil
+	}
+
+	logger := zerolog.Ctx(ctx)
+
+	files, err := prctx.ChangedFiles(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list changed files")
+	}
+
+	depth := config.Depth
+	if depth <= 0 {
+		depth = DefaultDirectoryStatusDepth
+	}
+	maxStatuses := config.MaxStatuses
+	if maxStatuses <= 0 {
+		maxStatuses = DefaultMaxDirectoryStatuses
+	}
+
+	dirs := policy.Directories(files, depth)
+	if len(dirs) > maxStatuses {
+		logger.Info().Msgf("Pull request changes %d directories, more than the limit of %d; not posting directory statuses", len(dirs), maxStatuses)
+		return nil
+	}
+
+	if b.runtimeFlags(ctx).ShadowMode {
+		logger.Info().Msgf("Shadow mode is enabled, not posting %d directory statuses", len(dirs))
+		return nil
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	sha := pr.GetHead().GetSHA()
+	detailsURL := b.DetailsURL(pr)
+
+	// cached rule results do not depend on the changed files, so directory
+	// evaluations do not use the rule cache
+	evalCtx := b.pullEvaluationContext(ctx, prctx)
+
+	for _, dir := range dirs {
+		result := evaluator.Evaluate(evalCtx, policy.ScopeToDirectory(prctx, dir))
+
+		state, description := "pending", result.Description
+		switch {
+		case result.Error != nil:
+			logger.Warn().Err(result.Error).Str("directory", dir).Msg("Error evaluating policy for directory")
+			state, description = "error", "Error evaluating policy for this directory"
+		case result.Status == common.StatusApproved:
+			state = "success"
+		case result.Status == common.StatusDisapproved:
+			state = "failure"
+		case result.Status == common.StatusSkipped:
+			state, description = "success", "No rules apply to changes in this directory"
+		}
+
+		status := &github.RepoStatus{
+			Context:     github.String(b.DirectoryStatusContext(dir)),
+			State:       &state,
+			Description: &description,
+			TargetURL:   &detailsURL,
+		}
+		if err := b.postGitHubRepoStatus(ctx, client, owner, repo, sha, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
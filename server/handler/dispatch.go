@@ -0,0 +1,291 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultDispatchEventType = "policy-bot"
+	DefaultDispatchTTL       = 30 * 24 * time.Hour
+
+	dispatchKeyPrefix = "dispatch/"
+
+	dispatchActionApprove = "approve"
+	dispatchActionVeto    = "veto"
+)
+
+// DispatchConfig configures approvals and vetoes sent by automated workflows
+// with repository_dispatch or workflow_dispatch events. Dispatch decisions
+// are disabled if Secret is empty.
+type DispatchConfig struct {
+	// Secret is the key used to sign dispatch payloads with HMAC-SHA256.
+	Secret string `yaml:"secret"`
+
+	// EventType is the event_type of repository_dispatch events that carry
+	// decisions. If unset, DefaultDispatchEventType is used.
+	EventType string `yaml:"event_type"`
+
+	// TTL is how long decisions are kept. If unset, DefaultDispatchTTL is
+	// used.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+func (c *DispatchConfig) IsEnabled() bool {
+	return c.Secret != ""
+}
+
+// dispatchPayload is the decision sent in the client_payload of a
+// repository_dispatch event or the inputs of a workflow_dispatch event.
+type dispatchPayload struct {
+	PullRequest dispatchNumber `json:"pull_request"`
+	Rule        string         `json:"rule"`
+	Action      string         `json:"action"`
+	SHA         string         `json:"sha"`
+	Signature   string         `json:"signature"`
+}
+
+// dispatchNumber is a number that may be encoded as a string, because all
+// workflow_dispatch inputs are strings.
+type dispatchNumber int
+
+func (n *dispatchNumber) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.Errorf("invalid number %s", data)
+	}
+	*n = dispatchNumber(v)
+	return nil
+}
+
+// signedMessage returns the message signed by the payload signature.
+func (p *dispatchPayload) signedMessage(owner, repo string) string {
+	return fmt.Sprintf("%s/%s#%d:%s:%s:%s", owner, repo, p.PullRequest, p.Rule, p.Action, p.SHA)
+}
+
+// verify returns an error if the payload is incomplete or its signature does
+// not match the secret.
+func (p *dispatchPayload) verify(owner, repo, secret string) error {
+	if p.PullRequest <= 0 || p.Rule == "" || p.SHA == "" {
+		return errors.New("payload must include pull_request, rule, and sha")
+	}
+	if p.Action != dispatchActionApprove && p.Action != dispatchActionVeto {
+		return errors.Errorf("invalid action %q, must be %q or %q", p.Action, dispatchActionApprove, dispatchActionVeto)
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(p.Signature, "sha256="))
+	if err != nil {
+		return errors.New("signature is not a hex string")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(p.signedMessage(owner, repo)))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// dispatchDecision is the latest decision for a rule and commit. Each
+// decision is stored under its own key, so concurrent decisions for other
+// rules of the same commit do not overwrite it.
+type dispatchDecision struct {
+	Rule      string    `json:"rule"`
+	Actor     string    `json:"actor"`
+	Veto      bool      `json:"veto"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func dispatchPrefix(owner, repo, sha string) string {
+	return fmt.Sprintf("%s%s/%s/%s/", dispatchKeyPrefix, owner, repo, sha)
+}
+
+// dispatchKey returns the key of the decision for a rule. Rule names can
+// contain any character, so the key uses a hash of the name.
+func dispatchKey(owner, repo, sha, rule string) string {
+	sum := sha256.Sum256([]byte(rule))
+	return dispatchPrefix(owner, repo, sha) + hex.EncodeToString(sum[:])
+}
+
+// withDispatchDecisions returns a context in which rules use the dispatch
+// decisions recorded for the head commit of the pull request. Failures are
+// logged and return the context unchanged.
+func (b *Base) withDispatchDecisions(ctx context.Context, prctx pull.Context) context.Context {
+	if b.Store == nil || !b.PullOpts().Dispatch.IsEnabled() {
+		return ctx
+	}
+
+	sha := prctx.HeadSHA()
+	decisions := make(map[string]*approval.DispatchDecision)
+
+	prefix := dispatchPrefix(prctx.RepositoryOwner(), prctx.RepositoryName(), sha)
+	err := b.Store.Scan(ctx, prefix, func(key string, value []byte) error {
+		var d dispatchDecision
+		if err := json.Unmarshal(value, &d); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msgf("Ignoring invalid dispatch decision %s", key)
+			return nil
+		}
+		decisions[d.Rule] = &approval.DispatchDecision{
+			Actor:     d.Actor,
+			Veto:      d.Veto,
+			SHA:       sha,
+			CreatedAt: d.CreatedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to load dispatch decisions")
+		return ctx
+	}
+	if len(decisions) == 0 {
+		return ctx
+	}
+	return approval.WithDispatchDecisions(ctx, decisions)
+}
+
+// saveDispatchDecision records the decision for a rule and commit, replacing
+// any earlier decision for the same rule and commit.
+func (b *Base) saveDispatchDecision(ctx context.Context, owner, repo, sha string, d dispatchDecision) error {
+	value, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode dispatch decision")
+	}
+
+	ttl := b.PullOpts().Dispatch.TTL
+	if ttl <= 0 {
+		ttl = DefaultDispatchTTL
+	}
+	if err := b.Store.Put(ctx, dispatchKey(owner, repo, sha, d.Rule), value, ttl); err != nil {
+		return errors.Wrap(err, "failed to save dispatch decision")
+	}
+	return nil
+}
+
+type Dispatch struct {
+	Base
+}
+
+func (h *Dispatch) Handles() []string { return []string{"repository_dispatch", "workflow_dispatch"} }
+
+// dispatchEvent contains the fields of the repository_dispatch and
+// workflow_dispatch events used for decisions. The vendored client does not
+// support these events.
+type dispatchEvent struct {
+	EventType     string             `json:"event_type"`
+	ClientPayload json.RawMessage    `json:"client_payload"`
+	Inputs        json.RawMessage    `json:"inputs"`
+	Repo          *github.Repository `json:"repository,omitempty"`
+	Sender        *github.User       `json:"sender,omitempty"`
+
+	Installation *github.Installation `json:"installation,omitempty"`
+}
+
+func (e *dispatchEvent) GetInstallation() *github.Installation {
+	return e.Installation
+}
+
+// Handle repository_dispatch and workflow_dispatch
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#repository_dispatch
+func (h *Dispatch) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	config := h.PullOpts().Dispatch
+	if h.Store == nil || !config.IsEnabled() {
+		return nil
+	}
+
+	var event dispatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrapf(err, "failed to parse %s event payload", eventType)
+	}
+
+	raw := event.Inputs
+	if eventType == "repository_dispatch" {
+		expected := config.EventType
+		if expected == "" {
+			expected = DefaultDispatchEventType
+		}
+		if event.EventType != expected {
+			return nil
+		}
+		raw = event.ClientPayload
+	}
+
+	// workflow_dispatch events for other workflows do not carry decisions
+	var decision dispatchPayload
+	if len(raw) == 0 || json.Unmarshal(raw, &decision) != nil || decision.Signature == "" {
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	owner := event.Repo.GetOwner().GetLogin()
+	repo := event.Repo.GetName()
+	ctx, logger := h.preparePRContext(ctx, installationID, event.Repo, int(decision.PullRequest))
+
+	if err := decision.verify(owner, repo, config.Secret); err != nil {
+		logger.Warn().Str(LogKeyAudit, eventType).Err(err).Msgf("Ignoring dispatch decision from %s", event.Sender.GetLogin())
+		return nil
+	}
+
+	err := h.saveDispatchDecision(ctx, owner, repo, decision.SHA, dispatchDecision{
+		Rule:      decision.Rule,
+		Actor:     event.Sender.GetLogin(),
+		Veto:      decision.Action == dispatchActionVeto,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info().Str(LogKeyAudit, eventType).Msgf("Recorded %s of rule %q by %s for %s", decision.Action, decision.Rule, event.Sender.GetLogin(), decision.SHA)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, int(decision.PullRequest))
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %d", decision.PullRequest)
+	}
+	if pr.GetHead().GetSHA() != decision.SHA {
+		logger.Debug().Msg("Dispatch decision is for an old head commit, not evaluating")
+		return nil
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, h.Installations, h.ClientCreator)
+	return h.Evaluate(ctx, mbrCtx, client, v4client, pr)
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/store"
+)
+
+func TestSaveDispatchDecision(t *testing.T) {
+	ctx := context.Background()
+
+	st := store.NewMemory()
+	b := Base{
+		Options: NewOptions(&PullEvaluationOptions{
+			Dispatch: DispatchConfig{Secret: "secret"},
+		}),
+		Store: st,
+	}
+
+	loadDecisions := func(t *testing.T) map[string]dispatchDecision {
+		decisions := make(map[string]dispatchDecision)
+		err := st.Scan(ctx, dispatchPrefix("testorg", "testrepo", "abc123"), func(key string, value []byte) error {
+			var d dispatchDecision
+			require.NoError(t, json.Unmarshal(value, &d))
+			decisions[d.Rule] = d
+			return nil
+		})
+		require.NoError(t, err)
+		return decisions
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d := dispatchDecision{Rule: fmt.Sprintf("rule-%d", i), Actor: "risk-bot", Veto: i%2 == 0, CreatedAt: time.Now()}
+			assert.NoError(t, b.saveDispatchDecision(ctx, "testorg", "testrepo", "abc123", d))
+		}(i)
+	}
+	wg.Wait()
+
+	decisions := loadDecisions(t)
+	require.Len(t, decisions, 10, "concurrent decisions were lost")
+	assert.True(t, decisions["rule-0"].Veto)
+	assert.False(t, decisions["rule-1"].Veto)
+
+	// a later decision replaces the earlier decision for the same rule
+	require.NoError(t, b.saveDispatchDecision(ctx, "testorg", "testrepo", "abc123", dispatchDecision{Rule: "rule-0", Actor: "risk-bot"}))
+
+	decisions = loadDecisions(t)
+	require.Len(t, decisions, 10)
+	assert.False(t, decisions["rule-0"].Veto)
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	DefaultEscalationInterval = 5 * time.Minute
+
+	disapprovalKeyPrefix = "disapproval/"
+)
+
+// EscalationConfig configures actions taken when a pull request stays
+// disapproved for too long. Escalation is disabled if After is zero.
+type EscalationConfig struct {
+	// After is how long a pull request must be disapproved before escalating.
+	After time.Duration `yaml:"after"`
+
+	// Interval is how often to check for pull requests to escalate. If unset,
+	// DefaultEscalationInterval is used.
+	Interval time.Duration `yaml:"interval"`
+
+	// Comment enables posting a comment on the pull request.
+	Comment bool `yaml:"comment"`
+
+	// SlackWebhookURL is a Slack incoming webhook that receives a message for
+	// each escalation.
+	SlackWebhookURL string `yaml:"slack_webhook_url"`
+
+	// TeamReviewers are the slugs of teams in the repository's organization
+	// that are requested to review escalated pull requests.
+	TeamReviewers []string `yaml:"team_reviewers"`
+}
+
+func (c *EscalationConfig) IsEnabled() bool {
+	return c.After > 0
+}
+
+type disapprovalRecord struct {
+	Owner     string    `json:"owner"`
+	Repo      string    `json:"repo"`
+	Number    int       `json:"number"`
+	Since     time.Time `json:"since"`
+	Escalated bool      `json:"escalated"`
+}
+
+func disapprovalKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%d", disapprovalKeyPrefix, owner, repo, number)
+}
+
+// trackDisapproval records when a pull request became disapproved and
+// forgets pull requests that are no longer disapproved.
+func (b *Base) trackDisapproval(ctx context.Context, pr *github.PullRequest, status common.EvaluationStatus) {
+	if b.Store == nil || !b.PullOpts().DisapprovalEscalation.IsEnabled() {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := disapprovalKey(owner, repo, pr.GetNumber())
+
+	if status != common.StatusDisapproved {
+		if err := b.Store.Delete(ctx, key); err != nil {
+			logger.Error().Err(err).Msg("Failed to clear disapproval record")
+		}
+		return
+	}
+
+	_, exists, err := b.Store.Get(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read disapproval record")
+		return
+	}
+	if exists {
+		return
+	}
+
+	record := disapprovalRecord{
+		Owner:  owner,
+		Repo:   repo,
+		Number: pr.GetNumber(),
+		Since:  time.Now(),
+	}
+	if err := b.putDisapproval(ctx, key, record); err != nil {
+		logger.Error().Err(err).Msg("Failed to save disapproval record")
+	}
+}
+
+func (b *Base) putDisapproval(ctx context.Context, key string, record disapprovalRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode disapproval record")
+	}
+	return b.Store.Put(ctx, key, value, 0)
+}
+
+// DisapprovalEscalator periodically escalates pull requests that have been
+// disapproved for longer than the configured duration.
+type DisapprovalEscalator struct {
+	Base
+	HTTPClient *http.Client
+}
+
+// Run checks for pull requests to escalate until the context is canceled.
+func (e *DisapprovalEscalator) Run(ctx context.Context) {
+	config := e.PullOpts().DisapprovalEscalation
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultEscalationInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.EscalateAll(ctx); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to escalate disapproved pull requests")
+			}
+		}
+	}
+}
+
+// EscalateAll escalates every tracked pull request that has been disapproved
+// for long enough and has not been escalated yet. It does nothing if
+// escalation was disabled by reloading the server configuration.
+func (e *DisapprovalEscalator) EscalateAll(ctx context.Context) error {
+	after := e.PullOpts().DisapprovalEscalation.After
+	if after <= 0 {
+		return nil
+	}
+
+	if e.runtimeFlags(ctx).MuteNotifications {
+		zerolog.Ctx(ctx).Debug().Msg("Notifications are muted, not escalating disapproved pull requests")
+		return nil
+	}
+
+	return e.Store.Scan(ctx, disapprovalKeyPrefix, func(key string, value []byte) error {
+		var record disapprovalRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("key", key).Msg("Ignoring invalid disapproval record")
+			return nil
+		}
+
+		if record.Escalated || time.Since(record.Since) < after {
+			return nil
+		}
+
+		logger := zerolog.Ctx(ctx).With().Str("pull_request", fmt.Sprintf("%s/%s#%d", record.Owner, record.Repo, record.Number)).Logger()
+		if err := e.escalate(logger.WithContext(ctx), key, record); err != nil {
+			logger.Error().Err(err).Msg("Failed to escalate disapproved pull request")
+		}
+		return nil
+	})
+}
+
+func (e *DisapprovalEscalator) escalate(ctx context.Context, key string, record disapprovalRecord) error {
+	config := e.PullOpts().DisapprovalEscalation
+
+	installation, err := e.Installations.GetByOwner(ctx, record.Owner)
+	if err != nil {
+		return err
+	}
+
+	client, err := e.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, record.Owner, record.Repo, record.Number)
+	if err != nil {
+		if isNotFound(err) {
+			return e.Store.Delete(ctx, key)
+		}
+		return errors.Wrap(err, "failed to get pull request")
+	}
+	if pr.GetState() != "open" {
+		return e.Store.Delete(ctx, key)
+	}
+
+	message := fmt.Sprintf("This pull request has been disapproved for %s. See the [policy details](%s).",
+		time.Since(record.Since).Round(time.Minute), e.DetailsURL(pr))
+
+	if len(config.TeamReviewers) > 0 {
+		req := github.ReviewersRequest{TeamReviewers: config.TeamReviewers}
+		if err := requestReviewers(ctx, client, record.Owner, record.Repo, record.Number, req); err != nil {
+			return errors.Wrap(err, "failed to request escalation team review")
+		}
+		message += fmt.Sprintf(" Requested review from %s.", strings.Join(config.TeamReviewers, ", "))
+	}
+
+	if config.Comment {
+		comment := &github.IssueComment{Body: &message}
+		if _, _, err := client.Issues.CreateComment(ctx, record.Owner, record.Repo, record.Number, comment); err != nil {
+			return errors.Wrap(err, "failed to create escalation comment")
+		}
+	}
+
+	if config.SlackWebhookURL != "" {
+		text := fmt.Sprintf("<%s|%s/%s#%d>: %s", pr.GetHTMLURL(), record.Owner, record.Repo, record.Number, message)
+		if err := postSlack(ctx, e.HTTPClient, config.SlackWebhookURL, text); err != nil {
+			return err
+		}
+	}
+
+	zerolog.Ctx(ctx).Info().Msg("Escalated disapproved pull request")
+
+	record.Escalated = true
+	return e.putDisapproval(ctx, key, record)
+}
+
+// postSlack sends a message to a Slack incoming webhook. If client is nil,
+// http.DefaultClient is used.
+func postSlack(ctx context.Context, client *http.Client, url, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode slack message")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create slack request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send slack message")
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("slack webhook returned status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/google/go-github/github"
@@ -26,6 +27,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policysync"
 )
 
 type FetchedConfig struct {
@@ -35,6 +37,18 @@ type FetchedConfig struct {
 	Path   string
 	Config *policy.Config
 	Error  error
+
+	// Version identifies the content of the policy. It is the blob SHA of a
+	// policy file or the version of a central policy bundle.
+	Version string
+
+	// Central is true if the policy came from the central configuration
+	// service. Path is then the bundle key that matched the repository.
+	Central bool
+
+	// Content is the source of the policy, used to show the lines that
+	// contain errors.
+	Content []byte
 }
 
 func (fc FetchedConfig) Missing() bool {
@@ -50,11 +64,18 @@ func (fc FetchedConfig) Invalid() bool {
 }
 
 func (fc FetchedConfig) String() string {
+	if fc.Central {
+		return fmt.Sprintf("central policy %q version=%s", fc.Path, fc.Version)
+	}
 	return fmt.Sprintf("%s/%s ref=%s", fc.Owner, fc.Repo, fc.Ref)
 }
 
 func (fc FetchedConfig) Description() string {
 	switch {
+	case fc.Central && fc.Invalid():
+		return fmt.Sprintf("Invalid central policy version=%s", fc.Version)
+	case fc.Central:
+		return fmt.Sprintf("Valid central policy version=%s", fc.Version)
 	case fc.Missing():
 		return fmt.Sprintf("No policy found at ref=%s", fc.Ref)
 	case fc.Invalid():
@@ -65,6 +86,62 @@ func (fc FetchedConfig) Description() string {
 
 type ConfigFetcher struct {
 	PolicyPath string
+
+	// BranchPolicyPaths overrides PolicyPath for pull requests with a base
+	// branch that matches a pattern. The first matching entry is used.
+	BranchPolicyPaths []BranchPolicyPath
+
+	// Central provides policies from a central configuration service. If it
+	// is nil, policies are read from repository files.
+	Central *policysync.Syncer
+}
+
+// BranchPolicyPath uses the policy at Path for pull requests with a base
+// branch matching the Branch regular expression. The expression is compiled
+// when the configuration is parsed, so invalid patterns are rejected at
+// startup instead of failing every evaluation.
+type BranchPolicyPath struct {
+	Branch string `yaml:"branch"`
+	Path   string `yaml:"path"`
+
+	pattern *regexp.Regexp
+}
+
+func (bp *BranchPolicyPath) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw struct {
+		Branch string `yaml:"branch"`
+		Path   string `yaml:"path"`
+	}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	pattern, err := regexp.Compile(raw.Branch)
+	if err != nil {
+		return errors.Wrapf(err, "invalid branch pattern %q", raw.Branch)
+	}
+	if raw.Path == "" {
+		return errors.Errorf("branch policy path for pattern %q must specify a path", raw.Branch)
+	}
+
+	*bp = BranchPolicyPath{Branch: raw.Branch, Path: raw.Path, pattern: pattern}
+	return nil
+}
+
+// Matches returns true if the branch matches the pattern.
+func (bp *BranchPolicyPath) Matches(branch string) bool {
+	return bp.pattern != nil && bp.pattern.MatchString(branch)
+}
+
+// PolicyPathForBranch returns the path to the policy file for pull requests
+// that target the given branch.
+func (cf *ConfigFetcher) PolicyPathForBranch(branch string) string {
+	for i := range cf.BranchPolicyPaths {
+		if cf.BranchPolicyPaths[i].Matches(branch) {
+			return cf.BranchPolicyPaths[i].Path
+		}
+	}
+	return cf.PolicyPath
 }
 
 // ConfigForPR fetches the policy configuration for a PR. It returns an error
@@ -72,21 +149,51 @@ type ConfigFetcher struct {
 // does not exist or is invalid, the returned error is nil and the appropriate
 // fields are set on the FetchedConfig.
 func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, client *github.Client, pr *github.PullRequest) (FetchedConfig, error) {
+	return cf.configForRef(ctx, client, pr, pr.GetBase().GetRef())
+}
+
+// ConfigForRef fetches the policy configuration for a PR at the given ref of
+// the target repository.
+func (cf *ConfigFetcher) ConfigForRef(ctx context.Context, client *github.Client, pr *github.PullRequest, ref string) (FetchedConfig, error) {
+	return cf.configForRef(ctx, client, pr, ref)
+}
+
+func (cf *ConfigFetcher) configForRef(ctx context.Context, client *github.Client, pr *github.PullRequest, ref string) (FetchedConfig, error) {
 	fc := FetchedConfig{
 		Owner: pr.GetBase().GetRepo().GetOwner().GetLogin(),
 		Repo:  pr.GetBase().GetRepo().GetName(),
-		Ref:   pr.GetBase().GetRef(),
-		Path:  cf.PolicyPath,
+		Ref:   ref,
 	}
 
-	configBytes, err := cf.fetchConfig(ctx, client, fc.Owner, fc.Repo, fc.Ref)
+	if cf.Central != nil {
+		if !cf.Central.Ready() {
+			return fc, errors.New("central policies have not been loaded")
+		}
+		if p, ok := cf.Central.Policy(fc.Owner, fc.Repo); ok {
+			fc.Central = true
+			fc.Path = p.Key
+			fc.Version = p.Version
+			fc.Content = p.Content
+			fc.Config, fc.Error = cf.unmarshalConfig(p.Content)
+			return fc, nil
+		}
+		if cf.Central.Authoritative() {
+			return fc, nil
+		}
+	}
+
+	fc.Path = cf.PolicyPathForBranch(pr.GetBase().GetRef())
+
+	configBytes, version, err := cf.fetchConfig(ctx, client, fc.Owner, fc.Repo, fc.Ref, fc.Path)
 	if err != nil {
 		return fc, err
 	}
+	fc.Version = version
 
 	if configBytes == nil {
 		return fc, nil
 	}
+	fc.Content = configBytes
 
 	config, err := cf.unmarshalConfig(configBytes)
 	if err != nil {
@@ -98,12 +205,14 @@ func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, client *github.Client,
 	return fc, nil
 }
 
-func (cf *ConfigFetcher) fetchConfig(ctx context.Context, client *github.Client, owner, repo, ref string) ([]byte, error) {
+// fetchConfig returns the policy for a repository, following references to
+// remote policies, and the blob SHA of the file that contains it.
+func (cf *ConfigFetcher) fetchConfig(ctx context.Context, client *github.Client, owner, repo, ref, path string) ([]byte, string, error) {
 	logger := zerolog.Ctx(ctx)
 
-	configBytes, err := cf.fetchConfigContents(ctx, client, owner, repo, ref, cf.PolicyPath)
+	configBytes, sha, err := cf.fetchConfigContents(ctx, client, owner, repo, ref, path)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var rawConfig map[string]interface{}
@@ -111,36 +220,31 @@ func (cf *ConfigFetcher) fetchConfig(ctx context.Context, client *github.Client,
 
 	if _, isRemote := rawConfig["remote"]; !isRemote {
 		logger.Debug().Msgf("Found local policy config in %s/%s@%s", owner, repo, ref)
-		return configBytes, nil
+		return configBytes, sha, nil
 	}
 	logger.Debug().Msgf("Found reference to remote policy in %s/%s@%s", owner, repo, ref)
 
 	var remoteConfig policy.RemoteConfig
 	if err := yaml.UnmarshalStrict(configBytes, &remoteConfig); err != nil {
-		return nil, errors.Wrap(err, "failed to unmarshal reference to remote policy")
+		return nil, "", errors.Wrap(err, "failed to unmarshal reference to remote policy")
 	}
 
 	if remoteConfig.Path == "" {
-		remoteConfig.Path = cf.PolicyPath
+		remoteConfig.Path = path
 	}
 
 	remoteParts := strings.Split(remoteConfig.Remote, "/")
 	if len(remoteParts) != 2 {
-		return nil, errors.Errorf("failed to parse remote config location from %q", remoteConfig.Remote)
+		return nil, "", errors.Errorf("failed to parse remote config location from %q", remoteConfig.Remote)
 	}
 
 	remoteOwner, remoteRepo := remoteParts[0], remoteParts[1]
 
-	remotePolicyBytes, err := cf.fetchConfigContents(ctx, client, remoteOwner, remoteRepo, remoteConfig.Ref, remoteConfig.Path)
-	if err != nil {
-		return nil, err
-	}
-
-	return remotePolicyBytes, nil
+	return cf.fetchConfigContents(ctx, client, remoteOwner, remoteRepo, remoteConfig.Ref, remoteConfig.Path)
 }
 
 // fetchConfigContents returns a nil slice if there is no policy
-func (cf *ConfigFetcher) fetchConfigContents(ctx context.Context, client *github.Client, owner, repo, ref, path string) ([]byte, error) {
+func (cf *ConfigFetcher) fetchConfigContents(ctx context.Context, client *github.Client, owner, repo, ref, path string) ([]byte, string, error) {
 	logger := zerolog.Ctx(ctx)
 	logger.Debug().Msgf("attempting to fetch policy definition for %s/%s@%s/%s", owner, repo, ref, path)
 
@@ -151,22 +255,22 @@ func (cf *ConfigFetcher) fetchConfigContents(ctx context.Context, client *github
 	file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, path, opts)
 	if err != nil {
 		if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
-			return nil, nil
+			return nil, "", nil
 		}
-		return nil, errors.Wrapf(err, "failed to fetch content of %s/%s@%s/%s", owner, repo, ref, path)
+		return nil, "", errors.Wrapf(err, "failed to fetch content of %s/%s@%s/%s", owner, repo, ref, path)
 	}
 
 	// file will be nil if the ref contains a directory at the expected file path
 	if file == nil {
-		return nil, nil
+		return nil, "", nil
 	}
 
 	content, err := file.GetContent()
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to decode content of %s/%s@%s/%s", owner, repo, ref, path)
+		return nil, "", errors.Wrapf(err, "failed to decode content of %s/%s@%s/%s", owner, repo, ref, path)
 	}
 
-	return []byte(content), nil
+	return []byte(content), file.GetSHA(), nil
 }
 
 func (cf *ConfigFetcher) unmarshalConfig(bytes []byte) (*policy.Config, error) {
@@ -0,0 +1,54 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBranchPolicyPaths(t *testing.T) {
+	var opts PullEvaluationOptions
+	err := yaml.UnmarshalStrict([]byte(`
+policy_path: .policy.yml
+branch_policy_paths:
+  - branch: "^release/.*$"
+    path: .policy.release.yml
+  - branch: "^(main|develop)$"
+    path: .policy.main.yml
+`), &opts)
+	require.NoError(t, err)
+
+	cf := &ConfigFetcher{PolicyPath: opts.PolicyPath, BranchPolicyPaths: opts.BranchPolicyPaths}
+	assert.Equal(t, ".policy.release.yml", cf.PolicyPathForBranch("release/1.0"))
+	assert.Equal(t, ".policy.main.yml", cf.PolicyPathForBranch("develop"))
+	assert.Equal(t, ".policy.yml", cf.PolicyPathForBranch("feature/release/1.0"))
+
+	err = yaml.UnmarshalStrict([]byte(`
+branch_policy_paths:
+  - branch: "^release/(.*$"
+    path: .policy.release.yml
+`), &opts)
+	assert.EqualError(t, err, "invalid branch pattern \"^release/(.*$\": error parsing regexp: missing closing ): `^release/(.*$`")
+
+	err = yaml.UnmarshalStrict([]byte(`
+branch_policy_paths:
+  - branch: "^release/.*$"
+`), &opts)
+	assert.EqualError(t, err, "branch policy path for pattern \"^release/.*$\" must specify a path")
+}
@@ -16,10 +16,14 @@ package handler
 
 import (
 	"html/template"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/bluekeyes/templatetree"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -30,11 +34,33 @@ const (
 type FilesConfig struct {
 	Static    string `yaml:"static"`
 	Templates string `yaml:"templates"`
+
+	// TemplateOverrides is a directory of templates that replace the
+	// templates with the same name in Templates. Overrides may extend the
+	// default templates and may add new templates.
+	TemplateOverrides string `yaml:"template_overrides"`
+
+	// Messages is a directory of message catalogs named "<locale>.yml" and
+	// Locale selects the catalog used by the templates.
+	Messages string `yaml:"messages"`
+	Locale   string `yaml:"locale"`
 }
 
 func LoadTemplates(c *FilesConfig) (templatetree.HTMLTree, error) {
+	messages, err := LoadMessages(c)
+	if err != nil {
+		return nil, err
+	}
+
+	locale := c.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
 	root := template.New("root").Funcs(template.FuncMap{
 		"titlecase": strings.Title,
+		"t":         messages.Format,
+		"locale":    func() string { return locale },
 	})
 
 	dir := c.Templates
@@ -42,9 +68,52 @@ func LoadTemplates(c *FilesConfig) (templatetree.HTMLTree, error) {
 		dir = DefaultTemplatesDir
 	}
 
+	if c.TemplateOverrides != "" {
+		merged, err := ioutil.TempDir("", "policy-bot-templates")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create template directory")
+		}
+		defer func() {
+			_ = os.RemoveAll(merged)
+		}()
+
+		// templatetree loads a single directory, so copy the overrides over
+		// a copy of the defaults to resolve inheritance across both
+		for _, src := range []string{dir, c.TemplateOverrides} {
+			if err := copyTemplates(src, merged); err != nil {
+				return nil, err
+			}
+		}
+		dir = merged
+	}
+
 	return templatetree.LoadHTML(dir, "*.html.tmpl", root)
 }
 
+func copyTemplates(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "failed to read templates in %s", src)
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read template %s", path)
+		}
+		return errors.Wrapf(ioutil.WriteFile(target, b, 0644), "failed to copy template %s", path)
+	})
+}
+
 func Static(prefix string, c *FilesConfig) http.Handler {
 	dir := c.Static
 	if dir == "" {
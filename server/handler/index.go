@@ -38,10 +38,10 @@ func (h *Index) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		PolicyPath string
 	}
 
-	data.AppName = h.PullOpts.AppName
+	data.AppName = h.PullOpts().AppName
 	data.Version = version.GetVersion()
 	data.GitHubURL = h.GithubConfig.WebURL
-	data.PolicyPath = h.PullOpts.PolicyPath
+	data.PolicyPath = h.PullOpts().PolicyPath
 
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
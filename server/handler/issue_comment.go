@@ -46,7 +46,7 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 	number := event.GetIssue().GetNumber()
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
 
-	ctx, logger := githubapp.PreparePRContext(ctx, installationID, event.GetRepo(), number)
+	ctx, logger := h.preparePRContext(ctx, installationID, event.GetRepo(), number)
 
 	if !event.GetIssue().IsPullRequest() {
 		logger.Debug().Msg("Issue comment event is not for a pull request")
@@ -84,7 +84,23 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 		logger.Warn().Str(LogKeyAudit, "issue_comment").Msg("Skipped tampering check because the policy is not valid")
 	}
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, repo.GetOwner().GetLogin(), h.Installations, h.ClientCreator)
+	mbrCtx := NewCrossOrgMembershipContext(client, repo.GetOwner().GetLogin(), h.Installations, h.ClientCreator)
+
+	if event.GetAction() == "created" && IsPolicyCommand(event.GetComment().GetBody()) {
+		logger.Info().Msgf("Handling %s command from %s", PolicyCommand, event.GetSender().GetLogin())
+
+		eval, err := h.evaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
+		if err != nil {
+			return err
+		}
+		return h.PostEvaluationComment(ctx, client, pr, eval)
+	}
+
+	if fetchedConfig.Valid() && !fetchedConfig.Config.TriggeredBy(approval.TriggerComments) {
+		logger.Debug().Msgf("Skipping evaluation because no rules depend on %s", approval.TriggerComments)
+		return nil
+	}
+
 	return h.EvaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
 }
 
@@ -109,7 +125,7 @@ func (h *IssueComment) detectAndLogTampering(ctx context.Context, client *github
 		return false, nil
 	}
 
-	if h.affectsApproval(originalBody, config.ApprovalRules) {
+	if h.affectsApproval(h.evaluationContext(ctx, pr.GetBase().GetRepo().GetOwner().GetLogin()), originalBody, config.ApprovalRules) {
 		msg := fmt.Sprintf("Entity %s edited approval comment by %s", eventAuthor, commentAuthor)
 		logger.Warn().Str(LogKeyAudit, "issue_comment").Msg(msg)
 
@@ -121,9 +137,9 @@ func (h *IssueComment) detectAndLogTampering(ctx context.Context, client *github
 	return true, nil
 }
 
-func (h *IssueComment) affectsApproval(actualComment string, rules []*approval.Rule) bool {
+func (h *IssueComment) affectsApproval(ctx context.Context, actualComment string, rules []*approval.Rule) bool {
 	for _, rule := range rules {
-		if rule.Options.GetMethods().CommentMatches(actualComment) {
+		if rule.Options.GetMethods(ctx).CommentMatches(actualComment) {
 			return true
 		}
 	}
@@ -0,0 +1,60 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+// LevelWriter discards log messages below a level that can change while the
+// server runs. Loggers keep their level when they are copied into contexts,
+// so the server logs all levels and filters messages here instead.
+type LevelWriter struct {
+	out   io.Writer
+	level int32
+}
+
+func NewLevelWriter(out io.Writer, level zerolog.Level) *LevelWriter {
+	w := &LevelWriter{out: out}
+	w.SetLevel(level)
+	return w
+}
+
+func (w *LevelWriter) Level() zerolog.Level {
+	return zerolog.Level(atomic.LoadInt32(&w.level))
+}
+
+func (w *LevelWriter) SetLevel(level zerolog.Level) {
+	atomic.StoreInt32(&w.level, int32(level))
+}
+
+// Unfiltered returns the writer that receives messages of all levels.
+func (w *LevelWriter) Unfiltered() io.Writer {
+	return w.out
+}
+
+func (w *LevelWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+func (w *LevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < w.Level() {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
@@ -16,34 +16,30 @@ package handler
 
 import (
 	"net/http"
-	"net/url"
-	"strings"
+	"time"
 
 	"github.com/alexedwards/scs"
 	"github.com/bluekeyes/hatpear"
-	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/go-githubapp/oauth2"
 	"github.com/pkg/errors"
 )
 
 const (
-	SessionKeyUsername = "username"
-	SessionKeyRedirect = "redirect"
+	SessionKeyUsername    = "username"
+	SessionKeyToken       = "token"
+	SessionKeyTokenExpiry = "token_expiry"
+	SessionKeyRedirect    = "redirect"
+	SessionKeyCSRFToken   = "csrf_token"
 )
 
 func Login(c githubapp.Config, sessions *scs.Manager) oauth2.LoginCallback {
 	return func(w http.ResponseWriter, r *http.Request, login *oauth2.Login) {
-		client := github.NewClient(login.Client)
-
-		// TODO(bkeyes): this should be in baseapp or something
-		// I should be able to get a valid, parsed URL
-		u, err := url.Parse(strings.TrimSuffix(c.V3APIURL, "/") + "/")
+		client, err := newUserClient(c, login.Client)
 		if err != nil {
-			hatpear.Store(r, errors.Wrap(err, "failed to parse github url"))
+			hatpear.Store(r, err)
 			return
 		}
-		client.BaseURL = u
 
 		user, _, err := client.Users.Get(r.Context(), "")
 		if err != nil {
@@ -51,11 +47,30 @@ func Login(c githubapp.Config, sessions *scs.Manager) oauth2.LoginCallback {
 			return
 		}
 
+		// GitHub App user tokens expire and only grant access to the
+		// repositories of the app installations, so keep the token to check
+		// what the user can see and when they must log in again
 		sess := sessions.Load(r)
 		if err := sess.PutString(w, SessionKeyUsername, user.GetLogin()); err != nil {
 			hatpear.Store(r, errors.Wrap(err, "failed to save session"))
 			return
 		}
+		if err := sess.PutString(w, SessionKeyToken, login.Token.AccessToken); err != nil {
+			hatpear.Store(r, errors.Wrap(err, "failed to save session"))
+			return
+		}
+		if err := sess.PutTime(w, SessionKeyTokenExpiry, login.Token.Expiry); err != nil {
+			hatpear.Store(r, errors.Wrap(err, "failed to save session"))
+			return
+		}
+		if err := sess.Remove(w, SessionKeyGroups); err != nil {
+			hatpear.Store(r, errors.Wrap(err, "failed to save session"))
+			return
+		}
+		if err := sess.Remove(w, SessionKeySSO); err != nil {
+			hatpear.Store(r, errors.Wrap(err, "failed to save session"))
+			return
+		}
 
 		// go to root or back to the previous page
 		target, err := sess.GetString(SessionKeyRedirect)
@@ -68,9 +83,29 @@ func Login(c githubapp.Config, sessions *scs.Manager) oauth2.LoginCallback {
 	}
 }
 
-func RequireLogin(sessions *scs.Manager) func(http.Handler) http.Handler {
+// RequireLogin requires requests to come from a logged in user. Users log in
+// with the OAuth flow or by sending a personal access token, fine-grained
+// personal access token, or GitHub App user token in the Authorization
+// header. Sessions with an expired token must log in again. If single
+// sign-on is enabled, users without a session log in with the identity
+// provider instead of GitHub.
+func RequireLogin(c githubapp.Config, sessions *scs.Manager, sso *SSOConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := authorizationToken(r); ok {
+				auth, err := authenticateToken(r.Context(), c, token)
+				if err != nil {
+					hatpear.Store(r, err)
+					return
+				}
+				if auth == nil {
+					http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withUserAuth(r.Context(), auth)))
+				return
+			}
+
 			sess := sessions.Load(r)
 
 			user, err := sess.GetString(SessionKeyUsername)
@@ -79,17 +114,55 @@ func RequireLogin(sessions *scs.Manager) func(http.Handler) http.Handler {
 				return
 			}
 
+			expiry, err := sess.GetTime(SessionKeyTokenExpiry)
+			if err != nil {
+				hatpear.Store(r, errors.Wrap(err, "failed to read session"))
+				return
+			}
+			if !expiry.IsZero() && time.Now().After(expiry) {
+				user = ""
+			}
+
 			if user == "" {
 				if err := sess.PutString(w, SessionKeyRedirect, r.URL.String()); err != nil {
 					hatpear.Store(r, errors.Wrap(err, "failed to save session"))
 					return
 				}
 
-				http.Redirect(w, r, oauth2.DefaultRoute, http.StatusFound)
+				loginRoute := oauth2.DefaultRoute
+				if sso.IsEnabled() {
+					loginRoute = SSOLoginRoute
+				}
+				http.Redirect(w, r, loginRoute, http.StatusFound)
+				return
+			}
+
+			token, err := sess.GetString(SessionKeyToken)
+			if err != nil {
+				hatpear.Store(r, errors.Wrap(err, "failed to read session"))
+				return
+			}
+
+			groups, err := sessionGroups(sess)
+			if err != nil {
+				hatpear.Store(r, errors.Wrap(err, "failed to read session"))
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			sso, err := sessionSSO(sess)
+			if err != nil {
+				hatpear.Store(r, errors.Wrap(err, "failed to read session"))
+				return
+			}
+
+			auth := &userAuth{Login: user, Token: token, Groups: groups, SSO: sso}
+			if token != "" {
+				if auth.Client, err = newTokenClient(r.Context(), c, token); err != nil {
+					hatpear.Store(r, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(withUserAuth(r.Context(), auth)))
 		})
 	}
 }
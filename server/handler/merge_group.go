@@ -0,0 +1,133 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// mergeGroupRefPattern matches the head branch of a merge group, which ends
+// with the number of the last pull request in the group.
+var mergeGroupRefPattern = regexp.MustCompile(`/gh-readonly-queue/.+/pr-(\d+)-[0-9a-f]+$`)
+
+type MergeGroup struct {
+	Base
+}
+
+func (h *MergeGroup) Handles() []string { return []string{"merge_group"} }
+
+// mergeGroupEvent contains the fields of the merge group event used for
+// evaluation. The vendored client does not support this event.
+type mergeGroupEvent struct {
+	Action     string `json:"action"`
+	MergeGroup struct {
+		HeadSHA string `json:"head_sha"`
+		HeadRef string `json:"head_ref"`
+	} `json:"merge_group"`
+	Repo         *github.Repository   `json:"repository,omitempty"`
+	Installation *github.Installation `json:"installation,omitempty"`
+}
+
+func (e *mergeGroupEvent) GetInstallation() *github.Installation {
+	return e.Installation
+}
+
+// Handle merge_group
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#merge_group
+//
+// Each merge group contains the changes of the group ahead of it in the queue
+// and one more pull request, so the policy of that pull request decides the
+// status of the group. The status is posted on the head commit of the group
+// with the same context as the pull request status, so the same required
+// status check applies to pull requests and the merge queue.
+func (h *MergeGroup) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event mergeGroupEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse merge group event payload")
+	}
+
+	if event.Action != "checks_requested" {
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+
+	m := mergeGroupRefPattern.FindStringSubmatch(event.MergeGroup.HeadRef)
+	if m == nil {
+		_, logger := h.prepareRepoContext(ctx, installationID, event.Repo)
+		logger.Warn().Msgf("Ignoring merge group with unexpected head ref %s", event.MergeGroup.HeadRef)
+		return nil
+	}
+	number, err := strconv.Atoi(m[1])
+	if err != nil {
+		return errors.Wrapf(err, "invalid pull request number in merge group ref %s", event.MergeGroup.HeadRef)
+	}
+
+	ctx, logger := h.preparePRContext(ctx, installationID, event.Repo, number)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	owner := event.Repo.GetOwner().GetLogin()
+	repo := event.Repo.GetName()
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %d of merge group", number)
+	}
+
+	fetchedConfig, err := h.ConfigFetcher.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, h.Installations, h.ClientCreator)
+	eval, err := h.evaluateFetchedConfig(ctx, mbrCtx, client, v4client, pr, fetchedConfig)
+	if err != nil {
+		return err
+	}
+	if eval.State == "" {
+		logger.Debug().Msgf("No status for merge group: %s", eval.Description)
+		return nil
+	}
+
+	return h.postMergeGroupStatus(ctx, client, pr, event.MergeGroup.HeadSHA, eval.State, eval.Description)
+}
+
+// postMergeGroupStatus posts the policy status of a pull request on the head
+// commit of a merge group that contains it.
+func (b *Base) postMergeGroupStatus(ctx context.Context, client *github.Client, pr *github.PullRequest, sha, state, message string) error {
+	if b.runtimeFlags(ctx).ShadowMode {
+		zerolog.Ctx(ctx).Info().Msgf("Shadow mode is enabled, not posting merge group status %s: %s", state, message)
+		return nil
+	}
+	return b.postCommitStatus(ctx, client, pr, sha, state, message)
+}
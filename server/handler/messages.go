@@ -0,0 +1,175 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DefaultLocale = "en"
+)
+
+// defaultMessages is the English message catalog. Catalogs for other locales
+// only need to define the messages they translate.
+var defaultMessages = Messages{
+	"page.title": "PolicyBot",
+
+	"index.tagline":         "Enforce approval and disapproval policies on pull requests",
+	"index.install":         "Install",
+	"index.getting_started": "Getting Started",
+	"index.install_app":     "Install %s on your repository",
+	"index.add_policy":      "Add a %s file on the default branch",
+	"index.docs":            "docs",
+	"index.open_pr":         "Open a pull request and watch the status change based on the policy!",
+	"index.learn_more":      "Learn More",
+	"index.documentation":   "Documentation",
+
+	"details.title":             "Details",
+	"details.view_policy":       "View the policy definition on GitHub",
+	"details.policy_version":    "version %s",
+	"details.central_policy":    "Central policy",
+	"details.view_pull_request": "View the pull request on GitHub",
+	"details.merged":            "This pull request is merged. It was evaluated as of its merge on %s using the policy at the merge commit.",
+	"details.error":             "Error",
+	"details.status":            "Status: %s",
+	"details.requires":          "Requires:",
+	"details.environments":      "Environments:",
+	"details.unapproved":        "waiting for approval",
+	"details.advisory":          "Advisory",
+	"details.advisory_title":    "This rule does not affect the status of the policy",
+	"details.warning":           "Warning: %s",
+	"details.approved_commits":  "Approved commits:",
+	"details.approvers":         "Who can unblock this:",
+	"details.requested":         "Requested",
+	"details.request":           "Request",
+	"details.request_title":     "Request a review from %s",
+	"details.more_approvers":    "and %d more",
+	"details.debug":             "Debug logging:",
+	"details.debug_until":       "enabled until %s",
+	"details.debug_off":         "off",
+	"details.debug_pull":        "This pull request",
+	"details.debug_repository":  "This repository",
+	"details.debug_enable":      "Enable",
+	"details.debug_disable":     "Disable",
+	"details.timeline":          "Timeline",
+	"details.timeline_initial":  "new",
+	"details.timeline_event":    "after %s",
+	"details.timeline_approved": "Approved by:",
+	"details.timeline_invalid":  "Approval invalidated:",
+	"details.timeline_dismiss":  "Review dismissed:",
+
+	"admin.title":              "Admin",
+	"admin.flags":              "Runtime Flags",
+	"admin.shadow_mode":        "Shadow mode: evaluate pull requests without posting statuses",
+	"admin.mute_notifications": "Mute notifications: stop approval acknowledgments and escalations",
+	"admin.save":               "Save",
+	"admin.caches":             "Caches",
+	"admin.caches_help":        "Discard cached on-call, audit log, and external check results and fetch central policies again.",
+	"admin.flush":              "Flush caches",
+	"admin.integrations":       "Integrations",
+	"admin.no_integrations":    "No optional integrations are enabled.",
+	"admin.rate_limits":        "Rate Limits",
+	"admin.installation":       "Installation",
+	"admin.remaining":          "Remaining",
+	"admin.reset":              "Resets",
+	"admin.token_expiry":       "Token expires",
+	"admin.configuration":      "Configuration",
+	"admin.reload":             "Reload configuration",
+	"admin.reload_help":        "Read the server configuration file again and apply changes that do not require a restart.",
+	"admin.deliveries":         "Webhook Deliveries",
+	"admin.deliveries_help":    "Process a recorded delivery again, bypassing duplicate detection.",
+	"admin.delivery_id":        "Delivery ID",
+	"admin.replay":             "Replay",
+
+	"slack_link.title":   "Link Slack Account",
+	"slack_link.confirm": "Link Slack user %s in workspace %s to GitHub user %s?",
+	"slack_link.help":    "Slack approvals by the linked Slack user count as approvals by the GitHub user. Only continue if you clicked a button in Slack to get this link.",
+	"slack_link.link":    "Link accounts",
+
+	"status.approved":    "Approved",
+	"status.disapproved": "Disapproved",
+	"status.pending":     "Pending",
+	"status.skipped":     "Skipped",
+	"status.error":       "Error",
+}
+
+// Messages maps message keys to text in one locale. Messages may contain
+// fmt verbs that are replaced by the arguments given in templates.
+type Messages map[string]string
+
+// Format returns the message for key with the arguments applied. Unknown
+// keys are returned unchanged so that missing translations are visible.
+func (m Messages) Format(key string, args ...interface{}) string {
+	msg, ok := m[key]
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// LoadMessages returns the message catalog for the configured locale. The
+// catalog for a locale is the file "<locale>.yml" in the messages directory,
+// merged over the default English messages. The default locale does not
+// require a catalog file, but one may be provided to change the default
+// text.
+func LoadMessages(c *FilesConfig) (Messages, error) {
+	locale := c.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	messages := make(Messages, len(defaultMessages))
+	for k, v := range defaultMessages {
+		messages[k] = v
+	}
+
+	if c.Messages == "" {
+		if locale != DefaultLocale {
+			return nil, errors.Errorf("locale %q requires a messages directory", locale)
+		}
+		return messages, nil
+	}
+
+	path := filepath.Join(c.Messages, locale+".yml")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && locale == DefaultLocale {
+			return messages, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read messages for locale %q", locale)
+	}
+
+	var catalog Messages
+	if err := yaml.UnmarshalStrict(b, &catalog); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse messages in %s", path)
+	}
+	for k, v := range catalog {
+		if _, ok := defaultMessages[k]; !ok {
+			return nil, errors.Errorf("unknown message %q in %s", k, path)
+		}
+		messages[k] = v
+	}
+	return messages, nil
+}
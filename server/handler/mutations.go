@@ -0,0 +1,110 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// mutationAttempts is the maximum number of times to try a GitHub
+	// mutation that fails with a transient error.
+	mutationAttempts = 3
+
+	// mutationBackoff is the delay before the first retry of a mutation. The
+	// delay increases linearly with each attempt.
+	mutationBackoff = 500 * time.Millisecond
+
+	// mutationMaxDelay is the longest time to wait before retrying a
+	// mutation. Mutations that GitHub asks to delay for longer fail instead
+	// of holding up the event.
+	mutationMaxDelay = 10 * time.Second
+)
+
+// retryMutation calls fn until it succeeds, fails with an error that is not
+// transient, or has been attempted mutationAttempts times. It returns the
+// last error. Because fn may be called more than once for a single change,
+// it must be idempotent. Statuses and review requests are: posting a status
+// again replaces the previous status with the same context and requesting
+// reviewers again adds them to the existing requests.
+func retryMutation(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == mutationAttempts {
+			return err
+		}
+
+		delay, ok := retryDelay(err, attempt)
+		if !ok {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay returns how long to wait before repeating a mutation that
+// failed with err on the given attempt, or false if the error is not
+// transient. Server errors, secondary rate limits, and network errors are
+// transient; other client errors, like validation failures or missing
+// resources, fail the same way every time. Secondary rate limits wait for
+// the time GitHub asks for and primary rate limits wait until the limit
+// resets, unless that takes longer than mutationMaxDelay.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	backoff := time.Duration(attempt) * mutationBackoff
+
+	switch err := errors.Cause(err).(type) {
+	case *github.AbuseRateLimitError:
+		if err.RetryAfter != nil {
+			return *err.RetryAfter, *err.RetryAfter <= mutationMaxDelay
+		}
+		return backoff, true
+	case *github.RateLimitError:
+		delay := time.Until(err.Rate.Reset.Time)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, delay <= mutationMaxDelay
+	case *github.ErrorResponse:
+		return backoff, err.Response != nil && err.Response.StatusCode >= 500
+	case *url.Error:
+		if err.Err == context.Canceled || err.Err == context.DeadlineExceeded {
+			return 0, false
+		}
+		return backoff, true
+	case net.Error:
+		return backoff, true
+	}
+	return 0, false
+}
+
+// requestReviewers requests reviews on a pull request, retrying transient
+// failures. All users and teams are requested in a single call.
+func requestReviewers(ctx context.Context, client *github.Client, owner, repo string, number int, req github.ReviewersRequest) error {
+	return retryMutation(ctx, func() error {
+		_, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, number, req)
+		return err
+	})
+}
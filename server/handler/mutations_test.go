@@ -0,0 +1,142 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func statusError(code int) error {
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: code}}
+}
+
+func TestRetryDelay(t *testing.T) {
+	retryAfter := 2 * time.Second
+	longRetryAfter := time.Minute
+
+	tests := map[string]struct {
+		Err   error
+		Delay time.Duration
+		Retry bool
+	}{
+		"serverError": {
+			Err:   statusError(http.StatusBadGateway),
+			Delay: mutationBackoff,
+			Retry: true,
+		},
+		"wrappedServerError": {
+			Err:   errors.Wrap(statusError(http.StatusInternalServerError), "failed to post status"),
+			Delay: mutationBackoff,
+			Retry: true,
+		},
+		"validationError": {
+			Err: statusError(http.StatusUnprocessableEntity),
+		},
+		"notFound": {
+			Err: statusError(http.StatusNotFound),
+		},
+		"secondaryRateLimit": {
+			Err:   &github.AbuseRateLimitError{},
+			Delay: mutationBackoff,
+			Retry: true,
+		},
+		"secondaryRateLimitRetryAfter": {
+			Err:   &github.AbuseRateLimitError{RetryAfter: &retryAfter},
+			Delay: retryAfter,
+			Retry: true,
+		},
+		"secondaryRateLimitLongRetryAfter": {
+			Err:   &github.AbuseRateLimitError{RetryAfter: &longRetryAfter},
+			Delay: longRetryAfter,
+		},
+		"primaryRateLimitReset": {
+			Err:   &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(-time.Second)}}},
+			Retry: true,
+		},
+		"primaryRateLimitLater": {
+			Err: &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}},
+		},
+		"networkError": {
+			Err:   &url.Error{Op: "Post", URL: "https://api.github.com", Err: errors.New("connection reset by peer")},
+			Delay: mutationBackoff,
+			Retry: true,
+		},
+		"canceled": {
+			Err: &url.Error{Op: "Post", URL: "https://api.github.com", Err: context.Canceled},
+		},
+		"otherError": {
+			Err: errors.New("failed to encode request"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			delay, retry := retryDelay(test.Err, 1)
+			assert.Equal(t, test.Retry, retry)
+			if test.Delay > 0 {
+				assert.Equal(t, test.Delay, delay)
+			}
+		})
+	}
+
+	delay, _ := retryDelay(statusError(http.StatusBadGateway), 2)
+	assert.Equal(t, 2*mutationBackoff, delay, "backoff should increase with each attempt")
+}
+
+func TestRetryMutation(t *testing.T) {
+	ctx := context.Background()
+	retryAfter := time.Millisecond
+
+	t.Run("clientError", func(t *testing.T) {
+		var attempts int
+		err := retryMutation(ctx, func() error {
+			attempts++
+			return statusError(http.StatusUnprocessableEntity)
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts, "client errors should not be retried")
+	})
+
+	t.Run("transientError", func(t *testing.T) {
+		var attempts int
+		err := retryMutation(ctx, func() error {
+			attempts++
+			if attempts == 1 {
+				return &github.AbuseRateLimitError{RetryAfter: &retryAfter}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("maxAttempts", func(t *testing.T) {
+		var attempts int
+		err := retryMutation(ctx, func() error {
+			attempts++
+			return &github.AbuseRateLimitError{RetryAfter: &retryAfter}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, mutationAttempts, attempts)
+	})
+}
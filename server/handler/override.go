@@ -0,0 +1,106 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const overrideKeyPrefix = "override/"
+
+// OverrideConfig configures notifications for pull requests approved by an
+// override policy. Every override is logged with the audit key.
+type OverrideConfig struct {
+	// SlackWebhookURL is a Slack incoming webhook that receives a message for
+	// each override.
+	SlackWebhookURL string `yaml:"slack_webhook_url"`
+}
+
+func overrideKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%d", overrideKeyPrefix, owner, repo, number)
+}
+
+// overrideResult returns the result of the override policy if it approved
+// the pull request.
+func overrideResult(result *common.Result) *common.Result {
+	for _, c := range result.Children {
+		if c.Name == "override" && c.Status == common.StatusApproved && c.Error == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// notifyOverride logs and announces pull requests approved by an override
+// policy. If a store is configured, each override of a head commit is only
+// announced once; otherwise it is logged after every evaluation and no Slack
+// message is sent.
+func (b *Base) notifyOverride(ctx context.Context, pr *github.PullRequest, result *common.Result) {
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := overrideKey(owner, repo, pr.GetNumber())
+	sha := pr.GetHead().GetSHA()
+
+	override := overrideResult(result)
+	if override == nil {
+		if b.Store != nil {
+			if err := b.Store.Delete(ctx, key); err != nil {
+				logger.Error().Err(err).Msg("Failed to clear override record")
+			}
+		}
+		return
+	}
+
+	if b.Store != nil {
+		value, exists, err := b.Store.Get(ctx, key)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to read override record")
+			return
+		}
+		if exists && string(value) == sha {
+			return
+		}
+	}
+
+	message := fmt.Sprintf("Policy overridden by %s for %s", strings.Join(override.Approvers, " and "), sha)
+	logger.Warn().Str(LogKeyAudit, "override").Strs("approvers", override.Approvers).Msg(message)
+
+	if b.Store == nil {
+		return
+	}
+
+	if url := b.PullOpts().Override.SlackWebhookURL; url != "" && !b.runtimeFlags(ctx).MuteNotifications {
+		text := fmt.Sprintf(":rotating_light: <%s|%s/%s#%d>: %s", pr.GetHTMLURL(), owner, repo, pr.GetNumber(), message)
+		if err := postSlack(ctx, &http.Client{Timeout: 10 * time.Second}, url, text); err != nil {
+			logger.Error().Err(err).Msg("Failed to send override notification")
+			return
+		}
+	}
+
+	if err := b.Store.Put(ctx, key, []byte(sha), 0); err != nil {
+		logger.Error().Err(err).Msg("Failed to save override record")
+	}
+}
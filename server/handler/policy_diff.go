@@ -0,0 +1,313 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/scs"
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	// MaxPolicyDiffPullRequests is the maximum number of open pull requests
+	// evaluated by a single policy diff.
+	MaxPolicyDiffPullRequests = 100
+)
+
+// PolicyDiff evaluates the open pull requests of a repository against both
+// their current policy and a proposed policy and reports the differences.
+// The proposed policy is the request body or, if the body is empty, the
+// policy file at the "ref" query parameter. The "number" query parameter
+// limits the diff to a single pull request.
+type PolicyDiff struct {
+	Base
+	Sessions *scs.Manager
+}
+
+type PolicyDiffReport struct {
+	Repository string `json:"repository"`
+
+	// NewlyBlocked and NewlyApproved count the pull requests that are
+	// approved by the current policy but not the proposed policy, and the
+	// opposite.
+	NewlyBlocked  int `json:"newly_blocked"`
+	NewlyApproved int `json:"newly_approved"`
+
+	// Unchanged counts the pull requests with no differences.
+	Unchanged int `json:"unchanged"`
+
+	// Truncated is true if the repository has more open pull requests than
+	// were evaluated.
+	Truncated bool `json:"truncated,omitempty"`
+
+	PullRequests []*PullRequestDiff `json:"pull_requests"`
+}
+
+// PullRequestDiff describes how the outcome of a pull request changes under
+// the proposed policy. Statuses are "approved", "pending", "disapproved",
+// "skipped", or "error". Only pull requests with differences have Rules.
+type PullRequestDiff struct {
+	PullRequest string     `json:"pull_request"`
+	Title       string     `json:"title"`
+	Current     string     `json:"current"`
+	Proposed    string     `json:"proposed"`
+	Rules       []RuleDiff `json:"rules,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// RuleDiff is a rule or policy section whose status differs between the
+// current and proposed policies. A status is empty if the rule does not
+// exist in that version of the policy.
+type RuleDiff struct {
+	Name     string `json:"name"`
+	Current  string `json:"current,omitempty"`
+	Proposed string `json:"proposed,omitempty"`
+}
+
+func (h *PolicyDiff) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	var number int
+	if n := r.URL.Query().Get("number"); n != "" {
+		var err error
+		if number, err = strconv.Atoi(n); err != nil {
+			http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	installation, err := h.Installations.GetByOwner(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	client, err := h.ClientCreator.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	v4client, err := h.ClientCreator.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	// if the user does not have permission, pretend the repo doesn't exist
+	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil && !isNotFound(err) {
+		return errors.Wrap(err, "failed to get user permission level")
+	}
+	if err != nil || level.GetPermission() == "none" {
+		http.Error(w, fmt.Sprintf("not found: %s/%s", owner, repo), http.StatusNotFound)
+		return nil
+	}
+
+	proposedBytes, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicySize))
+	if err != nil {
+		http.Error(w, errors.Wrap(err, "failed to read policy").Error(), http.StatusBadRequest)
+		return nil
+	}
+	if len(proposedBytes) == 0 {
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			http.Error(w, "request must contain a policy or set the ref parameter", http.StatusBadRequest)
+			return nil
+		}
+		if proposedBytes, _, err = h.ConfigFetcher.fetchConfig(ctx, client, owner, repo, ref, h.ConfigFetcher.PolicyPath); err != nil {
+			return errors.WithMessage(err, "failed to fetch proposed policy")
+		}
+		if proposedBytes == nil {
+			http.Error(w, fmt.Sprintf("no policy found at ref=%s", ref), http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	proposedConfig, err := policy.ParseConfig(proposedBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid proposed policy: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	proposed, err := policy.ParsePolicy(proposedConfig)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid proposed policy: %v", err), http.StatusBadRequest)
+		return nil
+	}
+
+	var prs []*github.PullRequest
+	if number > 0 {
+		pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+		if err != nil {
+			if isNotFound(err) {
+				http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
+				return nil
+			}
+			return errors.Wrap(err, "failed to get pull request")
+		}
+		prs = append(prs, pr)
+	} else {
+		if prs, err = listOpenPullRequests(ctx, client, owner, repo); err != nil {
+			return err
+		}
+	}
+
+	report := PolicyDiffReport{
+		Repository:   fmt.Sprintf("%s/%s", owner, repo),
+		PullRequests: []*PullRequestDiff{},
+	}
+	if len(prs) > MaxPolicyDiffPullRequests {
+		prs = prs[:MaxPolicyDiffPullRequests]
+		report.Truncated = true
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, h.Installations, h.ClientCreator)
+	currentByBranch := make(map[string]*policyVersion)
+
+	for _, pr := range prs {
+		branch := pr.GetBase().GetRef()
+		current, ok := currentByBranch[branch]
+		if !ok {
+			current = h.loadCurrentPolicy(ctx, client, pr)
+			currentByBranch[branch] = current
+		}
+
+		prctx := pull.NewGitHubContext(mbrCtx, client, v4client, pr)
+		evalCtx := h.evaluationContext(ctx, owner)
+
+		diff := &PullRequestDiff{
+			PullRequest: fmt.Sprintf("%s/%s#%d", owner, repo, pr.GetNumber()),
+			Title:       pr.GetTitle(),
+			Current:     "error",
+		}
+
+		var currentResult *common.Result
+		if current.Error != nil {
+			diff.Error = current.Error.Error()
+		} else {
+			res := current.Evaluator.Evaluate(evalCtx, prctx)
+			currentResult = &res
+			diff.Current = resultStatus(currentResult)
+		}
+
+		proposedResult := proposed.Evaluate(evalCtx, prctx)
+		diff.Proposed = resultStatus(&proposedResult)
+		diff.Rules = diffResults(currentResult, &proposedResult)
+
+		switch {
+		case diff.Current == diff.Proposed && len(diff.Rules) == 0:
+			report.Unchanged++
+		case diff.Current == common.StatusApproved.String() && diff.Proposed != diff.Current:
+			report.NewlyBlocked++
+		case diff.Proposed == common.StatusApproved.String() && diff.Proposed != diff.Current:
+			report.NewlyApproved++
+		}
+		report.PullRequests = append(report.PullRequests, diff)
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, &report)
+	return nil
+}
+
+// policyVersion is a parsed policy or the reason it could not be used.
+type policyVersion struct {
+	Evaluator common.Evaluator
+	Error     error
+}
+
+func (h *PolicyDiff) loadCurrentPolicy(ctx context.Context, client *github.Client, pr *github.PullRequest) *policyVersion {
+	config, err := h.ConfigFetcher.ConfigForPR(ctx, client, pr)
+	switch {
+	case err != nil:
+		return &policyVersion{Error: errors.WithMessage(err, "failed to fetch current policy")}
+	case config.Missing():
+		return &policyVersion{Error: errors.New(config.Description())}
+	case config.Invalid():
+		return &policyVersion{Error: errors.WithMessage(config.Error, config.Description())}
+	}
+
+	evaluator, err := policy.ParsePolicy(config.Config)
+	if err != nil {
+		return &policyVersion{Error: errors.WithMessage(err, "invalid current policy")}
+	}
+	return &policyVersion{Evaluator: evaluator}
+}
+
+func resultStatus(r *common.Result) string {
+	if r.Error != nil {
+		return "error"
+	}
+	return r.Status.String()
+}
+
+// diffResults returns the rules and policy sections whose status differs
+// between two results, in the order they appear in the proposed result
+// followed by any that only appear in the current result. The current result
+// may be nil if the current policy could not be evaluated.
+func diffResults(current, proposed *common.Result) []RuleDiff {
+	var currentNames, proposedNames []string
+	currentStatuses := make(map[string]string)
+	proposedStatuses := make(map[string]string)
+
+	if current != nil {
+		collectStatuses(current, currentStatuses, &currentNames)
+	}
+	collectStatuses(proposed, proposedStatuses, &proposedNames)
+
+	var diffs []RuleDiff
+	for _, name := range proposedNames {
+		if currentStatuses[name] != proposedStatuses[name] {
+			diffs = append(diffs, RuleDiff{Name: name, Current: currentStatuses[name], Proposed: proposedStatuses[name]})
+		}
+	}
+	for _, name := range currentNames {
+		if _, ok := proposedStatuses[name]; !ok {
+			diffs = append(diffs, RuleDiff{Name: name, Current: currentStatuses[name]})
+		}
+	}
+	return diffs
+}
+
+// collectStatuses records the status of each named result in the tree and
+// the order of the names. Anonymous "and" and "or" groups are skipped.
+func collectStatuses(r *common.Result, statuses map[string]string, names *[]string) {
+	if r.Name != "" && r.Name != "and" && r.Name != "or" {
+		if _, ok := statuses[r.Name]; !ok {
+			*names = append(*names, r.Name)
+		}
+		statuses[r.Name] = resultStatus(r)
+	}
+	for _, c := range r.Children {
+		collectStatuses(c, statuses, names)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 type PullRequest struct {
@@ -49,13 +50,101 @@ func (h *PullRequest) Handle(ctx context.Context, eventType, deliveryID string,
 		return err
 	}
 
-	ctx, _ = githubapp.PreparePRContext(ctx, installationID, event.GetRepo(), event.GetNumber())
+	ctx, _ = h.preparePRContext(ctx, installationID, event.GetRepo(), event.GetNumber())
 
 	switch event.GetAction() {
-	case "opened", "reopened", "synchronize", "edited":
-		mbrCtx := NewCrossOrgMembershipContext(ctx, client, event.GetRepo().GetOwner().GetLogin(), h.Installations, h.ClientCreator)
+	case "edited":
+		// retargeting a pull request is an edit that changes the base branch
+		if from := baseRefChange(payload); from != "" {
+			zerolog.Ctx(ctx).Info().Msgf("Pull request base branch changed from %s to %s", from, event.GetPullRequest().GetBase().GetRef())
+		}
+		fallthrough
+
+	case "opened", "reopened", "synchronize":
+		if err := h.validateForkPolicy(ctx, client, event.GetPullRequest()); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to validate policy changes")
+		}
+
+		mbrCtx := NewCrossOrgMembershipContext(client, event.GetRepo().GetOwner().GetLogin(), h.Installations, h.ClientCreator)
+		return h.Evaluate(ctx, mbrCtx, client, v4client, event.GetPullRequest())
+
+	case "review_requested", "review_request_removed":
+		mbrCtx := NewCrossOrgMembershipContext(client, event.GetRepo().GetOwner().GetLogin(), h.Installations, h.ClientCreator)
 		return h.Evaluate(ctx, mbrCtx, client, v4client, event.GetPullRequest())
+
+	case "closed":
+		if h.Attestor != nil {
+			return h.attestMerge(ctx, installationID, client, v4client, event.GetPullRequest())
+		}
 	}
 
 	return nil
 }
+
+// baseRefChange returns the previous base branch of an edited pull request
+// or the empty string if the edit did not change the base branch. The
+// vendored github.EditChange type does not include base changes.
+func baseRefChange(payload []byte) string {
+	var edit struct {
+		Changes struct {
+			Base *struct {
+				Ref struct {
+					From string `json:"from"`
+				} `json:"ref"`
+			} `json:"base"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(payload, &edit); err != nil || edit.Changes.Base == nil {
+		return ""
+	}
+	return edit.Changes.Base.Ref.From
+}
+
+// validateForkPolicy posts a policy validation check for pull requests from
+// forks that modify the policy file. Pull requests from branches in the same
+// repository are validated by the push handler.
+func (h *PullRequest) validateForkPolicy(ctx context.Context, client *github.Client, pr *github.PullRequest) error {
+	base, head := pr.GetBase().GetRepo(), pr.GetHead().GetRepo()
+	if head == nil || head.GetID() == base.GetID() {
+		return nil
+	}
+
+	path := h.ConfigFetcher.PolicyPathForBranch(pr.GetBase().GetRef())
+
+	modified, err := pullRequestModifiesPath(ctx, client, pr, path)
+	if err != nil || !modified {
+		return err
+	}
+
+	return h.ValidatePolicyChange(ctx, client, PolicyChange{
+		Owner:     base.GetOwner().GetLogin(),
+		Repo:      base.GetName(),
+		BaseRef:   pr.GetBase().GetRef(),
+		Path:      path,
+		HeadOwner: head.GetOwner().GetLogin(),
+		HeadRepo:  head.GetName(),
+		HeadSHA:   pr.GetHead().GetSHA(),
+	})
+}
+
+func pullRequestModifiesPath(ctx context.Context, client *github.Client, pr *github.PullRequest, path string) (bool, error) {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		files, res, err := client.PullRequests.ListFiles(ctx, owner, repo, pr.GetNumber(), opt)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to list pull request files")
+		}
+		for _, f := range files {
+			if f.GetFilename() == path {
+				return true, nil
+			}
+		}
+		if res.NextPage == 0 {
+			return false, nil
+		}
+		opt.Page = res.NextPage
+	}
+}
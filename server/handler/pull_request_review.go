@@ -21,6 +21,8 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/approval"
 )
 
 type PullRequestReview struct {
@@ -49,8 +51,17 @@ func (h *PullRequestReview) Handle(ctx context.Context, eventType, deliveryID st
 		return err
 	}
 
-	ctx, _ = githubapp.PreparePRContext(ctx, installationID, event.GetRepo(), event.GetPullRequest().GetNumber())
+	ctx, logger := h.preparePRContext(ctx, installationID, event.GetRepo(), event.GetPullRequest().GetNumber())
+
+	if h.PullOpts().ReviewerLoad.Enabled && event.GetAction() == "submitted" {
+		owner := event.GetRepo().GetOwner().GetLogin()
+		repo := event.GetRepo().GetName()
+		number := event.GetPullRequest().GetNumber()
+		if err := h.completeReviewRequest(ctx, event.GetReview().GetUser().GetLogin(), owner, repo, number); err != nil {
+			logger.Warn().Err(err).Msg("Failed to update reviewer load")
+		}
+	}
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, event.GetRepo().GetOwner().GetLogin(), h.Installations, h.ClientCreator)
-	return h.Evaluate(ctx, mbrCtx, client, v4client, event.GetPullRequest())
+	mbrCtx := NewCrossOrgMembershipContext(client, event.GetRepo().GetOwner().GetLogin(), h.Installations, h.ClientCreator)
+	return h.EvaluateTriggered(ctx, mbrCtx, client, v4client, event.GetPullRequest(), approval.TriggerReviews)
 }
@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/approval"
+)
+
+type PullRequestReviewThread struct {
+	Base
+}
+
+func (h *PullRequestReviewThread) Handles() []string {
+	return []string{"pull_request_review_thread"}
+}
+
+// pullRequestReviewThreadEvent contains the fields of the review thread event
+// used for evaluation. The vendored client does not support this event.
+type pullRequestReviewThreadEvent struct {
+	Action       string               `json:"action"`
+	PullRequest  *github.PullRequest  `json:"pull_request,omitempty"`
+	Repo         *github.Repository   `json:"repository,omitempty"`
+	Installation *github.Installation `json:"installation,omitempty"`
+}
+
+func (e *pullRequestReviewThreadEvent) GetInstallation() *github.Installation {
+	return e.Installation
+}
+
+// Handle pull_request_review_thread
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#pull_request_review_thread
+func (h *PullRequestReviewThread) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event pullRequestReviewThreadEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse pull request review thread event payload")
+	}
+
+	// only changes to the resolution of a thread affect evaluation
+	if event.Action != "resolved" && event.Action != "unresolved" {
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	ctx, _ = h.preparePRContext(ctx, installationID, event.Repo, event.PullRequest.GetNumber())
+
+	mbrCtx := NewCrossOrgMembershipContext(client, event.Repo.GetOwner().GetLogin(), h.Installations, h.ClientCreator)
+	return h.EvaluateTriggered(ctx, mbrCtx, client, v4client, event.PullRequest, approval.TriggerComments)
+}
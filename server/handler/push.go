@@ -0,0 +1,118 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+type Push struct {
+	Base
+}
+
+func (h *Push) Handles() []string { return []string{"push"} }
+
+// Handle push
+// https://developer.github.com/v3/activity/events/types/#pushevent
+func (h *Push) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.PushEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse push event payload")
+	}
+
+	if event.GetDeleted() {
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	ctx, logger := h.prepareRepoContext(ctx, installationID, pushEventRepository(event.GetRepo()))
+
+	if err := h.checkPushProtection(ctx, installationID, &event); err != nil {
+		logger.Error().Err(err).Msg("Failed to check push protection")
+	}
+
+	if !strings.HasPrefix(event.GetRef(), "refs/heads/") {
+		return nil
+	}
+
+	branch := strings.TrimPrefix(event.GetRef(), "refs/heads/")
+	path := h.ConfigFetcher.PolicyPathForBranch(branch)
+
+	if !pushModifiesPath(event, path) {
+		return nil
+	}
+
+	logger.Debug().Msgf("Push to %s modified policy file %s", branch, path)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	if owner == "" {
+		owner = event.GetRepo().GetOwner().GetName()
+	}
+	repo := event.GetRepo().GetName()
+
+	change := PolicyChange{
+		Owner:     owner,
+		Repo:      repo,
+		Path:      path,
+		HeadOwner: owner,
+		HeadRepo:  repo,
+		HeadSHA:   event.GetAfter(),
+	}
+	if before := event.GetBefore(); before != zeroSHA {
+		change.BaseRef = before
+	}
+
+	return h.ValidatePolicyChange(ctx, client, change)
+}
+
+func pushModifiesPath(event github.PushEvent, path string) bool {
+	for _, c := range event.Commits {
+		for _, files := range [][]string{c.Added, c.Modified, c.Removed} {
+			for _, f := range files {
+				if f == path {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pushEventRepository converts the repository in a push event to the type
+// expected by githubapp for logging.
+func pushEventRepository(r *github.PushEventRepository) *github.Repository {
+	if r == nil {
+		return nil
+	}
+	return &github.Repository{
+		ID:       r.ID,
+		Name:     r.Name,
+		FullName: r.FullName,
+		Owner:    r.Owner,
+	}
+}
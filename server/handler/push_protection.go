@@ -0,0 +1,254 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const commitPullsMediaType = "application/vnd.github.groot-preview+json"
+
+// PushProtectionConfig configures checks of pushes to protected branches and
+// tags. A push complies with the policy if its head commit is the merge commit
+// of a pull request that was approved when it merged. Other pushes, like
+// direct pushes by administrators, are violations.
+type PushProtectionConfig struct {
+	// Enabled checks pushes to protected branches and tags.
+	Enabled bool `yaml:"enabled"`
+
+	// Branches are regular expressions for protected branches. If empty, only
+	// the default branch of each repository is protected.
+	Branches []string `yaml:"branches"`
+
+	// Tags are regular expressions for protected tags. If empty, no tags are
+	// protected.
+	Tags []string `yaml:"tags"`
+
+	// SlackWebhookURL is an incoming webhook that receives a message for each
+	// violation.
+	SlackWebhookURL string `yaml:"slack_webhook_url"`
+}
+
+// Validate returns an error if any of the patterns are malformed.
+func (c *PushProtectionConfig) Validate() error {
+	for _, p := range append(append([]string(nil), c.Branches...), c.Tags...) {
+		if _, err := regexp.Compile(p); err != nil {
+			return errors.Wrapf(err, "invalid push protection pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Protects returns true if pushes to the ref are checked. Refs are full names,
+// like "refs/heads/develop" or "refs/tags/v1.0.0".
+func (c *PushProtectionConfig) Protects(ref, defaultBranch string) bool {
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		branch := strings.TrimPrefix(ref, "refs/heads/")
+		if len(c.Branches) == 0 {
+			return branch == defaultBranch
+		}
+		return matchesAnyPattern(c.Branches, branch)
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return matchesAnyPattern(c.Tags, strings.TrimPrefix(ref, "refs/tags/"))
+	}
+	return false
+}
+
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// PushProtectionCheckName returns the context of the status posted on the
+// head commit of protected pushes.
+func (b *Base) PushProtectionCheckName() string {
+	return fmt.Sprintf("%s: push", b.PullOpts().StatusCheckContext)
+}
+
+// checkPushProtection checks that a push to a protected branch or tag merged
+// an approved pull request. It posts a status with the result on the head
+// commit of the push and reports violations in the audit log and to Slack.
+func (b *Base) checkPushProtection(ctx context.Context, installationID int64, event *github.PushEvent) error {
+	config := b.PullOpts().PushProtection
+	if !config.Enabled || event.GetDeleted() {
+		return nil
+	}
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	if owner == "" {
+		owner = event.GetRepo().GetOwner().GetName()
+	}
+	repo := event.GetRepo().GetName()
+
+	if !b.PullOpts().Repositories.Enforced(owner, repo) {
+		return nil
+	}
+	if !config.Protects(event.GetRef(), event.GetRepo().GetDefaultBranch()) {
+		return nil
+	}
+
+	logger := zerolog.Ctx(ctx)
+
+	// annotated tags point to a tag object, but the head commit is the
+	// tagged commit
+	sha := event.GetHeadCommit().GetID()
+	if sha == "" {
+		sha = event.GetAfter()
+	}
+
+	client, err := b.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := b.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	pr, err := mergedPullRequestForCommit(ctx, client, owner, repo, sha, event.GetRef())
+	if err != nil {
+		return err
+	}
+
+	targetURL := event.GetHeadCommit().GetURL()
+	var violation string
+	if pr == nil {
+		violation = fmt.Sprintf("%s was pushed to %s without a pull request", shortSHA(sha), event.GetRef())
+	} else {
+		targetURL = b.DetailsURL(pr)
+
+		mbrCtx := NewCrossOrgMembershipContext(client, owner, b.Installations, b.ClientCreator)
+		loaded := &loadedPullRequest{
+			InstallationID: installationID,
+			Client:         client,
+			V4Client:       v4client,
+			PullRequest:    pr,
+			PullContext:    pull.NewGitHubContextAt(mbrCtx, client, v4client, pr, pr.GetMergedAt()),
+		}
+
+		result, _, err := b.evaluatePullRequest(ctx, loaded)
+		if err != nil {
+			logger.Info().Err(err).Msgf("Skipping push protection for pull request %d without a valid policy", pr.GetNumber())
+			return nil
+		}
+		if result.Error != nil {
+			return errors.WithMessage(result.Error, "failed to evaluate policy for push protection")
+		}
+		if result.Status != common.StatusApproved {
+			violation = fmt.Sprintf("#%d was merged to %s with policy status %s", pr.GetNumber(), event.GetRef(), result.Status)
+		}
+	}
+
+	state, message := "failure", violation
+	if violation == "" {
+		state, message = "success", fmt.Sprintf("Merged #%d with an approved policy", pr.GetNumber())
+	} else {
+		b.notifyPushViolation(ctx, event, owner, repo, violation)
+	}
+
+	if b.runtimeFlags(ctx).ShadowMode {
+		logger.Info().Msgf("Shadow mode is enabled, not posting push status %s: %s", state, message)
+		return nil
+	}
+
+	name := b.PushProtectionCheckName()
+	status := &github.RepoStatus{
+		Context:     &name,
+		State:       &state,
+		Description: &message,
+		TargetURL:   &targetURL,
+	}
+	if _, _, err := client.Repositories.CreateStatus(ctx, owner, repo, sha, status); err != nil {
+		return errors.Wrap(err, "failed to post push protection status")
+	}
+	return nil
+}
+
+// notifyPushViolation records a violation in the audit log and sends it to
+// the configured Slack webhook. Failures to send are logged.
+func (b *Base) notifyPushViolation(ctx context.Context, event *github.PushEvent, owner, repo, violation string) {
+	logger := zerolog.Ctx(ctx)
+	pusher := event.GetPusher().GetName()
+
+	logger.Warn().Str(LogKeyAudit, "push").Str("pusher", pusher).Msgf("Push protection violation: %s", violation)
+
+	url := b.PullOpts().PushProtection.SlackWebhookURL
+	if url == "" || b.runtimeFlags(ctx).MuteNotifications {
+		return
+	}
+
+	text := fmt.Sprintf(":rotating_light: <%s|%s/%s>: %s by %s", event.GetCompare(), owner, repo, violation, pusher)
+	if err := postSlack(ctx, &http.Client{Timeout: 10 * time.Second}, url, text); err != nil {
+		logger.Error().Err(err).Msg("Failed to send push protection notification")
+	}
+}
+
+// mergedPullRequestForCommit returns the merged pull request with the given
+// merge commit, or nil if the commit was not created by merging a pull
+// request. For branches, the pull request must target the pushed branch.
+func mergedPullRequestForCommit(ctx context.Context, client *github.Client, owner, repo, sha, ref string) (*github.PullRequest, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/commits/%s/pulls", owner, repo, sha), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Accept", commitPullsMediaType)
+
+	var prs []*github.PullRequest
+	if _, err := client.Do(ctx, req, &prs); err != nil {
+		return nil, errors.Wrapf(err, "failed to list pull requests for commit %s", sha)
+	}
+
+	for _, pr := range prs {
+		if pr.MergedAt == nil || pr.GetMergeCommitSHA() != sha {
+			continue
+		}
+		if strings.HasPrefix(ref, "refs/heads/") && pr.GetBase().GetRef() != strings.TrimPrefix(ref, "refs/heads/") {
+			continue
+		}
+
+		// the list response does not include all fields used for evaluation
+		full, _, err := client.PullRequests.Get(ctx, owner, repo, pr.GetNumber())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get pull request %d", pr.GetNumber())
+		}
+		return full, nil
+	}
+	return nil, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
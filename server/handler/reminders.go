@@ -0,0 +1,387 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultReminderCheckInterval = 5 * time.Minute
+	DefaultReminderMaxInterval   = 7 * 24 * time.Hour
+
+	reminderKeyPrefix = "reminder/"
+)
+
+// ReminderConfig configures reminders for rules that stay pending for too
+// long. Reminders are disabled if After is zero.
+type ReminderConfig struct {
+	// After is how long a rule must be pending before the first reminder.
+	After time.Duration `yaml:"after"`
+
+	// Interval is the time between the first and second reminder. The time
+	// between later reminders doubles after each reminder, up to MaxInterval.
+	// If unset, After is used.
+	Interval time.Duration `yaml:"interval"`
+
+	// MaxInterval is the longest time between reminders. If unset,
+	// DefaultReminderMaxInterval is used.
+	MaxInterval time.Duration `yaml:"max_interval"`
+
+	// MaxReminders is the number of reminders sent for a pull request. If
+	// zero, reminders continue until no rules are pending.
+	MaxReminders int `yaml:"max_reminders"`
+
+	// CheckInterval is how often to check for pull requests that need a
+	// reminder. If unset, DefaultReminderCheckInterval is used.
+	CheckInterval time.Duration `yaml:"check_interval"`
+
+	// Comment enables posting a comment that mentions the eligible approvers
+	// of the pending rules.
+	Comment bool `yaml:"comment"`
+
+	// RequestReviews enables requesting review from enough eligible
+	// approvers of the pending rules to satisfy them, skipping users who
+	// already have a pending review request.
+	RequestReviews bool `yaml:"request_reviews"`
+}
+
+func (c *ReminderConfig) IsEnabled() bool {
+	return c.After > 0
+}
+
+// nextReminder returns when the next reminder for the record is due.
+func (c *ReminderConfig) nextReminder(record reminderRecord) time.Time {
+	if record.Reminders == 0 {
+		return record.oldest().Add(c.After)
+	}
+
+	interval := c.Interval
+	if interval <= 0 {
+		interval = c.After
+	}
+	maxInterval := c.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultReminderMaxInterval
+	}
+
+	for i := 1; i < record.Reminders && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return record.RemindedAt.Add(interval)
+}
+
+type reminderRecord struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+
+	// Pending maps the names of pending rules to when they became pending.
+	Pending map[string]time.Time `json:"pending"`
+
+	Reminders  int       `json:"reminders"`
+	RemindedAt time.Time `json:"reminded_at"`
+}
+
+// oldest returns when the rule that has been pending the longest became
+// pending.
+func (r reminderRecord) oldest() time.Time {
+	var oldest time.Time
+	for _, since := range r.Pending {
+		if oldest.IsZero() || since.Before(oldest) {
+			oldest = since
+		}
+	}
+	return oldest
+}
+
+func reminderKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%d", reminderKeyPrefix, owner, repo, number)
+}
+
+// trackPendingRules records when each rule of a pull request became pending
+// and forgets pull requests without pending rules.
+func (b *Base) trackPendingRules(ctx context.Context, pr *github.PullRequest, config *policy.Config, result *common.Result) {
+	if b.Store == nil || !b.PullOpts().ReviewReminders.IsEnabled() {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := reminderKey(owner, repo, pr.GetNumber())
+
+	var pending []string
+	if result.Status == common.StatusPending {
+		for _, r := range policy.PendingRules(config, result) {
+			pending = append(pending, r.Name)
+		}
+	}
+
+	if len(pending) == 0 {
+		if err := b.Store.Delete(ctx, key); err != nil {
+			logger.Error().Err(err).Msg("Failed to clear reminder record")
+		}
+		return
+	}
+
+	record := reminderRecord{Owner: owner, Repo: repo, Number: pr.GetNumber()}
+	value, exists, err := b.Store.Get(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read reminder record")
+		return
+	}
+	if exists {
+		if err := json.Unmarshal(value, &record); err != nil {
+			logger.Warn().Err(err).Msg("Replacing invalid reminder record")
+		}
+	}
+
+	now := time.Now()
+	changed := !exists || len(record.Pending) != len(pending)
+
+	tracked := make(map[string]time.Time, len(pending))
+	for _, name := range pending {
+		since, ok := record.Pending[name]
+		if !ok {
+			since = now
+			changed = true
+		}
+		tracked[name] = since
+	}
+	if !changed {
+		return
+	}
+
+	record.Pending = tracked
+	if err := b.putReminder(ctx, key, record); err != nil {
+		logger.Error().Err(err).Msg("Failed to save reminder record")
+	}
+}
+
+func (b *Base) putReminder(ctx context.Context, key string, record reminderRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode reminder record")
+	}
+	return b.Store.Put(ctx, key, value, 0)
+}
+
+// ReviewReminder periodically reminds the eligible approvers of rules that
+// have been pending for longer than the configured duration.
+type ReviewReminder struct {
+	Base
+}
+
+// Run checks for pull requests that need a reminder until the context is
+// canceled.
+func (r *ReviewReminder) Run(ctx context.Context) {
+	interval := r.PullOpts().ReviewReminders.CheckInterval
+	if interval <= 0 {
+		interval = DefaultReminderCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RemindAll(ctx); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to send review reminders")
+			}
+		}
+	}
+}
+
+// RemindAll sends a reminder for every tracked pull request with a reminder
+// due. It does nothing if reminders were disabled by reloading the server
+// configuration.
+func (r *ReviewReminder) RemindAll(ctx context.Context) error {
+	config := r.PullOpts().ReviewReminders
+	if !config.IsEnabled() {
+		return nil
+	}
+
+	if r.runtimeFlags(ctx).MuteNotifications {
+		zerolog.Ctx(ctx).Debug().Msg("Notifications are muted, not sending review reminders")
+		return nil
+	}
+
+	now := time.Now()
+	return r.Store.Scan(ctx, reminderKeyPrefix, func(key string, value []byte) error {
+		var record reminderRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("key", key).Msg("Ignoring invalid reminder record")
+			return nil
+		}
+
+		if config.MaxReminders > 0 && record.Reminders >= config.MaxReminders {
+			return nil
+		}
+		if now.Before(config.nextReminder(record)) {
+			return nil
+		}
+
+		logger := zerolog.Ctx(ctx).With().Str("pull_request", fmt.Sprintf("%s/%s#%d", record.Owner, record.Repo, record.Number)).Logger()
+		if err := r.remind(logger.WithContext(ctx), key, record); err != nil {
+			logger.Error().Err(err).Msg("Failed to send review reminder")
+		}
+		return nil
+	})
+}
+
+func (r *ReviewReminder) remind(ctx context.Context, key string, record reminderRecord) error {
+	config := r.PullOpts().ReviewReminders
+
+	installation, err := r.Installations.GetByOwner(ctx, record.Owner)
+	if err != nil {
+		return err
+	}
+
+	client, err := r.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	v4client, err := r.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, record.Owner, record.Repo, record.Number)
+	if err != nil {
+		if isNotFound(err) {
+			return r.Store.Delete(ctx, key)
+		}
+		return errors.Wrap(err, "failed to get pull request")
+	}
+	if pr.GetState() != "open" {
+		return r.Store.Delete(ctx, key)
+	}
+
+	fetchedConfig, err := r.ConfigFetcher.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+	}
+	if !fetchedConfig.Valid() {
+		return r.Store.Delete(ctx, key)
+	}
+
+	evaluator, err := policy.ParsePolicy(fetchedConfig.Config)
+	if err != nil {
+		return r.Store.Delete(ctx, key)
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, record.Owner, r.Installations, r.ClientCreator)
+	prctx := pull.NewGitHubContext(mbrCtx, client, v4client, pr)
+	evalCtx := r.pullEvaluationContext(ctx, prctx)
+
+	result := evaluator.Evaluate(evalCtx, prctx)
+	if result.Error != nil {
+		return errors.WithMessage(result.Error, "failed to evaluate policy")
+	}
+	if result.Status != common.StatusPending {
+		return r.Store.Delete(ctx, key)
+	}
+
+	approvers, err := policy.EligibleApprovers(evalCtx, prctx, fetchedConfig.Config, &result)
+	if err != nil {
+		return err
+	}
+
+	// only remind approvers of rules that have been pending long enough
+	now := time.Now()
+	for name := range approvers {
+		since, ok := record.Pending[name]
+		if !ok || now.Sub(since) < config.After {
+			delete(approvers, name)
+		}
+	}
+	if len(approvers) == 0 {
+		return nil
+	}
+
+	if config.RequestReviews {
+		reviewers := selectReviewers(fetchedConfig.Config, &result, approvers, pr)
+		if len(reviewers) > 0 {
+			req := github.ReviewersRequest{Reviewers: reviewers}
+			if err := requestReviewers(ctx, client, record.Owner, record.Repo, record.Number, req); err != nil {
+				return errors.Wrap(err, "failed to request reminder reviews")
+			}
+		}
+	}
+
+	if config.Comment {
+		body := formatReminderComment(approvers, now.Sub(record.oldest()), r.DetailsURL(pr))
+		comment := &github.IssueComment{Body: &body}
+		if _, _, err := client.Issues.CreateComment(ctx, record.Owner, record.Repo, record.Number, comment); err != nil {
+			return errors.Wrap(err, "failed to create reminder comment")
+		}
+	}
+
+	zerolog.Ctx(ctx).Info().Msgf("Sent review reminder %d", record.Reminders+1)
+
+	record.Reminders++
+	record.RemindedAt = now
+	return r.putReminder(ctx, key, record)
+}
+
+func formatReminderComment(approvers map[string][]string, waiting time.Duration, detailsURL string) string {
+	var names []string
+	for name := range approvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "This pull request has been waiting for approval for %s. See the [policy details](%s).\n\n",
+		waiting.Round(time.Minute), detailsURL)
+	for _, name := range names {
+		users := approvers[name]
+		fmt.Fprintf(&buf, "- **%s**:", name)
+		for i, u := range users {
+			if i == MaxDisplayedApprovers {
+				fmt.Fprintf(&buf, " and %d more", len(users)-i)
+				break
+			}
+			fmt.Fprintf(&buf, " @%s", u)
+		}
+		if len(users) == 0 {
+			buf.WriteString(" no eligible users")
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// RepositoryFilter selects the repositories where policies are enforced.
+// Patterns match the full name of a repository, like "org/repo", and use the
+// syntax of path.Match, so "org/*" matches all repositories in an
+// organization.
+type RepositoryFilter struct {
+	// Allow lists the repositories where policies are enforced. If empty,
+	// policies are enforced in all repositories that are not denied.
+	Allow []string `yaml:"allow"`
+
+	// Deny lists the repositories where policies are not enforced, even if
+	// they are allowed.
+	Deny []string `yaml:"deny"`
+}
+
+// Validate returns an error if any of the patterns are malformed.
+func (f RepositoryFilter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Allow...), f.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid repository pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Enforced returns true if policies are enforced for the repository with the
+// given owner and name.
+func (f RepositoryFilter) Enforced(owner, repo string) bool {
+	name := owner + "/" + repo
+	if matchesAnyRepository(f.Deny, name) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchesAnyRepository(f.Allow, name)
+}
+
+func matchesAnyRepository(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// ResultJSON is the serialized form of a policy evaluation result.
+type ResultJSON struct {
+	Name          string            `json:"name"`
+	Status        string            `json:"status"`
+	Description   string            `json:"description,omitempty"`
+	Approvers     []string          `json:"approvers,omitempty"`
+	ApprovalSHAs  map[string]string `json:"approval_shas,omitempty"`
+	Warnings      []string          `json:"warnings,omitempty"`
+	RequiresRules []string          `json:"requires_rules,omitempty"`
+	WaitingFor    []string          `json:"waiting_for,omitempty"`
+	Advisory      bool              `json:"advisory,omitempty"`
+	StatusContext string            `json:"status_context,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Children      []*ResultJSON     `json:"children,omitempty"`
+
+	Environments []*common.EnvironmentStatus `json:"environments,omitempty"`
+}
+
+func NewResultJSON(r *common.Result) *ResultJSON {
+	if r == nil {
+		return nil
+	}
+
+	res := &ResultJSON{
+		Name:         r.Name,
+		Status:       r.Status.String(),
+		Description:  r.Description,
+		Approvers:    r.Approvers,
+		ApprovalSHAs: r.ApprovalSHAs,
+		Warnings:     r.Warnings,
+
+		RequiresRules: r.RequiredRules,
+		WaitingFor:    r.WaitingFor,
+		Advisory:      r.Advisory,
+		StatusContext: r.StatusContext,
+
+		Environments: r.Environments,
+	}
+	if r.Error != nil {
+		res.Status = "error"
+		res.Error = r.Error.Error()
+	}
+	for _, c := range r.Children {
+		res.Children = append(res.Children, NewResultJSON(c))
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/store"
+)
+
+const (
+	reviewRequestKeyPrefix = "review-request/"
+
+	// reviewLoadWindow is the period used for weekly review request limits.
+	// Records of review requests expire after this period.
+	reviewLoadWindow = 7 * 24 * time.Hour
+)
+
+// ReviewerLoadConfig balances the review requests made by policy-bot across
+// eligible approvers. Requests are tracked in the store.
+type ReviewerLoadConfig struct {
+	// Enabled prefers eligible approvers with fewer open review requests
+	// from policy-bot when requesting reviewers.
+	Enabled bool `yaml:"enabled"`
+
+	// WeeklyLimit is the maximum number of reviews policy-bot requests from
+	// a user in a week. If zero, there is no limit.
+	WeeklyLimit int `yaml:"weekly_limit"`
+
+	// UserLimits overrides WeeklyLimit for users, keyed by login.
+	UserLimits map[string]int `yaml:"user_limits"`
+}
+
+func (c ReviewerLoadConfig) limit(user string) int {
+	if limit, ok := c.UserLimits[user]; ok {
+		return limit
+	}
+	return c.WeeklyLimit
+}
+
+type reviewRequestRecord struct {
+	RequestedAt time.Time `json:"requested_at"`
+	Open        bool      `json:"open"`
+}
+
+type reviewerLoad struct {
+	Open   int
+	Weekly int
+}
+
+func reviewRequestKey(user, owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%s/%d", reviewRequestKeyPrefix, strings.ToLower(user), owner, repo, number)
+}
+
+// loadReviewerLoad returns the open and weekly review request counts for
+// each user.
+func loadReviewerLoad(ctx context.Context, st store.Store, users []string) (map[string]reviewerLoad, error) {
+	loads := make(map[string]reviewerLoad)
+	for _, u := range users {
+		if _, ok := loads[u]; ok {
+			continue
+		}
+
+		var load reviewerLoad
+		prefix := reviewRequestKeyPrefix + strings.ToLower(u) + "/"
+		err := st.Scan(ctx, prefix, func(key string, value []byte) error {
+			var record reviewRequestRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return errors.Wrapf(err, "failed to parse review request record %s", key)
+			}
+			load.Weekly++
+			if record.Open {
+				load.Open++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load review requests for %s", u)
+		}
+		loads[u] = load
+	}
+	return loads, nil
+}
+
+// balanceApprovers orders the eligible approvers of each rule by their number
+// of open review requests and removes users who reached their weekly limit.
+// Users with the same load keep their original order.
+func (b *Base) balanceApprovers(ctx context.Context, approvers map[string][]string) (map[string][]string, error) {
+	var users []string
+	for _, rule := range approvers {
+		users = append(users, rule...)
+	}
+
+	loads, err := loadReviewerLoad(ctx, b.Store, users)
+	if err != nil {
+		return nil, err
+	}
+
+	config := b.PullOpts().ReviewerLoad
+	balanced := make(map[string][]string, len(approvers))
+	for name, rule := range approvers {
+		var available []string
+		for _, u := range rule {
+			if limit := config.limit(u); limit > 0 && loads[u].Weekly >= limit {
+				continue
+			}
+			available = append(available, u)
+		}
+		sort.SliceStable(available, func(i, j int) bool {
+			return loads[available[i]].Open < loads[available[j]].Open
+		})
+		balanced[name] = available
+	}
+	return balanced, nil
+}
+
+// recordReviewRequests records open review requests for users.
+func (b *Base) recordReviewRequests(ctx context.Context, owner, repo string, number int, users []string) error {
+	record := reviewRequestRecord{RequestedAt: time.Now(), Open: true}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal review request record")
+	}
+
+	for _, u := range users {
+		if err := b.Store.Put(ctx, reviewRequestKey(u, owner, repo, number), value, reviewLoadWindow); err != nil {
+			return errors.Wrapf(err, "failed to record review request for %s", u)
+		}
+	}
+	return nil
+}
+
+// completeReviewRequest marks the review request for a user as closed. The
+// request still counts towards the user's weekly limit until it expires.
+func (b *Base) completeReviewRequest(ctx context.Context, user, owner, repo string, number int) error {
+	key := reviewRequestKey(user, owner, repo, number)
+
+	value, exists, err := b.Store.Get(ctx, key)
+	if err != nil || !exists {
+		return errors.Wrapf(err, "failed to get review request for %s", user)
+	}
+
+	var record reviewRequestRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return errors.Wrapf(err, "failed to parse review request record %s", key)
+	}
+	if !record.Open {
+		return nil
+	}
+
+	ttl := time.Until(record.RequestedAt.Add(reviewLoadWindow))
+	if ttl <= 0 {
+		return b.Store.Delete(ctx, key)
+	}
+
+	record.Open = false
+	if value, err = json.Marshal(record); err != nil {
+		return errors.Wrap(err, "failed to marshal review request record")
+	}
+	return b.Store.Put(ctx, key, value, ttl)
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/scs"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	// MaxDisplayedApprovers is the maximum number of eligible approvers shown
+	// for each pending rule on the details page.
+	MaxDisplayedApprovers = 20
+)
+
+// RequestReviewers requests a review on a pull request from an eligible
+// approver on behalf of a logged in user.
+type RequestReviewers struct {
+	Base
+	Sessions *scs.Manager
+}
+
+func (h *RequestReviewers) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	number, err := strconv.Atoi(pat.Param(r, "number"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
+		return nil
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := requestUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	token, err := sess.GetString(SessionKeyCSRFToken)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(r.PostFormValue("csrf_token"))) != 1 {
+		http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+		return nil
+	}
+
+	reviewer := r.PostFormValue("reviewer")
+	if reviewer == "" {
+		http.Error(w, "missing reviewer", http.StatusBadRequest)
+		return nil
+	}
+
+	loaded, err := h.loadPullRequest(ctx, owner, repo, number, user)
+	if err != nil {
+		if isNotFoundError(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil
+		}
+		return err
+	}
+
+	if !canRequestReviewers(loaded, user) {
+		http.Error(w, "you do not have permission to request reviewers on this pull request", http.StatusForbidden)
+		return nil
+	}
+
+	result, config, err := h.evaluatePullRequest(ctx, loaded)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	approvers, err := policy.EligibleApprovers(h.evaluationContext(ctx, owner), loaded.PullContext, config.Config, result)
+	if err != nil {
+		return err
+	}
+	if !isEligible(approvers, reviewer) {
+		http.Error(w, fmt.Sprintf("%s is not an eligible approver for a pending rule", reviewer), http.StatusBadRequest)
+		return nil
+	}
+
+	requested, err := reviewRequested(ctx, loaded.PullContext, reviewer)
+	if err != nil {
+		return err
+	}
+	if requested {
+		zerolog.Ctx(ctx).Info().Msgf("Review from %s on %s/%s#%d is already requested", reviewer, owner, repo, number)
+		http.Redirect(w, r, fmt.Sprintf("/details/%s/%s/%d", owner, repo, number), http.StatusSeeOther)
+		return nil
+	}
+
+	req := github.ReviewersRequest{Reviewers: []string{reviewer}}
+	if err := requestReviewers(ctx, loaded.Client, owner, repo, number, req); err != nil {
+		return errors.Wrapf(err, "failed to request review from %s", reviewer)
+	}
+
+	zerolog.Ctx(ctx).Info().Msgf("User %s requested review from %s on %s/%s#%d", user, reviewer, owner, repo, number)
+
+	http.Redirect(w, r, fmt.Sprintf("/details/%s/%s/%d", owner, repo, number), http.StatusSeeOther)
+	return nil
+}
+
+// canRequestReviewers returns true if the user may request reviewers on the
+// loaded pull request, matching the permissions required by GitHub.
+func canRequestReviewers(loaded *loadedPullRequest, user string) bool {
+	if loaded.PullRequest.GetState() != "open" {
+		return false
+	}
+	if loaded.PullRequest.GetUser().GetLogin() == user {
+		return true
+	}
+	return loaded.Permission == common.GithubAdminPermission || loaded.Permission == common.GithubWritePermission
+}
+
+// reviewRequested returns true if the user has a pending review request on
+// the pull request, either directly or as a member of a requested team.
+func reviewRequested(ctx context.Context, prctx pull.Context, user string) (bool, error) {
+	requests, err := prctx.RequestedReviewers(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get review requests")
+	}
+
+	for _, u := range requests.Users {
+		if strings.EqualFold(u, user) {
+			return true, nil
+		}
+	}
+	for _, t := range requests.Teams {
+		member, err := prctx.IsTeamMember(ctx, t, user)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get membership of %s", t)
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isEligible(approvers map[string][]string, user string) bool {
+	for _, users := range approvers {
+		for _, u := range users {
+			if strings.EqualFold(u, user) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// csrfToken returns the CSRF token for the session, creating a new token if
+// the session does not have one.
+func csrfToken(w http.ResponseWriter, sess *scs.Session) (string, error) {
+	token, err := sess.GetString(SessionKeyCSRFToken)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read session")
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate CSRF token")
+	}
+
+	token = hex.EncodeToString(b)
+	if err := sess.PutString(w, SessionKeyCSRFToken, token); err != nil {
+		return "", errors.Wrap(err, "failed to save session")
+	}
+	return token, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/approval"
+)
+
+const (
+	DefaultRuleCacheTTL  = 10 * time.Minute
+	DefaultRuleCacheSize = 10000
+)
+
+// RuleCacheConfig configures the reuse of rule results between evaluations
+// of the same pull request. A rule is evaluated again when the head commit,
+// base branch, title, body, reviews, or comments of the pull request change,
+// when the policy changes, or when its cached result expires. Rules that
+// depend on the time or on external services are always evaluated.
+type RuleCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long a result is reused. It bounds how long changes that
+	// are not part of the cache key, like team membership, take to affect
+	// cached rules. If unset, DefaultRuleCacheTTL is used.
+	TTL time.Duration `yaml:"ttl"`
+
+	// Size is the maximum number of cached results. If unset,
+	// DefaultRuleCacheSize is used.
+	Size int `yaml:"size"`
+}
+
+func (c *RuleCacheConfig) IsEnabled() bool {
+	return c.Enabled
+}
+
+// NewCache returns an empty cache with the configured limits.
+func (c *RuleCacheConfig) NewCache() *approval.ResultCache {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultRuleCacheTTL
+	}
+	size := c.Size
+	if size <= 0 {
+		size = DefaultRuleCacheSize
+	}
+	return approval.NewResultCache(ttl, size)
+}
+
+// withRuleCache returns a context in which rules reuse cached results, if
+// the rule cache is enabled. The version identifies the policy. Snapshots
+// must record the data used by every rule, so the cache is not used when
+// snapshots are enabled.
+func (b *Base) withRuleCache(ctx context.Context, version string) context.Context {
+	if b.RuleCache == nil || b.Snapshots != nil || version == "" {
+		return ctx
+	}
+	return approval.WithResultCache(ctx, b.RuleCache, version)
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// postRuleStatuses posts a commit status for each rule result with a status
+// context. Approved rules report success, rules that failed to evaluate
+// report an error, and all other rules report pending.
+func (b *Base) postRuleStatuses(ctx context.Context, client *github.Client, pr *github.PullRequest, result *common.Result) error {
+	rules := ruleStatusResults(result, nil, make(map[string]bool))
+	if len(rules) == 0 {
+		return nil
+	}
+
+	if b.runtimeFlags(ctx).ShadowMode {
+		zerolog.Ctx(ctx).Info().Msgf("Shadow mode is enabled, not posting %d rule statuses", len(rules))
+		return nil
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	sha := pr.GetHead().GetSHA()
+	detailsURL := b.DetailsURL(pr)
+
+	for _, r := range rules {
+		state, description := "pending", r.Description
+		switch {
+		case r.Error != nil:
+			state, description = "error", "Error evaluating rule"
+		case r.Status == common.StatusApproved:
+			state = "success"
+		}
+
+		status := &github.RepoStatus{
+			Context:     github.String(r.StatusContext),
+			State:       &state,
+			Description: &description,
+			TargetURL:   &detailsURL,
+		}
+		if err := b.postGitHubRepoStatus(ctx, client, owner, repo, sha, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ruleStatusResults returns the results in the tree that have a status
+// context. If a rule appears more than once, only the first result is used.
+func ruleStatusResults(r *common.Result, results []*common.Result, seen map[string]bool) []*common.Result {
+	if r.StatusContext != "" && !seen[r.StatusContext] {
+		seen[r.StatusContext] = true
+		results = append(results, r)
+	}
+	for _, c := range r.Children {
+		results = ruleStatusResults(c, results, seen)
+	}
+	return results
+}
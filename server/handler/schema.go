@@ -0,0 +1,63 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy"
+)
+
+// maxPolicySize is the largest policy file accepted by the validation
+// endpoint.
+const maxPolicySize = 1 << 20
+
+type ValidationResult struct {
+	Valid  bool                     `json:"valid"`
+	Errors []policy.ValidationError `json:"errors"`
+}
+
+// PolicySchema returns the JSON Schema for policy files.
+func PolicySchema() http.Handler {
+	schema := policy.Schema()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baseapp.WriteJSON(w, http.StatusOK, schema)
+	})
+}
+
+// ValidatePolicy validates the policy file in the request body and returns
+// any problems as JSON. It does not resolve references to remote policies.
+func ValidatePolicy() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicySize))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "failed to read policy").Error(), http.StatusBadRequest)
+			return
+		}
+
+		verrs := policy.ValidateConfig(data)
+		if verrs == nil {
+			verrs = []policy.ValidationError{}
+		}
+		baseapp.WriteJSON(w, http.StatusOK, &ValidationResult{
+			Valid:  len(verrs) == 0,
+			Errors: verrs,
+		})
+	})
+}
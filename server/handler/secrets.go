@@ -0,0 +1,103 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// maxSecretAnnotations is the number of annotations GitHub accepts in one
+// check run request.
+const maxSecretAnnotations = 50
+
+// SecretsCheckName returns the name of the check run that annotates possible
+// secrets found by the contains_secrets predicate.
+func (b *Base) SecretsCheckName() string {
+	return fmt.Sprintf("%s: secrets", b.PullOpts().StatusCheckContext)
+}
+
+// postSecretsCheck annotates the possible secrets found by the policy on the
+// head commit of a pull request. It does nothing if the policy does not scan
+// for secrets. The check run always has a neutral conclusion; rules that use
+// the predicate decide whether the pull request needs more approval.
+func (b *Base) postSecretsCheck(ctx context.Context, client *github.Client, pr *github.PullRequest, prctx pull.Context, config *policy.Config) {
+	if !policy.ScansSecrets(config) {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	if b.runtimeFlags(ctx).ShadowMode {
+		logger.Info().Msg("Shadow mode is enabled, not posting secrets check")
+		return
+	}
+
+	findings, err := policy.SecretFindings(ctx, prctx, config)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to scan pull request for secrets")
+		return
+	}
+
+	title := "No possible secrets found"
+	summary := "No possible secrets were found in the lines added by this pull request."
+	if len(findings) > 0 {
+		title = fmt.Sprintf("%d possible secrets found", len(findings))
+		summary = "Lines added by this pull request may contain secrets. Rules that use the `contains_secrets` predicate apply."
+		if len(findings) > maxSecretAnnotations {
+			summary += fmt.Sprintf(" Only the first %d findings are annotated.", maxSecretAnnotations)
+		}
+	}
+
+	var annotations []*github.CheckRunAnnotation
+	for i, f := range findings {
+		if i == maxSecretAnnotations {
+			break
+		}
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String(f.Path),
+			StartLine:       github.Int(f.Line),
+			EndLine:         github.Int(f.Line),
+			AnnotationLevel: github.String("warning"),
+			Title:           github.String("Possible secret"),
+			Message:         github.String(fmt.Sprintf("This line may contain a secret (%s). Remove it and rotate the credential if it is real.", f.Kind)),
+		})
+	}
+
+	opts := checkRunOptions{
+		Name:        b.SecretsCheckName(),
+		DetailsURL:  b.DetailsURL(pr),
+		Status:      "completed",
+		Conclusion:  "neutral",
+		CompletedAt: github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:       &title,
+			Summary:     &summary,
+			Annotations: annotations,
+		},
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	if err := postCheckRun(ctx, client, owner, repo, pr.GetHead().GetSHA(), &opts); err != nil {
+		logger.Warn().Err(err).Msg("Failed to post secrets check")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ShutdownGate rejects requests after the server starts shutting down, so
+// that load balancers stop routing to the server and GitHub records failed
+// deliveries instead of sending events that would be lost. It tracks the
+// requests in progress so the server can wait for them to finish.
+type ShutdownGate struct {
+	mu      sync.Mutex
+	closed  bool
+	active  int
+	drained chan struct{}
+}
+
+// Close rejects all further requests.
+func (g *ShutdownGate) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return
+	}
+	g.closed = true
+	g.drained = make(chan struct{})
+	if g.active == 0 {
+		close(g.drained)
+	}
+}
+
+// Wait blocks until the requests in progress when the gate closed finish or
+// the context is done. It returns immediately if the gate is open.
+func (g *ShutdownGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	drained := g.drained
+	g.mu.Unlock()
+
+	if drained == nil {
+		return nil
+	}
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "requests in progress did not finish")
+	}
+}
+
+// Wrap returns a handler that responds with 503 Service Unavailable once the
+// gate is closed and calls h otherwise.
+func (g *ShutdownGate) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.enter() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer g.exit()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (g *ShutdownGate) enter() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return false
+	}
+	g.active++
+	return true
+}
+
+func (g *ShutdownGate) exit() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.active--
+	if g.closed && g.active == 0 {
+		close(g.drained)
+	}
+}
@@ -0,0 +1,797 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/bluekeyes/templatetree"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/store"
+)
+
+const (
+	DefaultSlackAPIURL      = "https://slack.com/api"
+	DefaultSlackDecisionTTL = 30 * 24 * time.Hour
+
+	slackLinkTTL         = 15 * time.Minute
+	slackSignatureMaxAge = 5 * time.Minute
+	slackMaxPayloadSize  = 1 << 20
+
+	slackActionApprove = "approve"
+	slackActionReject  = "reject"
+
+	slackUserKeyPrefix     = "slack-user/"
+	slackLoginKeyPrefix    = "slack-login/"
+	slackLinkKeyPrefix     = "slack-link/"
+	slackDecisionKeyPrefix = "slack-decision/"
+	slackRequestKeyPrefix  = "slack-request/"
+)
+
+// SlackApprovalConfig configures approvals from Slack. Eligible approvers of
+// pending rules that allow the slack method receive a direct message with
+// buttons to approve or reject the rule. Slack approvals are disabled if the
+// bot token or signing secret is empty.
+type SlackApprovalConfig struct {
+	// BotToken is the bot token of the Slack app, used to send messages.
+	BotToken string `yaml:"bot_token"`
+
+	// SigningSecret is the signing secret of the Slack app, used to verify
+	// interactions.
+	SigningSecret string `yaml:"signing_secret"`
+
+	// APIURL is the base URL of the Slack Web API. If unset,
+	// DefaultSlackAPIURL is used.
+	APIURL string `yaml:"api_url"`
+
+	// TTL is how long decisions are kept. If unset, DefaultSlackDecisionTTL
+	// is used.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+func (c *SlackApprovalConfig) IsEnabled() bool {
+	return c.BotToken != "" && c.SigningSecret != ""
+}
+
+func (c *SlackApprovalConfig) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return DefaultSlackDecisionTTL
+}
+
+func (b *Base) slackApprovalsEnabled() bool {
+	return b.Store != nil && b.PullOpts().SlackApprovals.IsEnabled()
+}
+
+// slackDecision is the latest decision of a user for a rule and commit. Each
+// decision is stored under its own key, so concurrent decisions for other
+// rules or users of the same commit do not overwrite it.
+type slackDecision struct {
+	Rule      string    `json:"rule"`
+	User      string    `json:"user"`
+	Reject    bool      `json:"reject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// slackActionValue identifies the rule and commit of an approval request.
+// It is the value of the buttons in the message.
+type slackActionValue struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	SHA    string `json:"sha"`
+	Rule   string `json:"rule"`
+}
+
+func slackDecisionPrefix(owner, repo, sha string) string {
+	return fmt.Sprintf("%s%s/%s/%s/", slackDecisionKeyPrefix, owner, repo, sha)
+}
+
+func slackDecisionKey(value slackActionValue, login string) string {
+	return slackDecisionPrefix(value.Owner, value.Repo, value.SHA) + slackRecordID(value.Rule, login)
+}
+
+// slackRequestKey returns the key that records that a user was asked to
+// approve a rule for a commit.
+func slackRequestKey(value slackActionValue, login string) string {
+	return fmt.Sprintf("%s%s/%s/%d/%s/%s", slackRequestKeyPrefix, value.Owner, value.Repo, value.Number, value.SHA, slackRecordID(value.Rule, login))
+}
+
+// slackRecordID identifies a rule and user in a key. Rule names can contain
+// any character, so the ID is a hash.
+func slackRecordID(rule, login string) string {
+	sum := sha256.Sum256([]byte(rule + "\x00" + strings.ToLower(login)))
+	return hex.EncodeToString(sum[:])
+}
+
+// withSlackDecisions returns a context in which rules use the Slack
+// decisions recorded for the head commit of the pull request. Failures are
+// logged and return the context unchanged.
+func (b *Base) withSlackDecisions(ctx context.Context, prctx pull.Context) context.Context {
+	if !b.slackApprovalsEnabled() {
+		return ctx
+	}
+
+	sha := prctx.HeadSHA()
+	decisions := make(map[string][]*approval.SlackDecision)
+
+	prefix := slackDecisionPrefix(prctx.RepositoryOwner(), prctx.RepositoryName(), sha)
+	err := b.Store.Scan(ctx, prefix, func(key string, value []byte) error {
+		var d slackDecision
+		if err := json.Unmarshal(value, &d); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msgf("Ignoring invalid Slack decision %s", key)
+			return nil
+		}
+		decisions[d.Rule] = append(decisions[d.Rule], &approval.SlackDecision{
+			User:      d.User,
+			Reject:    d.Reject,
+			SHA:       sha,
+			CreatedAt: d.CreatedAt,
+		})
+		return nil
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to load Slack decisions")
+		return ctx
+	}
+	if len(decisions) == 0 {
+		return ctx
+	}
+	return approval.WithSlackDecisions(ctx, decisions)
+}
+
+// requestSlackApprovals sends a Slack message to the linked eligible
+// approvers of each pending rule that allows the slack method. Each user is
+// asked once per rule and head commit, even if the pull request is evaluated
+// concurrently. Failures are logged and do not affect the evaluation.
+func (b *Base) requestSlackApprovals(ctx context.Context, pr *github.PullRequest, prctx pull.Context, config *policy.Config, result *common.Result) {
+	if !b.slackApprovalsEnabled() || b.runtimeFlags(ctx).MuteNotifications {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	evalCtx := b.pullEvaluationContext(ctx, prctx)
+
+	slackRules := make(map[string]bool)
+	for _, r := range config.ApprovalRules {
+		if r.Options.GetMethods(evalCtx).Slack {
+			slackRules[r.Name] = true
+		}
+	}
+	if len(slackRules) == 0 {
+		return
+	}
+
+	approvers, err := policy.EligibleApprovers(evalCtx, prctx, config, result)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to list eligible approvers for Slack approvals")
+		return
+	}
+
+	owner := prctx.RepositoryOwner()
+	repo := prctx.RepositoryName()
+	sha := prctx.HeadSHA()
+
+	rules := make([]string, 0, len(approvers))
+	for rule := range approvers {
+		if slackRules[rule] {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules)
+
+	sent := 0
+	for _, rule := range rules {
+		value := slackActionValue{Owner: owner, Repo: repo, Number: pr.GetNumber(), SHA: sha, Rule: rule}
+
+		for _, user := range approvers[rule] {
+			slackID, ok, err := b.Store.Get(ctx, slackLoginKeyPrefix+strings.ToLower(user))
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to look up linked Slack account")
+				continue
+			}
+			if !ok {
+				continue
+			}
+
+			key := slackRequestKey(value, user)
+			claimed, err := b.Store.PutIfAbsent(ctx, key, []byte(user), b.PullOpts().SlackApprovals.ttl())
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to record Slack approval request")
+				continue
+			}
+			if !claimed {
+				continue
+			}
+
+			if err := b.sendSlackApprovalRequest(ctx, string(slackID), pr, value); err != nil {
+				logger.Warn().Err(err).Msgf("Failed to send Slack approval request to %s", user)
+				if err := b.Store.Delete(ctx, key); err != nil {
+					logger.Error().Err(err).Msg("Failed to remove record of failed Slack approval request")
+				}
+				continue
+			}
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		logger.Info().Msgf("Sent %d Slack approval requests", sent)
+	}
+}
+
+func (b *Base) sendSlackApprovalRequest(ctx context.Context, channel string, pr *github.PullRequest, value slackActionValue) error {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode action value")
+	}
+
+	text := fmt.Sprintf("<%s|%s/%s#%d> %s needs your approval for rule *%s*", pr.GetHTMLURL(), value.Owner, value.Repo, value.Number, pr.GetTitle(), value.Rule)
+	message := map[string]interface{}{
+		"channel": channel,
+		"text":    text,
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": text},
+			},
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					slackButton(slackActionApprove, "Approve", "primary", string(v)),
+					slackButton(slackActionReject, "Reject", "danger", string(v)),
+					map[string]interface{}{
+						"type": "button",
+						"text": map[string]string{"type": "plain_text", "text": "Details"},
+						"url":  b.DetailsURL(pr),
+					},
+				},
+			},
+		},
+	}
+	return b.callSlackAPI(ctx, "chat.postMessage", message)
+}
+
+func slackButton(actionID, text, style, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]string{"type": "plain_text", "text": text},
+		"style":     style,
+		"value":     value,
+	}
+}
+
+// callSlackAPI calls a method of the Slack Web API with the bot token.
+func (b *Base) callSlackAPI(ctx context.Context, method string, body interface{}) error {
+	config := b.PullOpts().SlackApprovals
+
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultSlackAPIURL
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode slack request")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create slack request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+config.BotToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call slack method %s", method)
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	var reply struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return errors.Wrapf(err, "failed to decode slack method %s response", method)
+	}
+	if !reply.OK {
+		return errors.Errorf("slack method %s failed: %s", method, reply.Error)
+	}
+	return nil
+}
+
+// SlackInteractions handles button clicks in Slack approval requests. The
+// request must be signed with the signing secret of the Slack app. Users who
+// have not linked their Slack account to GitHub receive a link to do so.
+type SlackInteractions struct {
+	Base
+}
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Team struct {
+		ID     string `json:"id"`
+		Domain string `json:"domain"`
+	} `json:"team"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (h *SlackInteractions) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx)
+
+	if !h.slackApprovalsEnabled() {
+		http.Error(w, "slack approvals are not enabled", http.StatusNotFound)
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, slackMaxPayloadSize))
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+
+	if err := verifySlackSignature(r.Header, body, h.PullOpts().SlackApprovals.SigningSecret, time.Now()); err != nil {
+		logger.Warn().Err(err).Msg("Rejecting Slack interaction with an invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return nil
+	}
+
+	form, err := parseSlackForm(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(form), &interaction); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return nil
+	}
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	action := interaction.Actions[0]
+	if action.ActionID != slackActionApprove && action.ActionID != slackActionReject {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	var value slackActionValue
+	if err := json.Unmarshal([]byte(action.Value), &value); err != nil || value.Rule == "" || value.SHA == "" {
+		http.Error(w, "invalid action value", http.StatusBadRequest)
+		return nil
+	}
+
+	login, linked, err := h.Store.Get(ctx, slackUserKeyPrefix+interaction.User.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to look up linked GitHub account")
+	}
+	if !linked {
+		token, err := h.newSlackLinkToken(ctx, slackLinkRequest{
+			SlackID:    interaction.User.ID,
+			Username:   interaction.User.Username,
+			TeamID:     interaction.Team.ID,
+			TeamDomain: interaction.Team.Domain,
+		})
+		if err != nil {
+			return err
+		}
+		url := fmt.Sprintf("%s/slack/link/%s", strings.TrimSuffix(h.BaseConfig.PublicURL, "/"), token)
+		h.respondSlack(ctx, interaction.ResponseURL, false, fmt.Sprintf("Link your GitHub account to approve rules from Slack: <%s|link accounts>. The link expires in %d minutes.", url, int(slackLinkTTL/time.Minute)))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	reject := action.ActionID == slackActionReject
+	if err := h.recordSlackDecision(ctx, value, string(login), reject); err != nil {
+		return err
+	}
+
+	verb := "approved"
+	if reject {
+		verb = "rejected"
+	}
+	logger.Info().Str(LogKeyAudit, "slack").Msgf("%s %s rule %q of %s/%s#%d at %s from Slack", login, verb, value.Rule, value.Owner, value.Repo, value.Number, value.SHA)
+	h.respondSlack(ctx, interaction.ResponseURL, true, fmt.Sprintf("You %s rule *%s* of %s/%s#%d as %s.", verb, value.Rule, value.Owner, value.Repo, value.Number, login))
+
+	// Slack requires a response within a few seconds, so evaluate after
+	// responding
+	evalCtx := logger.WithContext(context.Background())
+	go func() {
+		if err := h.evaluateSlackDecision(evalCtx, value); err != nil {
+			logger.Error().Err(err).Msg("Failed to evaluate pull request after Slack decision")
+		}
+	}()
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *SlackInteractions) recordSlackDecision(ctx context.Context, value slackActionValue, login string, reject bool) error {
+	d, err := json.Marshal(slackDecision{Rule: value.Rule, User: login, Reject: reject, CreatedAt: time.Now()})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode Slack decision")
+	}
+	if err := h.Store.Put(ctx, slackDecisionKey(value, login), d, h.PullOpts().SlackApprovals.ttl()); err != nil {
+		return errors.Wrap(err, "failed to save Slack decision")
+	}
+	return nil
+}
+
+func (h *SlackInteractions) evaluateSlackDecision(ctx context.Context, value slackActionValue) error {
+	installation, err := h.Installations.GetByOwner(ctx, value.Owner)
+	if err != nil {
+		return err
+	}
+
+	client, err := h.NewInstallationClient(installation.ID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := h.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, value.Owner, value.Repo, value.Number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %d", value.Number)
+	}
+
+	ctx, logger := h.preparePRContext(ctx, installation.ID, pr.GetBase().GetRepo(), value.Number)
+	if pr.GetHead().GetSHA() != value.SHA {
+		logger.Debug().Msg("Slack decision is for an old head commit, not evaluating")
+		return nil
+	}
+
+	mbrCtx := NewCrossOrgMembershipContext(client, value.Owner, h.Installations, h.ClientCreator)
+	return h.Evaluate(ctx, mbrCtx, client, v4client, pr)
+}
+
+// slackLinkRequest is the Slack account that requested a link token.
+type slackLinkRequest struct {
+	SlackID    string `json:"slack_id"`
+	Username   string `json:"username"`
+	TeamID     string `json:"team_id"`
+	TeamDomain string `json:"team_domain"`
+}
+
+func (h *SlackInteractions) newSlackLinkToken(ctx context.Context, req slackLinkRequest) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate link token")
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode link token")
+	}
+
+	token := hex.EncodeToString(b)
+	if err := h.Store.Put(ctx, slackLinkKeyPrefix+token, data, slackLinkTTL); err != nil {
+		return "", errors.Wrap(err, "failed to save link token")
+	}
+	return token, nil
+}
+
+// respondSlack replaces the message with the buttons or, if replace is
+// false, sends a message only visible to the user who clicked a button.
+// Failures are logged.
+func (h *SlackInteractions) respondSlack(ctx context.Context, responseURL string, replace bool, text string) {
+	if responseURL == "" {
+		return
+	}
+
+	body := map[string]interface{}{
+		"text":             text,
+		"replace_original": replace,
+	}
+	if !replace {
+		body["response_type"] = "ephemeral"
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to encode Slack response")
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, responseURL, bytes.NewReader(data))
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to create Slack response")
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to send Slack response")
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+}
+
+// verifySlackSignature returns an error if the request was not signed with
+// the signing secret or was signed too long ago.
+func verifySlackSignature(header http.Header, body []byte, secret string, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid request timestamp")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return errors.New("request timestamp is too old")
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(header.Get("X-Slack-Signature"), "v0="))
+	if err != nil {
+		return errors.New("signature is not a hex string")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// parseSlackForm returns the payload field of a form-encoded interaction.
+func parseSlackForm(body []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := req.ParseForm(); err != nil {
+		return "", errors.New("invalid form body")
+	}
+
+	payload := req.PostForm.Get("payload")
+	if payload == "" {
+		return "", errors.New("missing payload")
+	}
+	return payload, nil
+}
+
+// SlackLink shows the Slack account that requested a link token and asks the
+// logged in GitHub user to confirm linking it. The token is not used until the
+// user confirms, so opening a link sent by someone else does not link their
+// Slack account.
+type SlackLink struct {
+	Base
+	Sessions  *scs.Manager
+	Templates templatetree.HTMLTree
+}
+
+func (h *SlackLink) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	if !h.slackApprovalsEnabled() {
+		http.Error(w, "slack approvals are not enabled", http.StatusNotFound)
+		return nil
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := githubUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if user == "" {
+		http.Error(w, slackLinkSSOMessage, http.StatusForbidden)
+		return nil
+	}
+
+	token := pat.Param(r, "token")
+	req, ok, err := loadSlackLinkRequest(ctx, h.Store, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		http.Error(w, slackLinkExpiredMessage, http.StatusNotFound)
+		return nil
+	}
+
+	csrf, err := csrfToken(w, sess)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		User       string
+		Token      string
+		CSRFToken  string
+		Username   string
+		TeamDomain string
+	}{
+		User:       user,
+		Token:      token,
+		CSRFToken:  csrf,
+		Username:   req.Username,
+		TeamDomain: req.TeamDomain,
+	}
+	if data.Username == "" {
+		data.Username = req.SlackID
+	}
+	if data.TeamDomain == "" {
+		data.TeamDomain = req.TeamID
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	return h.Templates.ExecuteTemplate(w, "slack_link.html.tmpl", data)
+}
+
+// SlackLinkConfirm links the Slack account that requested a link token to the
+// logged in GitHub user, so that the user can approve rules from Slack.
+type SlackLinkConfirm struct {
+	Base
+	Sessions *scs.Manager
+}
+
+func (h *SlackLinkConfirm) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	if !h.slackApprovalsEnabled() {
+		http.Error(w, "slack approvals are not enabled", http.StatusNotFound)
+		return nil
+	}
+
+	sess := h.Sessions.Load(r)
+	user, err := githubUser(r, sess)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if user == "" {
+		http.Error(w, slackLinkSSOMessage, http.StatusForbidden)
+		return nil
+	}
+
+	csrf, err := sess.GetString(SessionKeyCSRFToken)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	if csrf == "" || subtle.ConstantTimeCompare([]byte(csrf), []byte(r.PostFormValue("csrf_token"))) != 1 {
+		http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+		return nil
+	}
+
+	token := pat.Param(r, "token")
+	req, ok, err := loadSlackLinkRequest(ctx, h.Store, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		http.Error(w, slackLinkExpiredMessage, http.StatusNotFound)
+		return nil
+	}
+	if err := h.Store.Delete(ctx, slackLinkKeyPrefix+token); err != nil {
+		return errors.Wrap(err, "failed to delete link token")
+	}
+
+	slackID := req.SlackID
+
+	// remove the previous link of the Slack account, if any
+	if previous, ok, err := h.Store.Get(ctx, slackUserKeyPrefix+slackID); err != nil {
+		return errors.Wrap(err, "failed to read linked GitHub account")
+	} else if ok {
+		if err := h.Store.Delete(ctx, slackLoginKeyPrefix+strings.ToLower(string(previous))); err != nil {
+			return errors.Wrap(err, "failed to unlink previous GitHub account")
+		}
+	}
+
+	if err := h.Store.Put(ctx, slackUserKeyPrefix+slackID, []byte(user), 0); err != nil {
+		return errors.Wrap(err, "failed to link Slack account")
+	}
+	if err := h.Store.Put(ctx, slackLoginKeyPrefix+strings.ToLower(user), []byte(slackID), 0); err != nil {
+		return errors.Wrap(err, "failed to link Slack account")
+	}
+
+	zerolog.Ctx(ctx).Info().Str(LogKeyAudit, "slack").Msgf("Linked Slack account %s (%s in %s) to %s", slackID, req.Username, req.TeamDomain, user)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "Your Slack account is linked to GitHub user %s. Return to Slack to approve rules.\n", user)
+	return nil
+}
+
+const (
+	slackLinkSSOMessage     = "log in with GitHub to link a Slack account, single sign-on logins cannot be linked"
+	slackLinkExpiredMessage = "the link is invalid or has expired, click a Slack button to get a new link"
+)
+
+// loadSlackLinkRequest returns the Slack account that requested the token.
+// The second result is false if the token does not exist or has expired.
+func loadSlackLinkRequest(ctx context.Context, st store.Store, token string) (*slackLinkRequest, bool, error) {
+	data, ok, err := st.Get(ctx, slackLinkKeyPrefix+token)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to read link token")
+	}
+	if !ok {
+		return nil, false, nil
+	}
+
+	var req slackLinkRequest
+	if err := json.Unmarshal(data, &req); err != nil || req.SlackID == "" {
+		return nil, false, nil
+	}
+	return &req, true, nil
+}
+
+// githubUser returns the user who made the request if GitHub authenticated
+// the user, with an OAuth login or a token. It returns an empty string for
+// single sign-on sessions, whose login comes from a claim of the identity
+// provider and is not verified by GitHub.
+func githubUser(r *http.Request, sess *scs.Session) (string, error) {
+	if auth := userAuthFromContext(r.Context()); auth != nil {
+		if auth.Token == "" {
+			return "", nil
+		}
+		return auth.Login, nil
+	}
+
+	token, err := sess.GetString(SessionKeyToken)
+	if err != nil || token == "" {
+		return "", err
+	}
+	return sess.GetString(SessionKeyUsername)
+}
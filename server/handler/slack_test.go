@@ -0,0 +1,305 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"goji.io"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/store"
+)
+
+var csrfInputPattern = regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`)
+
+func TestVerifySlackSignature(t *testing.T) {
+	const secret = "signing-secret"
+	now := time.Unix(1600000000, 0)
+	body := []byte("payload=%7B%7D")
+
+	sign := func(ts time.Time, secret string, body []byte) http.Header {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":"))
+		mac.Write(body)
+
+		h := make(http.Header)
+		h.Set("X-Slack-Request-Timestamp", timestamp)
+		h.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return h
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, verifySlackSignature(sign(now, secret, body), body, secret, now))
+		assert.NoError(t, verifySlackSignature(sign(now.Add(-time.Minute), secret, body), body, secret, now))
+	})
+
+	t.Run("wrongSecret", func(t *testing.T) {
+		err := verifySlackSignature(sign(now, "other-secret", body), body, secret, now)
+		assert.EqualError(t, err, "signature does not match")
+	})
+
+	t.Run("modifiedBody", func(t *testing.T) {
+		err := verifySlackSignature(sign(now, secret, body), []byte("payload=%7B%22a%22%7D"), secret, now)
+		assert.EqualError(t, err, "signature does not match")
+	})
+
+	t.Run("oldTimestamp", func(t *testing.T) {
+		err := verifySlackSignature(sign(now.Add(-10*time.Minute), secret, body), body, secret, now)
+		assert.EqualError(t, err, "request timestamp is too old")
+
+		err = verifySlackSignature(sign(now.Add(10*time.Minute), secret, body), body, secret, now)
+		assert.EqualError(t, err, "request timestamp is too old")
+	})
+
+	t.Run("missingTimestamp", func(t *testing.T) {
+		h := sign(now, secret, body)
+		h.Del("X-Slack-Request-Timestamp")
+		err := verifySlackSignature(h, body, secret, now)
+		assert.EqualError(t, err, "missing or invalid request timestamp")
+	})
+
+	t.Run("invalidSignature", func(t *testing.T) {
+		h := sign(now, secret, body)
+		h.Set("X-Slack-Signature", "v0=not-hex")
+		err := verifySlackSignature(h, body, secret, now)
+		assert.EqualError(t, err, "signature is not a hex string")
+	})
+}
+
+func TestSlackLink(t *testing.T) {
+	ctx := context.Background()
+
+	st := store.NewMemory()
+	base := Base{
+		Options: NewOptions(&PullEvaluationOptions{
+			SlackApprovals: SlackApprovalConfig{BotToken: "xoxb-token", SigningSecret: "secret"},
+		}),
+		Store: st,
+	}
+
+	templates, err := LoadTemplates(&FilesConfig{Templates: "../templates"})
+	require.NoError(t, err)
+
+	sessions := scs.NewCookieManager("0123456789abcdef0123456789abcdef")
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/login"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := sessions.Load(r)
+		_ = sess.PutString(w, SessionKeyUsername, "mhaypenny")
+		_ = sess.PutString(w, SessionKeyToken, r.URL.Query().Get("token"))
+	}))
+	mux.Handle(pat.Get("/slack/link/:token"), serveTest(t, &SlackLink{Base: base, Sessions: sessions, Templates: templates}))
+	mux.Handle(pat.Post("/slack/link/:token"), serveTest(t, &SlackLinkConfirm{Base: base, Sessions: sessions}))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newToken := func(t *testing.T) string {
+		token := strconv.FormatInt(time.Now().UnixNano(), 16)
+		req, err := json.Marshal(slackLinkRequest{SlackID: "U123", Username: "attacker", TeamID: "T1", TeamDomain: "acme"})
+		require.NoError(t, err)
+		require.NoError(t, st.Put(ctx, slackLinkKeyPrefix+token, req, slackLinkTTL))
+		return token
+	}
+
+	assertNotLinked := func(t *testing.T) {
+		_, linked, err := st.Get(ctx, slackUserKeyPrefix+"U123")
+		require.NoError(t, err)
+		assert.False(t, linked, "Slack account was linked")
+	}
+
+	t.Run("confirmed", func(t *testing.T) {
+		client := newSessionClient(t, srv.URL, "gho_token")
+		token := newToken(t)
+
+		res, body := get(t, client, srv.URL+"/slack/link/"+token)
+		require.Equal(t, http.StatusOK, res.StatusCode, body)
+		assert.Contains(t, body, "Link Slack user attacker in workspace acme to GitHub user mhaypenny?")
+
+		// opening the link does not link the account or use the token
+		assertNotLinked(t)
+		_, ok, err := st.Get(ctx, slackLinkKeyPrefix+token)
+		require.NoError(t, err)
+		assert.True(t, ok, "link token was deleted")
+
+		m := csrfInputPattern.FindStringSubmatch(body)
+		require.NotNil(t, m, "page does not contain a CSRF token")
+
+		res, body = post(t, client, srv.URL+"/slack/link/"+token, url.Values{"csrf_token": {m[1]}})
+		require.Equal(t, http.StatusOK, res.StatusCode, body)
+
+		login, linked, err := st.Get(ctx, slackUserKeyPrefix+"U123")
+		require.NoError(t, err)
+		assert.True(t, linked, "Slack account was not linked")
+		assert.Equal(t, "mhaypenny", string(login))
+
+		_, ok, err = st.Get(ctx, slackLinkKeyPrefix+token)
+		require.NoError(t, err)
+		assert.False(t, ok, "link token was not deleted")
+
+		require.NoError(t, st.Delete(ctx, slackUserKeyPrefix+"U123"))
+	})
+
+	t.Run("missingCSRFToken", func(t *testing.T) {
+		client := newSessionClient(t, srv.URL, "gho_token")
+		token := newToken(t)
+
+		res, _ := get(t, client, srv.URL+"/slack/link/"+token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, _ = post(t, client, srv.URL+"/slack/link/"+token, nil)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		res, _ = post(t, client, srv.URL+"/slack/link/"+token, url.Values{"csrf_token": {"0123"}})
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		assertNotLinked(t)
+	})
+
+	t.Run("singleSignOn", func(t *testing.T) {
+		client := newSessionClient(t, srv.URL, "")
+		token := newToken(t)
+
+		res, _ := get(t, client, srv.URL+"/slack/link/"+token)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		res, _ = post(t, client, srv.URL+"/slack/link/"+token, url.Values{"csrf_token": {"0123"}})
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		assertNotLinked(t)
+	})
+
+	t.Run("unknownToken", func(t *testing.T) {
+		client := newSessionClient(t, srv.URL, "gho_token")
+
+		res, _ := get(t, client, srv.URL+"/slack/link/unknown")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
+
+func TestRecordSlackDecision(t *testing.T) {
+	ctx := context.Background()
+
+	st := store.NewMemory()
+	h := &SlackInteractions{
+		Base: Base{
+			Options: NewOptions(&PullEvaluationOptions{
+				SlackApprovals: SlackApprovalConfig{BotToken: "xoxb-token", SigningSecret: "secret"},
+			}),
+			Store: st,
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := slackActionValue{Owner: "testorg", Repo: "testrepo", Number: 1, SHA: "abc123", Rule: fmt.Sprintf("rule-%d", i)}
+			assert.NoError(t, h.recordSlackDecision(ctx, value, "mhaypenny", i%2 == 0))
+		}(i)
+	}
+	wg.Wait()
+
+	decisions := make(map[string]slackDecision)
+	err := st.Scan(ctx, slackDecisionPrefix("testorg", "testrepo", "abc123"), func(key string, value []byte) error {
+		var d slackDecision
+		require.NoError(t, json.Unmarshal(value, &d))
+		decisions[d.Rule] = d
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, decisions, 10, "concurrent decisions were lost")
+	assert.Equal(t, "mhaypenny", decisions["rule-0"].User)
+	assert.True(t, decisions["rule-0"].Reject)
+	assert.False(t, decisions["rule-1"].Reject)
+
+	// a later decision replaces the earlier decision of the same user
+	value := slackActionValue{Owner: "testorg", Repo: "testrepo", Number: 1, SHA: "abc123", Rule: "rule-0"}
+	require.NoError(t, h.recordSlackDecision(ctx, value, "mhaypenny", false))
+
+	count := 0
+	err = st.Scan(ctx, slackDecisionPrefix("testorg", "testrepo", "abc123"), func(key string, value []byte) error {
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10, count)
+}
+
+type errorHandler interface {
+	ServeHTTP(w http.ResponseWriter, r *http.Request) error
+}
+
+func serveTest(t *testing.T, h errorHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h.ServeHTTP(w, r); err != nil {
+			t.Errorf("handler returned an error: %+v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+// newSessionClient returns a client with a session for mhaypenny. The session
+// has no GitHub token if token is empty, like a single sign-on session.
+func newSessionClient(t *testing.T, serverURL, token string) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	client := &http.Client{Jar: jar}
+	res, _ := get(t, client, serverURL+"/login?token="+url.QueryEscape(token))
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	return client
+}
+
+func get(t *testing.T, client *http.Client, u string) (*http.Response, string) {
+	res, err := client.Get(u)
+	require.NoError(t, err)
+	return res, readBody(t, res)
+}
+
+func post(t *testing.T, client *http.Client, u string, form url.Values) (*http.Response, string) {
+	res, err := client.PostForm(u, form)
+	require.NoError(t, err)
+	return res, readBody(t, res)
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(b)
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/snapshot"
+)
+
+// snapshotContext wraps the context to record the data used by the
+// evaluation if snapshots are enabled.
+func (b *Base) snapshotContext(prctx pull.Context) pull.Context {
+	if b.Snapshots == nil {
+		return prctx
+	}
+	return snapshot.NewRecorder(prctx)
+}
+
+// writeSnapshot writes a snapshot of the evaluation if the context recorded
+// it. Failures are logged, but do not fail the evaluation.
+func (b *Base) writeSnapshot(ctx context.Context, prctx pull.Context, fc FetchedConfig, result *common.Result) {
+	rec, ok := prctx.(*snapshot.Recorder)
+	if !ok || b.Snapshots == nil {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	path, err := b.Snapshots.Write(rec.Snapshot(string(fc.Content), result))
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to write evaluation snapshot")
+		return
+	}
+	logger.Debug().Msgf("Wrote evaluation snapshot to %s", path)
+}
@@ -0,0 +1,512 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	SSOLoginRoute    = "/api/sso/login"
+	SSOCallbackRoute = "/api/sso/callback"
+
+	SessionKeyGroups   = "groups"
+	SessionKeySSO      = "sso"
+	SessionKeySSOState = "sso_state"
+	SessionKeySSONonce = "sso_nonce"
+
+	DefaultSSOLoginClaim  = "preferred_username"
+	DefaultSSOGroupsClaim = "groups"
+
+	// ssoKeyRefreshInterval is the minimum time between loading the keys of
+	// the provider, so that tokens with unknown key IDs cannot make the
+	// server request the keys on every login attempt.
+	ssoKeyRefreshInterval = time.Minute
+)
+
+// SSOConfig configures logging in to the UI with an OpenID Connect identity
+// provider instead of GitHub. Users are identified by their GitHub login,
+// which the provider must include in a claim of the ID token, so that the
+// details page can check what they can see. Only group claims control who
+// may use the admin page and the read-only views that cover all
+// repositories: the login claim is not trusted to match the GitHub users in
+// the admin configuration.
+type SSOConfig struct {
+	// Issuer is the URL of the provider. Its discovery document must be
+	// available at Issuer + "/.well-known/openid-configuration". Single
+	// sign-on is disabled if it is empty.
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+
+	// Scopes are requested in addition to the "openid" scope.
+	Scopes []string `yaml:"scopes"`
+
+	// LoginClaim is the ID token claim that contains the GitHub login of the
+	// user. If unset, DefaultSSOLoginClaim is used.
+	LoginClaim string `yaml:"login_claim"`
+
+	// GroupsClaim is the ID token claim that lists the groups of the user.
+	// If unset, DefaultSSOGroupsClaim is used.
+	GroupsClaim string `yaml:"groups_claim"`
+
+	// AdminGroups are the groups whose members may use the admin page and
+	// API. Users who log in with single sign-on are administrators only if
+	// they are members of one of these groups.
+	AdminGroups []string `yaml:"admin_groups"`
+
+	// DashboardGroups are the groups whose members may use the read-only
+	// views that cover all repositories, like the GitHub status endpoint.
+	// Administrators may always use these views.
+	DashboardGroups []string `yaml:"dashboard_groups"`
+}
+
+func (c *SSOConfig) IsEnabled() bool {
+	return c != nil && c.Issuer != ""
+}
+
+// Validate returns an error if single sign-on is enabled but incomplete.
+func (c *SSOConfig) Validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return errors.New("client_id and client_secret are required")
+	}
+	return nil
+}
+
+// IsAdmin returns true if any of the groups may administer the server.
+func (c *SSOConfig) IsAdmin(groups []string) bool {
+	return c.IsEnabled() && anyGroup(c.AdminGroups, groups)
+}
+
+// CanViewDashboards returns true if any of the groups may use the read-only
+// views that cover all repositories.
+func (c *SSOConfig) CanViewDashboards(groups []string) bool {
+	return c.IsEnabled() && (anyGroup(c.DashboardGroups, groups) || anyGroup(c.AdminGroups, groups))
+}
+
+func anyGroup(allowed, groups []string) bool {
+	for _, a := range allowed {
+		for _, g := range groups {
+			if strings.EqualFold(a, g) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SSOProvider logs users in with an OpenID Connect identity provider. It
+// caches the discovery document and signing keys of the provider.
+type SSOProvider struct {
+	config      SSOConfig
+	redirectURL string
+	client      *http.Client
+
+	mu          sync.Mutex
+	discovery   *ssoDiscovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type ssoDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewSSOProvider returns a provider that redirects users back to the
+// callback route under the public URL of the server.
+func NewSSOProvider(config SSOConfig, publicURL string) *SSOProvider {
+	return &SSOProvider{
+		config:      config,
+		redirectURL: strings.TrimSuffix(publicURL, "/") + SSOCallbackRoute,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *SSOProvider) getDiscovery(ctx context.Context) (*ssoDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d ssoDiscovery
+	u := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, u, &d); err != nil {
+		return nil, errors.WithMessage(err, "failed to load provider configuration")
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("provider configuration is missing required endpoints")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// getKey returns the RSA signing key with the given ID. It loads the keys of
+// the provider again if the ID is unknown, so that rotated keys are found,
+// but at most once per ssoKeyRefreshInterval.
+func (p *SSOProvider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if !p.keysFetched.IsZero() && time.Since(p.keysFetched) < ssoKeyRefreshInterval {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+	p.keysFetched = time.Now()
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &jwks); err != nil {
+		return nil, errors.WithMessage(err, "failed to load provider keys")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *SSOProvider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "failed to get %s", u)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to get %s: unexpected status %d", u, res.StatusCode)
+	}
+	return errors.Wrapf(json.NewDecoder(res.Body).Decode(v), "failed to decode %s", u)
+}
+
+func (p *SSOProvider) oauth2Config(d *ssoDiscovery) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+		RedirectURL: p.redirectURL,
+		Scopes:      append([]string{"openid"}, p.config.Scopes...),
+	}
+}
+
+// ssoIdentity is the user identified by a verified ID token.
+type ssoIdentity struct {
+	Login  string
+	Groups []string
+}
+
+// verify checks the signature, issuer, audience, expiration, and nonce of an
+// ID token and returns the identity it contains.
+func (p *SSOProvider) verify(ctx context.Context, idToken, nonce string) (*ssoIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %s", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ID token")
+	}
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := d.Issuer
+	if issuer == "" {
+		issuer = p.config.Issuer
+	}
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, errors.New("ID token has the wrong issuer")
+	}
+	if !hasAudience(claims["aud"], p.config.ClientID) {
+		return nil, errors.New("ID token has the wrong audience")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("ID token is expired")
+	}
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return nil, errors.New("ID token has the wrong nonce")
+	}
+
+	loginClaim := p.config.LoginClaim
+	if loginClaim == "" {
+		loginClaim = DefaultSSOLoginClaim
+	}
+	login, _ := claims[loginClaim].(string)
+	if login == "" {
+		return nil, errors.Errorf("ID token does not contain the %q claim", loginClaim)
+	}
+
+	groupsClaim := p.config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = DefaultSSOGroupsClaim
+	}
+
+	identity := &ssoIdentity{Login: login}
+	switch groups := claims[groupsClaim].(type) {
+	case string:
+		identity.Groups = []string{groups}
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	}
+	return identity, nil
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SSOLogin redirects the user to the identity provider.
+type SSOLogin struct {
+	Provider *SSOProvider
+	Sessions *scs.Manager
+}
+
+func (h *SSOLogin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	d, err := h.Provider.getDiscovery(r.Context())
+	if err != nil {
+		return err
+	}
+
+	state, err := randomSSOValue()
+	if err != nil {
+		return err
+	}
+	nonce, err := randomSSOValue()
+	if err != nil {
+		return err
+	}
+
+	sess := h.Sessions.Load(r)
+	if err := sess.PutString(w, SessionKeySSOState, state); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+	if err := sess.PutString(w, SessionKeySSONonce, nonce); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+
+	u := h.Provider.oauth2Config(d).AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce))
+	http.Redirect(w, r, u, http.StatusFound)
+	return nil
+}
+
+// SSOCallback completes a login with the identity provider and starts a
+// session for the GitHub user in the ID token.
+type SSOCallback struct {
+	Provider *SSOProvider
+	Sessions *scs.Manager
+}
+
+func (h *SSOCallback) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	sess := h.Sessions.Load(r)
+
+	if msg := r.FormValue("error"); msg != "" {
+		http.Error(w, fmt.Sprintf("login failed: %s", msg), http.StatusUnauthorized)
+		return nil
+	}
+
+	state, err := sess.GetString(SessionKeySSOState)
+	if err != nil {
+		return errors.Wrap(err, "failed to read session")
+	}
+	nonce, err := sess.GetString(SessionKeySSONonce)
+	if err != nil {
+		return errors.Wrap(err, "failed to read session")
+	}
+	if state == "" || r.FormValue("state") != state {
+		http.Error(w, "invalid login state, try logging in again", http.StatusBadRequest)
+		return nil
+	}
+	if err := sess.Remove(w, SessionKeySSOState); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+
+	d, err := h.Provider.getDiscovery(ctx)
+	if err != nil {
+		return err
+	}
+
+	token, err := h.Provider.oauth2Config(d).Exchange(ctx, r.FormValue("code"))
+	if err != nil {
+		return errors.Wrap(err, "failed to exchange authorization code")
+	}
+
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return errors.New("token response does not contain an ID token")
+	}
+
+	identity, err := h.Provider.verify(ctx, idToken, nonce)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Rejecting single sign-on login")
+		http.Error(w, "login failed: invalid ID token", http.StatusUnauthorized)
+		return nil
+	}
+
+	groups, err := json.Marshal(identity.Groups)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode groups")
+	}
+
+	// single sign-on sessions have no GitHub token, so they last until the
+	// session expires
+	if err := sess.PutString(w, SessionKeyUsername, identity.Login); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+	if err := sess.PutString(w, SessionKeyToken, ""); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+	if err := sess.PutTime(w, SessionKeyTokenExpiry, time.Time{}); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+	if err := sess.PutString(w, SessionKeyGroups, string(groups)); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+	if err := sess.PutBool(w, SessionKeySSO, true); err != nil {
+		return errors.Wrap(err, "failed to save session")
+	}
+
+	zerolog.Ctx(ctx).Info().Str(LogKeyAudit, "sso").Strs("groups", identity.Groups).Msgf("User %s logged in with single sign-on", identity.Login)
+
+	target, err := sess.GetString(SessionKeyRedirect)
+	if err != nil {
+		return errors.Wrap(err, "failed to read session")
+	}
+	if target == "" {
+		target = "/"
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+	return nil
+}
+
+// sessionSSO returns true if the session was created by a single sign-on
+// login. Sessions created before the flag was saved are recognized by their
+// groups, which are only saved by single sign-on logins.
+func sessionSSO(sess *scs.Session) (bool, error) {
+	sso, err := sess.GetBool(SessionKeySSO)
+	if err != nil || sso {
+		return sso, err
+	}
+	groups, err := sess.GetString(SessionKeyGroups)
+	return groups != "", err
+}
+
+// sessionGroups returns the single sign-on groups saved in the session.
+func sessionGroups(sess *scs.Session) ([]string, error) {
+	value, err := sess.GetString(SessionKeyGroups)
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	var groups []string
+	if err := json.Unmarshal([]byte(value), &groups); err != nil {
+		return nil, nil
+	}
+	return groups, nil
+}
+
+func randomSSOValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate login state")
+	}
+	return hex.EncodeToString(b), nil
+}
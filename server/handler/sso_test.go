@@ -0,0 +1,104 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSOGetKey(t *testing.T) {
+	ctx := context.Background()
+
+	var fetches int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer": %q, "authorization_endpoint": "%[1]s/auth", "token_endpoint": "%[1]s/token", "jwks_uri": "%[1]s/keys"}`, srv.URL)
+		case "/keys":
+			fetches++
+			fmt.Fprint(w, `{"keys": [{"kid": "known", "kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewSSOProvider(SSOConfig{Issuer: srv.URL}, "https://policy-bot.example.com")
+
+	key, err := p.getKey(ctx, "known")
+	require.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.Equal(t, 1, fetches)
+
+	_, err = p.getKey(ctx, "unknown")
+	assert.EqualError(t, err, `unknown signing key "unknown"`)
+	_, err = p.getKey(ctx, "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 1, fetches, "unknown keys should not load the keys again within the refresh interval")
+
+	p.keysFetched = time.Now().Add(-2 * ssoKeyRefreshInterval)
+	_, err = p.getKey(ctx, "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 2, fetches, "unknown keys should load the keys again after the refresh interval")
+
+	_, err = p.getKey(ctx, "known")
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches, "known keys should not load the keys again")
+}
+
+func TestAdminUser(t *testing.T) {
+	b := &Base{
+		Admin: &AdminConfig{Users: []string{"octocat"}},
+		SSO:   &SSOConfig{Issuer: "https://sso.example.com", AdminGroups: []string{"admins"}},
+	}
+
+	tests := map[string]struct {
+		Auth  userAuth
+		Admin bool
+	}{
+		"githubAdmin":    {Auth: userAuth{Login: "octocat"}, Admin: true},
+		"githubUser":     {Auth: userAuth{Login: "mhaypenny"}},
+		"ssoAdminGroup":  {Auth: userAuth{Login: "mhaypenny", SSO: true, Groups: []string{"admins"}}, Admin: true},
+		"ssoAdminClaim":  {Auth: userAuth{Login: "octocat", SSO: true}},
+		"ssoOtherGroups": {Auth: userAuth{Login: "octocat", SSO: true, Groups: []string{"developers"}}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			auth := test.Auth
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			r = r.WithContext(withUserAuth(r.Context(), &auth))
+			w := httptest.NewRecorder()
+
+			user, err := b.adminUser(w, r, nil)
+			require.NoError(t, err)
+			if test.Admin {
+				assert.Equal(t, auth.Login, user)
+			} else {
+				assert.Empty(t, user)
+				assert.Equal(t, http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
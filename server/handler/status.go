@@ -23,6 +23,8 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/approval"
 )
 
 type Status struct {
@@ -49,10 +51,10 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 		return err
 	}
 
-	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	ctx, logger := h.prepareRepoContext(ctx, installationID, repo)
 
 	// ignore contexts that are not ours
-	if !strings.HasPrefix(event.GetContext(), h.PullOpts.StatusCheckContext) {
+	if !strings.HasPrefix(event.GetContext(), h.PullOpts().StatusCheckContext) {
 		logger.Debug().Msgf("Ignoring context event for '%s'", event.GetContext())
 		return nil
 	}
@@ -60,7 +62,7 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 	sender := event.GetSender()
 	commitSHA := event.GetCommit().GetSHA()
 
-	if sender.GetLogin() != h.PullOpts.AppName+"[bot]" {
+	if sender.GetLogin() != h.PullOpts().AppName+"[bot]" {
 		auditMessage := fmt.Sprintf(
 			"Entity '%s' overwrote status check '%s' on ref=%s to status='%s' description='%s' targetURL='%s'",
 			sender.GetLogin(),
@@ -81,9 +83,60 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 			Description: &auditMessage,
 		}
 
-		_, _, err := client.Repositories.CreateStatus(ctx, ownerName, repoName, commitSHA, status)
+		return retryMutation(ctx, func() error {
+			_, _, err := client.Repositories.CreateStatus(ctx, ownerName, repoName, commitSHA, status)
+			return err
+		})
+	}
+
+	// a final policy status may change the approval of pull requests stacked
+	// on the pull requests for this commit
+	if event.GetState() != "pending" && strings.HasPrefix(event.GetContext(), h.PullOpts().StatusCheckContext+": ") {
+		return h.evaluateStackedPullRequests(ctx, client, installationID, &event)
+	}
+
+	return nil
+}
+
+// evaluateStackedPullRequests evaluates the open pull requests whose base
+// branch is a branch with the status commit at its head.
+func (h *Status) evaluateStackedPullRequests(ctx context.Context, client *github.Client, installationID int64, event *github.StatusEvent) error {
+	if len(event.Branches) == 0 {
+		return nil
+	}
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
 		return err
 	}
 
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	mbrCtx := NewCrossOrgMembershipContext(client, owner, h.Installations, h.ClientCreator)
+
+	for _, branch := range event.Branches {
+		if branch.GetCommit().GetSHA() != event.GetCommit().GetSHA() {
+			continue
+		}
+
+		opts := &github.PullRequestListOptions{
+			State:       "open",
+			Base:        branch.GetName(),
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		prs, _, err := client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pull requests stacked on %s", branch.GetName())
+		}
+
+		for _, pr := range prs {
+			ctx, logger := h.preparePRContext(ctx, installationID, event.GetRepo(), pr.GetNumber())
+			logger.Debug().Msgf("Evaluating pull request stacked on %s", branch.GetName())
+
+			if err := h.EvaluateTriggered(ctx, mbrCtx, client, v4client, pr, approval.TriggerStatuses); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,320 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	DefaultTimelineMaxEntries = 200
+	DefaultTimelineTTL        = 90 * 24 * time.Hour
+
+	timelineKeyPrefix = "timeline/"
+)
+
+// TimelineConfig configures the timeline of rule changes shown on the
+// details page of each pull request.
+type TimelineConfig struct {
+	// Enabled records the status and approvers of each rule after every
+	// evaluation triggered by an event and lists the changes on the details
+	// page.
+	Enabled bool `yaml:"enabled"`
+
+	// MaxEntries is the number of changes kept for each pull request. Older
+	// changes are dropped first. If unset, DefaultTimelineMaxEntries is used.
+	MaxEntries int `yaml:"max_entries"`
+
+	// TTL is how long the timeline is kept after the last change. If unset,
+	// DefaultTimelineTTL is used.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// timelineRuleState is the status and approvers of a rule after the last
+// recorded evaluation.
+type timelineRuleState struct {
+	Status    string   `json:"status"`
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// timelineEntry is a change to a rule. Status is empty if the status did not
+// change, in which case only the approvers changed.
+type timelineEntry struct {
+	Time   time.Time `json:"time"`
+	Rule   string    `json:"rule"`
+	SHA    string    `json:"sha"`
+	From   string    `json:"from,omitempty"`
+	Status string    `json:"status,omitempty"`
+
+	Event  string `json:"event,omitempty"`
+	Action string `json:"action,omitempty"`
+	Actor  string `json:"actor,omitempty"`
+
+	// Approved lists users whose approvals started counting. Invalidated
+	// lists users whose approvals stopped counting, like after a push, and
+	// Dismissed lists users whose reviews were dismissed.
+	Approved    []string `json:"approved,omitempty"`
+	Invalidated []string `json:"invalidated,omitempty"`
+	Dismissed   []string `json:"dismissed,omitempty"`
+}
+
+// Cause describes the event that triggered the change, like
+// "pull_request_review dismissed by alice", or returns an empty string if
+// the event is unknown.
+func (e timelineEntry) Cause() string {
+	if e.Event == "" {
+		return ""
+	}
+	cause := e.Event
+	if e.Action != "" {
+		cause += " " + e.Action
+	}
+	if e.Actor != "" {
+		cause += " by " + e.Actor
+	}
+	return cause
+}
+
+type timelineRecord struct {
+	Rules   map[string]timelineRuleState `json:"rules"`
+	Entries []timelineEntry              `json:"entries"`
+}
+
+func timelineKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%d", timelineKeyPrefix, owner, repo, number)
+}
+
+func (b *Base) timelineEnabled() bool {
+	return b.Store != nil && b.PullOpts().Timeline.Enabled
+}
+
+// timelineEvent is the webhook event that triggered an evaluation.
+type timelineEvent struct {
+	Type   string
+	Action string
+	Actor  string
+}
+
+type timelineEventKey struct{}
+
+// TimelineEvents wraps an event handler so that evaluations know which event
+// triggered them and the timeline can show it.
+func TimelineEvents(h githubapp.EventHandler) githubapp.EventHandler {
+	return &timelineEventHandler{EventHandler: h}
+}
+
+type timelineEventHandler struct {
+	githubapp.EventHandler
+}
+
+func (h *timelineEventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event struct {
+		Action string       `json:"action"`
+		Sender *github.User `json:"sender"`
+	}
+	if err := json.Unmarshal(payload, &event); err == nil {
+		ctx = context.WithValue(ctx, timelineEventKey{}, &timelineEvent{
+			Type:   eventType,
+			Action: event.Action,
+			Actor:  event.Sender.GetLogin(),
+		})
+	}
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
+
+func timelineEventFromContext(ctx context.Context) *timelineEvent {
+	if e, ok := ctx.Value(timelineEventKey{}).(*timelineEvent); ok {
+		return e
+	}
+	return &timelineEvent{}
+}
+
+// recordTimeline adds the rules whose status or approvers changed since the
+// last recorded evaluation to the timeline of the pull request. Failures are
+// logged and do not affect the evaluation.
+func (b *Base) recordTimeline(ctx context.Context, pr *github.PullRequest, result *common.Result) {
+	if !b.timelineEnabled() {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	config := b.PullOpts().Timeline
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := timelineKey(owner, repo, pr.GetNumber())
+
+	record, err := b.loadTimeline(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load timeline")
+		return
+	}
+	if record == nil {
+		record = &timelineRecord{}
+	}
+
+	rules := timelineRules(result, make(map[string]timelineRuleState))
+	entries := timelineChanges(record.Rules, rules, timelineEventFromContext(ctx), pr.GetHead().GetSHA(), time.Now())
+	if len(entries) == 0 {
+		return
+	}
+
+	maxEntries := config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultTimelineMaxEntries
+	}
+	record.Rules = rules
+	record.Entries = append(record.Entries, entries...)
+	if len(record.Entries) > maxEntries {
+		record.Entries = record.Entries[len(record.Entries)-maxEntries:]
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode timeline")
+		return
+	}
+
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = DefaultTimelineTTL
+	}
+	if err := b.Store.Put(ctx, key, value, ttl); err != nil {
+		logger.Error().Err(err).Msg("Failed to save timeline")
+	}
+}
+
+// timelineRules returns the state of the rules in the result.
+func timelineRules(r *common.Result, rules map[string]timelineRuleState) map[string]timelineRuleState {
+	if len(r.Children) == 0 {
+		status := r.Status.String()
+		if r.Error != nil {
+			status = "error"
+		}
+		rules[r.Name] = timelineRuleState{Status: status, Approvers: r.Approvers}
+		return rules
+	}
+	for _, c := range r.Children {
+		timelineRules(c, rules)
+	}
+	return rules
+}
+
+// timelineChanges returns an entry for each rule whose state differs between
+// the previous and current evaluations. Rules are listed in name order.
+func timelineChanges(previous, current map[string]timelineRuleState, event *timelineEvent, sha string, now time.Time) []timelineEntry {
+	var entries []timelineEntry
+	for _, name := range sortedRuleNames(current) {
+		prev, cur := previous[name], current[name]
+
+		entry := timelineEntry{
+			Time:   now,
+			Rule:   name,
+			SHA:    sha,
+			Event:  event.Type,
+			Action: event.Action,
+			Actor:  event.Actor,
+		}
+		if prev.Status != cur.Status {
+			entry.From = prev.Status
+			entry.Status = cur.Status
+		}
+
+		entry.Approved = missingUsers(cur.Approvers, prev.Approvers)
+		removed := missingUsers(prev.Approvers, cur.Approvers)
+		if event.Type == "pull_request_review" && event.Action == "dismissed" {
+			entry.Dismissed = removed
+		} else {
+			entry.Invalidated = removed
+		}
+
+		if entry.Status != "" || len(entry.Approved) > 0 || len(removed) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func sortedRuleNames(rules map[string]timelineRuleState) []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// missingUsers returns the users in a that are not in b.
+func missingUsers(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, u := range b {
+		in[u] = true
+	}
+
+	var missing []string
+	for _, u := range a {
+		if !in[u] {
+			missing = append(missing, u)
+		}
+	}
+	return missing
+}
+
+func (b *Base) loadTimeline(ctx context.Context, key string) (*timelineRecord, error) {
+	value, exists, err := b.Store.Get(ctx, key)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var record timelineRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Ignoring invalid timeline record")
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// timelineEntries returns the timeline of a pull request with the newest
+// change first, or nil if the timeline is not enabled.
+func (b *Base) timelineEntries(ctx context.Context, owner, repo string, number int) ([]timelineEntry, error) {
+	if !b.timelineEnabled() {
+		return nil, nil
+	}
+
+	record, err := b.loadTimeline(ctx, timelineKey(owner, repo, number))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load timeline")
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	entries := make([]timelineEntry, len(record.Entries))
+	for i, e := range record.Entries {
+		entries[len(entries)-1-i] = e
+	}
+	return entries, nil
+}
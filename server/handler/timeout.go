@@ -0,0 +1,245 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	DefaultRetryDelay = time.Minute
+	DefaultMaxRetries = 3
+
+	retryCheckInterval = 15 * time.Second
+	retryKeyPrefix     = "retry/"
+)
+
+// TimeoutConfig limits how long policy evaluations may take, so that a slow
+// GitHub API or a very large pull request cannot block an evaluation
+// forever. Timeouts are disabled if they are zero.
+type TimeoutConfig struct {
+	// Evaluation limits the evaluation of the whole policy.
+	Evaluation time.Duration `yaml:"evaluation"`
+
+	// Rule limits the evaluation of each approval rule. Rules that finish in
+	// time still contribute to the result, so a policy with an "or" may be
+	// approved even if one of its rules times out.
+	Rule time.Duration `yaml:"rule"`
+
+	// RetryDelay is the time between a timed out evaluation and its retry.
+	// If unset, DefaultRetryDelay is used.
+	RetryDelay time.Duration `yaml:"retry_delay"`
+
+	// MaxRetries is the number of times a timed out evaluation is retried
+	// before reporting an error. If unset, DefaultMaxRetries is used.
+	MaxRetries int `yaml:"max_retries"`
+}
+
+func (c *TimeoutConfig) IsEnabled() bool {
+	return c.Evaluation > 0 || c.Rule > 0
+}
+
+type retryRecord struct {
+	Owner    string    `json:"owner"`
+	Repo     string    `json:"repo"`
+	Number   int       `json:"number"`
+	Attempts int       `json:"attempts"`
+	Due      time.Time `json:"due"`
+}
+
+func retryKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%d", retryKeyPrefix, owner, repo, number)
+}
+
+// isTimeout returns true if the evaluation failed because the context or
+// one of its rules ran out of time.
+func isTimeout(ctx context.Context, err error) bool {
+	return ctx.Err() == context.DeadlineExceeded || errors.Cause(err) == context.DeadlineExceeded
+}
+
+// evaluationTimedOut posts a pending status for a pull request whose
+// evaluation timed out and schedules a retry. If the store is not configured
+// or all retries were used, it posts an error status instead.
+func (b *Base) evaluationTimedOut(ctx context.Context, client *github.Client, pr *github.PullRequest, result *common.Result) (Evaluation, error) {
+	zerolog.Ctx(ctx).Warn().Err(result.Error).Msg("Policy evaluation timed out")
+
+	eval := Evaluation{State: "pending", Description: "Evaluation timed out, will retry", Result: result}
+	if !b.scheduleRetry(ctx, pr) {
+		eval.State = "error"
+		eval.Description = "Evaluation timed out"
+	}
+	return eval, b.PostStatus(ctx, client, pr, eval.State, eval.Description)
+}
+
+// scheduleRetry records that the evaluation of a pull request should be
+// retried and returns false if no retry was scheduled.
+func (b *Base) scheduleRetry(ctx context.Context, pr *github.PullRequest) bool {
+	if b.Store == nil {
+		return false
+	}
+
+	logger := zerolog.Ctx(ctx)
+	config := b.PullOpts().Timeouts
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := retryKey(owner, repo, pr.GetNumber())
+
+	record := retryRecord{Owner: owner, Repo: repo, Number: pr.GetNumber()}
+	value, exists, err := b.Store.Get(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read retry record")
+		return false
+	}
+	if exists {
+		if err := json.Unmarshal(value, &record); err != nil {
+			logger.Warn().Err(err).Msg("Replacing invalid retry record")
+		}
+	}
+
+	maxRetries := config.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	if record.Attempts >= maxRetries {
+		logger.Warn().Msgf("Not retrying evaluation after %d attempts", record.Attempts)
+		b.clearRetry(ctx, pr)
+		return false
+	}
+
+	delay := config.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	record.Attempts++
+	record.Due = time.Now().Add(delay)
+
+	value, err = json.Marshal(record)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode retry record")
+		return false
+	}
+	if err := b.Store.Put(ctx, key, value, 0); err != nil {
+		logger.Error().Err(err).Msg("Failed to save retry record")
+		return false
+	}
+	return true
+}
+
+// clearRetry forgets the scheduled retry for a pull request, if any.
+func (b *Base) clearRetry(ctx context.Context, pr *github.PullRequest) {
+	if b.Store == nil || !b.PullOpts().Timeouts.IsEnabled() {
+		return
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	if err := b.Store.Delete(ctx, retryKey(owner, repo, pr.GetNumber())); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to clear retry record")
+	}
+}
+
+// EvaluationRetrier periodically evaluates pull requests again after their
+// evaluation timed out.
+type EvaluationRetrier struct {
+	Base
+}
+
+// Run retries evaluations until the context is canceled.
+func (r *EvaluationRetrier) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RetryAll(ctx); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to retry timed out evaluations")
+			}
+		}
+	}
+}
+
+// RetryAll evaluates every pull request with a retry that is due. It does
+// nothing if timeouts were disabled by reloading the server configuration.
+func (r *EvaluationRetrier) RetryAll(ctx context.Context) error {
+	if r.Store == nil || !r.PullOpts().Timeouts.IsEnabled() {
+		return nil
+	}
+
+	now := time.Now()
+	return r.Store.Scan(ctx, retryKeyPrefix, func(key string, value []byte) error {
+		var record retryRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("key", key).Msg("Ignoring invalid retry record")
+			return nil
+		}
+		if now.Before(record.Due) {
+			return nil
+		}
+
+		logger := zerolog.Ctx(ctx).With().Str("pull_request", fmt.Sprintf("%s/%s#%d", record.Owner, record.Repo, record.Number)).Logger()
+		if err := r.retry(logger.WithContext(ctx), key, record); err != nil {
+			logger.Error().Err(err).Msg("Failed to retry evaluation")
+		}
+		return nil
+	})
+}
+
+func (r *EvaluationRetrier) retry(ctx context.Context, key string, record retryRecord) error {
+	installation, err := r.Installations.GetByOwner(ctx, record.Owner)
+	if err != nil {
+		return err
+	}
+
+	client, err := r.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	v4client, err := r.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, record.Owner, record.Repo, record.Number)
+	if err != nil {
+		if isNotFound(err) {
+			return r.Store.Delete(ctx, key)
+		}
+		return errors.Wrap(err, "failed to get pull request")
+	}
+	if pr.GetState() != "open" {
+		return r.Store.Delete(ctx, key)
+	}
+
+	ctx, logger := r.preparePRContext(ctx, installation.ID, pr.GetBase().GetRepo(), record.Number)
+	logger.Info().Msgf("Retrying timed out evaluation, attempt %d", record.Attempts)
+
+	mbrCtx := NewCrossOrgMembershipContext(client, record.Owner, r.Installations, r.ClientCreator)
+	return r.Evaluate(ctx, mbrCtx, client, v4client, pr)
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alexedwards/scs"
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+)
+
+// userAuth identifies the user who made a request to the UI or API.
+type userAuth struct {
+	Login string
+
+	// Token is the OAuth token, GitHub App user token, or personal access
+	// token of the user. It is empty for sessions created before tokens were
+	// saved.
+	Token string
+
+	// Client makes requests with Token. It is nil if Token is empty.
+	Client *github.Client
+
+	// Groups are the groups of a user who logged in with single sign-on.
+	Groups []string
+
+	// SSO is true if the user logged in with single sign-on. Their login
+	// comes from a claim chosen by the identity provider, so it is never
+	// matched against lists of GitHub users, like administrators.
+	SSO bool
+}
+
+type userAuthKey struct{}
+
+func withUserAuth(ctx context.Context, auth *userAuth) context.Context {
+	return context.WithValue(ctx, userAuthKey{}, auth)
+}
+
+func userAuthFromContext(ctx context.Context) *userAuth {
+	auth, _ := ctx.Value(userAuthKey{}).(*userAuth)
+	return auth
+}
+
+// requestUser returns the login of the user who made the request, either
+// from the token authenticated by RequireLogin or from the session.
+func requestUser(r *http.Request, sess *scs.Session) (string, error) {
+	if auth := userAuthFromContext(r.Context()); auth != nil {
+		return auth.Login, nil
+	}
+	return sess.GetString(SessionKeyUsername)
+}
+
+// authorizationToken returns the token from an Authorization header using
+// the "token" or "Bearer" scheme.
+func authorizationToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	for _, scheme := range []string{"token ", "bearer "} {
+		if len(header) > len(scheme) && strings.EqualFold(header[:len(scheme)], scheme) {
+			return strings.TrimSpace(header[len(scheme):]), true
+		}
+	}
+	return "", false
+}
+
+// tokenKind describes a GitHub token by its prefix.
+func tokenKind(token string) string {
+	switch {
+	case strings.HasPrefix(token, "github_pat_"):
+		return "fine-grained personal access token"
+	case strings.HasPrefix(token, "ghp_"):
+		return "personal access token"
+	case strings.HasPrefix(token, "ghu_"):
+		return "GitHub App user token"
+	case strings.HasPrefix(token, "gho_"):
+		return "OAuth token"
+	}
+	return "unknown token"
+}
+
+// authenticateToken returns the user who owns a token or nil if GitHub
+// rejects the token.
+func authenticateToken(ctx context.Context, c githubapp.Config, token string) (*userAuth, error) {
+	client, err := newTokenClient(ctx, c, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, res, err := client.Users.Get(ctx, "")
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusUnauthorized {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get github user")
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Authenticated %s with a %s", user.GetLogin(), tokenKind(token))
+	return &userAuth{Login: user.GetLogin(), Token: token, Client: client}, nil
+}
+
+// newTokenClient returns a client for the GitHub API that makes requests with
+// the token.
+func newTokenClient(ctx context.Context, c githubapp.Config, token string) (*github.Client, error) {
+	return newUserClient(c, oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+}
+
+// newUserClient returns a client for the GitHub API that makes requests with
+// the given HTTP client.
+func newUserClient(c githubapp.Config, httpClient *http.Client) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+
+	// TODO(bkeyes): this should be in baseapp or something
+	// I should be able to get a valid, parsed URL
+	u, err := url.Parse(strings.TrimSuffix(c.V3APIURL, "/") + "/")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse github url")
+	}
+	client.BaseURL = u
+	return client, nil
+}
+
+// requestSSO returns true if the user who made the request logged in with
+// single sign-on.
+func requestSSO(r *http.Request, sess *scs.Session) (bool, error) {
+	if auth := userAuthFromContext(r.Context()); auth != nil {
+		return auth.SSO, nil
+	}
+	return sessionSSO(sess)
+}
+
+// requestGroups returns the single sign-on groups of the user who made the
+// request. It is empty for users who did not log in with single sign-on.
+func requestGroups(r *http.Request) []string {
+	if auth := userAuthFromContext(r.Context()); auth != nil {
+		return auth.Groups
+	}
+	return nil
+}
+
+// userCanAccess returns true if the token of the user in the context can read
+// the pull request. Fine-grained personal access tokens and GitHub App user
+// tokens only grant access to some repositories, so a user may not be able to
+// see a pull request with their token even though they can see it on GitHub.
+// Revoked tokens cannot access any pull request. It returns true if the user
+// has no token.
+func userCanAccess(ctx context.Context, owner, repo string, number int) (bool, error) {
+	auth := userAuthFromContext(ctx)
+	if auth == nil || auth.Client == nil {
+		return true, nil
+	}
+
+	_, res, err := auth.Client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		if res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusUnauthorized) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to get pull request as user")
+	}
+	return true, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+)
+
+// maxCheckOutputLength is slightly less than the maximum length GitHub allows
+// for check run summaries.
+const maxCheckOutputLength = 65000
+
+// PolicyChange identifies a version of a policy file to validate and the
+// version it replaces. The check run is posted to Owner/Repo, which also
+// contains the previous version of the policy at BaseRef. If BaseRef is
+// empty, all rules are reported as added.
+type PolicyChange struct {
+	Owner   string
+	Repo    string
+	BaseRef string
+	Path    string
+
+	// HeadOwner, HeadRepo, and HeadSHA locate the new version of the policy.
+	// The head repository differs from Owner/Repo for pull requests from
+	// forks.
+	HeadOwner string
+	HeadRepo  string
+	HeadSHA   string
+}
+
+// PolicyValidationCheckName returns the name of the check run that reports
+// the results of policy validation.
+func (b *Base) PolicyValidationCheckName() string {
+	return fmt.Sprintf("%s: policy validation", b.PullOpts().StatusCheckContext)
+}
+
+// ValidatePolicyChange parses a new version of a policy file and posts a
+// check run on the commit with any errors and the changes to the effective
+// rules.
+func (b *Base) ValidatePolicyChange(ctx context.Context, client *github.Client, change PolicyChange) error {
+	logger := zerolog.Ctx(ctx)
+
+	newBytes, _, err := b.ConfigFetcher.fetchConfig(ctx, client, change.HeadOwner, change.HeadRepo, change.HeadSHA, change.Path)
+	if err != nil {
+		return errors.WithMessage(err, "failed to fetch new policy")
+	}
+
+	var oldBytes []byte
+	if change.BaseRef != "" {
+		oldBytes, _, err = b.ConfigFetcher.fetchConfig(ctx, client, change.Owner, change.Repo, change.BaseRef, change.Path)
+		if err != nil {
+			return errors.WithMessage(err, "failed to fetch previous policy")
+		}
+	}
+
+	var conclusion, title string
+	var summary bytes.Buffer
+
+	switch _, parseErr := policy.ParseConfig(newBytes); {
+	case newBytes == nil:
+		conclusion = "neutral"
+		title = fmt.Sprintf("No policy found at %s", change.Path)
+		summary.WriteString("The policy file was removed. Pull requests will not be evaluated by this policy.\n")
+
+	case parseErr != nil:
+		conclusion = "failure"
+		title = fmt.Sprintf("Invalid policy at %s", change.Path)
+		fmt.Fprintf(&summary, "The policy could not be parsed:\n\n```\n%s\n```\n", parseErr.Error())
+
+	default:
+		conclusion = "success"
+		title = fmt.Sprintf("Valid policy at %s", change.Path)
+	}
+
+	if newBytes != nil {
+		changes, err := policy.DiffConfigs(oldBytes, newBytes)
+		if err != nil {
+			logger.Debug().Err(err).Msg("Failed to compute policy changes")
+		} else {
+			writePolicyChanges(&summary, changes)
+		}
+	}
+
+	logger.Info().Msgf("Posting policy validation for %s/%s@%s: %s", change.Owner, change.Repo, change.HeadSHA, title)
+
+	output := summary.String()
+	if len(output) > maxCheckOutputLength {
+		output = output[:maxCheckOutputLength] + "\n\n(truncated)"
+	}
+
+	completedAt := github.Timestamp{Time: time.Now()}
+	_, _, err = client.Checks.CreateCheckRun(ctx, change.Owner, change.Repo, github.CreateCheckRunOptions{
+		Name:        b.PolicyValidationCheckName(),
+		HeadSHA:     change.HeadSHA,
+		Status:      github.String("completed"),
+		Conclusion:  &conclusion,
+		CompletedAt: &completedAt,
+		Output: &github.CheckRunOutput{
+			Title:   &title,
+			Summary: &output,
+		},
+	})
+	return errors.Wrap(err, "failed to create policy validation check")
+}
+
+func writePolicyChanges(w *bytes.Buffer, changes []policy.Change) {
+	if len(changes) == 0 {
+		w.WriteString("\nThe effective rules are unchanged.\n")
+		return
+	}
+
+	w.WriteString("\n### Changes\n")
+	for _, c := range changes {
+		fmt.Fprintf(w, "\n**%s** (%s)\n\n```diff\n", c.Name, c.Kind)
+		writeDiffLines(w, "-", c.Old)
+		writeDiffLines(w, "+", c.New)
+		w.WriteString("```\n")
+	}
+}
+
+func writeDiffLines(w *bytes.Buffer, prefix, s string) {
+	if s == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		fmt.Fprintf(w, "%s %s\n", prefix, line)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func logLevel(c LoggingConfig) (zerolog.Level, error) {
+	if c.Level == "" {
+		return zerolog.DebugLevel, nil
+	}
+	level, err := zerolog.ParseLevel(c.Level)
+	if err != nil {
+		return zerolog.NoLevel, errors.Wrap(err, "invalid logging level")
+	}
+	return level, nil
+}
+
+// SetConfigLoader sets the function that reads the configuration when the
+// server reloads it. If it is set before calling Start, the server also
+// reloads the configuration when it receives SIGHUP.
+func (s *Server) SetConfigLoader(load func() (*Config, error)) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.loadConfig = load
+}
+
+// Reload reads the configuration again and applies the evaluation options and
+// the logging level without interrupting in-flight evaluations. Caches are
+// flushed so that results computed with the previous options are discarded.
+// Changes to other settings are logged and take effect after a restart.
+func (s *Server) Reload(ctx context.Context) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.loadConfig == nil {
+		return errors.New("the server configuration cannot be reloaded")
+	}
+
+	c, err := s.loadConfig()
+	if err != nil {
+		return errors.WithMessage(err, "failed to reload server configuration")
+	}
+
+	level, err := logLevel(c.Logging)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Ctx(ctx)
+	if changed := restartRequired(s.config, c); len(changed) > 0 {
+		logger.Warn().Msgf("Changes to %s require a restart and were not applied", strings.Join(changed, ", "))
+	}
+
+	s.options.Store(&c.Options)
+	s.logs.SetLevel(level)
+
+	if err := s.flushCaches(ctx); err != nil {
+		return err
+	}
+
+	logger.Info().Msg("Reloaded server configuration")
+	return nil
+}
+
+func (s *Server) reloadOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		case <-signals:
+			if err := s.Reload(ctx); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to reload server configuration")
+			}
+		}
+	}
+}
+
+// restartRequired returns the settings that differ between the running and
+// the reloaded configuration but can only change when the server starts.
+func restartRequired(running, reloaded *Config) []string {
+	settings := []struct {
+		name              string
+		running, reloaded interface{}
+	}{
+		{"server", running.Server, reloaded.Server},
+		{"github", running.Github, reloaded.Github},
+		{"logging.text", running.Logging.Text, reloaded.Logging.Text},
+		{"logging.debug", running.Logging.Debug, reloaded.Logging.Debug},
+		{"sessions", running.Sessions, reloaded.Sessions},
+		{"options.app_name", running.Options.AppName, reloaded.Options.AppName},
+		{"options.policy_path", running.Options.PolicyPath, reloaded.Options.PolicyPath},
+		{"options.branch_policy_paths", running.Options.BranchPolicyPaths, reloaded.Options.BranchPolicyPaths},
+		{"options.disapproval_escalation.interval", running.Options.DisapprovalEscalation.Interval, reloaded.Options.DisapprovalEscalation.Interval},
+		{"options.review_reminders.check_interval", running.Options.ReviewReminders.CheckInterval, reloaded.Options.ReviewReminders.CheckInterval},
+		{"files", running.Files, reloaded.Files},
+		{"datadog", running.Datadog, reloaded.Datadog},
+		{"on_call", running.OnCall, reloaded.OnCall},
+		{"jira", running.Jira, reloaded.Jira},
+		{"identity", running.Identity, reloaded.Identity},
+		{"store", running.Store, reloaded.Store},
+		{"scheduler", running.Scheduler, reloaded.Scheduler},
+		{"attestation", running.Attestation, reloaded.Attestation},
+		{"audit_log", running.AuditLog, reloaded.AuditLog},
+		{"queue", running.Queue, reloaded.Queue},
+		{"shutdown", running.Shutdown, reloaded.Shutdown},
+		{"policy_sync", running.PolicySync, reloaded.PolicySync},
+		{"admin", running.Admin, reloaded.Admin},
+		{"deliveries", running.Deliveries, reloaded.Deliveries},
+		{"sso", running.SSO, reloaded.SSO},
+		{"rule_cache", running.RuleCache, reloaded.RuleCache},
+		{"snapshots", running.Snapshots, reloaded.Snapshots},
+	}
+
+	var changed []string
+	for _, setting := range settings {
+		if !reflect.DeepEqual(setting.running, setting.reloaded) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
@@ -15,11 +15,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs"
@@ -33,7 +37,18 @@ import (
 	"goji.io"
 	"goji.io/pat"
 
+	"github.com/palantir/policy-bot/attestation"
+	"github.com/palantir/policy-bot/auditlog"
+	"github.com/palantir/policy-bot/delivery"
+	"github.com/palantir/policy-bot/eventqueue"
+	"github.com/palantir/policy-bot/identity"
+	"github.com/palantir/policy-bot/jira"
+	"github.com/palantir/policy-bot/oncall"
+	"github.com/palantir/policy-bot/policysync"
+	"github.com/palantir/policy-bot/scheduler"
 	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/snapshot"
+	"github.com/palantir/policy-bot/store"
 	"github.com/palantir/policy-bot/version"
 )
 
@@ -44,6 +59,28 @@ const (
 type Server struct {
 	config *Config
 	base   *baseapp.Server
+
+	// options, logs, and flushCaches apply reloaded configuration
+	options     *handler.Options
+	logs        *handler.LevelWriter
+	flushCaches func(ctx context.Context) error
+
+	reloadMu   sync.Mutex
+	loadConfig func() (*Config, error)
+
+	escalator *handler.DisapprovalEscalator
+	reminder  *handler.ReviewReminder
+	retrier   *handler.EvaluationRetrier
+	scheduler *scheduler.Scheduler
+	worker    *eventqueue.Worker
+	policies  *policysync.Syncer
+
+	gate           *handler.ShutdownGate
+	store          store.Store
+	queue          eventqueue.Queue
+	resumeHandlers []githubapp.EventHandler
+	stopWorker     context.CancelFunc
+	workerDone     chan struct{}
 }
 
 // New instantiates a new Server.
@@ -53,7 +90,12 @@ func New(c *Config) (*Server, error) {
 	if c.Logging.Text {
 		out = zerolog.ConsoleWriter{Out: out}
 	}
-	logger := zerolog.New(out).With().Timestamp().Logger()
+	level, err := logLevel(c.Logging)
+	if err != nil {
+		return nil, err
+	}
+	logs := handler.NewLevelWriter(out, level)
+	logger := zerolog.New(logs).With().Timestamp().Logger()
 
 	lifetime, _ := time.ParseDuration(c.Sessions.Lifetime)
 	if lifetime == 0 {
@@ -97,23 +139,135 @@ func New(c *Config) (*Server, error) {
 		return nil, errors.Wrap(err, "failed to initialize Github app client")
 	}
 
+	st, err := store.New(c.Store)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize store")
+	}
+
 	basePolicyHandler := handler.Base{
 		ClientCreator: cc,
 		BaseConfig:    &c.Server,
 		Installations: githubapp.NewInstallationsService(appClient),
+		Store:         st,
+		Debug:         &c.Logging.Debug,
+		Admin:         &c.Admin,
+		SSO:           &c.SSO,
+		Logs:          logs,
 
-		PullOpts: &c.Options,
+		Options: handler.NewOptions(&c.Options),
 		ConfigFetcher: &handler.ConfigFetcher{
-			PolicyPath: c.Options.PolicyPath,
+			PolicyPath:        c.Options.PolicyPath,
+			BranchPolicyPaths: c.Options.BranchPolicyPaths,
 		},
 	}
+	if c.Attestation.IsEnabled() {
+		signer, err := attestation.NewSigner(c.Attestation)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize attestation signer")
+		}
+		basePolicyHandler.Attestor = &handler.Attestor{
+			Signer:     signer,
+			CheckRun:   c.Attestation.CheckRun,
+			Endpoint:   c.Attestation.Endpoint,
+			HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	var policies *policysync.Syncer
+	if c.PolicySync.IsEnabled() {
+		policies, err = policysync.New(c.PolicySync, &http.Client{Timeout: 10 * time.Second})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize central policies")
+		}
+		basePolicyHandler.ConfigFetcher.Central = policies
+	}
+	if c.AuditLog.IsEnabled() {
+		basePolicyHandler.AuditLog = auditlog.NewChecker(c.AuditLog)
+	}
+	if c.OnCall.IsEnabled() {
+		basePolicyHandler.OnCall = oncall.NewClient(c.OnCall, &http.Client{Timeout: 10 * time.Second})
+	}
+	if c.Identity.IsEnabled() {
+		basePolicyHandler.Identity = identity.NewClient(c.Identity, &http.Client{Timeout: 10 * time.Second})
+	}
+	if c.Jira.IsEnabled() {
+		basePolicyHandler.Jira = jira.NewClient(c.Jira, &http.Client{Timeout: 10 * time.Second})
+	}
+	if c.Deliveries.IsEnabled() {
+		basePolicyHandler.Deliveries = delivery.New(c.Deliveries, st)
+	}
+	if c.RuleCache.IsEnabled() {
+		basePolicyHandler.RuleCache = c.RuleCache.NewCache()
+	}
+	if c.Snapshots.IsEnabled() {
+		basePolicyHandler.Snapshots, err = snapshot.NewWriter(c.Snapshots)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize evaluation snapshots")
+		}
+	}
 
-	dispatcher := githubapp.NewDefaultEventDispatcher(c.Github,
+	eventHandlers := []githubapp.EventHandler{
 		&handler.PullRequest{Base: basePolicyHandler},
+		&handler.Push{Base: basePolicyHandler},
 		&handler.PullRequestReview{Base: basePolicyHandler},
+		&handler.PullRequestReviewThread{Base: basePolicyHandler},
+		&handler.MergeGroup{Base: basePolicyHandler},
+		&handler.Dispatch{Base: basePolicyHandler},
+		&handler.CheckRun{Base: basePolicyHandler},
 		&handler.IssueComment{Base: basePolicyHandler},
 		&handler.Status{Base: basePolicyHandler},
-	)
+		&handler.Installation{Base: basePolicyHandler},
+	}
+	for i, h := range eventHandlers {
+		eventHandlers[i] = handler.TimelineEvents(h)
+	}
+
+	var queue eventqueue.Queue
+	var worker *eventqueue.Worker
+	var receiver *eventqueue.Receiver
+	if c.Queue.IsEnabled() {
+		q, err := eventqueue.New(c.Queue)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize event queue")
+		}
+		if c.Queue.IsWorker() {
+			rec := basePolicyHandler.Deliveries
+			if rec == nil {
+				ttl := c.Queue.DeduplicationTTL
+				if ttl <= 0 {
+					ttl = eventqueue.DefaultDeduplicationTTL
+				}
+				rec = delivery.New(delivery.Config{Enabled: true, TTL: ttl}, st)
+			}
+			worker = eventqueue.NewWorker(c.Queue, q, rec, eventHandlers...)
+		}
+		if c.Queue.IsReceiver() {
+			receiver = eventqueue.NewReceiver(q, eventHandlers...)
+		}
+		queue = q
+	}
+
+	var sched *scheduler.Scheduler
+	if c.Scheduler.IsEnabled() {
+		sched = scheduler.New(c.Scheduler)
+		for i, h := range eventHandlers {
+			eventHandlers[i] = sched.Wrap(h)
+		}
+	}
+
+	dispatchHandlers := eventHandlers
+	if receiver != nil {
+		dispatchHandlers = []githubapp.EventHandler{receiver}
+	}
+	resumeHandlers := append([]githubapp.EventHandler(nil), dispatchHandlers...)
+
+	// with a queue, workers record deliveries when they process them; a
+	// receiver that also recorded them would make workers skip every event
+	if basePolicyHandler.Deliveries != nil && !c.Queue.IsEnabled() {
+		for i, h := range dispatchHandlers {
+			dispatchHandlers[i] = basePolicyHandler.Deliveries.Wrap(h)
+		}
+	}
+	dispatcher := githubapp.NewDefaultEventDispatcher(c.Github, dispatchHandlers...)
 
 	templates, err := handler.LoadTemplates(&c.Files)
 	if err != nil {
@@ -121,12 +275,15 @@ func New(c *Config) (*Server, error) {
 	}
 
 	mux := base.Mux()
+	gate := &handler.ShutdownGate{}
 
 	// webhook route
-	mux.Handle(pat.Post(githubapp.DefaultWebhookRoute), dispatcher)
+	mux.Handle(pat.Post(githubapp.DefaultWebhookRoute), gate.Wrap(dispatcher))
 
 	// additional API routes
-	mux.Handle(pat.Get("/api/health"), handler.Health())
+	mux.Handle(pat.Get("/api/health"), gate.Wrap(handler.Health()))
+	mux.Handle(pat.Get("/api/schema/policy"), handler.PolicySchema())
+	mux.Handle(pat.Post("/api/validate"), handler.ValidatePolicy())
 	mux.Handle(pat.Get(oauth2.DefaultRoute), oauth2.NewHandler(
 		oauth2.GetConfig(c.Github, nil),
 		oauth2.ForceTLS(forceTLS),
@@ -135,6 +292,17 @@ func New(c *Config) (*Server, error) {
 		}),
 		oauth2.OnLogin(handler.Login(c.Github, sessions)),
 	))
+	if c.SSO.IsEnabled() {
+		sso := handler.NewSSOProvider(c.SSO, c.Server.PublicURL)
+		mux.Handle(pat.Get(handler.SSOLoginRoute), hatpear.Try(&handler.SSOLogin{
+			Provider: sso,
+			Sessions: sessions,
+		}))
+		mux.Handle(pat.Get(handler.SSOCallbackRoute), hatpear.Try(&handler.SSOCallback{
+			Provider: sso,
+			Sessions: sessions,
+		}))
+	}
 
 	// additional client routes
 	mux.Handle(pat.Get("/favicon.ico"), http.RedirectHandler("/static/img/favicon.ico", http.StatusFound))
@@ -146,18 +314,104 @@ func New(c *Config) (*Server, error) {
 	}))
 
 	details := goji.SubMux()
-	details.Use(handler.RequireLogin(sessions))
+	details.Use(handler.RequireLogin(c.Github, sessions, &c.SSO))
 	details.Handle(pat.Get("/:owner/:repo/:number"), hatpear.Try(&handler.Details{
+		Base:         basePolicyHandler,
+		GithubConfig: &c.Github,
+		Sessions:     sessions,
+		Templates:    templates,
+	}))
+	details.Handle(pat.Post("/:owner/:repo/:number/reviewers"), hatpear.Try(&handler.RequestReviewers{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	}))
+	details.Handle(pat.Post("/:owner/:repo/:number/debug"), hatpear.Try(&handler.DebugLogging{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	}))
+	mux.Handle(pat.New("/details/*"), details)
+
+	audit := goji.SubMux()
+	audit.Use(handler.RequireLogin(c.Github, sessions, &c.SSO))
+	audit.Handle(pat.Get("/:owner/:repo/:number"), hatpear.Try(&handler.Audit{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	}))
+	mux.Handle(pat.New("/api/audit/*"), audit)
+
+	detailsAPI := goji.SubMux()
+	detailsAPI.Use(handler.RequireLogin(c.Github, sessions, &c.SSO))
+	detailsAPI.Handle(pat.Get("/:owner/:repo/:number"), hatpear.Try(&handler.DetailsAPI{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	}))
+	mux.Handle(pat.New("/api/details/*"), detailsAPI)
+
+	policyDiff := goji.SubMux()
+	policyDiff.Use(handler.RequireLogin(c.Github, sessions, &c.SSO))
+	policyDiff.Handle(pat.Post("/:owner/:repo"), hatpear.Try(&handler.PolicyDiff{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	}))
+	mux.Handle(pat.New("/api/policy-diff/*"), policyDiff)
+
+	s := &Server{
+		config:      c,
+		options:     basePolicyHandler.Options,
+		logs:        logs,
+		flushCaches: basePolicyHandler.FlushCaches,
+	}
+
+	requireLogin := handler.RequireLogin(c.Github, sessions, &c.SSO)
+	mux.Handle(pat.Get("/admin"), requireLogin(hatpear.Try(&handler.Admin{
 		Base:      basePolicyHandler,
 		Sessions:  sessions,
 		Templates: templates,
+	})))
+	mux.Handle(pat.Post("/admin"), requireLogin(hatpear.Try(&handler.AdminAction{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+		Reload:   s.Reload,
+	})))
+	mux.Handle(pat.Get("/api/admin"), requireLogin(hatpear.Try(&handler.AdminAPI{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	})))
+	mux.Handle(pat.Get("/api/github/status"), requireLogin(hatpear.Try(&handler.GitHubStatus{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	})))
+	mux.Handle(pat.Post("/api/slack/interactions"), hatpear.Try(&handler.SlackInteractions{
+		Base: basePolicyHandler,
 	}))
-	mux.Handle(pat.New("/details/*"), details)
+	mux.Handle(pat.Get("/slack/link/:token"), requireLogin(hatpear.Try(&handler.SlackLink{
+		Base:      basePolicyHandler,
+		Sessions:  sessions,
+		Templates: templates,
+	})))
+	mux.Handle(pat.Post("/slack/link/:token"), requireLogin(hatpear.Try(&handler.SlackLinkConfirm{
+		Base:     basePolicyHandler,
+		Sessions: sessions,
+	})))
+
+	s.base = base
+	s.scheduler = sched
+	s.worker = worker
+	s.policies = policies
+	s.gate = gate
+	s.store = st
+	s.queue = queue
+	s.resumeHandlers = resumeHandlers
 
-	return &Server{
-		config: c,
-		base:   base,
-	}, nil
+	// the escalator always runs so that escalation can be enabled by
+	// reloading the configuration
+	s.escalator = &handler.DisapprovalEscalator{
+		Base:       basePolicyHandler,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	s.reminder = &handler.ReviewReminder{Base: basePolicyHandler}
+	s.retrier = &handler.EvaluationRetrier{Base: basePolicyHandler}
+	return s, nil
 }
 
 // Start is blocking and long-running
@@ -167,5 +421,52 @@ func (s *Server) Start() error {
 			return err
 		}
 	}
-	return s.base.Start()
+	if s.scheduler != nil {
+		s.scheduler.Start()
+	}
+	if s.escalator != nil {
+		logger := s.base.Logger()
+		go s.escalator.Run(logger.WithContext(context.Background()))
+	}
+	if s.reminder != nil {
+		logger := s.base.Logger()
+		go s.reminder.Run(logger.WithContext(context.Background()))
+	}
+	if s.retrier != nil {
+		logger := s.base.Logger()
+		go s.retrier.Run(logger.WithContext(context.Background()))
+	}
+	if s.loadConfig != nil {
+		logger := s.base.Logger()
+		go s.reloadOnSignal(logger.WithContext(context.Background()))
+	}
+	if s.policies != nil {
+		logger := s.base.Logger()
+		go s.policies.Run(logger.WithContext(context.Background()))
+	}
+	if s.worker != nil {
+		logger := s.base.Logger()
+		ctx, cancel := context.WithCancel(logger.WithContext(context.Background()))
+		s.stopWorker = cancel
+		s.workerDone = make(chan struct{})
+		go func() {
+			defer close(s.workerDone)
+			s.worker.Run(ctx)
+		}()
+	}
+
+	logger := s.base.Logger()
+	go s.resumePending(logger.WithContext(context.Background()))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.base.Start()
+	}()
+	go func() {
+		errs <- s.shutdownOnSignal(logger.WithContext(context.Background()), signals)
+	}()
+	return <-errs
 }
@@ -0,0 +1,127 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/eventqueue"
+)
+
+const (
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+type ShutdownConfig struct {
+	// Timeout is how long the server waits for in-flight evaluations to
+	// finish after it receives SIGTERM or SIGINT. If unset,
+	// DefaultShutdownTimeout is used.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Shutdown stops accepting webhooks, waits for in-flight evaluations to finish
+// until the context is done, and saves queued events that were not processed
+// to the store. The next server to start with the same store processes the
+// saved events.
+func (s *Server) Shutdown(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+	s.gate.Close()
+
+	var pending []eventqueue.Event
+
+	// webhooks handled synchronously evaluate within the request
+	drainErr := s.gate.Wait(ctx)
+
+	if s.scheduler != nil {
+		events, err := s.scheduler.Shutdown(ctx)
+		if err != nil && drainErr == nil {
+			drainErr = err
+		}
+		for _, e := range events {
+			pending = append(pending, eventqueue.Event{Type: e.Type, DeliveryID: e.DeliveryID, Payload: e.Payload})
+		}
+	}
+
+	if s.stopWorker != nil {
+		s.stopWorker()
+		select {
+		case <-s.workerDone:
+		case <-ctx.Done():
+			if drainErr == nil {
+				drainErr = errors.Wrap(ctx.Err(), "in-flight events did not finish")
+			}
+		}
+	}
+
+	// events in a memory queue only exist in this server; events in other
+	// queues are delivered again if they were not acknowledged
+	if q, ok := s.queue.(*eventqueue.Memory); ok {
+		pending = append(pending, q.Drain()...)
+	}
+
+	if drainErr != nil {
+		logger.Warn().Err(drainErr).Msg("Shutting down before all in-flight evaluations finished")
+	}
+
+	if len(pending) > 0 {
+		// the shutdown deadline may have passed, but saving events is
+		// required to not lose them
+		saveCtx := logger.WithContext(context.Background())
+		if err := eventqueue.SavePending(saveCtx, s.store, pending); err != nil {
+			return errors.WithMessage(err, "failed to save queued events")
+		}
+		logger.Info().Msgf("Saved %d queued events to resume after restart", len(pending))
+	}
+
+	logger.Info().Msg("Server shut down")
+	return nil
+}
+
+// shutdownOnSignal shuts down the server after it receives a signal and
+// returns the result of Shutdown.
+func (s *Server) shutdownOnSignal(ctx context.Context, signals chan os.Signal) error {
+	sig := <-signals
+	signal.Stop(signals)
+
+	timeout := s.config.Shutdown.Timeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	zerolog.Ctx(ctx).Info().Msgf("Received %s, shutting down within %s", sig, timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// resumePending processes the events saved by a server that shut down.
+func (s *Server) resumePending(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	count, err := eventqueue.ResumePending(ctx, s.store, s.resumeHandlers...)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to resume queued events")
+	}
+	if count > 0 {
+		logger.Info().Msgf("Resumed %d events queued before the last shutdown", count)
+	}
+}
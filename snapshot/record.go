@@ -0,0 +1,354 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// callKey returns the key of a method call in a snapshot.
+func callKey(method string, args ...string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+	return fmt.Sprintf("%s(%s)", method, strings.Join(quoted, ", "))
+}
+
+// mergedSinceArg returns the argument that identifies a call to
+// AuthorMergedPullRequests. The time is relative to the start of the
+// evaluation, because it is usually computed from the current time.
+func mergedSinceArg(start, since time.Time) string {
+	if since.IsZero() {
+		return "all"
+	}
+	return start.Sub(since).Round(time.Minute).String()
+}
+
+// linesArg returns the argument that identifies the lines of a call to Blame.
+func linesArg(lines []int) string {
+	s := make([]string, len(lines))
+	for i, n := range lines {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// changedFilesIter is the recorded result of ChangedFilesIter. Complete is
+// true if the iteration visited all changed files.
+type changedFilesIter struct {
+	Files    []*pull.File `json:"files"`
+	Complete bool         `json:"complete"`
+}
+
+// Recorder is a pull.Context that records the results of the methods called
+// on it, so that an evaluation using it can be replayed from a snapshot.
+type Recorder struct {
+	pull.Context
+	start time.Time
+
+	mu    sync.Mutex
+	calls map[string]*Call
+}
+
+// NewRecorder returns a Recorder that wraps the context.
+func NewRecorder(prctx pull.Context) *Recorder {
+	return &Recorder{
+		Context: prctx,
+		start:   time.Now(),
+		calls:   make(map[string]*Call),
+	}
+}
+
+var _ pull.Context = &Recorder{}
+
+// Snapshot returns a snapshot with the recorded calls and the result.
+func (r *Recorder) Snapshot(policy string, result *common.Result) *Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := make(map[string]*Call, len(r.calls))
+	for k, c := range r.calls {
+		calls[k] = c
+	}
+
+	return &Snapshot{
+		Locator:     r.Locator(),
+		Owner:       r.RepositoryOwner(),
+		Repository:  r.RepositoryName(),
+		HeadSHA:     r.HeadSHA(),
+		EvaluatedAt: r.start,
+		Policy:      policy,
+		Calls:       calls,
+		Result:      NewResult(result),
+	}
+}
+
+func (r *Recorder) record(key string, value interface{}, err error) {
+	c := &Call{}
+	if err != nil {
+		c.Error = err.Error()
+	} else {
+		b, merr := json.Marshal(value)
+		if merr != nil {
+			return
+		}
+		c.Value = b
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[key] = c
+}
+
+func (r *Recorder) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	v, err := r.Context.IsTeamMember(ctx, team, user)
+	r.record(callKey("IsTeamMember", team, user), v, err)
+	return v, err
+}
+
+func (r *Recorder) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	v, err := r.Context.IsOrgMember(ctx, org, user)
+	r.record(callKey("IsOrgMember", org, user), v, err)
+	return v, err
+}
+
+func (r *Recorder) OrganizationMembership(ctx context.Context, org, user string) (*pull.OrgMembership, error) {
+	v, err := r.Context.OrganizationMembership(ctx, org, user)
+	r.record(callKey("OrganizationMembership", org, user), v, err)
+	return v, err
+}
+
+func (r *Recorder) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	v, err := r.Context.IsCollaborator(ctx, org, repo, user, desiredPerm)
+	r.record(callKey("IsCollaborator", org, repo, user, desiredPerm), v, err)
+	return v, err
+}
+
+func (r *Recorder) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	v, err := r.Context.TeamMembers(ctx, team)
+	r.record(callKey("TeamMembers", team), v, err)
+	return v, err
+}
+
+func (r *Recorder) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	v, err := r.Context.OrganizationMembers(ctx, org)
+	r.record(callKey("OrganizationMembers", org), v, err)
+	return v, err
+}
+
+func (r *Recorder) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	v, err := r.Context.RepositoryCollaborators(ctx, org, repo, desiredPerm)
+	r.record(callKey("RepositoryCollaborators", org, repo, desiredPerm), v, err)
+	return v, err
+}
+
+func (r *Recorder) RepositoryTopics(ctx context.Context) ([]string, error) {
+	v, err := r.Context.RepositoryTopics(ctx)
+	r.record(callKey("RepositoryTopics"), v, err)
+	return v, err
+}
+
+func (r *Recorder) RepositoryCustomProperties(ctx context.Context) (map[string][]string, error) {
+	v, err := r.Context.RepositoryCustomProperties(ctx)
+	r.record(callKey("RepositoryCustomProperties"), v, err)
+	return v, err
+}
+
+func (r *Recorder) TargetRepository(ctx context.Context) (*pull.Repository, error) {
+	v, err := r.Context.TargetRepository(ctx)
+	r.record(callKey("TargetRepository"), v, err)
+	return v, err
+}
+
+func (r *Recorder) SourceRepository(ctx context.Context) (*pull.Repository, error) {
+	v, err := r.Context.SourceRepository(ctx)
+	r.record(callKey("SourceRepository"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Author(ctx context.Context) (string, error) {
+	v, err := r.Context.Author(ctx)
+	r.record(callKey("Author"), v, err)
+	return v, err
+}
+
+func (r *Recorder) CreatedAt(ctx context.Context) (time.Time, error) {
+	v, err := r.Context.CreatedAt(ctx)
+	r.record(callKey("CreatedAt"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Title(ctx context.Context) (string, error) {
+	v, err := r.Context.Title(ctx)
+	r.record(callKey("Title"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Body(ctx context.Context) (string, error) {
+	v, err := r.Context.Body(ctx)
+	r.record(callKey("Body"), v, err)
+	return v, err
+}
+
+func (r *Recorder) ChangedFiles(ctx context.Context) ([]*pull.File, error) {
+	v, err := r.Context.ChangedFiles(ctx)
+	r.record(callKey("ChangedFiles"), v, err)
+	return v, err
+}
+
+func (r *Recorder) ChangedFilesIter(ctx context.Context, fn func(*pull.File) bool) error {
+	var files []*pull.File
+	complete := true
+	err := r.Context.ChangedFilesIter(ctx, func(f *pull.File) bool {
+		files = append(files, f)
+		if !fn(f) {
+			complete = false
+			return false
+		}
+		return true
+	})
+
+	key := callKey("ChangedFilesIter")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// keep the most complete iteration, since later calls may stop at a
+	// different file than earlier calls
+	var last changedFilesIter
+	if c, ok := r.calls[key]; ok && c.Value != nil {
+		_ = json.Unmarshal(c.Value, &last)
+	}
+	if last.Complete || len(last.Files) > len(files) {
+		return err
+	}
+
+	b, merr := json.Marshal(changedFilesIter{Files: files, Complete: complete && err == nil})
+	if merr != nil {
+		return err
+	}
+	c := &Call{Value: b}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	r.calls[key] = c
+	return err
+}
+
+func (r *Recorder) FileContents(ctx context.Context, path string) (*pull.FileContents, error) {
+	v, err := r.Context.FileContents(ctx, path)
+	r.record(callKey("FileContents", path), v, err)
+	return v, err
+}
+
+func (r *Recorder) BaseFileContent(ctx context.Context, path string) ([]byte, error) {
+	v, err := r.Context.BaseFileContent(ctx, path)
+	r.record(callKey("BaseFileContent", path), v, err)
+	return v, err
+}
+
+func (r *Recorder) RefFileContent(ctx context.Context, path, ref string) ([]byte, error) {
+	v, err := r.Context.RefFileContent(ctx, path, ref)
+	r.record(callKey("RefFileContent", path, ref), v, err)
+	return v, err
+}
+
+func (r *Recorder) Commits(ctx context.Context) ([]*pull.Commit, error) {
+	v, err := r.Context.Commits(ctx)
+	r.record(callKey("Commits"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Comments(ctx context.Context) ([]*pull.Comment, error) {
+	v, err := r.Context.Comments(ctx)
+	r.record(callKey("Comments"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Reviews(ctx context.Context) ([]*pull.Review, error) {
+	v, err := r.Context.Reviews(ctx)
+	r.record(callKey("Reviews"), v, err)
+	return v, err
+}
+
+func (r *Recorder) RequestedReviewers(ctx context.Context) (*pull.ReviewRequests, error) {
+	v, err := r.Context.RequestedReviewers(ctx)
+	r.record(callKey("RequestedReviewers"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Branches(ctx context.Context) (string, string, error) {
+	base, head, err := r.Context.Branches(ctx)
+	r.record(callKey("Branches"), []string{base, head}, err)
+	return base, head, err
+}
+
+func (r *Recorder) BaseChangedAt(ctx context.Context) (time.Time, error) {
+	v, err := r.Context.BaseChangedAt(ctx)
+	r.record(callKey("BaseChangedAt"), v, err)
+	return v, err
+}
+
+func (r *Recorder) ReviewThreads(ctx context.Context) ([]*pull.ReviewThread, error) {
+	v, err := r.Context.ReviewThreads(ctx)
+	r.record(callKey("ReviewThreads"), v, err)
+	return v, err
+}
+
+func (r *Recorder) TargetCommits(ctx context.Context) ([]*pull.Commit, error) {
+	v, err := r.Context.TargetCommits(ctx)
+	r.record(callKey("TargetCommits"), v, err)
+	return v, err
+}
+
+func (r *Recorder) Timeline(ctx context.Context) ([]*pull.TimelineEvent, error) {
+	v, err := r.Context.Timeline(ctx)
+	r.record(callKey("Timeline"), v, err)
+	return v, err
+}
+
+func (r *Recorder) BranchPullRequest(ctx context.Context, branch string) (*pull.PullRequestRef, error) {
+	v, err := r.Context.BranchPullRequest(ctx, branch)
+	r.record(callKey("BranchPullRequest", branch), v, err)
+	return v, err
+}
+
+func (r *Recorder) AuthorMergedPullRequests(ctx context.Context, since time.Time) (int, error) {
+	v, err := r.Context.AuthorMergedPullRequests(ctx, since)
+	r.record(callKey("AuthorMergedPullRequests", mergedSinceArg(r.start, since)), v, err)
+	return v, err
+}
+
+func (r *Recorder) CommitChangedFiles(ctx context.Context, sha string) ([]*pull.File, error) {
+	v, err := r.Context.CommitChangedFiles(ctx, sha)
+	r.record(callKey("CommitChangedFiles", sha), v, err)
+	return v, err
+}
+
+func (r *Recorder) Blame(ctx context.Context, path string, lines []int) (map[int]*pull.BlameLine, error) {
+	v, err := r.Context.Blame(ctx, path, lines)
+	r.record(callKey("Blame", path, linesArg(lines)), v, err)
+	return v, err
+}
@@ -0,0 +1,299 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Context is a pull.Context that returns the results recorded in a snapshot.
+// Methods that were not called by the recorded evaluation return an error.
+type Context struct {
+	snapshot *Snapshot
+	start    time.Time
+}
+
+// NewContext returns a Context for the snapshot.
+func NewContext(s *Snapshot) *Context {
+	return &Context{snapshot: s, start: time.Now()}
+}
+
+var _ pull.Context = &Context{}
+
+// load decodes the recorded result of a call into value.
+func (c *Context) load(key string, value interface{}) error {
+	call, ok := c.snapshot.Calls[key]
+	if !ok {
+		return errors.Errorf("%s was not recorded in the snapshot", key)
+	}
+	if call.Error != "" {
+		return errors.New(call.Error)
+	}
+	if err := json.Unmarshal(call.Value, value); err != nil {
+		return errors.Wrapf(err, "failed to decode recorded result of %s", key)
+	}
+	return nil
+}
+
+func (c *Context) Locator() string         { return c.snapshot.Locator }
+func (c *Context) HeadSHA() string         { return c.snapshot.HeadSHA }
+func (c *Context) RepositoryOwner() string { return c.snapshot.Owner }
+func (c *Context) RepositoryName() string  { return c.snapshot.Repository }
+
+func (c *Context) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	var v bool
+	err := c.load(callKey("IsTeamMember", team, user), &v)
+	return v, err
+}
+
+func (c *Context) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	var v bool
+	err := c.load(callKey("IsOrgMember", org, user), &v)
+	return v, err
+}
+
+func (c *Context) OrganizationMembership(ctx context.Context, org, user string) (*pull.OrgMembership, error) {
+	var v *pull.OrgMembership
+	err := c.load(callKey("OrganizationMembership", org, user), &v)
+	return v, err
+}
+
+func (c *Context) IsCollaborator(ctx context.Context, org, repo, user, desiredPerm string) (bool, error) {
+	var v bool
+	err := c.load(callKey("IsCollaborator", org, repo, user, desiredPerm), &v)
+	return v, err
+}
+
+func (c *Context) TeamMembers(ctx context.Context, team string) ([]string, error) {
+	var v []string
+	err := c.load(callKey("TeamMembers", team), &v)
+	return v, err
+}
+
+func (c *Context) OrganizationMembers(ctx context.Context, org string) ([]string, error) {
+	var v []string
+	err := c.load(callKey("OrganizationMembers", org), &v)
+	return v, err
+}
+
+func (c *Context) RepositoryCollaborators(ctx context.Context, org, repo, desiredPerm string) ([]string, error) {
+	var v []string
+	err := c.load(callKey("RepositoryCollaborators", org, repo, desiredPerm), &v)
+	return v, err
+}
+
+func (c *Context) RepositoryTopics(ctx context.Context) ([]string, error) {
+	var v []string
+	err := c.load(callKey("RepositoryTopics"), &v)
+	return v, err
+}
+
+func (c *Context) RepositoryCustomProperties(ctx context.Context) (map[string][]string, error) {
+	var v map[string][]string
+	err := c.load(callKey("RepositoryCustomProperties"), &v)
+	return v, err
+}
+
+func (c *Context) TargetRepository(ctx context.Context) (*pull.Repository, error) {
+	var v *pull.Repository
+	err := c.load(callKey("TargetRepository"), &v)
+	return v, err
+}
+
+func (c *Context) SourceRepository(ctx context.Context) (*pull.Repository, error) {
+	var v *pull.Repository
+	err := c.load(callKey("SourceRepository"), &v)
+	return v, err
+}
+
+func (c *Context) Author(ctx context.Context) (string, error) {
+	var v string
+	err := c.load(callKey("Author"), &v)
+	return v, err
+}
+
+func (c *Context) CreatedAt(ctx context.Context) (time.Time, error) {
+	var v time.Time
+	err := c.load(callKey("CreatedAt"), &v)
+	return v, err
+}
+
+func (c *Context) Title(ctx context.Context) (string, error) {
+	var v string
+	err := c.load(callKey("Title"), &v)
+	return v, err
+}
+
+func (c *Context) Body(ctx context.Context) (string, error) {
+	var v string
+	err := c.load(callKey("Body"), &v)
+	return v, err
+}
+
+func (c *Context) ChangedFiles(ctx context.Context) ([]*pull.File, error) {
+	var v []*pull.File
+	err := c.load(callKey("ChangedFiles"), &v)
+	return v, err
+}
+
+// ChangedFilesIter uses the recorded result of ChangedFiles if it exists and
+// the recorded iteration otherwise. It returns an error if the iteration
+// needs more files than the recorded iteration visited.
+func (c *Context) ChangedFilesIter(ctx context.Context, fn func(*pull.File) bool) error {
+	if _, ok := c.snapshot.Calls[callKey("ChangedFiles")]; ok {
+		files, err := c.ChangedFiles(ctx)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if !fn(f) {
+				break
+			}
+		}
+		return nil
+	}
+
+	key := callKey("ChangedFilesIter")
+	call, ok := c.snapshot.Calls[key]
+	if !ok {
+		return errors.Errorf("%s was not recorded in the snapshot", key)
+	}
+
+	var iter changedFilesIter
+	if call.Value != nil {
+		if err := json.Unmarshal(call.Value, &iter); err != nil {
+			return errors.Wrapf(err, "failed to decode recorded result of %s", key)
+		}
+	}
+	for _, f := range iter.Files {
+		if !fn(f) {
+			return nil
+		}
+	}
+	if call.Error != "" {
+		return errors.New(call.Error)
+	}
+	if !iter.Complete {
+		return errors.Errorf("%s did not record all changed files", key)
+	}
+	return nil
+}
+
+func (c *Context) FileContents(ctx context.Context, path string) (*pull.FileContents, error) {
+	var v *pull.FileContents
+	err := c.load(callKey("FileContents", path), &v)
+	return v, err
+}
+
+func (c *Context) BaseFileContent(ctx context.Context, path string) ([]byte, error) {
+	var v []byte
+	err := c.load(callKey("BaseFileContent", path), &v)
+	return v, err
+}
+
+func (c *Context) RefFileContent(ctx context.Context, path, ref string) ([]byte, error) {
+	var v []byte
+	err := c.load(callKey("RefFileContent", path, ref), &v)
+	return v, err
+}
+
+func (c *Context) Commits(ctx context.Context) ([]*pull.Commit, error) {
+	var v []*pull.Commit
+	err := c.load(callKey("Commits"), &v)
+	return v, err
+}
+
+func (c *Context) Comments(ctx context.Context) ([]*pull.Comment, error) {
+	var v []*pull.Comment
+	err := c.load(callKey("Comments"), &v)
+	return v, err
+}
+
+func (c *Context) Reviews(ctx context.Context) ([]*pull.Review, error) {
+	var v []*pull.Review
+	err := c.load(callKey("Reviews"), &v)
+	return v, err
+}
+
+func (c *Context) RequestedReviewers(ctx context.Context) (*pull.ReviewRequests, error) {
+	var v *pull.ReviewRequests
+	err := c.load(callKey("RequestedReviewers"), &v)
+	return v, err
+}
+
+func (c *Context) Branches(ctx context.Context) (string, string, error) {
+	var v []string
+	if err := c.load(callKey("Branches"), &v); err != nil {
+		return "", "", err
+	}
+	if len(v) != 2 {
+		return "", "", errors.New("recorded result of Branches() is invalid")
+	}
+	return v[0], v[1], nil
+}
+
+func (c *Context) BaseChangedAt(ctx context.Context) (time.Time, error) {
+	var v time.Time
+	err := c.load(callKey("BaseChangedAt"), &v)
+	return v, err
+}
+
+func (c *Context) ReviewThreads(ctx context.Context) ([]*pull.ReviewThread, error) {
+	var v []*pull.ReviewThread
+	err := c.load(callKey("ReviewThreads"), &v)
+	return v, err
+}
+
+func (c *Context) TargetCommits(ctx context.Context) ([]*pull.Commit, error) {
+	var v []*pull.Commit
+	err := c.load(callKey("TargetCommits"), &v)
+	return v, err
+}
+
+func (c *Context) Timeline(ctx context.Context) ([]*pull.TimelineEvent, error) {
+	var v []*pull.TimelineEvent
+	err := c.load(callKey("Timeline"), &v)
+	return v, err
+}
+
+func (c *Context) BranchPullRequest(ctx context.Context, branch string) (*pull.PullRequestRef, error) {
+	var v *pull.PullRequestRef
+	err := c.load(callKey("BranchPullRequest", branch), &v)
+	return v, err
+}
+
+func (c *Context) AuthorMergedPullRequests(ctx context.Context, since time.Time) (int, error) {
+	var v int
+	err := c.load(callKey("AuthorMergedPullRequests", mergedSinceArg(c.start, since)), &v)
+	return v, err
+}
+
+func (c *Context) CommitChangedFiles(ctx context.Context, sha string) ([]*pull.File, error) {
+	var v []*pull.File
+	err := c.load(callKey("CommitChangedFiles", sha), &v)
+	return v, err
+}
+
+func (c *Context) Blame(ctx context.Context, path string, lines []int) (map[int]*pull.BlameLine, error) {
+	var v map[int]*pull.BlameLine
+	err := c.load(callKey("Blame", path, linesArg(lines)), &v)
+	return v, err
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot records the pull request data used by an evaluation and
+// its result, so that operators can replay the evaluation offline to debug
+// results that cannot be reproduced.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/store"
+)
+
+const (
+	DefaultRetention = 7 * 24 * time.Hour
+
+	// pruneInterval is the minimum time between removals of expired
+	// snapshots.
+	pruneInterval = time.Hour
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type Config struct {
+	// Directory is where snapshots are written. Snapshots are disabled if it
+	// is empty.
+	Directory string `yaml:"directory"`
+
+	// Encryption encrypts snapshots with the same key files as the store.
+	// Snapshots contain pull request content, like patches and comments, so
+	// they should be encrypted if the directory is not private.
+	Encryption store.EncryptionConfig `yaml:"encryption"`
+
+	// Retention is how long to keep snapshots. If unset, DefaultRetention is
+	// used.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func (c *Config) IsEnabled() bool {
+	return c.Directory != ""
+}
+
+// Snapshot is the pull request data used by an evaluation and its result.
+type Snapshot struct {
+	Locator     string    `json:"locator"`
+	Owner       string    `json:"owner"`
+	Repository  string    `json:"repository"`
+	HeadSHA     string    `json:"head_sha"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+
+	// Policy is the content of the evaluated policy file, if known.
+	Policy string `json:"policy,omitempty"`
+
+	// Calls maps the pull request context methods called by the evaluation,
+	// with their arguments, to their results.
+	Calls map[string]*Call `json:"calls"`
+
+	Result *Result `json:"result"`
+}
+
+// Call is the result of a pull request context method.
+type Call struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// Result is a recorded evaluation result. The status is "error" and the
+// description is the error message if the evaluation failed.
+type Result struct {
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Description string    `json:"description,omitempty"`
+	Approvers   []string  `json:"approvers,omitempty"`
+	Children    []*Result `json:"children,omitempty"`
+}
+
+// NewResult converts an evaluation result.
+func NewResult(res *common.Result) *Result {
+	r := &Result{
+		Name:        res.Name,
+		Status:      res.Status.String(),
+		Description: res.Description,
+		Approvers:   res.Approvers,
+	}
+	if res.Error != nil {
+		r.Status = "error"
+		r.Description = res.Error.Error()
+	}
+	for _, c := range res.Children {
+		r.Children = append(r.Children, NewResult(c))
+	}
+	return r
+}
+
+// Diff returns the differences between a recorded and a replayed result, one
+// line per result that changed. Results are matched by name.
+func Diff(recorded, replayed *Result) []string {
+	var diffs []string
+	diffResults(&diffs, recorded.Name, recorded, replayed)
+	return diffs
+}
+
+func diffResults(diffs *[]string, path string, a, b *Result) {
+	switch {
+	case a.Status != b.Status:
+		*diffs = append(*diffs, fmt.Sprintf("%s: %s -> %s (%s)", path, a.Status, b.Status, b.Description))
+	case a.Description != b.Description:
+		*diffs = append(*diffs, fmt.Sprintf("%s: description %q -> %q", path, a.Description, b.Description))
+	case strings.Join(a.Approvers, ",") != strings.Join(b.Approvers, ","):
+		*diffs = append(*diffs, fmt.Sprintf("%s: approvers %q -> %q", path, a.Approvers, b.Approvers))
+	}
+
+	children := make(map[string]*Result, len(b.Children))
+	for _, c := range b.Children {
+		children[c.Name] = c
+	}
+	for _, c := range a.Children {
+		childPath := path + "/" + c.Name
+		if other, ok := children[c.Name]; ok {
+			diffResults(diffs, childPath, c, other)
+			delete(children, c.Name)
+		} else {
+			*diffs = append(*diffs, fmt.Sprintf("%s: not in the replayed result", childPath))
+		}
+	}
+
+	var added []string
+	for name := range children {
+		added = append(added, name)
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		*diffs = append(*diffs, fmt.Sprintf("%s/%s: not in the recorded result", path, name))
+	}
+}
+
+// Writer writes snapshots to the configured directory, one file for each
+// head commit of a pull request. Writing a snapshot for a commit replaces any
+// earlier snapshot for the same commit.
+type Writer struct {
+	config Config
+	cipher *store.Cipher
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewWriter creates a Writer for the configuration.
+func NewWriter(c Config) (*Writer, error) {
+	if c.Retention <= 0 {
+		c.Retention = DefaultRetention
+	}
+	if err := os.MkdirAll(c.Directory, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create snapshot directory")
+	}
+
+	w := &Writer{config: c}
+	if c.Encryption.IsEnabled() {
+		cipher, err := store.NewCipher(c.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		w.cipher = cipher
+	}
+	return w, nil
+}
+
+// Write writes the snapshot and returns the path of the file.
+func (w *Writer) Write(s *Snapshot) (string, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode snapshot")
+	}
+	if w.cipher != nil {
+		if b, err = w.cipher.Encrypt(b); err != nil {
+			return "", err
+		}
+	}
+
+	name := unsafeNameChars.ReplaceAllString(fmt.Sprintf("%s-%s", s.Locator, s.HeadSHA), "_") + ".json"
+	path := filepath.Join(w.config.Directory, name)
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return "", errors.Wrap(err, "failed to write snapshot")
+	}
+
+	w.prune()
+	return path, nil
+}
+
+// prune removes snapshots older than the retention, at most once per
+// pruneInterval.
+func (w *Writer) prune() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(w.lastPruned) < pruneInterval {
+		return
+	}
+	w.lastPruned = now
+
+	files, err := ioutil.ReadDir(w.config.Directory)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") && now.Sub(f.ModTime()) > w.config.Retention {
+			_ = os.Remove(filepath.Join(w.config.Directory, f.Name()))
+		}
+	}
+}
+
+// Read reads a snapshot file, decrypting it with the keys in the
+// configuration if it is encrypted.
+func Read(path string, c store.EncryptionConfig) (*Snapshot, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read snapshot")
+	}
+	if store.IsEncrypted(b) {
+		if !c.IsEnabled() {
+			return nil, errors.New("snapshot is encrypted, but no key files were given")
+		}
+		cipher, err := store.NewCipher(c)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = cipher.Decrypt(b); err != nil {
+			return nil, err
+		}
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrap(err, "failed to parse snapshot")
+	}
+	return &s, nil
+}
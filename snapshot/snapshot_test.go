@@ -0,0 +1,190 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+	"github.com/palantir/policy-bot/store"
+)
+
+const testPolicy = `
+policy:
+  approval:
+    - or:
+      - docs only
+      - code review
+approval_rules:
+  - name: docs only
+    if:
+      only_changed_files:
+        paths: ["^docs/.*$"]
+  - name: code review
+    requires:
+      count: 1
+      teams: ["org/reviewers"]
+`
+
+const changedPolicy = `
+policy:
+  approval:
+    - code review
+approval_rules:
+  - name: code review
+    requires:
+      count: 1
+      teams: ["org/admins"]
+`
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+
+	prctx := pulltest.New().
+		WithLocator("palantir/policy-bot#1").
+		WithHeadSHA("abc123").
+		WithRepository("palantir", "policy-bot").
+		WithAuthor("mhaypenny").
+		WithFiles(&pull.File{Filename: "app/main.go"}).
+		WithComments(&pull.Comment{Author: "ttest", Body: ":+1:"}).
+		WithTeams("ttest", "org/reviewers").
+		Build()
+
+	rec := NewRecorder(prctx)
+	recorded := evaluate(t, testPolicy, rec)
+	require.Equal(t, common.StatusApproved, recorded.Status)
+
+	dir, err := ioutil.TempDir("", "policy-bot-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "snapshot.key")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(key), 0600))
+	encryption := store.EncryptionConfig{KeyFiles: []string{keyFile}}
+
+	w, err := NewWriter(Config{Directory: filepath.Join(dir, "snapshots"), Encryption: encryption})
+	require.NoError(t, err)
+
+	path, err := w.Write(rec.Snapshot(testPolicy, &recorded))
+	require.NoError(t, err)
+	assert.Equal(t, "palantir_policy-bot_1-abc123.json", filepath.Base(path))
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(content, []byte("mhaypenny")), "snapshot contains plaintext data")
+
+	_, err = Read(path, store.EncryptionConfig{})
+	assert.EqualError(t, err, "snapshot is encrypted, but no key files were given")
+
+	s, err := Read(path, encryption)
+	require.NoError(t, err)
+	assert.Equal(t, "palantir/policy-bot#1", s.Locator)
+	assert.Equal(t, testPolicy, s.Policy)
+
+	t.Run("samePolicy", func(t *testing.T) {
+		replayed := evaluate(t, s.Policy, NewContext(s))
+		assert.Empty(t, Diff(s.Result, NewResult(&replayed)))
+	})
+
+	t.Run("changedPolicy", func(t *testing.T) {
+		replayed := evaluate(t, changedPolicy, NewContext(s))
+		diffs := Diff(s.Result, NewResult(&replayed))
+		require.Len(t, diffs, 4)
+		assert.Contains(t, diffs[0], `policy: approved -> error`)
+		assert.Contains(t, diffs[0], `IsTeamMember("org/admins", "ttest") was not recorded in the snapshot`)
+	})
+
+	t.Run("partialChangedFilesIter", func(t *testing.T) {
+		// the "docs only" rule stopped at the first file that did not match
+		c := NewContext(s)
+
+		var files []string
+		err := c.ChangedFilesIter(ctx, func(f *pull.File) bool {
+			files = append(files, f.Filename)
+			return false
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"app/main.go"}, files)
+
+		err = c.ChangedFilesIter(ctx, func(f *pull.File) bool { return true })
+		assert.EqualError(t, err, "ChangedFilesIter() did not record all changed files")
+	})
+}
+
+func TestDiff(t *testing.T) {
+	recorded := &Result{
+		Name:   "policy",
+		Status: "approved",
+		Children: []*Result{
+			{Name: "a", Status: "approved", Approvers: []string{"ttest"}},
+			{Name: "b", Status: "skipped"},
+		},
+	}
+	replayed := &Result{
+		Name:   "policy",
+		Status: "approved",
+		Children: []*Result{
+			{Name: "a", Status: "approved", Approvers: []string{"mhaypenny"}},
+			{Name: "c", Status: "pending", Description: "0/1 approvals required"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		`policy/a: approvers ["ttest"] -> ["mhaypenny"]`,
+		"policy/b: not in the replayed result",
+		"policy/c: not in the recorded result",
+	}, Diff(recorded, replayed))
+}
+
+func TestReplayMissingCall(t *testing.T) {
+	c := NewContext(&Snapshot{Calls: map[string]*Call{
+		callKey("IsTeamMember", "org/reviewers", "ttest"): {Value: []byte("true")},
+		callKey("Title"): {Error: "failed to load title"},
+	}})
+	ctx := context.Background()
+
+	member, err := c.IsTeamMember(ctx, "org/reviewers", "ttest")
+	require.NoError(t, err)
+	assert.True(t, member)
+
+	_, err = c.IsTeamMember(ctx, "org/reviewers", "mhaypenny")
+	assert.EqualError(t, err, `IsTeamMember("org/reviewers", "mhaypenny") was not recorded in the snapshot`)
+
+	_, err = c.Title(ctx)
+	assert.EqualError(t, err, "failed to load title")
+}
+
+func evaluate(t *testing.T, policyYAML string, prctx pull.Context) common.Result {
+	config, err := policy.ParseConfig([]byte(policyYAML))
+	require.NoError(t, err)
+
+	evaluator, err := policy.ParsePolicy(config)
+	require.NoError(t, err)
+
+	return evaluator.Evaluate(context.Background(), prctx)
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keySize   = 32
+	keyIDSize = 8
+)
+
+// encryptedMagic starts every encrypted store file. It is followed by the ID
+// of the key, the nonce, and the sealed content.
+var encryptedMagic = []byte("policy-bot-store-v1\n")
+
+type EncryptionConfig struct {
+	// KeyFiles are files that each contain a base64-encoded 256-bit key, like
+	// the output of "openssl rand -base64 32". The first key encrypts the
+	// store and all keys can decrypt it. To rotate keys, add a new key file
+	// first and remove the old file after the server saved the store again.
+	KeyFiles []string `yaml:"key_files"`
+}
+
+func (c *EncryptionConfig) IsEnabled() bool {
+	return len(c.KeyFiles) > 0
+}
+
+type encryptionKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// keyring encrypts with the first key and decrypts with any key.
+type keyring struct {
+	keys []*encryptionKey
+}
+
+// loadKeyring reads the key files in the configuration.
+func loadKeyring(c EncryptionConfig) (*keyring, error) {
+	k := &keyring{}
+	for _, path := range c.KeyFiles {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read key file %s", path)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode key file %s", path)
+		}
+
+		ek, err := newEncryptionKey(key)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid key file "+path)
+		}
+		k.keys = append(k.keys, ek)
+	}
+	return k, nil
+}
+
+// newEncryptionKey creates an AES-GCM key. Its ID is a prefix of the SHA-256
+// hash of the key, so that files record which key encrypted them without
+// revealing it.
+func newEncryptionKey(key []byte) (*encryptionKey, error) {
+	if len(key) != keySize {
+		return nil, errors.Errorf("key must be %d bytes, but is %d bytes", keySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+
+	sum := sha256.Sum256(key)
+	return &encryptionKey{id: sum[:keyIDSize], aead: aead}, nil
+}
+
+// seal encrypts the content with the first key.
+func (k *keyring) seal(content []byte) ([]byte, error) {
+	key := k.keys[0]
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+
+	var b bytes.Buffer
+	b.Write(encryptedMagic)
+	b.Write(key.id)
+	b.Write(nonce)
+	return key.aead.Seal(b.Bytes(), nonce, content, encryptedMagic), nil
+}
+
+// open decrypts data created by seal. It returns true if the data was not
+// encrypted with the first key and should be encrypted again.
+func (k *keyring) open(data []byte) ([]byte, bool, error) {
+	data = data[len(encryptedMagic):]
+	if len(data) < keyIDSize {
+		return nil, false, errors.New("encrypted store file is truncated")
+	}
+	id, data := data[:keyIDSize], data[keyIDSize:]
+
+	for i, key := range k.keys {
+		if !bytes.Equal(key.id, id) {
+			continue
+		}
+
+		n := key.aead.NonceSize()
+		if len(data) < n {
+			return nil, false, errors.New("encrypted store file is truncated")
+		}
+		content, err := key.aead.Open(nil, data[:n], data[n:], encryptedMagic)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to decrypt store file")
+		}
+		return content, i > 0, nil
+	}
+	return nil, false, errors.Errorf("store file is encrypted with unknown key %s", hex.EncodeToString(id))
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// Cipher encrypts and decrypts data in the format of encrypted store files,
+// so that other files written by the server can use the same keys.
+type Cipher struct {
+	keys *keyring
+}
+
+// NewCipher creates a Cipher with the keys in the configuration.
+func NewCipher(c EncryptionConfig) (*Cipher, error) {
+	if !c.IsEnabled() {
+		return nil, errors.New("no key files are configured")
+	}
+	keys, err := loadKeyring(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{keys: keys}, nil
+}
+
+// Encrypt encrypts the data with the first key.
+func (c *Cipher) Encrypt(data []byte) ([]byte, error) {
+	return c.keys.seal(data)
+}
+
+// Decrypt decrypts data encrypted with any of the keys. Data that is not
+// encrypted is returned unchanged.
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	}
+	content, _, err := c.keys.open(data)
+	return content, err
+}
+
+// IsEncrypted returns true if the data was encrypted by a Cipher or is an
+// encrypted store file.
+func IsEncrypted(data []byte) bool {
+	return isEncrypted(data)
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedFile(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "policy-bot-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "store.json")
+	oldKey := writeKeyFile(t, dir, "old.key", 1)
+	newKey := writeKeyFile(t, dir, "new.key", 2)
+
+	// start with a plaintext file to verify that it is encrypted on load
+	plain, err := NewFile(path)
+	require.NoError(t, err)
+	require.NoError(t, plain.Put(ctx, "secret/1", []byte("installation-token"), 0))
+
+	f, err := New(Config{Type: TypeFile, Path: path, Encryption: EncryptionConfig{KeyFiles: []string{oldKey}}})
+	require.NoError(t, err)
+	testStore(t, f)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, isEncrypted(b), "store file is not encrypted")
+	assert.False(t, bytes.Contains(b, []byte("installation-token")), "store file contains plaintext values")
+
+	_, err = NewFile(path)
+	assert.EqualError(t, err, "store file is encrypted, but no keys are configured")
+
+	_, err = New(Config{Type: TypeFile, Path: path, Encryption: EncryptionConfig{KeyFiles: []string{newKey}}})
+	assert.Error(t, err, "store file was decrypted with the wrong key")
+
+	// rotate to the new key while the old key can still decrypt
+	_, err = New(Config{Type: TypeFile, Path: path, Encryption: EncryptionConfig{KeyFiles: []string{newKey, oldKey}}})
+	require.NoError(t, err)
+
+	// the old key is no longer needed after rotation
+	f, err = New(Config{Type: TypeFile, Path: path, Encryption: EncryptionConfig{KeyFiles: []string{newKey}}})
+	require.NoError(t, err)
+
+	v, ok, err := f.Get(ctx, "secret/1")
+	require.NoError(t, err)
+	assert.True(t, ok, "key secret/1 was not persisted")
+	assert.Equal(t, []byte("installation-token"), v)
+}
+
+func TestEncryptionConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy-bot-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key := writeKeyFile(t, dir, "store.key", 1)
+
+	_, err = New(Config{Type: TypeMemory, Encryption: EncryptionConfig{KeyFiles: []string{key}}})
+	assert.EqualError(t, err, "encryption is only supported by the file store")
+
+	short := filepath.Join(dir, "short.key")
+	require.NoError(t, ioutil.WriteFile(short, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600))
+
+	_, err = New(Config{Type: TypeFile, Path: filepath.Join(dir, "store.json"), Encryption: EncryptionConfig{KeyFiles: []string{short}}})
+	assert.EqualError(t, err, "invalid key file "+short+": key must be 32 bytes, but is 5 bytes")
+}
+
+func TestCipher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy-bot-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key := writeKeyFile(t, dir, "store.key", 1)
+
+	_, err = NewCipher(EncryptionConfig{})
+	assert.Error(t, err, "cipher was created without keys")
+
+	c, err := NewCipher(EncryptionConfig{KeyFiles: []string{key}})
+	require.NoError(t, err)
+
+	encrypted, err := c.Encrypt([]byte("snapshot"))
+	require.NoError(t, err)
+	assert.True(t, isEncrypted(encrypted), "data is not encrypted")
+
+	decrypted, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("snapshot"), decrypted)
+
+	plain, err := c.Decrypt([]byte("plaintext"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plaintext"), plain, "plaintext data was changed")
+}
+
+func writeKeyFile(t *testing.T, dir, name string, fill byte) string {
+	path := filepath.Join(dir, name)
+	key := bytes.Repeat([]byte{fill}, keySize)
+	require.NoError(t, ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+	return path
+}
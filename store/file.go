@@ -0,0 +1,155 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// File is a Store that keeps values in memory and writes them to a JSON file
+// after every change, so that state survives server restarts. It is intended
+// for single-instance deployments.
+type File struct {
+	*Memory
+	path string
+
+	// keys encrypts the file. It is nil if the file is not encrypted.
+	keys *keyring
+}
+
+// NewFile creates a File store, loading existing values from path if the
+// file exists.
+func NewFile(path string) (*File, error) {
+	return newFile(path, nil)
+}
+
+// newFile is like NewFile, but encrypts the file with the keys if they are
+// not nil. Files that are not encrypted with the first key, including files
+// that are not encrypted at all, are encrypted again immediately.
+func newFile(path string, keys *keyring) (*File, error) {
+	f := &File{Memory: NewMemory(), path: path, keys: keys}
+
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return f, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "failed to read store file")
+	}
+
+	reencrypt := false
+	switch {
+	case isEncrypted(b) && keys == nil:
+		return nil, errors.New("store file is encrypted, but no keys are configured")
+	case isEncrypted(b):
+		if b, reencrypt, err = keys.open(b); err != nil {
+			return nil, err
+		}
+	case keys != nil:
+		reencrypt = true
+	}
+
+	if err := json.Unmarshal(b, &f.entries); err != nil {
+		return nil, errors.Wrap(err, "failed to parse store file")
+	}
+
+	if reencrypt {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := f.save(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+var _ Store = &File{}
+
+func (f *File) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.put(key, value, ttl)
+	return f.save()
+}
+
+func (f *File) PutIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.putIfAbsent(key, value, ttl) {
+		return false, nil
+	}
+	return true, f.save()
+}
+
+func (f *File) Delete(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.entries[key]; !ok {
+		return nil
+	}
+	delete(f.entries, key)
+	return f.save()
+}
+
+// save writes all entries to the file. The caller must hold the lock.
+func (f *File) save() error {
+	now := time.Now()
+	for k, e := range f.entries {
+		if e.expired(now) {
+			delete(f.entries, k)
+		}
+	}
+
+	b, err := json.Marshal(f.entries)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode store")
+	}
+	if f.keys != nil {
+		if b, err = f.keys.seal(b); err != nil {
+			return errors.WithMessage(err, "failed to encrypt store")
+		}
+	}
+
+	// write to a temporary file and rename to avoid partial writes
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary store file")
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "failed to write store file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write store file")
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Wrap(err, "failed to replace store file")
+	}
+	return nil
+}
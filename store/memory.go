@@ -0,0 +1,126 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// Memory is a Store that keeps all values in memory.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]entry)}
+}
+
+var _ Store = &Memory{}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.put(key, value, ttl)
+	return nil
+}
+
+func (m *Memory) PutIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.putIfAbsent(key, value, ttl), nil
+}
+
+// putIfAbsent sets the value if the key does not exist or has expired. The
+// caller must hold the lock.
+func (m *Memory) putIfAbsent(key string, value []byte, ttl time.Duration) bool {
+	if e, ok := m.entries[key]; ok && !e.expired(time.Now()) {
+		return false
+	}
+	m.put(key, value, ttl)
+	return true
+}
+
+func (m *Memory) put(key string, value []byte, ttl time.Duration) {
+	e := entry{Value: value}
+	if ttl > 0 {
+		e.Expires = time.Now().Add(ttl)
+	}
+	m.entries[key] = e
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *Memory) Scan(ctx context.Context, prefix string, fn func(key string, value []byte) error) error {
+	type kv struct {
+		key   string
+		value []byte
+	}
+
+	// copy matching entries so fn may modify the store
+	m.mu.Lock()
+	now := time.Now()
+	var matches []kv
+	for k, e := range m.entries {
+		if e.expired(now) {
+			delete(m.entries, k)
+			continue
+		}
+		if strings.HasPrefix(k, prefix) {
+			matches = append(matches, kv{k, e.Value})
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].key < matches[j].key })
+	for _, m := range matches {
+		if err := fn(m.key, m.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
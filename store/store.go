@@ -0,0 +1,90 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store persists small amounts of state that must survive across
+// webhook deliveries, like timestamps used by background schedulers.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TypeMemory = "memory"
+	TypeFile   = "file"
+)
+
+// Store is a key-value store with optional expiration. Implementations must
+// be safe for concurrent use.
+type Store interface {
+	// Get returns the value for the key. The boolean is false if the key does
+	// not exist or has expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Put sets the value for the key. If ttl is positive, the key expires
+	// after that duration; otherwise it never expires.
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// PutIfAbsent sets the value for the key if the key does not exist or has
+	// expired, as a single atomic operation. The boolean is true if the value
+	// was set.
+	PutIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// Scan calls fn for each unexpired key with the prefix in lexical order,
+	// stopping at the first error returned by fn.
+	Scan(ctx context.Context, prefix string, fn func(key string, value []byte) error) error
+}
+
+type Config struct {
+	// Type is the store implementation, either "memory" (the default) or
+	// "file". The memory store loses all state when the server restarts.
+	Type string `yaml:"type"`
+
+	// Path is the file used by the "file" store.
+	Path string `yaml:"path"`
+
+	// Encryption encrypts the file used by the "file" store.
+	Encryption EncryptionConfig `yaml:"encryption"`
+}
+
+// New creates the store described by the configuration.
+func New(c Config) (Store, error) {
+	switch c.Type {
+	case "", TypeMemory:
+		if c.Encryption.IsEnabled() {
+			return nil, errors.New("encryption is only supported by the file store")
+		}
+		return NewMemory(), nil
+	case TypeFile:
+		if c.Path == "" {
+			return nil, errors.New("file store must specify a path")
+		}
+		if !c.Encryption.IsEnabled() {
+			return NewFile(c.Path)
+		}
+
+		keys, err := loadKeyring(c.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		return newFile(c.Path, keys)
+	}
+	return nil, errors.Errorf("unknown store type %q", c.Type)
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "a/1", []byte("one"), 0))
+	require.NoError(t, s.Put(ctx, "a/2", []byte("two"), 0))
+	require.NoError(t, s.Put(ctx, "b/1", []byte("three"), 0))
+	require.NoError(t, s.Put(ctx, "a/expired", []byte("gone"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	v, ok, err := s.Get(ctx, "a/1")
+	require.NoError(t, err)
+	assert.True(t, ok, "key a/1 does not exist")
+	assert.Equal(t, []byte("one"), v)
+
+	_, ok, err = s.Get(ctx, "a/expired")
+	require.NoError(t, err)
+	assert.False(t, ok, "expired key exists")
+
+	var keys []string
+	err = s.Scan(ctx, "a/", func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/1", "a/2"}, keys)
+
+	stored, err := s.PutIfAbsent(ctx, "a/1", []byte("other"), 0)
+	require.NoError(t, err)
+	assert.False(t, stored, "existing key was replaced")
+
+	stored, err = s.PutIfAbsent(ctx, "a/expired", []byte("again"), 0)
+	require.NoError(t, err)
+	assert.True(t, stored, "expired key was not replaced")
+
+	v, ok, err = s.Get(ctx, "a/expired")
+	require.NoError(t, err)
+	assert.True(t, ok, "key a/expired does not exist")
+	assert.Equal(t, []byte("again"), v)
+	require.NoError(t, s.Delete(ctx, "a/expired"))
+
+	require.NoError(t, s.Delete(ctx, "a/1"))
+	require.NoError(t, s.Delete(ctx, "missing"))
+
+	_, ok, err = s.Get(ctx, "a/1")
+	require.NoError(t, err)
+	assert.False(t, ok, "deleted key exists")
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy-bot-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "store.json")
+
+	f, err := NewFile(path)
+	require.NoError(t, err)
+	testStore(t, f)
+
+	// verify that values are loaded from the file
+	f, err = NewFile(path)
+	require.NoError(t, err)
+
+	v, ok, err := f.Get(context.Background(), "b/1")
+	require.NoError(t, err)
+	assert.True(t, ok, "key b/1 was not persisted")
+	assert.Equal(t, []byte("three"), v)
+}